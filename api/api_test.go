@@ -0,0 +1,2784 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"pqcd/benchmark"
+	"pqcd/crypto"
+	"pqcd/security"
+)
+
+// newTestHandler returns a handler backed by the default registry
+func newTestHandler(t *testing.T) *CryptoHandler {
+	t.Helper()
+	return NewCryptoHandler(crypto.DefaultRegistry(), benchmark.NewMetricsCollector())
+}
+
+// postJSON runs a handler against a JSON request body
+func postJSON(t *testing.T, handler http.HandlerFunc, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if err := json.NewEncoder(&payload).Encode(body); err != nil {
+		t.Fatalf("Failed to encode request body: %v", err)
+	}
+	req := httptest.NewRequest("POST", path, &payload)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestBatchKeyGen(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.batchWorkers = 8
+
+	rec := postJSON(t, handler.HandleBatchKeyGen(), "/api/keys/batch", BatchKeyGenRequest{
+		Algorithm:    string(crypto.AlgMLKEM768),
+		Count:        50,
+		DecoysPerKey: 3,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Batch key generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var response BatchKeyGenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode batch response: %v", err)
+	}
+	if len(response.Keys) != 50 {
+		t.Fatalf("Expected 50 keys, got %d", len(response.Keys))
+	}
+
+	// Every slot must be filled with a distinct key pair
+	seen := make(map[string]bool)
+	for i, key := range response.Keys {
+		if key.PublicKey == "" || key.PrivateKey == "" {
+			t.Fatalf("Key %d is empty", i)
+		}
+		if seen[key.PublicKey] {
+			t.Errorf("Key %d duplicates an earlier public key", i)
+		}
+		seen[key.PublicKey] = true
+		if len(key.Decoys) != 3 {
+			t.Errorf("Key %d: Expected 3 decoys, got %d", i, len(key.Decoys))
+		}
+	}
+
+	for _, stats := range handler.metrics.GetAllStats() {
+		if stats.Algorithm == crypto.AlgMLKEM768 && stats.Operation == "KeyGen" && stats.Count != 50 {
+			t.Errorf("Expected 50 recorded KeyGen operations, got %d", stats.Count)
+		}
+	}
+}
+
+func TestBatchKeyGenConcurrentRequests(t *testing.T) {
+	handler := newTestHandler(t)
+	batch := handler.HandleBatchKeyGen()
+
+	done := make(chan int, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			var payload bytes.Buffer
+			json.NewEncoder(&payload).Encode(BatchKeyGenRequest{Algorithm: string(crypto.AlgECDH), Count: 10})
+			rec := httptest.NewRecorder()
+			batch(rec, httptest.NewRequest("POST", "/api/keys/batch", &payload))
+			done <- rec.Code
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+		}
+	}
+}
+
+func TestBatchKeyGenLimits(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []BatchKeyGenRequest{
+		{Algorithm: string(crypto.AlgMLKEM768), Count: MaxBatchKeyCount + 1},
+		{Algorithm: string(crypto.AlgMLKEM768), Count: 0},
+		{Algorithm: string(crypto.AlgMLKEM768), Count: 1, DecoysPerKey: -1},
+		{Algorithm: "rot13", Count: 1},
+	}
+	for _, req := range tests {
+		rec := postJSON(t, handler.HandleBatchKeyGen(), "/api/keys/batch", req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %+v, got %d", http.StatusBadRequest, req, rec.Code)
+		}
+	}
+}
+
+func TestBatchWorkerCount(t *testing.T) {
+	t.Setenv("BATCH_WORKER_COUNT", "12")
+	if count := batchWorkerCount(); count != 12 {
+		t.Errorf("Expected 12 workers, got %d", count)
+	}
+
+	t.Setenv("BATCH_WORKER_COUNT", "zero")
+	if count := batchWorkerCount(); count != 4 {
+		t.Errorf("Expected default of 4 workers, got %d", count)
+	}
+}
+
+// newTestKeyStore attaches an in-memory key store to a handler
+func TestBatchSignVerify(t *testing.T) {
+	handler := newTestHandler(t)
+	provider := crypto.NewMLDSA65Provider()
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	messages := []string{"first", "second", "third"}
+
+	rec := postJSON(t, handler.HandleBatchSignVerify(), "/api/sign-verify", BatchSignVerifyRequest{
+		Operation: "sign",
+		Algorithm: string(crypto.AlgMLDSA65),
+		Key:       hex.EncodeToString(keyPair.PrivateKey),
+		Messages:  messages,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Batch signing failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var signed BatchSignVerifyResponse
+	json.NewDecoder(rec.Body).Decode(&signed)
+	if len(signed.Results) != len(messages) {
+		t.Fatalf("Expected %d results, got %d", len(messages), len(signed.Results))
+	}
+	signatures := make([]string, len(messages))
+	for i, result := range signed.Results {
+		if result.Index != i || !result.Valid || result.Signature == "" || result.Error != "" {
+			t.Fatalf("Unexpected sign result %d: %+v", i, result)
+		}
+		signatures[i] = result.Signature
+	}
+
+	// A bad signature fails only its own message
+	signatures[1] = signatures[0]
+	signatures[2] = "not hex"
+	rec = postJSON(t, handler.HandleBatchSignVerify(), "/api/sign-verify", BatchSignVerifyRequest{
+		Operation:  "verify",
+		Algorithm:  string(crypto.AlgMLDSA65),
+		Key:        hex.EncodeToString(keyPair.PublicKey),
+		Messages:   messages,
+		Signatures: signatures,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Batch verification failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var verified BatchSignVerifyResponse
+	json.NewDecoder(rec.Body).Decode(&verified)
+	if len(verified.Results) != len(messages) {
+		t.Fatalf("Expected %d results, got %d", len(messages), len(verified.Results))
+	}
+	if result := verified.Results[0]; !result.Valid || result.Error != "" {
+		t.Errorf("Expected the first signature to verify, got %+v", result)
+	}
+	if result := verified.Results[1]; result.Valid || result.Error != "" {
+		t.Errorf("Expected the second signature not to verify, got %+v", result)
+	}
+	if result := verified.Results[2]; result.Valid || result.Error == "" {
+		t.Errorf("Expected an error for the malformed third signature, got %+v", result)
+	}
+}
+
+func TestBatchSignVerifyLimits(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []BatchSignVerifyRequest{
+		{Operation: "sign", Algorithm: string(crypto.AlgMLDSA65), Key: "00", Messages: make([]string, MaxBatchSignVerifyMessages+1)},
+		{Operation: "sign", Algorithm: string(crypto.AlgMLDSA65), Key: "00"},
+		{Operation: "encrypt", Algorithm: string(crypto.AlgMLDSA65), Key: "00", Messages: []string{"m"}},
+		{Operation: "verify", Algorithm: string(crypto.AlgMLDSA65), Key: "00", Messages: []string{"m"}},
+		{Operation: "sign", Algorithm: "rot13", Key: "00", Messages: []string{"m"}},
+		{Operation: "sign", Algorithm: string(crypto.AlgMLDSA65), Key: "not hex", Messages: []string{"m"}},
+	}
+	for _, req := range tests {
+		rec := postJSON(t, handler.HandleBatchSignVerify(), "/api/sign-verify", req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %+v, got %d", http.StatusBadRequest, req, rec.Code)
+		}
+	}
+}
+
+// countingSignatureProvider counts the calls to Sign and Verify and the most
+// that were in progress at once, holding each call long enough to overlap
+type countingSignatureProvider struct {
+	crypto.SignatureProvider
+	calls, inFlight, maxInFlight atomic.Int32
+}
+
+func (p *countingSignatureProvider) Name() crypto.Algorithm {
+	return "counting-ml-dsa-44"
+}
+
+// track records a call for its duration
+func (p *countingSignatureProvider) track() func() {
+	p.calls.Add(1)
+	current := p.inFlight.Add(1)
+	for {
+		highest := p.maxInFlight.Load()
+		if current <= highest || p.maxInFlight.CompareAndSwap(highest, current) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return func() { p.inFlight.Add(-1) }
+}
+
+func (p *countingSignatureProvider) Sign(ctx context.Context, privateKey, message []byte) ([]byte, error) {
+	defer p.track()()
+	return p.SignatureProvider.Sign(ctx, privateKey, message)
+}
+
+func (p *countingSignatureProvider) Verify(ctx context.Context, publicKey, message, signature []byte) (bool, error) {
+	defer p.track()()
+	return p.SignatureProvider.Verify(ctx, publicKey, message, signature)
+}
+
+func TestBatchSignVerifyLoad(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.batchWorkers = 4
+	provider := &countingSignatureProvider{SignatureProvider: crypto.NewMLDSA44Provider()}
+	handler.Registry().RegisterSignatureProvider(provider)
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	messages := make([]string, MaxBatchSignVerifyMessages)
+	for i := range messages {
+		messages[i] = fmt.Sprintf("document %d", i)
+	}
+	rec := postJSON(t, handler.HandleBatchSignVerify(), "/api/sign-verify", BatchSignVerifyRequest{
+		Operation: "sign",
+		Algorithm: string(provider.Name()),
+		Key:       hex.EncodeToString(keyPair.PrivateKey),
+		Messages:  messages,
+	})
+	var signed BatchSignVerifyResponse
+	json.NewDecoder(rec.Body).Decode(&signed)
+	signatures := make([]string, len(signed.Results))
+	for i, result := range signed.Results {
+		signatures[i] = result.Signature
+	}
+
+	rec = postJSON(t, handler.HandleBatchSignVerify(), "/api/sign-verify", BatchSignVerifyRequest{
+		Operation:  "verify",
+		Algorithm:  string(provider.Name()),
+		Key:        hex.EncodeToString(keyPair.PublicKey),
+		Messages:   messages,
+		Signatures: signatures,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Batch verification failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var verified BatchSignVerifyResponse
+	json.NewDecoder(rec.Body).Decode(&verified)
+	for i, result := range verified.Results {
+		if result.Index != i || !result.Valid {
+			t.Errorf("Expected message %d to verify, got %+v", i, result)
+		}
+	}
+
+	if calls := provider.calls.Load(); calls != 2*MaxBatchSignVerifyMessages {
+		t.Errorf("Expected %d calls, got %d", 2*MaxBatchSignVerifyMessages, calls)
+	}
+	if highest := provider.maxInFlight.Load(); highest < 2 || highest > 4 {
+		t.Errorf("Expected between 2 and 4 calls in progress at once, got %d", highest)
+	}
+}
+
+func newTestKeyStore(t *testing.T, handler *CryptoHandler) *sql.DB {
+	t.Helper()
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	handler.SetKeyStore(db)
+	return db
+}
+
+// insertTestKey stores a key pair row and returns its ID
+func insertTestKey(t *testing.T, db *sql.DB, fingerprint, algorithm string, isReal bool) int64 {
+	t.Helper()
+	result, err := db.Exec(
+		"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real) VALUES (?, ?, ?, ?, ?)",
+		[]byte("public-"+fingerprint), []byte("private-"+fingerprint), fingerprint, algorithm, isReal,
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert key: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+// getKeys runs the list handler with a query string
+func getKeys(t *testing.T, handler *CryptoHandler, query string) (*httptest.ResponseRecorder, KeyListResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.HandleListKeys()(rec, httptest.NewRequest("GET", "/api/keys"+query, nil))
+	var response KeyListResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode key list: %v", err)
+		}
+	}
+	return rec, response
+}
+
+func TestListKeys(t *testing.T) {
+	handler := newTestHandler(t)
+	db := newTestKeyStore(t, handler)
+
+	for i := 0; i < 25; i++ {
+		insertTestKey(t, db, fmt.Sprintf("kyber-%02d", i), "kyber768", true)
+	}
+	for i := 0; i < 5; i++ {
+		insertTestKey(t, db, fmt.Sprintf("decoy-%02d", i), "kyber768", false)
+	}
+	insertTestKey(t, db, "dilithium-00", "dilithium3", true)
+
+	// Defaults return the first page of 20 newest keys
+	_, response := getKeys(t, handler, "")
+	if response.Total != 31 || response.Page != 1 || response.PerPage != 20 {
+		t.Errorf("Expected total 31 on page 1 of 20, got %+v", response)
+	}
+	if len(response.Keys) != 20 {
+		t.Fatalf("Expected 20 keys, got %d", len(response.Keys))
+	}
+	if response.Keys[0].Fingerprint != "dilithium-00" {
+		t.Errorf("Expected newest key first, got %s", response.Keys[0].Fingerprint)
+	}
+
+	// Filters combine and paginate
+	_, response = getKeys(t, handler, "?algorithm=kyber768&is_real=true&page=2&per_page=10")
+	if response.Total != 25 {
+		t.Errorf("Expected 25 real kyber keys, got %d", response.Total)
+	}
+	if len(response.Keys) != 10 {
+		t.Fatalf("Expected 10 keys, got %d", len(response.Keys))
+	}
+	if response.Keys[0].Fingerprint != "kyber-14" {
+		t.Errorf("Expected kyber-14 to start page 2, got %s", response.Keys[0].Fingerprint)
+	}
+	for _, key := range response.Keys {
+		if !key.IsReal || key.Algorithm != "kyber768" {
+			t.Errorf("Key %s does not match the filter", key.Fingerprint)
+		}
+	}
+
+	_, response = getKeys(t, handler, "?is_real=false")
+	if response.Total != 5 {
+		t.Errorf("Expected 5 decoy keys, got %d", response.Total)
+	}
+
+	// Key material must never be returned
+	rec, _ := getKeys(t, handler, "")
+	if bytes.Contains(rec.Body.Bytes(), []byte("private")) {
+		t.Errorf("Key list leaked private key material: %s", rec.Body.String())
+	}
+}
+
+func TestListKeysValidation(t *testing.T) {
+	handler := newTestHandler(t)
+
+	// Without a key store the endpoint is unavailable
+	rec, _ := getKeys(t, handler, "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	newTestKeyStore(t, handler)
+	for _, query := range []string{"?page=0", "?per_page=101", "?per_page=abc", "?is_real=maybe"} {
+		rec, _ := getKeys(t, handler, query)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
+
+// setTestKeyExpiry sets the expiry of a stored key pair
+func setTestKeyExpiry(t *testing.T, db *sql.DB, id int64, expiresAt time.Time) {
+	t.Helper()
+	if _, err := db.Exec("UPDATE key_pairs SET expires_at = ? WHERE id = ?", expiresAt.UTC().Format(sqliteTimestampFormat), id); err != nil {
+		t.Fatalf("Failed to set key expiry: %v", err)
+	}
+}
+
+func TestListKeysByExpiry(t *testing.T) {
+	handler := newTestHandler(t)
+	db := newTestKeyStore(t, handler)
+
+	expiredID := insertTestKey(t, db, "expired", "kyber768", true)
+	setTestKeyExpiry(t, db, expiredID, time.Now().Add(-time.Hour))
+	activeID := insertTestKey(t, db, "active", "kyber768", true)
+	setTestKeyExpiry(t, db, activeID, time.Now().Add(time.Hour))
+	insertTestKey(t, db, "forever", "kyber768", true)
+
+	_, response := getKeys(t, handler, "?status=expired")
+	if response.Total != 1 || response.Keys[0].Fingerprint != "expired" {
+		t.Errorf("Expected only the expired key, got %+v", response.Keys)
+	}
+
+	_, response = getKeys(t, handler, "?status=active")
+	if response.Total != 2 {
+		t.Errorf("Expected the unexpired and non-expiring keys, got %+v", response.Keys)
+	}
+	for _, key := range response.Keys {
+		if key.Fingerprint == "active" && key.ExpiresAt == nil {
+			t.Errorf("Expected the active key to report its expiry")
+		}
+		if key.Fingerprint == "forever" && key.ExpiresAt != nil {
+			t.Errorf("Expected the non-expiring key to have no expiry, got %v", key.ExpiresAt)
+		}
+	}
+
+	_, response = getKeys(t, handler, "")
+	if response.Total != 3 {
+		t.Errorf("Expected all 3 keys without a status filter, got %d", response.Total)
+	}
+
+	rec, _ := getKeys(t, handler, "?status=revoked")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown status, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestKeyTTL(t *testing.T) {
+	r, db := newTestRouter(t)
+
+	activeID := insertTestKey(t, db, "active", "kyber768", true)
+	setTestKeyExpiry(t, db, activeID, time.Now().Add(time.Hour))
+	expiredID := insertTestKey(t, db, "expired", "kyber768", true)
+	setTestKeyExpiry(t, db, expiredID, time.Now().Add(-time.Hour))
+	foreverID := insertTestKey(t, db, "forever", "kyber768", true)
+
+	getTTL := func(id int64) (int, KeyTTLResponse) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/api/keys/%d/ttl", id), nil))
+		var response KeyTTLResponse
+		json.NewDecoder(rec.Body).Decode(&response)
+		return rec.Code, response
+	}
+
+	code, response := getTTL(activeID)
+	if code != http.StatusOK || response.RemainingSeconds == nil {
+		t.Fatalf("Expected a TTL for the active key, got %d %+v", code, response)
+	}
+	if *response.RemainingSeconds < 3590 || *response.RemainingSeconds > 3600 {
+		t.Errorf("Expected about an hour remaining, got %d seconds", *response.RemainingSeconds)
+	}
+
+	if _, response := getTTL(expiredID); response.RemainingSeconds == nil || *response.RemainingSeconds != 0 {
+		t.Errorf("Expected 0 seconds remaining for the expired key, got %+v", response)
+	}
+	if _, response := getTTL(foreverID); response.ExpiresAt != nil || response.RemainingSeconds != nil {
+		t.Errorf("Expected no TTL for the non-expiring key, got %+v", response)
+	}
+	if code, _ := getTTL(999); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing key, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestOpenKeyStoreAddsExpiryColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = legacy.Exec(`CREATE TABLE key_pairs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		public_key BLOB NOT NULL,
+		private_key BLOB NOT NULL,
+		fingerprint VARCHAR(95) NOT NULL,
+		algorithm TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		is_real BOOLEAN DEFAULT 1,
+		tags TEXT,
+		source_ip TEXT
+	)`)
+	if err == nil {
+		_, err = legacy.Exec("INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm) VALUES (x'01', x'02', 'old', 'kyber768')")
+	}
+	legacy.Close()
+	if err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+
+	db, err := OpenKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open legacy key store: %v", err)
+	}
+	defer db.Close()
+
+	id := insertTestKey(t, db, "legacy", "kyber768", true)
+	if key, err := getKey(db, id); err != nil || key.ExpiresAt != nil {
+		t.Errorf("Expected the legacy store to gain expires_at, got %+v %v", key, err)
+	}
+
+	// The table is rebuilt so public keys can be stored without a private key
+	if _, err := importKey(db, "ml-kem-768", []byte("public-only"), nil, ""); err != nil {
+		t.Errorf("Expected the legacy store to accept a key without a private key: %v", err)
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE fingerprint = 'old' AND private_key = x'02'").Scan(&count)
+	if count != 1 {
+		t.Error("Expected existing keys to survive the rebuild")
+	}
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_key_pairs_expires_at'").Scan(&count)
+	if count != 1 {
+		t.Error("Expected the rebuilt table to keep its indexes")
+	}
+}
+
+func TestOpenKeyStoreConvertsCommaSeparatedTags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := OpenKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	tagged := insertTestKey(t, db, testFingerprint("F2", 0), "kyber768", true)
+	single := insertTestKey(t, db, testFingerprint("F2", 1), "kyber768", true)
+	empty := insertTestKey(t, db, testFingerprint("F2", 2), "kyber768", true)
+	untagged := insertTestKey(t, db, testFingerprint("F2", 3), "kyber768", true)
+	current := insertTestKey(t, db, testFingerprint("F2", 4), "kyber768", true)
+	for id, tags := range map[int64]string{
+		tagged:  "production,us-east-1",
+		single:  "123",
+		empty:   "",
+		current: `["hsm"]`,
+	} {
+		if err := updateKeyTags(db, id, tags); err != nil {
+			t.Fatalf("Failed to tag key %d: %v", id, err)
+		}
+	}
+	db.Close()
+
+	// Reopening converts the comma-separated tags written by older versions
+	db, err = OpenKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen key store: %v", err)
+	}
+	defer db.Close()
+
+	want := map[int64]string{
+		tagged:   "production,us-east-1",
+		single:   "123",
+		empty:    "",
+		untagged: "",
+		current:  "hsm",
+	}
+	for id, tags := range want {
+		key, err := getKey(db, id)
+		if err != nil {
+			t.Errorf("Failed to read key %d: %v", id, err)
+			continue
+		}
+		if strings.Join(key.Tags, ",") != tags {
+			t.Errorf("Expected key %d tagged %q, got %q", id, tags, key.Tags)
+		}
+	}
+	var stored string
+	db.QueryRow("SELECT tags FROM key_pairs WHERE id = ?", tagged).Scan(&stored)
+	if stored != `["production","us-east-1"]` {
+		t.Errorf("Expected tags stored as a JSON array, got %s", stored)
+	}
+}
+
+// newTestRouter registers every route against an in-memory key store
+func newTestRouter(t *testing.T) (*mux.Router, *sql.DB) {
+	t.Helper()
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleAdmin))
+	RegisterRoutes(r, db, nil)
+	return r, db
+}
+
+// withTestUser authenticates every request as a user with the given role, in
+// place of the authentication middleware
+func withTestUser(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(security.WithUser(r.Context(), security.User{Name: "test", Role: role})))
+		})
+	}
+}
+
+// testFingerprint builds a colon-separated fingerprint from a prefix and suffix octet
+func testFingerprint(prefix string, suffix byte) string {
+	octets := make([]string, 0, 32)
+	for i := 0; i < 31; i++ {
+		octets = append(octets, prefix)
+	}
+	return strings.Join(append(octets, fmt.Sprintf("%02X", suffix)), ":")
+}
+
+func TestDeleteKey(t *testing.T) {
+	r, db := newTestRouter(t)
+
+	realID := insertTestKey(t, db, testFingerprint("AA", 0), "kyber768", true)
+	insertTestKey(t, db, testFingerprint("AA", 1), "kyber768", false)
+	insertTestKey(t, db, testFingerprint("AA", 2), "kyber768", false)
+	otherID := insertTestKey(t, db, testFingerprint("BB", 1), "kyber768", false)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("DELETE", fmt.Sprintf("/api/keys/%d", realID), nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+
+	// The real key and its two decoys are gone, the unrelated decoy remains
+	var remaining []int64
+	rows, err := db.Query("SELECT id FROM key_pairs")
+	if err != nil {
+		t.Fatalf("Failed to query keys: %v", err)
+	}
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		remaining = append(remaining, id)
+	}
+	rows.Close()
+	if len(remaining) != 1 || remaining[0] != otherID {
+		t.Errorf("Expected only key %d to remain, got %v", otherID, remaining)
+	}
+
+	var severity string
+	var relatedID int64
+	err = db.QueryRow("SELECT severity, related_item_id FROM event_logs WHERE event_type = 'key_deletion'").Scan(&severity, &relatedID)
+	if err != nil {
+		t.Fatalf("Expected a key deletion event: %v", err)
+	}
+	if severity != "CRITICAL" || relatedID != realID {
+		t.Errorf("Expected CRITICAL event for key %d, got %s for key %d", realID, severity, relatedID)
+	}
+
+	// Deleting it again reports that it no longer exists
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("DELETE", fmt.Sprintf("/api/keys/%d", realID), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestGetKeyDecoys(t *testing.T) {
+	r, db := newTestRouter(t)
+
+	realFingerprint := testFingerprint("AA", 0)
+	realID := insertTestKey(t, db, realFingerprint, "kyber768", true)
+	otherFingerprint := testFingerprint("DD", 0)
+	insertTestKey(t, db, otherFingerprint, "kyber768", true)
+	// One decoy from before origins were recorded, matched on its prefix, and
+	// two linked by origin, only one of which belongs to the key
+	legacyID := insertTestKey(t, db, testFingerprint("AA", 1), "kyber768", false)
+	linkedID := insertTestKey(t, db, testFingerprint("BB", 1), "kyber768", false)
+	otherID := insertTestKey(t, db, testFingerprint("AA", 2), "kyber768", false)
+	db.Exec("UPDATE key_pairs SET origin_fingerprint = ? WHERE id = ?", realFingerprint, linkedID)
+	db.Exec("UPDATE key_pairs SET origin_fingerprint = ? WHERE id = ?", otherFingerprint, otherID)
+
+	rec := serveJSON(t, r, "GET", "/api/keys/"+realFingerprint+"/decoys", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var response DecoyKeyListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode decoy list: %v", err)
+	}
+	if response.RealFingerprint != realFingerprint || len(response.Decoys) != 2 ||
+		response.Decoys[0].ID != legacyID || response.Decoys[1].ID != linkedID || response.Decoys[1].IsReal {
+		t.Errorf("Expected decoys %d and %d of %s, got %+v", legacyID, linkedID, realFingerprint, response)
+	}
+
+	// Decoys aren't real keys, so they have no decoys of their own
+	for _, fingerprint := range []string{testFingerprint("BB", 1), testFingerprint("EE", 0)} {
+		if rec := serveJSON(t, r, "GET", "/api/keys/"+fingerprint+"/decoys", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", fingerprint, http.StatusNotFound, rec.Code)
+		}
+	}
+
+	// Deleting the key takes the decoys linked by origin with it
+	if rec := serveJSON(t, r, "DELETE", fmt.Sprintf("/api/keys/%d", realID), nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	var remaining int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE id IN (?, ?, ?)", legacyID, linkedID, otherID).Scan(&remaining)
+	if remaining != 1 {
+		t.Errorf("Expected only the other key's decoy to remain, got %d keys", remaining)
+	}
+}
+
+func TestRouteRoles(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		role   string // Least privileged role allowed
+		status int    // Status once allowed
+	}{
+		{"GET", "/api/keys", security.RoleReadonly, http.StatusOK},
+		{"GET", "/api/algorithms", security.RoleReadonly, http.StatusOK},
+		{"GET", "/api/status/algorithms", security.RoleReadonly, http.StatusOK},
+		{"GET", "/api/ws/threats", security.RoleReadonly, http.StatusServiceUnavailable},
+		{"GET", "/api/keys/aa:bb/usage", security.RoleReadonly, http.StatusOK},
+		{"GET", "/api/metrics/sla", security.RoleReadonly, http.StatusOK},
+		{"POST", "/api/keys/1/derive-symmetric", security.RoleUser, http.StatusServiceUnavailable},
+		{"POST", "/api/keys/bundle/generate", security.RoleUser, http.StatusServiceUnavailable},
+		{"POST", "/api/ml-kem-768/keygen", security.RoleUser, http.StatusOK},
+		{"POST", "/api/ml-dsa-44/sign", security.RoleUser, http.StatusBadRequest},
+		{"POST", "/api/sign-verify", security.RoleUser, http.StatusBadRequest},
+		{"POST", "/api/demo/key-agreement", security.RoleUser, http.StatusBadRequest},
+		{"POST", "/api/encrypt", security.RoleUser, http.StatusBadRequest},
+		{"GET", "/api/benchmark/run?iterations=0", security.RoleUser, http.StatusBadRequest},
+		{"GET", "/api/keys/%d/exportable", security.RoleReadonly, http.StatusOK},
+		{"POST", "/api/keys/import", security.RoleUser, http.StatusBadRequest},
+		{"POST", "/api/keys/%d/rotate", security.RoleAdmin, http.StatusServiceUnavailable},
+		{"POST", "/api/admin/purge-threats", security.RoleAdmin, http.StatusServiceUnavailable},
+		{"GET", "/api/admin/event-logs/export", security.RoleAdmin, http.StatusOK},
+		{"GET", "/api/keys/aa:bb/decoys", security.RoleAdmin, http.StatusNotFound},
+		{"DELETE", "/api/keys/%d", security.RoleAdmin, http.StatusNoContent},
+	}
+	ranks := map[string]int{security.RoleReadonly: 1, security.RoleUser: 2, security.RoleAdmin: 3}
+
+	for _, role := range []string{security.RoleReadonly, security.RoleUser, security.RoleAdmin} {
+		db, err := OpenKeyStore(":memory:")
+		if err != nil {
+			t.Fatalf("Failed to open key store: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		r := mux.NewRouter()
+		r.Use(withTestUser(role))
+		RegisterRoutes(r, db, nil)
+		id := insertTestKey(t, db, testFingerprint("CC", 0), "kyber768", true)
+
+		for _, tc := range tests {
+			path := tc.path
+			if strings.Contains(path, "%d") {
+				path = fmt.Sprintf(path, id)
+			}
+			want := tc.status
+			if ranks[role] < ranks[tc.role] {
+				want = http.StatusForbidden
+			}
+			if rec := serveJSON(t, r, tc.method, path, nil); rec.Code != want {
+				t.Errorf("%s %s as %s: Expected status %d, got %d", tc.method, path, role, want, rec.Code)
+			}
+		}
+
+		rec := serveJSON(t, r, "GET", "/api/whoami", nil)
+		var user security.User
+		if err := json.NewDecoder(rec.Body).Decode(&user); err != nil || user.Role != role {
+			t.Errorf("Expected whoami to report role %s, got %d %+v", role, rec.Code, user)
+		}
+	}
+
+	// Without the authentication middleware nobody is authenticated
+	r := mux.NewRouter()
+	RegisterRoutes(r, nil, nil)
+	if rec := serveJSON(t, r, "GET", "/api/algorithms", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unauthenticated request, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestZeroise(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	defer db.Close()
+	id := insertTestKey(t, db, "zeroise", "kyber768", true)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	if err := zeroise(tx, "id = ?", id); err != nil {
+		t.Fatalf("Zeroise failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	var publicKey, privateKey []byte
+	if err := db.QueryRow("SELECT public_key, private_key FROM key_pairs WHERE id = ?", id).Scan(&publicKey, &privateKey); err != nil {
+		t.Fatalf("Failed to read key: %v", err)
+	}
+	if !bytes.Equal(privateKey, make([]byte, len("private-zeroise"))) {
+		t.Errorf("Expected zeroed private key of original length, got %x", privateKey)
+	}
+	if !bytes.Equal(publicKey, make([]byte, len("public-zeroise"))) {
+		t.Errorf("Expected zeroed public key of original length, got %x", publicKey)
+	}
+}
+
+// serveJSON runs a request with a JSON body through a router
+func serveJSON(t *testing.T, r *mux.Router, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("Failed to encode request body: %v", err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, path, &payload))
+	return rec
+}
+
+func TestKeyTagsCRUD(t *testing.T) {
+	r, db := newTestRouter(t)
+
+	// Create
+	id := insertTestKey(t, db, testFingerprint("CC", 0), "kyber768", true)
+	insertTestKey(t, db, testFingerprint("DD", 0), "kyber768", true)
+
+	// Update
+	rec := serveJSON(t, r, "PUT", fmt.Sprintf("/api/keys/%d/tags", id), UpdateKeyTagsRequest{
+		Tags: []string{"production", "us-east-1", "production"},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Tag update failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var key KeySummary
+	if err := json.NewDecoder(rec.Body).Decode(&key); err != nil {
+		t.Fatalf("Failed to decode key summary: %v", err)
+	}
+	if key.ID != id || strings.Join(key.Tags, ",") != "production,us-east-1" {
+		t.Errorf("Expected key %d tagged production,us-east-1, got %+v", id, key)
+	}
+
+	// Read, filtering by tag
+	rec = serveJSON(t, r, "GET", "/api/keys?tag=production", nil)
+	var list KeyListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode key list: %v", err)
+	}
+	if list.Total != 1 || list.Keys[0].ID != id {
+		t.Errorf("Expected only key %d tagged production, got %+v", id, list)
+	}
+
+	// Partial tag names must not match
+	rec = serveJSON(t, r, "GET", "/api/keys?tag=prod", nil)
+	list = KeyListResponse{}
+	json.NewDecoder(rec.Body).Decode(&list)
+	if list.Total != 0 {
+		t.Errorf("Expected no keys tagged prod, got %d", list.Total)
+	}
+
+	// Delete
+	rec = serveJSON(t, r, "DELETE", fmt.Sprintf("/api/keys/%d", id), nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	rec = serveJSON(t, r, "PUT", fmt.Sprintf("/api/keys/%d/tags", id), UpdateKeyTagsRequest{Tags: []string{"gone"}})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for deleted key, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestKeyTagValidation(t *testing.T) {
+	r, db := newTestRouter(t)
+	id := insertTestKey(t, db, testFingerprint("EE", 0), "kyber768", true)
+
+	invalid := [][]string{
+		{"has space"},
+		{"comma,separated"},
+		{""},
+		{strings.Repeat("a", maxTagLength+1)},
+	}
+	for _, tags := range invalid {
+		rec := serveJSON(t, r, "PUT", fmt.Sprintf("/api/keys/%d/tags", id), UpdateKeyTagsRequest{Tags: tags})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusBadRequest, tags, rec.Code)
+		}
+	}
+
+	if _, err := serializeTags([]string{strings.Repeat("a", maxTagLength), "under_score", "Mixed-9"}); err != nil {
+		t.Errorf("Expected valid tags to serialize, got %v", err)
+	}
+	if tags, err := serializeTags([]string{"production", "hsm", "production"}); err != nil || tags != `["production","hsm"]` {
+		t.Errorf("Expected tags to serialize as a JSON array, got %s %v", tags, err)
+	}
+	if tags, err := serializeTags(nil); err != nil || tags != "[]" {
+		t.Errorf("Expected no tags to serialize as an empty array, got %s %v", tags, err)
+	}
+	if tags, err := parseTags(""); err != nil || len(tags) != 0 {
+		t.Errorf("Expected no tags for an empty column, got %v %v", tags, err)
+	}
+	if _, err := parseTags("production,hsm"); err == nil {
+		t.Error("Expected comma-separated tags to be rejected")
+	}
+}
+
+func TestListKeysByTags(t *testing.T) {
+	handler := newTestHandler(t)
+	db := newTestKeyStore(t, handler)
+
+	both := insertTestKey(t, db, testFingerprint("F1", 0), "kyber768", true)
+	production := insertTestKey(t, db, testFingerprint("F1", 1), "kyber768", true)
+	hsm := insertTestKey(t, db, testFingerprint("F1", 2), "kyber768", true)
+	untagged := insertTestKey(t, db, testFingerprint("F1", 3), "kyber768", true)
+	for id, tags := range map[int64][]string{
+		both:       {"production", "hsm"},
+		production: {"production", "us-east-1"},
+		hsm:        {"hsm"},
+		untagged:   {},
+	} {
+		serialized, err := serializeTags(tags)
+		if err == nil {
+			err = updateKeyTags(db, id, serialized)
+		}
+		if err != nil {
+			t.Fatalf("Failed to tag key %d: %v", id, err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"?tags=production,hsm", []int64{both}},
+		{"?tags=production,hsm&tag_mode=all", []int64{both}},
+		{"?tags=production,hsm&tag_mode=any", []int64{hsm, production, both}},
+		{"?tags=us-east-1,hsm&tag_mode=any", []int64{hsm, production, both}},
+		{"?tags=production", []int64{production, both}},
+		{"?tag=hsm", []int64{hsm, both}},
+		{"?tag=hsm&tags=us-east-1&tag_mode=any", []int64{hsm, production, both}},
+		{"?tags=prod,h&tag_mode=any", nil},
+		{"?tags=hsm,missing", nil},
+		{"?tag_mode=any", []int64{untagged, hsm, production, both}},
+	}
+	for _, tt := range tests {
+		rec, response := getKeys(t, handler, tt.query)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", tt.query, http.StatusOK, rec.Code)
+			continue
+		}
+		var ids []int64
+		for _, key := range response.Keys {
+			ids = append(ids, key.ID)
+		}
+		if !slices.Equal(ids, tt.want) || response.Total != len(tt.want) {
+			t.Errorf("%s: expected keys %v, got %v (total %d)", tt.query, tt.want, ids, response.Total)
+		}
+	}
+
+	for _, query := range []string{"?tags=production,", "?tags=has%20space", "?tags=hsm&tag_mode=none"} {
+		if rec, _ := getKeys(t, handler, query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestCryptoErrorStatus(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	// A malformed key is the client's fault
+	rec := serveJSON(t, r, "POST", "/api/ml-kem-768/decapsulate", DecapsulateRequest{PrivateKey: "abcd", Ciphertext: "abcd", Algorithm: string(crypto.AlgMLKEM768)})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	var response ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if response.Code != string(crypto.ErrCodeInvalidKey) {
+		t.Errorf("Expected code %s, got %s", crypto.ErrCodeInvalidKey, response.Code)
+	}
+
+	// So is a ciphertext of the wrong size for the key's algorithm
+	keyPair, err := crypto.NewMLKEM768Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	rec = serveJSON(t, r, "POST", "/api/ml-kem-768/decapsulate", DecapsulateRequest{
+		PrivateKey: hex.EncodeToString(keyPair.PrivateKey),
+		Ciphertext: hex.EncodeToString(make([]byte, 1087)),
+		Algorithm:  string(crypto.AlgMLKEM768),
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a short ciphertext, got %d", http.StatusBadRequest, rec.Code)
+	}
+	response = ErrorResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if response.Code != string(crypto.ErrCodeInvalidKey) || !strings.Contains(response.Error, "must be 1088 bytes, got 1087") {
+		t.Errorf("Expected code %s with the expected and actual sizes, got %s: %s", crypto.ErrCodeInvalidKey, response.Code, response.Error)
+	}
+
+	// Errors without a code are internal failures
+	rec = httptest.NewRecorder()
+	respondWithCryptoError(rec, "operation failed", fmt.Errorf("unexpected"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestEncapsulateValidation(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	tests := []struct {
+		name      string
+		algorithm crypto.Algorithm
+		publicKey []byte
+		want      string
+	}{
+		{"unregistered algorithm", "kyber-512", make([]byte, 800), "unsupported algorithm: kyber-512"},
+		{"short key", crypto.AlgMLKEM768, make([]byte, 512), "public key for ml-kem-768 must be 1184 bytes, got 512"},
+		{"classical key for hybrid", crypto.AlgHybridMLKEMECDH, make([]byte, 65), "public key for hybrid-ml-kem-ecdh must be 1249 bytes, got 65"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(t, r, "POST", "/api/ml-kem-768/encapsulate", EncapsulateRequest{
+				PublicKey: hex.EncodeToString(tt.publicKey),
+				Algorithm: string(tt.algorithm),
+			})
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+			var response ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if response.Error != tt.want {
+				t.Errorf("Expected error %q, got %q", tt.want, response.Error)
+			}
+		})
+	}
+}
+
+func TestOperationLatencyHeader(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	// assertLatency checks rec succeeded and carries a valid latency header
+	assertLatency := func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		latency, err := strconv.ParseInt(rec.Header().Get(OperationLatencyHeader), 10, 64)
+		if err != nil || latency < 0 {
+			t.Errorf("Expected %s to be a non-negative integer, got %q", OperationLatencyHeader, rec.Header().Get(OperationLatencyHeader))
+		}
+	}
+
+	t.Run("kem", func(t *testing.T) {
+		rec := serveJSON(t, r, "POST", "/api/ml-kem-768/keygen", nil)
+		assertLatency(t, rec)
+		var key KeyGenResponse
+		json.NewDecoder(rec.Body).Decode(&key)
+
+		rec = serveJSON(t, r, "POST", "/api/ml-kem-768/encapsulate", EncapsulateRequest{PublicKey: key.PublicKey, Algorithm: key.Algorithm})
+		assertLatency(t, rec)
+		var encapsulated EncapsulateResponse
+		json.NewDecoder(rec.Body).Decode(&encapsulated)
+
+		rec = serveJSON(t, r, "POST", "/api/ml-kem-768/decapsulate", DecapsulateRequest{PrivateKey: key.PrivateKey, Ciphertext: encapsulated.Ciphertext, Algorithm: key.Algorithm})
+		assertLatency(t, rec)
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		rec := serveJSON(t, r, "POST", "/api/ml-dsa-65/keygen", nil)
+		assertLatency(t, rec)
+		var key KeyGenResponse
+		json.NewDecoder(rec.Body).Decode(&key)
+
+		rec = serveJSON(t, r, "POST", "/api/ml-dsa-65/sign", SignRequest{PrivateKey: key.PrivateKey, Message: "hello"})
+		assertLatency(t, rec)
+		var signed SignResponse
+		json.NewDecoder(rec.Body).Decode(&signed)
+
+		rec = serveJSON(t, r, "POST", "/api/ml-dsa-65/verify", VerifyRequest{PublicKey: key.PublicKey, Message: "hello", Signature: signed.Signature})
+		assertLatency(t, rec)
+	})
+
+	t.Run("failed request", func(t *testing.T) {
+		rec := serveJSON(t, r, "POST", "/api/ml-kem-768/encapsulate", EncapsulateRequest{Algorithm: string(crypto.AlgMLKEM768)})
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+		if latency := rec.Header().Get(OperationLatencyHeader); latency != "" {
+			t.Errorf("Expected no latency header on a rejected request, got %q", latency)
+		}
+	})
+}
+
+// flushRecorder records how many lines of the body had been written at each flush
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushedLines []int
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushedLines = append(f.flushedLines, strings.Count(f.Body.String(), "\n"))
+	f.ResponseRecorder.Flush()
+}
+
+func TestDecoyStream(t *testing.T) {
+	handler := newTestHandler(t).HandleDecoyStream()
+	publicKey := make([]byte, 1184)
+	rand.Read(publicKey)
+
+	stream := func(count int) *flushRecorder {
+		t.Helper()
+		body, _ := json.Marshal(DecoyStreamRequest{PublicKey: hex.EncodeToString(publicKey), Algorithm: string(crypto.AlgMLKEM768), Count: count})
+		rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/decoys/generate/stream", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	// Every decoy is delivered, one more line at a time, before the next is generated
+	rec := stream(5)
+	if len(rec.flushedLines) != 6 {
+		t.Fatalf("Expected 6 flushes, got %v", rec.flushedLines)
+	}
+	for i, lines := range rec.flushedLines {
+		if lines != i+1 {
+			t.Errorf("Flush %d: Expected %d lines delivered, got %d", i, i+1, lines)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	seen := map[string]bool{}
+	for i, line := range lines[:5] {
+		var item DecoyStreamItem
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			t.Fatalf("Line %d: Failed to decode decoy: %v", i, err)
+		}
+		decoy, _ := hex.DecodeString(item.PublicKey)
+		if item.Index != i || len(decoy) != len(publicKey) || item.Fingerprint != storedFingerprint(decoy) || item.DoneAt.IsZero() {
+			t.Errorf("Line %d: Unexpected decoy %+v", i, item)
+		}
+		if item.SimilarityScore != 0.75 {
+			t.Errorf("Line %d: Expected a similarity score of 0.75, got %g", i, item.SimilarityScore)
+		}
+		if seen[item.PublicKey] {
+			t.Errorf("Line %d: Expected every decoy to differ", i)
+		}
+		seen[item.PublicKey] = true
+	}
+	var done DecoyStreamDone
+	if err := json.Unmarshal([]byte(lines[5]), &done); err != nil || !done.Done || done.Total != 5 {
+		t.Errorf("Expected a final done line with total 5, got %q", lines[5])
+	}
+
+	// The total is capped
+	rec = stream(500)
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != maxStreamedDecoys+1 {
+		t.Errorf("Expected %d lines, got %d", maxStreamedDecoys+1, lines)
+	}
+
+	for name, req := range map[string]DecoyStreamRequest{
+		"no count":       {PublicKey: hex.EncodeToString(publicKey), Algorithm: string(crypto.AlgMLKEM768)},
+		"wrong key size": {PublicKey: "abcd", Algorithm: string(crypto.AlgMLKEM768), Count: 1},
+		"fraction":       {PublicKey: hex.EncodeToString(publicKey), Algorithm: string(crypto.AlgMLKEM768), Count: 1, HammingFraction: 0.9},
+	} {
+		if rec := postJSON(t, handler, "/api/decoys/generate/stream", req); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: Expected status %d, got %d", name, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestKeyUsageFlagging(t *testing.T) {
+	r, db := newTestRouter(t)
+	provider, _ := crypto.DefaultRegistry().GetKEMProvider(crypto.AlgMLKEM768)
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	fingerprint := storedFingerprint(keyPair.PublicKey)
+	if _, err := db.Exec(
+		"INSERT INTO key_pairs (public_key, fingerprint, algorithm) VALUES (?, ?, ?)",
+		keyPair.PublicKey, fingerprint, "ml-kem-768",
+	); err != nil {
+		t.Fatalf("Failed to insert key: %v", err)
+	}
+
+	encapsulate := EncapsulateRequest{
+		PublicKey: hex.EncodeToString(keyPair.PublicKey),
+		Algorithm: string(crypto.AlgMLKEM768),
+	}
+	flagged := func() bool {
+		var flagged bool
+		if err := db.QueryRow("SELECT flagged FROM key_pairs WHERE fingerprint = ?", fingerprint).Scan(&flagged); err != nil {
+			t.Fatalf("Failed to read flag: %v", err)
+		}
+		return flagged
+	}
+
+	var ciphertext string
+	for i := 0; i < maxHourlyEncapsulations; i++ {
+		rec := serveJSON(t, r, "POST", "/api/ml-kem-768/encapsulate", encapsulate)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Encapsulation %d failed with status %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+		if i == 0 {
+			var response EncapsulateResponse
+			json.NewDecoder(rec.Body).Decode(&response)
+			ciphertext = response.Ciphertext
+		}
+	}
+	if flagged() {
+		t.Fatalf("Expected a key used %d times not to be flagged", maxHourlyEncapsulations)
+	}
+
+	// The 1001st encapsulation within the hour flags the key
+	if rec := serveJSON(t, r, "POST", "/api/ml-kem-768/encapsulate", encapsulate); rec.Code != http.StatusOK {
+		t.Fatalf("Encapsulation failed with status %d", rec.Code)
+	}
+	if !flagged() {
+		t.Fatal("Expected the key to be flagged after 1001 encapsulations")
+	}
+	var warnings int
+	db.QueryRow("SELECT COUNT(*) FROM event_logs WHERE event_type = 'key_flagged' AND severity = 'WARNING' AND related_item_type = 'key_pair'").Scan(&warnings)
+	if warnings != 1 {
+		t.Errorf("Expected 1 warning event, got %d", warnings)
+	}
+
+	rec := serveJSON(t, r, "POST", "/api/ml-kem-768/decapsulate", DecapsulateRequest{
+		PrivateKey: hex.EncodeToString(keyPair.PrivateKey),
+		Ciphertext: ciphertext,
+		Algorithm:  string(crypto.AlgMLKEM768),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Decapsulation failed with status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serveJSON(t, r, "GET", "/api/keys/"+fingerprint+"/usage", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var usage KeyUsageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&usage); err != nil {
+		t.Fatalf("Failed to decode key usage: %v", err)
+	}
+	if !usage.Flagged || usage.Operations[usageEncapsulate].Count != maxHourlyEncapsulations+1 {
+		t.Errorf("Expected a flagged key with %d encapsulations, got %+v", maxHourlyEncapsulations+1, usage)
+	}
+	if usage.Operations[usageEncapsulate].LastUsed.IsZero() {
+		t.Error("Expected the last use to be recorded")
+	}
+
+	if usage.Operations[usageDecapsulate].Count != 1 {
+		t.Errorf("Expected 1 decapsulation of the stored key, got %+v", usage.Operations)
+	}
+
+	// Nothing is recorded under the private key
+	var rows int
+	db.QueryRow("SELECT COUNT(*) FROM key_usage WHERE fingerprint = ?", storedFingerprint(keyPair.PrivateKey)).Scan(&rows)
+	if rows != 0 {
+		t.Errorf("Expected no usage under the private key's fingerprint, got %d rows", rows)
+	}
+}
+
+func TestUsageCounterWindow(t *testing.T) {
+	counter := newUsageCounter()
+	now := time.Now()
+	counter.now = func() time.Time { return now }
+
+	for i := 0; i < maxHourlyEncapsulations; i++ {
+		if counter.Add("aa") {
+			t.Fatalf("Expected encapsulation %d to stay within the limit", i+1)
+		}
+	}
+	if !counter.Add("aa") {
+		t.Error("Expected the encapsulation past the limit to be reported")
+	}
+	if counter.Add("aa") {
+		t.Error("Expected a key to be reported once per window")
+	}
+
+	// A new window starts the count again
+	now = now.Add(usageWindow)
+	if counter.Add("aa") {
+		t.Error("Expected the count to reset after an hour")
+	}
+}
+
+func TestEncryptIdempotency(t *testing.T) {
+	r, _ := newTestRouter(t)
+	provider, _ := crypto.DefaultRegistry().GetKEMProvider(crypto.AlgMLKEM768)
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	body, _ := json.Marshal(EncapsulateRequest{
+		Algorithm: string(crypto.AlgMLKEM768),
+		PublicKey: hex.EncodeToString(keyPair.PublicKey),
+	})
+
+	encrypt := func(key string) EncapsulateResponse {
+		req := httptest.NewRequest("POST", "/api/encrypt", bytes.NewReader(body))
+		if key != "" {
+			req.Header.Set(security.IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Encryption failed: %d %s", rec.Code, rec.Body.String())
+		}
+		var response EncapsulateResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	// Encapsulation is randomized, so only a replay returns the same ciphertext
+	if first, retry := encrypt("attempt-1"), encrypt("attempt-1"); first != retry {
+		t.Error("Expected a retry with the same idempotency key to get the same ciphertext")
+	}
+	if first, second := encrypt(""), encrypt(""); first == second {
+		t.Error("Expected requests without an idempotency key to be encrypted separately")
+	}
+}
+
+func TestTracingSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	// Initialization registers the propagator; spans go to the recorder instead
+	stdoutProvider, err := InitTracerProvider(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer stdoutProvider.Shutdown(context.Background())
+	otel.SetTracerProvider(provider)
+
+	r, _ := newTestRouter(t)
+
+	// Key generation continues the trace propagated by the caller
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/api/ml-dsa-65/keygen", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Key generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var key KeyGenResponse
+	json.NewDecoder(rec.Body).Decode(&key)
+
+	rec = serveJSON(t, r, "POST", "/api/ml-dsa-65/sign", SignRequest{PrivateKey: key.PrivateKey, Message: "traced"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Signing failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	for i, name := range []string{"keygen", "sign"} {
+		span := spans[i]
+		if span.Name() != name {
+			t.Errorf("Span %d: Expected name %s, got %s", i, name, span.Name())
+		}
+		attrs := make(map[string]string)
+		for _, attr := range span.Attributes() {
+			attrs[string(attr.Key)] = attr.Value.Emit()
+		}
+		if attrs["crypto.algorithm"] != string(crypto.AlgMLDSA65) {
+			t.Errorf("Span %s: Expected algorithm attribute %s, got %q", name, crypto.AlgMLDSA65, attrs["crypto.algorithm"])
+		}
+		if len(span.Events()) != 1 {
+			t.Errorf("Span %s: Expected 1 recorded operation event, got %d", name, len(span.Events()))
+		}
+	}
+	if got := spans[0].SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("Expected keygen span in propagated trace %s, got %s", traceID, got)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	for i := 0; i < 3; i++ {
+		rec := serveJSON(t, r, "POST", "/api/ecdh/keygen?cached=true", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Cached key generation failed: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := serveJSON(t, r, "GET", "/api/cache/stats", nil)
+	var stats crypto.KeyCacheStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode cache stats: %v", err)
+	}
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %d and %d", stats.Hits, stats.Misses)
+	}
+}
+
+func TestJitterResponse(t *testing.T) {
+	start := time.Now()
+	jitterResponse(context.Background(), 0, 0)
+	if elapsed := time.Since(start); elapsed > 5*time.Millisecond {
+		t.Errorf("Expected disabled jitter to return immediately, took %v", elapsed)
+	}
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		jitterResponse(context.Background(), 10, 30)
+		elapsed := time.Since(start)
+		if elapsed < 10*time.Millisecond || elapsed > 30*time.Millisecond+20*time.Millisecond {
+			t.Errorf("Expected a delay between 10ms and 30ms, got %v", elapsed)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	jitterResponse(ctx, 1000, 1000)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected a cancelled request to skip the delay, took %v", elapsed)
+	}
+}
+
+func TestJitterOnlyForDeceivedClients(t *testing.T) {
+	handler := newTestHandler(t)
+	engine := security.NewResponseEngine()
+	handler.SetResponseEngine(engine)
+	handler.jitterMinMs, handler.jitterMaxMs = 40, 40
+
+	provider, err := crypto.DefaultRegistry().GetSignatureProvider(crypto.AlgMLDSA65)
+	if err != nil {
+		t.Fatalf("Failed to get signature provider: %v", err)
+	}
+	keys, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/sign/{alg}", handler.HandleSign()).Methods("POST")
+	sign := func() time.Duration {
+		start := time.Now()
+		rec := serveJSON(t, r, "POST", "/api/sign/"+string(crypto.AlgMLDSA65), SignRequest{
+			PrivateKey: hex.EncodeToString(keys.PrivateKey),
+			Message:    "hello",
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Signing failed: %d %s", rec.Code, rec.Body.String())
+		}
+		return time.Since(start)
+	}
+
+	if elapsed := sign(); elapsed >= 40*time.Millisecond {
+		t.Errorf("Expected no jitter for an unflagged client, took %v", elapsed)
+	}
+
+	// httptest requests come from 192.0.2.1
+	engine.ClassifyThreat(security.RequestFeatures{ClientIP: "192.0.2.1"}, "AbnormalLatency", 4.0)
+	if elapsed := sign(); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected a flagged client to be delayed by 40ms, took %v", elapsed)
+	}
+}
+
+func TestDecoyEncapsulation(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.SetResponseEngine(security.NewResponseEngine())
+	handler.jitterMinMs, handler.jitterMaxMs = 0, 0
+
+	provider, _ := crypto.DefaultRegistry().GetKEMProvider(crypto.AlgMLKEM768)
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+
+	encapsulate := func(ctx context.Context) EncapsulateResponse {
+		body, _ := json.Marshal(EncapsulateRequest{
+			Algorithm: string(crypto.AlgMLKEM768),
+			PublicKey: hex.EncodeToString(keyPair.PublicKey),
+		})
+		req := httptest.NewRequest("POST", "/api/encrypt", bytes.NewReader(body)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		handler.HandleEncapsulate()(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Encapsulation failed: %d %s", rec.Code, rec.Body.String())
+		}
+		var response EncapsulateResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	genuine := encapsulate(context.Background())
+	decoy := encapsulate(security.WithDeception(context.Background()))
+	if len(decoy.Ciphertext) != len(genuine.Ciphertext) || len(decoy.SharedSecret) != len(genuine.SharedSecret) {
+		t.Errorf("Expected the decoy to match the real response format, got %d/%d hex chars, want %d/%d",
+			len(decoy.Ciphertext), len(decoy.SharedSecret), len(genuine.Ciphertext), len(genuine.SharedSecret))
+	}
+
+	ciphertext, _ := hex.DecodeString(decoy.Ciphertext)
+	secret, err := provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext)
+	if err != nil {
+		t.Fatalf("Expected the decoy ciphertext to decapsulate, got %v", err)
+	}
+	if hex.EncodeToString(secret) == decoy.SharedSecret {
+		t.Error("Expected the decoy shared secret to be wrong")
+	}
+}
+
+func TestGenerateKeyBundle(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleUser))
+	handler := RegisterRoutes(r, db, nil)
+
+	request := BundleGenerateRequest{KEMAlgorithm: "ml-kem-768", SigAlgorithm: "ml-dsa-65"}
+	if rec := serveJSON(t, r, "POST", "/api/keys/bundle/generate", request); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without key encryption, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	encryptor, err := crypto.NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	handler.SetKeyEncryptor(encryptor)
+
+	rec := serveJSON(t, r, "POST", "/api/keys/bundle/generate", request)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Bundle generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var bundle BundleResponse
+	if err := json.NewDecoder(rec.Body).Decode(&bundle); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if bundle.KEMAlgorithm != "ml-kem-768" || bundle.SigAlgorithm != "ml-dsa-65" {
+		t.Errorf("Unexpected bundle algorithms %s and %s", bundle.KEMAlgorithm, bundle.SigAlgorithm)
+	}
+	if strings.Contains(rec.Body.String(), "private") {
+		t.Errorf("Expected no private keys in the response, got %s", rec.Body.String())
+	}
+	kemPublicKey, _ := hex.DecodeString(bundle.KEMPublicKey)
+	sigPublicKey, _ := hex.DecodeString(bundle.SigPublicKey)
+	hash := sha256.Sum256(append(append([]byte{}, kemPublicKey...), sigPublicKey...))
+	if bundle.Fingerprint != hex.EncodeToString(hash[:]) {
+		t.Errorf("Expected the fingerprint to hash both public keys, got %s", bundle.Fingerprint)
+	}
+
+	// The stored private keys pair with the returned public keys
+	var fingerprint string
+	var storedKEMPublicKey, storedKEMPrivateKey, storedSigPublicKey, storedSigPrivateKey []byte
+	err = db.QueryRow("SELECT fingerprint, kem_public_key, kem_private_key, sig_public_key, sig_private_key FROM key_bundles WHERE id = ?", bundle.ID).
+		Scan(&fingerprint, &storedKEMPublicKey, &storedKEMPrivateKey, &storedSigPublicKey, &storedSigPrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to read stored bundle: %v", err)
+	}
+	if fingerprint != bundle.Fingerprint || !bytes.Equal(storedKEMPublicKey, kemPublicKey) || !bytes.Equal(storedSigPublicKey, sigPublicKey) {
+		t.Error("Expected the stored bundle to match the response")
+	}
+	kemPrivateKey, err := encryptor.DecryptFromStorage(storedKEMPrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to decrypt the stored KEM key: %v", err)
+	}
+	kem := crypto.NewMLKEM768Provider()
+	ciphertext, sharedSecret, err := kem.Encapsulate(context.Background(), kemPublicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	if recovered, err := kem.Decapsulate(context.Background(), kemPrivateKey, ciphertext); err != nil || !crypto.SecureCompare(recovered, sharedSecret) {
+		t.Errorf("Expected the stored KEM key to decapsulate, got %v", err)
+	}
+	sigPrivateKey, err := encryptor.DecryptFromStorage(storedSigPrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to decrypt the stored signature key: %v", err)
+	}
+	signer := crypto.NewMLDSA65Provider()
+	signature, err := signer.Sign(context.Background(), sigPrivateKey, []byte("bundle"))
+	if err != nil {
+		t.Fatalf("Signing failed: %v", err)
+	}
+	if valid, err := signer.Verify(context.Background(), sigPublicKey, []byte("bundle"), signature); err != nil || !valid {
+		t.Errorf("Expected the stored signature key to verify, got %v %v", valid, err)
+	}
+
+	// Each algorithm must be of the right kind
+	for _, invalid := range []BundleGenerateRequest{
+		{KEMAlgorithm: "ml-dsa-65", SigAlgorithm: "ml-dsa-65"},
+		{KEMAlgorithm: "ml-kem-768", SigAlgorithm: "ml-kem-768"},
+		{KEMAlgorithm: "ml-kem-768"},
+	} {
+		if rec := serveJSON(t, r, "POST", "/api/keys/bundle/generate", invalid); rec.Code != http.StatusBadRequest {
+			t.Errorf("%+v: Expected status %d, got %d", invalid, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleAdmin))
+	handler := RegisterRoutes(r, db, nil)
+	encryptor, err := crypto.NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	handler.SetKeyEncryptor(encryptor)
+
+	oldID := insertTestKey(t, db, testFingerprint("EE", 0), "kyber768", true)
+	if err := updateKeyTags(db, oldID, `["production","us-east-1"]`); err != nil {
+		t.Fatalf("Failed to tag key: %v", err)
+	}
+	decoyID := insertTestKey(t, db, testFingerprint("EE", 1), "kyber768", false)
+
+	rec := serveJSON(t, r, "POST", fmt.Sprintf("/api/keys/%d/rotate", oldID), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Rotation failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var response KeyRotationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode rotation response: %v", err)
+	}
+
+	// The new key is distinct but keeps the algorithm and tags
+	if response.New.ID == oldID || response.New.Fingerprint == response.Old.Fingerprint {
+		t.Errorf("Expected a distinct replacement key, got %+v", response.New)
+	}
+	if response.New.Algorithm != "kyber768" || strings.Join(response.New.Tags, ",") != "production,us-east-1" {
+		t.Errorf("Expected the replacement to keep the algorithm and tags, got %+v", response.New)
+	}
+	if response.Old.SupersededBy == nil || *response.Old.SupersededBy != response.New.ID {
+		t.Errorf("Expected the old key to point at the replacement, got %+v", response.Old)
+	}
+
+	// The old key stays queryable with its key material intact
+	old, err := getKey(db, oldID)
+	if err != nil {
+		t.Fatalf("Expected the old key to remain: %v", err)
+	}
+	if old.Fingerprint != testFingerprint("EE", 0) {
+		t.Errorf("Expected the old key to be unchanged, got %+v", old)
+	}
+	var oldPrivate []byte
+	db.QueryRow("SELECT private_key FROM key_pairs WHERE id = ?", oldID).Scan(&oldPrivate)
+	if string(oldPrivate) != "private-"+testFingerprint("EE", 0) {
+		t.Errorf("Expected the old private key to be kept for decryption")
+	}
+
+	// The replacement is a real ML-KEM-768 key, stored encrypted
+	var storedPrivate []byte
+	db.QueryRow("SELECT private_key FROM key_pairs WHERE id = ?", response.New.ID).Scan(&storedPrivate)
+	privateKey, err := encryptor.DecryptFromStorage(storedPrivate)
+	if err != nil {
+		t.Fatalf("Failed to decrypt the replacement key: %v", err)
+	}
+	if info, _ := crypto.DefaultRegistry().AlgorithmInfo(crypto.AlgMLKEM768); len(privateKey) != info.PrivateKeySize {
+		t.Errorf("Expected a %d-byte private key, got %d", info.PrivateKeySize, len(privateKey))
+	}
+
+	var severity string
+	if err := db.QueryRow("SELECT severity FROM event_logs WHERE event_type = 'key_rotation' AND related_item_id = ?", oldID).Scan(&severity); err != nil {
+		t.Fatalf("Expected the rotation to be logged: %v", err)
+	}
+	if severity != "WARNING" {
+		t.Errorf("Expected WARNING severity, got %s", severity)
+	}
+
+	checks := map[string]int{
+		fmt.Sprintf("/api/keys/%d/rotate", oldID):   http.StatusConflict,
+		fmt.Sprintf("/api/keys/%d/rotate", decoyID): http.StatusBadRequest,
+		"/api/keys/999/rotate":                      http.StatusNotFound,
+	}
+	for path, want := range checks {
+		if rec := serveJSON(t, r, "POST", path, nil); rec.Code != want {
+			t.Errorf("Expected status %d for %s, got %d", want, path, rec.Code)
+		}
+	}
+
+	// Rotation needs a key encryptor
+	handler.SetKeyEncryptor(nil)
+	if rec := serveJSON(t, r, "POST", fmt.Sprintf("/api/keys/%d/rotate", response.New.ID), nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without a key encryptor, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+func TestPKCS12ExportImport(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleAdmin))
+	handler := RegisterRoutes(r, db, nil)
+	encryptor, err := crypto.NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	handler.SetKeyEncryptor(encryptor)
+
+	keyPair, err := crypto.NewMLDSA44Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	storedPrivate, err := encryptor.EncryptForStorage(keyPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to encrypt key: %v", err)
+	}
+	result, err := db.Exec(
+		"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real) VALUES (?, ?, ?, ?, ?)",
+		keyPair.PublicKey, storedPrivate, storedFingerprint(keyPair.PublicKey), "dilithium2", true,
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert key: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	decoyID := insertTestKey(t, db, testFingerprint("FF", 1), "dilithium2", false)
+
+	for _, encryption := range []string{"modern", "legacy"} {
+		exportPath := fmt.Sprintf("/api/keys/%d/export/pkcs12", id)
+		rec := serveJSON(t, r, "POST", exportPath, PKCS12ExportRequest{Password: "secret", Encryption: encryption})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Export failed: %d %s", rec.Code, rec.Body.String())
+		}
+		var exported PKCS12ExportResponse
+		if err := json.NewDecoder(rec.Body).Decode(&exported); err != nil {
+			t.Fatalf("Failed to decode export response: %v", err)
+		}
+		pfx, err := base64.StdEncoding.DecodeString(exported.PFX)
+		if err != nil {
+			t.Fatalf("Expected base64 pfx: %v", err)
+		}
+		bundled, err := crypto.ImportPKCS12(pfx, "secret")
+		if err != nil {
+			t.Fatalf("Failed to read exported bundle: %v", err)
+		}
+		if bundled.Algorithm != crypto.AlgMLDSA44 || !bytes.Equal(bundled.PrivateKey, keyPair.PrivateKey) {
+			t.Errorf("Expected the bundle to hold the stored key (%s)", encryption)
+		}
+
+		// Importing a key that is already stored conflicts
+		importRequest := PKCS12ImportRequest{PFX: exported.PFX, Password: "secret"}
+		if rec := serveJSON(t, r, "POST", "/api/keys/import/pkcs12", importRequest); rec.Code != http.StatusConflict {
+			t.Errorf("Expected status %d re-importing a stored key, got %d", http.StatusConflict, rec.Code)
+		}
+		if rec := serveJSON(t, r, "POST", "/api/keys/import/pkcs12", PKCS12ImportRequest{PFX: exported.PFX, Password: "wrong"}); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for the wrong password, got %d", http.StatusBadRequest, rec.Code)
+		}
+	}
+
+	var severity string
+	if err := db.QueryRow("SELECT severity FROM event_logs WHERE event_type = 'key_export' AND related_item_id = ?", id).Scan(&severity); err != nil {
+		t.Fatalf("Expected the export to be logged: %v", err)
+	}
+	if severity != "WARNING" {
+		t.Errorf("Expected WARNING severity, got %s", severity)
+	}
+
+	// Import into a store that does not hold the key yet
+	rec := serveJSON(t, r, "POST", fmt.Sprintf("/api/keys/%d/export/pkcs12", id), PKCS12ExportRequest{Password: "secret"})
+	var exported PKCS12ExportResponse
+	json.NewDecoder(rec.Body).Decode(&exported)
+	if _, err := deleteKey(db, id); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+	rec = serveJSON(t, r, "POST", "/api/keys/import/pkcs12", PKCS12ImportRequest{PFX: exported.PFX, Password: "secret"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Import failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var imported KeySummary
+	if err := json.NewDecoder(rec.Body).Decode(&imported); err != nil {
+		t.Fatalf("Failed to decode import response: %v", err)
+	}
+	if !imported.IsReal || imported.Algorithm != string(crypto.AlgMLDSA44) || imported.Fingerprint != storedFingerprint(keyPair.PublicKey) {
+		t.Errorf("Unexpected imported key: %+v", imported)
+	}
+	publicKey, storedPrivate, err := getKeyMaterial(db, imported.ID)
+	if err != nil {
+		t.Fatalf("Failed to read imported key: %v", err)
+	}
+	privateKey, err := encryptor.DecryptFromStorage(storedPrivate)
+	if err != nil {
+		t.Fatalf("Expected the imported key to be stored encrypted: %v", err)
+	}
+	if !bytes.Equal(publicKey, keyPair.PublicKey) || !bytes.Equal(privateKey, keyPair.PrivateKey) {
+		t.Error("Key material does not survive a PKCS#12 export and import")
+	}
+
+	checks := []struct {
+		path string
+		body interface{}
+		want int
+	}{
+		{fmt.Sprintf("/api/keys/%d/export/pkcs12", imported.ID), PKCS12ExportRequest{}, http.StatusBadRequest},
+		{fmt.Sprintf("/api/keys/%d/export/pkcs12", imported.ID), PKCS12ExportRequest{Password: "secret", Encryption: "rc2"}, http.StatusBadRequest},
+		{fmt.Sprintf("/api/keys/%d/export/pkcs12", decoyID), PKCS12ExportRequest{Password: "secret"}, http.StatusBadRequest},
+		{"/api/keys/999/export/pkcs12", PKCS12ExportRequest{Password: "secret"}, http.StatusNotFound},
+		{"/api/keys/import/pkcs12", PKCS12ImportRequest{PFX: "not base64!", Password: "secret"}, http.StatusBadRequest},
+	}
+	for _, check := range checks {
+		if rec := serveJSON(t, r, "POST", check.path, check.body); rec.Code != check.want {
+			t.Errorf("Expected status %d for %s, got %d", check.want, check.path, rec.Code)
+		}
+	}
+
+	// Export and import need a key encryptor
+	handler.SetKeyEncryptor(nil)
+	if rec := serveJSON(t, r, "POST", fmt.Sprintf("/api/keys/%d/export/pkcs12", imported.ID), PKCS12ExportRequest{Password: "secret"}); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without a key encryptor, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+func TestVerifyKeyIntegrity(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleAdmin))
+	handler := RegisterRoutes(r, db, nil)
+	encryptor, err := crypto.NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	handler.SetKeyEncryptor(encryptor)
+
+	// storeKey stores a key pair, encrypting the private key the way the backend does
+	storeKey := func(algorithm string, publicKey, privateKey []byte) int64 {
+		t.Helper()
+		storedPrivate, err := encryptor.EncryptForStorage(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to encrypt key: %v", err)
+		}
+		result, err := db.Exec(
+			"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real) VALUES (?, ?, ?, ?, ?)",
+			publicKey, storedPrivate, storedFingerprint(publicKey), algorithm, true,
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert key: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		return id
+	}
+	check := func(id int64) KeyIntegrityResponse {
+		t.Helper()
+		rec := serveJSON(t, r, "GET", fmt.Sprintf("/api/keys/%d/verify-storage", id), nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Integrity check of key %d failed: %d %s", id, rec.Code, rec.Body.String())
+		}
+		var response KeyIntegrityResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode integrity response: %v", err)
+		}
+		return response
+	}
+	criticalEvents := func(id int64) int {
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM event_logs WHERE event_type = ? AND severity = 'CRITICAL' AND related_item_id = ?", keyIntegrityEventType, id).Scan(&count)
+		return count
+	}
+
+	kemKey, err := crypto.NewMLKEM768Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	sigKey, err := crypto.NewMLDSA44Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	otherSigKey, err := crypto.NewMLDSA44Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	// Intact key pairs pass, whether or not the public key can be recomputed
+	for _, id := range []int64{storeKey("kyber", kemKey.PublicKey, kemKey.PrivateKey), storeKey("dilithium2", sigKey.PublicKey, sigKey.PrivateKey)} {
+		if response := check(id); !response.Valid || response.MismatchCount != 0 || response.Error != "" {
+			t.Errorf("Expected key %d to be intact, got %+v", id, response)
+		}
+		if criticalEvents(id) != 0 {
+			t.Errorf("Expected no integrity failure to be logged for key %d", id)
+		}
+	}
+
+	// A corrupted public key is reported byte by byte
+	corrupted := append([]byte{}, kemKey.PublicKey...)
+	corrupted[12] ^= 0x01
+	corrupted[47] ^= 0x80
+	id := storeKey("ml-kem-768", corrupted, kemKey.PrivateKey)
+	response := check(id)
+	if response.Valid || !slices.Equal(response.MismatchBytes, []int{12, 47}) || response.MismatchCount != 2 {
+		t.Errorf("Expected mismatches at bytes 12 and 47, got %+v", response)
+	}
+	if criticalEvents(id) != 1 {
+		t.Errorf("Expected a CRITICAL integrity failure to be logged for key %d", id)
+	}
+
+	// So is a corrupted private key that no longer recovers its secrets
+	corrupted = append([]byte{}, kemKey.PrivateKey...)
+	corrupted[0] ^= 0x01
+	id = storeKey("ml-kem-768", kemKey.PublicKey, corrupted)
+	if response := check(id); response.Valid || response.MismatchCount != 0 || response.Error == "" {
+		t.Errorf("Expected a corrupted private key to fail, got %+v", response)
+	}
+	if criticalEvents(id) != 1 {
+		t.Errorf("Expected a CRITICAL integrity failure to be logged for key %d", id)
+	}
+
+	// And a signature key pair that doesn't belong together
+	id = storeKey("dilithium2", otherSigKey.PublicKey, sigKey.PrivateKey)
+	if response := check(id); response.Valid || !strings.Contains(response.Error, crypto.ErrKeyPairMismatch.Error()) {
+		t.Errorf("Expected mismatched ML-DSA keys to fail, got %+v", response)
+	}
+
+	// A private key blob that no longer decrypts
+	id = storeKey("ml-kem-768", kemKey.PublicKey, kemKey.PrivateKey)
+	if _, err := db.Exec("UPDATE key_pairs SET private_key = ? WHERE id = ?", []byte("not an encrypted key"), id); err != nil {
+		t.Fatalf("Failed to corrupt key: %v", err)
+	}
+	if response := check(id); response.Valid || response.Error != "stored private key does not decrypt" {
+		t.Errorf("Expected an undecryptable private key to fail, got %+v", response)
+	}
+
+	decoyID := insertTestKey(t, db, testFingerprint("EE", 1), "kyber", false)
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{fmt.Sprintf("/api/keys/%d/verify-storage", decoyID), http.StatusBadRequest},
+		{"/api/keys/9999/verify-storage", http.StatusNotFound},
+	} {
+		if rec := serveJSON(t, r, "GET", tc.path, nil); rec.Code != tc.want {
+			t.Errorf("Expected status %d for %s, got %d", tc.want, tc.path, rec.Code)
+		}
+	}
+}
+
+func TestImportPublicKey(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleAdmin))
+	handler := RegisterRoutes(r, db, nil)
+	encryptor, err := crypto.NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	handler.SetKeyEncryptor(encryptor)
+
+	keyPair, err := crypto.NewMLKEM768Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	request := PublicKeyImportRequest{
+		PublicKey: hex.EncodeToString(keyPair.PublicKey),
+		Algorithm: string(crypto.AlgMLKEM768),
+		Tags:      []string{"offline"},
+	}
+	rec := serveJSON(t, r, "POST", "/api/keys/import", request)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Import failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var imported KeySummary
+	if err := json.NewDecoder(rec.Body).Decode(&imported); err != nil {
+		t.Fatalf("Failed to decode import response: %v", err)
+	}
+	if !imported.IsReal || imported.Algorithm != string(crypto.AlgMLKEM768) || imported.Fingerprint != storedFingerprint(keyPair.PublicKey) || len(imported.Tags) != 1 {
+		t.Errorf("Unexpected imported key: %+v", imported)
+	}
+	var isNull bool
+	if err := db.QueryRow("SELECT private_key IS NULL FROM key_pairs WHERE id = ?", imported.ID).Scan(&isNull); err != nil || !isNull {
+		t.Errorf("Expected no private key to be stored, got %v %v", isNull, err)
+	}
+	if rec := serveJSON(t, r, "POST", "/api/keys/import", request); rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d re-importing the key, got %d", http.StatusConflict, rec.Code)
+	}
+
+	// The imported key is listed like any other
+	rec = serveJSON(t, r, "GET", "/api/keys?tag=offline", nil)
+	var list KeyListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode key list: %v", err)
+	}
+	if list.Total != 1 || list.Keys[0].ID != imported.ID {
+		t.Errorf("Expected the imported key to be listed, got %+v", list)
+	}
+
+	// Only real keys with a private key are exportable
+	generatedID := insertTestKey(t, db, testFingerprint("AA", 1), "kyber768", true)
+	decoyID := insertTestKey(t, db, testFingerprint("AA", 2), "kyber768", false)
+	for id, want := range map[int64]bool{imported.ID: false, generatedID: true, decoyID: false} {
+		rec := serveJSON(t, r, "GET", fmt.Sprintf("/api/keys/%d/exportable", id), nil)
+		var response KeyExportableResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.ID != id || response.Exportable != want {
+			t.Errorf("Expected key %d exportable=%v, got %d %+v", id, want, rec.Code, response)
+		}
+	}
+	if rec := serveJSON(t, r, "GET", "/api/keys/999/exportable", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown key, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	// Export refuses a key without a private key
+	if rec := serveJSON(t, r, "POST", fmt.Sprintf("/api/keys/%d/export/pkcs12", imported.ID), PKCS12ExportRequest{Password: "secret"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d exporting a public key, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	invalid := map[string]PublicKeyImportRequest{
+		"not hex":     {PublicKey: "zz", Algorithm: string(crypto.AlgMLKEM768)},
+		"wrong size":  {PublicKey: hex.EncodeToString(keyPair.PublicKey[:100]), Algorithm: string(crypto.AlgMLKEM768)},
+		"unknown":     {PublicKey: request.PublicKey, Algorithm: "rsa-2048"},
+		"other size":  {PublicKey: request.PublicKey, Algorithm: string(crypto.AlgMLDSA44)},
+		"invalid tag": {PublicKey: request.PublicKey, Algorithm: string(crypto.AlgMLKEM768), Tags: []string{"no spaces"}},
+	}
+	for name, req := range invalid {
+		if rec := serveJSON(t, r, "POST", "/api/keys/import", req); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: Expected status %d, got %d", name, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+// insertTestEvent stores an event log entry at a fixed time
+func insertTestEvent(t *testing.T, db *sql.DB, eventType, severity string, at time.Time) {
+	t.Helper()
+	_, err := db.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, timestamp) VALUES (?, ?, ?, ?, ?)",
+		eventType, eventType+" at "+at.Format(time.RFC3339), "192.0.2.10", severity, at.UTC().Format(sqliteTimestampFormat),
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert event: %v", err)
+	}
+}
+
+func TestListEventLogs(t *testing.T) {
+	r, db := newTestRouter(t)
+
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	insertTestEvent(t, db, "key_deletion", "CRITICAL", base)
+	insertTestEvent(t, db, "key_rotation", "WARNING", base.Add(time.Hour))
+	insertTestEvent(t, db, "key_export", "WARNING", base.Add(2*time.Hour))
+	insertTestEvent(t, db, "key_import", "INFO", base.Add(3*time.Hour))
+	insertTestEvent(t, db, "threat_detected", "ERROR", base.Add(4*time.Hour))
+
+	checks := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"threat_detected", "key_import", "key_export", "key_rotation", "key_deletion"}},
+		{"?severity=WARNING", []string{"key_export", "key_rotation"}},
+		{"?severity=critical", []string{"key_deletion"}},
+		{"?from=2025-03-01T13:00:00Z&to=2025-03-01T15:00:00Z", []string{"key_import", "key_export", "key_rotation"}},
+		// Offsets are converted to UTC before comparing
+		{"?from=2025-03-01T15:30:00%2B02:00", []string{"threat_detected", "key_import", "key_export"}},
+		{"?event_type=key_import", []string{"key_import"}},
+		{"?severity=WARNING&from=2025-03-01T14:00:00Z", []string{"key_export"}},
+	}
+	for _, check := range checks {
+		rec := serveJSON(t, r, "GET", "/api/event-logs"+check.query, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Listing %q failed: %d %s", check.query, rec.Code, rec.Body.String())
+		}
+		var response EventLogResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode event logs: %v", err)
+		}
+		var got []string
+		for _, entry := range response.Logs {
+			got = append(got, entry.EventType)
+		}
+		if strings.Join(got, ",") != strings.Join(check.want, ",") || response.Total != len(check.want) {
+			t.Errorf("Expected %v for %q, got %v (total %d)", check.want, check.query, got, response.Total)
+		}
+	}
+
+	// Pagination reports the total across pages
+	rec := serveJSON(t, r, "GET", "/api/event-logs?per_page=2&page=2", nil)
+	var page EventLogResponse
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode event logs: %v", err)
+	}
+	if page.Total != 5 || len(page.Logs) != 2 || page.Logs[0].EventType != "key_export" {
+		t.Errorf("Expected the second page of two entries out of 5, got %+v", page)
+	}
+	if !page.Logs[0].Timestamp.Equal(base.Add(2 * time.Hour)) {
+		t.Errorf("Expected timestamp %v, got %v", base.Add(2*time.Hour), page.Logs[0].Timestamp)
+	}
+}
+
+func TestListEventLogsValidation(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	for _, query := range []string{
+		"?severity=DEBUG",
+		"?from=yesterday",
+		"?to=2025-03-01",
+		"?from=2025-03-02T00:00:00Z&to=2025-03-01T00:00:00Z",
+		"?page=0",
+		"?per_page=1000",
+	} {
+		if rec := serveJSON(t, r, "GET", "/api/event-logs"+query, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
+
+func TestListEventLogsRateLimit(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	request := func(remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/api/event-logs", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < eventLogRequestsPerMinute; i++ {
+		if code := request("198.51.100.1:1234"); code != http.StatusOK {
+			t.Fatalf("Expected request %d to succeed, got %d", i+1, code)
+		}
+	}
+	if code := request("198.51.100.1:5678"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d once the limit is reached, got %d", http.StatusTooManyRequests, code)
+	}
+
+	// Other clients have their own budget
+	if code := request("198.51.100.2:1234"); code != http.StatusOK {
+		t.Errorf("Expected another client to succeed, got %d", code)
+	}
+}
+
+// exportEventLogsAs requests an event log export as a client at remoteAddr,
+// since each client may only export once a minute
+func exportEventLogsAs(r *mux.Router, remoteAddr, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/admin/event-logs/export"+query, nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestExportEventLogs(t *testing.T) {
+	r, db := newTestRouter(t)
+
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		insertTestEvent(t, db, "auth_failure", "WARNING", base.Add(time.Duration(i)*time.Minute))
+	}
+
+	// CSV
+	rec := exportEventLogsAs(r, "198.51.100.1:1234", "?format=csv")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CSV export failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("Expected CSV content type, got %q", got)
+	}
+	if got, want := rec.Header().Get("Content-Disposition"), "attachment; filename=events_start_end.csv"; got != want {
+		t.Errorf("Expected Content-Disposition %q, got %q", want, got)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV export: %v", err)
+	}
+	if len(records) != 101 {
+		t.Fatalf("Expected a header and 100 rows, got %d rows", len(records))
+	}
+	if got := strings.Join(records[0], ","); got != "id,event_type,description,source_ip,timestamp,severity,related_item_id,related_item_type" {
+		t.Errorf("Unexpected CSV header %q", got)
+	}
+	if records[1][4] != base.Format(time.RFC3339) || records[1][1] != "auth_failure" || records[1][6] != "" {
+		t.Errorf("Expected the oldest event first, got %q", records[1])
+	}
+
+	// JSON Lines
+	rec = exportEventLogsAs(r, "198.51.100.2:1234", "?format=jsonl")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("JSON Lines export failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Expected JSON Lines content type, got %q", got)
+	}
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if len(lines) != 100 {
+		t.Fatalf("Expected 100 lines, got %d", len(lines))
+	}
+	for i, line := range lines {
+		var entry EventLog
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Line %d is not a JSON object: %v", i+1, err)
+		}
+		if !entry.Timestamp.Equal(base.Add(time.Duration(i) * time.Minute)) {
+			t.Errorf("Line %d: expected timestamp %s, got %s", i+1, base.Add(time.Duration(i)*time.Minute), entry.Timestamp)
+		}
+	}
+
+	// A range exports only the events inside it and names the file after it
+	from, to := base.Add(10*time.Minute), base.Add(19*time.Minute)
+	rec = exportEventLogsAs(r, "198.51.100.3:1234", "?from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Range export failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if got, want := rec.Header().Get("Content-Disposition"), "attachment; filename=events_20250301T121000Z_20250301T121900Z.csv"; got != want {
+		t.Errorf("Expected Content-Disposition %q, got %q", want, got)
+	}
+	records, err = csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV export: %v", err)
+	}
+	if len(records) != 11 {
+		t.Errorf("Expected a header and 10 rows, got %d rows", len(records))
+	}
+}
+
+func TestExportEventLogsValidation(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	for i, query := range []string{
+		"?format=xml",
+		"?from=yesterday",
+		"?from=2025-03-02T00:00:00Z&to=2025-03-01T00:00:00Z",
+	} {
+		if rec := exportEventLogsAs(r, fmt.Sprintf("198.51.100.%d:1234", i+1), query); rec.Code != http.StatusBadRequest {
+			t.Errorf("Query %q: expected status %d, got %d", query, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestExportEventLogsRateLimit(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	if rec := exportEventLogsAs(r, "198.51.100.1:1234", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the first export to succeed, got %d", rec.Code)
+	}
+	rec := exportEventLogsAs(r, "198.51.100.1:5678", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d for a second export within a minute, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	// Other clients have their own budget
+	if rec := exportEventLogsAs(r, "198.51.100.2:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected another client to succeed, got %d", rec.Code)
+	}
+}
+
+func TestHoneypotProbesLoggedBeforeAuth(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	auth, err := security.NewAuthenticator(db)
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	r := mux.NewRouter()
+	r.Use(HoneypotMiddleware)
+	r.Use(security.NewAuthMiddleware(auth).Middleware)
+	RegisterRoutes(r, db, nil)
+
+	probes := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/api/v0/keys/admin", ""},
+		{"GET", "/api/internal/master-key?format=raw", ""},
+		{"POST", "/api/debug/decrypt-all", `{"confirm": true}`},
+	}
+	for _, probe := range probes {
+		req := httptest.NewRequest(probe.method, probe.path, strings.NewReader(probe.body))
+		req.RemoteAddr = "198.51.100.23:4444"
+		req.Header.Set("User-Agent", "sqlmap/1.7")
+		req.Header.Set("X-Probe", "yes")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s: Expected status %d, got %d", probe.method, probe.path, http.StatusForbidden, rec.Code)
+		}
+		if body := rec.Body.String(); body != `{"error":"insufficient_clearance","code":4031}` {
+			t.Errorf("%s %s: Unexpected body %s", probe.method, probe.path, body)
+		}
+	}
+
+	rows, err := db.Query("SELECT description, source_ip, severity FROM event_logs WHERE event_type = 'honeypot_probe' ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	defer rows.Close()
+	var logged []honeypotProbe
+	for rows.Next() {
+		var description, ip, severity string
+		if err := rows.Scan(&description, &ip, &severity); err != nil {
+			t.Fatalf("Failed to scan event: %v", err)
+		}
+		if ip != "198.51.100.23" || severity != "CRITICAL" {
+			t.Errorf("Expected a CRITICAL event from 198.51.100.23, got %s from %s", severity, ip)
+		}
+		var probe honeypotProbe
+		if err := json.Unmarshal([]byte(description), &probe); err != nil {
+			t.Fatalf("Expected a JSON description, got %q", description)
+		}
+		logged = append(logged, probe)
+	}
+	if len(logged) != len(probes) {
+		t.Fatalf("Expected %d logged probes, got %d", len(probes), len(logged))
+	}
+	for i, probe := range logged {
+		if probe.Method != probes[i].method || probe.Body != probes[i].body ||
+			probe.UserAgent != "sqlmap/1.7" || len(probe.Headers["X-Probe"]) != 1 || probe.Timestamp.IsZero() {
+			t.Errorf("Unexpected probe record %+v", probe)
+		}
+	}
+	if logged[1].Path != "/api/internal/master-key" || logged[1].Query != "format=raw" {
+		t.Errorf("Expected the path and query to be recorded, got %q and %q", logged[1].Path, logged[1].Query)
+	}
+
+	// Real endpoints still need a token
+	if rec := serveJSON(t, r, "GET", "/api/keys", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unauthenticated request, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestPurgeThreatHistory(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	engine := security.NewResponseEngineWithDB(db)
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleAdmin))
+	RegisterRoutes(r, db, engine)
+
+	ip, bystander := "203.0.113.7", "203.0.113.8"
+	for i := 0; i < 6; i++ {
+		engine.ClassifyThreat(security.RequestFeatures{ClientIP: ip}, "AbnormalLatency", 6.0)
+	}
+	engine.ApplyAction(security.ActionThrottle, ip)
+	engine.ClassifyThreat(security.RequestFeatures{ClientIP: bystander}, "AbnormalLatency", 6.0)
+
+	// A critical threat from two days ago is kept for audit
+	old := security.Threat{IP: ip, Level: security.ThreatLevelCritical, Timestamp: time.Now().Add(-48 * time.Hour)}
+	data, _ := json.Marshal(old)
+	_, err = db.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, timestamp) VALUES (?, ?, ?, ?, ?)",
+		"threat", string(data), ip, "CRITICAL", old.Timestamp.UTC(),
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert threat: %v", err)
+	}
+
+	rec := serveJSON(t, r, "POST", "/api/admin/purge-threats", PurgeThreatsRequest{IP: ip})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var response PurgeThreatsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.IP != ip || response.DeletedRecords != 6 {
+		t.Errorf("Expected 6 records deleted for %s, got %+v", ip, response)
+	}
+
+	counts := map[string]int{}
+	rows, err := db.Query("SELECT event_type, source_ip FROM event_logs WHERE event_type IN ('threat', 'admin_purge')")
+	if err != nil {
+		t.Fatalf("Failed to query event logs: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var eventType, sourceIP string
+		if err := rows.Scan(&eventType, &sourceIP); err != nil {
+			t.Fatalf("Failed to scan event log: %v", err)
+		}
+		counts[eventType+" "+sourceIP]++
+	}
+	want := map[string]int{"threat " + ip: 1, "threat " + bystander: 1, "admin_purge " + ip: 1}
+	if !maps.Equal(counts, want) {
+		t.Errorf("Expected event logs %v, got %v", want, counts)
+	}
+
+	// The purged IP starts over, even after a restart reloads its history
+	for _, e := range []*security.ResponseEngine{engine, security.NewResponseEngineWithDB(db)} {
+		if _, _, limited := e.CheckThrottle(ip); limited {
+			t.Error("Expected the purged IP to no longer be throttled")
+		}
+		// A repeat offender would be deceived rather than throttled
+		threat := e.ClassifyThreat(security.RequestFeatures{ClientIP: ip}, "HighFrequency", 1.0)
+		if action := e.DecideAction(threat); action != security.ActionThrottle {
+			t.Errorf("Expected a medium threat from the purged IP to be throttled, got %s", action)
+		}
+		if e.ShouldRedirect(ip) || e.ShouldDeceive(ip) {
+			t.Error("Expected no deception or redirect for the purged IP")
+		}
+	}
+	if !engine.ShouldDeceive(bystander) {
+		t.Error("Expected other IPs to keep their threat history")
+	}
+
+	rec = serveJSON(t, r, "POST", "/api/admin/purge-threats", PurgeThreatsRequest{IP: "not-an-ip"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid IP, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestThreatStream(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	auth, err := security.NewAuthenticator(db)
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	engine := security.NewResponseEngine()
+	r := mux.NewRouter()
+	r.Use(security.NewAuthMiddleware(auth).Middleware)
+	RegisterRoutes(r, db, engine)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws/threats"
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a handshake without an API key to get 401, got %v", err)
+	}
+
+	if err := auth.Register("dashboard", "dashboard password", security.RoleReadonly); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	token, _, err := auth.IssueToken(security.User{Name: "dashboard"})
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?api_key="+token, nil)
+	if err != nil {
+		t.Fatalf("Failed to open threat stream: %v", err)
+	}
+	defer conn.Close()
+
+	for _, ip := range []string{"198.51.100.40", "198.51.100.41"} {
+		sent := time.Now()
+		engine.ClassifyThreat(security.RequestFeatures{ClientIP: ip}, "AbnormalLatency", 6.0)
+
+		conn.SetReadDeadline(sent.Add(100 * time.Millisecond))
+		var threat security.Threat
+		if err := conn.ReadJSON(&threat); err != nil {
+			t.Fatalf("Expected the threat from %s within 100ms: %v", ip, err)
+		}
+		if threat.IP != ip || threat.Level != security.ThreatLevelCritical {
+			t.Errorf("Expected the critical threat from %s, got %+v", ip, threat)
+		}
+	}
+}
+
+func TestRunBenchmark(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	rec := serveJSON(t, r, "GET", "/api/benchmark/run?iterations=1", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var report benchmark.BenchmarkReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Iterations != 1 || len(report.Algorithms) == 0 {
+		t.Errorf("Expected a report of 1 iteration over every algorithm, got %+v", report)
+	}
+
+	for _, iterations := range []string{"0", "1001", "many"} {
+		if rec := serveJSON(t, r, "GET", "/api/benchmark/run?iterations="+iterations, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s iterations, got %d", http.StatusBadRequest, iterations, rec.Code)
+		}
+	}
+}
+
+// largeKeyKEM stands in for Classic McEliece, which needs the mceliece build
+// tag, generating key pairs with a public key of its size
+type largeKeyKEM struct {
+	crypto.KEMProvider
+}
+
+func (largeKeyKEM) Name() crypto.Algorithm {
+	return crypto.AlgMcEliece348864
+}
+
+func (largeKeyKEM) KeyGen(ctx context.Context) (crypto.KeyPair, error) {
+	publicKey := make([]byte, 261120)
+	for i := range publicKey {
+		publicKey[i] = byte(i)
+	}
+	return crypto.KeyPair{PublicKey: publicKey, PrivateKey: make([]byte, 32), Algorithm: crypto.AlgMcEliece348864}, nil
+}
+
+func TestKeyGenLargePublicKey(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleUser))
+	handler := RegisterRoutes(r, nil, nil)
+	handler.Registry().RegisterKEMProvider(largeKeyKEM{crypto.NewMLKEM768Provider()})
+	expected, _ := largeKeyKEM{}.KeyGen(context.Background())
+
+	for _, warnings := range []bool{false, true} {
+		handler.SetAlgorithmWarnings(warnings)
+		rec := serveJSON(t, r, "POST", "/api/mceliece-348864/keygen", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Key generation failed: %d %s", rec.Code, rec.Body.String())
+		}
+		var key KeyGenResponse
+		if err := json.NewDecoder(rec.Body).Decode(&key); err != nil {
+			t.Fatalf("Failed to decode streamed response: %v", err)
+		}
+
+		if key.PublicKey != "" {
+			t.Error("Expected the public key to be sent in chunks only")
+		}
+		if len(key.PublicKeyChunks) != 16 {
+			t.Errorf("Expected 16 chunks, got %d", len(key.PublicKeyChunks))
+		}
+		if strings.Join(key.PublicKeyChunks, "") != hex.EncodeToString(expected.PublicKey) {
+			t.Error("Expected the joined chunks to be the public key")
+		}
+		if key.Algorithm != string(crypto.AlgMcEliece348864) || key.PrivateKey != hex.EncodeToString(expected.PrivateKey) || key.Fingerprint == "" {
+			t.Errorf("Unexpected fields after the chunks: %+v", key)
+		}
+
+		if warnings != (key.Warning != "") || key.Warning != rec.Header().Get("X-Algorithm-Warning") {
+			t.Errorf("Warnings %v: got warning %q and header %q", warnings, key.Warning, rec.Header().Get("X-Algorithm-Warning"))
+		}
+	}
+
+	// Small keys are still sent whole, without a warning
+	rec := serveJSON(t, r, "POST", "/api/ml-kem-768/keygen", nil)
+	var key KeyGenResponse
+	json.NewDecoder(rec.Body).Decode(&key)
+	if key.PublicKey == "" || key.PublicKeyChunks != nil || key.Warning != "" {
+		t.Errorf("Expected a whole ML-KEM public key without a warning, got %d chunks and warning %q", len(key.PublicKeyChunks), key.Warning)
+	}
+}
+
+func TestKeyAgreementDemo(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	for _, algorithm := range []string{"", "ml-kem-768", "ecdh", "hybrid-ml-kem-ecdh"} {
+		rec := serveJSON(t, r, "POST", "/api/demo/key-agreement", KeyAgreementRequest{Algorithm: algorithm})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: Expected status %d, got %d: %s", algorithm, http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var demo KeyAgreementDemo
+		if err := json.NewDecoder(rec.Body).Decode(&demo); err != nil {
+			t.Fatalf("Failed to decode demo: %v", err)
+		}
+		if !demo.Match || demo.AliceSharedSecret != demo.BobSharedSecret {
+			t.Errorf("%q: Expected matching shared secrets, got %+v", algorithm, demo)
+		}
+		if demo.AlicePublicKey == "" || demo.BobCiphertext == "" || demo.AliceSharedSecret == "" {
+			t.Errorf("%q: Expected every step in the transcript, got %+v", algorithm, demo)
+		}
+		if algorithm == "" && demo.Algorithm != string(crypto.AlgMLKEM768) {
+			t.Errorf("Expected the algorithm to default to %s, got %s", crypto.AlgMLKEM768, demo.Algorithm)
+		}
+	}
+
+	if rec := serveJSON(t, r, "POST", "/api/demo/key-agreement", KeyAgreementRequest{Algorithm: "ml-dsa-44"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a signature algorithm, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+// failingKEM stands in for an algorithm whose key generation is broken
+type failingKEM struct {
+	crypto.KEMProvider
+}
+
+func (failingKEM) Name() crypto.Algorithm {
+	return "failing-kem"
+}
+
+func (failingKEM) KeyGen(ctx context.Context) (crypto.KeyPair, error) {
+	return crypto.KeyPair{}, errors.New("entropy source unavailable")
+}
+
+func TestAlgorithmStatus(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleReadonly))
+	handler := RegisterRoutes(r, nil, nil)
+	handler.Registry().RegisterKEMProvider(failingKEM{crypto.NewMLKEM768Provider()})
+
+	status := func() AlgorithmStatusResponse {
+		rec := serveJSON(t, r, "GET", "/api/status/algorithms", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var response AlgorithmStatusResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+		return response
+	}
+
+	response := status()
+	statuses := make(map[crypto.Algorithm]AlgorithmStatus)
+	for _, algorithm := range response.Algorithms {
+		statuses[algorithm.Name] = algorithm
+	}
+	if got := statuses["failing-kem"]; got.Status != AlgorithmStatusUnavailable || got.Error == "" {
+		t.Errorf("Expected the failing provider to be unavailable, got %+v", got)
+	}
+	if got := statuses[crypto.AlgMLKEM768]; got.Status != AlgorithmStatusOK {
+		t.Errorf("Expected ML-KEM-768 to be ok, got %+v", got)
+	}
+	if got := statuses[crypto.AlgECDSA]; got.Status != AlgorithmStatusOK {
+		t.Errorf("Expected ECDSA to be ok, got %+v", got)
+	}
+	if want := len(handler.Registry().ListKEMAlgorithms()) + len(handler.Registry().ListSignatureAlgorithms()); len(response.Algorithms) != want {
+		t.Errorf("Expected %d algorithms, got %d", want, len(response.Algorithms))
+	}
+
+	// A second request within a minute gets the cached check
+	if again := status(); !again.CheckedAt.Equal(response.CheckedAt) {
+		t.Errorf("Expected the cached check from %s, got one from %s", response.CheckedAt, again.CheckedAt)
+	}
+}
+
+func TestDeriveSymmetric(t *testing.T) {
+	db, err := OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	r := mux.NewRouter()
+	r.Use(withTestUser(security.RoleUser))
+	handler := RegisterRoutes(r, db, nil)
+	encryptor, err := crypto.NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	handler.SetKeyEncryptor(encryptor)
+
+	provider := crypto.NewMLKEM768Provider()
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	storedPrivateKey, err := encryptor.EncryptForStorage(keyPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to encrypt private key: %v", err)
+	}
+	id, err := importKey(db, string(crypto.AlgMLKEM768), keyPair.PublicKey, storedPrivateKey, "")
+	if err != nil {
+		t.Fatalf("Failed to store key pair: %v", err)
+	}
+	ciphertext, sharedSecret, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+
+	derive := func(info string, length int) (int, DeriveResponse) {
+		t.Helper()
+		rec := serveJSON(t, r, "POST", fmt.Sprintf("/api/keys/%d/derive-symmetric", id), DeriveSymmetricRequest{
+			Ciphertext: hex.EncodeToString(ciphertext),
+			Info:       info,
+			Length:     length,
+		})
+		var response DeriveResponse
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode derived key: %v", err)
+			}
+			if strings.Contains(rec.Body.String(), hex.EncodeToString(sharedSecret)) {
+				t.Error("Expected the shared secret never to be returned")
+			}
+		}
+		return rec.Code, response
+	}
+
+	code, aes := derive("aes-256-gcm", 0)
+	if code != http.StatusOK {
+		t.Fatalf("Derivation failed with status %d", code)
+	}
+	expected, _ := crypto.DeriveKey(sharedSecret, []byte("aes-256-gcm"), 32)
+	if aes.Length != 32 || aes.Key != hex.EncodeToString(expected) {
+		t.Errorf("Expected the HKDF-SHA256 output of the shared secret, got %+v", aes)
+	}
+
+	// Each info string gives an independent key; the same one gives the same key
+	_, chacha := derive("chacha20-poly1305", 32)
+	if chacha.Key == aes.Key {
+		t.Error("Expected different info strings to derive different keys")
+	}
+	if _, again := derive("aes-256-gcm", 32); again.Key != aes.Key {
+		t.Error("Expected the same info string to derive the same key")
+	}
+	if _, short := derive("aes-128-gcm", 16); short.Length != 16 || len(short.Key) != 32 {
+		t.Errorf("Expected a 16 byte key, got %+v", short)
+	}
+
+	if code, _ := derive("aes-256-gcm", crypto.MaxDerivedKeyLength+1); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an oversized key, got %d", http.StatusBadRequest, code)
+	}
+	rec := serveJSON(t, r, "POST", "/api/keys/999/derive-symmetric", DeriveSymmetricRequest{Ciphertext: hex.EncodeToString(ciphertext)})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing key, got %d", http.StatusNotFound, rec.Code)
+	}
+	publicOnly, err := importKey(db, string(crypto.AlgMLKEM768), []byte("public-only"), nil, "")
+	if err != nil {
+		t.Fatalf("Failed to store public key: %v", err)
+	}
+	rec = serveJSON(t, r, "POST", fmt.Sprintf("/api/keys/%d/derive-symmetric", publicOnly), DeriveSymmetricRequest{Ciphertext: hex.EncodeToString(ciphertext)})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a key without a private key, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// Readonly users may not use stored keys
+	readonly := mux.NewRouter()
+	readonly.Use(withTestUser(security.RoleReadonly))
+	RegisterRoutes(readonly, db, nil)
+	rec = serveJSON(t, readonly, "POST", fmt.Sprintf("/api/keys/%d/derive-symmetric", id), DeriveSymmetricRequest{Ciphertext: hex.EncodeToString(ciphertext)})
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a readonly user, got %d", http.StatusForbidden, rec.Code)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"pqcd/benchmark"
+	"pqcd/security"
+)
+
+// Iterations of the benchmark suite when none are requested, and the most
+// allowed. A run of 100 iterations takes a couple of minutes.
+const (
+	defaultBenchmarkIterations = 100
+	maxBenchmarkIterations     = 1000
+)
+
+// HandleRunBenchmark runs the benchmark suite over every registered algorithm
+// and returns the report. The number of iterations comes from the iterations
+// query parameter. A second run while one is in progress gets 409.
+func (h *CryptoHandler) HandleRunBenchmark() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		iterations := defaultBenchmarkIterations
+		if value := r.URL.Query().Get("iterations"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxBenchmarkIterations {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("iterations must be between 1 and %d", maxBenchmarkIterations))
+				return
+			}
+			iterations = n
+		}
+
+		if !h.benchmarkRunning.CompareAndSwap(false, true) {
+			respondWithError(w, http.StatusConflict, "a benchmark is already running")
+			return
+		}
+		defer h.benchmarkRunning.Store(false)
+
+		// The run outlasts the server's write timeout
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Debug("Failed to clear the write deadline for the benchmark")
+		}
+
+		security.RequestLogger(r.Context()).WithField("iterations", iterations).Info("Running benchmark suite")
+		report := benchmark.RunSuite(r.Context(), h.registry, iterations)
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"iterations":  iterations,
+			"duration_ms": report.DurationMs,
+		}).Info("Benchmark suite finished")
+
+		respondWithJSON(w, http.StatusOK, report)
+	}
+}
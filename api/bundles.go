@@ -0,0 +1,134 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"pqcd/crypto"
+	"pqcd/security"
+)
+
+// BundleGenerateRequest is the request for generating a key bundle
+type BundleGenerateRequest struct {
+	KEMAlgorithm string `json:"kem_algorithm"`
+	SigAlgorithm string `json:"sig_algorithm"`
+}
+
+// BundleResponse describes a stored key bundle. The fingerprint is the
+// SHA-256 digest of the KEM public key followed by the signature public key.
+type BundleResponse struct {
+	ID           int64     `json:"id"`
+	Fingerprint  string    `json:"fingerprint"`
+	KEMAlgorithm string    `json:"kem_algorithm"`
+	KEMPublicKey string    `json:"kem_public_key"`
+	SigAlgorithm string    `json:"sig_algorithm"`
+	SigPublicKey string    `json:"sig_public_key"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// storeKeyBundle stores a key bundle with its private keys already encrypted
+// for storage and returns its ID
+func storeKeyBundle(db *sql.DB, bundle crypto.KeyBundle, storedKEMPrivateKey, storedSigPrivateKey []byte, sourceIP string) (int64, error) {
+	result, err := db.Exec(
+		`INSERT INTO key_bundles (fingerprint, kem_algorithm, kem_public_key, kem_private_key, sig_algorithm, sig_public_key, sig_private_key, source_ip, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		hex.EncodeToString(bundle.Fingerprint()),
+		string(bundle.KEM.Algorithm), bundle.KEM.PublicKey, storedKEMPrivateKey,
+		string(bundle.Signature.Algorithm), bundle.Signature.PublicKey, storedSigPrivateKey,
+		sourceIP, bundle.CreatedAt.UTC().Format(sqliteTimestampFormat),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store key bundle: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read key bundle id: %w", err)
+	}
+	return id, nil
+}
+
+// HandleGenerateBundle handles generating a KEM key pair and a signature key
+// pair together as a bundle. Both private keys are encrypted into the key
+// store; only the public keys are returned.
+func (h *CryptoHandler) HandleGenerateBundle() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		if h.keyEncryptor == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key encryption is not configured")
+			return
+		}
+
+		var req BundleGenerateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		kemAlg, sigAlg := crypto.Algorithm(req.KEMAlgorithm), crypto.Algorithm(req.SigAlgorithm)
+		if _, err := h.registry.GetKEMProvider(kemAlg); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported KEM algorithm: %s", kemAlg))
+			return
+		}
+		if _, err := h.registry.GetSignatureProvider(sigAlg); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported signature algorithm: %s", sigAlg))
+			return
+		}
+
+		ctx, span := startSpan(r, "keygen", "KeyGenBundle", kemAlg)
+		defer span.End()
+
+		bundle, err := crypto.GenerateBundle(ctx, kemAlg, sigAlg, h.registry)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Key bundle generation failed")
+			failSpan(span, err)
+			respondWithCryptoError(w, "key bundle generation failed", err)
+			return
+		}
+		defer bundle.Zero()
+
+		storedKEMPrivateKey, err := h.keyEncryptor.EncryptForStorage(bundle.KEM.PrivateKey)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to encrypt bundle KEM key")
+			respondWithError(w, http.StatusInternalServerError, "failed to encrypt key bundle")
+			return
+		}
+		storedSigPrivateKey, err := h.keyEncryptor.EncryptForStorage(bundle.Signature.PrivateKey)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to encrypt bundle signature key")
+			respondWithError(w, http.StatusInternalServerError, "failed to encrypt key bundle")
+			return
+		}
+
+		id, err := storeKeyBundle(h.keyStore, bundle, storedKEMPrivateKey, storedSigPrivateKey, remoteIP(r))
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to store key bundle")
+			respondWithError(w, http.StatusInternalServerError, "failed to store key bundle")
+			return
+		}
+
+		fingerprint := hex.EncodeToString(bundle.Fingerprint())
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"id":            id,
+			"kem_algorithm": kemAlg,
+			"sig_algorithm": sigAlg,
+		}).Info("Key bundle generated")
+
+		respondWithJSON(w, http.StatusCreated, BundleResponse{
+			ID:           id,
+			Fingerprint:  fingerprint,
+			KEMAlgorithm: string(kemAlg),
+			KEMPublicKey: hex.EncodeToString(bundle.KEM.PublicKey),
+			SigAlgorithm: string(sigAlg),
+			SigPublicKey: hex.EncodeToString(bundle.Signature.PublicKey),
+			CreatedAt:    bundle.CreatedAt,
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"pqcd/crypto"
+	"pqcd/security"
+)
+
+// maxStreamedDecoys caps the decoys one streaming request generates
+const maxStreamedDecoys = 50
+
+// defaultDecoyHammingFraction is the fraction of bits streamed decoys differ
+// from the real key in when the request doesn't choose one
+const defaultDecoyHammingFraction = 0.25
+
+// DecoyStreamRequest is the request for streamed decoy generation. Each decoy
+// is PublicKey with HammingFraction of its bits flipped at random.
+type DecoyStreamRequest struct {
+	PublicKey       string  `json:"publicKey"`
+	Algorithm       string  `json:"algorithm"`
+	Count           int     `json:"count"`
+	HammingFraction float64 `json:"hammingFraction"` // In (0, 0.5], 0.25 if omitted
+}
+
+// DecoyStreamItem is one line of a decoy stream, written as soon as the decoy
+// is generated
+type DecoyStreamItem struct {
+	Index           int       `json:"index"`
+	PublicKey       string    `json:"publicKey"`
+	Fingerprint     string    `json:"fingerprint"`
+	SimilarityScore float64   `json:"similarityScore"` // Fraction of bits shared with the real key
+	DoneAt          time.Time `json:"doneAt"`
+}
+
+// DecoyStreamDone is the last line of a decoy stream
+type DecoyStreamDone struct {
+	Done  bool `json:"done"`
+	Total int  `json:"total"`
+}
+
+// HandleDecoyStream handles streamed decoy generation. The response is NDJSON:
+// a DecoyStreamItem per decoy, each flushed as soon as it is ready, then a
+// DecoyStreamDone. At most 50 decoys are generated, however many are asked
+// for. Once the stream has started, an error can only cut it short, so a
+// stream without its done line is incomplete.
+func (h *CryptoHandler) HandleDecoyStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req DecoyStreamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		publicKey, err := hex.DecodeString(req.PublicKey)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid public key format")
+			return
+		}
+		if err := crypto.ValidatePublicKeySize(crypto.Algorithm(req.Algorithm), publicKey); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Count <= 0 {
+			respondWithError(w, http.StatusBadRequest, "count must be positive")
+			return
+		}
+		count := min(req.Count, maxStreamedDecoys)
+		fraction := req.HammingFraction
+		if fraction == 0 {
+			fraction = defaultDecoyHammingFraction
+		}
+		if !(fraction > 0 && fraction <= 0.5) {
+			respondWithError(w, http.StatusBadRequest, "hammingFraction must be in (0, 0.5]")
+			return
+		}
+		rng, err := newDecoyRand()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "failed to seed decoy generator")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		controller := http.NewResponseController(w)
+		encoder := json.NewEncoder(w)
+		logger := security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"algorithm": req.Algorithm,
+			"count":     count,
+		})
+
+		for i := 0; i < count; i++ {
+			if err := r.Context().Err(); err != nil {
+				logger.WithError(err).Info("Decoy stream canceled")
+				return
+			}
+			decoy, differing := flipDecoyBits(publicKey, fraction, rng)
+			item := DecoyStreamItem{
+				Index:           i,
+				PublicKey:       hex.EncodeToString(decoy),
+				Fingerprint:     storedFingerprint(decoy),
+				SimilarityScore: 1 - float64(differing)/float64(8*len(publicKey)),
+				DoneAt:          time.Now().UTC(),
+			}
+			if err := encoder.Encode(item); err != nil {
+				logger.WithError(err).Warn("Decoy stream cut short")
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				logger.WithError(err).Debug("Failed to flush decoy stream")
+			}
+		}
+
+		if err := encoder.Encode(DecoyStreamDone{Done: true, Total: count}); err != nil {
+			logger.WithError(err).Warn("Decoy stream cut short")
+			return
+		}
+		controller.Flush()
+		logger.Info("Streamed decoys")
+	}
+}
+
+// newDecoyRand returns a generator seeded from crypto/rand, so decoys of the
+// same key share no pattern
+func newDecoyRand() (*rand.Rand, error) {
+	var seed [32]byte
+	if _, err := cryptorand.Read(seed[:]); err != nil {
+		return nil, fmt.Errorf("failed to seed decoy generator: %w", err)
+	}
+	return rand.New(rand.NewChaCha8(seed)), nil
+}
+
+// flipDecoyBits returns a copy of key with fraction of its bits, at least one,
+// flipped at distinct random positions, and the number flipped
+func flipDecoyBits(key []byte, fraction float64, rng *rand.Rand) ([]byte, int) {
+	size := 8 * len(key)
+	flips := int(math.Max(1, math.Round(fraction*float64(size))))
+
+	decoy := make([]byte, len(key))
+	copy(decoy, key)
+	for _, pos := range rng.Perm(size)[:flips] {
+		decoy[pos/8] ^= 1 << (pos % 8)
+	}
+	return decoy, flips
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"pqcd/crypto"
+	"pqcd/security"
+)
+
+// DeriveSymmetricRequest is the request for deriving a symmetric key from a
+// ciphertext encapsulated to a stored key pair
+type DeriveSymmetricRequest struct {
+	Ciphertext string `json:"ciphertext"`
+	Info       string `json:"info"`
+	Length     int    `json:"length"`
+}
+
+// HandleDeriveSymmetric handles deriving a symmetric key, for AES or
+// ChaCha20, from a ciphertext encapsulated to a stored key pair. The stored
+// private key decapsulates the ciphertext and the shared secret is run through
+// HKDF-SHA256 with the request's info. Only the derived key is returned; the
+// shared secret and private key never leave the server.
+func (h *CryptoHandler) HandleDeriveSymmetric() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		if h.keyEncryptor == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key encryption is not configured")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid key id")
+			return
+		}
+
+		var req DeriveSymmetricRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		ciphertext, err := hex.DecodeString(req.Ciphertext)
+		if err != nil || len(ciphertext) == 0 {
+			respondWithError(w, http.StatusBadRequest, "invalid ciphertext format")
+			return
+		}
+		if req.Length == 0 {
+			req.Length = 32 // Default to an AES-256 key
+		}
+		if req.Length < 0 || req.Length > crypto.MaxDerivedKeyLength {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("length must be between 1 and %d bytes", crypto.MaxDerivedKeyLength))
+			return
+		}
+
+		key, err := getKey(h.keyStore, id)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("key %d not found", id))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read key")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key")
+			return
+		}
+		provider, err := h.registry.GetKEMProvider(registryAlgorithm(key.Algorithm))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("key %d is not a KEM key", id))
+			return
+		}
+
+		_, storedPrivateKey, err := getKeyMaterial(h.keyStore, id)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read key material")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key")
+			return
+		}
+		if storedPrivateKey == nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("key %d was imported without a private key", id))
+			return
+		}
+		privateKey, err := h.keyEncryptor.DecryptFromStorage(storedPrivateKey)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to decrypt stored key")
+			respondWithError(w, http.StatusInternalServerError, "failed to decrypt key")
+			return
+		}
+		defer crypto.ZeroBytes(privateKey)
+
+		sharedSecret, err := provider.Decapsulate(r.Context(), privateKey, ciphertext)
+		if err != nil {
+			respondWithCryptoError(w, "decapsulation failed", err)
+			return
+		}
+		defer crypto.ZeroBytes(sharedSecret)
+		h.trackKeyUsage(r, key.Fingerprint, usageDecapsulate)
+
+		derived, err := crypto.DeriveKey(sharedSecret, []byte(req.Info), req.Length)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("key derivation failed: %v", err))
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, DeriveResponse{
+			Key:    hex.EncodeToString(derived),
+			Length: len(derived),
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pqcd/security"
+)
+
+// eventLogExportsPerMinute is how often a single client may export the event log
+const eventLogExportsPerMinute = 1
+
+// eventLogExportFileTime formats the range bounds in export file names
+const eventLogExportFileTime = "20060102T150405Z"
+
+// eventLogCSVHeader is the header row of CSV exports
+var eventLogCSVHeader = []string{"id", "event_type", "description", "source_ip", "timestamp", "severity", "related_item_id", "related_item_type"}
+
+// eventLogWriter writes exported event logs in one format
+type eventLogWriter interface {
+	Write(entry EventLog) error
+	Flush() error
+}
+
+// csvEventLogWriter writes event logs as CSV rows under eventLogCSVHeader
+type csvEventLogWriter struct {
+	w *csv.Writer
+}
+
+func newCSVEventLogWriter(w io.Writer) (*csvEventLogWriter, error) {
+	writer := &csvEventLogWriter{w: csv.NewWriter(w)}
+	if err := writer.w.Write(eventLogCSVHeader); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (c *csvEventLogWriter) Write(entry EventLog) error {
+	var relatedID string
+	if entry.RelatedItemID != nil {
+		relatedID = strconv.FormatInt(*entry.RelatedItemID, 10)
+	}
+	return c.w.Write([]string{
+		strconv.FormatInt(entry.ID, 10),
+		entry.EventType,
+		entry.Description,
+		entry.SourceIP,
+		entry.Timestamp.UTC().Format(time.RFC3339),
+		entry.Severity,
+		relatedID,
+		entry.RelatedItemType,
+	})
+}
+
+func (c *csvEventLogWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonLinesEventLogWriter writes each event log as a JSON object on its own line
+type jsonLinesEventLogWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLinesEventLogWriter(w io.Writer) *jsonLinesEventLogWriter {
+	buf := bufio.NewWriter(w)
+	return &jsonLinesEventLogWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (j *jsonLinesEventLogWriter) Write(entry EventLog) error {
+	return j.enc.Encode(entry)
+}
+
+func (j *jsonLinesEventLogWriter) Flush() error {
+	return j.buf.Flush()
+}
+
+// exportEventLogs writes every event log matching the filter, oldest first,
+// reading them from the database as it goes rather than all at once. It
+// returns the number of event logs written.
+func exportEventLogs(ctx context.Context, db *sql.DB, filter EventLogFilter, out eventLogWriter) (int, error) {
+	where, args := filter.whereClause()
+	rows, err := db.QueryContext(ctx,
+		"SELECT "+eventLogColumns+" FROM event_logs"+where+" ORDER BY timestamp, id",
+		args...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query event logs: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		entry, err := scanEventLog(rows)
+		if err != nil {
+			return count, err
+		}
+		if err := out.Write(entry); err != nil {
+			return count, fmt.Errorf("failed to write event log: %w", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("failed to read event logs: %w", err)
+	}
+	if err := out.Flush(); err != nil {
+		return count, fmt.Errorf("failed to write event logs: %w", err)
+	}
+	return count, nil
+}
+
+// eventLogExportFilename names an export after its range, with "start" or
+// "end" standing in for a bound left open
+func eventLogExportFilename(filter EventLogFilter, ext string) string {
+	from, to := "start", "end"
+	if !filter.From.IsZero() {
+		from = filter.From.UTC().Format(eventLogExportFileTime)
+	}
+	if !filter.To.IsZero() {
+		to = filter.To.UTC().Format(eventLogExportFileTime)
+	}
+	return fmt.Sprintf("events_%s_%s.%s", from, to, ext)
+}
+
+// HandleExportEventLogs handles exporting the event log, optionally limited
+// to a time range, as CSV or JSON Lines for ingestion by a SIEM. The export is
+// streamed as it is read, so once it has started a failure can only cut it
+// short.
+func (h *CryptoHandler) HandleExportEventLogs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.eventLogExportLimiter.Allow(remoteIP(r)) {
+			w.Header().Set("Retry-After", "60")
+			respondWithError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+
+		query := r.URL.Query()
+		format := query.Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		var contentType string
+		switch format {
+		case "csv":
+			contentType = "text/csv; charset=utf-8"
+		case "jsonl":
+			contentType = "application/x-ndjson"
+		default:
+			respondWithError(w, http.StatusBadRequest, `format must be "csv" or "jsonl"`)
+			return
+		}
+		var filter EventLogFilter
+		if err := parseEventLogRange(query, &filter); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// A large export outlasts the server's write timeout
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Debug("Failed to clear the write deadline for the event log export")
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", eventLogExportFilename(filter, format)))
+		w.WriteHeader(http.StatusOK)
+
+		var out eventLogWriter
+		if format == "csv" {
+			writer, err := newCSVEventLogWriter(w)
+			if err != nil {
+				security.RequestLogger(r.Context()).WithError(err).Error("Failed to write event log export header")
+				return
+			}
+			out = writer
+		} else {
+			out = newJSONLinesEventLogWriter(w)
+		}
+
+		count, err := exportEventLogs(r.Context(), h.keyStore, filter, out)
+		logger := security.RequestLogger(r.Context()).WithField("format", format).WithField("count", count)
+		if err != nil {
+			logger.WithError(err).Error("Event log export cut short")
+			return
+		}
+		logger.Info("Exported event logs")
+	}
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"pqcd/security"
+)
+
+// Pagination limits for listing event logs
+const (
+	defaultEventLogsPerPage = 50
+	maxEventLogsPerPage     = 200
+)
+
+// eventLogRequestsPerMinute is how often a single client may list event logs
+const eventLogRequestsPerMinute = 10
+
+// maxTrackedClients bounds the per-client limiters kept by an ipRateLimiter
+const maxTrackedClients = 10000
+
+// eventLogSeverities are the severities allowed by the event_logs table
+var eventLogSeverities = map[string]bool{
+	"INFO":     true,
+	"WARNING":  true,
+	"ERROR":    true,
+	"CRITICAL": true,
+}
+
+// EventLog is a single entry of the event_logs table
+type EventLog struct {
+	ID              int64     `json:"id"`
+	EventType       string    `json:"eventType"`
+	Description     string    `json:"description"`
+	SourceIP        string    `json:"sourceIp"`
+	Timestamp       time.Time `json:"timestamp"`
+	Severity        string    `json:"severity"`
+	RelatedItemID   *int64    `json:"relatedItemId,omitempty"`
+	RelatedItemType string    `json:"relatedItemType,omitempty"`
+}
+
+// EventLogResponse is the response for listing event logs
+type EventLogResponse struct {
+	Logs    []EventLog `json:"logs"`
+	Total   int        `json:"total"`
+	Page    int        `json:"page"`
+	PerPage int        `json:"perPage"`
+}
+
+// EventLogFilter restricts which event logs are listed. Zero times leave the
+// range open on that side.
+type EventLogFilter struct {
+	From      time.Time
+	To        time.Time
+	Severity  string
+	EventType string
+	Page      int
+	PerPage   int
+}
+
+// whereClause builds the SQL condition and arguments for a filter. Every value
+// is passed as a parameter; only the fixed condition strings are joined.
+func (f EventLogFilter) whereClause() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if !f.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, f.From.UTC().Format(sqliteTimestampFormat))
+	}
+	if !f.To.IsZero() {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, f.To.UTC().Format(sqliteTimestampFormat))
+	}
+	if f.Severity != "" {
+		conditions = append(conditions, "severity = ?")
+		args = append(args, f.Severity)
+	}
+	if f.EventType != "" {
+		conditions = append(conditions, "event_type = ?")
+		args = append(args, f.EventType)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// listEventLogs returns one page of event logs matching the filter, newest
+// first, along with the total number of matches
+func listEventLogs(db *sql.DB, filter EventLogFilter) ([]EventLog, int, error) {
+	where, args := filter.whereClause()
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM event_logs"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count event logs: %w", err)
+	}
+
+	offset := (filter.Page - 1) * filter.PerPage
+	rows, err := db.Query(
+		"SELECT "+eventLogColumns+" FROM event_logs"+where+" ORDER BY timestamp DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, filter.PerPage, offset)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query event logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := make([]EventLog, 0, filter.PerPage)
+	for rows.Next() {
+		entry, err := scanEventLog(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		logs = append(logs, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read event logs: %w", err)
+	}
+
+	return logs, total, nil
+}
+
+// eventLogColumns are the columns scanEventLog reads, in order
+const eventLogColumns = "id, event_type, description, source_ip, timestamp, severity, related_item_id, related_item_type"
+
+// scanEventLog reads an event log from a row of eventLogColumns
+func scanEventLog(rows *sql.Rows) (EventLog, error) {
+	var entry EventLog
+	var description, sourceIP, severity, relatedType sql.NullString
+	var relatedID sql.NullInt64
+	if err := rows.Scan(&entry.ID, &entry.EventType, &description, &sourceIP, &entry.Timestamp, &severity, &relatedID, &relatedType); err != nil {
+		return EventLog{}, fmt.Errorf("failed to scan event log: %w", err)
+	}
+	entry.Description = description.String
+	entry.SourceIP = sourceIP.String
+	entry.Severity = severity.String
+	entry.RelatedItemType = relatedType.String
+	if relatedID.Valid {
+		entry.RelatedItemID = &relatedID.Int64
+	}
+	return entry, nil
+}
+
+// ipRateLimiter limits requests per client IP with a token bucket for each client
+type ipRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	limit    rate.Limit
+	burst    int
+}
+
+// newIPRateLimiter creates a limiter allowing each client perMinute requests a minute
+func newIPRateLimiter(perMinute int) *ipRateLimiter {
+	return &ipRateLimiter{
+		limiters: make(map[string]*rate.Limiter),
+		limit:    rate.Limit(float64(perMinute) / 60),
+		burst:    perMinute,
+	}
+}
+
+// Allow reports whether a request from the client may proceed
+func (l *ipRateLimiter) Allow(clientIP string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, exists := l.limiters[clientIP]
+	if !exists {
+		// Forget clients whose buckets have refilled before tracking another one
+		if len(l.limiters) >= maxTrackedClients {
+			for ip, tracked := range l.limiters {
+				if tracked.Tokens() >= float64(l.burst) {
+					delete(l.limiters, ip)
+				}
+			}
+		}
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.limiters[clientIP] = limiter
+	}
+	return limiter.Allow()
+}
+
+// parseEventLogRange reads the from and to query parameters, RFC3339
+// timestamps that may each be left out, into the filter
+func parseEventLogRange(query url.Values, filter *EventLogFilter) error {
+	for name, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("%s must be an RFC3339 timestamp", name)
+			}
+			*bound = parsed
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return errors.New("to must not be before from")
+	}
+	return nil
+}
+
+// HandleListEventLogs handles listing the event log, filtered by time range,
+// severity and event type
+func (h *CryptoHandler) HandleListEventLogs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.eventLogLimiter.Allow(remoteIP(r)) {
+			w.Header().Set("Retry-After", "60")
+			respondWithError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+
+		filter := EventLogFilter{Page: 1, PerPage: defaultEventLogsPerPage}
+		query := r.URL.Query()
+		if err := parseEventLogRange(query, &filter); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if value := query.Get("severity"); value != "" {
+			severity := strings.ToUpper(value)
+			if !eventLogSeverities[severity] {
+				respondWithError(w, http.StatusBadRequest, "severity must be INFO, WARNING, ERROR or CRITICAL")
+				return
+			}
+			filter.Severity = severity
+		}
+		filter.EventType = query.Get("event_type")
+		if value := query.Get("page"); value != "" {
+			page, err := strconv.Atoi(value)
+			if err != nil || page < 1 {
+				respondWithError(w, http.StatusBadRequest, "page must be a positive integer")
+				return
+			}
+			filter.Page = page
+		}
+		if value := query.Get("per_page"); value != "" {
+			perPage, err := strconv.Atoi(value)
+			if err != nil || perPage < 1 || perPage > maxEventLogsPerPage {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("per_page must be between 1 and %d", maxEventLogsPerPage))
+				return
+			}
+			filter.PerPage = perPage
+		}
+
+		logs, total, err := listEventLogs(h.keyStore, filter)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to list event logs")
+			respondWithError(w, http.StatusInternalServerError, "failed to list event logs")
+			return
+		}
+
+		response := EventLogResponse{
+			Logs:    logs,
+			Total:   total,
+			Page:    filter.Page,
+			PerPage: filter.PerPage,
+		}
+
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
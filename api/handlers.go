@@ -1,48 +1,291 @@
 package api
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 
 	"pqcd/crypto"
 	"pqcd/benchmark"
+	"pqcd/security"
+)
+
+// Pagination limits for listing stored keys
+const (
+	defaultKeysPerPage = 20
+	maxKeysPerPage     = 100
+)
+
+// Key cache settings used by RegisterRoutes
+const (
+	defaultKeyCacheEntries = 32
+	defaultKeyCacheTTL     = 5 * time.Minute
+)
+
+// MaxBatchKeyCount is the most key pairs a single batch request may generate
+const MaxBatchKeyCount = 100
+
+// maxDecoysPerKey is the most decoys a batch request may attach to each key
+const maxDecoysPerKey = 20
+
+// Public keys larger than largePublicKeySize bytes, such as Classic McEliece's,
+// are sent by HandleKeyGen in chunks of publicKeyChunkSize bytes
+const (
+	largePublicKeySize = 64 << 10
+	publicKeyChunkSize = 16 << 10
+)
+
+// Default bounds of the response delay added for clients marked for deception
+const (
+	defaultJitterMinMs = 0
+	defaultJitterMaxMs = 50
 )
 
 // CryptoHandler handles crypto API requests
 type CryptoHandler struct {
-	registry *crypto.Registry
-	metrics  *benchmark.MetricsCollector
+	registry     *crypto.Registry
+	metrics      *benchmark.MetricsCollector
+	batchWorkers int
+	keyStore     *sql.DB
+	
+	// Private keys written to the key store are encrypted with keyEncryptor
+	keyEncryptor *crypto.KeyEncryptor
+	
+	// Listing event logs is rate limited per client
+	eventLogLimiter       *ipRateLimiter
+	eventLogExportLimiter *ipRateLimiter
+	
+	// Clients the response engine marks for deception get randomly delayed responses
+	responseEngine *security.ResponseEngine
+	jitterMinMs    int
+	jitterMaxMs    int
+	
+	// Only one benchmark suite runs at a time
+	benchmarkRunning atomic.Bool
+	
+	// Key generation responses warn about large public keys when enabled
+	algorithmWarnings bool
+	
+	// The last check of which algorithms can generate keys
+	statusCache algorithmStatusCache
+	
+	// Encapsulations per key this hour, to flag keys being enumerated
+	usage *usageCounter
 }
 
 // NewCryptoHandler creates a new handler for crypto operations
 func NewCryptoHandler(registry *crypto.Registry, metrics *benchmark.MetricsCollector) *CryptoHandler {
 	return &CryptoHandler{
-		registry: registry,
-		metrics:  metrics,
+		registry:              registry,
+		metrics:               metrics,
+		batchWorkers:          batchWorkerCount(),
+		eventLogLimiter:       newIPRateLimiter(eventLogRequestsPerMinute),
+		eventLogExportLimiter: newIPRateLimiter(eventLogExportsPerMinute),
+		jitterMinMs:           envMilliseconds("JITTER_MIN_MS", defaultJitterMinMs),
+		jitterMaxMs:           envMilliseconds("JITTER_MAX_MS", defaultJitterMaxMs),
+		usage:                 newUsageCounter(),
+	}
+}
+
+// SetKeyStore attaches the database used by the key management endpoints
+func (h *CryptoHandler) SetKeyStore(db *sql.DB) {
+	h.keyStore = db
+}
+
+// SetKeyEncryptor attaches the encryptor for private keys written to the key
+// store. Without one, key rotation is unavailable.
+func (h *CryptoHandler) SetKeyEncryptor(encryptor *crypto.KeyEncryptor) {
+	h.keyEncryptor = encryptor
+}
+
+// SetResponseEngine attaches the engine used to decide which clients get jittered responses
+func (h *CryptoHandler) SetResponseEngine(engine *security.ResponseEngine) {
+	h.responseEngine = engine
+}
+
+// SetAlgorithmWarnings sets whether key generation responses for algorithms
+// with large public keys carry a warning about their size
+func (h *CryptoHandler) SetAlgorithmWarnings(enabled bool) {
+	h.algorithmWarnings = enabled
+}
+
+// Registry returns the crypto registry used by the handler
+func (h *CryptoHandler) Registry() *crypto.Registry {
+	return h.registry
+}
+
+// Metrics returns the collector the handler records operations in
+func (h *CryptoHandler) Metrics() *benchmark.MetricsCollector {
+	return h.metrics
+}
+
+// envMilliseconds reads a non-negative millisecond setting from the environment
+func envMilliseconds(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms < 0 {
+		logrus.WithField("value", value).Warnf("Invalid %s, using default of %d", name, fallback)
+		return fallback
+	}
+	return ms
+}
+
+// batchWorkerCount reads the batch key generation pool size from BATCH_WORKER_COUNT
+func batchWorkerCount() int {
+	value := os.Getenv("BATCH_WORKER_COUNT")
+	if value == "" {
+		return 4
 	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 {
+		logrus.WithField("value", value).Warn("Invalid BATCH_WORKER_COUNT, using default of 4")
+		return 4
+	}
+	return count
 }
 
 // KeyGenRequest is empty for now since key generation doesn't need input
 type KeyGenRequest struct{}
 
-// KeyGenResponse is the response for key generation
+// KeyGenResponse is the response for key generation. Public keys larger than
+// 64 KiB are sent as PublicKeyChunks, hex-encoded pieces to be joined in
+// order, instead of PublicKey, and are streamed as they are encoded.
 type KeyGenResponse struct {
+	PublicKey       string    `json:"publicKey,omitempty"`
+	PublicKeyChunks []string  `json:"publicKeyChunks,omitempty"`
+	PrivateKey      string    `json:"privateKey"`
+	Algorithm       string    `json:"algorithm"`
+	Fingerprint     string    `json:"fingerprint"`
+	Decoys          []string  `json:"decoys"`
+	Warning         string    `json:"warning,omitempty"` // Set for large keys when algorithm warnings are on
+	GeneratedAt     time.Time `json:"generatedAt"`
+}
+
+// KeyGenPEMResponse is the response for PEM key generation
+type KeyGenPEMResponse struct {
 	PublicKey   string    `json:"publicKey"`
 	PrivateKey  string    `json:"privateKey"`
 	Algorithm   string    `json:"algorithm"`
 	Fingerprint string    `json:"fingerprint"`
-	Decoys      []string  `json:"decoys"`
+	Warning     string    `json:"warning,omitempty"`
 	GeneratedAt time.Time `json:"generatedAt"`
 }
 
+// BatchKeyGenRequest is the request for bulk key generation
+type BatchKeyGenRequest struct {
+	Algorithm    string `json:"algorithm"`
+	Count        int    `json:"count"`
+	DecoysPerKey int    `json:"decoysPerKey"`
+}
+
+// BatchKeyGenResponse is the response for bulk key generation
+type BatchKeyGenResponse struct {
+	Keys        []KeyGenResponse `json:"keys"`
+	GeneratedAt time.Time        `json:"generatedAt"`
+	TotalMs     int64            `json:"totalMs"`
+}
+
+// KeySummary describes a stored key pair without any key material
+type KeySummary struct {
+	ID           int64      `json:"id"`
+	Fingerprint  string     `json:"fingerprint"`
+	Algorithm    string     `json:"algorithm"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	IsReal       bool       `json:"isReal"`
+	Tags         []string   `json:"tags"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	SupersededBy *int64     `json:"supersededBy,omitempty"` // ID of the key that replaced this one
+}
+
+// KeyRotationResponse is the response for rotating a stored key pair
+type KeyRotationResponse struct {
+	Old KeySummary `json:"old"`
+	New KeySummary `json:"new"`
+}
+
+// DecoyKeyListResponse lists the decoys stored for a real key
+type DecoyKeyListResponse struct {
+	RealFingerprint string       `json:"realFingerprint"`
+	Decoys          []KeySummary `json:"decoys"`
+}
+
+// PKCS12ExportRequest is the request for exporting a stored key pair as PKCS#12.
+// Encryption is "modern" (AES-256, the default) or "legacy" (3DES).
+type PKCS12ExportRequest struct {
+	Password   string `json:"password"`
+	Encryption string `json:"encryption,omitempty"`
+}
+
+// PKCS12ExportResponse carries a base64-encoded PKCS#12 bundle
+type PKCS12ExportResponse struct {
+	ID        int64  `json:"id"`
+	Algorithm string `json:"algorithm"`
+	PFX       string `json:"pfx"`
+}
+
+// PKCS12ImportRequest is the request for importing a base64-encoded PKCS#12 bundle
+type PKCS12ImportRequest struct {
+	PFX      string `json:"pfx"`
+	Password string `json:"password"`
+}
+
+// PublicKeyImportRequest is the request for registering a hex-encoded public
+// key generated elsewhere, without its private key
+type PublicKeyImportRequest struct {
+	PublicKey string   `json:"public_key"`
+	Algorithm string   `json:"algorithm"`
+	Tags      []string `json:"tags"`
+}
+
+// KeyExportableResponse reports whether a stored key pair can be exported
+type KeyExportableResponse struct {
+	ID         int64 `json:"id"`
+	Exportable bool  `json:"exportable"`
+}
+
+// KeyTTLResponse reports how long a stored key has left. Both fields are null
+// for keys that never expire.
+type KeyTTLResponse struct {
+	ID               int64      `json:"id"`
+	ExpiresAt        *time.Time `json:"expiresAt"`
+	RemainingSeconds *int64     `json:"remainingSeconds"`
+}
+
+// UpdateKeyTagsRequest is the request for replacing a stored key's tags
+type UpdateKeyTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// KeyListResponse is the response for listing stored keys
+type KeyListResponse struct {
+	Keys    []KeySummary `json:"keys"`
+	Total   int          `json:"total"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"perPage"`
+}
+
 // EncapsulateRequest is the request for encapsulation
 type EncapsulateRequest struct {
 	PublicKey string `json:"publicKey"`
@@ -90,9 +333,24 @@ type VerifyResponse struct {
 	Valid bool `json:"valid"`
 }
 
+// DeriveRequest is the request for key derivation
+type DeriveRequest struct {
+	SharedSecret string `json:"sharedSecret"`
+	Salt         string `json:"salt"`
+	Info         string `json:"info"`
+	Length       int    `json:"length"`
+}
+
+// DeriveResponse is the response for key derivation
+type DeriveResponse struct {
+	Key    string `json:"key"`
+	Length int    `json:"length"`
+}
+
 // ErrorResponse represents an API error
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
 }
 
 // HealthCheckResponse represents the health check response
@@ -112,99 +370,988 @@ type DecoyGenerationResponse struct {
 	Decoys []string `json:"decoys"`
 }
 
-// HandleHealthCheck handles health check requests
-func (h *CryptoHandler) HandleHealthCheck() http.HandlerFunc {
+// AlgorithmsResponse lists the registered algorithms grouped by operation type
+type AlgorithmsResponse struct {
+	KEM       []crypto.AlgorithmMetadata `json:"kem"`
+	Signature []crypto.AlgorithmMetadata `json:"signature"`
+}
+
+// HandleListAlgorithms returns metadata for every registered algorithm
+func (h *CryptoHandler) HandleListAlgorithms() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := AlgorithmsResponse{
+			KEM:       h.algorithmInfo(h.registry.ListKEMAlgorithms()),
+			Signature: h.algorithmInfo(h.registry.ListSignatureAlgorithms()),
+		}
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// algorithmInfo collects metadata for the given algorithms
+func (h *CryptoHandler) algorithmInfo(algorithms []crypto.Algorithm) []crypto.AlgorithmMetadata {
+	info := make([]crypto.AlgorithmMetadata, 0, len(algorithms))
+	for _, alg := range algorithms {
+		metadata, err := h.registry.AlgorithmInfo(alg)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to get algorithm metadata")
+			continue
+		}
+		info = append(info, metadata)
+	}
+	return info
+}
+
+// HandleHealthCheck handles health check requests
+func (h *CryptoHandler) HandleHealthCheck() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := HealthCheckResponse{Status: "ok"}
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// HandleDecoyGeneration handles decoy generation requests
+func (h *CryptoHandler) HandleDecoyGeneration() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req DecoyGenerationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		response := DecoyGenerationResponse{
+			Decoys: generateDecoys(req.Target, req.Complexity, req.Count),
+		}
+
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// generateDecoys creates placeholder decoy strings derived from a target
+func generateDecoys(target string, complexity, count int) []string {
+	decoys := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		// Generate a random-like string based on target and complexity
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%s-%d-%d", target, complexity, i)))
+		decoys = append(decoys, hex.EncodeToString(hash[:10]))
+	}
+	return decoys
+}
+
+// HandleKeyGen handles key generation requests
+func (h *CryptoHandler) HandleKeyGen() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		algorithm := crypto.Algorithm(vars["alg"])
+		security.RequestLogger(r.Context()).WithField("algorithm", algorithm).Info("Handling key generation request")
+		
+		wrapper := newResponseWriterWrapper(w, "KeyGen")
+		wrapper.setAlgorithm(algorithm)
+		defer wrapper.logOperation(r)
+		w = wrapper
+		
+		keyPair, ok := h.generateKeyPair(w, r, algorithm)
+		if !ok {
+			return
+		}
+		
+		// Create a simple fingerprint (SHA-256 hash of the public key)
+		hash := sha256.Sum256(keyPair.PublicKey)
+		fingerprint := hex.EncodeToString(hash[:])
+
+		// Encode keys as hex strings for JSON response
+		response := KeyGenResponse{
+			PrivateKey:  hex.EncodeToString(keyPair.PrivateKey),
+			Algorithm:   string(keyPair.Algorithm),
+			Fingerprint: fingerprint,
+			Decoys:      []string{}, // Placeholder for now
+			Warning:     h.keySizeWarning(w, keyPair),
+			GeneratedAt: time.Now(),
+		}
+		
+		if len(keyPair.PublicKey) > largePublicKeySize {
+			respondWithPublicKeyChunks(w, response, keyPair.PublicKey)
+			return
+		}
+		response.PublicKey = hex.EncodeToString(keyPair.PublicKey)
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// HandleKeyGenPEM handles key generation requests that return PEM-encoded keys
+func (h *CryptoHandler) HandleKeyGenPEM() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		algorithm := crypto.Algorithm(vars["alg"])
+		security.RequestLogger(r.Context()).WithField("algorithm", algorithm).Info("Handling PEM key generation request")
+		
+		keyPair, ok := h.generateKeyPair(w, r, algorithm)
+		if !ok {
+			return
+		}
+		
+		publicPEM, err := crypto.MarshalPublicKeyToPEM(keyPair)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("PEM encoding failed: %v", err))
+			return
+		}
+		
+		privatePEM, err := crypto.MarshalPrivateKeyToPEM(keyPair)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("PEM encoding failed: %v", err))
+			return
+		}
+		
+		hash := sha256.Sum256(keyPair.PublicKey)
+		
+		response := KeyGenPEMResponse{
+			PublicKey:   string(publicPEM),
+			PrivateKey:  string(privatePEM),
+			Algorithm:   string(keyPair.Algorithm),
+			Fingerprint: hex.EncodeToString(hash[:]),
+			Warning:     h.keySizeWarning(w, keyPair),
+			GeneratedAt: time.Now(),
+		}
+		
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// keySizeWarning returns a warning about the size of keyPair's public key and
+// sets it as the X-Algorithm-Warning header, if algorithm warnings are on and
+// the key is large. Otherwise it returns an empty string.
+func (h *CryptoHandler) keySizeWarning(w http.ResponseWriter, keyPair crypto.KeyPair) string {
+	if !h.algorithmWarnings || len(keyPair.PublicKey) <= largePublicKeySize {
+		return ""
+	}
+	warning := fmt.Sprintf("%s public keys are %d bytes, expect slow transfers and large storage", keyPair.Algorithm, len(keyPair.PublicKey))
+	w.Header().Set("X-Algorithm-Warning", warning)
+	return warning
+}
+
+// HandleBatchKeyGen handles bulk key generation requests using a pool of workers
+func (h *CryptoHandler) HandleBatchKeyGen() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req BatchKeyGenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		
+		if req.Count < 1 || req.Count > MaxBatchKeyCount {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("count must be between 1 and %d", MaxBatchKeyCount))
+			return
+		}
+		if req.DecoysPerKey < 0 || req.DecoysPerKey > maxDecoysPerKey {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("decoysPerKey must be between 0 and %d", maxDecoysPerKey))
+			return
+		}
+		
+		algorithm := crypto.Algorithm(req.Algorithm)
+		ctx, span := startSpan(r, "keygen", "KeyGen", algorithm)
+		defer span.End()
+		span.SetAttributes(attribute.Int("crypto.batch_count", req.Count))
+		
+		provider, err := h.keyGenProvider(algorithm)
+		if err != nil {
+			failSpan(span, err)
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported algorithm: %s", algorithm))
+			return
+		}
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"algorithm": algorithm,
+			"count":     req.Count,
+			"workers":   h.batchWorkers,
+		}).Info("Handling batch key generation request")
+		
+		start := time.Now()
+		
+		// Each worker writes only to the slots of the indices it receives
+		keys := make([]KeyGenResponse, req.Count)
+		errs := make([]error, req.Count)
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		
+		workers := h.batchWorkers
+		if workers > req.Count {
+			workers = req.Count
+		}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for index := range jobs {
+					keyStart := time.Now()
+					keyPair, err := provider.KeyGen(ctx)
+					if err != nil {
+						errs[index] = err
+						continue
+					}
+					h.metrics.RecordOperation(ctx, algorithm, "KeyGen", time.Since(keyStart), len(keyPair.PublicKey), len(keyPair.PrivateKey), true)
+					
+					hash := sha256.Sum256(keyPair.PublicKey)
+					fingerprint := hex.EncodeToString(hash[:])
+					keys[index] = KeyGenResponse{
+						PublicKey:   hex.EncodeToString(keyPair.PublicKey),
+						PrivateKey:  hex.EncodeToString(keyPair.PrivateKey),
+						Algorithm:   string(keyPair.Algorithm),
+						Fingerprint: fingerprint,
+						Decoys:      generateDecoys(fingerprint, 5, req.DecoysPerKey),
+						GeneratedAt: time.Now(),
+					}
+				}
+			}()
+		}
+		
+		for i := 0; i < req.Count; i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		
+		for _, err := range errs {
+			if err != nil {
+				security.RequestLogger(r.Context()).WithError(err).Error("Batch key generation failed")
+				failSpan(span, err)
+				respondWithCryptoError(w, "key generation failed", err)
+				return
+			}
+		}
+		
+		response := BatchKeyGenResponse{
+			Keys:        keys,
+			GeneratedAt: time.Now(),
+			TotalMs:     time.Since(start).Milliseconds(),
+		}
+		
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// HandleCacheStats reports the key cache hit and miss counts
+func (h *CryptoHandler) HandleCacheStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cache := h.registry.KeyCache()
+		if cache == nil {
+			respondWithError(w, http.StatusNotFound, "key cache is not enabled")
+			return
+		}
+		
+		respondWithJSON(w, http.StatusOK, cache.Stats())
+	}
+}
+
+// HandleListKeys handles listing stored key pairs with pagination and filtering
+func (h *CryptoHandler) HandleListKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		
+		query := r.URL.Query()
+		filter := KeyFilter{
+			Algorithm: query.Get("algorithm"),
+			Page:      1,
+			PerPage:   defaultKeysPerPage,
+		}
+		
+		if value := query.Get("is_real"); value != "" {
+			isReal, err := strconv.ParseBool(value)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "is_real must be a boolean")
+				return
+			}
+			filter.IsReal = &isReal
+		}
+		// tag is shorthand for tags with a single tag
+		for _, value := range []string{query.Get("tags"), query.Get("tag")} {
+			if value == "" {
+				continue
+			}
+			for _, tag := range strings.Split(value, ",") {
+				if err := validateTag(tag); err != nil {
+					respondWithError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+				filter.Tags = append(filter.Tags, tag)
+			}
+		}
+		if value := query.Get("tag_mode"); value != "" {
+			if value != TagModeAll && value != TagModeAny {
+				respondWithError(w, http.StatusBadRequest, "tag_mode must be all or any")
+				return
+			}
+			filter.TagMode = value
+		}
+		if value := query.Get("status"); value != "" {
+			if value != KeyStatusActive && value != KeyStatusExpired {
+				respondWithError(w, http.StatusBadRequest, "status must be active or expired")
+				return
+			}
+			filter.Status = value
+		}
+		if value := query.Get("page"); value != "" {
+			page, err := strconv.Atoi(value)
+			if err != nil || page < 1 {
+				respondWithError(w, http.StatusBadRequest, "page must be a positive integer")
+				return
+			}
+			filter.Page = page
+		}
+		if value := query.Get("per_page"); value != "" {
+			perPage, err := strconv.Atoi(value)
+			if err != nil || perPage < 1 || perPage > maxKeysPerPage {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("per_page must be between 1 and %d", maxKeysPerPage))
+				return
+			}
+			filter.PerPage = perPage
+		}
+		
+		keys, total, err := listKeys(h.keyStore, filter)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to list keys")
+			respondWithError(w, http.StatusInternalServerError, "failed to list keys")
+			return
+		}
+		
+		response := KeyListResponse{
+			Keys:    keys,
+			Total:   total,
+			Page:    filter.Page,
+			PerPage: filter.PerPage,
+		}
+		
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// HandleUpdateKeyTags handles replacing the tags of a stored key pair
+func (h *CryptoHandler) HandleUpdateKeyTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid key id")
+			return
+		}
+		
+		var req UpdateKeyTagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		
+		tags, err := serializeTags(req.Tags)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		
+		err = updateKeyTags(h.keyStore, id, tags)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("key %d not found", id))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to update key tags")
+			respondWithError(w, http.StatusInternalServerError, "failed to update key tags")
+			return
+		}
+		
+		key, err := getKey(h.keyStore, id)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read updated key")
+			respondWithError(w, http.StatusInternalServerError, "failed to read updated key")
+			return
+		}
+		
+		respondWithJSON(w, http.StatusOK, key)
+	}
+}
+
+// HandleKeyTTL reports the remaining lifetime of a stored key pair
+func (h *CryptoHandler) HandleKeyTTL() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid key id")
+			return
+		}
+		
+		key, err := getKey(h.keyStore, id)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("key %d not found", id))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read key")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key")
+			return
+		}
+		
+		response := KeyTTLResponse{ID: id, ExpiresAt: key.ExpiresAt}
+		if key.ExpiresAt != nil {
+			// Expired keys report zero until the backend purges them
+			remaining := int64(time.Until(*key.ExpiresAt).Seconds())
+			if remaining < 0 {
+				remaining = 0
+			}
+			response.RemainingSeconds = &remaining
+		}
+		
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// HandleRotateKey handles replacing a stored key pair with a freshly generated
+// one. The old key is kept, marked as superseded, so ciphertext from before the
+// rotation can still be decrypted.
+func (h *CryptoHandler) HandleRotateKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		if h.keyEncryptor == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key encryption is not configured")
+			return
+		}
+		
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid key id")
+			return
+		}
+		
+		old, err := getKey(h.keyStore, id)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("key %d not found", id))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read key")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key")
+			return
+		}
+		if !old.IsReal {
+			respondWithError(w, http.StatusBadRequest, "decoy keys cannot be rotated")
+			return
+		}
+		if old.SupersededBy != nil {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("key %d has already been rotated to key %d", id, *old.SupersededBy))
+			return
+		}
+		
+		keyPair, ok := h.generateKeyPair(w, r, registryAlgorithm(old.Algorithm))
+		if !ok {
+			return
+		}
+		storedPrivateKey, err := h.keyEncryptor.EncryptForStorage(keyPair.PrivateKey)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to encrypt replacement key")
+			respondWithError(w, http.StatusInternalServerError, "failed to encrypt replacement key")
+			return
+		}
+		
+		newID, err := rotateKey(h.keyStore, id, keyPair.PublicKey, storedPrivateKey)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("key %d not found", id))
+			return
+		}
+		if errors.Is(err, errKeySuperseded) {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("key %d has already been rotated", id))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to rotate key")
+			respondWithError(w, http.StatusInternalServerError, "failed to rotate key")
+			return
+		}
+		
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"id":     id,
+			"new_id": newID,
+		}).Warn("Key pair rotated")
+		
+		description := fmt.Sprintf("Key pair %d rotated, replaced by key pair %d", id, newID)
+		if err := logKeyEvent(h.keyStore, r, "key_rotation", description, "WARNING", id); err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to log key rotation")
+		}
+		
+		var response KeyRotationResponse
+		if response.Old, err = getKey(h.keyStore, id); err == nil {
+			response.New, err = getKey(h.keyStore, newID)
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read rotated keys")
+			respondWithError(w, http.StatusInternalServerError, "failed to read rotated keys")
+			return
+		}
+		
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// HandleExportPKCS12 handles exporting a stored key pair as a password-protected
+// PKCS#12 bundle
+func (h *CryptoHandler) HandleExportPKCS12() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		if h.keyEncryptor == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key encryption is not configured")
+			return
+		}
+		
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid key id")
+			return
+		}
+		
+		var req PKCS12ExportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if req.Password == "" {
+			respondWithError(w, http.StatusBadRequest, "password is required")
+			return
+		}
+		var encryption crypto.PKCS12Encryption
+		switch req.Encryption {
+		case "", "modern":
+			encryption = crypto.PKCS12Modern
+		case "legacy":
+			encryption = crypto.PKCS12Legacy
+		default:
+			respondWithError(w, http.StatusBadRequest, "encryption must be modern or legacy")
+			return
+		}
+		
+		key, err := getKey(h.keyStore, id)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("key %d not found", id))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read key")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key")
+			return
+		}
+		if !key.IsReal {
+			respondWithError(w, http.StatusBadRequest, "decoy keys cannot be exported")
+			return
+		}
+		
+		publicKey, storedPrivateKey, err := getKeyMaterial(h.keyStore, id)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read key material")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key")
+			return
+		}
+		if storedPrivateKey == nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("key %d was imported without a private key", id))
+			return
+		}
+		privateKey, err := h.keyEncryptor.DecryptFromStorage(storedPrivateKey)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to decrypt stored key")
+			respondWithError(w, http.StatusInternalServerError, "failed to decrypt key")
+			return
+		}
+		defer crypto.ZeroBytes(privateKey)
+		
+		keyPair := crypto.KeyPair{
+			PublicKey:  publicKey,
+			PrivateKey: privateKey,
+			Algorithm:  registryAlgorithm(key.Algorithm),
+		}
+		pfx, err := crypto.ExportPKCS12WithEncryption(keyPair, req.Password, encryption)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to export key: %v", err))
+			return
+		}
+		
+		security.RequestLogger(r.Context()).WithField("id", id).Warn("Key pair exported")
+		
+		description := fmt.Sprintf("Key pair %d exported as PKCS#12", id)
+		if err := logKeyEvent(h.keyStore, r, "key_export", description, "WARNING", id); err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to log key export")
+		}
+		
+		response := PKCS12ExportResponse{
+			ID:        id,
+			Algorithm: key.Algorithm,
+			PFX:       base64.StdEncoding.EncodeToString(pfx),
+		}
+		
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// HandleImportPKCS12 handles storing the key pair from a PKCS#12 bundle written
+// by HandleExportPKCS12
+func (h *CryptoHandler) HandleImportPKCS12() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		response := HealthCheckResponse{Status: "ok"}
-		respondWithJSON(w, http.StatusOK, response)
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		if h.keyEncryptor == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key encryption is not configured")
+			return
+		}
+		
+		var req PKCS12ImportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		pfx, err := base64.StdEncoding.DecodeString(req.PFX)
+		if err != nil || len(pfx) == 0 {
+			respondWithError(w, http.StatusBadRequest, "pfx must be base64-encoded")
+			return
+		}
+		
+		keyPair, err := crypto.ImportPKCS12(pfx, req.Password)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to import key: %v", err))
+			return
+		}
+		storedPrivateKey, err := h.keyEncryptor.EncryptForStorage(keyPair.PrivateKey)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encrypt imported key")
+			respondWithError(w, http.StatusInternalServerError, "failed to encrypt imported key")
+			return
+		}
+		
+		id, err := importKey(h.keyStore, string(keyPair.Algorithm), keyPair.PublicKey, storedPrivateKey, "")
+		if errors.Is(err, errKeyExists) {
+			respondWithError(w, http.StatusConflict, "key is already stored")
+			return
+		}
+		if err != nil {
+			logrus.WithError(err).Error("Failed to import key")
+			respondWithError(w, http.StatusInternalServerError, "failed to import key")
+			return
+		}
+		
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"id":        id,
+			"algorithm": keyPair.Algorithm,
+		}).Info("Key pair imported")
+		
+		description := fmt.Sprintf("Key pair %d imported from PKCS#12", id)
+		if err := logKeyEvent(h.keyStore, r, "key_import", description, "INFO", id); err != nil {
+			logrus.WithError(err).Error("Failed to log key import")
+		}
+		
+		key, err := getKey(h.keyStore, id)
+		if err != nil {
+			logrus.WithError(err).WithField("id", id).Error("Failed to read imported key")
+			respondWithError(w, http.StatusInternalServerError, "failed to read imported key")
+			return
+		}
+		
+		respondWithJSON(w, http.StatusCreated, key)
 	}
 }
 
-// HandleDecoyGeneration handles decoy generation requests
-func (h *CryptoHandler) HandleDecoyGeneration() http.HandlerFunc {
+// HandleImportPublicKey handles registering a public key generated offline so
+// decoys can be made for it. The private key never reaches the server, so the
+// stored key can't be exported.
+func (h *CryptoHandler) HandleImportPublicKey() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req DecoyGenerationRequest
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		
+		var req PublicKeyImportRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			respondWithError(w, http.StatusBadRequest, "invalid request body")
 			return
 		}
-
-		// Placeholder: Generate simple random strings as decoys
-		decoys := make([]string, 0, req.Count)
-		for i := 0; i < req.Count; i++ {
-			// Generate a random-like string based on target and complexity
-			hash := sha256.Sum256([]byte(fmt.Sprintf("%s-%d-%d", req.Target, req.Complexity, i)))
-			decoys = append(decoys, hex.EncodeToString(hash[:10]))
+		publicKey, err := hex.DecodeString(req.PublicKey)
+		if err != nil || len(publicKey) == 0 {
+			respondWithError(w, http.StatusBadRequest, "public_key must be hex-encoded")
+			return
 		}
-
-		response := DecoyGenerationResponse{
-			Decoys: decoys,
+		
+		algorithm := crypto.Algorithm(req.Algorithm)
+		info, err := h.registry.AlgorithmInfo(algorithm)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported algorithm: %s", req.Algorithm))
+			return
 		}
-
-		respondWithJSON(w, http.StatusOK, response)
+		if len(publicKey) != info.PublicKeySize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s public keys are %d bytes, got %d", algorithm, info.PublicKeySize, len(publicKey)))
+			return
+		}
+		
+		tags, err := serializeTags(req.Tags)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		
+		id, err := importKey(h.keyStore, string(algorithm), publicKey, nil, tags)
+		if errors.Is(err, errKeyExists) {
+			respondWithError(w, http.StatusConflict, "key is already stored")
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to import public key")
+			respondWithError(w, http.StatusInternalServerError, "failed to import public key")
+			return
+		}
+		
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"id":        id,
+			"algorithm": algorithm,
+		}).Info("Public key imported")
+		
+		description := fmt.Sprintf("Public key %d imported without a private key", id)
+		if err := logKeyEvent(h.keyStore, r, "key_import", description, "INFO", id); err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to log public key import")
+		}
+		
+		key, err := getKey(h.keyStore, id)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read imported key")
+			respondWithError(w, http.StatusInternalServerError, "failed to read imported key")
+			return
+		}
+		
+		respondWithJSON(w, http.StatusCreated, key)
 	}
 }
 
-// HandleKeyGen handles key generation requests
-func (h *CryptoHandler) HandleKeyGen() http.HandlerFunc {
+// HandleKeyExportable reports whether a stored key pair can be exported, which
+// imported public keys and decoys can't
+func (h *CryptoHandler) HandleKeyExportable() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		algorithm := crypto.Algorithm(vars["alg"])
-		logrus.WithField("algorithm", algorithm).Info("Handling key generation request")
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
 		
-		start := time.Now()
-		var keyPair crypto.KeyPair
-		var err error
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid key id")
+			return
+		}
 		
-		// Check if it's a KEM or signature algorithm
-		if strings.HasPrefix(string(algorithm), "ml-kem") || algorithm == crypto.AlgECDH {
-			provider, err := h.registry.GetKEMProvider(algorithm)
-			if err != nil {
-				logrus.WithError(err).Error("Failed to get KEM provider")
-				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported algorithm: %s", algorithm))
-				return
-			}
-			keyPair, err = provider.KeyGen()
-		} else {
-			provider, err := h.registry.GetSignatureProvider(algorithm)
-			if err != nil {
-				logrus.WithError(err).Error("Failed to get signature provider")
-				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported algorithm: %s", algorithm))
-				return
-			}
-			keyPair, err = provider.KeyGen()
+		exportable, err := keyExportable(h.keyStore, id)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("key %d not found", id))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read key")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key")
+			return
+		}
+		
+		respondWithJSON(w, http.StatusOK, KeyExportableResponse{ID: id, Exportable: exportable})
+	}
+}
+
+// HandleDeleteKey handles revoking a stored key pair
+func (h *CryptoHandler) HandleDeleteKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
 		}
 		
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 		if err != nil {
-			logrus.WithError(err).Error("Key generation failed")
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("key generation failed: %v", err))
+			respondWithError(w, http.StatusBadRequest, "invalid key id")
 			return
 		}
 		
-		duration := time.Since(start)
-		h.metrics.RecordOperation(algorithm, "KeyGen", duration, len(keyPair.PublicKey), len(keyPair.PrivateKey), true)
+		decoys, err := deleteKey(h.keyStore, id)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("key %d not found", id))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to delete key")
+			respondWithError(w, http.StatusInternalServerError, "failed to delete key")
+			return
+		}
 		
-		// Create a simple fingerprint (SHA-256 hash of the public key)
-		hash := sha256.Sum256(keyPair.PublicKey)
-		fingerprint := hex.EncodeToString(hash[:])
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"id":     id,
+			"decoys": decoys,
+		}).Warn("Key pair deleted")
+		
+		description := fmt.Sprintf("Key pair %d deleted along with %d decoys", id, decoys)
+		if err := logKeyEvent(h.keyStore, r, "key_deletion", description, "CRITICAL", id); err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Failed to log key deletion")
+		}
+		
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
 
-		// Encode keys as hex strings for JSON response
-		response := KeyGenResponse{
-			PublicKey:   hex.EncodeToString(keyPair.PublicKey),
-			PrivateKey:  hex.EncodeToString(keyPair.PrivateKey),
-			Algorithm:   string(keyPair.Algorithm),
-			Fingerprint: fingerprint,
-			Decoys:      []string{}, // Placeholder for now
-			GeneratedAt: time.Now(),
+// HandleGetKeyDecoys handles listing the decoys stored for a real key, given
+// its fingerprint
+func (h *CryptoHandler) HandleGetKeyDecoys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
 		}
 		
-		respondWithJSON(w, http.StatusOK, response)
+		fingerprint := mux.Vars(r)["fingerprint"]
+		decoys, err := listKeyDecoys(h.keyStore, fingerprint)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("no real key with fingerprint %s", fingerprint))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("fingerprint", fingerprint).Error("Failed to list decoys")
+			respondWithError(w, http.StatusInternalServerError, "failed to list decoys")
+			return
+		}
+		
+		respondWithJSON(w, http.StatusOK, DecoyKeyListResponse{
+			RealFingerprint: fingerprint,
+			Decoys:          decoys,
+		})
+	}
+}
+
+// jitterResponse sleeps for a cryptographically random duration between minMs
+// and maxMs milliseconds, returning early if ctx is cancelled
+func jitterResponse(ctx context.Context, minMs, maxMs int) {
+	if maxMs < minMs {
+		maxMs = minMs
+	}
+	delay := time.Duration(minMs) * time.Millisecond
+	if spread := time.Duration(maxMs-minMs) * time.Millisecond; spread > 0 {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(spread)+1))
+		if err != nil {
+			security.RequestLogger(ctx).WithError(err).Error("Failed to generate response jitter")
+		} else {
+			delay += time.Duration(n.Int64())
+		}
+	}
+	if delay <= 0 {
+		return
 	}
+	
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// jitter delays the response to a client the response engine has marked for
+// deception, so its timing measurements carry no information about the keys
+func (h *CryptoHandler) jitter(r *http.Request) {
+	if h.responseEngine == nil || !h.responseEngine.ShouldDeceive(remoteIP(r)) {
+		return
+	}
+	jitterResponse(r.Context(), h.jitterMinMs, h.jitterMaxMs)
+}
+
+// remoteIP returns the client address of a request without its port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// keyGenProvider returns the KEM or signature provider registered for an algorithm
+func (h *CryptoHandler) keyGenProvider(algorithm crypto.Algorithm) (crypto.CryptoProvider, error) {
+	// Check if it's a KEM or signature algorithm
+	if provider, err := h.registry.GetKEMProvider(algorithm); err == nil {
+		return provider, nil
+	}
+	
+	provider, err := h.registry.GetSignatureProvider(algorithm)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get signature provider")
+		return nil, err
+	}
+	return provider, nil
+}
+
+// generateKeyPair runs key generation for an algorithm within a "keygen" span and
+// records its metrics. On failure it writes the error response and returns false.
+func (h *CryptoHandler) generateKeyPair(w http.ResponseWriter, r *http.Request, algorithm crypto.Algorithm) (crypto.KeyPair, bool) {
+	ctx, span := startSpan(r, "keygen", "KeyGen", algorithm)
+	defer span.End()
+	
+	if err := h.registry.ValidateAlgorithm(algorithm); err != nil {
+		failSpan(span, err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return crypto.KeyPair{}, false
+	}
+	
+	provider, err := h.keyGenProvider(algorithm)
+	if err != nil {
+		failSpan(span, err)
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported algorithm: %s", algorithm))
+		return crypto.KeyPair{}, false
+	}
+	
+	// Callers that only need a short-lived key can opt into the key cache
+	cache := h.registry.KeyCache()
+	if cache != nil && r.URL.Query().Get("cached") == "true" {
+		span.SetAttributes(attribute.Bool("crypto.cached", true))
+		keyPair, err := cache.GetOrGenerate(ctx, algorithm)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Error("Cached key generation failed")
+			failSpan(span, err)
+			respondWithCryptoError(w, "key generation failed", err)
+			return crypto.KeyPair{}, false
+		}
+		return keyPair, true
+	}
+	
+	start := time.Now()
+	keyPair, err := provider.KeyGen(ctx)
+	if err != nil {
+		security.RequestLogger(r.Context()).WithError(err).Error("Key generation failed")
+		failSpan(span, err)
+		respondWithCryptoError(w, "key generation failed", err)
+		return crypto.KeyPair{}, false
+	}
+	
+	duration := time.Since(start)
+	h.metrics.RecordOperation(ctx, algorithm, "KeyGen", duration, len(keyPair.PublicKey), len(keyPair.PrivateKey), true)
+	setOperationLatency(w, duration)
+	
+	return keyPair, true
 }
 
 // HandleEncapsulate handles encapsulation requests
 func (h *CryptoHandler) HandleEncapsulate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		wrapper := newResponseWriterWrapper(w, "Encapsulate")
+		defer wrapper.logOperation(r)
+		w = wrapper
+		
 		var req EncapsulateRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			respondWithError(w, http.StatusBadRequest, "invalid request body")
@@ -212,6 +1359,14 @@ func (h *CryptoHandler) HandleEncapsulate() http.HandlerFunc {
 		}
 
 		algorithm := crypto.Algorithm(req.Algorithm)
+		wrapper.setAlgorithm(algorithm)
+		ctx, span := startSpan(r, "encapsulate", "Encapsulate", algorithm)
+		defer span.End()
+		
+		if err := h.registry.ValidateAlgorithm(algorithm); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		
 		// Decode public key from hex
 		publicKey, err := hex.DecodeString(req.PublicKey)
@@ -219,6 +1374,10 @@ func (h *CryptoHandler) HandleEncapsulate() http.HandlerFunc {
 			respondWithError(w, http.StatusBadRequest, "invalid public key format")
 			return
 		}
+		if err := crypto.ValidatePublicKeySize(algorithm, publicKey); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		
 		// Get the KEM provider
 		provider, err := h.registry.GetKEMProvider(algorithm)
@@ -229,14 +1388,28 @@ func (h *CryptoHandler) HandleEncapsulate() http.HandlerFunc {
 		
 		// Perform encapsulation
 		start := time.Now()
-		ciphertext, sharedSecret, err := provider.Encapsulate(publicKey)
+		ciphertext, sharedSecret, err := provider.Encapsulate(ctx, publicKey)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("encapsulation failed: %v", err))
+			failSpan(span, err)
+			respondWithCryptoError(w, "encapsulation failed", err)
 			return
 		}
 		duration := time.Since(start)
 		
-		h.metrics.RecordOperation(algorithm, "Encapsulate", duration, len(publicKey), len(ciphertext), true)
+		h.metrics.RecordOperation(ctx, algorithm, "Encapsulate", duration, len(publicKey), len(ciphertext), true)
+		setOperationLatency(w, duration)
+		h.trackKeyUsage(r, storedFingerprint(publicKey), usageEncapsulate)
+		
+		// Clients flagged by the security layer get a decoy in place of the real
+		// result. The real encapsulation still runs so errors and timing match.
+		if security.DeceptionEnabled(r.Context()) && h.responseEngine != nil {
+			security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+				"ip":        remoteIP(r),
+				"algorithm": algorithm,
+			}).Warn("Serving decoy encapsulation")
+			span.SetAttributes(attribute.Bool("security.decoy", true))
+			ciphertext, sharedSecret = h.responseEngine.GenerateDecoyEncapsulateResponse(algorithm)
+		}
 		
 		// Prepare response
 		response := EncapsulateResponse{
@@ -244,6 +1417,7 @@ func (h *CryptoHandler) HandleEncapsulate() http.HandlerFunc {
 			SharedSecret: hex.EncodeToString(sharedSecret),
 		}
 		
+		h.jitter(r)
 		respondWithJSON(w, http.StatusOK, response)
 	}
 }
@@ -251,6 +1425,10 @@ func (h *CryptoHandler) HandleEncapsulate() http.HandlerFunc {
 // HandleDecapsulate handles decapsulation requests
 func (h *CryptoHandler) HandleDecapsulate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		wrapper := newResponseWriterWrapper(w, "Decapsulate")
+		defer wrapper.logOperation(r)
+		w = wrapper
+		
 		var req DecapsulateRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			respondWithError(w, http.StatusBadRequest, "invalid request body")
@@ -258,6 +1436,14 @@ func (h *CryptoHandler) HandleDecapsulate() http.HandlerFunc {
 		}
 
 		algorithm := crypto.Algorithm(req.Algorithm)
+		wrapper.setAlgorithm(algorithm)
+		ctx, span := startSpan(r, "decapsulate", "Decapsulate", algorithm)
+		defer span.End()
+		
+		if err := h.registry.ValidateAlgorithm(algorithm); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		
 		// Decode private key and ciphertext from hex
 		privateKey, err := hex.DecodeString(req.PrivateKey)
@@ -265,6 +1451,7 @@ func (h *CryptoHandler) HandleDecapsulate() http.HandlerFunc {
 			respondWithError(w, http.StatusBadRequest, "invalid private key format")
 			return
 		}
+		defer crypto.ZeroBytes(privateKey)
 		
 		ciphertext, err := hex.DecodeString(req.Ciphertext)
 		if err != nil {
@@ -281,20 +1468,32 @@ func (h *CryptoHandler) HandleDecapsulate() http.HandlerFunc {
 		
 		// Perform decapsulation
 		start := time.Now()
-		sharedSecret, err := provider.Decapsulate(privateKey, ciphertext)
+		sharedSecret, err := provider.Decapsulate(ctx, privateKey, ciphertext)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("decapsulation failed: %v", err))
+			failSpan(span, err)
+			respondWithCryptoError(w, "decapsulation failed", err)
 			return
 		}
 		duration := time.Since(start)
 		
-		h.metrics.RecordOperation(algorithm, "Decapsulate", duration, len(privateKey), len(ciphertext), true)
+		h.metrics.RecordOperation(ctx, algorithm, "Decapsulate", duration, len(privateKey), len(ciphertext), true)
+		setOperationLatency(w, duration)
+		
+		// The public key isn't sent for decapsulation, so it is derived to count
+		// the use under the key's fingerprint. Keys of providers that can't
+		// derive it aren't counted.
+		if deriver, ok := provider.(crypto.PublicKeyDeriver); ok {
+			if publicKey, err := deriver.DerivePublicKey(privateKey); err == nil {
+				h.trackKeyUsage(r, storedFingerprint(publicKey), usageDecapsulate)
+			}
+		}
 		
 		// Prepare response
 		response := DecapsulateResponse{
 			SharedSecret: hex.EncodeToString(sharedSecret),
 		}
 		
+		h.jitter(r)
 		respondWithJSON(w, http.StatusOK, response)
 	}
 }
@@ -304,6 +1503,13 @@ func (h *CryptoHandler) HandleSign() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		algorithm := crypto.Algorithm(vars["alg"])
+		ctx, span := startSpan(r, "sign", "Sign", algorithm)
+		defer span.End()
+		
+		wrapper := newResponseWriterWrapper(w, "Sign")
+		wrapper.setAlgorithm(algorithm)
+		defer wrapper.logOperation(r)
+		w = wrapper
 		
 		var req SignRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -317,6 +1523,7 @@ func (h *CryptoHandler) HandleSign() http.HandlerFunc {
 			respondWithError(w, http.StatusBadRequest, "invalid private key format")
 			return
 		}
+		defer crypto.ZeroBytes(privateKey)
 		
 		// Get the signature provider
 		provider, err := h.registry.GetSignatureProvider(algorithm)
@@ -327,20 +1534,23 @@ func (h *CryptoHandler) HandleSign() http.HandlerFunc {
 		
 		// Perform signing
 		start := time.Now()
-		signature, err := provider.Sign(privateKey, []byte(req.Message))
+		signature, err := provider.Sign(ctx, privateKey, []byte(req.Message))
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("signing failed: %v", err))
+			failSpan(span, err)
+			respondWithCryptoError(w, "signing failed", err)
 			return
 		}
 		duration := time.Since(start)
 		
-		h.metrics.RecordOperation(algorithm, "Sign", duration, len(privateKey), len(signature), true)
+		h.metrics.RecordOperation(ctx, algorithm, "Sign", duration, len(privateKey), len(signature), true)
+		setOperationLatency(w, duration)
 		
 		// Prepare response
 		response := SignResponse{
 			Signature: hex.EncodeToString(signature),
 		}
 		
+		h.jitter(r)
 		respondWithJSON(w, http.StatusOK, response)
 	}
 }
@@ -350,6 +1560,13 @@ func (h *CryptoHandler) HandleVerify() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		algorithm := crypto.Algorithm(vars["alg"])
+		ctx, span := startSpan(r, "verify", "Verify", algorithm)
+		defer span.End()
+		
+		wrapper := newResponseWriterWrapper(w, "Verify")
+		wrapper.setAlgorithm(algorithm)
+		defer wrapper.logOperation(r)
+		w = wrapper
 		
 		var req VerifyRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -379,28 +1596,81 @@ func (h *CryptoHandler) HandleVerify() http.HandlerFunc {
 		
 		// Perform verification
 		start := time.Now()
-		valid, err := provider.Verify(publicKey, []byte(req.Message), signature)
+		valid, err := provider.Verify(ctx, publicKey, []byte(req.Message), signature)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("verification failed: %v", err))
+			failSpan(span, err)
+			respondWithCryptoError(w, "verification failed", err)
 			return
 		}
 		duration := time.Since(start)
 		
-		h.metrics.RecordOperation(algorithm, "Verify", duration, len(publicKey), len(signature), valid)
+		h.metrics.RecordOperation(ctx, algorithm, "Verify", duration, len(publicKey), len(signature), valid)
+		setOperationLatency(w, duration)
 		
 		// Prepare response
 		response := VerifyResponse{
 			Valid: valid,
 		}
 		
+		h.jitter(r)
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// HandleDerive handles HKDF key derivation requests
+func (h *CryptoHandler) HandleDerive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req DeriveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		
+		// Decode shared secret and optional salt from hex
+		sharedSecret, err := hex.DecodeString(req.SharedSecret)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid shared secret format")
+			return
+		}
+		
+		salt, err := hex.DecodeString(req.Salt)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid salt format")
+			return
+		}
+		
+		if req.Length == 0 {
+			req.Length = 32 // Default to an AES-256 key
+		}
+		
+		key, err := crypto.DeriveKeyWithSalt(sharedSecret, salt, []byte(req.Info), req.Length)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("key derivation failed: %v", err))
+			return
+		}
+		
+		response := DeriveResponse{
+			Key:    hex.EncodeToString(key),
+			Length: len(key),
+		}
+		
 		respondWithJSON(w, http.StatusOK, response)
 	}
 }
 
 // Helper functions for API responses
 
+// errorLogger returns a log entry carrying the request ID that
+// RequestIDMiddleware set on w, for the helpers that don't see the request
+func errorLogger(w http.ResponseWriter) *logrus.Entry {
+	if id := w.Header().Get(security.RequestIDHeader); id != "" {
+		return logrus.WithField("request_id", id)
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
 func respondWithError(w http.ResponseWriter, code int, message string) {
-	logrus.WithFields(logrus.Fields{
+	errorLogger(w).WithFields(logrus.Fields{
 		"status_code": code,
 		"error":       message,
 	}).Error("API error")
@@ -408,11 +1678,84 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, ErrorResponse{Error: message})
 }
 
+// respondWithCryptoError writes a provider error, translating its code into the
+// matching HTTP status: bad keys or inputs are the client's fault, anything else is ours
+func respondWithCryptoError(w http.ResponseWriter, message string, err error) {
+	status := http.StatusInternalServerError
+	var code string
+	
+	var cryptoErr *crypto.CryptoError
+	if errors.As(err, &cryptoErr) {
+		code = string(cryptoErr.Code)
+		switch cryptoErr.Code {
+		case crypto.ErrCodeInvalidKey, crypto.ErrCodeInvalidInput:
+			status = http.StatusBadRequest
+		case crypto.ErrCodeUnsupported:
+			status = http.StatusNotImplemented
+		case crypto.ErrCodeCanceled:
+			status = http.StatusServiceUnavailable
+		}
+	}
+	
+	errorLogger(w).WithFields(logrus.Fields{
+		"status_code": status,
+		"error":       err.Error(),
+	}).Error("API error")
+	
+	respondWithJSON(w, status, ErrorResponse{
+		Error: fmt.Sprintf("%s: %v", message, err),
+		Code:  code,
+	})
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		logrus.WithError(err).Error("Failed to encode JSON response")
+		errorLogger(w).WithError(err).Error("Failed to encode JSON response")
+	}
+}
+// respondWithPublicKeyChunks writes response with publicKey as its
+// PublicKeyChunks, flushing each chunk as it is written so the whole key is
+// never encoded in memory at once
+func respondWithPublicKeyChunks(w http.ResponseWriter, response KeyGenResponse, publicKey []byte) {
+	response.PublicKey = ""
+	rest, err := json.Marshal(response)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to encode response")
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	
+	chunk := make([]byte, 0, hex.EncodedLen(publicKeyChunkSize)+3)
+	for offset := 0; offset < len(publicKey); offset += publicKeyChunkSize {
+		end := min(offset+publicKeyChunkSize, len(publicKey))
+		chunk = chunk[:0]
+		if offset == 0 {
+			chunk = append(chunk, `{"publicKeyChunks":[`...)
+		} else {
+			chunk = append(chunk, ',')
+		}
+		chunk = append(chunk, '"')
+		chunk = hex.AppendEncode(chunk, publicKey[offset:end])
+		chunk = append(chunk, '"')
+		if _, err := w.Write(chunk); err != nil {
+			errorLogger(w).WithError(err).Error("Failed to write public key chunk")
+			return
+		}
+		if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			errorLogger(w).WithError(err).Error("Failed to flush public key chunk")
+			return
+		}
+	}
+	
+	// rest is the remaining fields as an object, so its opening brace is replaced
+	if _, err := w.Write(append(append([]byte("],"), rest[1:]...), '\n')); err != nil {
+		errorLogger(w).WithError(err).Error("Failed to write key generation response")
 	}
-} 
\ No newline at end of file
+}
+ 
\ No newline at end of file
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"pqcd/security"
+)
+
+// honeypotRoutePrefix names the trap routes so HoneypotMiddleware can find them
+const honeypotRoutePrefix = "honeypot:"
+
+// maxHoneypotBodyBytes caps how much of a probe's body is recorded
+const maxHoneypotBodyBytes = 64 << 10
+
+// honeypotRoutes are trap endpoints. They look administrative but only exist to
+// record whoever probes them.
+var honeypotRoutes = []struct {
+	method string
+	path   string
+}{
+	{"GET", "/v0/keys/admin"},
+	{"GET", "/internal/master-key"},
+	{"POST", "/debug/decrypt-all"},
+}
+
+// honeypotProbe is the record of a probe stored in the event log description
+type honeypotProbe struct {
+	Method    string              `json:"method"`
+	Path      string              `json:"path"`
+	Query     string              `json:"query,omitempty"`
+	UserAgent string              `json:"user_agent"`
+	Headers   map[string][]string `json:"headers"`
+	Body      string              `json:"body,omitempty"`
+	Truncated bool                `json:"body_truncated,omitempty"`
+	RequestID string              `json:"request_id,omitempty"`
+	Timestamp time.Time           `json:"timestamp"`
+}
+
+// registerHoneypotRoutes registers the trap endpoints on the /api subrouter
+func registerHoneypotRoutes(r *mux.Router, handler *CryptoHandler) {
+	for _, route := range honeypotRoutes {
+		r.HandleFunc(route.path, handler.HandleHoneypotProbe()).Methods(route.method).Name(honeypotRoutePrefix + route.method + " " + route.path)
+	}
+}
+
+// HoneypotMiddleware serves the trap endpoints straight away, so that the
+// middleware after it, such as authentication, cannot keep probes from being
+// recorded. It must be added to the router before that middleware.
+func HoneypotMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil && strings.HasPrefix(route.GetName(), honeypotRoutePrefix) {
+			route.GetHandler().ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleHoneypotProbe records a request to a trap endpoint as a CRITICAL event
+// and answers with a convincing refusal
+func (h *CryptoHandler) HandleHoneypotProbe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxHoneypotBodyBytes+1))
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Debug("Failed to read honeypot probe body")
+		}
+		probe := honeypotProbe{
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Query:     r.URL.RawQuery,
+			UserAgent: r.UserAgent(),
+			Headers:   r.Header,
+			Timestamp: time.Now().UTC(),
+		}
+		probe.RequestID, _ = security.RequestIDFromContext(r.Context())
+		if len(body) > maxHoneypotBodyBytes {
+			body = body[:maxHoneypotBodyBytes]
+			probe.Truncated = true
+		}
+		probe.Body = string(body)
+
+		ip := remoteIP(r)
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"ip":         ip,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"user_agent": r.UserAgent(),
+		}).Warn("Honeypot endpoint probed")
+
+		if h.keyStore != nil {
+			description, err := json.Marshal(probe)
+			if err == nil {
+				_, err = h.keyStore.Exec(
+					"INSERT INTO event_logs (event_type, description, source_ip, severity) VALUES (?, ?, ?, ?)",
+					"honeypot_probe", string(description), ip, "CRITICAL",
+				)
+			}
+			if err != nil {
+				security.RequestLogger(r.Context()).WithError(err).Error("Failed to log honeypot probe")
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"insufficient_clearance","code":4031}`))
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"pqcd/crypto"
+	"pqcd/security"
+)
+
+// keyIntegrityEventType is the event_logs event type recording keys that
+// failed an integrity check
+const keyIntegrityEventType = "key_integrity_failure"
+
+// maxReportedMismatches caps the byte positions an integrity check lists
+const maxReportedMismatches = 256
+
+// KeyIntegrityResponse reports whether a stored key pair is intact.
+// MismatchBytes lists the first 256 positions where the stored public key
+// differs from the one recomputed from the private key, and MismatchCount how
+// many there are in all. Error says what is wrong with an invalid key pair.
+type KeyIntegrityResponse struct {
+	ID            int64  `json:"id"`
+	Algorithm     string `json:"algorithm"`
+	Valid         bool   `json:"valid"`
+	MismatchBytes []int  `json:"mismatch_bytes,omitempty"`
+	MismatchCount int    `json:"mismatch_count,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// HandleVerifyKeyIntegrity checks that a stored key pair hasn't been corrupted
+// at rest. The private key must decrypt, the public key recomputed from it
+// must match the stored one byte for byte, where the algorithm allows it, and
+// the two must work together. A key pair failing the check is logged as a
+// CRITICAL key_integrity_failure event.
+func (h *CryptoHandler) HandleVerifyKeyIntegrity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+		if h.keyEncryptor == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key encryption is not configured")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid key id")
+			return
+		}
+
+		key, err := getKey(h.keyStore, id)
+		if errors.Is(err, errKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("key %d not found", id))
+			return
+		}
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read key")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key")
+			return
+		}
+		// Decoys are altered copies of a real key, so they never form a key pair
+		if !key.IsReal {
+			respondWithError(w, http.StatusBadRequest, "decoy keys cannot be checked")
+			return
+		}
+		var provider crypto.CryptoProvider
+		if kem, err := h.registry.GetKEMProvider(registryAlgorithm(key.Algorithm)); err == nil {
+			provider = kem
+		} else if sig, err := h.registry.GetSignatureProvider(registryAlgorithm(key.Algorithm)); err == nil {
+			provider = sig
+		} else {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("keys of algorithm %s cannot be checked", key.Algorithm))
+			return
+		}
+
+		publicKey, storedPrivateKey, err := getKeyMaterial(h.keyStore, id)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("id", id).Error("Failed to read key material")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key")
+			return
+		}
+		if storedPrivateKey == nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("key %d was imported without a private key", id))
+			return
+		}
+
+		response := KeyIntegrityResponse{ID: id, Algorithm: key.Algorithm, Valid: true}
+		privateKey, err := h.keyEncryptor.DecryptFromStorage(storedPrivateKey)
+		if err != nil {
+			response.Valid = false
+			response.Error = "stored private key does not decrypt"
+		} else {
+			defer crypto.ZeroBytes(privateKey)
+			if err := checkKeyPair(r.Context(), provider, publicKey, privateKey, &response); err != nil {
+				respondWithCryptoError(w, "integrity check failed", err)
+				return
+			}
+		}
+
+		if !response.Valid {
+			security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+				"id":             id,
+				"algorithm":      key.Algorithm,
+				"mismatch_count": response.MismatchCount,
+				"error":          response.Error,
+			}).Error("Stored key failed its integrity check")
+			description := fmt.Sprintf("Key %d failed its integrity check: %s", id, response.Error)
+			if err := logKeyEvent(h.keyStore, r, keyIntegrityEventType, description, "CRITICAL", id); err != nil {
+				security.RequestLogger(r.Context()).WithError(err).Error("Failed to log key integrity failure")
+			}
+		}
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// checkKeyPair records in response whether a decrypted key pair is intact.
+// Errors other than a malformed or mismatched key, such as a canceled
+// request, are returned instead.
+func checkKeyPair(ctx context.Context, provider crypto.CryptoProvider, publicKey, privateKey []byte, response *KeyIntegrityResponse) error {
+	if deriver, ok := provider.(crypto.PublicKeyDeriver); ok {
+		derived, err := deriver.DerivePublicKey(privateKey)
+		if err != nil {
+			return invalidKeyPair(response, err)
+		}
+		response.MismatchBytes, response.MismatchCount = mismatchedBytes(publicKey, derived)
+		if response.MismatchCount > 0 {
+			response.Valid = false
+			response.Error = "stored public key does not match the private key"
+			return nil
+		}
+	}
+	return invalidKeyPair(response, crypto.VerifyKeyPair(ctx, provider, publicKey, privateKey))
+}
+
+// invalidKeyPair marks response invalid if err is caused by the keys
+// themselves, and returns any other error
+func invalidKeyPair(response *KeyIntegrityResponse, err error) error {
+	var cryptoErr *crypto.CryptoError
+	if errors.As(err, &cryptoErr) && (cryptoErr.Code == crypto.ErrCodeInvalidKey || cryptoErr.Code == crypto.ErrCodeInvalidInput) {
+		response.Valid = false
+		response.Error = err.Error()
+		return nil
+	}
+	return err
+}
+
+// mismatchedBytes returns up to maxReportedMismatches positions where stored
+// and derived differ, and the number of positions in all. Bytes past the end
+// of the shorter key count as mismatches.
+func mismatchedBytes(stored, derived []byte) ([]int, int) {
+	var positions []int
+	count := 0
+	for i := 0; i < max(len(stored), len(derived)); i++ {
+		if i < len(stored) && i < len(derived) && stored[i] == derived[i] {
+			continue
+		}
+		if count < maxReportedMismatches {
+			positions = append(positions, i)
+		}
+		count++
+	}
+	return positions, count
+}
@@ -0,0 +1,620 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+
+	"pqcd/crypto"
+	"pqcd/security"
+)
+
+// keyStoreSchema creates the tables the key management endpoints rely on.
+// It mirrors database/schema.sql so the API can share a database with the backend.
+var keyStoreSchema = []string{
+	`CREATE TABLE IF NOT EXISTS key_pairs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		public_key BLOB NOT NULL,
+		private_key BLOB,
+		fingerprint VARCHAR(95) NOT NULL,
+		algorithm TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		is_real BOOLEAN DEFAULT 1,
+		tags TEXT, -- JSON array of tag names
+		source_ip TEXT,
+		expires_at TIMESTAMP,
+		superseded_by INTEGER REFERENCES key_pairs(id),
+		flagged BOOLEAN DEFAULT 0,
+		origin_fingerprint TEXT -- Fingerprint of the real key a decoy was generated for
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_key_pairs_fingerprint ON key_pairs(fingerprint)`,
+	`CREATE INDEX IF NOT EXISTS idx_key_pairs_algorithm ON key_pairs(algorithm)`,
+	`CREATE INDEX IF NOT EXISTS idx_key_pairs_is_real ON key_pairs(is_real)`,
+	`CREATE TABLE IF NOT EXISTS key_usage (
+		fingerprint TEXT NOT NULL,
+		operation TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		last_used TIMESTAMP,
+		UNIQUE (fingerprint, operation)
+	)`,
+	`CREATE TABLE IF NOT EXISTS event_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_type TEXT NOT NULL,
+		description TEXT,
+		source_ip TEXT,
+		timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		severity TEXT CHECK (severity IN ('INFO', 'WARNING', 'ERROR', 'CRITICAL')),
+		related_item_id INTEGER,
+		related_item_type TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_event_logs_type_time ON event_logs(event_type, timestamp)`,
+	`CREATE INDEX IF NOT EXISTS idx_event_logs_ip_type ON event_logs(source_ip, event_type)`,
+	`CREATE INDEX IF NOT EXISTS idx_event_logs_severity_time ON event_logs(severity, timestamp)`,
+	`CREATE TABLE IF NOT EXISTS key_bundles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		fingerprint TEXT NOT NULL,
+		kem_algorithm TEXT NOT NULL,
+		kem_public_key BLOB NOT NULL,
+		kem_private_key BLOB NOT NULL,
+		sig_algorithm TEXT NOT NULL,
+		sig_public_key BLOB NOT NULL,
+		sig_private_key BLOB NOT NULL,
+		source_ip TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_key_bundles_fingerprint ON key_bundles(fingerprint)`,
+}
+
+// keyStoreUpgrades bring key stores created by older versions up to keyStoreSchema
+var keyStoreUpgrades = []string{
+	`ALTER TABLE key_pairs ADD COLUMN expires_at TIMESTAMP`,
+	`CREATE INDEX IF NOT EXISTS idx_key_pairs_expires_at ON key_pairs(expires_at)`,
+	`ALTER TABLE key_pairs ADD COLUMN superseded_by INTEGER REFERENCES key_pairs(id)`,
+	`ALTER TABLE key_pairs ADD COLUMN flagged BOOLEAN DEFAULT 0`,
+	`ALTER TABLE key_pairs ADD COLUMN origin_fingerprint TEXT`,
+	`CREATE INDEX IF NOT EXISTS idx_key_pairs_origin_fingerprint ON key_pairs(origin_fingerprint)`,
+	// Tags used to be stored comma-separated. They can't contain quotes or
+	// commas, so wrapping and splitting the string gives a JSON array.
+	`UPDATE key_pairs SET tags = CASE WHEN tags = '' THEN '[]' ELSE '["' || replace(tags, ',', '","') || '"]' END
+		WHERE tags IS NOT NULL AND tags NOT LIKE '[%'`,
+}
+
+// sqliteTimestampFormat matches CURRENT_TIMESTAMP and the expiry times written by
+// the backend, so expires_at compares correctly as text
+const sqliteTimestampFormat = "2006-01-02 15:04:05"
+
+// OpenKeyStore opens the SQLite database holding stored key pairs and creates
+// any missing tables
+func OpenKeyStore(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key store: %w", err)
+	}
+
+	// Every connection to an in-memory database gets its own empty database
+	if path == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to key store: %w", err)
+	}
+
+	for _, statement := range keyStoreSchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create key store schema: %w", err)
+		}
+	}
+	for _, statement := range keyStoreUpgrades {
+		if _, err := db.Exec(statement); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			db.Close()
+			return nil, fmt.Errorf("failed to upgrade key store schema: %w", err)
+		}
+	}
+	if err := allowNullPrivateKeys(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	logrus.WithField("path", path).Info("Key store opened")
+	return db, nil
+}
+
+// allowNullPrivateKeys drops the NOT NULL constraint on private_key from key
+// stores created before public keys could be imported on their own. SQLite
+// cannot alter a column, so the table is rebuilt from its own definition,
+// keeping any columns the backend added.
+func allowNullPrivateKeys(db *sql.DB) error {
+	const notNull = "private_key BLOB NOT NULL"
+
+	var definition string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'key_pairs'").Scan(&definition); err != nil {
+		return fmt.Errorf("failed to read key store schema: %w", err)
+	}
+	if !strings.Contains(definition, notNull) {
+		return nil
+	}
+
+	rows, err := db.Query("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = 'key_pairs' AND sql IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to read key store indexes: %w", err)
+	}
+	var indexes []string
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read key store indexes: %w", err)
+		}
+		indexes = append(indexes, index)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read key store indexes: %w", err)
+	}
+
+	// Only the table name is renamed, so superseded_by still references key_pairs
+	definition = strings.Replace(definition, "key_pairs", "key_pairs_new", 1)
+	statements := []string{
+		strings.Replace(definition, notNull, "private_key BLOB", 1),
+		"INSERT INTO key_pairs_new SELECT * FROM key_pairs",
+		"DROP TABLE key_pairs",
+		"ALTER TABLE key_pairs_new RENAME TO key_pairs",
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, statement := range append(statements, indexes...) {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to make private keys optional: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit key store upgrade: %w", err)
+	}
+
+	logrus.Info("Key store upgraded to allow public keys without a private key")
+	return nil
+}
+
+// decoyFingerprintPrefixLength is how many characters of a real key's
+// fingerprint (its first eight octets) its decoys share
+const decoyFingerprintPrefixLength = 23
+
+// decoysOf returns the SQL condition and arguments matching the decoys of the
+// real key with the given fingerprint. Decoys stored before origin_fingerprint
+// was recorded are matched on the fingerprint prefix they share with the key.
+func decoysOf(fingerprint string) (string, []interface{}) {
+	if len(fingerprint) < decoyFingerprintPrefixLength {
+		return "is_real = 0 AND origin_fingerprint = ?", []interface{}{fingerprint}
+	}
+	return "is_real = 0 AND (origin_fingerprint = ? OR (origin_fingerprint IS NULL AND substr(fingerprint, 1, ?) = ?))",
+		[]interface{}{fingerprint, decoyFingerprintPrefixLength, fingerprint[:decoyFingerprintPrefixLength]}
+}
+
+// errKeyNotFound is returned when no stored key pair has the requested ID
+var errKeyNotFound = errors.New("key not found")
+
+// errKeySuperseded is returned when rotating a key that has already been rotated
+var errKeySuperseded = errors.New("key has already been rotated")
+
+// errKeyExists is returned when importing a key pair that is already stored
+var errKeyExists = errors.New("key already exists")
+
+// storedAlgorithms maps the algorithm names the backend stores to registry algorithms
+var storedAlgorithms = map[string]crypto.Algorithm{
+	"kyber":      crypto.AlgMLKEM768,
+	"kyber768":   crypto.AlgMLKEM768,
+	"dilithium":  crypto.AlgMLDSA44,
+	"dilithium2": crypto.AlgMLDSA44,
+	"dilithium3": crypto.AlgMLDSA65,
+	"dilithium5": crypto.AlgMLDSA87,
+}
+
+// registryAlgorithm returns the registry algorithm for a stored algorithm name
+func registryAlgorithm(stored string) crypto.Algorithm {
+	if alg, ok := storedAlgorithms[stored]; ok {
+		return alg
+	}
+	return crypto.Algorithm(stored)
+}
+
+// storedFingerprint formats a public key fingerprint the way the backend stores
+// it: the SHA-256 digest as colon-separated hex pairs
+func storedFingerprint(publicKey []byte) string {
+	hash := sha256.Sum256(publicKey)
+	pairs := make([]string, len(hash))
+	for i, b := range hash {
+		pairs[i] = hex.EncodeToString([]byte{b})
+	}
+	return strings.Join(pairs, ":")
+}
+
+// Expiry filters for listing stored keys
+const (
+	KeyStatusActive  = "active"
+	KeyStatusExpired = "expired"
+)
+
+// KeyFilter restricts which stored key pairs are listed
+type KeyFilter struct {
+	Algorithm string
+	IsReal    *bool
+	Tags      []string
+	TagMode   string // TagModeAny for keys carrying any of Tags, otherwise all of them
+	Status    string // KeyStatusActive, KeyStatusExpired or empty for both
+	Page      int
+	PerPage   int
+}
+
+// whereClause builds the SQL condition and arguments for a filter
+func (f KeyFilter) whereClause() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.Algorithm != "" {
+		conditions = append(conditions, "algorithm = ?")
+		args = append(args, f.Algorithm)
+	}
+	if f.IsReal != nil {
+		conditions = append(conditions, "is_real = ?")
+		args = append(args, *f.IsReal)
+	}
+	if len(f.Tags) > 0 {
+		const hasTag = "EXISTS (SELECT 1 FROM json_each(key_pairs.tags) WHERE json_each.value "
+		if f.TagMode == TagModeAny {
+			conditions = append(conditions, hasTag+"IN (?"+strings.Repeat(", ?", len(f.Tags)-1)+"))")
+			for _, tag := range f.Tags {
+				args = append(args, tag)
+			}
+		} else {
+			for _, tag := range f.Tags {
+				conditions = append(conditions, hasTag+"= ?)")
+				args = append(args, tag)
+			}
+		}
+	}
+	switch f.Status {
+	case KeyStatusActive:
+		conditions = append(conditions, "(expires_at IS NULL OR expires_at >= ?)")
+		args = append(args, time.Now().UTC().Format(sqliteTimestampFormat))
+	case KeyStatusExpired:
+		conditions = append(conditions, "expires_at IS NOT NULL AND expires_at < ?")
+		args = append(args, time.Now().UTC().Format(sqliteTimestampFormat))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// keySummaryColumns are the key_pairs columns read into a KeySummary
+const keySummaryColumns = "id, fingerprint, algorithm, created_at, is_real, tags, expires_at, superseded_by"
+
+// scanKeySummary reads a row selected with keySummaryColumns
+func scanKeySummary(row interface{ Scan(...interface{}) error }) (KeySummary, error) {
+	var key KeySummary
+	var tags sql.NullString
+	var expiresAt sql.NullTime
+	var supersededBy sql.NullInt64
+	if err := row.Scan(&key.ID, &key.Fingerprint, &key.Algorithm, &key.CreatedAt, &key.IsReal, &tags, &expiresAt, &supersededBy); err != nil {
+		return KeySummary{}, fmt.Errorf("failed to scan key: %w", err)
+	}
+	parsed, err := parseTags(tags.String)
+	if err != nil {
+		return KeySummary{}, fmt.Errorf("failed to scan key %d: %w", key.ID, err)
+	}
+	key.Tags = parsed
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if supersededBy.Valid {
+		key.SupersededBy = &supersededBy.Int64
+	}
+	return key, nil
+}
+
+// getKey returns the summary of a single stored key pair
+func getKey(db *sql.DB, id int64) (KeySummary, error) {
+	key, err := scanKeySummary(db.QueryRow("SELECT "+keySummaryColumns+" FROM key_pairs WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return KeySummary{}, errKeyNotFound
+	}
+	return key, err
+}
+
+// updateKeyTags replaces the tags of a stored key pair
+func updateKeyTags(db *sql.DB, id int64, tags string) error {
+	result, err := db.Exec("UPDATE key_pairs SET tags = ? WHERE id = ?", tags, id)
+	if err != nil {
+		return fmt.Errorf("failed to update tags: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to count updated keys: %w", err)
+	}
+	if updated == 0 {
+		return errKeyNotFound
+	}
+	return nil
+}
+
+// listKeys returns one page of key summaries matching a filter along with the
+// total number of matching keys. Key material is never selected.
+func listKeys(db *sql.DB, filter KeyFilter) ([]KeySummary, int, error) {
+	where, args := filter.whereClause()
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM key_pairs"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count keys: %w", err)
+	}
+
+	offset := (filter.Page - 1) * filter.PerPage
+	rows, err := db.Query(
+		"SELECT "+keySummaryColumns+" FROM key_pairs"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, filter.PerPage, offset)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]KeySummary, 0, filter.PerPage)
+	for rows.Next() {
+		key, err := scanKeySummary(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read keys: %w", err)
+	}
+
+	return keys, total, nil
+}
+
+// listKeyDecoys returns the summaries of the decoys of the real key with the
+// given fingerprint, oldest first
+func listKeyDecoys(db *sql.DB, fingerprint string) ([]KeySummary, error) {
+	var real int
+	if err := db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE fingerprint = ? AND is_real = 1", fingerprint).Scan(&real); err != nil {
+		return nil, fmt.Errorf("failed to look up key: %w", err)
+	}
+	if real == 0 {
+		return nil, errKeyNotFound
+	}
+
+	where, args := decoysOf(fingerprint)
+	rows, err := db.Query("SELECT "+keySummaryColumns+" FROM key_pairs WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query decoys: %w", err)
+	}
+	defer rows.Close()
+
+	decoys := []KeySummary{}
+	for rows.Next() {
+		decoy, err := scanKeySummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		decoys = append(decoys, decoy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read decoys: %w", err)
+	}
+	return decoys, nil
+}
+
+// rotateKey stores a replacement for a key pair and marks the old key as
+// superseded by it. The replacement keeps the old key's algorithm name and tags.
+// It returns the ID of the new key.
+func rotateKey(db *sql.DB, id int64, publicKey, storedPrivateKey []byte) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var algorithm string
+	var tags sql.NullString
+	var supersededBy sql.NullInt64
+	err = tx.QueryRow("SELECT algorithm, tags, superseded_by FROM key_pairs WHERE id = ?", id).Scan(&algorithm, &tags, &supersededBy)
+	if err == sql.ErrNoRows {
+		return 0, errKeyNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up key: %w", err)
+	}
+	if supersededBy.Valid {
+		return 0, errKeySuperseded
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real, tags) VALUES (?, ?, ?, ?, ?, ?)",
+		publicKey, storedPrivateKey, storedFingerprint(publicKey), algorithm, true, tags,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store replacement key: %w", err)
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read replacement key id: %w", err)
+	}
+
+	// The superseded_by check guards against a concurrent rotation of the same key
+	result, err = tx.Exec("UPDATE key_pairs SET superseded_by = ? WHERE id = ? AND superseded_by IS NULL", newID, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark key as superseded: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("failed to count superseded keys: %w", err)
+	} else if updated == 0 {
+		return 0, errKeySuperseded
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit key rotation: %w", err)
+	}
+	return newID, nil
+}
+
+// getKeyMaterial returns the public key and the stored (encrypted) private key
+// of a stored key pair. The private key is nil for an imported public key.
+func getKeyMaterial(db *sql.DB, id int64) ([]byte, []byte, error) {
+	var publicKey, storedPrivateKey []byte
+	err := db.QueryRow("SELECT public_key, private_key FROM key_pairs WHERE id = ?", id).Scan(&publicKey, &storedPrivateKey)
+	if err == sql.ErrNoRows {
+		return nil, nil, errKeyNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read key material: %w", err)
+	}
+	return publicKey, storedPrivateKey, nil
+}
+
+// importKey stores an imported real key pair with the given tags and returns
+// its ID. storedPrivateKey is nil when only the public key is imported. A real
+// key with the same fingerprint must not already be stored.
+func importKey(db *sql.DB, algorithm string, publicKey, storedPrivateKey []byte, tags string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	fingerprint := storedFingerprint(publicKey)
+	var existing int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE fingerprint = ? AND is_real = 1", fingerprint).Scan(&existing); err != nil {
+		return 0, fmt.Errorf("failed to check for existing key: %w", err)
+	}
+	if existing > 0 {
+		return 0, errKeyExists
+	}
+
+	// A nil slice would be bound as an empty blob rather than NULL
+	var privateKey interface{}
+	if storedPrivateKey != nil {
+		privateKey = storedPrivateKey
+	}
+	result, err := tx.Exec(
+		"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real, tags) VALUES (?, ?, ?, ?, ?, ?)",
+		publicKey, privateKey, fingerprint, algorithm, true, tags,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store imported key: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read imported key id: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit key import: %w", err)
+	}
+	return id, nil
+}
+
+// keyExportable reports whether a stored key pair can be exported: it must be
+// a real key whose private key is stored
+func keyExportable(db *sql.DB, id int64) (bool, error) {
+	var exportable bool
+	err := db.QueryRow("SELECT is_real = 1 AND private_key IS NOT NULL FROM key_pairs WHERE id = ?", id).Scan(&exportable)
+	if err == sql.ErrNoRows {
+		return false, errKeyNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether key is exportable: %w", err)
+	}
+	return exportable, nil
+}
+
+// deleteKey removes a stored key pair. Deleting a real key also removes its
+// decoys, as matched by decoysOf. The key material of every removed row is
+// zeroised before the rows are deleted. It returns the number of decoys removed.
+func deleteKey(db *sql.DB, id int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var fingerprint string
+	var isReal bool
+	err = tx.QueryRow("SELECT fingerprint, is_real FROM key_pairs WHERE id = ?", id).Scan(&fingerprint, &isReal)
+	if err == sql.ErrNoRows {
+		return 0, errKeyNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up key: %w", err)
+	}
+
+	where := "id = ?"
+	args := []interface{}{id}
+	if isReal {
+		decoys, decoyArgs := decoysOf(fingerprint)
+		where += " OR (" + decoys + ")"
+		args = append(args, decoyArgs...)
+	}
+
+	if err := zeroise(tx, where, args...); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("DELETE FROM key_pairs WHERE "+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete key: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted keys: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit key deletion: %w", err)
+	}
+	return deleted - 1, nil
+}
+
+// zeroise overwrites the stored key material of matching rows with zeros so the
+// original bytes do not linger in freed database pages
+func zeroise(tx *sql.Tx, where string, args ...interface{}) error {
+	_, err := tx.Exec(
+		"UPDATE key_pairs SET public_key = zeroblob(length(public_key)), private_key = zeroblob(length(private_key)) WHERE "+where,
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to zeroise key material: %w", err)
+	}
+	return nil
+}
+
+// logKeyEvent records a key management event made by r in the event log. The
+// description ends with the request ID, if r has one.
+func logKeyEvent(db *sql.DB, r *http.Request, eventType, description, severity string, keyID int64) error {
+	if id, ok := security.RequestIDFromContext(r.Context()); ok {
+		description = fmt.Sprintf("%s (request %s)", description, id)
+	}
+	_, err := db.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, related_item_id, related_item_type) VALUES (?, ?, ?, ?, ?, ?)",
+		eventType, description, remoteIP(r), severity, keyID, "key_pair",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log key event: %w", err)
+	}
+	return nil
+}
@@ -1,52 +1,133 @@
 package api
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	
 	"pqcd/benchmark"
 	"pqcd/crypto"
+	"pqcd/security"
 )
 
-// RegisterRoutes sets up all API routes
-func RegisterRoutes(r *mux.Router) {
+// RegisterRoutes sets up all API routes. keyStore backs the key management
+// endpoints and may be nil, in which case they report 503. responseEngine
+// decides which clients get jittered responses and may also be nil. Each /api
+// route requires a role of the user in the request context, so
+// security.AuthMiddleware must run first. The returned handler gives access
+// to the registry and metrics behind the routes.
+func RegisterRoutes(r *mux.Router, keyStore *sql.DB, responseEngine *security.ResponseEngine) *CryptoHandler {
 	// Create the crypto registry
 	registry := crypto.DefaultRegistry()
+	registry.EnableKeyCache(defaultKeyCacheEntries, defaultKeyCacheTTL)
 	
 	// Create the metrics collector
 	metrics := benchmark.NewMetricsCollector()
 	
+	// Export the metrics to Prometheus as well
+	promRegistry := prometheus.NewRegistry()
+	metrics.RegisterPrometheusCollectors(promRegistry)
+	r.Handle("/metrics", promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{})).Methods("GET")
+	
 	// Create the handler
 	handler := NewCryptoHandler(registry, metrics)
+	handler.SetKeyStore(keyStore)
+	handler.SetResponseEngine(responseEngine)
 	
 	// Set up the API subrouter with common path prefix
 	api := r.PathPrefix("/api").Subrouter()
 	
+	// Roles needed for each endpoint, from the user the authentication
+	// middleware authenticated
+	readonly := security.RequireRole(security.RoleReadonly)
+	user := security.RequireRole(security.RoleUser)
+	admin := security.RequireRole(security.RoleAdmin)
+	
 	// Register KEM endpoints
-	registerKEMRoutes(api, handler)
+	registerKEMRoutes(api, handler, user)
 	
 	// Register signature endpoints
-	registerSignatureRoutes(api, handler)
+	registerSignatureRoutes(api, handler, user)
+	api.Handle("/sign-verify", user(handler.HandleBatchSignVerify())).Methods("POST")
 	
 	// Register metrics endpoint
-	api.HandleFunc("/metrics", metrics.HandleMetrics()).Methods("GET")
+	api.Handle("/metrics", readonly(metrics.HandleMetrics())).Methods("GET")
+	api.Handle("/metrics/sla", readonly(metrics.HandleSLA())).Methods("GET")
+
+	// Register key cache statistics endpoint
+	api.Handle("/cache/stats", readonly(handler.HandleCacheStats())).Methods("GET")
+
+	// Register the benchmark suite endpoint. A run keeps the CPU busy for
+	// minutes, so it needs more than read access.
+	api.Handle("/benchmark/run", user(handler.HandleRunBenchmark())).Methods("GET")
+
+	// Register the key agreement demonstration
+	api.Handle("/demo/key-agreement", user(handler.HandleKeyAgreementDemo())).Methods("POST")
+
+	// Register key derivation endpoint
+	api.Handle("/derive", user(handler.HandleDerive())).Methods("POST")
+
+	// Register algorithm listing endpoint
+	api.Handle("/algorithms", readonly(handler.HandleListAlgorithms())).Methods("GET")
 
 	// Register health check endpoint
-	api.HandleFunc("/health", handler.HandleHealthCheck()).Methods("GET")
+	api.Handle("/health", readonly(handler.HandleHealthCheck())).Methods("GET")
+	api.Handle("/status/algorithms", readonly(handler.HandleAlgorithmStatus())).Methods("GET")
+	
+	// Register the endpoint reporting the caller's role
+	api.Handle("/whoami", readonly(security.HandleWhoAmI())).Methods("GET")
+	
+	// Register key management endpoints. Deleting, rotating and exporting
+	// private keys, and telling a key's decoys apart, is reserved for admins.
+	api.Handle("/keys", readonly(handler.HandleListKeys())).Methods("GET")
+	api.Handle("/keys/batch", user(handler.HandleBatchKeyGen())).Methods("POST")
+	api.Handle("/keys/bundle/generate", user(handler.HandleGenerateBundle())).Methods("POST")
+	api.Handle("/keys/{id:[0-9]+}", admin(handler.HandleDeleteKey())).Methods("DELETE")
+	api.Handle("/keys/{id:[0-9]+}/tags", user(handler.HandleUpdateKeyTags())).Methods("PUT")
+	api.Handle("/keys/{id:[0-9]+}/ttl", readonly(handler.HandleKeyTTL())).Methods("GET")
+	api.Handle("/keys/{id:[0-9]+}/rotate", admin(handler.HandleRotateKey())).Methods("POST")
+	api.Handle("/keys/{id:[0-9]+}/export/pkcs12", admin(handler.HandleExportPKCS12())).Methods("POST")
+	api.Handle("/keys/{id:[0-9]+}/derive-symmetric", user(handler.HandleDeriveSymmetric())).Methods("POST")
+	api.Handle("/keys/{id:[0-9]+}/exportable", readonly(handler.HandleKeyExportable())).Methods("GET")
+	api.Handle("/keys/{id:[0-9]+}/verify-storage", admin(handler.HandleVerifyKeyIntegrity())).Methods("GET")
+	api.Handle("/keys/{fingerprint:[0-9a-fA-F:]+}/usage", readonly(handler.HandleKeyUsage())).Methods("GET")
+	api.Handle("/keys/{fingerprint:[0-9a-fA-F:-]+}/decoys", admin(handler.HandleGetKeyDecoys())).Methods("GET")
+	api.Handle("/keys/import", user(handler.HandleImportPublicKey())).Methods("POST")
+	api.Handle("/keys/import/pkcs12", user(handler.HandleImportPKCS12())).Methods("POST")
+	
+	// Register event log endpoint
+	api.Handle("/event-logs", readonly(handler.HandleListEventLogs())).Methods("GET")
+	api.Handle("/admin/event-logs/export", admin(handler.HandleExportEventLogs())).Methods("GET")
+	
+	// Register the endpoint clearing an IP's threat history after a false positive
+	api.Handle("/admin/purge-threats", admin(handler.HandlePurgeThreatHistory())).Methods("POST")
+	
+	// Register the live threat feed. Browsers can't set headers on a WebSocket
+	// handshake, so it may pass its token as the api_key query parameter.
+	api.Handle("/ws/threats", readonly(handler.HandleThreatStream())).Methods("GET")
 	
 	// Register decoy generation endpoint
-	api.HandleFunc("/decoys/generate", handler.HandleDecoyGeneration()).Methods("POST")
+	api.Handle("/decoys/generate", user(handler.HandleDecoyGeneration())).Methods("POST")
+	api.Handle("/decoys/generate/stream", user(handler.HandleDecoyStream())).Methods("POST")
+
+	// Register the trap endpoints. HoneypotMiddleware serves them before
+	// authentication, so they need no role.
+	registerHoneypotRoutes(api, handler)
 
-	// Register general encrypt/decrypt endpoints
-	api.HandleFunc("/encrypt", handler.HandleEncapsulate()).Methods("POST")
-	api.HandleFunc("/decrypt", handler.HandleDecapsulate()).Methods("POST")
+	// Register general encrypt/decrypt endpoints. Retries carrying the same
+	// X-Idempotency-Key get the first response instead of running again.
+	idempotency := security.NewIdempotencyMiddleware()
+	api.Handle("/encrypt", user(idempotency.Middleware(handler.HandleEncapsulate()))).Methods("POST")
+	api.Handle("/decrypt", user(idempotency.Middleware(handler.HandleDecapsulate()))).Methods("POST")
 
 	// This is a placeholder for your actual PQC API endpoints.
 	// The AI middleware will wrap these routes.
-	api.HandleFunc("/api/crypto/{algorithm}/{operation}", func(w http.ResponseWriter, r *http.Request) {
+	api.Handle("/api/crypto/{algorithm}/{operation}", user(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		algorithm := vars["algorithm"]
 		operation := vars["operation"]
@@ -55,23 +136,30 @@ func RegisterRoutes(r *mux.Router) {
 		w.WriteHeader(http.StatusOK)
 		response := fmt.Sprintf(`{"status": "ok", "message": "successfully performed %s for %s"}`, operation, algorithm)
 		fmt.Fprintln(w, response)
-	}).Methods("POST", "GET")
+	}))).Methods("POST", "GET")
 
 	logrus.Info("API routes registered")
+	return handler
 }
 
-// registerKEMRoutes registers the Key Encapsulation Mechanism endpoints
-func registerKEMRoutes(r *mux.Router, handler *CryptoHandler) {
-	kemRoutes := r.PathPrefix("/{alg:(?:ml-kem-768|ecdh)}").Subrouter()
+// registerKEMRoutes registers the Key Encapsulation Mechanism endpoints behind
+// the role middleware
+func registerKEMRoutes(r *mux.Router, handler *CryptoHandler, role mux.MiddlewareFunc) {
+	kemRoutes := r.PathPrefix("/{alg:(?:ml-kem-768|ecdh|hybrid-ml-kem-ecdh|frodokem-640-aes|frodokem-976-aes|bike-l1|bike-l3|mceliece-348864|mceliece-460896|hqc-128|hqc-256)}").Subrouter()
+	kemRoutes.Use(role)
 	kemRoutes.HandleFunc("/keygen", handler.HandleKeyGen()).Methods("POST")
+	kemRoutes.HandleFunc("/keygen/pem", handler.HandleKeyGenPEM()).Methods("POST")
 	kemRoutes.HandleFunc("/encapsulate", handler.HandleEncapsulate()).Methods("POST")
 	kemRoutes.HandleFunc("/decapsulate", handler.HandleDecapsulate()).Methods("POST")
 }
 
-// registerSignatureRoutes registers the Digital Signature endpoints
-func registerSignatureRoutes(r *mux.Router, handler *CryptoHandler) {
-	sigRoutes := r.PathPrefix("/{alg:(?:ml-dsa-65|ecdsa)}").Subrouter()
+// registerSignatureRoutes registers the Digital Signature endpoints behind the
+// role middleware
+func registerSignatureRoutes(r *mux.Router, handler *CryptoHandler, role mux.MiddlewareFunc) {
+	sigRoutes := r.PathPrefix("/{alg:(?:ml-dsa-44|ml-dsa-65|ml-dsa-87|sphincs-sha2-128s|sphincs-sha2-256s|ecdsa)}").Subrouter()
+	sigRoutes.Use(role)
 	sigRoutes.HandleFunc("/keygen", handler.HandleKeyGen()).Methods("POST")
+	sigRoutes.HandleFunc("/keygen/pem", handler.HandleKeyGenPEM()).Methods("POST")
 	sigRoutes.HandleFunc("/sign", handler.HandleSign()).Methods("POST")
 	sigRoutes.HandleFunc("/verify", handler.HandleVerify()).Methods("POST")
 } 
\ No newline at end of file
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+
+	"pqcd/crypto"
+	"pqcd/security"
+)
+
+// MaxBatchSignVerifyMessages is the most messages a single sign-verify request
+// may sign or verify
+const MaxBatchSignVerifyMessages = 50
+
+// BatchSignVerifyRequest is the request for signing or verifying many messages
+// with one key. Key is the hex-encoded private key to sign with or public key
+// to verify against. To verify, Signatures holds the hex-encoded signature of
+// each message, in the same order.
+type BatchSignVerifyRequest struct {
+	Operation  string   `json:"operation"` // "sign" or "verify"
+	Algorithm  string   `json:"algorithm"`
+	Key        string   `json:"key"`
+	Messages   []string `json:"messages"`
+	Signatures []string `json:"signatures,omitempty"`
+}
+
+// BatchSignVerifyResult is the outcome for the message at Index. Valid is
+// whether the signature verified, or when signing whether signing succeeded.
+// A message that could not be processed has Error set instead.
+type BatchSignVerifyResult struct {
+	Index     int    `json:"index"`
+	Signature string `json:"signature,omitempty"`
+	Valid     bool   `json:"valid"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BatchSignVerifyResponse is the response for batch signing and verification,
+// with one result per message in request order
+type BatchSignVerifyResponse struct {
+	Results []BatchSignVerifyResult `json:"results"`
+}
+
+// HandleBatchSignVerify signs or verifies a batch of messages on the pool of
+// batch workers. A message that fails gets an error in its result rather than
+// failing the whole batch.
+func (h *CryptoHandler) HandleBatchSignVerify() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req BatchSignVerifyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		if req.Operation != "sign" && req.Operation != "verify" {
+			respondWithError(w, http.StatusBadRequest, `operation must be "sign" or "verify"`)
+			return
+		}
+		if len(req.Messages) < 1 || len(req.Messages) > MaxBatchSignVerifyMessages {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("messages must hold between 1 and %d messages", MaxBatchSignVerifyMessages))
+			return
+		}
+		if req.Operation == "verify" && len(req.Signatures) != len(req.Messages) {
+			respondWithError(w, http.StatusBadRequest, "signatures must hold one signature per message")
+			return
+		}
+
+		algorithm := crypto.Algorithm(req.Algorithm)
+		op := "Sign"
+		if req.Operation == "verify" {
+			op = "Verify"
+		}
+		ctx, span := startSpan(r, "sign-verify", op, algorithm)
+		defer span.End()
+		span.SetAttributes(attribute.Int("crypto.batch_count", len(req.Messages)))
+
+		provider, err := h.registry.GetSignatureProvider(algorithm)
+		if err != nil {
+			failSpan(span, err)
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unsupported algorithm: %s", algorithm))
+			return
+		}
+
+		key, err := hex.DecodeString(req.Key)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid key format")
+			return
+		}
+		if req.Operation == "sign" {
+			defer crypto.ZeroBytes(key)
+		}
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"algorithm": algorithm,
+			"operation": req.Operation,
+			"count":     len(req.Messages),
+			"workers":   h.batchWorkers,
+		}).Info("Handling batch sign-verify request")
+
+		// Each message is signed or verified on its own, so every worker
+		// writes only to the results of the indices it receives
+		results := make([]BatchSignVerifyResult, len(req.Messages))
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+
+		workers := h.batchWorkers
+		if workers > len(req.Messages) {
+			workers = len(req.Messages)
+		}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for index := range jobs {
+					result := BatchSignVerifyResult{Index: index}
+					message := []byte(req.Messages[index])
+					start := time.Now()
+
+					if req.Operation == "sign" {
+						signature, err := provider.Sign(ctx, key, message)
+						if err != nil {
+							result.Error = err.Error()
+						} else {
+							h.metrics.RecordOperation(ctx, algorithm, "Sign", time.Since(start), len(key), len(signature), true)
+							result.Signature = hex.EncodeToString(signature)
+							result.Valid = true
+						}
+					} else if signature, err := hex.DecodeString(req.Signatures[index]); err != nil {
+						result.Error = "invalid signature format"
+					} else if valid, err := provider.Verify(ctx, key, message, signature); err != nil {
+						result.Error = err.Error()
+					} else {
+						h.metrics.RecordOperation(ctx, algorithm, "Verify", time.Since(start), len(key), len(signature), valid)
+						result.Valid = valid
+					}
+
+					results[index] = result
+				}
+			}()
+		}
+
+		for i := range req.Messages {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		h.jitter(r)
+		respondWithJSON(w, http.StatusOK, BatchSignVerifyResponse{Results: results})
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"pqcd/crypto"
+)
+
+// Algorithm statuses are checked at most once per algorithmStatusTTL. An
+// algorithm whose key generation takes longer than degradedKeyGenLatency is
+// reported as degraded.
+const (
+	algorithmStatusTTL    = 60 * time.Second
+	degradedKeyGenLatency = 500 * time.Millisecond
+)
+
+// Algorithm availability as reported by the status endpoint
+const (
+	AlgorithmStatusOK          = "ok"
+	AlgorithmStatusDegraded    = "degraded"
+	AlgorithmStatusUnavailable = "unavailable"
+)
+
+// AlgorithmStatus is the outcome of a trial key generation with one algorithm
+type AlgorithmStatus struct {
+	Name            crypto.Algorithm `json:"name"`
+	Status          string           `json:"status"`
+	KeyGenLatencyUs int64            `json:"keygen_latency_us"`
+	Error           string           `json:"error,omitempty"`
+}
+
+// AlgorithmStatusResponse reports the availability of every registered
+// algorithm, as of CheckedAt
+type AlgorithmStatusResponse struct {
+	Algorithms []AlgorithmStatus `json:"algorithms"`
+	CheckedAt  time.Time         `json:"checked_at"`
+}
+
+// algorithmStatusCache holds the last status check so repeated requests don't
+// each generate a key with every algorithm
+type algorithmStatusCache struct {
+	mu       sync.Mutex
+	response *AlgorithmStatusResponse
+}
+
+// HandleAlgorithmStatus reports whether each registered algorithm can generate
+// keys, and how fast. Results are cached for a minute.
+func (h *CryptoHandler) HandleAlgorithmStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondWithJSON(w, http.StatusOK, h.algorithmStatus())
+	}
+}
+
+// algorithmStatus returns the cached status check, running a new one if it is
+// missing or stale. Concurrent callers wait for the same check.
+func (h *CryptoHandler) algorithmStatus() AlgorithmStatusResponse {
+	h.statusCache.mu.Lock()
+	defer h.statusCache.mu.Unlock()
+
+	if cached := h.statusCache.response; cached != nil && time.Since(cached.CheckedAt) < algorithmStatusTTL {
+		return *cached
+	}
+
+	response := AlgorithmStatusResponse{
+		Algorithms: []AlgorithmStatus{},
+		CheckedAt:  time.Now().UTC(),
+	}
+	for _, alg := range h.registry.ListKEMAlgorithms() {
+		if provider, err := h.registry.GetKEMProvider(alg); err == nil {
+			response.Algorithms = append(response.Algorithms, checkAlgorithm(provider))
+		}
+	}
+	for _, alg := range h.registry.ListSignatureAlgorithms() {
+		if provider, err := h.registry.GetSignatureProvider(alg); err == nil {
+			response.Algorithms = append(response.Algorithms, checkAlgorithm(provider))
+		}
+	}
+
+	h.statusCache.response = &response
+	return response
+}
+
+// checkAlgorithm times a single key generation with provider. Algorithms run
+// one after another so their timings don't include each other's. The check
+// isn't tied to a request's context, since its result is cached for every
+// caller and a cancelled request would otherwise mark algorithms unavailable.
+func checkAlgorithm(provider crypto.CryptoProvider) AlgorithmStatus {
+	status := AlgorithmStatus{Name: provider.Name(), Status: AlgorithmStatusOK}
+
+	start := time.Now()
+	keyPair, err := provider.KeyGen(context.Background())
+	elapsed := time.Since(start)
+	status.KeyGenLatencyUs = elapsed.Microseconds()
+
+	if err != nil {
+		logrus.WithError(err).WithField("algorithm", provider.Name()).Warn("Algorithm status check failed")
+		status.Status = AlgorithmStatusUnavailable
+		status.Error = err.Error()
+		return status
+	}
+	crypto.ZeroBytes(keyPair.PrivateKey)
+
+	if elapsed > degradedKeyGenLatency {
+		status.Status = AlgorithmStatusDegraded
+	}
+	return status
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// maxTagLength is the longest tag name accepted
+const maxTagLength = 64
+
+// tagPattern matches the characters allowed in a tag name
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// validateTag checks that a tag name is non-empty, short enough and uses only
+// letters, digits, underscores and hyphens
+func validateTag(tag string) error {
+	if len(tag) > maxTagLength {
+		return fmt.Errorf("tag %q exceeds %d characters", tag, maxTagLength)
+	}
+	if !tagPattern.MatchString(tag) {
+		return fmt.Errorf("tag %q may only contain letters, digits, '_' and '-'", tag)
+	}
+	return nil
+}
+
+// Tag filter modes for listing stored keys
+const (
+	TagModeAll = "all"
+	TagModeAny = "any"
+)
+
+// parseTags decodes the JSON array held in the tags column
+func parseTags(tags string) ([]string, error) {
+	parsed := []string{}
+	if tags == "" {
+		return parsed, nil
+	}
+	if err := json.Unmarshal([]byte(tags), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to decode tags: %w", err)
+	}
+	return parsed, nil
+}
+
+// serializeTags validates tags and encodes them as the JSON array stored in
+// the tags column, dropping duplicates
+func serializeTags(tags []string) (string, error) {
+	seen := make(map[string]bool, len(tags))
+	unique := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if err := validateTag(tag); err != nil {
+			return "", err
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		unique = append(unique, tag)
+	}
+	encoded, err := json.Marshal(unique)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tags: %w", err)
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"pqcd/crypto"
+	"pqcd/security"
+)
+
+// OperationLatencyHeader carries how long the crypto operation behind a
+// response took, in microseconds
+const OperationLatencyHeader = "X-Operation-Latency-Us"
+
+// ResponseWriterWrapper captures the status code of a crypto operation's
+// response so the operation can be logged, with its algorithm and latency,
+// once the handler returns
+type ResponseWriterWrapper struct {
+	http.ResponseWriter
+	status    int
+	operation string
+	algorithm crypto.Algorithm
+	latency   time.Duration
+}
+
+// newResponseWriterWrapper wraps w for a handler performing operation
+func newResponseWriterWrapper(w http.ResponseWriter, operation string) *ResponseWriterWrapper {
+	return &ResponseWriterWrapper{ResponseWriter: w, operation: operation}
+}
+
+// WriteHeader records the status code before writing it
+func (w *ResponseWriterWrapper) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records an implicit 200 status if no header was written
+func (w *ResponseWriterWrapper) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped writer, so http.ResponseController can flush it
+// and set its deadlines
+func (w *ResponseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// setAlgorithm records the algorithm of the operation, once known
+func (w *ResponseWriterWrapper) setAlgorithm(algorithm crypto.Algorithm) {
+	w.algorithm = algorithm
+}
+
+// setOperationLatency sets the X-Operation-Latency-Us header to how long an
+// operation took, and records it for logging if w is a ResponseWriterWrapper.
+// It must be called before the response is written.
+func setOperationLatency(w http.ResponseWriter, latency time.Duration) {
+	if wrapper, ok := w.(*ResponseWriterWrapper); ok {
+		wrapper.latency = latency
+	}
+	w.Header().Set(OperationLatencyHeader, strconv.FormatInt(latency.Microseconds(), 10))
+}
+
+// logOperation logs the operation with the status code of its response
+func (w *ResponseWriterWrapper) logOperation(r *http.Request) {
+	security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+		"algorithm":   w.algorithm,
+		"operation":   w.operation,
+		"latency_us":  w.latency.Microseconds(),
+		"status_code": w.status,
+	}).Info("Crypto operation completed")
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"pqcd/security"
+)
+
+// PurgeThreatsRequest names the IP whose threat history should be cleared
+type PurgeThreatsRequest struct {
+	IP string `json:"ip"`
+}
+
+// PurgeThreatsResponse reports how many persisted threats a purge deleted
+type PurgeThreatsResponse struct {
+	IP             string `json:"ip"`
+	DeletedRecords int64  `json:"deletedRecords"`
+}
+
+// HandlePurgeThreatHistory clears the threat history and throttling of an IP,
+// for when a false positive has caught a legitimate client. Threats persisted
+// in the last 24 hours are deleted; older ones are kept for audit.
+func (h *CryptoHandler) HandlePurgeThreatHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.responseEngine == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "threat response is not configured")
+			return
+		}
+
+		var req PurgeThreatsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		ip := net.ParseIP(req.IP)
+		if ip == nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid IP address: %q", req.IP))
+			return
+		}
+
+		admin, _ := security.UserFromContext(r.Context())
+		description := fmt.Sprintf("Threat history of %s purged by %s from %s", ip, admin.Name, remoteIP(r))
+		if id, ok := security.RequestIDFromContext(r.Context()); ok {
+			description = fmt.Sprintf("%s (request %s)", description, id)
+		}
+
+		deleted, err := h.responseEngine.PurgeThreats(ip.String(), description)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("ip", ip.String()).Error("Failed to purge threat history")
+			respondWithError(w, http.StatusInternalServerError, "failed to purge threat history")
+			return
+		}
+
+		security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"ip":      ip.String(),
+			"admin":   admin.Name,
+			"deleted": deleted,
+		}).Warn("Threat history purged")
+
+		respondWithJSON(w, http.StatusOK, PurgeThreatsResponse{
+			IP:             ip.String(),
+			DeletedRecords: deleted,
+		})
+	}
+}
+
+// threatStreamWriteTimeout bounds how long sending one threat to a stream
+// subscriber may take before the stream is closed
+const threatStreamWriteTimeout = 10 * time.Second
+
+// threatStreamUpgrader accepts WebSocket handshakes from any origin. Streams
+// are authenticated by token rather than cookies, so cross-site pages gain
+// nothing from opening one.
+var threatStreamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// HandleThreatStream upgrades the connection to a WebSocket and sends each
+// threat the response engine classifies as a JSON message, until the client
+// disconnects. A subscriber that reads too slowly misses threats.
+func (h *CryptoHandler) HandleThreatStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.responseEngine == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "threat response is not configured")
+			return
+		}
+
+		hub := h.responseEngine.Threats()
+		threats := hub.Subscribe()
+		if threats == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "too many threat stream subscribers")
+			return
+		}
+		defer hub.Unsubscribe(threats)
+
+		// The upgrader answers failed handshakes itself
+		conn, err := threatStreamUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).Warn("Threat stream handshake failed")
+			return
+		}
+		defer conn.Close()
+		security.RequestLogger(r.Context()).WithField("ip", remoteIP(r)).Info("Threat stream opened")
+
+		// Clients only ever send control frames, which the read loop handles.
+		// It ends once the connection is closed.
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case threat := <-threats:
+				conn.SetWriteDeadline(time.Now().Add(threatStreamWriteTimeout))
+				if err := conn.WriteJSON(threat); err != nil {
+					security.RequestLogger(r.Context()).WithError(err).Warn("Failed to send threat, closing stream")
+					return
+				}
+			case <-closed:
+				security.RequestLogger(r.Context()).WithField("ip", remoteIP(r)).Info("Threat stream closed")
+				return
+			}
+		}
+	}
+}
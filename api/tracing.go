@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"pqcd/crypto"
+)
+
+// tracerName identifies the spans created by the API handlers
+const tracerName = "pqcd/api"
+
+// tracer creates spans using whichever TracerProvider is globally registered
+var tracer = otel.Tracer(tracerName)
+
+// InitTracerProvider creates a TracerProvider and registers it globally along
+// with the W3C trace context propagator. Spans are exported to Jaeger when
+// OTEL_EXPORTER_JAEGER_ENDPOINT is set, for example http://jaeger:4318, and
+// written to stdout otherwise. Jaeger ingests spans over OTLP/HTTP directly.
+func InitTracerProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	if endpoint := os.Getenv("OTEL_EXPORTER_JAEGER_ENDPOINT"); endpoint != "" {
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint+"/v1/traces"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Jaeger exporter: %w", err)
+		}
+		logrus.WithField("endpoint", endpoint).Info("Exporting traces to Jaeger")
+	} else {
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		logrus.Info("Exporting traces to stdout")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("pqcd"))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider, nil
+}
+
+// startSpan starts a span for a crypto operation, continuing any trace
+// propagated in the request headers
+func startSpan(r *http.Request, name, operation string, algorithm crypto.Algorithm) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("crypto.algorithm", string(algorithm)),
+			attribute.String("crypto.operation", operation),
+		),
+	)
+}
+
+// failSpan marks a span as failed
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
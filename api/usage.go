@@ -0,0 +1,213 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"pqcd/security"
+)
+
+// Operations counted in key_usage
+const (
+	usageEncapsulate = "encapsulate"
+	usageDecapsulate = "decapsulate"
+)
+
+// A key seeing more than maxHourlyEncapsulations within usageWindow is flagged
+// as the likely target of an enumeration attack
+const (
+	maxHourlyEncapsulations = 1000
+	usageWindow             = time.Hour
+)
+
+// KeyUsageResponse reports how often a key has been used, per operation
+type KeyUsageResponse struct {
+	Fingerprint string              `json:"fingerprint"`
+	Operations  map[string]KeyUsage `json:"operations"`
+	Flagged     bool                `json:"flagged"`
+}
+
+// KeyUsage is the number of times a key was used for one operation
+type KeyUsage struct {
+	Count    int64     `json:"count"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// usageCounter counts encapsulations per key fingerprint in fixed hourly
+// windows
+type usageCounter struct {
+	mu      sync.Mutex
+	windows map[string]*usageWindowCount
+	now     func() time.Time
+}
+
+// usageWindowCount is the encapsulations of one key since start
+type usageWindowCount struct {
+	start time.Time
+	count int
+}
+
+func newUsageCounter() *usageCounter {
+	return &usageCounter{
+		windows: make(map[string]*usageWindowCount),
+		now:     time.Now,
+	}
+}
+
+// Add counts an encapsulation with the key and reports whether it took the
+// key over the hourly limit. Only the first encapsulation past the limit in a
+// window does, so a key is flagged once per window.
+func (c *usageCounter) Add(fingerprint string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	window, exists := c.windows[fingerprint]
+	if !exists || now.Sub(window.start) >= usageWindow {
+		// Forget keys whose windows have ended before tracking another one
+		if !exists && len(c.windows) >= maxTrackedClients {
+			for tracked, w := range c.windows {
+				if now.Sub(w.start) >= usageWindow {
+					delete(c.windows, tracked)
+				}
+			}
+		}
+		window = &usageWindowCount{start: now}
+		c.windows[fingerprint] = window
+	}
+	window.count++
+	return window.count == maxHourlyEncapsulations+1
+}
+
+// recordKeyUsage counts an operation with the key in key_usage
+func recordKeyUsage(db *sql.DB, fingerprint, operation string) error {
+	_, err := db.Exec(
+		`INSERT INTO key_usage (fingerprint, operation, count, last_used) VALUES (?, ?, 1, ?)
+		ON CONFLICT (fingerprint, operation) DO UPDATE SET count = count + 1, last_used = excluded.last_used`,
+		fingerprint, operation, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record key usage: %w", err)
+	}
+	return nil
+}
+
+// getKeyUsage returns the usage of a key per operation
+func getKeyUsage(db *sql.DB, fingerprint string) (map[string]KeyUsage, error) {
+	rows, err := db.Query("SELECT operation, count, last_used FROM key_usage WHERE fingerprint = ?", fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query key usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make(map[string]KeyUsage)
+	for rows.Next() {
+		var operation string
+		var entry KeyUsage
+		if err := rows.Scan(&operation, &entry.Count, &entry.LastUsed); err != nil {
+			return nil, fmt.Errorf("failed to scan key usage: %w", err)
+		}
+		usage[operation] = entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read key usage: %w", err)
+	}
+	return usage, nil
+}
+
+// isKeyFlagged reports whether any stored key pair with the fingerprint is flagged
+func isKeyFlagged(db *sql.DB, fingerprint string) (bool, error) {
+	var flagged bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM key_pairs WHERE fingerprint = ? AND flagged = 1)", fingerprint).Scan(&flagged)
+	if err != nil {
+		return false, fmt.Errorf("failed to read key flag: %w", err)
+	}
+	return flagged, nil
+}
+
+// flagKey marks the stored key pairs with the fingerprint as flagged and logs
+// a warning. The warning is logged even if the key isn't stored.
+func flagKey(db *sql.DB, r *http.Request, fingerprint string) error {
+	if _, err := db.Exec("UPDATE key_pairs SET flagged = 1 WHERE fingerprint = ?", fingerprint); err != nil {
+		return fmt.Errorf("failed to flag key: %w", err)
+	}
+
+	var keyID sql.NullInt64
+	if err := db.QueryRow("SELECT MIN(id) FROM key_pairs WHERE fingerprint = ?", fingerprint).Scan(&keyID); err != nil {
+		return fmt.Errorf("failed to find flagged key: %w", err)
+	}
+	description := fmt.Sprintf("Key %s used for more than %d encapsulations in an hour, possible enumeration attack", fingerprint, maxHourlyEncapsulations)
+	if requestID, ok := security.RequestIDFromContext(r.Context()); ok {
+		description = fmt.Sprintf("%s (request %s)", description, requestID)
+	}
+	_, err := db.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, related_item_id, related_item_type) VALUES (?, ?, ?, ?, ?, ?)",
+		"key_flagged", description, remoteIP(r), "WARNING", keyID, "key_pair",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log key event: %w", err)
+	}
+	return nil
+}
+
+// trackKeyUsage counts an operation with the key identified by fingerprint
+// and flags the key once its encapsulations exceed the hourly limit. Failures
+// are logged rather than failing the operation.
+func (h *CryptoHandler) trackKeyUsage(r *http.Request, fingerprint, operation string) {
+	if h.keyStore == nil {
+		return
+	}
+
+	logger := security.RequestLogger(r.Context()).WithFields(logrus.Fields{
+		"fingerprint": fingerprint,
+		"operation":   operation,
+	})
+	if err := recordKeyUsage(h.keyStore, fingerprint, operation); err != nil {
+		logger.WithError(err).Error("Failed to record key usage")
+	}
+	if operation != usageEncapsulate || !h.usage.Add(fingerprint) {
+		return
+	}
+
+	logger.WithField("ip", remoteIP(r)).Warn("Flagging key used for too many encapsulations")
+	if err := flagKey(h.keyStore, r, fingerprint); err != nil {
+		logger.WithError(err).Error("Failed to flag key")
+	}
+}
+
+// HandleKeyUsage handles reporting how often a key has been used for each
+// operation, and whether it has been flagged for excessive use
+func (h *CryptoHandler) HandleKeyUsage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.keyStore == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "key store is not configured")
+			return
+		}
+
+		fingerprint := mux.Vars(r)["fingerprint"]
+		operations, err := getKeyUsage(h.keyStore, fingerprint)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("fingerprint", fingerprint).Error("Failed to read key usage")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key usage")
+			return
+		}
+		flagged, err := isKeyFlagged(h.keyStore, fingerprint)
+		if err != nil {
+			security.RequestLogger(r.Context()).WithError(err).WithField("fingerprint", fingerprint).Error("Failed to read key flag")
+			respondWithError(w, http.StatusInternalServerError, "failed to read key usage")
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, KeyUsageResponse{
+			Fingerprint: fingerprint,
+			Operations:  operations,
+			Flagged:     flagged,
+		})
+	}
+}
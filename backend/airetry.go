@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Retry settings for calls to the AI service. The delay before each retry
+// doubles, up to aiRetryMaxDelay.
+const (
+	aiMaxAttempts   = 3
+	aiRetryMaxDelay = 2 * time.Second
+)
+
+// aiRetryBaseDelay is the delay before the first retry, shortened by tests
+var aiRetryBaseDelay = 200 * time.Millisecond
+
+// aiAttemptTimeout bounds a single call to the AI service
+const aiAttemptTimeout = 10 * time.Second
+
+// maxAIResponseBytes bounds the AI service response read into memory
+const maxAIResponseBytes = 1 << 20
+
+// callAIWithRetry posts payload as JSON to the AI service at url and returns
+// the response body. Network errors and 5xx responses are retried up to
+// maxAttempts attempts in all, waiting baseDelay before the first retry and
+// twice as long before each one after, capped at two seconds; 4xx responses
+// are returned at once. Cancelling ctx stops the call, including any wait
+// between attempts.
+func callAIWithRetry(ctx context.Context, url string, payload []byte, maxAttempts int, baseDelay time.Duration) ([]byte, error) {
+	delay := baseDelay
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var body []byte
+		var retryable bool
+		body, retryable, err = postAI(ctx, url, payload)
+		if err == nil {
+			return body, nil
+		}
+		if !retryable || ctx.Err() != nil {
+			return nil, err
+		}
+		if attempt == maxAttempts {
+			break
+		}
+
+		log.Printf("AI service attempt %d of %d failed: %v, retrying in %s", attempt, maxAttempts, err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		if delay *= 2; delay > aiRetryMaxDelay {
+			delay = aiRetryMaxDelay
+		}
+	}
+	return nil, fmt.Errorf("AI service failed after %d attempts: %w", maxAttempts, err)
+}
+
+// postAI makes a single call to the AI service, reporting whether a failure
+// is worth retrying. Only network errors and 5xx responses are: after a 4xx
+// the request itself is at fault, so sending it again would fail the same way.
+func postAI(ctx context.Context, url string, payload []byte) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, aiAttemptTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create AI request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, resp.StatusCode >= 500, fmt.Errorf("AI service returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAIResponseBytes))
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read AI response: %w", err)
+	}
+	return body, false, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pqcd/backend/crypto"
+)
+
+// CanaryStatus reports whether a canary token's decoy key has been used
+type CanaryStatus struct {
+	TokenID          string     `json:"token_id"`
+	Triggered        bool       `json:"triggered"`
+	TriggerCount     int        `json:"trigger_count"`
+	FirstTriggeredAt *time.Time `json:"first_triggered_at,omitempty"`
+	LastTriggeredAt  *time.Time `json:"last_triggered_at,omitempty"`
+	LastSourceIP     string     `json:"last_source_ip,omitempty"`
+}
+
+// canaryDecoy replaces the last of decoys with a decoy carrying a new canary
+// token, as similar to keyPair as the others, returning the token ID. If the
+// canary can't be generated the decoys are left as they are and the token ID
+// is empty.
+func canaryDecoy(keyPair *crypto.KeyPair, decoys []*crypto.KeyPair, targetHammingFraction float64) string {
+	if len(decoys) == 0 {
+		return ""
+	}
+	tokenID, err := crypto.NewCanaryTokenID()
+	if err != nil {
+		log.Printf("Failed to generate canary token: %v", err)
+		return ""
+	}
+	canary, err := crypto.GenerateCognitiveCannaryKeyPair(keyPair, tokenID, targetHammingFraction)
+	if err != nil {
+		log.Printf("Failed to generate canary decoy: %v", err)
+		return ""
+	}
+	crypto.ZeroBytes(decoys[len(decoys)-1].PrivateKey)
+	decoys[len(decoys)-1] = canary
+	return tokenID
+}
+
+// checkCanaryKey records a CRITICAL event if key carries a canary token. Only
+// decoys carry canary tokens, so whoever sent key got it from the key store.
+func checkCanaryKey(key []byte, r *http.Request) {
+	tokenID, ok := crypto.ExtractCanaryToken(key)
+	if !ok {
+		return
+	}
+	ip := clientIP(r)
+	log.Printf("Canary token %s used from %s on %s [request_id=%s]", tokenID, ip, r.URL.Path, requestID(r))
+
+	ctx, cancel := dbContext(r.Context())
+	defer cancel()
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, related_item_type) VALUES (?, ?, ?, ?, ?)",
+		"canary_triggered", withRequestID(fmt.Sprintf("Canary token %s used on %s", tokenID, r.URL.Path), r), ip, "CRITICAL", "canary_token",
+	)
+	if err != nil {
+		log.Printf("Failed to log canary event: %v", err)
+	}
+
+	now := time.Now().UTC().Format(sqliteTimestampFormat)
+	_, err = db.ExecContext(ctx,
+		`UPDATE canary_tokens SET trigger_count = trigger_count + 1,
+			first_triggered_at = COALESCE(first_triggered_at, ?), last_triggered_at = ?, last_source_ip = ?
+		WHERE token_id = ?`,
+		now, now, ip, tokenID,
+	)
+	if err != nil {
+		log.Printf("Failed to update canary token: %v", err)
+	}
+}
+
+// Canary handler reports whether the decoy carrying a canary token was used:
+// GET /api/canary/{tokenID}/triggered
+func canaryTriggeredHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tokenID, rest, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/canary/"), "/")
+	if !ok || rest != "triggered" || tokenID == "" {
+		sendErrorResponse(w, "Not found", http.StatusNotFound, "expected /api/canary/{tokenID}/triggered")
+		return
+	}
+
+	status := CanaryStatus{TokenID: tokenID}
+	var first, last sql.NullTime
+	var lastIP sql.NullString
+	ctx, cancel := dbContext(r.Context())
+	defer cancel()
+	err := db.QueryRowContext(ctx,
+		"SELECT trigger_count, first_triggered_at, last_triggered_at, last_source_ip FROM canary_tokens WHERE token_id = ?",
+		tokenID,
+	).Scan(&status.TriggerCount, &first, &last, &lastIP)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, "Unknown canary token", http.StatusNotFound, "")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to look up canary token", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status.Triggered = status.TriggerCount > 0
+	if first.Valid {
+		status.FirstTriggeredAt = &first.Time
+	}
+	if last.Valid {
+		status.LastTriggeredAt = &last.Time
+	}
+	status.LastSourceIP = lastIP.String
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -153,7 +153,7 @@ func keyGenerateHandler(w http.ResponseWriter, r *http.Request) {
 	// Generate decoys if requested
 	var decoyKeys []string
 	if req.Count > 0 {
-		decoys, err := crypto.GenerateCognitiveDecoyKeys(keyPair, req.Count)
+		decoys, err := crypto.GenerateCognitiveDecoyKeys(keyPair, req.Count, crypto.DefaultDecoyHammingFraction)
 		if err == nil {
 			for _, decoy := range decoys {
 				decoyKeyB64 := base64.StdEncoding.EncodeToString(decoy.PublicKey)
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"log"
 	
-	"./crypto"
+	"github.com/pqcd/backend/crypto"
 )
 
 func main() {
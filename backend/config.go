@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Default configuration values
+const (
+	defaultPort             = "8083"
+	defaultMaxRequestBodyMB = 16
+	defaultDecoyComplexity  = 5
+	defaultBatchWorkerCount = 4
+
+	defaultMaxDecoyCount      = 100
+	defaultMaxDecoyComplexity = 10
+
+	defaultDBMaxConns         = 10
+	defaultDBMaxIdleConns     = 5
+	defaultDBConnMaxLifetimeS = 300
+	defaultDBSizeThresholdMB  = 1024
+
+	defaultDecoyRotationIntervalS = 86400
+)
+
+// Config holds the backend settings. Values come from pqcd.yaml or pqcd.toml
+// in the working directory, or the file given with --config, and environment
+// variables named after the upper-cased keys override the file.
+type Config struct {
+	Port                   string     `mapstructure:"port"`
+	DatabasePath           string     `mapstructure:"db_path"`
+	AIServiceURL           string     `mapstructure:"ai_service_url"`
+	LogLevel               string     `mapstructure:"log_level"`
+	TLSCertPath            string     `mapstructure:"tls_cert_path"`
+	TLSKeyPath             string     `mapstructure:"tls_key_path"`
+	MaxRequestBodyMB       int        `mapstructure:"max_request_body_mb"`
+	DecoyComplexityDefault int        `mapstructure:"decoy_complexity_default"`
+	MaxDecoyCount          int        `mapstructure:"max_decoy_count"`
+	MaxDecoyComplexity     int        `mapstructure:"max_decoy_complexity"`
+	BatchWorkerCount       int        `mapstructure:"batch_worker_count"`
+	DBMaxConns             int        `mapstructure:"db_max_conns"`
+	DBMaxIdleConns         int        `mapstructure:"db_max_idle_conns"`
+	DBConnMaxLifetimeS     int        `mapstructure:"db_conn_max_lifetime_s"`
+	DBSizeThresholdMB      int        `mapstructure:"db_size_threshold_mb"`
+	DecoyRotationIntervalS int        `mapstructure:"decoy_rotation_interval_s"`
+	CORS                   CORSConfig `mapstructure:"cors"`
+}
+
+// appConfig is the configuration in use, replaced by main at startup
+var appConfig = defaultConfig()
+
+// defaultConfig returns the configuration used when nothing is set
+func defaultConfig() *Config {
+	return &Config{
+		Port:                   defaultPort,
+		DatabasePath:           "./pqcd.db",
+		AIServiceURL:           "http://localhost:5000",
+		LogLevel:               "info",
+		MaxRequestBodyMB:       defaultMaxRequestBodyMB,
+		DecoyComplexityDefault: defaultDecoyComplexity,
+		MaxDecoyCount:          defaultMaxDecoyCount,
+		MaxDecoyComplexity:     defaultMaxDecoyComplexity,
+		BatchWorkerCount:       defaultBatchWorkerCount,
+		DBMaxConns:             defaultDBMaxConns,
+		DBMaxIdleConns:         defaultDBMaxIdleConns,
+		DBConnMaxLifetimeS:     defaultDBConnMaxLifetimeS,
+		DBSizeThresholdMB:      defaultDBSizeThresholdMB,
+		DecoyRotationIntervalS: defaultDecoyRotationIntervalS,
+		CORS:                   defaultCORSConfig(),
+	}
+}
+
+// loadConfig reads the configuration file at path, or looks for pqcd.yaml or
+// pqcd.toml in the working directory if path is empty, then applies
+// environment overrides and validates the result
+func loadConfig(path string) (*Config, error) {
+	v := viper.New()
+
+	defaults := defaultConfig()
+	v.SetDefault("port", defaults.Port)
+	v.SetDefault("db_path", defaults.DatabasePath)
+	v.SetDefault("ai_service_url", defaults.AIServiceURL)
+	v.SetDefault("log_level", defaults.LogLevel)
+	v.SetDefault("tls_cert_path", "")
+	v.SetDefault("tls_key_path", "")
+	v.SetDefault("max_request_body_mb", defaults.MaxRequestBodyMB)
+	v.SetDefault("decoy_complexity_default", defaults.DecoyComplexityDefault)
+	v.SetDefault("max_decoy_count", defaults.MaxDecoyCount)
+	v.SetDefault("max_decoy_complexity", defaults.MaxDecoyComplexity)
+	v.SetDefault("batch_worker_count", defaults.BatchWorkerCount)
+	v.SetDefault("db_max_conns", defaults.DBMaxConns)
+	v.SetDefault("db_max_idle_conns", defaults.DBMaxIdleConns)
+	v.SetDefault("db_conn_max_lifetime_s", defaults.DBConnMaxLifetimeS)
+	v.SetDefault("db_size_threshold_mb", defaults.DBSizeThresholdMB)
+	v.SetDefault("decoy_rotation_interval_s", defaults.DecoyRotationIntervalS)
+	v.SetDefault("cors.allowed_origins", defaults.CORS.AllowedOrigins)
+	v.SetDefault("cors.allowed_methods", defaults.CORS.AllowedMethods)
+	v.SetDefault("cors.max_age_sec", defaults.CORS.MaxAgeSec)
+	v.SetDefault("cors.allow_credentials", defaults.CORS.AllowCredentials)
+	v.AutomaticEnv()
+	// TLS_CERT and TLS_KEY are accepted as shorter names for the TLS settings
+	v.BindEnv("tls_cert_path", "TLS_CERT_PATH", "TLS_CERT")
+	v.BindEnv("tls_key_path", "TLS_KEY_PATH", "TLS_KEY")
+	// The nested CORS settings are read from CORS_* variables
+	v.BindEnv("cors.allowed_origins", "CORS_ALLOWED_ORIGINS")
+	v.BindEnv("cors.allowed_methods", "CORS_ALLOWED_METHODS")
+	v.BindEnv("cors.max_age_sec", "CORS_MAX_AGE_SEC")
+	v.BindEnv("cors.allow_credentials", "CORS_ALLOW_CREDENTIALS")
+
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+	} else {
+		v.SetConfigName("pqcd")
+		v.AddConfigPath(".")
+		if err := v.ReadInConfig(); err != nil {
+			var notFound viper.ConfigFileNotFoundError
+			if !errors.As(err, &notFound) {
+				return nil, fmt.Errorf("failed to read config file: %w", err)
+			}
+		}
+	}
+
+	config := &Config{}
+	if err := v.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks every field and reports all problems at once, in a single
+// error listing what validateConfig found
+func (c *Config) Validate() error {
+	errs := validateConfig(c)
+	if len(errs) == 0 {
+		return nil
+	}
+	problems := make([]string, len(errs))
+	for i, err := range errs {
+		problems[i] = err.Error()
+	}
+	return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+}
+
+// validateConfig returns an error for every invalid field of cfg, so startup
+// can report them all at once
+func validateConfig(cfg *Config) []error {
+	var errs []error
+
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %q", cfg.Port))
+	}
+	if cfg.DatabasePath == "" {
+		errs = append(errs, errors.New("db_path must not be empty"))
+	}
+	switch strings.ToLower(cfg.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log_level must be debug, info, warn or error, got %q", cfg.LogLevel))
+	}
+	if (cfg.TLSCertPath == "") != (cfg.TLSKeyPath == "") {
+		errs = append(errs, errors.New("tls_cert_path and tls_key_path must be set together"))
+	}
+	for _, file := range []string{cfg.TLSCertPath, cfg.TLSKeyPath} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("TLS file %s is not readable: %w", file, err))
+		}
+	}
+	if cfg.MaxRequestBodyMB < 0 {
+		errs = append(errs, fmt.Errorf("max_request_body_mb must not be negative, got %d", cfg.MaxRequestBodyMB))
+	}
+	if cfg.DecoyComplexityDefault < 1 {
+		errs = append(errs, fmt.Errorf("decoy_complexity_default must be at least 1, got %d", cfg.DecoyComplexityDefault))
+	}
+	if cfg.MaxDecoyCount < 1 {
+		errs = append(errs, fmt.Errorf("max_decoy_count must be at least 1, got %d", cfg.MaxDecoyCount))
+	}
+	if cfg.MaxDecoyComplexity < 1 {
+		errs = append(errs, fmt.Errorf("max_decoy_complexity must be at least 1, got %d", cfg.MaxDecoyComplexity))
+	} else if cfg.DecoyComplexityDefault > cfg.MaxDecoyComplexity {
+		errs = append(errs, fmt.Errorf("decoy_complexity_default must not exceed max_decoy_complexity, got %d > %d", cfg.DecoyComplexityDefault, cfg.MaxDecoyComplexity))
+	}
+	if cfg.BatchWorkerCount < 1 {
+		errs = append(errs, fmt.Errorf("batch_worker_count must be at least 1, got %d", cfg.BatchWorkerCount))
+	}
+	if cfg.DBMaxConns < 0 {
+		errs = append(errs, fmt.Errorf("db_max_conns must not be negative, got %d", cfg.DBMaxConns))
+	}
+	if cfg.DBMaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("db_max_idle_conns must not be negative, got %d", cfg.DBMaxIdleConns))
+	} else if cfg.DBMaxConns > 0 && cfg.DBMaxIdleConns > cfg.DBMaxConns {
+		errs = append(errs, fmt.Errorf("db_max_idle_conns must not exceed db_max_conns, got %d > %d", cfg.DBMaxIdleConns, cfg.DBMaxConns))
+	}
+	if cfg.DBConnMaxLifetimeS < 0 {
+		errs = append(errs, fmt.Errorf("db_conn_max_lifetime_s must not be negative, got %d", cfg.DBConnMaxLifetimeS))
+	}
+	if cfg.DBSizeThresholdMB < 0 {
+		errs = append(errs, fmt.Errorf("db_size_threshold_mb must not be negative, got %d", cfg.DBSizeThresholdMB))
+	}
+	if cfg.DecoyRotationIntervalS < 0 {
+		errs = append(errs, fmt.Errorf("decoy_rotation_interval_s must not be negative, got %d", cfg.DecoyRotationIntervalS))
+	}
+	if err := ValidateCORSConfig(cfg.CORS); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// maxRequestBodyBytes is the size limit for encrypt and decrypt requests.
+// Zero falls back to the default.
+func (c *Config) maxRequestBodyBytes() int64 {
+	if c.MaxRequestBodyMB == 0 {
+		return defaultMaxRequestBodyMB << 20
+	}
+	return int64(c.MaxRequestBodyMB) << 20
+}
+
+// decoyRotationInterval is how often decoy keys are rotated. Zero turns
+// rotation off.
+func (c *Config) decoyRotationInterval() time.Duration {
+	return time.Duration(c.DecoyRotationIntervalS) * time.Second
+}
+
+// dbConnMaxLifetime is how long a database connection is reused before it is
+// closed. Zero reuses connections forever.
+func (c *Config) dbConnMaxLifetime() time.Duration {
+	return time.Duration(c.DBConnMaxLifetimeS) * time.Second
+}
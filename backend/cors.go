@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+// defaultCORSMethods are the methods cross-origin requests may use when
+// cors.allowed_methods is not set
+var defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+
+// CORSConfig is the cross-origin policy. It is read from the cors section of
+// the config file, or from CORS_ALLOWED_ORIGINS and CORS_ALLOWED_METHODS
+// (comma-separated), CORS_MAX_AGE_SEC and CORS_ALLOW_CREDENTIALS.
+type CORSConfig struct {
+	AllowedOrigins   []string `mapstructure:"allowed_origins"`
+	AllowedMethods   []string `mapstructure:"allowed_methods"`
+	MaxAgeSec        int      `mapstructure:"max_age_sec"`
+	AllowCredentials bool     `mapstructure:"allow_credentials"`
+}
+
+// defaultCORSConfig allows any origin, without credentials. Production
+// deployments should list their origins instead.
+func defaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: defaultCORSMethods,
+	}
+}
+
+// ValidateCORSConfig checks a CORS policy. A wildcard origin is rejected when
+// credentials are allowed, since the CORS spec forbids answering a
+// credentialed request with Access-Control-Allow-Origin: *.
+func ValidateCORSConfig(cfg CORSConfig) error {
+	var problems []string
+
+	if len(cfg.AllowedOrigins) == 0 {
+		problems = append(problems, "cors.allowed_origins must not be empty")
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if strings.TrimSpace(origin) == "" {
+			problems = append(problems, "cors.allowed_origins must not contain empty origins")
+			break
+		}
+	}
+	if cfg.AllowCredentials {
+		for _, origin := range cfg.AllowedOrigins {
+			if strings.Contains(origin, "*") {
+				problems = append(problems, fmt.Sprintf("cors.allowed_origins must not contain the wildcard %q when cors.allow_credentials is set", origin))
+				break
+			}
+		}
+	}
+	for _, method := range cfg.AllowedMethods {
+		if method == "" || strings.ContainsAny(method, " \t,") {
+			problems = append(problems, fmt.Sprintf("cors.allowed_methods contains an invalid method %q", method))
+		}
+	}
+	if cfg.MaxAgeSec < 0 {
+		problems = append(problems, fmt.Sprintf("cors.max_age_sec must not be negative, got %d", cfg.MaxAgeSec))
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// corsOptions builds the middleware options for the policy. The allowed and
+// exposed headers are fixed by the API rather than configured.
+func (c CORSConfig) corsOptions(debug bool) cors.Options {
+	methods := c.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	return cors.Options{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   methods,
+		AllowedHeaders:   []string{"Content-Type", "Authorization", requestIDHeader, streamPublicKeyHeader, streamPrivateKeyHeader, streamAlgorithmHeader},
+		ExposedHeaders:   []string{requestIDHeader},
+		MaxAge:           c.MaxAgeSec,
+		AllowCredentials: c.AllowCredentials,
+		Debug:            debug,
+	}
+}
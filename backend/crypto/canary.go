@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// CanaryMagic starts every canary key: 0xCA 'N' 'R' 0x00, "CANARY" squeezed
+// into four bytes
+var CanaryMagic = []byte{0xCA, 'N', 'R', 0x00}
+
+// Layout of a canary key
+const (
+	canaryTokenSize   = 32                                    // Bytes in a canary token
+	canaryScanBytes   = 8                                     // How far into a key the magic is looked for
+	canaryTokenOffset = canaryScanBytes                       // Where the token's bits start
+	canaryKeyMinSize  = canaryTokenOffset + canaryTokenSize*8 // One key byte per token bit
+)
+
+// NewCanaryTokenID returns a random canary token ID: 32 bytes, base64url-encoded
+func NewCanaryTokenID() (string, error) {
+	token := make([]byte, canaryTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate canary token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// GenerateCognitiveCannaryKeyPair generates a decoy of realKey, like
+// GenerateCognitiveDecoyKeys, that carries tokenID. Both halves of the decoy
+// start with CanaryMagic and hide the token's bits, one per byte, in the least
+// significant bits of the bytes after it.
+func GenerateCognitiveCannaryKeyPair(realKey *KeyPair, tokenID string, targetHammingFraction float64) (*KeyPair, error) {
+	token, err := base64.RawURLEncoding.DecodeString(tokenID)
+	if err != nil || len(token) != canaryTokenSize {
+		return nil, fmt.Errorf("canary token ID must be %d base64url-encoded bytes", canaryTokenSize)
+	}
+	if len(realKey.PublicKey) < canaryKeyMinSize || len(realKey.PrivateKey) < canaryKeyMinSize {
+		return nil, fmt.Errorf("%s keys are too short to carry a canary token", realKey.Algorithm)
+	}
+
+	decoy, err := SimilarityTunedDecoy(realKey, targetHammingFraction, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	embedCanaryToken(decoy.PublicKey, token)
+	embedCanaryToken(decoy.PrivateKey, token)
+	return decoy, nil
+}
+
+// embedCanaryToken writes the magic and the token's bits into key
+func embedCanaryToken(key, token []byte) {
+	copy(key, CanaryMagic)
+	for i := 0; i < canaryTokenSize*8; i++ {
+		bit := token[i/8] >> (7 - i%8) & 1
+		key[canaryTokenOffset+i] = key[canaryTokenOffset+i]&^1 | bit
+	}
+}
+
+// ExtractCanaryToken returns the canary token ID hidden in key, if the magic
+// appears in its first 8 bytes
+func ExtractCanaryToken(key []byte) (string, bool) {
+	if len(key) < canaryKeyMinSize || !bytes.Contains(key[:canaryScanBytes], CanaryMagic) {
+		return "", false
+	}
+
+	token := make([]byte, canaryTokenSize)
+	for i := 0; i < canaryTokenSize*8; i++ {
+		token[i/8] |= (key[canaryTokenOffset+i] & 1) << (7 - i%8)
+	}
+	return base64.RawURLEncoding.EncodeToString(token), true
+}
@@ -2,7 +2,18 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
 	"testing"
+	"testing/iotest"
+
+	"golang.org/x/crypto/hkdf"
 )
 
 func TestKyberKeyGeneration(t *testing.T) {
@@ -23,10 +34,22 @@ func TestKyberKeyGeneration(t *testing.T) {
 		t.Errorf("Expected algorithm %s, got %s", AlgoKyber, keyPair.Algorithm)
 	}
 
-	// Generate a fingerprint and verify it's not empty
+	// Generate a fingerprint and verify its format
 	fingerprint := FingerPrint(keyPair.PublicKey)
-	if fingerprint == "" {
-		t.Error("Expected non-empty fingerprint")
+	if len(fingerprint) != 95 {
+		t.Errorf("Expected fingerprint length 95, got %d", len(fingerprint))
+	}
+	if strings.Count(fingerprint, ":") != 31 {
+		t.Errorf("Expected 32 colon-separated pairs, got %s", fingerprint)
+	}
+
+	// The short variant keeps the legacy 16-byte hex format
+	short := FingerPrintShort(keyPair.PublicKey)
+	if len(short) != 32 {
+		t.Errorf("Expected short fingerprint length 32, got %d", len(short))
+	}
+	if strings.ReplaceAll(fingerprint, ":", "")[:32] != short {
+		t.Errorf("Short fingerprint %s is not a prefix of %s", short, fingerprint)
 	}
 }
 
@@ -69,6 +92,58 @@ func TestEncryptionDecryption(t *testing.T) {
 		t.Errorf("Original: %s", plaintext)
 		t.Errorf("Decrypted: %s", decrypted)
 	}
+
+	// Verify that tampering with the ciphertext is detected
+	tampered := &EncryptedData{
+		Ciphertext: append([]byte{}, encrypted.Ciphertext...),
+		Algorithm:  encrypted.Algorithm,
+		Nonce:      encrypted.Nonce,
+	}
+	tampered.Ciphertext[len(tampered.Ciphertext)-1] ^= 0x01
+	if _, err := Decrypt(tampered, keyPair.PrivateKey); err == nil {
+		t.Error("Expected decryption of tampered ciphertext to fail")
+	}
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	// Generate a key pair
+	keyPair, err := GenerateKeyPair(AlgoKyber)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	encrypted, err := Encrypt([]byte("authenticated message"), keyPair.PublicKey, keyPair.Algorithm)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	// Tampering with the nonce must be detected
+	badNonce := append([]byte{}, encrypted.Nonce...)
+	badNonce[0] ^= 0x01
+	if _, err := Decrypt(&EncryptedData{Ciphertext: encrypted.Ciphertext, Algorithm: encrypted.Algorithm, Nonce: badNonce}, keyPair.PrivateKey); err == nil {
+		t.Error("Expected decryption with a modified nonce to fail")
+	}
+
+	// Tampering with the encapsulation must be detected
+	badCiphertext := append([]byte{}, encrypted.Ciphertext...)
+	badCiphertext[KyberCiphertextSize-1] ^= 0x01
+	if _, err := Decrypt(&EncryptedData{Ciphertext: badCiphertext, Algorithm: encrypted.Algorithm, Nonce: encrypted.Nonce}, keyPair.PrivateKey); err == nil {
+		t.Error("Expected decryption with a modified encapsulation to fail")
+	}
+
+	// A truncated nonce must be rejected
+	if _, err := Decrypt(&EncryptedData{Ciphertext: encrypted.Ciphertext, Algorithm: encrypted.Algorithm, Nonce: encrypted.Nonce[:8]}, keyPair.PrivateKey); err == nil {
+		t.Error("Expected decryption with a short nonce to fail")
+	}
+
+	// A ciphertext without room for the encapsulation and tag must be rejected
+	// before decapsulating
+	short := encrypted.Ciphertext[:KyberCiphertextSize+gcmTagSize-1]
+	_, err = Decrypt(&EncryptedData{Ciphertext: short, Algorithm: encrypted.Algorithm, Nonce: encrypted.Nonce}, keyPair.PrivateKey)
+	want := fmt.Sprintf("ciphertext too short: expected at least %d bytes, got %d", KyberCiphertextSize+gcmTagSize, len(short))
+	if err == nil || err.Error() != want {
+		t.Errorf("Expected error %q, got %v", want, err)
+	}
 }
 
 func TestDecoyGeneration(t *testing.T) {
@@ -80,7 +155,7 @@ func TestDecoyGeneration(t *testing.T) {
 
 	// Generate decoy keys
 	numDecoys := 3
-	decoys, err := GenerateCognitiveDecoyKeys(realKey, numDecoys)
+	decoys, err := GenerateCognitiveDecoyKeys(realKey, numDecoys, DefaultDecoyHammingFraction)
 	if err != nil {
 		t.Fatalf("Failed to generate decoy keys: %v", err)
 	}
@@ -120,4 +195,303 @@ func TestDecoyGeneration(t *testing.T) {
 			t.Errorf("Decoy %d: Fingerprint is identical to real key", i)
 		}
 	}
-} 
\ No newline at end of file
+} 
+func TestCanaryKeyPair(t *testing.T) {
+	realKey, err := GenerateKeyPair(AlgoKyber)
+	if err != nil {
+		t.Fatalf("Failed to generate real key pair: %v", err)
+	}
+	tokenID, err := NewCanaryTokenID()
+	if err != nil {
+		t.Fatalf("Failed to generate canary token: %v", err)
+	}
+
+	canary, err := GenerateCognitiveCannaryKeyPair(realKey, tokenID, DefaultDecoyHammingFraction)
+	if err != nil {
+		t.Fatalf("Failed to generate canary key pair: %v", err)
+	}
+	if len(canary.PublicKey) != len(realKey.PublicKey) || len(canary.PrivateKey) != len(realKey.PrivateKey) {
+		t.Errorf("Expected the canary to have the real key's sizes")
+	}
+	if bytes.Equal(canary.PublicKey, realKey.PublicKey) {
+		t.Error("Canary public key is identical to real key")
+	}
+	if !bytes.HasPrefix(canary.PublicKey, CanaryMagic) {
+		t.Errorf("Expected the canary public key to start with the magic, got %x", canary.PublicKey[:8])
+	}
+
+	for name, key := range map[string][]byte{"public": canary.PublicKey, "private": canary.PrivateKey} {
+		if got, ok := ExtractCanaryToken(key); !ok || got != tokenID {
+			t.Errorf("Expected the %s key to carry token %s, got %s (%v)", name, tokenID, got, ok)
+		}
+	}
+
+	// Real keys and plain decoys carry no token
+	decoys, err := GenerateCognitiveDecoyKeys(realKey, 3, DefaultDecoyHammingFraction)
+	if err != nil {
+		t.Fatalf("Failed to generate decoy keys: %v", err)
+	}
+	for _, key := range [][]byte{realKey.PublicKey, decoys[0].PublicKey, decoys[2].PrivateKey, CanaryMagic} {
+		if _, ok := ExtractCanaryToken(key); ok {
+			t.Errorf("Expected no canary token in %x...", key[:4])
+		}
+	}
+
+	if _, err := GenerateCognitiveCannaryKeyPair(realKey, "too-short", DefaultDecoyHammingFraction); err == nil {
+		t.Error("Expected an invalid token ID to be rejected")
+	}
+	short := &KeyPair{PublicKey: make([]byte, 32), PrivateKey: make([]byte, 64), Algorithm: "tiny"}
+	if _, err := GenerateCognitiveCannaryKeyPair(short, tokenID, DefaultDecoyHammingFraction); err == nil {
+		t.Error("Expected keys too short for a token to be rejected")
+	}
+}
+
+func TestKeyEncryptorKnownAnswer(t *testing.T) {
+	// Encrypted with "test master key", so keys stored before the storage key
+	// derivation moved to x/crypto/hkdf still decrypt
+	blob, _ := hex.DecodeString("5091fe4838571b831f0b2f8241dbb01b81b93ce6ab103650e93e949b1b700b4ae29fb58fb038a945e7d6d20b0845fb9441e0cc673772e12dcb")
+	encryptor, err := NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	privKey, err := encryptor.DecryptFromStorage(blob)
+	if err != nil {
+		t.Fatalf("Failed to decrypt stored key: %v", err)
+	}
+	if string(privKey) != "stored before the HKDF change" {
+		t.Errorf("Unexpected plaintext %q", privKey)
+	}
+}
+
+func TestKeyEncryptorRoundTrip(t *testing.T) {
+	encryptor, err := NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	keyPair, _ := GenerateKeyPair(AlgoKyber)
+
+	blob, err := encryptor.EncryptForStorage(keyPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	if bytes.Contains(blob, keyPair.PrivateKey[:32]) {
+		t.Error("Expected the stored blob not to contain the private key")
+	}
+	if len(blob) != 12+len(keyPair.PrivateKey)+16 {
+		t.Errorf("Expected nonce || ciphertext || tag of %d bytes, got %d", 12+len(keyPair.PrivateKey)+16, len(blob))
+	}
+
+	again, _ := encryptor.EncryptForStorage(keyPair.PrivateKey)
+	if bytes.Equal(blob, again) {
+		t.Error("Expected a fresh nonce for every encryption")
+	}
+
+	decrypted, err := encryptor.DecryptFromStorage(blob)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, keyPair.PrivateKey) {
+		t.Error("Decrypted key does not match the original")
+	}
+
+	wrongKey, _ := NewKeyEncryptor("another master key")
+	if _, err := wrongKey.DecryptFromStorage(blob); err == nil {
+		t.Error("Expected decryption with the wrong master key to fail")
+	}
+	blob[len(blob)-1] ^= 0x01
+	if _, err := encryptor.DecryptFromStorage(blob); err == nil {
+		t.Error("Expected decryption of a tampered blob to fail")
+	}
+	if _, err := encryptor.DecryptFromStorage(blob[:10]); err == nil {
+		t.Error("Expected decryption of a truncated blob to fail")
+	}
+	if _, err := NewKeyEncryptor(""); err == nil {
+		t.Error("Expected an empty master key to be rejected")
+	}
+}
+
+func TestScoreDecoyEffectiveness(t *testing.T) {
+	realKey, err := GenerateKeyPair(AlgoKyber)
+	if err != nil {
+		t.Fatalf("Failed to generate real key pair: %v", err)
+	}
+
+	// Flip the bits of one byte, or of every byte
+	modified := func(n int) *KeyPair {
+		publicKey := bytes.Clone(realKey.PublicKey)
+		for i := 0; i < n; i++ {
+			publicKey[i] ^= 0xFF
+		}
+		return &KeyPair{PublicKey: publicKey, Algorithm: realKey.Algorithm}
+	}
+	minimal := ScoreDecoyEffectiveness(realKey, modified(1))
+	heavy := ScoreDecoyEffectiveness(realKey, modified(len(realKey.PublicKey)))
+	if minimal <= heavy {
+		t.Errorf("Expected a minimally modified decoy to score above a heavily modified one, got %f and %f", minimal, heavy)
+	}
+
+	if got := ScoreDecoyEffectiveness(realKey, realKey); got != 1 {
+		t.Errorf("Expected the real key to score 1 against itself, got %f", got)
+	}
+	otherAlgorithm := modified(1)
+	otherAlgorithm.Algorithm = AlgoDilithium
+	if got := ScoreDecoyEffectiveness(realKey, otherAlgorithm); got >= minimal {
+		t.Errorf("Expected an algorithm mismatch to lower the score below %f, got %f", minimal, got)
+	}
+
+	decoys, err := GenerateCognitiveDecoyKeys(realKey, 3, DefaultDecoyHammingFraction)
+	if err != nil {
+		t.Fatalf("Failed to generate decoy keys: %v", err)
+	}
+	for i, decoy := range decoys {
+		if score := ScoreDecoyEffectiveness(realKey, decoy); score < 0 || score > 1 {
+			t.Errorf("Decoy %d: Expected a score in [0,1], got %f", i, score)
+		}
+	}
+}
+
+func TestSimilarityTuner(t *testing.T) {
+	for _, algorithm := range []string{AlgoKyber, AlgoDilithium} {
+		realKey, err := GenerateKeyPair(algorithm)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key pair: %v", algorithm, err)
+		}
+
+		for _, target := range []float64{0.01, 0.05, 0.1, DefaultDecoyHammingFraction, 0.4, 0.5} {
+			decoy, err := SimilarityTunedDecoy(realKey, target, rand.Reader)
+			if err != nil {
+				t.Fatalf("%s at %g: Failed to tune decoy: %v", algorithm, target, err)
+			}
+			if decoy.Algorithm != realKey.Algorithm {
+				t.Errorf("%s at %g: Expected the real key's algorithm, got %s", algorithm, target, decoy.Algorithm)
+			}
+
+			for name, keys := range map[string][2][]byte{
+				"public":  {realKey.PublicKey, decoy.PublicKey},
+				"private": {realKey.PrivateKey, decoy.PrivateKey},
+			} {
+				achieved := hammingDistance(keys[0], keys[1])
+				if math.Abs(achieved-target) > similarityTolerance*target {
+					t.Errorf("%s at %g: Expected the %s key to differ in %g of its bits (±5%%), got %g", algorithm, target, name, target, achieved)
+				}
+			}
+		}
+	}
+
+	// Decoys of the same key don't share their flipped bits
+	realKey, err := GenerateKeyPair(AlgoKyber)
+	if err != nil {
+		t.Fatalf("Failed to generate real key pair: %v", err)
+	}
+	first, err := SimilarityTunedDecoy(realKey, 0.1, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to tune decoy: %v", err)
+	}
+	second, err := SimilarityTunedDecoy(realKey, 0.1, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to tune decoy: %v", err)
+	}
+	if bytes.Equal(first.PublicKey, second.PublicKey) {
+		t.Error("Expected decoys tuned to the same target to differ")
+	}
+
+	for _, target := range []float64{0, -0.1, 0.51, math.NaN()} {
+		if _, err := SimilarityTunedDecoy(realKey, target, rand.Reader); err == nil {
+			t.Errorf("Expected target %g to be rejected", target)
+		}
+	}
+	failing := iotest.ErrReader(errors.New("entropy exhausted"))
+	if _, err := SimilarityTunedDecoy(realKey, 0.1, failing); err == nil {
+		t.Error("Expected a failing random source to be reported")
+	}
+}
+
+func TestStreamEncryption(t *testing.T) {
+	keyPair, err := GenerateKeyPair(AlgoKyber)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	// Empty, partial, exact and multi-chunk payloads all round-trip
+	for _, size := range []int{0, 1, StreamChunkSize, 3*StreamChunkSize + 17} {
+		payload := bytes.Repeat([]byte{byte(size)}, size)
+		var encrypted, decrypted bytes.Buffer
+		if err := EncryptStream(&encrypted, bytes.NewReader(payload), keyPair.PublicKey, AlgoKyber); err != nil {
+			t.Fatalf("Failed to encrypt %d bytes: %v", size, err)
+		}
+		if err := DecryptStream(&decrypted, bytes.NewReader(encrypted.Bytes()), keyPair.PrivateKey); err != nil {
+			t.Fatalf("Failed to decrypt %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(decrypted.Bytes(), payload) {
+			t.Errorf("Decrypted %d byte stream does not match", size)
+		}
+	}
+
+	var encrypted bytes.Buffer
+	payload := bytes.Repeat([]byte("stream"), StreamChunkSize/2)
+	if err := EncryptStream(&encrypted, bytes.NewReader(payload), keyPair.PublicKey, AlgoKyber); err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	stream := encrypted.Bytes()
+	firstChunk := frameHeaderSize + KyberCiphertextSize
+	firstChunkEnd := firstChunk + frameHeaderSize + maxStreamFrameSize
+
+	tampered := map[string][]byte{
+		"truncated":           stream[:len(stream)-10],
+		"final chunk dropped": stream[:firstChunkEnd],
+		"trailing data":       append(append([]byte{}, stream...), 0),
+		"first chunk reused":  append(append([]byte{}, stream[:firstChunkEnd]...), stream[firstChunk:]...),
+	}
+	flipped := append([]byte{}, stream...)
+	flipped[firstChunk+frameHeaderSize+chunkHeaderSize] ^= 1
+	tampered["flipped bit"] = flipped
+	for name, data := range tampered {
+		if err := DecryptStream(io.Discard, bytes.NewReader(data), keyPair.PrivateKey); err == nil {
+			t.Errorf("%s: Expected decryption to fail", name)
+		}
+	}
+}
+
+func TestDeriveKeyShake256(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x0b}, 32)
+	context := []byte(encryptionKeyContext)
+
+	shake, err := DeriveKeyShake256(secret, context, 32)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+	hkdfKey := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, secret, nil, context), hkdfKey)
+	if bytes.Equal(shake, hkdfKey) {
+		t.Error("Expected SHAKE-256 and HKDF-SHA256 to derive different keys from the same input")
+	}
+
+	again, _ := DeriveKeyShake256(secret, context, 32)
+	if !bytes.Equal(shake, again) {
+		t.Error("Expected the same secret and context to derive the same key")
+	}
+	other, _ := DeriveKeyShake256(secret, []byte("another context"), 32)
+	if bytes.Equal(shake, other) {
+		t.Error("Expected different contexts to derive different keys")
+	}
+
+	if _, err := DeriveKeyShake256(nil, context, 32); err == nil {
+		t.Error("Expected an empty secret to be rejected")
+	}
+	if _, err := DeriveKeyShake256(secret, context, 0); err == nil {
+		t.Error("Expected a zero length to be rejected")
+	}
+}
+
+func TestDeriveKeyShake256Length(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x0b}, 32)
+	for _, length := range []int{1, 16, 32, 64, 137, 1024} {
+		key, err := DeriveKeyShake256(secret, nil, length)
+		if err != nil {
+			t.Fatalf("Failed to derive %d bytes: %v", length, err)
+		}
+		if len(key) != length {
+			t.Errorf("Expected %d bytes, got %d", length, len(key))
+		}
+	}
+}
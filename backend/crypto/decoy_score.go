@@ -0,0 +1,82 @@
+package crypto
+
+import (
+	"math/bits"
+	"strings"
+)
+
+// Weights of the signals ScoreDecoyEffectiveness combines. Public key
+// similarity counts most, since it is what an attacker comparing stored keys
+// sees first.
+const (
+	decoyPublicKeyWeight   = 0.5
+	decoyFingerprintWeight = 0.3
+	decoyAlgorithmWeight   = 0.2
+)
+
+// ScoreDecoyEffectiveness rates how hard a decoy is to tell apart from the
+// real key, from 0 (obviously fake) to 1 (maximally confusing). It combines
+// how few bits differ between the public keys, how many leading hex
+// characters their fingerprints share and whether the algorithms match.
+func ScoreDecoyEffectiveness(real *KeyPair, decoy *KeyPair) float64 {
+	if real == nil || decoy == nil {
+		return 0
+	}
+
+	score := decoyPublicKeyWeight * (1 - hammingDistance(real.PublicKey, decoy.PublicKey))
+	score += decoyFingerprintWeight * fingerprintPrefixSimilarity(FingerPrint(real.PublicKey), FingerPrint(decoy.PublicKey))
+	if real.Algorithm == decoy.Algorithm {
+		score += decoyAlgorithmWeight
+	}
+	return score
+}
+
+// hammingDistance returns the fraction of bits that differ between a and b,
+// counting every bit of the longer key's extra bytes as different. Two empty
+// keys are identical.
+func hammingDistance(a, b []byte) float64 {
+	longest := maxInt(len(a), len(b))
+	if longest == 0 {
+		return 0
+	}
+
+	differing := 8 * (longest - minInt(len(a), len(b)))
+	for i := 0; i < minInt(len(a), len(b)); i++ {
+		differing += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return float64(differing) / float64(8*longest)
+}
+
+// fingerprintPrefixSimilarity returns the fraction of hex characters at the
+// start of two fingerprints that match, ignoring the separating colons
+func fingerprintPrefixSimilarity(a, b string) float64 {
+	a = strings.ReplaceAll(a, ":", "")
+	b = strings.ReplaceAll(b, ":", "")
+	longest := maxInt(len(a), len(b))
+	if longest == 0 {
+		return 0
+	}
+
+	matching := 0
+	for matching < minInt(len(a), len(b)) && a[matching] == b[matching] {
+		matching++
+	}
+	return float64(matching) / float64(longest)
+}
+
+// minInt returns the smaller of a and b. The package still builds for Go
+// versions without the min and max builtins.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger of a and b
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
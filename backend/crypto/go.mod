@@ -1 +1,7 @@
- 
\ No newline at end of file
+module github.com/pqcd/backend/crypto
+
+go 1.22
+
+require golang.org/x/crypto v0.32.0
+
+require golang.org/x/sys v0.29.0 // indirect
@@ -1,6 +1,8 @@
 package crypto
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -8,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
 )
 
 // IMPORTANT NOTE: This is a functional implementation of post-quantum cryptography that simulates
@@ -39,10 +42,14 @@ const (
 	KyberPrivateKeySize = 2400 // Kyber-768 private key size
 	KyberCiphertextSize = 1088 // Kyber-768 ciphertext size
 	KyberSharedKeySize  = 32   // Kyber-768 shared key size
+	gcmNonceSize        = 12   // AES-GCM standard nonce size
+	gcmTagSize          = 16   // AES-GCM authentication tag size
 	SaberPublicKeySize  = 992  // Placeholder, not implemented
 	SaberPrivateKeySize = 2304 // Placeholder, not implemented
 	NTRUPublicKeySize   = 699  // Placeholder, not implemented
 	NTRUPrivateKeySize  = 935  // Placeholder, not implemented
+	DilithiumPublicKeySize  = 1312 // Dilithium2 public key size
+	DilithiumPrivateKeySize = 2528 // Dilithium2 private key size
 )
 
 // KeyPair represents a post-quantum keypair
@@ -75,8 +82,8 @@ func GenerateKeyPair(algorithm string) (*KeyPair, error) {
 		privKeySize = NTRUPrivateKeySize
 	case AlgoDilithium:
 		// Dilithium is a signature scheme, but we'll simulate it for consistency
-		pubKeySize = 1312
-		privKeySize = 2528
+		pubKeySize = DilithiumPublicKeySize
+		privKeySize = DilithiumPrivateKeySize
 	default:
 		// Fall back to Kyber
 		pubKeySize = KyberPublicKeySize
@@ -87,6 +94,7 @@ func GenerateKeyPair(algorithm string) (*KeyPair, error) {
 	// Generate random private key
 	privateKey := make([]byte, privKeySize)
 	if _, err := io.ReadFull(rand.Reader, privateKey); err != nil {
+		ZeroBytes(privateKey)
 		return nil, fmt.Errorf("failed to generate private key: %w", err)
 	}
 	
@@ -102,6 +110,22 @@ func GenerateKeyPair(algorithm string) (*KeyPair, error) {
 	}, nil
 }
 
+// KeySizes returns the expected public and private key sizes for an algorithm
+func KeySizes(algorithm string) (publicKeySize, privateKeySize int, err error) {
+	switch algorithm {
+	case AlgoKyber:
+		return KyberPublicKeySize, KyberPrivateKeySize, nil
+	case AlgoSaber:
+		return SaberPublicKeySize, SaberPrivateKeySize, nil
+	case AlgoNTRU:
+		return NTRUPublicKeySize, NTRUPrivateKeySize, nil
+	case AlgoDilithium:
+		return DilithiumPublicKeySize, DilithiumPrivateKeySize, nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+}
+
 // Helper function to derive a public key from a private key
 // In a real implementation, this would use the actual post-quantum algorithm
 func derivePublicKey(privateKey []byte, size int) []byte {
@@ -136,16 +160,9 @@ func Encrypt(data []byte, publicKey []byte, algorithm string) (*EncryptedData, e
 		return nil, errors.New("cannot encrypt empty data")
 	}
 	
-	// Generate a random shared secret (in a real implementation, this would be derived using the actual algorithm)
-	sharedSecret := make([]byte, KyberSharedKeySize)
-	if _, err := io.ReadFull(rand.Reader, sharedSecret); err != nil {
-		return nil, fmt.Errorf("failed to generate shared secret: %w", err)
-	}
-	
-	// Generate a fake encapsulation (in a real implementation, this would be the actual encapsulation)
-	encapsulation := make([]byte, KyberCiphertextSize)
-	if _, err := io.ReadFull(rand.Reader, encapsulation); err != nil {
-		return nil, fmt.Errorf("failed to generate encapsulation: %w", err)
+	sharedSecret, encapsulation, err := encapsulate()
+	if err != nil {
+		return nil, err
 	}
 	
 	// Generate a nonce
@@ -154,18 +171,12 @@ func Encrypt(data []byte, publicKey []byte, algorithm string) (*EncryptedData, e
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 	
-	// Create a key stream from the shared secret and nonce
-	keyStream := deriveKeyStream(sharedSecret, nonce, len(data))
-	
-	// Encrypt the data
-	ciphertext := make([]byte, len(data))
-	for i := range data {
-		ciphertext[i] = data[i] ^ keyStream[i]
+	// Encrypt the data with AES-256-GCM, authenticating the encapsulation as well
+	gcm, err := newEncryptionGCM(sharedSecret)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Store the shared secret in the encapsulation (in a real implementation, this would not be done)
-	// This is just for our simulation to allow decryption to work
-	copy(encapsulation, sharedSecret)
+	ciphertext := gcm.Seal(nil, gcmNonce(nonce), data, encapsulation)
 	
 	// Combine the encapsulation and ciphertext
 	finalCiphertext := append(encapsulation, ciphertext...)
@@ -183,60 +194,98 @@ func Decrypt(encrypted *EncryptedData, privateKey []byte) ([]byte, error) {
 		return nil, errors.New("cannot decrypt empty data")
 	}
 	
-	// Check if the ciphertext is long enough to contain the encapsulation
-	if len(encrypted.Ciphertext) <= KyberCiphertextSize {
-		return nil, errors.New("ciphertext too short")
+	// The ciphertext must hold a whole encapsulation and a GCM tag, or the
+	// split below would decapsulate a truncated encapsulation
+	if minSize := KyberCiphertextSize + gcmTagSize; len(encrypted.Ciphertext) < minSize {
+		return nil, fmt.Errorf("ciphertext too short: expected at least %d bytes, got %d", minSize, len(encrypted.Ciphertext))
 	}
 	
 	// Extract the encapsulation and actual ciphertext
 	encapsulation := encrypted.Ciphertext[:KyberCiphertextSize]
 	actualCiphertext := encrypted.Ciphertext[KyberCiphertextSize:]
 	
-	// Extract the shared secret from the encapsulation (in a real implementation, this would be derived using the actual algorithm)
-	// This is just for our simulation
-	sharedSecret := encapsulation[:KyberSharedKeySize]
+	sharedSecret := decapsulate(encapsulation)
 	
-	// Create a key stream from the shared secret and nonce
-	keyStream := deriveKeyStream(sharedSecret, encrypted.Nonce, len(actualCiphertext))
+	if len(encrypted.Nonce) < gcmNonceSize {
+		return nil, fmt.Errorf("nonce too short: expected at least %d bytes, got %d", gcmNonceSize, len(encrypted.Nonce))
+	}
 	
-	// Decrypt the data
-	plaintext := make([]byte, len(actualCiphertext))
-	for i := range actualCiphertext {
-		plaintext[i] = actualCiphertext[i] ^ keyStream[i]
+	// Decrypt and authenticate the data
+	gcm, err := newEncryptionGCM(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, gcmNonce(encrypted.Nonce), actualCiphertext, encapsulation)
+	if err != nil {
+		return nil, errors.New("authentication failed: ciphertext or nonce has been tampered with")
 	}
 	
 	return plaintext, nil
 }
 
-// Helper function to derive a key stream from a key and nonce
-func deriveKeyStream(key, nonce []byte, length int) []byte {
-	keyStream := make([]byte, length)
+// encapsulate returns a fresh shared secret and its KEM encapsulation
+func encapsulate() (sharedSecret, encapsulation []byte, err error) {
+	// Generate a random shared secret (in a real implementation, this would be derived using the actual algorithm)
+	sharedSecret = make([]byte, KyberSharedKeySize)
+	if _, err := io.ReadFull(rand.Reader, sharedSecret); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate shared secret: %w", err)
+	}
 	
-	// Use SHA-256 to create a key stream
-	h := sha256.New()
-	h.Write(key)
-	h.Write(nonce)
-	seed := h.Sum(nil)
+	// Generate a fake encapsulation (in a real implementation, this would be the actual encapsulation)
+	encapsulation = make([]byte, KyberCiphertextSize)
+	if _, err := io.ReadFull(rand.Reader, encapsulation); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate encapsulation: %w", err)
+	}
 	
-	// Expand the seed to the required length
-	for i := 0; i < length; i += sha256.Size {
-		h := sha256.New()
-		h.Write(seed)
-		h.Write([]byte{byte(i / 256), byte(i % 256)})  // Counter
-		digest := h.Sum(nil)
-		
-		// Copy as much as needed
-		n := copy(keyStream[i:], digest)
-		if n < len(digest) {
-			break
-		}
+	// Store the shared secret in the encapsulation (in a real implementation, this would not be done)
+	// This is just for our simulation to allow decryption to work
+	copy(encapsulation, sharedSecret)
+	
+	return sharedSecret, encapsulation, nil
+}
+
+// decapsulate recovers the shared secret from a KyberCiphertextSize encapsulation
+func decapsulate(encapsulation []byte) []byte {
+	// Extract the shared secret from the encapsulation (in a real implementation, this would be derived using the actual algorithm)
+	// This is just for our simulation
+	return encapsulation[:KyberSharedKeySize]
+}
+
+// Helper function to create an AES-256-GCM cipher from a 32-byte key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
 	}
 	
-	return keyStream
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	
+	return gcm, nil
+}
+
+// Helper function to create the AES-256-GCM cipher for a KEM shared secret,
+// keyed with SHAKE-256 rather than with the secret itself
+func newEncryptionGCM(sharedSecret []byte) (cipher.AEAD, error) {
+	key, err := DeriveKeyShake256(sharedSecret, []byte(encryptionKeyContext), 32)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(key)
+	return newGCM(key)
+}
+
+// Helper function to truncate the 24-byte nonce to the 12 bytes required by GCM
+func gcmNonce(nonce []byte) []byte {
+	return nonce[:gcmNonceSize]
 }
 
-// GenerateCognitiveDecoyKeys generates a set of decoy keys that appear similar to real keys
-func GenerateCognitiveDecoyKeys(realKey *KeyPair, count int) ([]*KeyPair, error) {
+// GenerateCognitiveDecoyKeys generates a set of decoy keys that appear similar
+// to real keys, each differing from it in about targetHammingFraction of its
+// bits (see SimilarityTunedDecoy)
+func GenerateCognitiveDecoyKeys(realKey *KeyPair, count int, targetHammingFraction float64) ([]*KeyPair, error) {
 	if count < 1 {
 		return nil, errors.New("count must be positive")
 	}
@@ -244,42 +293,39 @@ func GenerateCognitiveDecoyKeys(realKey *KeyPair, count int) ([]*KeyPair, error)
 	decoys := make([]*KeyPair, count)
 	
 	for i := 0; i < count; i++ {
-		// Create a key that looks similar to the real one but is different
-		decoyPriv := make([]byte, len(realKey.PrivateKey))
-		
-		// Start with a copy of the real private key
-		copy(decoyPriv, realKey.PrivateKey)
-		
-		// Modify several bytes to make it distinct
-		seed := 100 + i  // Use a different seed for each decoy
-		modifyBytes(decoyPriv, seed)
-		
-		// Generate the public key from the modified private key
-		decoyPub := derivePublicKey(decoyPriv, len(realKey.PublicKey))
-		
-		decoys[i] = &KeyPair{
-			PublicKey:  decoyPub,
-			PrivateKey: decoyPriv,
-			Algorithm:  realKey.Algorithm,
+		decoy, err := SimilarityTunedDecoy(realKey, targetHammingFraction, rand.Reader)
+		if err != nil {
+			for _, generated := range decoys[:i] {
+				ZeroBytes(generated.PrivateKey)
+			}
+			return nil, err
 		}
+		decoys[i] = decoy
 	}
 	
 	return decoys, nil
 }
 
-// Helper function to modify bytes in a buffer
-func modifyBytes(buffer []byte, seed int) {
-	// Modify at least 20 bytes to ensure significant difference
-	numModifications := 20 + (seed % 10)
+// FingerPrint generates a fingerprint of a key as the full SHA-256 hash
+// in colon-separated hex pairs (ab:cd:ef:...), as used for SSH keys
+func FingerPrint(key []byte) string {
+	if len(key) == 0 {
+		return ""
+	}
 	
-	for i := 0; i < numModifications; i++ {
-		pos := (seed*i + i*i) % len(buffer)
-		buffer[pos] = buffer[pos] ^ 0xFF  // Flip bits
+	// Hash the entire key for the fingerprint
+	hash := sha256.Sum256(key)
+	
+	pairs := make([]string, len(hash))
+	for i, b := range hash {
+		pairs[i] = hex.EncodeToString([]byte{b})
 	}
+	return strings.Join(pairs, ":")
 }
 
-// FingerPrint generates a fingerprint of a key
-func FingerPrint(key []byte) string {
+// FingerPrintShort generates the legacy fingerprint of a key: the first
+// 16 bytes of its SHA-256 hash as plain hex
+func FingerPrintShort(key []byte) string {
 	if len(key) == 0 {
 		return ""
 	}
@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// DefaultDecoyHammingFraction is the fraction of bits decoys differ from their
+// real key in when no other target is requested. Lower fractions make each
+// decoy harder to tell from the real key, but decoys that all stay close to it
+// also give away its bits when compared with each other.
+const DefaultDecoyHammingFraction = 0.25
+
+// similarityTolerance is how far, relative to the target, the Hamming distance
+// of a tuned decoy may be from the one requested
+const similarityTolerance = 0.05
+
+// SimilarityTunedDecoy returns a decoy of real whose keys differ from the real
+// ones in about targetHammingFraction of their bits, within ±5% of the target.
+// The bits to flip are drawn at random from rng, so decoys of the same key share
+// no pattern, and the number of flips is found by binary search. Random flips
+// leave half the bits differing at most, so the target must be in (0, 0.5].
+func SimilarityTunedDecoy(real *KeyPair, targetHammingFraction float64, rng io.Reader) (*KeyPair, error) {
+	if real == nil || len(real.PublicKey) == 0 || len(real.PrivateKey) == 0 {
+		return nil, errors.New("real key pair must have both keys")
+	}
+	if !(targetHammingFraction > 0 && targetHammingFraction <= 0.5) {
+		return nil, fmt.Errorf("target Hamming fraction must be in (0, 0.5], got %g", targetHammingFraction)
+	}
+
+	publicKey, err := tuneHammingDistance(real.PublicKey, targetHammingFraction, rng)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tune decoy public key: %w", err)
+	}
+	privateKey, err := tuneHammingDistance(real.PrivateKey, targetHammingFraction, rng)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tune decoy private key: %w", err)
+	}
+
+	return &KeyPair{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Algorithm:  real.Algorithm,
+	}, nil
+}
+
+// tuneHammingDistance returns a copy of key with random bits flipped until it
+// differs from key in fraction of its bits. Bits are drawn with replacement,
+// so a bit flipped twice is back where it started and the distance grows ever
+// more slowly with the number of flips. The search runs over prefixes of one
+// random sequence of bits, along which the distance moves one bit at a time.
+func tuneHammingDistance(key []byte, fraction float64, rng io.Reader) ([]byte, error) {
+	size := 8 * len(key)
+	target := math.Max(1, math.Round(fraction*float64(size)))
+	tolerance := math.Max(1, similarityTolerance*target)
+
+	positions, err := randomBitPositions(rng, size, maxFlips(size, fraction))
+	if err != nil {
+		return nil, err
+	}
+
+	tuned := make([]byte, len(key))
+	for lo, hi := 0, len(positions); lo <= hi; {
+		flips := (lo + hi) / 2
+		copy(tuned, key)
+		for _, pos := range positions[:flips] {
+			tuned[pos/8] ^= 1 << (pos % 8)
+		}
+
+		distance := float64(differingBits(key, tuned))
+		if distance > 0 && math.Abs(distance-target) <= tolerance {
+			return tuned, nil
+		}
+		if distance < target {
+			lo = flips + 1
+		} else {
+			hi = flips - 1
+		}
+	}
+
+	ZeroBytes(tuned)
+	return nil, fmt.Errorf("no number of flips reached %.0f of %d bits", target, size)
+}
+
+// maxFlips bounds the search for a fraction of bits: twice the number of
+// random flips expected to reach it, or four times the bits for fractions so
+// close to 0.5 that the expectation only gets there in the limit
+func maxFlips(size int, fraction float64) int {
+	limit := 4 * size
+	if size < 2 || fraction >= 0.5 {
+		return limit
+	}
+	expected := math.Log(1-2*fraction) / math.Log(1-2/float64(size))
+	return int(math.Min(float64(limit), 2*expected+64))
+}
+
+// randomBitPositions reads n positions below size from rng
+func randomBitPositions(rng io.Reader, size, n int) ([]int, error) {
+	buf := make([]byte, 4*n)
+	if _, err := io.ReadFull(rng, buf); err != nil {
+		return nil, fmt.Errorf("failed to read random bits: %w", err)
+	}
+
+	positions := make([]int, n)
+	for i := range positions {
+		positions[i] = int(binary.BigEndian.Uint32(buf[4*i:]) % uint32(size))
+	}
+	return positions, nil
+}
+
+// differingBits counts the bits that differ between two keys of equal length
+func differingBits(a, b []byte) int {
+	differing := 0
+	for i := range a {
+		differing += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return differing
+}
@@ -0,0 +1,60 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// storageKeyInfo binds keys derived for private key storage to that purpose
+const storageKeyInfo = "pqcd key_pairs private_key v1"
+
+// KeyEncryptor encrypts private keys before they are written to the database.
+// It uses AES-256-GCM with a key derived from a master secret via HKDF-SHA256.
+type KeyEncryptor struct {
+	gcm cipher.AEAD
+}
+
+// NewKeyEncryptor derives the storage key from masterKey
+func NewKeyEncryptor(masterKey string) (*KeyEncryptor, error) {
+	if masterKey == "" {
+		return nil, errors.New("master key must not be empty")
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(masterKey), nil, []byte(storageKeyInfo)), key); err != nil {
+		return nil, fmt.Errorf("failed to derive storage key: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyEncryptor{gcm: gcm}, nil
+}
+
+// EncryptForStorage returns nonce || ciphertext || tag for a private key
+func (e *KeyEncryptor) EncryptForStorage(privKey []byte) ([]byte, error) {
+	nonce := make([]byte, e.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return e.gcm.Seal(nonce, nonce, privKey, nil), nil
+}
+
+// DecryptFromStorage reverses EncryptForStorage
+func (e *KeyEncryptor) DecryptFromStorage(blob []byte) ([]byte, error) {
+	nonceSize := e.gcm.NonceSize()
+	if len(blob) < nonceSize+e.gcm.Overhead() {
+		return nil, errors.New("stored key is too short")
+	}
+	privKey, err := e.gcm.Open(nil, blob[:nonceSize], blob[nonceSize:], nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt stored key: wrong master key or corrupted data")
+	}
+	return privKey, nil
+}
@@ -0,0 +1,177 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamChunkSize is the most plaintext EncryptStream seals into one frame
+const StreamChunkSize = 64 << 10
+
+// Every frame of a stream starts with its length as a big-endian uint32
+const frameHeaderSize = 4
+
+// A data frame starts with a flag byte, set on the final chunk, and the nonce
+const chunkHeaderSize = 1 + gcmNonceSize
+
+// maxStreamFrameSize bounds a data frame: its header, a full chunk and the GCM tag
+const maxStreamFrameSize = chunkHeaderSize + StreamChunkSize + 16
+
+// EncryptStream encrypts plaintext read from r and writes it to w as a series
+// of length-prefixed frames. The first frame holds the KEM encapsulation of a
+// fresh shared secret. Each following frame holds a final-chunk flag, a random
+// nonce and one chunk of up to StreamChunkSize bytes sealed with AES-256-GCM
+// under that secret. The chunk's position and flag are authenticated, so frames
+// can't be reordered, dropped or cut off without DecryptStream noticing. If w
+// is an http.Flusher each frame is flushed as soon as it is written.
+func EncryptStream(w io.Writer, r io.Reader, publicKey []byte, algorithm string) error {
+	if _, _, err := KeySizes(algorithm); err != nil {
+		return err
+	}
+
+	sharedSecret, encapsulation, err := encapsulate()
+	if err != nil {
+		return err
+	}
+	defer ZeroBytes(sharedSecret)
+	gcm, err := newEncryptionGCM(sharedSecret)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFrame(w, encapsulation); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, StreamChunkSize)
+	frame := make([]byte, 0, maxStreamFrameSize)
+	for index := uint64(0); ; index++ {
+		// A short read ends the stream. A payload filling its last chunk exactly
+		// is followed by an empty final chunk.
+		n, err := io.ReadFull(r, chunk)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return fmt.Errorf("failed to read plaintext: %w", err)
+		}
+
+		frame = frame[:chunkHeaderSize]
+		frame[0] = 0
+		if final {
+			frame[0] = 1
+		}
+		nonce := frame[1:]
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		frame = gcm.Seal(frame, nonce, chunk[:n], chunkAdditionalData(index, frame[0]))
+		if err := writeFrame(w, frame); err != nil {
+			return err
+		}
+		if final {
+			ZeroBytes(chunk)
+			return nil
+		}
+	}
+}
+
+// DecryptStream reverses EncryptStream, writing the plaintext of each frame
+// read from r to w as soon as it has been authenticated. An error after the
+// first chunk leaves the chunks before it written to w.
+func DecryptStream(w io.Writer, r io.Reader, privateKey []byte) error {
+	encapsulation, err := readFrame(r, KyberCiphertextSize)
+	if err != nil {
+		return fmt.Errorf("failed to read encapsulation: %w", err)
+	}
+	if len(encapsulation) != KyberCiphertextSize {
+		return fmt.Errorf("encapsulation must be %d bytes, got %d", KyberCiphertextSize, len(encapsulation))
+	}
+	gcm, err := newEncryptionGCM(decapsulate(encapsulation))
+	if err != nil {
+		return err
+	}
+
+	for index := uint64(0); ; index++ {
+		frame, err := readFrame(r, maxStreamFrameSize)
+		if err == io.EOF {
+			return errors.New("stream ended before its final chunk")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read chunk %d: %w", index, err)
+		}
+		if len(frame) < chunkHeaderSize+gcm.Overhead() || frame[0] > 1 {
+			return fmt.Errorf("chunk %d is malformed", index)
+		}
+
+		flag, nonce, ciphertext := frame[0], frame[1:chunkHeaderSize], frame[chunkHeaderSize:]
+		plaintext, err := gcm.Open(ciphertext[:0], nonce, ciphertext, chunkAdditionalData(index, flag))
+		if err != nil {
+			return fmt.Errorf("authentication failed on chunk %d: ciphertext has been tampered with", index)
+		}
+
+		if _, err := w.Write(plaintext); err != nil {
+			return fmt.Errorf("failed to write plaintext: %w", err)
+		}
+		flush(w)
+		if flag == 1 {
+			if _, err := io.ReadFull(r, make([]byte, 1)); err != io.EOF {
+				return errors.New("data follows the final chunk")
+			}
+			return nil
+		}
+	}
+}
+
+// chunkAdditionalData binds a chunk to its position in the stream and to its
+// final-chunk flag
+func chunkAdditionalData(index uint64, flag byte) []byte {
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint64(data, index)
+	data[8] = flag
+	return data
+}
+
+// writeFrame writes payload prefixed with its length
+func writeFrame(w io.Writer, payload []byte) error {
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	flush(w)
+	return nil
+}
+
+// readFrame reads one length-prefixed frame of at most limit bytes. It
+// returns io.EOF only if r ends before the frame starts.
+func readFrame(r io.Reader, limit int) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("truncated frame header")
+		}
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if int64(length) > int64(limit) {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the %d byte limit", length, limit)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("truncated frame: %w", err)
+	}
+	return payload, nil
+}
+
+// flush sends buffered output on to the client if w supports it, so a
+// streamed HTTP response goes out frame by frame
+func flush(w io.Writer) {
+	if f, ok := w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,12 @@
+package crypto
+
+import "runtime"
+
+// ZeroBytes overwrites b with zeros, like ZeroBytes in the server's crypto
+// package
+func ZeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
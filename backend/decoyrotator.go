@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pqcd/backend/crypto"
+)
+
+// decoyKeyGenerator generates a key pair for an algorithm, as crypto.GenerateKeyPair does
+type decoyKeyGenerator func(algorithm string) (*crypto.KeyPair, error)
+
+// DecoyRotatorStatus reports the rotator's most recent run
+type DecoyRotatorStatus struct {
+	Enabled      bool       `json:"enabled"`
+	IntervalS    int64      `json:"interval_s"`
+	LastRun      *time.Time `json:"last_run"`
+	Rotated      int        `json:"rotated"`
+	TotalRotated int        `json:"total_rotated"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// DecoyRotator replaces decoy keys before attackers who catalogue them can
+// learn to recognise them. Every interval it replaces the decoys older than
+// twice the interval with fresh keys of the same algorithm and soft-deletes
+// the old ones by setting deleted_at and superseded_by.
+type DecoyRotator struct {
+	mu     sync.Mutex
+	status DecoyRotatorStatus
+}
+
+// decoyRotator is the rotator started by main and reported on by
+// /api/admin/decoy-rotator/status
+var decoyRotator = &DecoyRotator{}
+
+// Start rotates decoys in db every interval, generating replacements with
+// keyGen, until the returned channel is closed
+func (d *DecoyRotator) Start(db *sql.DB, keyGen decoyKeyGenerator, interval time.Duration) chan<- struct{} {
+	d.mu.Lock()
+	d.status.Enabled = true
+	d.status.IntervalS = int64(interval / time.Second)
+	d.mu.Unlock()
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.Run(db, keyGen, 2*interval, time.Now())
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return stop
+}
+
+// Run rotates the decoys older than maxAge at now once and records the
+// outcome for Status
+func (d *DecoyRotator) Run(db *sql.DB, keyGen decoyKeyGenerator, maxAge time.Duration, now time.Time) (int, error) {
+	rotated, err := rotateDecoys(db, keyGen, now.Add(-maxAge), now)
+	if err != nil {
+		log.Printf("Failed to rotate decoys: %v", err)
+	} else if rotated > 0 {
+		log.Printf("Rotated %d decoy keys", rotated)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lastRun := now.UTC()
+	d.status.LastRun = &lastRun
+	d.status.Rotated = rotated
+	d.status.TotalRotated += rotated
+	d.status.LastError = ""
+	if err != nil {
+		d.status.LastError = err.Error()
+	}
+	return rotated, err
+}
+
+// Status returns the outcome of the most recent run
+func (d *DecoyRotator) Status() DecoyRotatorStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := d.status
+	if status.LastRun != nil {
+		lastRun := *status.LastRun
+		status.LastRun = &lastRun
+	}
+	return status
+}
+
+// staleDecoy is a decoy key due for rotation
+type staleDecoy struct {
+	id        int64
+	algorithm string
+}
+
+// rotateDecoys replaces every live decoy created before cutoff, returning how
+// many were replaced. Each replacement is its own transaction, so a failure
+// part way leaves the decoys rotated so far in place.
+func rotateDecoys(db *sql.DB, keyGen decoyKeyGenerator, cutoff, now time.Time) (int, error) {
+	stale, err := listStaleDecoys(db, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	rotated := 0
+	for _, decoy := range stale {
+		if err := rotateDecoy(db, keyGen, decoy, now); err != nil {
+			return rotated, fmt.Errorf("failed to rotate decoy key %d: %w", decoy.id, err)
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// listStaleDecoys returns the live decoys created before cutoff
+func listStaleDecoys(db *sql.DB, cutoff time.Time) ([]staleDecoy, error) {
+	ctx, cancel := dbContext(context.Background())
+	defer cancel()
+	rows, err := db.QueryContext(ctx,
+		"SELECT id, algorithm FROM key_pairs WHERE is_real = 0 AND deleted_at IS NULL AND created_at < ? ORDER BY id",
+		cutoff.UTC().Format(sqliteTimestampFormat),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale decoys: %w", err)
+	}
+	defer rows.Close()
+
+	var stale []staleDecoy
+	for rows.Next() {
+		var decoy staleDecoy
+		if err := rows.Scan(&decoy.id, &decoy.algorithm); err != nil {
+			return nil, fmt.Errorf("failed to read stale decoy: %w", err)
+		}
+		stale = append(stale, decoy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stale decoys: %w", err)
+	}
+	return stale, nil
+}
+
+// rotateDecoy stores a fresh decoy with the same algorithm and expiry as the
+// stale one, soft-deletes the stale one and logs the rotation. The fresh decoy
+// isn't derived from a real key, so it has no effectiveness score.
+func rotateDecoy(db *sql.DB, keyGen decoyKeyGenerator, decoy staleDecoy, now time.Time) error {
+	keyPair, err := keyGen(decoy.algorithm)
+	if err != nil {
+		return fmt.Errorf("failed to generate replacement: %w", err)
+	}
+	storedKey, err := keyEncryptor.EncryptForStorage(keyPair.PrivateKey)
+	crypto.ZeroBytes(keyPair.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt replacement: %w", err)
+	}
+
+	ctx, cancel := dbContext(context.Background())
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		// expires_at is copied as stored so it keeps comparing as text, and the
+		// replacement stands in for the same real key
+		`INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real, expires_at, origin_fingerprint)
+		SELECT ?, ?, ?, ?, 0, expires_at, origin_fingerprint FROM key_pairs WHERE id = ?`,
+		keyPair.PublicKey, storedKey, crypto.FingerPrint(keyPair.PublicKey), keyPair.Algorithm, decoy.id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store replacement: %w", err)
+	}
+	replacementID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to read replacement id: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE key_pairs SET deleted_at = ?, superseded_by = ? WHERE id = ?",
+		now.UTC().Format(sqliteTimestampFormat), replacementID, decoy.id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to retire decoy: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO event_logs (event_type, description, severity, related_item_id, related_item_type) VALUES (?, ?, ?, ?, ?)",
+		"decoy_rotation", fmt.Sprintf("Rotated decoy key %d, replaced by %d", decoy.id, replacementID), "INFO", replacementID, "key_pair",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log rotation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rotation: %w", err)
+	}
+	return nil
+}
+
+// Decoy rotator status handler. Reports when the rotator last ran and how
+// many decoys it replaced.
+func decoyRotatorStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decoyRotator.Status())
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decoys per page of history when none is requested, and the most allowed
+const (
+	defaultDecoysPerPage = 50
+	maxDecoysPerPage     = 200
+)
+
+// DecoyRecord is a stored decoy. EffectivenessScore is null until the decoy
+// has been scored.
+type DecoyRecord struct {
+	ID                 int64     `json:"id"`
+	DecoyText          string    `json:"decoy_text"`
+	TargetText         string    `json:"target_text"`
+	Complexity         int       `json:"complexity"`
+	CreatedAt          time.Time `json:"created_at"`
+	EffectivenessScore *float64  `json:"effectiveness_score"`
+}
+
+// DecoyListResponse is a page of stored decoys. Total counts every decoy
+// matching the filters, not just those on the page.
+type DecoyListResponse struct {
+	Decoys []DecoyRecord `json:"decoys"`
+	Total  int           `json:"total"`
+}
+
+// EffectivenessRequest scores how well a decoy worked, from 0 to 1
+type EffectivenessRequest struct {
+	EffectivenessScore *float64 `json:"effectiveness_score"`
+}
+
+// Decoy history handler. Lists stored decoys, newest first, filtered by the
+// target, complexity and from/to query parameters and paged with page and
+// per_page.
+func listDecoysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var where []string
+	var args []interface{}
+
+	if target := query.Get("target"); target != "" {
+		where = append(where, "target_text = ?")
+		args = append(args, target)
+	}
+	for _, bound := range []struct {
+		param, clause string
+	}{
+		{"min_complexity", "complexity >= ?"},
+		{"max_complexity", "complexity <= ?"},
+	} {
+		if v := query.Get(bound.param); v != "" {
+			complexity, err := strconv.Atoi(v)
+			if err != nil {
+				sendErrorResponse(w, "Invalid "+bound.param, http.StatusBadRequest, bound.param+" must be an integer")
+				return
+			}
+			where = append(where, bound.clause)
+			args = append(args, complexity)
+		}
+	}
+	for _, bound := range []struct {
+		param, clause string
+	}{
+		{"from", "created_at >= ?"},
+		{"to", "created_at <= ?"},
+	} {
+		if v := query.Get(bound.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				sendErrorResponse(w, "Invalid "+bound.param+" timestamp", http.StatusBadRequest, err.Error())
+				return
+			}
+			where = append(where, bound.clause)
+			args = append(args, t.UTC().Format(sqliteTimestampFormat))
+		}
+	}
+
+	page, err := positiveParam(query.Get("page"), 1)
+	if err != nil {
+		sendErrorResponse(w, "Invalid page", http.StatusBadRequest, "page must be a positive integer")
+		return
+	}
+	perPage, err := positiveParam(query.Get("per_page"), defaultDecoysPerPage)
+	if err != nil || perPage > maxDecoysPerPage {
+		sendErrorResponse(w, "Invalid per_page", http.StatusBadRequest, fmt.Sprintf("per_page must be between 1 and %d", maxDecoysPerPage))
+		return
+	}
+
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	ctx, cancel := dbContext(r.Context())
+	defer cancel()
+	response := DecoyListResponse{Decoys: []DecoyRecord{}}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM decoys"+filter, args...).Scan(&response.Total); err != nil {
+		sendErrorResponse(w, "Failed to count decoys", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, err := db.QueryContext(ctx,
+		"SELECT id, decoy_text, target_text, complexity, created_at, effectiveness_score FROM decoys"+filter+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, perPage, (page-1)*perPage)...,
+	)
+	if err != nil {
+		sendErrorResponse(w, "Failed to list decoys", http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		record, err := scanDecoy(rows)
+		if err != nil {
+			sendErrorResponse(w, "Failed to list decoys", http.StatusInternalServerError, err.Error())
+			return
+		}
+		response.Decoys = append(response.Decoys, record)
+	}
+	if err := rows.Err(); err != nil {
+		sendErrorResponse(w, "Failed to list decoys", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Decoy effectiveness handler. Records how well a decoy worked, on PUT
+// /api/decoys/{id}/effectiveness, and returns the updated decoy.
+func decoyEffectivenessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idText, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/decoys/"), "/effectiveness")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if !ok || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req EffectivenessRequest
+	if !decodeJSONBody(w, r, maxKeyRequestBytes, &req) {
+		return
+	}
+	if req.EffectivenessScore == nil || *req.EffectivenessScore < 0 || *req.EffectivenessScore > 1 {
+		sendErrorResponse(w, "Invalid effectiveness score", http.StatusBadRequest, "effectiveness_score must be between 0 and 1")
+		return
+	}
+
+	ctx, cancel := dbContext(r.Context())
+	defer cancel()
+	result, err := db.ExecContext(ctx, "UPDATE decoys SET effectiveness_score = ? WHERE id = ?", *req.EffectivenessScore, id)
+	if err != nil {
+		sendErrorResponse(w, "Failed to update decoy", http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		sendErrorResponse(w, "Decoy not found", http.StatusNotFound, "")
+		return
+	}
+
+	record, err := scanDecoy(db.QueryRowContext(ctx,
+		"SELECT id, decoy_text, target_text, complexity, created_at, effectiveness_score FROM decoys WHERE id = ?", id,
+	))
+	if err != nil {
+		sendErrorResponse(w, "Failed to load decoy", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// scanDecoy reads a decoy row selected in DecoyRecord field order
+func scanDecoy(row interface{ Scan(...interface{}) error }) (DecoyRecord, error) {
+	var record DecoyRecord
+	var score sql.NullFloat64
+	if err := row.Scan(&record.ID, &record.DecoyText, &record.TargetText, &record.Complexity, &record.CreatedAt, &score); err != nil {
+		return record, fmt.Errorf("failed to scan decoy: %w", err)
+	}
+	if score.Valid {
+		record.EffectivenessScore = &score.Float64
+	}
+	return record, nil
+}
+
+// positiveParam parses an optional positive integer query parameter
+func positiveParam(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid positive integer: %q", value)
+	}
+	return n, nil
+}
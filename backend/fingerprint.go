@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// minFingerprintPrefix is the shortest prefix accepted by the fingerprint lookup
+const minFingerprintPrefix = 2
+
+// FingerprintMatch is a stored key whose fingerprint matches a lookup. Whether
+// the key is real is left out so lookups can't be used to pick out decoys.
+type FingerprintMatch struct {
+	ID          int64     `json:"id"`
+	Fingerprint string    `json:"fingerprint"`
+	Algorithm   string    `json:"algorithm"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// uniqueFingerprint returns fingerprint unchanged if no real key already uses it.
+// Otherwise the collision is logged and the first free suffix (-2, -3, ...) is
+// appended.
+func uniqueFingerprint(ctx context.Context, db *sql.DB, fingerprint, sourceIP string) (string, error) {
+	ctx, cancel := dbContext(ctx)
+	defer cancel()
+	rows, err := db.QueryContext(ctx,
+		"SELECT fingerprint FROM key_pairs WHERE is_real = 1 AND (fingerprint = ? OR fingerprint LIKE ?)",
+		fingerprint, fingerprint+"-%",
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to check fingerprint: %w", err)
+	}
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var existing string
+		if err := rows.Scan(&existing); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("failed to scan fingerprint: %w", err)
+		}
+		taken[existing] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to read fingerprints: %w", err)
+	}
+
+	if !taken[fingerprint] {
+		return fingerprint, nil
+	}
+
+	unique := fingerprint
+	for suffix := 2; taken[unique]; suffix++ {
+		unique = fmt.Sprintf("%s-%d", fingerprint, suffix)
+	}
+
+	log.Printf("Fingerprint collision on %s, storing as %s", fingerprint, unique)
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO event_logs (event_type, description, source_ip, severity) VALUES (?, ?, ?, ?)",
+		"fingerprint_collision", fmt.Sprintf("Fingerprint %s already in use, stored as %s", fingerprint, unique), sourceIP, "WARNING",
+	)
+	if err != nil {
+		log.Printf("Failed to log fingerprint collision: %v", err)
+	}
+	return unique, nil
+}
+
+// Fingerprint lookup handler. Returns every stored key whose fingerprint
+// starts with the given prefix, leaving out rotated decoys.
+func fingerprintLookupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	prefix := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/api/keys/fingerprint/"))
+	if len(prefix) < minFingerprintPrefix {
+		sendErrorResponse(w, "Fingerprint prefix is required", http.StatusBadRequest, fmt.Sprintf("prefix must be at least %d characters", minFingerprintPrefix))
+		return
+	}
+	// Fingerprints only contain hex digits, colons and collision suffixes, so
+	// rejecting anything else also keeps LIKE wildcards out of the pattern
+	if strings.Trim(prefix, "0123456789abcdef:-") != "" {
+		sendErrorResponse(w, "Invalid fingerprint prefix", http.StatusBadRequest, "prefix may only contain hex digits, ':' and '-'")
+		return
+	}
+
+	ctx, cancel := dbContext(r.Context())
+	defer cancel()
+	rows, err := db.QueryContext(ctx,
+		"SELECT id, fingerprint, algorithm, created_at FROM key_pairs WHERE fingerprint LIKE ? AND deleted_at IS NULL ORDER BY id",
+		prefix+"%",
+	)
+	if err != nil {
+		sendErrorResponse(w, "Failed to look up fingerprint", http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	matches := []FingerprintMatch{}
+	for rows.Next() {
+		var match FingerprintMatch
+		if err := rows.Scan(&match.ID, &match.Fingerprint, &match.Algorithm, &match.CreatedAt); err != nil {
+			sendErrorResponse(w, "Failed to read key", http.StatusInternalServerError, err.Error())
+			return
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		sendErrorResponse(w, "Failed to read keys", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pqcd/backend/crypto"
+)
+
+// Subsystem statuses reported by /api/health/detailed, from best to worst
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+// healthSlowLatency is how long the database or AI service may take to answer
+// before it is reported as degraded
+const healthSlowLatency = time.Second
+
+// aiHealthTimeout bounds the AI service health check
+const aiHealthTimeout = 2 * time.Second
+
+// healthAlgorithms are the algorithms the crypto check generates a key with
+var healthAlgorithms = []string{crypto.AlgoKyber, crypto.AlgoSaber, crypto.AlgoNTRU, crypto.AlgoDilithium}
+
+// healthKeyGen generates the crypto check's keys, replaced by tests
+var healthKeyGen = crypto.GenerateKeyPair
+
+// SubsystemHealth is the outcome of checking one subsystem
+type SubsystemHealth struct {
+	Status  string  `json:"status"`
+	Latency float64 `json:"latency_ms"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// DetailedHealthResponse reports each subsystem and the worst of their
+// statuses
+type DetailedHealthResponse struct {
+	Status     string                     `json:"status"`
+	Subsystems map[string]SubsystemHealth `json:"subsystems"`
+	Timestamp  time.Time                  `json:"timestamp"`
+}
+
+// healthCheck checks one subsystem, returning its status and the error behind
+// anything short of ok
+type healthCheck func(ctx context.Context) (string, error)
+
+// detailedHealthHandler checks the database, the AI service, key generation
+// with every algorithm and the size of the database file, all at once. It
+// answers 503 if any subsystem is down and 200 otherwise.
+func detailedHealthHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]healthCheck{
+		"database":   checkDatabaseHealth,
+		"ai_service": checkAIServiceHealth,
+		"crypto":     checkCryptoHealth,
+		"disk":       checkDiskHealth,
+	}
+
+	response := DetailedHealthResponse{
+		Status:     healthOK,
+		Subsystems: make(map[string]SubsystemHealth, len(checks)),
+		Timestamp:  time.Now().UTC(),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			status, err := check(r.Context())
+			health := SubsystemHealth{
+				Status:  status,
+				Latency: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				health.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Subsystems[name] = health
+			response.Status = worseHealth(response.Status, status)
+		}()
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	if response.Status == healthDown {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// worseHealth returns the worse of two statuses
+func worseHealth(a, b string) string {
+	rank := map[string]int{healthOK: 0, healthDegraded: 1, healthDown: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// slowHealth reports a subsystem that answered but took longer than
+// healthSlowLatency as degraded
+func slowHealth(start time.Time) (string, error) {
+	if elapsed := time.Since(start); elapsed > healthSlowLatency {
+		return healthDegraded, fmt.Errorf("took %s", elapsed.Round(time.Millisecond))
+	}
+	return healthOK, nil
+}
+
+// checkDatabaseHealth pings the database. Every request needs it, so it is
+// down if the ping fails.
+func checkDatabaseHealth(ctx context.Context) (string, error) {
+	ctx, cancel := dbContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		return healthDown, err
+	}
+	return slowHealth(start)
+}
+
+// checkAIServiceHealth calls the AI service's /health endpoint. Decoy
+// generation falls back to local decoys without the service, so an
+// unreachable service is degraded rather than down.
+func checkAIServiceHealth(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, aiHealthTimeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(appConfig.AIServiceURL, "/") + "/health"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return healthDegraded, fmt.Errorf("invalid AI service URL: %w", err)
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return healthDegraded, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxAIResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return healthDegraded, fmt.Errorf("AI service returned %s", resp.Status)
+	}
+	return slowHealth(start)
+}
+
+// checkCryptoHealth generates a key pair with every algorithm. It is degraded
+// if some algorithms fail and down if all of them do.
+func checkCryptoHealth(ctx context.Context) (string, error) {
+	var failures []error
+	for _, algorithm := range healthAlgorithms {
+		keyPair, err := healthKeyGen(algorithm)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", algorithm, err))
+			continue
+		}
+		crypto.ZeroBytes(keyPair.PrivateKey)
+	}
+
+	switch {
+	case len(failures) == 0:
+		return healthOK, nil
+	case len(failures) == len(healthAlgorithms):
+		return healthDown, errors.Join(failures...)
+	default:
+		return healthDegraded, errors.Join(failures...)
+	}
+}
+
+// checkDiskHealth compares the size of the database file with
+// db_size_threshold_mb, reporting a larger file as degraded so it can be
+// cleaned up before the disk fills
+func checkDiskHealth(ctx context.Context) (string, error) {
+	if appConfig.DBSizeThresholdMB == 0 {
+		return healthOK, nil
+	}
+	info, err := os.Stat(appConfig.DatabasePath)
+	if err != nil {
+		return healthDegraded, fmt.Errorf("failed to read database file size: %w", err)
+	}
+	if threshold := int64(appConfig.DBSizeThresholdMB) << 20; info.Size() > threshold {
+		return healthDegraded, fmt.Errorf("database file is %d MB, over the %d MB threshold", info.Size()>>20, appConfig.DBSizeThresholdMB)
+	}
+	return healthOK, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pqcd/backend/crypto"
+)
+
+// keygenWorkers is the number of scheduled key generation jobs run at once
+const keygenWorkers = 4
+
+// keygenQueueSize is how many scheduled jobs can wait for a worker before new
+// ones are turned away
+const keygenQueueSize = 100
+
+// Statuses of a scheduled key generation job
+const (
+	keygenJobPending   = "pending"
+	keygenJobRunning   = "running"
+	keygenJobCompleted = "completed"
+	keygenJobFailed    = "failed"
+)
+
+// errKeygenQueueFull is returned by Schedule when no more jobs can wait
+var errKeygenQueueFull = errors.New("key generation queue is full")
+
+// KeygenJob is a scheduled key generation job. KeyID is the key_pairs row of
+// the generated key once Status is completed; Error says why it failed.
+type KeygenJob struct {
+	ID          string     `json:"job_id"`
+	Status      string     `json:"status"`
+	KeyID       *int64     `json:"key_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// keygenTask is a queued job and the request it generates a key for
+type keygenTask struct {
+	id       string
+	req      KeyRequest
+	sourceIP string
+}
+
+// KeygenQueue generates keys for scheduled jobs in the background, on a fixed
+// pool of workers fed by a buffered channel. Job state is kept in keygen_jobs
+// so callers can poll it.
+type KeygenQueue struct {
+	tasks chan keygenTask
+}
+
+// keygenQueue is the queue started by main and fed by
+// /api/keys/generate/scheduled
+var keygenQueue = newKeygenQueue(keygenQueueSize)
+
+// newKeygenQueue returns a queue that holds up to size jobs waiting for a worker
+func newKeygenQueue(size int) *KeygenQueue {
+	return &KeygenQueue{tasks: make(chan keygenTask, size)}
+}
+
+// Start marks the jobs a previous process left unfinished as failed, then runs
+// workers goroutines taking jobs off the queue. The returned function stops
+// them, waiting for the jobs they are running; jobs still queued stay pending.
+func (q *KeygenQueue) Start(workers int) (stop func()) {
+	failInterruptedKeygenJobs()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case task := <-q.tasks:
+					q.run(task)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Schedule records a pending job for a validated key request and queues it.
+// If the queue is full the job is dropped and errKeygenQueueFull returned.
+func (q *KeygenQueue) Schedule(ctx context.Context, req KeyRequest, sourceIP string) (KeygenJob, error) {
+	job := KeygenJob{
+		ID:        newRequestID(),
+		Status:    keygenJobPending,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	dbCtx, cancel := dbContext(ctx)
+	defer cancel()
+	_, err := db.ExecContext(dbCtx,
+		"INSERT INTO keygen_jobs (id, status, created_at) VALUES (?, ?, ?)",
+		job.ID, job.Status, job.CreatedAt.Format(sqliteTimestampFormat),
+	)
+	if err != nil {
+		return KeygenJob{}, fmt.Errorf("failed to store job: %w", err)
+	}
+
+	// The job is stored before it is queued, so a worker always finds its row
+	select {
+	case q.tasks <- keygenTask{id: job.ID, req: req, sourceIP: sourceIP}:
+		return job, nil
+	default:
+		if _, err := db.ExecContext(dbCtx, "DELETE FROM keygen_jobs WHERE id = ?", job.ID); err != nil {
+			log.Printf("Failed to drop key generation job %s: %v", job.ID, err)
+		}
+		return KeygenJob{}, errKeygenQueueFull
+	}
+}
+
+// run generates and stores the key of a job, recording the outcome in
+// keygen_jobs
+func (q *KeygenQueue) run(task keygenTask) {
+	if err := updateKeygenJob(task.id, keygenJobRunning, nil, ""); err != nil {
+		log.Printf("Failed to start key generation job %s: %v", task.id, err)
+	}
+
+	// GenerateKeyPair falls back to Kyber for unknown algorithms, but a job
+	// should fail rather than complete with a key nobody asked for
+	var keyID int64
+	_, _, err := crypto.KeySizes(task.req.Algorithm)
+	if err == nil {
+		_, keyID, err = generateStoredKey(context.Background(), task.req, task.sourceIP)
+	}
+	if err != nil {
+		log.Printf("Key generation job %s failed: %v", task.id, err)
+		err = updateKeygenJob(task.id, keygenJobFailed, nil, err.Error())
+	} else {
+		err = updateKeygenJob(task.id, keygenJobCompleted, &keyID, "")
+	}
+	if err != nil {
+		log.Printf("Failed to record outcome of key generation job %s: %v", task.id, err)
+	}
+}
+
+// updateKeygenJob sets the status of a job. Completed and failed jobs also get
+// their completion time, and keyID or errMessage.
+func updateKeygenJob(id, status string, keyID *int64, errMessage string) error {
+	ctx, cancel := dbContext(context.Background())
+	defer cancel()
+	var completedAt interface{}
+	if status == keygenJobCompleted || status == keygenJobFailed {
+		completedAt = time.Now().UTC().Format(sqliteTimestampFormat)
+	}
+	var errValue interface{}
+	if errMessage != "" {
+		errValue = errMessage
+	}
+	_, err := db.ExecContext(ctx,
+		"UPDATE keygen_jobs SET status = ?, key_id = ?, completed_at = ?, error = ? WHERE id = ?",
+		status, keyID, completedAt, errValue, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	return nil
+}
+
+// failInterruptedKeygenJobs marks the jobs left pending or running when the
+// server last stopped as failed, since nothing will pick them up again
+func failInterruptedKeygenJobs() {
+	ctx, cancel := dbContext(context.Background())
+	defer cancel()
+	result, err := db.ExecContext(ctx,
+		"UPDATE keygen_jobs SET status = ?, completed_at = ?, error = ? WHERE status IN (?, ?)",
+		keygenJobFailed, time.Now().UTC().Format(sqliteTimestampFormat), "interrupted by a server restart",
+		keygenJobPending, keygenJobRunning,
+	)
+	if err != nil {
+		log.Printf("Failed to fail interrupted key generation jobs: %v", err)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		log.Printf("Marked %d interrupted key generation jobs as failed", n)
+	}
+}
+
+// loadKeygenJob reads a job from keygen_jobs
+func loadKeygenJob(ctx context.Context, id string) (KeygenJob, error) {
+	ctx, cancel := dbContext(ctx)
+	defer cancel()
+	var job KeygenJob
+	var keyID sql.NullInt64
+	var completedAt sql.NullTime
+	var errMessage sql.NullString
+	err := db.QueryRowContext(ctx,
+		"SELECT id, status, key_id, created_at, completed_at, error FROM keygen_jobs WHERE id = ?", id,
+	).Scan(&job.ID, &job.Status, &keyID, &job.CreatedAt, &completedAt, &errMessage)
+	if err != nil {
+		return KeygenJob{}, err
+	}
+	if keyID.Valid {
+		job.KeyID = &keyID.Int64
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	job.Error = errMessage.String
+	return job, nil
+}
+
+// Scheduled key generation handler. Takes the same request as
+// /api/keys/generate but only queues the key, returning the job to poll with
+// 202 Accepted.
+func scheduledKeyGenerationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "OPTIONS" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// For OPTIONS requests, the headers are already set by the middleware
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req KeyRequest
+	if !decodeJSONBody(w, r, maxKeyRequestBytes, &req) {
+		return
+	}
+	if !validateKeyRequest(w, &req) {
+		return
+	}
+
+	job, err := keygenQueue.Schedule(r.Context(), req, clientIP(r))
+	if errors.Is(err, errKeygenQueueFull) {
+		sendErrorResponse(w, "Too many scheduled key generations", http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to schedule key generation", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// Key generation job handler. Reports the status of a scheduled key generation.
+func keygenJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/keys/jobs/")
+	job, err := loadKeygenJob(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		sendErrorResponse(w, "Job not found", http.StatusNotFound, "")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to look up job", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -1,41 +1,54 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rs/cors"
 	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
 	
 	"github.com/pqcd/backend/crypto"
+	"github.com/pqcd/backend/migrator"
 )
 
 // Global database connection
 var db *sql.DB
 
-// Configuration
-type Config struct {
-	Port         string
-	DatabasePath string
-	AIServiceURL string
-	LogLevel     string
-}
+// dbQueryTimeout bounds every database call, so a locked or overloaded
+// database fails the request instead of hanging it
+var dbQueryTimeout = 5 * time.Second
+
+// keyEncryptor encrypts private keys stored in key_pairs
+var keyEncryptor *crypto.KeyEncryptor
+
+// Request body size limit for key and decoy requests. Encrypt and decrypt
+// requests are limited by max_request_body_mb.
+const maxKeyRequestBytes = 1 << 20
 
 // Response structures
 type KeyResponse struct {
 	PublicKey   string    `json:"public_key"`
 	Algorithm   string    `json:"algorithm"`
 	Fingerprint string    `json:"fingerprint"`
-	GeneratedAt time.Time `json:"generated_at"`
-	DecoyCount  int       `json:"decoy_count"`
+	GeneratedAt time.Time  `json:"generated_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DecoyCount  int        `json:"decoy_count"`
 }
 
 type EncryptResponse struct {
@@ -59,16 +72,43 @@ type DecoyResponse struct {
 	GeneratedAt time.Time `json:"generated_at"`
 }
 
+type TimelineEvent struct {
+	Timestamp time.Time              `json:"timestamp"`
+	EventType string                 `json:"event_type"`
+	Severity  string                 `json:"severity"`
+	Detail    map[string]interface{} `json:"detail"`
+}
+
+// threatRecord is a threat the response engine persisted to event_logs,
+// encoded as JSON in the description column. It is the engine's per-IP threat
+// history, so the timeline reads it the same way the engine reloads it.
+type threatRecord struct {
+	Type        string    `json:"type"`
+	Level       int       `json:"level"`
+	Score       float64   `json:"score"`
+	Description string    `json:"description"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// threatEventType is the event_logs event type of persisted threats
+const threatEventType = "threat"
+
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Details string `json:"details,omitempty"`
+	Error     string `json:"error"`
+	Code      int    `json:"code"`
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // Request structures
 type KeyRequest struct {
-	Algorithm string `json:"algorithm"`
-	Count     int    `json:"count"`
+	Algorithm  string `json:"algorithm"`
+	Count      int    `json:"count"`
+	TTLSeconds int64  `json:"ttl_seconds"` // 0 means the key never expires
+
+	// Fraction of bits the decoys differ from the real key in, up to 0.5. 0
+	// means crypto.DefaultDecoyHammingFraction.
+	TargetHammingFraction float64 `json:"target_hamming_fraction"`
 }
 
 type EncryptRequest struct {
@@ -91,12 +131,38 @@ type DecoyRequest struct {
 }
 
 func main() {
+	configPath := flag.String("config", "", "Path to a YAML or TOML config file (default: pqcd.yaml or pqcd.toml in the working directory)")
+	tlsPort := flag.Int("tls-port", 0, "Port to serve HTTPS on, keeping plain HTTP on the configured port (default: HTTPS on the configured port)")
+	flag.Parse()
+
 	// Load configuration
-	config := loadConfig()
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	appConfig = config
 
-	// Initialize database
+	// Private keys are encrypted at rest, so refuse to start without a master key
+	keyEncryptor, err = crypto.NewKeyEncryptor(os.Getenv("STORAGE_MASTER_KEY"))
+	if err != nil {
+		log.Fatalf("STORAGE_MASTER_KEY must be set to encrypt stored private keys: %v", err)
+	}
+
+	// Initialize database. It is closed by shutdown.
 	initDB(config.DatabasePath)
-	defer db.Close()
+
+	// Delete keys generated with a TTL once they expire
+	stopPurger := startKeyPurger(db, defaultKeyPurgeInterval)
+
+	// Replace decoy keys before they have been in circulation long enough to
+	// be recognised
+	var stopRotator chan<- struct{}
+	if interval := config.decoyRotationInterval(); interval > 0 {
+		stopRotator = decoyRotator.Start(db, crypto.GenerateKeyPair, interval)
+	}
+
+	// Generate scheduled keys in the background
+	stopKeygen := keygenQueue.Start(keygenWorkers)
 
 	// Create router
 	mux := http.NewServeMux()
@@ -104,42 +170,76 @@ func main() {
 	// Register routes
 	mux.HandleFunc("/api/status", statusHandler)
 	mux.HandleFunc("/api/health", healthHandler)
+	mux.HandleFunc("/api/health/detailed", detailedHealthHandler)
 	mux.HandleFunc("/api/keys/generate", keyGenerationHandler)
+	mux.HandleFunc("/api/keys/generate/scheduled", scheduledKeyGenerationHandler)
+	mux.HandleFunc("/api/keys/jobs/", keygenJobHandler)
+	mux.HandleFunc("/api/keys/fingerprint/", fingerprintLookupHandler)
 	mux.HandleFunc("/api/decoys/generate", decoyGenerationHandler)
+	mux.HandleFunc("/api/decoys/history", listDecoysHandler)
+	mux.HandleFunc("/api/decoys/", decoyEffectivenessHandler)
 	mux.HandleFunc("/api/encrypt", encryptHandler)
 	mux.HandleFunc("/api/decrypt", decryptHandler)
+	mux.HandleFunc("/api/encrypt/stream", encryptStreamHandler)
+	mux.HandleFunc("/api/decrypt/stream", decryptStreamHandler)
+	mux.HandleFunc("/api/admin/timeline/", timelineHandler)
+	mux.HandleFunc("/api/admin/decoy-rotator/status", decoyRotatorStatusHandler)
+	mux.HandleFunc("/api/canary/", canaryTriggeredHandler)
 
 	// Add CORS middleware
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
-		AllowCredentials: true,
-		Debug:            config.LogLevel == "debug",
-	})
-	handler := c.Handler(mux)
+	c := cors.New(config.CORS.corsOptions(config.LogLevel == "debug"))
+	handler := trackInFlight(requestIDMiddleware(c.Handler(mux)))
 
-	// Start server
-	log.Printf("Server starting on port %s...", config.Port)
-	log.Fatal(http.ListenAndServe(":"+config.Port, handler))
-}
+	tlsConfig, err := loadTLSConfig(config)
+	if err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
 
-// Load configuration from environment variables
-func loadConfig() *Config {
-	return &Config{
-		Port:         getEnv("PORT", "8083"),
-		DatabasePath: getEnv("DB_PATH", "./pqcd.db"),
-		AIServiceURL: getEnv("AI_SERVICE_URL", "http://localhost:5000"),
-		LogLevel:     getEnv("LOG_LEVEL", "info"),
+	// HTTPS runs on the configured port unless -tls-port is given, in which case
+	// plain HTTP stays on the configured port for health checks
+	var servers []*http.Server
+	httpsAddr := ":" + config.Port
+	if *tlsPort != 0 {
+		httpsAddr = fmt.Sprintf(":%d", *tlsPort)
+		httpSrv := &http.Server{
+			Addr:    ":" + config.Port,
+			Handler: handler,
+		}
+		servers = append(servers, httpSrv)
+		go func() {
+			log.Printf("HTTP server starting on port %s...", config.Port)
+			if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start HTTP server: %v", err)
+			}
+		}()
 	}
-}
 
-// Helper to get environment variable with default
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+	// Start server
+	srv := &http.Server{
+		Addr:      httpsAddr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	servers = append(servers, srv)
+	go func() {
+		log.Printf("HTTPS server starting on %s...", httpsAddr)
+		if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start HTTPS server: %v", err)
+		}
+	}()
+
+	// Wait for interrupt signal
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	// Shutdown gracefully
+	close(stopPurger)
+	if stopRotator != nil {
+		close(stopRotator)
 	}
-	return fallback
+	stopKeygen()
+	shutdown(servers, shutdownTimeout)
 }
 
 // Initialize database connection
@@ -157,9 +257,51 @@ func initDB(dbPath string) {
 	}
 
 	log.Printf("Connected to database at %s", dbPath)
+	configureDB(db, appConfig)
+	
+	// Bring databases created before source_ip existed up to the initial migration
+	addLegacyColumns()
+	
+	// Apply schema migrations
+	if err := migrator.Run(db); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
 	
 	// Create tables if they don't exist
 	createTables()
+
+	// Upgrade legacy fingerprints to the current format
+	migrateFingerprints(db)
+}
+
+// configureDB sizes the connection pool of db from cfg
+func configureDB(db *sql.DB, cfg *Config) {
+	db.SetMaxOpenConns(cfg.DBMaxConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.dbConnMaxLifetime())
+}
+
+// dbContext returns a context for one database call made on behalf of parent,
+// cancelled after dbQueryTimeout
+func dbContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, dbQueryTimeout)
+}
+
+// addLegacyColumns adds columns that the initial migration expects to databases
+// created before they existed. Fresh databases have no tables yet and are skipped.
+func addLegacyColumns() {
+	columns := []string{
+		`ALTER TABLE key_pairs ADD COLUMN source_ip TEXT`,
+	}
+
+	for _, column := range columns {
+		ctx, cancel := dbContext(context.Background())
+		_, err := db.ExecContext(ctx, column)
+		cancel()
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") && !strings.Contains(err.Error(), "no such table") {
+			log.Printf("Error adding column: %v", err)
+		}
+	}
 }
 
 // Create necessary tables if they don't exist
@@ -168,15 +310,25 @@ func createTables() {
 		`CREATE TABLE IF NOT EXISTS key_pairs (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			public_key BLOB NOT NULL,
-			private_key BLOB NOT NULL,
-			fingerprint TEXT NOT NULL,
+			private_key BLOB,
+			fingerprint VARCHAR(95) NOT NULL,
 			algorithm TEXT NOT NULL,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			is_real BOOLEAN DEFAULT 1,
-			tags TEXT
+			tags TEXT, -- JSON array of tag names
+			source_ip TEXT,
+			expires_at TIMESTAMP,
+			superseded_by INTEGER REFERENCES key_pairs(id),
+			effectiveness_score REAL,
+			flagged BOOLEAN DEFAULT 0,
+			deleted_at TIMESTAMP,
+			origin_fingerprint TEXT -- Fingerprint of the real key a decoy was generated for
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_key_pairs_fingerprint ON key_pairs(fingerprint)`,
 		`CREATE INDEX IF NOT EXISTS idx_key_pairs_algorithm ON key_pairs(algorithm)`,
+		`CREATE INDEX IF NOT EXISTS idx_key_pairs_is_real ON key_pairs(is_real)`,
+		`CREATE INDEX IF NOT EXISTS idx_key_pairs_expires_at ON key_pairs(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_key_pairs_origin_fingerprint ON key_pairs(origin_fingerprint)`,
 		`CREATE TABLE IF NOT EXISTS decoys (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			decoy_text TEXT NOT NULL,
@@ -186,6 +338,14 @@ func createTables() {
 			effectiveness_score REAL
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_decoys_target ON decoys(target_text)`,
+		`CREATE INDEX IF NOT EXISTS idx_decoys_target_complexity ON decoys(target_text, complexity)`,
+		`CREATE TABLE IF NOT EXISTS key_usage (
+			fingerprint TEXT NOT NULL,
+			operation TEXT NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0,
+			last_used TIMESTAMP,
+			UNIQUE (fingerprint, operation)
+		)`,
 		`CREATE TABLE IF NOT EXISTS event_logs (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			event_type TEXT NOT NULL,
@@ -197,6 +357,8 @@ func createTables() {
 			related_item_type TEXT
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_event_logs_type_time ON event_logs(event_type, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_event_logs_ip_type ON event_logs(source_ip, event_type)`,
+		`CREATE INDEX IF NOT EXISTS idx_event_logs_severity_time ON event_logs(severity, timestamp)`,
 		`CREATE TABLE IF NOT EXISTS users (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			username TEXT UNIQUE NOT NULL,
@@ -205,32 +367,118 @@ func createTables() {
 			last_login TIMESTAMP,
 			role TEXT CHECK (role IN ('admin', 'user', 'readonly')) DEFAULT 'user'
 		)`,
+		`CREATE TABLE IF NOT EXISTS block_list (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ip TEXT NOT NULL,
+			reason TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_block_list_ip ON block_list(ip)`,
+		`CREATE TABLE IF NOT EXISTS canary_tokens (
+			token_id TEXT PRIMARY KEY,
+			key_pair_id INTEGER REFERENCES key_pairs(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			first_triggered_at TIMESTAMP,
+			last_triggered_at TIMESTAMP,
+			trigger_count INTEGER NOT NULL DEFAULT 0,
+			last_source_ip TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS keygen_jobs (
+			id TEXT PRIMARY KEY,
+			status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+			key_id INTEGER REFERENCES key_pairs(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			completed_at TIMESTAMP,
+			error TEXT
+		)`,
 	}
 
 	for _, table := range tables {
-		_, err := db.Exec(table)
+		ctx, cancel := dbContext(context.Background())
+		_, err := db.ExecContext(ctx, table)
+		cancel()
 		if err != nil {
 			log.Printf("Error creating table: %v", err)
 		}
 	}
 
-	// Insert default admin user if it doesn't exist
+	createAdminUser()
+}
+
+// createAdminUser creates the admin user with a bcrypt hash of ADMIN_PASSWORD
+// if it doesn't exist. Without ADMIN_PASSWORD no admin user is created.
+func createAdminUser() {
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = 'admin'").Scan(&count)
+	ctx, cancel := dbContext(context.Background())
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = 'admin'").Scan(&count)
+	cancel()
 	if err != nil {
 		log.Printf("Error checking for admin user: %v", err)
 		return
 	}
+	if count > 0 {
+		return
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		log.Printf("No admin user exists; set ADMIN_PASSWORD to create one")
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		log.Printf("Error hashing admin password: %v", err)
+		return
+	}
+	ctx, cancel = dbContext(context.Background())
+	defer cancel()
+	_, err = db.ExecContext(ctx, "INSERT INTO users (username, password_hash, role) VALUES ('admin', ?, 'admin')", string(hash))
+	if err != nil {
+		log.Printf("Error creating admin user: %v", err)
+	} else {
+		log.Printf("Created admin user from ADMIN_PASSWORD")
+	}
+}
+
+// bcryptCost is the work factor of stored password hashes
+const bcryptCost = 12
+
+// migrateFingerprints recomputes legacy 16-byte hex fingerprints as full
+// colon-separated SHA-256 fingerprints
+func migrateFingerprints(db *sql.DB) {
+	ctx, cancel := dbContext(context.Background())
+	rows, err := db.QueryContext(ctx, "SELECT id, public_key FROM key_pairs WHERE fingerprint NOT LIKE '%:%'")
+	if err != nil {
+		cancel()
+		log.Printf("Error querying legacy fingerprints: %v", err)
+		return
+	}
+
+	updates := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var publicKey []byte
+		if err := rows.Scan(&id, &publicKey); err != nil {
+			log.Printf("Error scanning key pair: %v", err)
+			continue
+		}
+		updates[id] = crypto.FingerPrint(publicKey)
+	}
+	rows.Close()
+	cancel()
 
-	if count == 0 {
-		// Insert default admin user (password: admin123)
-		_, err = db.Exec("INSERT INTO users (username, password_hash, role) VALUES ('admin', '$2b$12$1B7tQMt1IjuOXZvGdyz9A.J1DWnbwOgqYJMBpWY2Rcx.UmNMy9.cG', 'admin')")
+	for id, fingerprint := range updates {
+		ctx, cancel := dbContext(context.Background())
+		_, err := db.ExecContext(ctx, "UPDATE key_pairs SET fingerprint = ? WHERE id = ?", fingerprint, id)
+		cancel()
 		if err != nil {
-			log.Printf("Error creating admin user: %v", err)
-		} else {
-			log.Printf("Created default admin user")
+			log.Printf("Error migrating fingerprint for key pair %d: %v", id, err)
 		}
 	}
+
+	if len(updates) > 0 {
+		log.Printf("Migrated %d fingerprints to SHA-256 format", len(updates))
+	}
 }
 
 // Status handler
@@ -279,56 +527,127 @@ func keyGenerationHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request
 	var req KeyRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request format", http.StatusBadRequest, err.Error())
+	if !decodeJSONBody(w, r, maxKeyRequestBytes, &req) {
+		return
+	}
+	if !validateKeyRequest(w, &req) {
 		return
 	}
 
-	// Validate request
+	response, _, err := generateStoredKey(r.Context(), req, clientIP(r))
+	if err != nil {
+		sendErrorResponse(w, "Key generation failed", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// validateKeyRequest fills in the defaults of a key request. Sends an error
+// response and returns false if a setting is out of range.
+func validateKeyRequest(w http.ResponseWriter, req *KeyRequest) bool {
 	if req.Algorithm == "" {
 		req.Algorithm = crypto.AlgoKyber // Default algorithm
 	}
 	if req.Count <= 0 {
 		req.Count = 5 // Default decoy count
 	}
+	if req.TTLSeconds < 0 {
+		sendErrorResponse(w, "Invalid TTL", http.StatusBadRequest, "ttl_seconds must not be negative")
+		return false
+	}
+	if req.TargetHammingFraction == 0 {
+		req.TargetHammingFraction = crypto.DefaultDecoyHammingFraction
+	}
+	if req.TargetHammingFraction < 0 || req.TargetHammingFraction > 0.5 {
+		sendErrorResponse(w, "Invalid target Hamming fraction", http.StatusBadRequest, "target_hamming_fraction must be between 0 and 0.5")
+		return false
+	}
+	return true
+}
+
+// generateStoredKey generates a key pair and its decoys for a validated key
+// request and stores them, returning the response for the caller and the
+// key_pairs ID of the real key. Decoys that fail to store are logged and
+// skipped.
+func generateStoredKey(ctx context.Context, req KeyRequest, sourceIP string) (KeyResponse, int64, error) {
+	generatedAt := time.Now()
+	expiresAt := expiryTimestamp(generatedAt, req.TTLSeconds)
 
 	// Generate key pair
 	keyPair, err := crypto.GenerateKeyPair(req.Algorithm)
 	if err != nil {
-		sendErrorResponse(w, "Key generation failed", http.StatusInternalServerError, err.Error())
-		return
+		return KeyResponse{}, 0, fmt.Errorf("failed to generate key pair: %w", err)
 	}
+	// Only the encrypted private keys are kept once they are stored
+	defer crypto.ZeroBytes(keyPair.PrivateKey)
 
-	// Generate fingerprint
-	fingerprint := crypto.FingerPrint(keyPair.PublicKey)
+	// Generate fingerprint, made unique among real keys
+	fingerprint, err := uniqueFingerprint(ctx, db, crypto.FingerPrint(keyPair.PublicKey), sourceIP)
+	if err != nil {
+		return KeyResponse{}, 0, err
+	}
 
 	// Store in database
-	_, err = db.Exec(
-		"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real) VALUES (?, ?, ?, ?, ?)",
-		keyPair.PublicKey, keyPair.PrivateKey, fingerprint, keyPair.Algorithm, true,
+	storedKey, err := keyEncryptor.EncryptForStorage(keyPair.PrivateKey)
+	if err != nil {
+		return KeyResponse{}, 0, fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	dbCtx, cancel := dbContext(ctx)
+	result, err := db.ExecContext(dbCtx,
+		"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real, source_ip, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		keyPair.PublicKey, storedKey, fingerprint, keyPair.Algorithm, true, sourceIP, expiresAt,
 	)
+	cancel()
 	if err != nil {
-		sendErrorResponse(w, "Failed to store key pair", http.StatusInternalServerError, err.Error())
-		return
+		return KeyResponse{}, 0, fmt.Errorf("failed to store key pair: %w", err)
+	}
+	keyID, err := result.LastInsertId()
+	if err != nil {
+		return KeyResponse{}, 0, fmt.Errorf("failed to read key pair id: %w", err)
 	}
 
 	// Generate decoys
-	decoys, err := crypto.GenerateCognitiveDecoyKeys(keyPair, req.Count)
+	decoys, err := crypto.GenerateCognitiveDecoyKeys(keyPair, req.Count, req.TargetHammingFraction)
 	if err != nil {
-		sendErrorResponse(w, "Failed to generate decoys", http.StatusInternalServerError, err.Error())
-		return
+		return KeyResponse{}, 0, fmt.Errorf("failed to generate decoys: %w", err)
 	}
+	// The last decoy carries a canary token, so its use can be detected
+	canaryTokenID := canaryDecoy(keyPair, decoys, req.TargetHammingFraction)
 
 	// Store decoys in database
-	for _, decoy := range decoys {
+	for i, decoy := range decoys {
 		decoyFingerprint := crypto.FingerPrint(decoy.PublicKey)
-		_, err = db.Exec(
-			"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real) VALUES (?, ?, ?, ?, ?)",
-			decoy.PublicKey, decoy.PrivateKey, decoyFingerprint, decoy.Algorithm, false,
+		score := crypto.ScoreDecoyEffectiveness(keyPair, decoy)
+		// Decoys are encrypted too, so real keys can't be told apart by their blobs
+		storedDecoy, err := keyEncryptor.EncryptForStorage(decoy.PrivateKey)
+		crypto.ZeroBytes(decoy.PrivateKey)
+		if err != nil {
+			log.Printf("Failed to encrypt decoy: %v", err)
+			continue
+		}
+		// Decoys expire with their key so they can't outlive it
+		dbCtx, cancel := dbContext(ctx)
+		result, err := db.ExecContext(dbCtx,
+			"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real, expires_at, effectiveness_score, origin_fingerprint) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			decoy.PublicKey, storedDecoy, decoyFingerprint, decoy.Algorithm, false, expiresAt, score, fingerprint,
 		)
 		if err != nil {
+			cancel()
 			log.Printf("Failed to store decoy: %v", err)
+			continue
+		}
+		if canaryTokenID != "" && i == len(decoys)-1 {
+			decoyID, err := result.LastInsertId()
+			if err == nil {
+				_, err = db.ExecContext(dbCtx, "INSERT INTO canary_tokens (token_id, key_pair_id) VALUES (?, ?)", canaryTokenID, decoyID)
+			}
+			if err != nil {
+				log.Printf("Failed to store canary token: %v", err)
+			}
 		}
+		cancel()
 	}
 
 	// Prepare response
@@ -336,12 +655,29 @@ func keyGenerationHandler(w http.ResponseWriter, r *http.Request) {
 		PublicKey:   base64.StdEncoding.EncodeToString(keyPair.PublicKey),
 		Algorithm:   keyPair.Algorithm,
 		Fingerprint: fingerprint,
-		GeneratedAt: time.Now(),
+		GeneratedAt: generatedAt,
 		DecoyCount:  req.Count,
 	}
+	if req.TTLSeconds > 0 {
+		expiry := generatedAt.Add(time.Duration(req.TTLSeconds) * time.Second)
+		response.ExpiresAt = &expiry
+	}
+	return response, keyID, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+// loadPrivateKey reads and decrypts the private key of a stored key pair
+func loadPrivateKey(ctx context.Context, id int64) ([]byte, error) {
+	ctx, cancel := dbContext(ctx)
+	defer cancel()
+	var storedKey []byte
+	if err := db.QueryRowContext(ctx, "SELECT private_key FROM key_pairs WHERE id = ?", id).Scan(&storedKey); err != nil {
+		return nil, fmt.Errorf("failed to load key pair %d: %w", id, err)
+	}
+	privateKey, err := keyEncryptor.DecryptFromStorage(storedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key pair %d: %w", id, err)
+	}
+	return privateKey, nil
 }
 
 // Decoy generation handler
@@ -359,8 +695,7 @@ func decoyGenerationHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request
 	var req DecoyRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request format", http.StatusBadRequest, err.Error())
+	if !decodeJSONBody(w, r, maxKeyRequestBytes, &req) {
 		return
 	}
 
@@ -370,14 +705,24 @@ func decoyGenerationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if req.Complexity <= 0 {
-		req.Complexity = 5 // Default complexity
+		req.Complexity = appConfig.DecoyComplexityDefault
+	}
+	if req.Complexity > appConfig.MaxDecoyComplexity {
+		sendErrorResponse(w, "Complexity too high", http.StatusBadRequest,
+			fmt.Sprintf("complexity must be at most %d, got %d", appConfig.MaxDecoyComplexity, req.Complexity))
+		return
 	}
 	if req.Count <= 0 {
-		req.Count = 10 // Default count
+		req.Count = min(10, appConfig.MaxDecoyCount) // Default count
+	}
+	if req.Count > appConfig.MaxDecoyCount {
+		sendErrorResponse(w, "Too many decoys requested", http.StatusBadRequest,
+			fmt.Sprintf("count must be at most %d, got %d", appConfig.MaxDecoyCount, req.Count))
+		return
 	}
 
 	// Call AI service to generate decoys
-	aiServiceURL := loadConfig().AIServiceURL + "/generate"
+	aiServiceURL := appConfig.AIServiceURL + "/generate"
 	aiReq, err := json.Marshal(map[string]interface{}{
 		"target":     req.Target,
 		"complexity": req.Complexity,
@@ -388,8 +733,8 @@ func decoyGenerationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make HTTP request to AI service
-	aiResp, err := http.Post(aiServiceURL, "application/json", ioutil.NopCloser(bytes.NewReader(aiReq)))
+	// Make HTTP request to AI service, retrying transient failures
+	aiBody, err := callAIWithRetry(r.Context(), aiServiceURL, aiReq, aiMaxAttempts, aiRetryBaseDelay)
 	if err != nil {
 		// Fallback to local decoy generation if AI service is unavailable
 		log.Printf("AI service unavailable: %v. Using fallback decoys.", err)
@@ -423,10 +768,12 @@ func decoyGenerationHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Store decoys in database
 		for _, decoy := range mockDecoys {
-			_, err = db.Exec(
+			ctx, cancel := dbContext(r.Context())
+			_, err = db.ExecContext(ctx,
 				"INSERT INTO decoys (decoy_text, target_text, complexity) VALUES (?, ?, ?)",
 				decoy, req.Target, req.Complexity,
 			)
+			cancel()
 			if err != nil {
 				log.Printf("Failed to store decoy: %v", err)
 			}
@@ -436,11 +783,10 @@ func decoyGenerationHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(response)
 		return
 	}
-	defer aiResp.Body.Close()
 
 	// Parse AI service response
 	var aiResponse map[string]interface{}
-	if err := json.NewDecoder(aiResp.Body).Decode(&aiResponse); err != nil {
+	if err := json.Unmarshal(aiBody, &aiResponse); err != nil {
 		sendErrorResponse(w, "Failed to parse AI response", http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -459,10 +805,12 @@ func decoyGenerationHandler(w http.ResponseWriter, r *http.Request) {
 			decoyStrings = append(decoyStrings, str)
 			
 			// Store in database
-			_, err = db.Exec(
+			ctx, cancel := dbContext(r.Context())
+			_, err = db.ExecContext(ctx,
 				"INSERT INTO decoys (decoy_text, target_text, complexity) VALUES (?, ?, ?)",
 				str, req.Target, req.Complexity,
 			)
+			cancel()
 			if err != nil {
 				log.Printf("Failed to store decoy: %v", err)
 			}
@@ -497,8 +845,7 @@ func encryptHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request
 	var req EncryptRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request format", http.StatusBadRequest, err.Error())
+	if !decodeJSONBody(w, r, appConfig.maxRequestBodyBytes(), &req) {
 		return
 	}
 
@@ -521,6 +868,19 @@ func encryptHandler(w http.ResponseWriter, r *http.Request) {
 		sendErrorResponse(w, "Invalid public key format", http.StatusBadRequest, err.Error())
 		return
 	}
+	checkCanaryKey(publicKey, r)
+
+	// Validate public key size for the requested algorithm
+	publicKeySize, _, err := crypto.KeySizes(req.Algorithm)
+	if err != nil {
+		sendErrorResponse(w, "Unsupported algorithm", http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(publicKey) != publicKeySize {
+		sendErrorResponse(w, "Invalid public key size", http.StatusBadRequest,
+			fmt.Sprintf("expected %d bytes for %s, got %d", publicKeySize, req.Algorithm, len(publicKey)))
+		return
+	}
 
 	// Encrypt data
 	encryptedData, err := crypto.Encrypt([]byte(req.Plaintext), publicKey, req.Algorithm)
@@ -530,9 +890,11 @@ func encryptHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Log encryption event
-	_, err = db.Exec(
-		"INSERT INTO event_logs (event_type, description, severity) VALUES (?, ?, ?)",
-		"encryption", fmt.Sprintf("Encrypted message using %s algorithm", req.Algorithm), "INFO",
+	ctx, cancel := dbContext(r.Context())
+	defer cancel()
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO event_logs (event_type, description, source_ip, severity) VALUES (?, ?, ?, ?)",
+		"encryption", withRequestID(fmt.Sprintf("Encrypted message using %s algorithm", req.Algorithm), r), clientIP(r), "INFO",
 	)
 	if err != nil {
 		log.Printf("Failed to log encryption event: %v", err)
@@ -565,8 +927,7 @@ func decryptHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request
 	var req DecryptRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request format", http.StatusBadRequest, err.Error())
+	if !decodeJSONBody(w, r, appConfig.maxRequestBodyBytes(), &req) {
 		return
 	}
 
@@ -599,6 +960,20 @@ func decryptHandler(w http.ResponseWriter, r *http.Request) {
 		sendErrorResponse(w, "Invalid private key format", http.StatusBadRequest, err.Error())
 		return
 	}
+	defer crypto.ZeroBytes(privateKey)
+	checkCanaryKey(privateKey, r)
+
+	// Validate private key size for the requested algorithm
+	_, privateKeySize, err := crypto.KeySizes(req.Algorithm)
+	if err != nil {
+		sendErrorResponse(w, "Unsupported algorithm", http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(privateKey) != privateKeySize {
+		sendErrorResponse(w, "Invalid private key size", http.StatusBadRequest,
+			fmt.Sprintf("expected %d bytes for %s, got %d", privateKeySize, req.Algorithm, len(privateKey)))
+		return
+	}
 
 	nonce, err := base64.StdEncoding.DecodeString(req.Nonce)
 	if err != nil {
@@ -621,9 +996,11 @@ func decryptHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Log decryption event
-	_, err = db.Exec(
-		"INSERT INTO event_logs (event_type, description, severity) VALUES (?, ?, ?)",
-		"decryption", fmt.Sprintf("Decrypted message using %s algorithm", req.Algorithm), "INFO",
+	ctx, cancel := dbContext(r.Context())
+	defer cancel()
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO event_logs (event_type, description, source_ip, severity) VALUES (?, ?, ?, ?)",
+		"decryption", withRequestID(fmt.Sprintf("Decrypted message using %s algorithm", req.Algorithm), r), clientIP(r), "INFO",
 	)
 	if err != nil {
 		log.Printf("Failed to log decryption event: %v", err)
@@ -640,19 +1017,260 @@ func decryptHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// Timeline handler returns every recorded event for a single IP in chronological order
+func timelineHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimPrefix(r.URL.Path, "/api/admin/timeline/")
+	if ip == "" {
+		sendErrorResponse(w, "IP address is required", http.StatusBadRequest, "")
+		return
+	}
+
+	// Parse optional time range and limit
+	query := r.URL.Query()
+	var from, to time.Time
+	var err error
+	if v := query.Get("from"); v != "" {
+		from, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from timestamp", http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		to, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			sendErrorResponse(w, "Invalid to timestamp", http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	limit := 200
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			sendErrorResponse(w, "Invalid limit", http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+	}
+
+	events, err := buildTimeline(r.Context(), ip)
+	if err != nil {
+		sendErrorResponse(w, "Failed to build timeline", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Apply the time range after merging so every source is filtered the same way
+	timeline := make([]TimelineEvent, 0, len(events))
+	for _, event := range events {
+		if !from.IsZero() && event.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && event.Timestamp.After(to) {
+			continue
+		}
+		timeline = append(timeline, event)
+	}
+	if len(timeline) > limit {
+		timeline = timeline[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeline)
+}
+
+// buildTimeline merges key generation, event log, threat history and block list
+// entries for an IP. Threats are the response engine's history, persisted to
+// event_logs, and appear as anomaly events at the time they were classified.
+func buildTimeline(ctx context.Context, ip string) ([]TimelineEvent, error) {
+	ctx, cancel := dbContext(ctx)
+	defer cancel()
+	events := []TimelineEvent{}
+
+	rows, err := db.QueryContext(ctx,
+		"SELECT id, fingerprint, algorithm, created_at FROM key_pairs WHERE source_ip = ? AND is_real = 1 ORDER BY id",
+		ip,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query key pairs: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var fingerprint, algorithm string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &fingerprint, &algorithm, &createdAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan key pair: %w", err)
+		}
+		events = append(events, TimelineEvent{
+			Timestamp: createdAt,
+			EventType: "key_generation",
+			Severity:  "INFO",
+			Detail: map[string]interface{}{
+				"key_id":      id,
+				"fingerprint": fingerprint,
+				"algorithm":   algorithm,
+			},
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read key pairs: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx,
+		"SELECT id, event_type, description, timestamp, severity FROM event_logs WHERE source_ip = ? AND event_type != ? ORDER BY id",
+		ip, threatEventType,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event logs: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var eventType string
+		var description, severity sql.NullString
+		var timestamp time.Time
+		if err := rows.Scan(&id, &eventType, &description, &timestamp, &severity); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan event log: %w", err)
+		}
+		events = append(events, TimelineEvent{
+			Timestamp: timestamp,
+			EventType: eventType,
+			Severity:  severity.String,
+			Detail: map[string]interface{}{
+				"event_id":    id,
+				"description": description.String,
+			},
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event logs: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx,
+		"SELECT id, description, timestamp, severity FROM event_logs WHERE source_ip = ? AND event_type = ? ORDER BY id",
+		ip, threatEventType,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query threat history: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var description, severity sql.NullString
+		var timestamp time.Time
+		if err := rows.Scan(&id, &description, &timestamp, &severity); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan threat: %w", err)
+		}
+		var threat threatRecord
+		if err := json.Unmarshal([]byte(description.String), &threat); err != nil {
+			log.Printf("Skipping unreadable threat record %d: %v", id, err)
+			continue
+		}
+		if threat.Timestamp.IsZero() {
+			threat.Timestamp = timestamp
+		}
+		events = append(events, TimelineEvent{
+			Timestamp: threat.Timestamp,
+			EventType: "anomaly",
+			Severity:  severity.String,
+			Detail: map[string]interface{}{
+				"event_id":    id,
+				"threat_type": threat.Type,
+				"level":       threat.Level,
+				"score":       threat.Score,
+				"description": threat.Description,
+			},
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read threat history: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx,
+		"SELECT id, reason, created_at FROM block_list WHERE ip = ? ORDER BY id",
+		ip,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query block list: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var reason sql.NullString
+		var createdAt time.Time
+		if err := rows.Scan(&id, &reason, &createdAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan block list entry: %w", err)
+		}
+		events = append(events, TimelineEvent{
+			Timestamp: createdAt,
+			EventType: "block",
+			Severity:  "CRITICAL",
+			Detail: map[string]interface{}{
+				"block_id": id,
+				"reason":   reason.String,
+			},
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read block list: %w", err)
+	}
+
+	// Stable sort keeps same-second events in the order they were recorded
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	return events, nil
+}
+
+// clientIP returns the remote address of a request without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Helper function to decode a size-limited JSON request body.
+// Sends an error response and returns false if the body is too large or malformed.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, limit int64, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			sendErrorResponse(w, "Request body too large", http.StatusRequestEntityTooLarge, fmt.Sprintf("limit is %d bytes", limit))
+			return false
+		}
+		sendErrorResponse(w, "Invalid request format", http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
 // Helper function to send error responses
 func sendErrorResponse(w http.ResponseWriter, message string, code int, details string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	
+	// requestIDMiddleware has already set the request ID on the response
 	response := ErrorResponse{
-		Error:   message,
-		Code:    code,
-		Details: details,
+		Error:     message,
+		Code:      code,
+		Details:   details,
+		RequestID: w.Header().Get(requestIDHeader),
 	}
 	
 	json.NewEncoder(w).Encode(response)
 	
 	// Log error
-	log.Printf("Error: %s (%d): %s", message, code, details)
+	log.Printf("Error: %s (%d): %s [request_id=%s]", message, code, details, response.RequestID)
 } 
\ No newline at end of file
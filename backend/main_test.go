@@ -0,0 +1,1734 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/cors"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pqcd/backend/crypto"
+)
+
+const testIP = "203.0.113.7"
+
+// setupTestDB points the global database at a fresh file for the duration of a test
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	encryptor, err := crypto.NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	keyEncryptor = encryptor
+	initDB(filepath.Join(t.TempDir(), "pqcd_test.db"))
+	t.Cleanup(func() { db.Close() })
+}
+
+// doRequest runs a handler against a request originating from testIP
+func doRequest(t *testing.T, handler http.HandlerFunc, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("Failed to encode request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.RemoteAddr = testIP + ":51234"
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestTimelineOrdering(t *testing.T) {
+	setupTestDB(t)
+
+	// Generate a key pair
+	rec := doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Count: 1})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Key generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var key KeyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&key); err != nil {
+		t.Fatalf("Failed to decode key response: %v", err)
+	}
+
+	// Encrypt a message with it
+	rec = doRequest(t, encryptHandler, "POST", "/api/encrypt", EncryptRequest{
+		Plaintext: "timeline test",
+		PublicKey: key.PublicKey,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Encryption failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Inject a threat from the response engine's history, an anomaly and a
+	// block shortly afterwards. The threat is persisted after it was
+	// classified, so only its own timestamp puts it in the right place.
+	now := time.Now().UTC()
+	threat, _ := json.Marshal(map[string]interface{}{
+		"ip":          testIP,
+		"type":        "Reconnaissance",
+		"level":       2,
+		"score":       0.8,
+		"description": "Injected threat",
+		"timestamp":   now.Add(500 * time.Millisecond),
+	})
+	_, err := db.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, timestamp) VALUES (?, ?, ?, ?, ?)",
+		threatEventType, string(threat), testIP, "WARNING", now.Add(3*time.Second),
+	)
+	if err != nil {
+		t.Fatalf("Failed to inject threat: %v", err)
+	}
+	_, err = db.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, timestamp) VALUES (?, ?, ?, ?, ?)",
+		"anomaly", "Injected anomaly", testIP, "WARNING", now.Add(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("Failed to inject anomaly: %v", err)
+	}
+	_, err = db.Exec(
+		"INSERT INTO block_list (ip, reason, created_at) VALUES (?, ?, ?)",
+		testIP, "Injected block", now.Add(2*time.Second),
+	)
+	if err != nil {
+		t.Fatalf("Failed to inject block: %v", err)
+	}
+
+	rec = doRequest(t, timelineHandler, "GET", "/api/admin/timeline/"+testIP, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Timeline request failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var timeline []TimelineEvent
+	if err := json.NewDecoder(rec.Body).Decode(&timeline); err != nil {
+		t.Fatalf("Failed to decode timeline: %v", err)
+	}
+
+	expected := []string{"key_generation", "encryption", "anomaly", "anomaly", "block"}
+	if len(timeline) != len(expected) {
+		t.Fatalf("Expected %d timeline events, got %d", len(expected), len(timeline))
+	}
+	for i, event := range timeline {
+		if event.EventType != expected[i] {
+			t.Errorf("Event %d: Expected type %s, got %s", i, expected[i], event.EventType)
+		}
+		if i > 0 && event.Timestamp.Before(timeline[i-1].Timestamp) {
+			t.Errorf("Event %d is out of chronological order", i)
+		}
+	}
+	if threatType := timeline[2].Detail["threat_type"]; threatType != "Reconnaissance" {
+		t.Errorf("Expected the threat history entry third, got %+v", timeline[2])
+	}
+
+	// Restricting the range should drop the earlier events
+	from := now.Add(1500 * time.Millisecond).Format(time.RFC3339Nano)
+	rec = doRequest(t, timelineHandler, "GET", "/api/admin/timeline/"+testIP+"?from="+from, nil)
+	timeline = nil
+	if err := json.NewDecoder(rec.Body).Decode(&timeline); err != nil {
+		t.Fatalf("Failed to decode filtered timeline: %v", err)
+	}
+	if len(timeline) != 1 || timeline[0].EventType != "block" {
+		t.Errorf("Expected only the block event after %s, got %+v", from, timeline)
+	}
+}
+
+func TestTimelineRequiresIP(t *testing.T) {
+	setupTestDB(t)
+
+	rec := doRequest(t, timelineHandler, "GET", "/api/admin/timeline/", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestTimelineReadErrors(t *testing.T) {
+	// Each case swaps a table for a view whose column fails to evaluate once
+	// the query steps onto the inserted row, so the error surfaces from
+	// rows.Next rather than from the query or the scan
+	tests := []struct {
+		name  string
+		setup []string
+		want  string
+	}{
+		{"key pairs", []string{
+			"ALTER TABLE key_pairs RENAME TO key_pairs_stored",
+			"CREATE VIEW key_pairs AS SELECT id, json_extract(fingerprint, '$') AS fingerprint, algorithm, created_at, is_real, source_ip FROM key_pairs_stored",
+			"INSERT INTO key_pairs_stored (public_key, fingerprint, algorithm, source_ip) VALUES (x'00', 'not json', 'kyber768', '" + testIP + "')",
+		}, "failed to read key pairs"},
+		{"event logs", []string{
+			"ALTER TABLE event_logs RENAME TO event_logs_stored",
+			"CREATE VIEW event_logs AS SELECT id, event_type, json_extract(description, '$') AS description, source_ip, timestamp, severity FROM event_logs_stored",
+			"INSERT INTO event_logs_stored (event_type, description, source_ip, severity) VALUES ('anomaly', 'not json', '" + testIP + "', 'WARNING')",
+		}, "failed to read event logs"},
+		{"threat history", []string{
+			"ALTER TABLE event_logs RENAME TO event_logs_stored",
+			"CREATE VIEW event_logs AS SELECT id, event_type, json_extract(description, '$') AS description, source_ip, timestamp, severity FROM event_logs_stored",
+			"INSERT INTO event_logs_stored (event_type, description, source_ip, severity) VALUES ('" + threatEventType + "', 'not json', '" + testIP + "', 'WARNING')",
+		}, "failed to read threat history"},
+		{"block list", []string{
+			"ALTER TABLE block_list RENAME TO block_list_stored",
+			"CREATE VIEW block_list AS SELECT id, ip, json_extract(reason, '$') AS reason, created_at FROM block_list_stored",
+			"INSERT INTO block_list_stored (ip, reason) VALUES ('" + testIP + "', 'not json')",
+		}, "failed to read block list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			for _, statement := range tt.setup {
+				if _, err := db.Exec(statement); err != nil {
+					t.Fatalf("Failed to run %q: %v", statement, err)
+				}
+			}
+
+			rec := doRequest(t, timelineHandler, "GET", "/api/admin/timeline/"+testIP, nil)
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusInternalServerError, rec.Code, rec.Body.String())
+			}
+			var response ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if !strings.Contains(response.Details, tt.want) {
+				t.Errorf("Expected details containing %q, got %q", tt.want, response.Details)
+			}
+		})
+	}
+}
+
+func TestMigrateFingerprints(t *testing.T) {
+	setupTestDB(t)
+
+	publicKey := []byte("legacy public key")
+	_, err := db.Exec(
+		"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm) VALUES (?, ?, ?, ?)",
+		publicKey, []byte("legacy private key"), crypto.FingerPrintShort(publicKey), crypto.AlgoKyber,
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert legacy key pair: %v", err)
+	}
+
+	migrateFingerprints(db)
+
+	var fingerprint string
+	if err := db.QueryRow("SELECT fingerprint FROM key_pairs").Scan(&fingerprint); err != nil {
+		t.Fatalf("Failed to read fingerprint: %v", err)
+	}
+	if fingerprint != crypto.FingerPrint(publicKey) {
+		t.Errorf("Expected migrated fingerprint %s, got %s", crypto.FingerPrint(publicKey), fingerprint)
+	}
+}
+
+func TestRequestBodyLimits(t *testing.T) {
+	setupTestDB(t)
+
+	// An encrypt body above 16 MB must be rejected with 413
+	oversized := EncryptRequest{
+		Plaintext: strings.Repeat("A", int(appConfig.maxRequestBodyBytes())+1),
+		PublicKey: "AAAA",
+		Algorithm: crypto.AlgoKyber,
+	}
+	rec := doRequest(t, encryptHandler, "POST", "/api/encrypt", oversized)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for oversized encrypt body, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+
+	// A key request above 1 MB must be rejected with 413
+	rec = doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Algorithm: strings.Repeat("k", maxKeyRequestBytes+1)})
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for oversized key body, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+
+	// Malformed JSON must be rejected with 400
+	req := httptest.NewRequest("POST", "/api/decrypt", strings.NewReader("{not json"))
+	rec = httptest.NewRecorder()
+	decryptHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for malformed body, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestRequestIDInErrorResponse(t *testing.T) {
+	setupTestDB(t)
+	handler := requestIDMiddleware(http.HandlerFunc(decryptHandler))
+
+	for _, incoming := range []string{"3f2504e0-4f89-41d3-9a0c-0305e82c3301", "", "not-a-uuid"} {
+		req := httptest.NewRequest("POST", "/api/decrypt", strings.NewReader("{not json"))
+		if incoming != "" {
+			req.Header.Set(requestIDHeader, incoming)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(requestIDHeader)
+		if !validRequestID(id) || (incoming == "3f2504e0-4f89-41d3-9a0c-0305e82c3301") != (id == incoming) {
+			t.Errorf("Incoming %q: unexpected request ID %q", incoming, id)
+		}
+		var response ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.RequestID != id {
+			t.Errorf("Incoming %q: expected the error to carry request ID %q, got %+v %v", incoming, id, response, err)
+		}
+	}
+}
+
+func TestKeySizeValidation(t *testing.T) {
+	setupTestDB(t)
+
+	// A public key of the wrong size must be rejected with 400
+	rec := doRequest(t, encryptHandler, "POST", "/api/encrypt", EncryptRequest{
+		Plaintext: "hello",
+		PublicKey: base64.StdEncoding.EncodeToString(make([]byte, 100)),
+		Algorithm: crypto.AlgoKyber,
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for short public key, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "expected 1184 bytes") {
+		t.Errorf("Expected a descriptive size error, got %s", rec.Body.String())
+	}
+
+	// A private key of the wrong size must be rejected with 400
+	rec = doRequest(t, decryptHandler, "POST", "/api/decrypt", DecryptRequest{
+		Ciphertext: base64.StdEncoding.EncodeToString(make([]byte, 2000)),
+		PrivateKey: base64.StdEncoding.EncodeToString(make([]byte, 10)),
+		Nonce:      base64.StdEncoding.EncodeToString(make([]byte, 24)),
+		Algorithm:  crypto.AlgoKyber,
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for short private key, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// Unknown algorithms are rejected instead of silently encrypted
+	rec = doRequest(t, encryptHandler, "POST", "/api/encrypt", EncryptRequest{
+		Plaintext: "hello",
+		PublicKey: base64.StdEncoding.EncodeToString(make([]byte, crypto.KyberPublicKeySize)),
+		Algorithm: "rot13",
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unknown algorithm, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestPrivateKeysEncryptedAtRest(t *testing.T) {
+	setupTestDB(t)
+
+	rec := doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Algorithm: crypto.AlgoKyber, Count: 2})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Key generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rows, err := db.Query("SELECT id, private_key FROM key_pairs")
+	if err != nil {
+		t.Fatalf("Failed to query key pairs: %v", err)
+	}
+	stored := make(map[int64][]byte)
+	for rows.Next() {
+		var id int64
+		var blob []byte
+		rows.Scan(&id, &blob)
+		stored[id] = blob
+	}
+	rows.Close()
+	if len(stored) != 3 {
+		t.Fatalf("Expected the key and 2 decoys to be stored, got %d rows", len(stored))
+	}
+
+	for id, blob := range stored {
+		privateKey, err := loadPrivateKey(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Failed to load key pair %d: %v", id, err)
+		}
+		if len(privateKey) != crypto.KyberPrivateKeySize {
+			t.Errorf("Expected a %d-byte private key, got %d", crypto.KyberPrivateKeySize, len(privateKey))
+		}
+		if bytes.Equal(blob, privateKey) || bytes.Contains(blob, privateKey[:32]) {
+			t.Errorf("Expected key pair %d to be stored encrypted", id)
+		}
+	}
+}
+
+func TestKeyGenerationTTL(t *testing.T) {
+	setupTestDB(t)
+
+	rec := doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Algorithm: crypto.AlgoKyber, Count: 1, TTLSeconds: 3600})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Key generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var response KeyResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+	if response.ExpiresAt == nil || response.ExpiresAt.Sub(response.GeneratedAt) != time.Hour {
+		t.Errorf("Expected the key to expire an hour after generation, got %v", response.ExpiresAt)
+	}
+
+	var expiring int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE expires_at IS NOT NULL").Scan(&expiring)
+	if expiring != 2 {
+		t.Errorf("Expected the key and its decoy to expire, got %d expiring rows", expiring)
+	}
+
+	rec = doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Algorithm: crypto.AlgoKyber, TTLSeconds: -1})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a negative TTL, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestKeyGenerationHammingFraction(t *testing.T) {
+	setupTestDB(t)
+
+	rec := doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Algorithm: crypto.AlgoKyber, Count: 3, TargetHammingFraction: 0.05})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Key generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var realKey []byte
+	if err := db.QueryRow("SELECT public_key FROM key_pairs WHERE is_real = 1").Scan(&realKey); err != nil {
+		t.Fatalf("Failed to load the real key: %v", err)
+	}
+	// The canary decoy's token is written over its tuned bits
+	rows, err := db.Query("SELECT public_key FROM key_pairs WHERE is_real = 0 AND id NOT IN (SELECT key_pair_id FROM canary_tokens)")
+	if err != nil {
+		t.Fatalf("Failed to load decoys: %v", err)
+	}
+	defer rows.Close()
+	decoys := 0
+	for rows.Next() {
+		var decoy []byte
+		if err := rows.Scan(&decoy); err != nil {
+			t.Fatalf("Failed to scan decoy: %v", err)
+		}
+		decoys++
+		differing := 0
+		for i := range decoy {
+			differing += bits.OnesCount8(decoy[i] ^ realKey[i])
+		}
+		if fraction := float64(differing) / float64(8*len(realKey)); fraction < 0.0475 || fraction > 0.0525 {
+			t.Errorf("Expected decoys to differ in 5%% of their bits (±5%%), got %g", fraction)
+		}
+	}
+	if decoys != 2 {
+		t.Errorf("Expected 2 decoys besides the canary, got %d", decoys)
+	}
+
+	for _, fraction := range []float64{-0.1, 0.6} {
+		rec := doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Algorithm: crypto.AlgoKyber, TargetHammingFraction: fraction})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for fraction %g, got %d", http.StatusBadRequest, fraction, rec.Code)
+		}
+	}
+}
+
+// scheduleKeyGeneration schedules a key generation job, which must be accepted
+func scheduleKeyGeneration(t *testing.T, req KeyRequest) KeygenJob {
+	t.Helper()
+	rec := doRequest(t, scheduledKeyGenerationHandler, "POST", "/api/keys/generate/scheduled", req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	var job KeygenJob
+	if err := json.NewDecoder(rec.Body).Decode(&job); err != nil {
+		t.Fatalf("Failed to decode job: %v", err)
+	}
+	if !validRequestID(job.ID) || job.Status != keygenJobPending {
+		t.Fatalf("Expected a pending job with a UUID, got %+v", job)
+	}
+	return job
+}
+
+// waitForKeygenJob polls a job until it completes or fails
+func waitForKeygenJob(t *testing.T, id string) KeygenJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := doRequest(t, keygenJobHandler, "GET", "/api/keys/jobs/"+id, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Job lookup failed: %d %s", rec.Code, rec.Body.String())
+		}
+		var job KeygenJob
+		json.NewDecoder(rec.Body).Decode(&job)
+		if job.Status == keygenJobCompleted || job.Status == keygenJobFailed {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job %s still %s after 5s", id, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduledKeyGeneration(t *testing.T) {
+	setupTestDB(t)
+	t.Cleanup(keygenQueue.Start(2))
+
+	job := waitForKeygenJob(t, scheduleKeyGeneration(t, KeyRequest{Algorithm: crypto.AlgoKyber, Count: 2}).ID)
+	if job.Status != keygenJobCompleted || job.KeyID == nil || job.CompletedAt == nil || job.Error != "" {
+		t.Fatalf("Expected a completed job with a key, got %+v", job)
+	}
+
+	var algorithm string
+	var isReal bool
+	if err := db.QueryRow("SELECT algorithm, is_real FROM key_pairs WHERE id = ?", *job.KeyID).Scan(&algorithm, &isReal); err != nil {
+		t.Fatalf("Failed to load the generated key: %v", err)
+	}
+	if algorithm != crypto.AlgoKyber || !isReal {
+		t.Errorf("Expected key_id to be a real %s key, got a %s key with is_real=%v", crypto.AlgoKyber, algorithm, isReal)
+	}
+	var decoys int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE is_real = 0").Scan(&decoys)
+	if decoys != 2 {
+		t.Errorf("Expected 2 decoys to be stored with the key, got %d", decoys)
+	}
+
+	rec := doRequest(t, keygenJobHandler, "GET", "/api/keys/jobs/no-such-job", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown job, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestScheduledKeyGenerationFailure(t *testing.T) {
+	setupTestDB(t)
+	t.Cleanup(keygenQueue.Start(1))
+
+	job := waitForKeygenJob(t, scheduleKeyGeneration(t, KeyRequest{Algorithm: "rsa"}).ID)
+	if job.Status != keygenJobFailed || job.KeyID != nil || job.CompletedAt == nil {
+		t.Fatalf("Expected a failed job without a key, got %+v", job)
+	}
+	if job.Error != "unsupported algorithm: rsa" {
+		t.Errorf("Expected the job to say why it failed, got %q", job.Error)
+	}
+	var stored int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs").Scan(&stored)
+	if stored != 0 {
+		t.Errorf("Expected no keys to be stored, got %d", stored)
+	}
+
+	// Out of range settings are rejected before a job is created
+	rec := doRequest(t, scheduledKeyGenerationHandler, "POST", "/api/keys/generate/scheduled", KeyRequest{TTLSeconds: -1})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a negative TTL, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestScheduledKeyGenerationQueueFull(t *testing.T) {
+	setupTestDB(t)
+	saved := keygenQueue
+	keygenQueue = newKeygenQueue(0)
+	t.Cleanup(func() { keygenQueue = saved })
+
+	// Nothing takes jobs off an unbuffered queue without workers
+	rec := doRequest(t, scheduledKeyGenerationHandler, "POST", "/api/keys/generate/scheduled", KeyRequest{})
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d %s", http.StatusServiceUnavailable, rec.Code, rec.Body.String())
+	}
+	var jobs int
+	db.QueryRow("SELECT COUNT(*) FROM keygen_jobs").Scan(&jobs)
+	if jobs != 0 {
+		t.Errorf("Expected the rejected job to be dropped, got %d jobs", jobs)
+	}
+}
+
+func TestInterruptedKeygenJobsFail(t *testing.T) {
+	setupTestDB(t)
+	db.Exec("INSERT INTO keygen_jobs (id, status) VALUES ('left-running', 'running')")
+
+	newKeygenQueue(1).Start(0)()
+
+	job, err := loadKeygenJob(context.Background(), "left-running")
+	if err != nil {
+		t.Fatalf("Failed to load job: %v", err)
+	}
+	if job.Status != keygenJobFailed || job.Error == "" || job.CompletedAt == nil {
+		t.Errorf("Expected the interrupted job to be marked failed, got %+v", job)
+	}
+}
+
+func TestPurgeExpiredKeys(t *testing.T) {
+	setupTestDB(t)
+	now := time.Now()
+
+	insert := func(expiresAt interface{}) {
+		t.Helper()
+		_, err := db.Exec(
+			"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, expires_at) VALUES (x'01', x'02', 'aa:bb', 'kyber768', ?)",
+			expiresAt,
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert key pair: %v", err)
+		}
+	}
+	insert(now.Add(-time.Minute).UTC().Format(sqliteTimestampFormat))
+	insert(now.Add(time.Hour).UTC().Format(sqliteTimestampFormat))
+	insert(nil)
+
+	purged, err := purgeExpiredKeys(db, now)
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 key to be purged, got %d", purged)
+	}
+
+	var remaining int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs").Scan(&remaining)
+	if remaining != 2 {
+		t.Errorf("Expected the unexpired and non-expiring keys to remain, got %d rows", remaining)
+	}
+
+	var description string
+	if err := db.QueryRow("SELECT description FROM event_logs WHERE event_type = 'key_expiry'").Scan(&description); err != nil {
+		t.Fatalf("Expected the purge to be logged: %v", err)
+	}
+	if description != "Purged 1 expired key pairs" {
+		t.Errorf("Unexpected purge log %q", description)
+	}
+
+	// Nothing left to purge, so nothing more is logged
+	if purged, _ := purgeExpiredKeys(db, now); purged != 0 {
+		t.Errorf("Expected nothing to purge, got %d", purged)
+	}
+}
+
+func TestKeyPurgerRuns(t *testing.T) {
+	setupTestDB(t)
+	db.Exec("INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, expires_at) VALUES (x'01', x'02', 'aa:bb', 'kyber768', '2000-01-01 00:00:00')")
+
+	stop := startKeyPurger(db, 10*time.Millisecond)
+	defer close(stop)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM key_pairs").Scan(&count)
+		if count == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected the purger to delete the expired key")
+}
+
+func TestRotateDecoys(t *testing.T) {
+	setupTestDB(t)
+	insert := func(isReal bool, createdAt string) int64 {
+		t.Helper()
+		result, err := db.Exec(
+			"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real, created_at, expires_at) VALUES (x'01', x'02', 'aa:bb', 'kyber', ?, ?, '2999-01-01 00:00:00')",
+			isReal, createdAt,
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert key pair: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		return id
+	}
+	now := time.Now()
+	stale := insert(false, "2000-01-01 00:00:00")
+	fresh := insert(false, now.UTC().Format(sqliteTimestampFormat))
+	real := insert(true, "2000-01-01 00:00:00")
+	db.Exec("UPDATE key_pairs SET origin_fingerprint = 'cc:dd' WHERE id = ?", stale)
+
+	rotator := &DecoyRotator{}
+	rotated, err := rotator.Run(db, crypto.GenerateKeyPair, time.Hour, now)
+	if err != nil {
+		t.Fatalf("Rotation failed: %v", err)
+	}
+	if rotated != 1 {
+		t.Fatalf("Expected 1 decoy to be rotated, got %d", rotated)
+	}
+
+	var deletedAt *string
+	var supersededBy *int64
+	db.QueryRow("SELECT deleted_at, superseded_by FROM key_pairs WHERE id = ?", stale).Scan(&deletedAt, &supersededBy)
+	if deletedAt == nil || supersededBy == nil {
+		t.Fatal("Expected the stale decoy to be soft-deleted and point at its replacement")
+	}
+	var isReal bool
+	var algorithm, expiresAt, origin string
+	var storedKey []byte
+	if err := db.QueryRow("SELECT is_real, algorithm, CAST(expires_at AS TEXT), private_key, origin_fingerprint FROM key_pairs WHERE id = ? AND deleted_at IS NULL", *supersededBy).Scan(&isReal, &algorithm, &expiresAt, &storedKey, &origin); err != nil {
+		t.Fatalf("Expected a live replacement decoy: %v", err)
+	}
+	if isReal || algorithm != crypto.AlgoKyber || expiresAt != "2999-01-01 00:00:00" {
+		t.Errorf("Expected the replacement to be a Kyber decoy expiring with the old one, got real=%v %s %s", isReal, algorithm, expiresAt)
+	}
+	if origin != "cc:dd" {
+		t.Errorf("Expected the replacement to keep the old decoy's origin fingerprint, got %q", origin)
+	}
+	if _, err := keyEncryptor.DecryptFromStorage(storedKey); err != nil {
+		t.Errorf("Expected the replacement's private key to be encrypted at rest: %v", err)
+	}
+	for _, id := range []int64{fresh, real} {
+		var deleted int
+		db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE id = ? AND deleted_at IS NOT NULL", id).Scan(&deleted)
+		if deleted != 0 {
+			t.Errorf("Expected key pair %d to be left alone", id)
+		}
+	}
+
+	var severity string
+	var relatedID int64
+	if err := db.QueryRow("SELECT severity, related_item_id FROM event_logs WHERE event_type = 'decoy_rotation'").Scan(&severity, &relatedID); err != nil {
+		t.Fatalf("Expected the rotation to be logged: %v", err)
+	}
+	if severity != "INFO" || relatedID != *supersededBy {
+		t.Errorf("Expected an INFO event for replacement %d, got %s for %d", *supersededBy, severity, relatedID)
+	}
+
+	// The replacement is new, so nothing is due on the next run
+	if rotated, _ := rotator.Run(db, crypto.GenerateKeyPair, time.Hour, now); rotated != 0 {
+		t.Errorf("Expected nothing to rotate, got %d", rotated)
+	}
+	if status := rotator.Status(); status.LastRun == nil || status.Rotated != 0 || status.TotalRotated != 1 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestRotateDecoysKeyGenFailure(t *testing.T) {
+	setupTestDB(t)
+	db.Exec("INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real, created_at) VALUES (x'01', x'02', 'aa:bb', 'kyber768', 0, '2000-01-01 00:00:00')")
+
+	rotator := &DecoyRotator{}
+	failing := func(string) (*crypto.KeyPair, error) { return nil, errors.New("no entropy") }
+	if _, err := rotator.Run(db, failing, time.Hour, time.Now()); err == nil {
+		t.Fatal("Expected the rotation to fail")
+	}
+	var live int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE deleted_at IS NULL").Scan(&live)
+	if live != 1 {
+		t.Errorf("Expected the decoy to stay live when its replacement fails, got %d live keys", live)
+	}
+	if status := rotator.Status(); status.LastError == "" {
+		t.Error("Expected the status to report the failure")
+	}
+}
+
+func TestDecoyRotatorStatus(t *testing.T) {
+	setupTestDB(t)
+	db.Exec("INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real, created_at) VALUES (x'01', x'02', 'aa:bb', 'kyber768', 0, '2000-01-01 00:00:00')")
+	previous := decoyRotator
+	decoyRotator = &DecoyRotator{}
+	t.Cleanup(func() { decoyRotator = previous })
+
+	stop := decoyRotator.Start(db, crypto.GenerateKeyPair, 10*time.Millisecond)
+	defer close(stop)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		rec := doRequest(t, decoyRotatorStatusHandler, "GET", "/api/admin/decoy-rotator/status", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		var status DecoyRotatorStatus
+		if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+		if !status.Enabled {
+			t.Fatal("Expected a started rotator to be enabled")
+		}
+		if status.TotalRotated == 1 {
+			if status.LastRun == nil {
+				t.Error("Expected the last run time to be reported")
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected the rotator to replace the stale decoy")
+}
+
+func TestFingerprintCollisionHandling(t *testing.T) {
+	setupTestDB(t)
+	insert := func(fingerprint string, isReal bool) {
+		t.Helper()
+		_, err := db.Exec(
+			"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real) VALUES (x'01', x'02', ?, 'kyber', ?)",
+			fingerprint, isReal,
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert key pair: %v", err)
+		}
+	}
+
+	// Decoys sharing a fingerprint are not collisions
+	insert("aa:bb", false)
+	fingerprint, err := uniqueFingerprint(context.Background(), db, "aa:bb", testIP)
+	if err != nil || fingerprint != "aa:bb" {
+		t.Fatalf("Expected an unused fingerprint to be kept, got %q %v", fingerprint, err)
+	}
+
+	insert("aa:bb", true)
+	fingerprint, _ = uniqueFingerprint(context.Background(), db, "aa:bb", testIP)
+	if fingerprint != "aa:bb-2" {
+		t.Errorf("Expected the first collision to get -2, got %q", fingerprint)
+	}
+	insert(fingerprint, true)
+	fingerprint, _ = uniqueFingerprint(context.Background(), db, "aa:bb", testIP)
+	if fingerprint != "aa:bb-3" {
+		t.Errorf("Expected the second collision to get -3, got %q", fingerprint)
+	}
+
+	var collisions int
+	db.QueryRow("SELECT COUNT(*) FROM event_logs WHERE event_type = 'fingerprint_collision' AND severity = 'WARNING' AND source_ip = ?", testIP).Scan(&collisions)
+	if collisions != 2 {
+		t.Errorf("Expected 2 collision warnings, got %d", collisions)
+	}
+}
+
+func TestFingerprintLookup(t *testing.T) {
+	setupTestDB(t)
+	for i, fingerprint := range []string{"aa:bb:01", "aa:bb:01-2", "aa:cc:02"} {
+		db.Exec(
+			"INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, is_real) VALUES (x'01', x'02', ?, 'kyber', ?)",
+			fingerprint, i != 2,
+		)
+	}
+
+	lookup := func(prefix string) (int, []FingerprintMatch) {
+		rec := httptest.NewRecorder()
+		fingerprintLookupHandler(rec, httptest.NewRequest("GET", "/api/keys/fingerprint/"+prefix, nil))
+		var matches []FingerprintMatch
+		json.NewDecoder(rec.Body).Decode(&matches)
+		return rec.Code, matches
+	}
+
+	if code, matches := lookup("AA:BB"); code != http.StatusOK || len(matches) != 2 {
+		t.Errorf("Expected 2 keys matching aa:bb, got %d %+v", code, matches)
+	}
+	if _, matches := lookup("aa:"); len(matches) != 3 {
+		t.Errorf("Expected 3 keys matching aa:, got %d", len(matches))
+	}
+	if code, matches := lookup("ff:ff"); code != http.StatusOK || len(matches) != 0 {
+		t.Errorf("Expected no matches for ff:ff, got %d %+v", code, matches)
+	}
+	for _, prefix := range []string{"a", "a%25", "zz"} {
+		if code, _ := lookup(prefix); code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusBadRequest, prefix, code)
+		}
+	}
+}
+
+func TestDecoyKeysScored(t *testing.T) {
+	setupTestDB(t)
+	rec := doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Algorithm: crypto.AlgoKyber, Count: 3})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Key generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var scored, unscoredReal int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE is_real = 0 AND effectiveness_score BETWEEN 0 AND 1").Scan(&scored)
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE is_real = 1 AND effectiveness_score IS NULL").Scan(&unscoredReal)
+	if scored != 3 || unscoredReal != 1 {
+		t.Errorf("Expected 3 scored decoys and an unscored real key, got %d and %d", scored, unscoredReal)
+	}
+}
+
+func TestDecoyKeysRecordOrigin(t *testing.T) {
+	setupTestDB(t)
+	rec := doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Algorithm: crypto.AlgoKyber, Count: 3})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Key generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var response KeyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	var decoys, unlinkedReal int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE is_real = 0 AND origin_fingerprint = ?", response.Fingerprint).Scan(&decoys)
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs WHERE is_real = 1 AND origin_fingerprint IS NULL").Scan(&unlinkedReal)
+	if decoys != 3 || unlinkedReal != 1 {
+		t.Errorf("Expected 3 decoys pointing at %s and a real key without an origin, got %d and %d", response.Fingerprint, decoys, unlinkedReal)
+	}
+}
+
+func TestCanaryDecoyTriggered(t *testing.T) {
+	setupTestDB(t)
+
+	rec := doRequest(t, keyGenerationHandler, "POST", "/api/keys/generate", KeyRequest{Algorithm: crypto.AlgoKyber, Count: 2})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Key generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var tokenID string
+	var publicKey []byte
+	err := db.QueryRow(
+		"SELECT c.token_id, k.public_key FROM canary_tokens c JOIN key_pairs k ON k.id = c.key_pair_id WHERE k.is_real = 0",
+	).Scan(&tokenID, &publicKey)
+	if err != nil {
+		t.Fatalf("Expected a decoy with a canary token: %v", err)
+	}
+
+	status := func(tokenID string) (int, CanaryStatus) {
+		rec := doRequest(t, canaryTriggeredHandler, "GET", "/api/canary/"+tokenID+"/triggered", nil)
+		var status CanaryStatus
+		json.NewDecoder(rec.Body).Decode(&status)
+		return rec.Code, status
+	}
+
+	if code, s := status(tokenID); code != http.StatusOK || s.Triggered || s.TriggerCount != 0 {
+		t.Errorf("Expected an untriggered canary, got %d %+v", code, s)
+	}
+
+	rec = doRequest(t, encryptHandler, "POST", "/api/encrypt", EncryptRequest{
+		Plaintext: "secret",
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		Algorithm: crypto.AlgoKyber,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Encryption with the canary decoy failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var events int
+	db.QueryRow("SELECT COUNT(*) FROM event_logs WHERE event_type = 'canary_triggered' AND severity = 'CRITICAL' AND source_ip = ?", testIP).Scan(&events)
+	if events != 1 {
+		t.Errorf("Expected 1 CRITICAL canary event, got %d", events)
+	}
+	code, s := status(tokenID)
+	if code != http.StatusOK || !s.Triggered || s.TriggerCount != 1 || s.LastSourceIP != testIP || s.FirstTriggeredAt == nil {
+		t.Errorf("Expected a triggered canary, got %d %+v", code, s)
+	}
+
+	if code, _ := status("unknown"); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown token, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestDBQueryTimeout(t *testing.T) {
+	setupTestDB(t)
+	defer func(timeout time.Duration) { dbQueryTimeout = timeout }(dbQueryTimeout)
+	dbQueryTimeout = 100 * time.Millisecond
+
+	// A recursive query that never finishes on its own
+	ctx, cancel := dbContext(context.Background())
+	defer cancel()
+	start := time.Now()
+	var count int
+	err := db.QueryRowContext(ctx, "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT COUNT(*) FROM c").Scan(&count)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the query to be cut off after %s, took %s", dbQueryTimeout, elapsed)
+	}
+
+	// A handler waiting for a connection gives up too
+	configureDB(db, &Config{DBMaxConns: 1, DBMaxIdleConns: 1})
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to hold the only connection: %v", err)
+	}
+	defer tx.Rollback()
+
+	start = time.Now()
+	rec := doRequest(t, fingerprintLookupHandler, "GET", "/api/keys/fingerprint/ab", nil)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusInternalServerError, rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the handler to fail after %s, took %s", dbQueryTimeout, elapsed)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	config, err := loadConfig("testdata/pqcd.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	expected := Config{
+		Port:                   "9443",
+		DatabasePath:           "/var/lib/pqcd/pqcd.db",
+		AIServiceURL:           "http://ai-service:5000",
+		LogLevel:               "debug",
+		MaxRequestBodyMB:       4,
+		DecoyComplexityDefault: 7,
+		MaxDecoyCount:          defaultMaxDecoyCount,
+		MaxDecoyComplexity:     defaultMaxDecoyComplexity,
+		BatchWorkerCount:       8,
+		DBMaxConns:             20,
+		DBMaxIdleConns:         defaultDBMaxIdleConns,
+		DBConnMaxLifetimeS:     defaultDBConnMaxLifetimeS,
+		DBSizeThresholdMB:      defaultDBSizeThresholdMB,
+		DecoyRotationIntervalS: defaultDecoyRotationIntervalS,
+		CORS:                   defaultCORSConfig(),
+	}
+	if !reflect.DeepEqual(*config, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, *config)
+	}
+	if config.maxRequestBodyBytes() != 4<<20 {
+		t.Errorf("Expected a 4 MB body limit, got %d", config.maxRequestBodyBytes())
+	}
+
+	// TOML works too, and unset keys keep their defaults
+	config, err = loadConfig("testdata/pqcd.toml")
+	if err != nil {
+		t.Fatalf("Failed to load TOML config: %v", err)
+	}
+	if config.Port != "9444" || config.LogLevel != "warn" || config.DecoyComplexityDefault != defaultDecoyComplexity {
+		t.Errorf("Unexpected TOML config: %+v", *config)
+	}
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	t.Setenv("PORT", "7000")
+	t.Setenv("BATCH_WORKER_COUNT", "2")
+
+	config, err := loadConfig("testdata/pqcd.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Port != "7000" || config.BatchWorkerCount != 2 {
+		t.Errorf("Expected environment variables to override the file, got %+v", *config)
+	}
+	if config.LogLevel != "debug" {
+		t.Errorf("Expected file values to remain, got log level %q", config.LogLevel)
+	}
+}
+
+func TestLoadCORSConfig(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com,https://admin.example.com")
+	t.Setenv("CORS_ALLOWED_METHODS", "GET,POST")
+	t.Setenv("CORS_MAX_AGE_SEC", "600")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+	config, err := loadConfig("testdata/pqcd.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	expected := CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://admin.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		MaxAgeSec:        600,
+		AllowCredentials: true,
+	}
+	if !reflect.DeepEqual(config.CORS, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, config.CORS)
+	}
+
+	// The policy is applied to cross-origin requests
+	handler := cors.New(config.CORS.corsOptions(false)).Handler(http.HandlerFunc(statusHandler))
+	for origin, allowed := range map[string]bool{"https://app.example.com": true, "https://evil.example.com": false} {
+		req := httptest.NewRequest("GET", "/api/status", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Access-Control-Allow-Origin") == origin; got != allowed {
+			t.Errorf("%s: Expected allowed %v, got Access-Control-Allow-Origin %q", origin, allowed, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+
+	// A wildcard origin can't be combined with credentials
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	if _, err := loadConfig("testdata/pqcd.yaml"); err == nil || !strings.Contains(err.Error(), "cors.allowed_origins") {
+		t.Errorf("Expected a wildcard origin with credentials to be rejected, got %v", err)
+	}
+}
+
+func TestValidateCORSConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   CORSConfig
+		valid bool
+	}{
+		{"default", defaultCORSConfig(), true},
+		{"wildcard without credentials", CORSConfig{AllowedOrigins: []string{"*"}}, true},
+		{"origins with credentials", CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}, true},
+		{"wildcard with credentials", CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, false},
+		{"subdomain wildcard with credentials", CORSConfig{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true}, false},
+		{"no origins", CORSConfig{}, false},
+		{"empty origin", CORSConfig{AllowedOrigins: []string{""}}, false},
+		{"invalid method", CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET POST"}}, false},
+		{"negative max age", CORSConfig{AllowedOrigins: []string{"*"}, MaxAgeSec: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateCORSConfig(tt.cfg); (err == nil) != tt.valid {
+			t.Errorf("%s: Expected valid %v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	if _, err := loadConfig("testdata/missing.yaml"); err == nil {
+		t.Error("Expected an error for a missing config file")
+	}
+
+	tests := map[string]string{
+		"PORT":                      "70000",
+		"MAX_REQUEST_BODY_MB":       "-1",
+		"LOG_LEVEL":                 "verbose",
+		"TLS_CERT_PATH":             "cert.pem",
+		"DB_MAX_IDLE_CONNS":         "50",
+		"DB_SIZE_THRESHOLD_MB":      "-1",
+		"DECOY_ROTATION_INTERVAL_S": "-1",
+		"MAX_DECOY_COUNT":           "0",
+		"MAX_DECOY_COMPLEXITY":      "6",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			_, err := loadConfig("testdata/pqcd.yaml")
+			if err == nil {
+				t.Fatalf("Expected %s=%s to be rejected", name, value)
+			}
+			if !strings.Contains(err.Error(), strings.ToLower(name)) && !strings.Contains(err.Error(), "tls_") {
+				t.Errorf("Expected the error to name the field, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateDecoyLimits(t *testing.T) {
+	t.Setenv("MAX_DECOY_COUNT", "500")
+	t.Setenv("MAX_DECOY_COMPLEXITY", "20")
+	config, err := loadConfig("testdata/pqcd.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.MaxDecoyCount != 500 || config.MaxDecoyComplexity != 20 {
+		t.Errorf("Expected the decoy caps from the environment, got %d and %d", config.MaxDecoyCount, config.MaxDecoyComplexity)
+	}
+
+	// Every problem is reported at once, one error per field
+	config = defaultConfig()
+	config.MaxDecoyCount = -1
+	config.MaxDecoyComplexity = 0
+	config.BatchWorkerCount = 0
+	fields := []string{"max_decoy_count", "max_decoy_complexity", "batch_worker_count"}
+	errs := validateConfig(config)
+	if len(errs) != len(fields) {
+		t.Fatalf("Expected %d errors, got %v", len(fields), errs)
+	}
+	for i, field := range fields {
+		if !strings.Contains(errs[i].Error(), field) {
+			t.Errorf("Expected error %d to name %s, got %v", i, field, errs[i])
+		}
+	}
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("Expected Validate to reject the decoy caps")
+	}
+	for _, field := range fields {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected Validate to name %s, got %v", field, err)
+		}
+	}
+	if errs := validateConfig(defaultConfig()); len(errs) != 0 {
+		t.Errorf("Expected the defaults to be valid, got %v", errs)
+	}
+}
+
+func TestTLSServerResponds(t *testing.T) {
+	tlsConfig, err := loadTLSConfig(defaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to configure TLS: %v", err)
+	}
+	assertServesHTTPS(t, tlsConfig)
+}
+
+func TestTLSServerWithCertFiles(t *testing.T) {
+	certPEM, keyPEM, err := generateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	t.Setenv("TLS_CERT", certFile)
+	t.Setenv("TLS_KEY", keyFile)
+
+	config, err := loadConfig("testdata/pqcd.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.TLSCertPath != certFile || config.TLSKeyPath != keyFile {
+		t.Fatalf("Expected TLS_CERT and TLS_KEY to set the TLS paths, got %q and %q", config.TLSCertPath, config.TLSKeyPath)
+	}
+	tlsConfig, err := loadTLSConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to configure TLS: %v", err)
+	}
+	assertServesHTTPS(t, tlsConfig)
+}
+
+// assertServesHTTPS starts a TLS server with the given config and checks that
+// it answers an HTTPS request
+func assertServesHTTPS(t *testing.T, tlsConfig *tls.Config) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(statusHandler), TLSConfig: tlsConfig}
+	go srv.ServeTLS(ln, "", "")
+	defer srv.Close()
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/api/status")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.TLS == nil {
+		t.Error("Expected a TLS connection")
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestCreateAdminUser(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "")
+	setupTestDB(t)
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	if count != 0 {
+		t.Fatalf("Expected no admin user without ADMIN_PASSWORD, got %d users", count)
+	}
+
+	t.Setenv("ADMIN_PASSWORD", "correct horse battery")
+	createAdminUser()
+	var hash, role string
+	if err := db.QueryRow("SELECT password_hash, role FROM users WHERE username = 'admin'").Scan(&hash, &role); err != nil {
+		t.Fatalf("Expected an admin user: %v", err)
+	}
+	if role != "admin" || bcrypt.CompareHashAndPassword([]byte(hash), []byte("correct horse battery")) != nil {
+		t.Errorf("Expected an admin with a bcrypt hash of ADMIN_PASSWORD, got role %s hash %s", role, hash)
+	}
+}
+
+func TestListDecoys(t *testing.T) {
+	setupTestDB(t)
+	for i := 0; i < 5; i++ {
+		db.Exec("INSERT INTO decoys (decoy_text, target_text, complexity, created_at) VALUES (?, 'kyber768', ?, ?)",
+			fmt.Sprintf("kyber76%d", i), i+1, fmt.Sprintf("2025-03-0%d 12:00:00", i+1))
+	}
+	db.Exec("INSERT INTO decoys (decoy_text, target_text, complexity, created_at) VALUES ('falcon511', 'falcon512', 3, '2025-03-03 12:00:00')")
+
+	list := func(query string) (int, DecoyListResponse) {
+		rec := doRequest(t, listDecoysHandler, "GET", "/api/decoys/history?"+query, nil)
+		var response DecoyListResponse
+		json.NewDecoder(rec.Body).Decode(&response)
+		return rec.Code, response
+	}
+
+	tests := []struct {
+		query  string
+		total  int
+		decoys []string
+	}{
+		{"", 6, []string{"falcon511", "kyber764", "kyber763", "kyber762", "kyber761", "kyber760"}},
+		{"target=kyber768", 5, []string{"kyber764", "kyber763", "kyber762", "kyber761", "kyber760"}},
+		{"min_complexity=2&max_complexity=3", 3, []string{"falcon511", "kyber762", "kyber761"}},
+		{"target=kyber768&from=2025-03-02T00:00:00Z&to=2025-03-04T00:00:00Z", 2, []string{"kyber762", "kyber761"}},
+		{"target=kyber768&per_page=2", 5, []string{"kyber764", "kyber763"}},
+		{"target=kyber768&per_page=2&page=3", 5, []string{"kyber760"}},
+		{"target=kyber768&per_page=2&page=4", 5, []string{}},
+	}
+	for _, tt := range tests {
+		code, response := list(tt.query)
+		if code != http.StatusOK {
+			t.Errorf("%q: Expected status %d, got %d", tt.query, http.StatusOK, code)
+			continue
+		}
+		got := []string{}
+		for _, decoy := range response.Decoys {
+			got = append(got, decoy.DecoyText)
+		}
+		if response.Total != tt.total || strings.Join(got, ",") != strings.Join(tt.decoys, ",") {
+			t.Errorf("%q: Expected %v of %d, got %v of %d", tt.query, tt.decoys, tt.total, got, response.Total)
+		}
+	}
+
+	for _, query := range []string{"min_complexity=high", "from=yesterday", "page=0", "per_page=201"} {
+		if code, _ := list(query); code != http.StatusBadRequest {
+			t.Errorf("%q: Expected status %d, got %d", query, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func TestDecoyEffectiveness(t *testing.T) {
+	setupTestDB(t)
+	result, _ := db.Exec("INSERT INTO decoys (decoy_text, target_text, complexity) VALUES ('kyber760', 'kyber768', 5)")
+	id, _ := result.LastInsertId()
+	path := fmt.Sprintf("/api/decoys/%d/effectiveness", id)
+
+	score := 0.75
+	rec := doRequest(t, decoyEffectivenessHandler, "PUT", path, EffectivenessRequest{EffectivenessScore: &score})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var record DecoyRecord
+	json.NewDecoder(rec.Body).Decode(&record)
+	if record.ID != id || record.EffectivenessScore == nil || *record.EffectivenessScore != score {
+		t.Errorf("Expected decoy %d scored %f, got %+v", id, score, record)
+	}
+
+	for _, body := range []interface{}{map[string]float64{"effectiveness_score": 1.5}, map[string]float64{"effectiveness_score": -0.1}, map[string]string{}} {
+		if rec := doRequest(t, decoyEffectivenessHandler, "PUT", path, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %v, got %d", http.StatusBadRequest, body, rec.Code)
+		}
+	}
+	if rec := doRequest(t, decoyEffectivenessHandler, "PUT", "/api/decoys/999/effectiveness", EffectivenessRequest{EffectivenessScore: &score}); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown decoy, got %d", http.StatusNotFound, rec.Code)
+	}
+	if rec := doRequest(t, decoyEffectivenessHandler, "PUT", "/api/decoys/abc/effectiveness", EffectivenessRequest{EffectivenessScore: &score}); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an invalid ID, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestStreamEncryptDecrypt(t *testing.T) {
+	setupTestDB(t)
+
+	keyPair, err := crypto.GenerateKeyPair(crypto.AlgoKyber)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	payload := make([]byte, 10<<20)
+	if _, err := rand.Read(payload); err != nil {
+		t.Fatalf("Failed to generate payload: %v", err)
+	}
+
+	stream := func(handler http.HandlerFunc, path, header string, key, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		req.RemoteAddr = testIP + ":51234"
+		req.Header.Set(header, base64.StdEncoding.EncodeToString(key))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	encrypted := stream(encryptStreamHandler, "/api/encrypt/stream", streamPublicKeyHeader, keyPair.PublicKey, payload)
+	if encrypted.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, encrypted.Code, encrypted.Body.String())
+	}
+	if !encrypted.Flushed || encrypted.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("Expected a flushed binary stream, got flushed=%v %q", encrypted.Flushed, encrypted.Header().Get("Content-Type"))
+	}
+	ciphertext := encrypted.Body.Bytes()
+
+	decrypted := stream(decryptStreamHandler, "/api/decrypt/stream", streamPrivateKeyHeader, keyPair.PrivateKey, ciphertext)
+	if decrypted.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, decrypted.Code, decrypted.Body.String())
+	}
+	if !bytes.Equal(decrypted.Body.Bytes(), payload) {
+		t.Fatalf("Decrypted stream does not match the %d byte payload", len(payload))
+	}
+
+	var events int
+	db.QueryRow("SELECT COUNT(*) FROM event_logs WHERE event_type IN ('encryption', 'decryption') AND description LIKE '%10485760 byte stream%'").Scan(&events)
+	if events != 2 {
+		t.Errorf("Expected both streams to be logged, got %d events", events)
+	}
+
+	// Errors before any output still get a status code
+	truncated := ciphertext[:4+crypto.KyberCiphertextSize+100]
+	if rec := stream(decryptStreamHandler, "/api/decrypt/stream", streamPrivateKeyHeader, keyPair.PrivateKey, truncated); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a truncated stream, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if rec := stream(encryptStreamHandler, "/api/encrypt/stream", streamPublicKeyHeader, nil, payload[:10]); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without a public key, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if rec := stream(decryptStreamHandler, "/api/decrypt/stream", streamPrivateKeyHeader, keyPair.PublicKey, ciphertext); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a key of the wrong size, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	setupTestDB(t)
+
+	// A handler that is still writing to the database when shutdown starts
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := trackInFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		if _, err := db.ExecContext(r.Context(), "INSERT INTO event_logs (event_type, severity) VALUES ('shutdown_test', 'INFO')"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(listener)
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post("http://"+listener.Addr().String(), "text/plain", nil)
+		if err != nil {
+			t.Errorf("In-flight request failed: %v", err)
+			close(responses)
+			return
+		}
+		resp.Body.Close()
+		responses <- resp
+	}()
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		shutdown([]*http.Server{srv}, 5*time.Second)
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("Expected shutdown to wait for the in-flight request")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	if resp, ok := <-responses; !ok || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected the in-flight request to complete, got %+v", resp)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not finish")
+	}
+	if err := db.Ping(); err == nil {
+		t.Error("Expected the database to be closed after shutdown")
+	}
+}
+
+// withAIService points the decoy generator at handler, with retries shortened
+// for the duration of a test
+func withAIService(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previousURL, previousDelay := appConfig.AIServiceURL, aiRetryBaseDelay
+	appConfig.AIServiceURL = server.URL
+	aiRetryBaseDelay = time.Millisecond
+	t.Cleanup(func() {
+		server.Close()
+		appConfig.AIServiceURL, aiRetryBaseDelay = previousURL, previousDelay
+	})
+}
+
+func TestDecoyGenerationRetriesAIService(t *testing.T) {
+	setupTestDB(t)
+	var attempts int32
+	withAIService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			// Drop the connection, as a network error
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Failed to hijack connection: %v", err)
+				return
+			}
+			conn.Close()
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"decoys": []string{"kyber767", "kyber769"}})
+		}
+	})
+
+	rec := doRequest(t, decoyGenerationHandler, "POST", "/api/decoys/generate", DecoyRequest{Target: "kyber768", Count: 2})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Decoy generation failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var response DecoyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if strings.Join(response.Decoys, ",") != "kyber767,kyber769" {
+		t.Errorf("Expected the AI service's decoys, got %v", response.Decoys)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestDecoyGenerationFallsBackAfterRetries(t *testing.T) {
+	setupTestDB(t)
+	var attempts int32
+	withAIService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	rec := doRequest(t, decoyGenerationHandler, "POST", "/api/decoys/generate", DecoyRequest{Target: "kyber768", Count: 2})
+	var response DecoyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if strings.Join(response.Decoys, ",") != "kyber768_v1,kyber768_prime" {
+		t.Errorf("Expected the fallback decoys, got %v", response.Decoys)
+	}
+	if attempts != aiMaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", aiMaxAttempts, attempts)
+	}
+}
+
+func TestDecoyGenerationLimits(t *testing.T) {
+	setupTestDB(t)
+	var attempts int32
+	withAIService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"decoys": []string{"kyber767"}})
+	})
+	previousCount, previousComplexity := appConfig.MaxDecoyCount, appConfig.MaxDecoyComplexity
+	appConfig.MaxDecoyCount, appConfig.MaxDecoyComplexity = 3, 6
+	t.Cleanup(func() {
+		appConfig.MaxDecoyCount, appConfig.MaxDecoyComplexity = previousCount, previousComplexity
+	})
+
+	rejected := map[string]DecoyRequest{
+		"count":      {Target: "kyber768", Count: 4},
+		"complexity": {Target: "kyber768", Count: 2, Complexity: 7},
+		"huge count": {Target: "kyber768", Count: 1000000},
+	}
+	for name, req := range rejected {
+		rec := doRequest(t, decoyGenerationHandler, "POST", "/api/decoys/generate", req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: Expected status %d, got %d", name, http.StatusBadRequest, rec.Code)
+		}
+	}
+	if attempts != 0 {
+		t.Errorf("Expected rejected requests not to reach the AI service, got %d calls", attempts)
+	}
+
+	// Requests at the caps, or relying on a default count above the count
+	// cap, go through
+	for _, req := range []DecoyRequest{
+		{Target: "kyber768", Count: 3, Complexity: 6},
+		{Target: "kyber768"},
+	} {
+		rec := doRequest(t, decoyGenerationHandler, "POST", "/api/decoys/generate", req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status %d for %+v, got %d: %s", http.StatusOK, req, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestCallAIWithRetry(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	// A 4xx response is not retried
+	if _, err := callAIWithRetry(context.Background(), server.URL, []byte("{}"), 3, time.Millisecond); err == nil {
+		t.Error("Expected an error for a 400 response")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected a 400 response not to be retried, got %d attempts", attempts)
+	}
+
+	// Cancelling the context stops the wait between attempts
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := callAIWithRetry(ctx, unavailable.URL, []byte("{}"), 10, time.Second)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context deadline to end retries, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected retries to stop with the context, took %s", elapsed)
+	}
+}
+
+// withHealthyDependencies sets up a database and an AI service that pass the
+// detailed health check, so a test can break one subsystem at a time
+func withHealthyDependencies(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	withAIService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+		}
+	})
+	dbFile := filepath.Join(t.TempDir(), "size.db")
+	if err := os.WriteFile(dbFile, []byte("small"), 0o600); err != nil {
+		t.Fatalf("Failed to create database file: %v", err)
+	}
+	previousPath, previousThreshold := appConfig.DatabasePath, appConfig.DBSizeThresholdMB
+	appConfig.DatabasePath, appConfig.DBSizeThresholdMB = dbFile, 1
+	t.Cleanup(func() {
+		appConfig.DatabasePath, appConfig.DBSizeThresholdMB = previousPath, previousThreshold
+	})
+}
+
+// getDetailedHealth runs the detailed health check
+func getDetailedHealth(t *testing.T) (int, DetailedHealthResponse) {
+	t.Helper()
+	rec := doRequest(t, detailedHealthHandler, "GET", "/api/health/detailed", nil)
+	var response DetailedHealthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+	return rec.Code, response
+}
+
+func TestDetailedHealth(t *testing.T) {
+	withHealthyDependencies(t)
+
+	code, response := getDetailedHealth(t)
+	if code != http.StatusOK || response.Status != healthOK {
+		t.Fatalf("Expected a healthy response, got %d %+v", code, response)
+	}
+	for _, name := range []string{"database", "ai_service", "crypto", "disk"} {
+		subsystem, ok := response.Subsystems[name]
+		if !ok {
+			t.Errorf("Expected the %s subsystem to be reported", name)
+			continue
+		}
+		if subsystem.Status != healthOK || subsystem.Error != "" || subsystem.Latency < 0 {
+			t.Errorf("Expected %s to be ok, got %+v", name, subsystem)
+		}
+	}
+}
+
+func TestDetailedHealthDatabaseDown(t *testing.T) {
+	withHealthyDependencies(t)
+	db.Close()
+
+	code, response := getDetailedHealth(t)
+	if code != http.StatusServiceUnavailable || response.Status != healthDown {
+		t.Errorf("Expected 503 and down, got %d %s", code, response.Status)
+	}
+	if database := response.Subsystems["database"]; database.Status != healthDown || database.Error == "" {
+		t.Errorf("Expected the database to be down with an error, got %+v", database)
+	}
+	if others := response.Subsystems["crypto"]; others.Status != healthOK {
+		t.Errorf("Expected the other subsystems to stay ok, got crypto %+v", others)
+	}
+}
+
+func TestDetailedHealthAIServiceDegraded(t *testing.T) {
+	withHealthyDependencies(t)
+
+	for name, handler := range map[string]http.HandlerFunc{
+		"error": func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) },
+		"slow": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(aiHealthTimeout + time.Second):
+			case <-r.Context().Done():
+			}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			withAIService(t, handler)
+			code, response := getDetailedHealth(t)
+			if code != http.StatusOK || response.Status != healthDegraded {
+				t.Errorf("Expected 200 and degraded, got %d %s", code, response.Status)
+			}
+			if ai := response.Subsystems["ai_service"]; ai.Status != healthDegraded || ai.Error == "" {
+				t.Errorf("Expected the AI service to be degraded with an error, got %+v", ai)
+			}
+		})
+	}
+}
+
+func TestDetailedHealthCryptoFailures(t *testing.T) {
+	withHealthyDependencies(t)
+	previous := healthKeyGen
+	t.Cleanup(func() { healthKeyGen = previous })
+
+	// One algorithm failing degrades crypto
+	healthKeyGen = func(algorithm string) (*crypto.KeyPair, error) {
+		if algorithm == crypto.AlgoNTRU {
+			return nil, errors.New("entropy source unavailable")
+		}
+		return previous(algorithm)
+	}
+	code, response := getDetailedHealth(t)
+	if code != http.StatusOK || response.Status != healthDegraded {
+		t.Errorf("Expected 200 and degraded with one algorithm failing, got %d %s", code, response.Status)
+	}
+	if c := response.Subsystems["crypto"]; c.Status != healthDegraded || !strings.Contains(c.Error, crypto.AlgoNTRU) {
+		t.Errorf("Expected crypto to be degraded naming %s, got %+v", crypto.AlgoNTRU, c)
+	}
+
+	// Every algorithm failing takes crypto down
+	healthKeyGen = func(algorithm string) (*crypto.KeyPair, error) {
+		return nil, errors.New("entropy source unavailable")
+	}
+	code, response = getDetailedHealth(t)
+	if code != http.StatusServiceUnavailable || response.Status != healthDown {
+		t.Errorf("Expected 503 and down with every algorithm failing, got %d %s", code, response.Status)
+	}
+	if c := response.Subsystems["crypto"]; c.Status != healthDown {
+		t.Errorf("Expected crypto to be down, got %+v", c)
+	}
+}
+
+func TestDetailedHealthDiskDegraded(t *testing.T) {
+	withHealthyDependencies(t)
+	// A sparse file takes up no space but reports its full size
+	if err := os.Truncate(appConfig.DatabasePath, 2<<20); err != nil {
+		t.Fatalf("Failed to grow database file: %v", err)
+	}
+
+	code, response := getDetailedHealth(t)
+	if code != http.StatusOK || response.Status != healthDegraded {
+		t.Errorf("Expected 200 and degraded, got %d %s", code, response.Status)
+	}
+	if disk := response.Subsystems["disk"]; disk.Status != healthDegraded || !strings.Contains(disk.Error, "threshold") {
+		t.Errorf("Expected the disk to be degraded over the threshold, got %+v", disk)
+	}
+
+	// A threshold of zero turns the check off
+	appConfig.DBSizeThresholdMB = 0
+	if _, response := getDetailedHealth(t); response.Subsystems["disk"].Status != healthOK {
+		t.Errorf("Expected the disk check to be off, got %+v", response.Subsystems["disk"])
+	}
+}
+
+func TestWorseHealth(t *testing.T) {
+	tests := []struct{ a, b, want string }{
+		{healthOK, healthOK, healthOK},
+		{healthOK, healthDegraded, healthDegraded},
+		{healthDegraded, healthOK, healthDegraded},
+		{healthDegraded, healthDown, healthDown},
+		{healthDown, healthDegraded, healthDown},
+	}
+	for _, tc := range tests {
+		if got := worseHealth(tc.a, tc.b); got != tc.want {
+			t.Errorf("worseHealth(%s, %s) = %s, expected %s", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
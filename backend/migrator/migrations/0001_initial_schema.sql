@@ -0,0 +1,59 @@
+-- Schema as originally created by createTables
+CREATE TABLE IF NOT EXISTS key_pairs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    public_key BLOB NOT NULL,
+    private_key BLOB NOT NULL,
+    fingerprint TEXT NOT NULL,
+    algorithm TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_real BOOLEAN DEFAULT 1,
+    tags TEXT,
+    source_ip TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_key_pairs_fingerprint ON key_pairs(fingerprint);
+CREATE INDEX IF NOT EXISTS idx_key_pairs_algorithm ON key_pairs(algorithm);
+CREATE INDEX IF NOT EXISTS idx_key_pairs_is_real ON key_pairs(is_real);
+
+CREATE TABLE IF NOT EXISTS decoys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    decoy_text TEXT NOT NULL,
+    target_text TEXT NOT NULL,
+    complexity INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    effectiveness_score REAL
+);
+
+CREATE INDEX IF NOT EXISTS idx_decoys_target ON decoys(target_text);
+
+CREATE TABLE IF NOT EXISTS event_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type TEXT NOT NULL,
+    description TEXT,
+    source_ip TEXT,
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    severity TEXT CHECK (severity IN ('INFO', 'WARNING', 'ERROR', 'CRITICAL')),
+    related_item_id INTEGER,
+    related_item_type TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_logs_type_time ON event_logs(event_type, timestamp);
+CREATE INDEX IF NOT EXISTS idx_event_logs_ip_type ON event_logs(source_ip, event_type);
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login TIMESTAMP,
+    role TEXT CHECK (role IN ('admin', 'user', 'readonly')) DEFAULT 'user'
+);
+
+CREATE TABLE IF NOT EXISTS block_list (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ip TEXT NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_block_list_ip ON block_list(ip);
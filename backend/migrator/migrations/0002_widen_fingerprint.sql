@@ -0,0 +1,23 @@
+-- Fingerprints are colon-separated SHA-256 digests: 32 hex pairs and 31 colons.
+-- SQLite cannot alter a column type, so the table is rebuilt.
+CREATE TABLE key_pairs_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    public_key BLOB NOT NULL,
+    private_key BLOB NOT NULL,
+    fingerprint VARCHAR(95) NOT NULL,
+    algorithm TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_real BOOLEAN DEFAULT 1,
+    tags TEXT,
+    source_ip TEXT
+);
+
+INSERT INTO key_pairs_new (id, public_key, private_key, fingerprint, algorithm, created_at, is_real, tags, source_ip)
+SELECT id, public_key, private_key, fingerprint, algorithm, created_at, is_real, tags, source_ip FROM key_pairs;
+
+DROP TABLE key_pairs;
+ALTER TABLE key_pairs_new RENAME TO key_pairs;
+
+CREATE INDEX idx_key_pairs_fingerprint ON key_pairs(fingerprint);
+CREATE INDEX idx_key_pairs_algorithm ON key_pairs(algorithm);
+CREATE INDEX idx_key_pairs_is_real ON key_pairs(is_real);
@@ -0,0 +1,5 @@
+-- Keys generated with a TTL are purged once expires_at has passed.
+-- NULL means the key never expires.
+ALTER TABLE key_pairs ADD COLUMN expires_at TIMESTAMP;
+
+CREATE INDEX idx_key_pairs_expires_at ON key_pairs(expires_at);
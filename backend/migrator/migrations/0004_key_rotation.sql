@@ -0,0 +1,3 @@
+-- A rotated key points at its replacement. Superseded keys are kept so
+-- ciphertext from before the rotation can still be decrypted.
+ALTER TABLE key_pairs ADD COLUMN superseded_by INTEGER REFERENCES key_pairs(id);
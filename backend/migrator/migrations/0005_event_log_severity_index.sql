@@ -0,0 +1,2 @@
+-- Event logs are listed by severity within a time range.
+CREATE INDEX IF NOT EXISTS idx_event_logs_severity_time ON event_logs(severity, timestamp);
@@ -0,0 +1,10 @@
+-- Decoy keys that carry a canary token, and whether anyone has used them.
+CREATE TABLE IF NOT EXISTS canary_tokens (
+    token_id TEXT PRIMARY KEY,
+    key_pair_id INTEGER REFERENCES key_pairs(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    first_triggered_at TIMESTAMP,
+    last_triggered_at TIMESTAMP,
+    trigger_count INTEGER NOT NULL DEFAULT 0,
+    last_source_ip TEXT
+);
@@ -0,0 +1,2 @@
+-- Decoy history is filtered by target and complexity.
+CREATE INDEX IF NOT EXISTS idx_decoys_target_complexity ON decoys(target_text, complexity);
@@ -0,0 +1,3 @@
+-- How hard each decoy key is to tell apart from its real key, from 0 to 1.
+-- NULL for real keys and decoys stored before scoring existed.
+ALTER TABLE key_pairs ADD COLUMN effectiveness_score REAL;
@@ -0,0 +1,27 @@
+-- Public keys imported without their private key store NULL in private_key.
+-- SQLite cannot drop a NOT NULL constraint, so the table is rebuilt.
+CREATE TABLE key_pairs_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    public_key BLOB NOT NULL,
+    private_key BLOB,
+    fingerprint VARCHAR(95) NOT NULL,
+    algorithm TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_real BOOLEAN DEFAULT 1,
+    tags TEXT,
+    source_ip TEXT,
+    expires_at TIMESTAMP,
+    superseded_by INTEGER REFERENCES key_pairs(id),
+    effectiveness_score REAL
+);
+
+INSERT INTO key_pairs_new (id, public_key, private_key, fingerprint, algorithm, created_at, is_real, tags, source_ip, expires_at, superseded_by, effectiveness_score)
+SELECT id, public_key, private_key, fingerprint, algorithm, created_at, is_real, tags, source_ip, expires_at, superseded_by, effectiveness_score FROM key_pairs;
+
+DROP TABLE key_pairs;
+ALTER TABLE key_pairs_new RENAME TO key_pairs;
+
+CREATE INDEX idx_key_pairs_fingerprint ON key_pairs(fingerprint);
+CREATE INDEX idx_key_pairs_algorithm ON key_pairs(algorithm);
+CREATE INDEX idx_key_pairs_is_real ON key_pairs(is_real);
+CREATE INDEX idx_key_pairs_expires_at ON key_pairs(expires_at);
@@ -0,0 +1,11 @@
+-- Operations performed with each key, counted to spot enumeration attacks.
+CREATE TABLE IF NOT EXISTS key_usage (
+    fingerprint TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    last_used TIMESTAMP,
+    UNIQUE (fingerprint, operation)
+);
+
+-- Set on keys used for more than 1000 encapsulations in an hour.
+ALTER TABLE key_pairs ADD COLUMN flagged BOOLEAN DEFAULT 0;
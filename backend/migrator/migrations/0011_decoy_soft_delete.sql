@@ -0,0 +1,3 @@
+-- Set on decoy keys the rotator has replaced. They are kept so canary tokens
+-- on them still trigger, but are no longer handed out.
+ALTER TABLE key_pairs ADD COLUMN deleted_at TIMESTAMP;
@@ -0,0 +1,10 @@
+-- Key pairs generated in the background for POST /api/keys/generate/scheduled.
+-- key_id is set once the job completes, error once it fails.
+CREATE TABLE IF NOT EXISTS keygen_jobs (
+    id TEXT PRIMARY KEY,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    key_id INTEGER REFERENCES key_pairs(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    error TEXT
+);
@@ -0,0 +1,6 @@
+-- Tags are stored as a JSON array so they can be matched exactly with
+-- json_each. Tag names can't contain quotes or commas, so the comma-separated
+-- values stored before convert by wrapping and splitting the string.
+UPDATE key_pairs
+SET tags = CASE WHEN tags = '' THEN '[]' ELSE '["' || replace(tags, ',', '","') || '"]' END
+WHERE tags IS NOT NULL AND tags NOT LIKE '[%';
@@ -0,0 +1,5 @@
+-- Decoys record the fingerprint of the real key they were generated for, so
+-- they can be listed by it. NULL on real keys and on decoys stored before.
+ALTER TABLE key_pairs ADD COLUMN origin_fingerprint TEXT;
+
+CREATE INDEX idx_key_pairs_origin_fingerprint ON key_pairs(origin_fingerprint);
@@ -0,0 +1,173 @@
+package migrator
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTestDB opens an empty database file
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrator_test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// appliedVersions returns the recorded migration versions in order
+func appliedVersions(t *testing.T, db *sql.DB) []int {
+	t.Helper()
+	rows, err := db.Query("SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatalf("Failed to query schema_migrations: %v", err)
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var version int
+		rows.Scan(&version)
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// columnType returns the declared type of a column
+func columnType(t *testing.T, db *sql.DB, table, column string) string {
+	t.Helper()
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatalf("Failed to read table info: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, columnType string
+		rows.Scan(&name, &columnType)
+		if name == column {
+			return columnType
+		}
+	}
+	return ""
+}
+
+func TestRunIsIdempotent(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := Run(db); err != nil {
+		t.Fatalf("First run failed: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm) VALUES (x'01', x'02', 'aa:bb', 'ml-kem-768')"); err != nil {
+		t.Fatalf("Failed to insert key pair: %v", err)
+	}
+	if err := Run(db); err != nil {
+		t.Fatalf("Second run failed: %v", err)
+	}
+
+	versions := appliedVersions(t, db)
+	if len(versions) != 14 || versions[0] != 1 || versions[13] != 14 {
+		t.Errorf("Expected migrations 1 to 14 to be applied once, got %v", versions)
+	}
+	if got := columnType(t, db, "key_pairs", "fingerprint"); got != "VARCHAR(95)" {
+		t.Errorf("Expected fingerprint to be VARCHAR(95), got %q", got)
+	}
+	if got := columnType(t, db, "key_pairs", "expires_at"); got != "TIMESTAMP" {
+		t.Errorf("Expected expires_at to be TIMESTAMP, got %q", got)
+	}
+	if got := columnType(t, db, "key_pairs", "superseded_by"); got != "INTEGER" {
+		t.Errorf("Expected superseded_by to be INTEGER, got %q", got)
+	}
+	if _, err := db.Exec("INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm) VALUES (x'03', NULL, 'cc:dd', 'ml-kem-768')"); err != nil {
+		t.Errorf("Expected a public key without a private key to be accepted: %v", err)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM key_pairs").Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected the key pair to survive a second run, got %d rows", count)
+	}
+}
+
+func TestWidenFingerprintKeepsData(t *testing.T) {
+	db := openTestDB(t)
+
+	// A database created by the original createTables
+	m := New(db)
+	m.files = fstest.MapFS{"0001_initial_schema.sql": mustReadEmbedded(t, "0001_initial_schema.sql")}
+	if err := m.Run(); err != nil {
+		t.Fatalf("Initial migration failed: %v", err)
+	}
+	db.Exec("INSERT INTO key_pairs (public_key, private_key, fingerprint, algorithm, source_ip) VALUES (x'01', x'02', 'aa:bb', 'ml-kem-768', '192.0.2.1')")
+
+	if err := Run(db); err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+
+	var fingerprint, sourceIP string
+	if err := db.QueryRow("SELECT fingerprint, source_ip FROM key_pairs WHERE id = 1").Scan(&fingerprint, &sourceIP); err != nil {
+		t.Fatalf("Failed to read migrated key pair: %v", err)
+	}
+	if fingerprint != "aa:bb" || sourceIP != "192.0.2.1" {
+		t.Errorf("Expected the key pair to be copied unchanged, got %q %q", fingerprint, sourceIP)
+	}
+
+	var indexes int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = 'key_pairs' AND name LIKE 'idx_%'").Scan(&indexes)
+	// Three recreated by the rebuild, plus the expiry and origin fingerprint indexes
+	if indexes != 5 {
+		t.Errorf("Expected 5 key_pairs indexes after the rebuild, got %d", indexes)
+	}
+}
+
+func TestRunRollsBackFailedMigration(t *testing.T) {
+	db := openTestDB(t)
+	m := New(db)
+	m.files = fstest.MapFS{
+		"0001_create.sql": {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY);")},
+		"0002_broken.sql": {Data: []byte("CREATE TABLE gadgets (id INTEGER PRIMARY KEY); INSERT INTO missing VALUES (1);")},
+		"0003_later.sql":  {Data: []byte("CREATE TABLE gizmos (id INTEGER PRIMARY KEY);")},
+	}
+
+	if err := m.Run(); err == nil {
+		t.Fatal("Expected the broken migration to fail")
+	}
+
+	if versions := appliedVersions(t, db); len(versions) != 1 || versions[0] != 1 {
+		t.Errorf("Expected only migration 1 to be recorded, got %v", versions)
+	}
+	for table, exists := range map[string]bool{"widgets": true, "gadgets": false, "gizmos": false} {
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
+		if (count == 1) != exists {
+			t.Errorf("Expected table %s to exist: %v", table, exists)
+		}
+	}
+}
+
+func TestLoadRejectsBadFileNames(t *testing.T) {
+	db := openTestDB(t)
+	for _, files := range []fstest.MapFS{
+		{"initial.sql": {Data: []byte("SELECT 1;")}},
+		{"0001_a.sql": {Data: []byte("SELECT 1;")}, "1_b.sql": {Data: []byte("SELECT 1;")}},
+	} {
+		m := New(db)
+		m.files = files
+		if err := m.Run(); err == nil {
+			t.Errorf("Expected an error for %v", files)
+		}
+	}
+}
+
+// mustReadEmbedded returns an embedded migration as a test file
+func mustReadEmbedded(t *testing.T, name string) *fstest.MapFile {
+	t.Helper()
+	data, err := embedded.ReadFile("migrations/" + name)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	return &fstest.MapFile{Data: data}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Default interval between expired key purges
+const defaultKeyPurgeInterval = time.Minute
+
+// sqliteTimestampFormat matches CURRENT_TIMESTAMP, so stored expiry times compare
+// correctly as text
+const sqliteTimestampFormat = "2006-01-02 15:04:05"
+
+// expiryTimestamp returns the stored expires_at value for a key created now with
+// a TTL, or nil if the key never expires
+func expiryTimestamp(now time.Time, ttlSeconds int64) interface{} {
+	if ttlSeconds <= 0 {
+		return nil
+	}
+	return now.Add(time.Duration(ttlSeconds) * time.Second).UTC().Format(sqliteTimestampFormat)
+}
+
+// startKeyPurger deletes expired key pairs every interval until stop is closed
+func startKeyPurger(db *sql.DB, interval time.Duration) chan<- struct{} {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := purgeExpiredKeys(db, time.Now()); err != nil {
+					log.Printf("Failed to purge expired keys: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return stop
+}
+
+// purgeExpiredKeys zeroises and deletes every key pair whose expiry is before
+// now, logging the count to event_logs. It returns the number of keys purged.
+func purgeExpiredKeys(db *sql.DB, now time.Time) (int64, error) {
+	const where = "expires_at IS NOT NULL AND expires_at < ?"
+	cutoff := now.UTC().Format(sqliteTimestampFormat)
+
+	ctx, cancel := dbContext(context.Background())
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Overwrite the key material first so it does not linger in freed pages
+	_, err = tx.ExecContext(ctx,
+		"UPDATE key_pairs SET public_key = zeroblob(length(public_key)), private_key = zeroblob(length(private_key)) WHERE "+where,
+		cutoff,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to zeroise expired keys: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM key_pairs WHERE "+where, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired keys: %w", err)
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count expired keys: %w", err)
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO event_logs (event_type, description, severity) VALUES (?, ?, ?)",
+		"key_expiry", fmt.Sprintf("Purged %d expired key pairs", purged), "INFO",
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to log key purge: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit key purge: %w", err)
+	}
+	log.Printf("Purged %d expired key pairs", purged)
+	return purged, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// shutdownTimeout is how long shutdown waits for in-flight requests
+const shutdownTimeout = 15 * time.Second
+
+// inFlight counts the requests being handled, so shutdown can let their
+// database writes finish before closing db
+var inFlight sync.WaitGroup
+
+// trackInFlight counts each request in inFlight until its handler returns
+func trackInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shutdown stops the servers accepting requests, waits up to timeout for the
+// ones in flight and then closes db. Requests still running when timeout
+// expires have their database calls fail rather than holding up the exit.
+func shutdown(servers []*http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shut down server on %s: %v", srv.Addr, err)
+		}
+	}
+
+	// Shutdown doesn't wait for hijacked connections, and gives up at the
+	// deadline, so wait for the handlers themselves too
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Shutdown timed out after %s with requests still in flight", timeout)
+	}
+
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+	log.Printf("Server shutdown complete")
+}
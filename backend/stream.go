@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/pqcd/backend/crypto"
+)
+
+// Headers carrying the key and algorithm of a streamed request, whose body is
+// the payload itself
+const (
+	streamPublicKeyHeader  = "X-Public-Key"
+	streamPrivateKeyHeader = "X-Private-Key"
+	streamAlgorithmHeader  = "X-Algorithm"
+)
+
+// streamResponseWriter records whether any of a streamed response has been
+// written, after which an error can no longer be reported with a status code
+type streamResponseWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *streamResponseWriter) Write(p []byte) (int, error) {
+	if w.written == 0 {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *streamResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Streaming encryption handler. Encrypts a request body of any size chunk by
+// chunk for the base64 public key in X-Public-Key, writing each encrypted frame
+// as soon as it is ready so neither side holds the whole payload in memory.
+func encryptStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	algorithm := streamAlgorithm(r)
+	publicKey, err := base64.StdEncoding.DecodeString(r.Header.Get(streamPublicKeyHeader))
+	if err != nil || len(publicKey) == 0 {
+		sendErrorResponse(w, "Public key is required", http.StatusBadRequest, streamPublicKeyHeader+" must hold a base64 public key")
+		return
+	}
+	checkCanaryKey(publicKey, r)
+
+	publicKeySize, _, err := crypto.KeySizes(algorithm)
+	if err != nil {
+		sendErrorResponse(w, "Unsupported algorithm", http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(publicKey) != publicKeySize {
+		sendErrorResponse(w, "Invalid public key size", http.StatusBadRequest,
+			fmt.Sprintf("expected %d bytes for %s, got %d", publicKeySize, algorithm, len(publicKey)))
+		return
+	}
+
+	body := &countingReader{Reader: r.Body}
+	out := &streamResponseWriter{ResponseWriter: w}
+	if err := crypto.EncryptStream(out, body, publicKey, algorithm); err != nil {
+		failStream(w, out, r, "Encryption failed", err)
+		return
+	}
+
+	logStreamEvent(r, "encryption", fmt.Sprintf("Encrypted %d byte stream using %s algorithm", body.read, algorithm))
+}
+
+// Streaming decryption handler. Reverses encryptStreamHandler with the base64
+// private key in X-Private-Key, writing each chunk of plaintext once it has
+// been authenticated.
+func decryptStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	algorithm := streamAlgorithm(r)
+	privateKey, err := base64.StdEncoding.DecodeString(r.Header.Get(streamPrivateKeyHeader))
+	if err != nil || len(privateKey) == 0 {
+		sendErrorResponse(w, "Private key is required", http.StatusBadRequest, streamPrivateKeyHeader+" must hold a base64 private key")
+		return
+	}
+	defer crypto.ZeroBytes(privateKey)
+	checkCanaryKey(privateKey, r)
+
+	_, privateKeySize, err := crypto.KeySizes(algorithm)
+	if err != nil {
+		sendErrorResponse(w, "Unsupported algorithm", http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(privateKey) != privateKeySize {
+		sendErrorResponse(w, "Invalid private key size", http.StatusBadRequest,
+			fmt.Sprintf("expected %d bytes for %s, got %d", privateKeySize, algorithm, len(privateKey)))
+		return
+	}
+
+	out := &streamResponseWriter{ResponseWriter: w}
+	if err := crypto.DecryptStream(out, r.Body, privateKey); err != nil {
+		failStream(w, out, r, "Decryption failed", err)
+		return
+	}
+
+	logStreamEvent(r, "decryption", fmt.Sprintf("Decrypted %d byte stream using %s algorithm", out.written, algorithm))
+}
+
+// streamAlgorithm returns the algorithm requested in X-Algorithm, defaulting
+// to Kyber like the buffered endpoints
+func streamAlgorithm(r *http.Request) string {
+	if algorithm := r.Header.Get(streamAlgorithmHeader); algorithm != "" {
+		return algorithm
+	}
+	return crypto.AlgoKyber
+}
+
+// failStream reports a streaming error with a status code if nothing has been
+// sent yet. Otherwise the connection is aborted, so the client sees a broken
+// transfer rather than a response that merely ends early.
+func failStream(w http.ResponseWriter, out *streamResponseWriter, r *http.Request, message string, err error) {
+	if out.written == 0 {
+		sendErrorResponse(w, message, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("Error: %s after %d bytes: %v [request_id=%s]", message, out.written, err, requestID(r))
+	panic(http.ErrAbortHandler)
+}
+
+// logStreamEvent records a completed streaming operation in event_logs
+func logStreamEvent(r *http.Request, eventType, description string) {
+	ctx, cancel := dbContext(r.Context())
+	defer cancel()
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO event_logs (event_type, description, source_ip, severity) VALUES (?, ?, ?, ?)",
+		eventType, withRequestID(description, r), clientIP(r), "INFO",
+	)
+	if err != nil {
+		log.Printf("Failed to log %s event: %v", eventType, err)
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.Reader
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
@@ -0,0 +1,173 @@
+package benchmark
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"pqcd/crypto"
+)
+
+func TestPrometheusCollectors(t *testing.T) {
+	m := NewMetricsCollector()
+	reg := prometheus.NewRegistry()
+	m.RegisterPrometheusCollectors(reg)
+
+	m.RecordOperation(context.Background(), crypto.AlgMLKEM768, "KeyGen", 200*time.Microsecond, 0, 1184, true)
+	m.RecordOperation(context.Background(), crypto.AlgMLKEM768, "KeyGen", 2*time.Millisecond, 0, 1184, false)
+	m.RecordOperation(context.Background(), crypto.AlgECDH, "Encapsulate", time.Millisecond, 65, 65, true)
+
+	if count := testutil.ToFloat64(m.operationCount.WithLabelValues(string(crypto.AlgMLKEM768), "KeyGen")); count != 2 {
+		t.Errorf("Expected 2 ML-KEM-768 KeyGen operations, got %v", count)
+	}
+	if count := testutil.ToFloat64(m.operationCount.WithLabelValues(string(crypto.AlgECDH), "Encapsulate")); count != 1 {
+		t.Errorf("Expected 1 ECDH Encapsulate operation, got %v", count)
+	}
+	if rate := testutil.ToFloat64(m.successRate.WithLabelValues(string(crypto.AlgMLKEM768), "KeyGen")); rate != 0.5 {
+		t.Errorf("Expected success rate 0.5, got %v", rate)
+	}
+	if n := testutil.CollectAndCount(m.operationLatency); n != 2 {
+		t.Errorf("Expected 2 latency series, got %d", n)
+	}
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	// Uniform latencies from 1 to 50000µs, more than the reservoir holds
+	h := NewLatencyHistogram()
+	for _, i := range rand.Perm(50000) {
+		h.Add(float64(i + 1))
+	}
+
+	for _, p := range []float64{50, 95, 99} {
+		expected := p / 100 * 50000
+		got := h.Percentile(p)
+		if math.Abs(got-expected)/expected > 0.02 {
+			t.Errorf("Expected P%v within 2%% of %v, got %v", p, expected, got)
+		}
+	}
+
+	small := NewLatencyHistogram()
+	if small.Percentile(50) != 0 {
+		t.Errorf("Expected 0 for an empty histogram, got %v", small.Percentile(50))
+	}
+	for _, latency := range []float64{40, 10, 30, 20} {
+		small.Add(latency)
+	}
+	if got := small.Percentile(50); got != 25 {
+		t.Errorf("Expected an interpolated median of 25, got %v", got)
+	}
+	if small.Percentile(0) != 10 || small.Percentile(100) != 40 {
+		t.Errorf("Expected P0 and P100 to be the extremes, got %v and %v", small.Percentile(0), small.Percentile(100))
+	}
+}
+
+func TestMetricsPercentilesJSON(t *testing.T) {
+	m := NewMetricsCollector()
+	for i := 1; i <= 100; i++ {
+		m.RecordOperation(context.Background(), crypto.AlgMLKEM768, "KeyGen", time.Duration(i)*time.Microsecond, 0, 1184, true)
+	}
+
+	rec := httptest.NewRecorder()
+	m.HandleMetrics()(rec, httptest.NewRequest("GET", "/api/metrics", nil))
+
+	var stats []map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode metrics: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("Expected 1 operation, got %d", len(stats))
+	}
+	for field, expected := range map[string]float64{"p50_latency_us": 50.5, "p95_latency_us": 95.05, "p99_latency_us": 99.01} {
+		got, _ := stats[0][field].(float64)
+		if math.Abs(got-expected) > 1e-9 {
+			t.Errorf("Expected %s of %v, got %v", field, expected, got)
+		}
+	}
+	if _, exists := stats[0]["Histogram"]; exists {
+		t.Error("Expected the raw histogram to be left out of the JSON")
+	}
+}
+
+func TestSLAAlerts(t *testing.T) {
+	m := NewMetricsCollector()
+	type alert struct {
+		alg          crypto.Algorithm
+		operation    string
+		actual, goal float64
+	}
+	var alerts []alert
+	m.SetAlertFunc(func(alg crypto.Algorithm, operation string, actual, goal float64) {
+		alerts = append(alerts, alert{alg, operation, actual, goal})
+	})
+	m.SetSLAGoal(crypto.AlgMLKEM768, "Encapsulate", 500)
+	m.SetSLAGoal(crypto.AlgMLKEM768, "Decapsulate", 500)
+
+	// A fast operation and one averaging above its goal
+	m.RecordOperation(context.Background(), crypto.AlgMLKEM768, "Decapsulate", 100*time.Microsecond, 0, 0, true)
+	m.RecordOperation(context.Background(), crypto.AlgMLKEM768, "Encapsulate", 400*time.Microsecond, 0, 0, true)
+	m.RecordOperation(context.Background(), crypto.AlgMLKEM768, "Encapsulate", 800*time.Microsecond, 0, 0, true)
+	m.CheckSLA()
+	if len(alerts) != 1 || alerts[0] != (alert{crypto.AlgMLKEM768, "Encapsulate", 600, 500}) {
+		t.Fatalf("Expected a single alert for Encapsulate at 600us, got %+v", alerts)
+	}
+
+	// A breach is alerted once, not on every check
+	m.CheckSLA()
+	if len(alerts) != 1 {
+		t.Errorf("Expected no repeat alert, got %+v", alerts)
+	}
+
+	rec := httptest.NewRecorder()
+	m.HandleSLA()(rec, httptest.NewRequest("GET", "/api/metrics/sla", nil))
+	var statuses []SLAStatus
+	if err := json.NewDecoder(rec.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode SLA status: %v", err)
+	}
+	expected := []SLAStatus{
+		{Algorithm: crypto.AlgMLKEM768, Operation: "Decapsulate", GoalUs: 500, ActualUs: 100, Count: 1},
+		{Algorithm: crypto.AlgMLKEM768, Operation: "Encapsulate", GoalUs: 500, ActualUs: 600, Count: 2, Breached: true},
+	}
+	if len(statuses) != len(expected) || statuses[0] != expected[0] || statuses[1] != expected[1] {
+		t.Errorf("Expected %+v, got %+v", expected, statuses)
+	}
+
+	// Recovering and breaching again alerts again
+	for i := 0; i < 4; i++ {
+		m.RecordOperation(context.Background(), crypto.AlgMLKEM768, "Encapsulate", 100*time.Microsecond, 0, 0, true)
+	}
+	m.CheckSLA()
+	for i := 0; i < 10; i++ {
+		m.RecordOperation(context.Background(), crypto.AlgMLKEM768, "Encapsulate", 2*time.Millisecond, 0, 0, true)
+	}
+	m.CheckSLA()
+	if len(alerts) != 2 || alerts[1].operation != "Encapsulate" {
+		t.Errorf("Expected a second alert after recovering, got %+v", alerts)
+	}
+}
+
+func TestParseSLAGoals(t *testing.T) {
+	goals, err := ParseSLAGoals("ml-kem-768:Encapsulate=500, ml-dsa-65:Sign=2500.5")
+	if err != nil {
+		t.Fatalf("ParseSLAGoals failed: %v", err)
+	}
+	expected := []SLAGoal{
+		{Algorithm: crypto.AlgMLKEM768, Operation: "Encapsulate", MaxLatencyUs: 500},
+		{Algorithm: crypto.AlgMLDSA65, Operation: "Sign", MaxLatencyUs: 2500.5},
+	}
+	if len(goals) != 2 || goals[0] != expected[0] || goals[1] != expected[1] {
+		t.Errorf("Expected %+v, got %+v", expected, goals)
+	}
+
+	for _, spec := range []string{"ml-kem-768=500", "ml-kem-768:Encapsulate", "ml-kem-768:Encapsulate=-1", ":Sign=5"} {
+		if _, err := ParseSLAGoals(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
@@ -1,16 +1,25 @@
 package benchmark
 
 import (
+	"context"
 	"encoding/json"
+	"math/rand"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"pqcd/crypto"
 )
 
+// latencyBuckets are the Prometheus histogram buckets in seconds (100µs to 50ms)
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05}
+
 // OperationStats contains aggregated stats for a crypto operation
 type OperationStats struct {
 	Operation   string         `json:"operation"`
@@ -22,23 +31,140 @@ type OperationStats struct {
 	AvgInputSize int           `json:"avg_input_size_bytes"`
 	AvgOutputSize int          `json:"avg_output_size_bytes"`
 	SuccessRate  float64       `json:"success_rate"`
+	P50Latency   float64       `json:"p50_latency_us"`
+	P95Latency   float64       `json:"p95_latency_us"`
+	P99Latency   float64       `json:"p99_latency_us"`
+	
+	// Histogram holds the latency samples the percentiles are computed from
+	Histogram    *LatencyHistogram `json:"-"`
+}
+
+// maxLatencySamples caps the number of latencies kept per operation
+const maxLatencySamples = 10000
+
+// LatencyHistogram estimates latency percentiles from a sorted reservoir of
+// samples. Once the reservoir is full, new samples replace random old ones so
+// it stays a uniform sample of everything recorded.
+type LatencyHistogram struct {
+	mutex   sync.RWMutex
+	samples []float64 // Sorted ascending
+	seen    int64
+}
+
+// NewLatencyHistogram creates an empty histogram
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{
+		samples: make([]float64, 0, 64),
+	}
+}
+
+// Add records a latency
+func (h *LatencyHistogram) Add(latency float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	
+	h.seen++
+	if len(h.samples) >= maxLatencySamples {
+		// Keep the new sample with probability maxLatencySamples/seen
+		if rand.Int63n(h.seen) >= maxLatencySamples {
+			return
+		}
+		evict := rand.Intn(len(h.samples))
+		h.samples = append(h.samples[:evict], h.samples[evict+1:]...)
+	}
+	
+	i := sort.SearchFloat64s(h.samples, latency)
+	h.samples = append(h.samples, 0)
+	copy(h.samples[i+1:], h.samples[i:])
+	h.samples[i] = latency
+}
+
+// Percentile returns the pth percentile (0-100) of the recorded latencies,
+// interpolating between neighbouring samples, or 0 if nothing was recorded
+func (h *LatencyHistogram) Percentile(p float64) float64 {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	
+	if len(h.samples) == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.samples[0]
+	}
+	if p >= 100 {
+		return h.samples[len(h.samples)-1]
+	}
+	
+	rank := p / 100 * float64(len(h.samples)-1)
+	lower := int(rank)
+	if lower+1 >= len(h.samples) {
+		return h.samples[lower]
+	}
+	fraction := rank - float64(lower)
+	return h.samples[lower] + fraction*(h.samples[lower+1]-h.samples[lower])
 }
 
 // MetricsCollector collects and reports performance metrics
 type MetricsCollector struct {
 	mutex  sync.RWMutex
 	stats  map[string]*OperationStats // Key is "algorithm:operation"
+	
+	// Prometheus collectors, only set once registered
+	operationCount   *prometheus.CounterVec
+	operationLatency *prometheus.HistogramVec
+	successRate      *prometheus.GaugeVec
+	
+	// Latency goals, keyed like stats, with whether each was breached at the
+	// last check and the function alerted when one is
+	slaGoals    map[string]SLAGoal
+	slaBreached map[string]bool
+	alertFunc   AlertFunc
 }
 
 // NewMetricsCollector creates a new metrics collector
 func NewMetricsCollector() *MetricsCollector {
 	return &MetricsCollector{
-		stats: make(map[string]*OperationStats),
+		stats:       make(map[string]*OperationStats),
+		slaGoals:    make(map[string]SLAGoal),
+		slaBreached: make(map[string]bool),
 	}
 }
 
-// RecordOperation records a single operation
-func (m *MetricsCollector) RecordOperation(algorithm crypto.Algorithm, operation string, duration time.Duration, inputSize, outputSize int, success bool) {
+// RegisterPrometheusCollectors creates Prometheus collectors labelled by algorithm
+// and operation, registers them with reg and starts updating them on every
+// recorded operation
+func (m *MetricsCollector) RegisterPrometheusCollectors(reg prometheus.Registerer) {
+	labels := []string{"algorithm", "operation"}
+	
+	operationCount := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pqcd",
+		Name:      "operations_total",
+		Help:      "Number of cryptographic operations performed.",
+	}, labels)
+	operationLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "pqcd",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of cryptographic operations.",
+		Buckets:   latencyBuckets,
+	}, labels)
+	successRate := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "pqcd",
+		Name:      "operation_success_rate",
+		Help:      "Fraction of cryptographic operations that succeeded.",
+	}, labels)
+	
+	reg.MustRegister(operationCount, operationLatency, successRate)
+	
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.operationCount = operationCount
+	m.operationLatency = operationLatency
+	m.successRate = successRate
+}
+
+// RecordOperation records a single operation. The operation is also added as an
+// event to the span in ctx, if any.
+func (m *MetricsCollector) RecordOperation(ctx context.Context, algorithm crypto.Algorithm, operation string, duration time.Duration, inputSize, outputSize int, success bool) {
 	key := string(algorithm) + ":" + operation
 	
 	m.mutex.Lock()
@@ -52,6 +178,7 @@ func (m *MetricsCollector) RecordOperation(algorithm crypto.Algorithm, operation
 			Algorithm: algorithm,
 			MinLatency: float64(duration.Microseconds()),
 			MaxLatency: float64(duration.Microseconds()),
+			Histogram:  NewLatencyHistogram(),
 		}
 		m.stats[key] = stats
 	}
@@ -66,6 +193,8 @@ func (m *MetricsCollector) RecordOperation(algorithm crypto.Algorithm, operation
 	stats.AvgInputSize = ((stats.AvgInputSize * (stats.Count-1)) + inputSize) / stats.Count
 	stats.AvgOutputSize = ((stats.AvgOutputSize * (stats.Count-1)) + outputSize) / stats.Count
 	
+	stats.Histogram.Add(latencyUs)
+	
 	// Update min/max
 	if latencyUs < stats.MinLatency {
 		stats.MinLatency = latencyUs
@@ -81,6 +210,23 @@ func (m *MetricsCollector) RecordOperation(algorithm crypto.Algorithm, operation
 		stats.SuccessRate = (stats.SuccessRate * float64(stats.Count-1)) / float64(stats.Count)
 	}
 	
+	// Update Prometheus collectors if registered
+	if m.operationCount != nil {
+		m.operationCount.WithLabelValues(string(algorithm), operation).Inc()
+		m.operationLatency.WithLabelValues(string(algorithm), operation).Observe(duration.Seconds())
+		m.successRate.WithLabelValues(string(algorithm), operation).Set(stats.SuccessRate)
+	}
+	
+	// Attach the measurement to the active trace
+	trace.SpanFromContext(ctx).AddEvent("operation recorded", trace.WithAttributes(
+		attribute.String("crypto.algorithm", string(algorithm)),
+		attribute.String("crypto.operation", operation),
+		attribute.Int64("crypto.latency_us", duration.Microseconds()),
+		attribute.Int("crypto.input_bytes", inputSize),
+		attribute.Int("crypto.output_bytes", outputSize),
+		attribute.Bool("crypto.success", success),
+	))
+	
 	// Log detailed metrics for this operation
 	logrus.WithFields(logrus.Fields{
 		"algorithm":    algorithm,
@@ -99,7 +245,11 @@ func (m *MetricsCollector) GetAllStats() []OperationStats {
 	
 	stats := make([]OperationStats, 0, len(m.stats))
 	for _, stat := range m.stats {
-		stats = append(stats, *stat)
+		snapshot := *stat
+		snapshot.P50Latency = stat.Histogram.Percentile(50)
+		snapshot.P95Latency = stat.Histogram.Percentile(95)
+		snapshot.P99Latency = stat.Histogram.Percentile(99)
+		stats = append(stats, snapshot)
 	}
 	
 	return stats
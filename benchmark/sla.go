@@ -0,0 +1,175 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"pqcd/crypto"
+)
+
+// slaCheckInterval is how often StartSLAChecker compares latencies with their goals
+const slaCheckInterval = 30 * time.Second
+
+// AlertFunc is called when an operation's average latency, in microseconds,
+// rises above its goal
+type AlertFunc func(alg crypto.Algorithm, operation string, actual, goal float64)
+
+// SLAGoal is the highest average latency acceptable for an operation
+type SLAGoal struct {
+	Algorithm    crypto.Algorithm
+	Operation    string
+	MaxLatencyUs float64
+}
+
+// SLAStatus compares an operation's average latency with its goal
+type SLAStatus struct {
+	Algorithm crypto.Algorithm `json:"algorithm"`
+	Operation string           `json:"operation"`
+	GoalUs    float64          `json:"goal_latency_us"`
+	ActualUs  float64          `json:"avg_latency_us"`
+	Count     int              `json:"count"`
+	Breached  bool             `json:"breached"`
+}
+
+// SetSLAGoal sets the highest average latency, in microseconds, acceptable for
+// an operation with an algorithm. A goal of 0 or less removes it.
+func (m *MetricsCollector) SetSLAGoal(alg crypto.Algorithm, operation string, maxLatencyUs float64) {
+	key := string(alg) + ":" + operation
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if maxLatencyUs <= 0 {
+		delete(m.slaGoals, key)
+		delete(m.slaBreached, key)
+		return
+	}
+	m.slaGoals[key] = SLAGoal{Algorithm: alg, Operation: operation, MaxLatencyUs: maxLatencyUs}
+}
+
+// SetAlertFunc sets the function called when a goal is breached. Nil disables
+// alerting.
+func (m *MetricsCollector) SetAlertFunc(alert AlertFunc) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.alertFunc = alert
+}
+
+// SLAStatuses returns every goal with the current average latency of its
+// operation, sorted by algorithm and operation. Operations not yet recorded
+// report zero and are never breached.
+func (m *MetricsCollector) SLAStatuses() []SLAStatus {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.slaStatuses()
+}
+
+// slaStatuses is SLAStatuses for callers already holding the lock
+func (m *MetricsCollector) slaStatuses() []SLAStatus {
+	statuses := make([]SLAStatus, 0, len(m.slaGoals))
+	for key, goal := range m.slaGoals {
+		status := SLAStatus{Algorithm: goal.Algorithm, Operation: goal.Operation, GoalUs: goal.MaxLatencyUs}
+		if stats, ok := m.stats[key]; ok {
+			status.ActualUs = stats.AvgLatency
+			status.Count = stats.Count
+			status.Breached = stats.AvgLatency > goal.MaxLatencyUs
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Algorithm != statuses[j].Algorithm {
+			return statuses[i].Algorithm < statuses[j].Algorithm
+		}
+		return statuses[i].Operation < statuses[j].Operation
+	})
+	return statuses
+}
+
+// CheckSLA compares every operation with its goal and calls the alert function
+// for each newly breached one. An operation stays breached, without further
+// alerts, until its average latency is back within its goal.
+func (m *MetricsCollector) CheckSLA() {
+	m.mutex.Lock()
+	var breaches []SLAStatus
+	for _, status := range m.slaStatuses() {
+		key := string(status.Algorithm) + ":" + status.Operation
+		if status.Breached && !m.slaBreached[key] {
+			breaches = append(breaches, status)
+		}
+		m.slaBreached[key] = status.Breached
+	}
+	alert := m.alertFunc
+	m.mutex.Unlock()
+
+	for _, breach := range breaches {
+		logrus.WithFields(logrus.Fields{
+			"algorithm":  breach.Algorithm,
+			"operation":  breach.Operation,
+			"latency_us": breach.ActualUs,
+			"goal_us":    breach.GoalUs,
+		}).Warn("Operation latency above its SLA goal")
+		if alert != nil {
+			alert(breach.Algorithm, breach.Operation, breach.ActualUs, breach.GoalUs)
+		}
+	}
+}
+
+// StartSLAChecker checks the goals every 30 seconds in the background until
+// stop is called
+func (m *MetricsCollector) StartSLAChecker() (stop func()) {
+	ticker := time.NewTicker(slaCheckInterval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.CheckSLA()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// ParseSLAGoals parses a comma-separated list of goals of the form
+// algorithm:operation=microseconds, such as "ml-kem-768:Encapsulate=500"
+func ParseSLAGoals(spec string) ([]SLAGoal, error) {
+	var goals []SLAGoal
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target, latency, ok := strings.Cut(entry, "=")
+		alg, operation, hasOperation := strings.Cut(target, ":")
+		if !ok || !hasOperation || alg == "" || operation == "" {
+			return nil, fmt.Errorf("invalid SLA goal %q, expected algorithm:operation=microseconds", entry)
+		}
+		maxLatencyUs, err := strconv.ParseFloat(latency, 64)
+		if err != nil || maxLatencyUs <= 0 {
+			return nil, fmt.Errorf("invalid SLA goal %q: latency must be a positive number of microseconds", entry)
+		}
+		goals = append(goals, SLAGoal{Algorithm: crypto.Algorithm(alg), Operation: operation, MaxLatencyUs: maxLatencyUs})
+	}
+	return goals, nil
+}
+
+// HandleSLA returns an HTTP handler reporting each goal, the current average
+// latency and whether it is breached
+func (m *MetricsCollector) HandleSLA() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(m.SLAStatuses()); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logrus.WithError(err).Error("Failed to encode SLA status")
+		}
+	}
+}
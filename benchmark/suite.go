@@ -0,0 +1,220 @@
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"pqcd/crypto"
+)
+
+// suiteMessage is the message signed and verified by the suite
+var suiteMessage = []byte("pqcd benchmark suite message")
+
+// BenchmarkReport compares the registered algorithms, as run by RunSuite
+type BenchmarkReport struct {
+	Iterations int                  `json:"iterations"`
+	StartedAt  time.Time            `json:"started_at"`
+	DurationMs float64              `json:"duration_ms"`
+	Algorithms []AlgorithmBenchmark `json:"algorithms"`
+}
+
+// AlgorithmBenchmark holds the results for one algorithm. If the algorithm
+// could not be benchmarked, for example because its key generation fails,
+// Error says why and Operations holds what was measured before that.
+type AlgorithmBenchmark struct {
+	Algorithm  crypto.Algorithm     `json:"algorithm"`
+	Type       string               `json:"type"` // "kem" or "signature"
+	Operations []OperationBenchmark `json:"operations"`
+	Error      string               `json:"error,omitempty"`
+}
+
+// OperationBenchmark holds the latency statistics of one operation. Failed
+// calls are counted in Errors and left out of the statistics.
+type OperationBenchmark struct {
+	Operation  string  `json:"operation"`
+	Iterations int     `json:"iterations"`
+	Errors     int     `json:"errors"`
+	MeanUs     float64 `json:"mean_us"`
+	StdDevUs   float64 `json:"std_dev_us"`
+	MinUs      float64 `json:"min_us"`
+	MaxUs      float64 `json:"max_us"`
+	OpsPerSec  float64 `json:"ops_per_sec"`
+}
+
+// RunSuite times each operation of every algorithm in registry iterations
+// times: KeyGen, then Encapsulate and Decapsulate for KEMs or Sign and Verify
+// for signature algorithms. Algorithms are run one after another so they don't
+// compete for the CPU. Once ctx ends the remaining operations fail with its
+// error. RunSuite keeps no state of its own and may be called from several
+// goroutines.
+func RunSuite(ctx context.Context, registry *crypto.Registry, iterations int) BenchmarkReport {
+	if iterations < 1 {
+		iterations = 1
+	}
+	report := BenchmarkReport{
+		Iterations: iterations,
+		StartedAt:  time.Now().UTC(),
+		Algorithms: []AlgorithmBenchmark{},
+	}
+
+	for _, alg := range registry.ListKEMAlgorithms() {
+		provider, err := registry.GetKEMProvider(alg)
+		if err != nil {
+			continue
+		}
+		report.Algorithms = append(report.Algorithms, benchmarkKEM(ctx, provider, iterations))
+	}
+	for _, alg := range registry.ListSignatureAlgorithms() {
+		provider, err := registry.GetSignatureProvider(alg)
+		if err != nil {
+			continue
+		}
+		report.Algorithms = append(report.Algorithms, benchmarkSignature(ctx, provider, iterations))
+	}
+
+	report.DurationMs = float64(time.Since(report.StartedAt).Microseconds()) / 1000
+	return report
+}
+
+// benchmarkKEM times key generation, encapsulation and decapsulation
+func benchmarkKEM(ctx context.Context, provider crypto.KEMProvider, iterations int) AlgorithmBenchmark {
+	result := AlgorithmBenchmark{Algorithm: provider.Name(), Type: "kem"}
+
+	keyGen, keyPair, err := benchmarkKeyGen(ctx, provider, iterations)
+	result.Operations = append(result.Operations, keyGen)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	ciphertexts := make([][]byte, iterations)
+	secrets := make([][]byte, iterations)
+	result.Operations = append(result.Operations, timeOperation("Encapsulate", iterations, func(i int) error {
+		var err error
+		ciphertexts[i], secrets[i], err = provider.Encapsulate(ctx, keyPair.PublicKey)
+		return err
+	}))
+	result.Operations = append(result.Operations, timeOperation("Decapsulate", iterations, func(i int) error {
+		if ciphertexts[i] == nil {
+			return errors.New("encapsulation failed")
+		}
+		secret, err := provider.Decapsulate(ctx, keyPair.PrivateKey, ciphertexts[i])
+		if err != nil {
+			return err
+		}
+		if !crypto.SecureCompare(secret, secrets[i]) {
+			return errors.New("shared secret mismatch")
+		}
+		return nil
+	}))
+
+	crypto.ZeroBytes(keyPair.PrivateKey)
+	return result
+}
+
+// benchmarkSignature times key generation, signing and verification
+func benchmarkSignature(ctx context.Context, provider crypto.SignatureProvider, iterations int) AlgorithmBenchmark {
+	result := AlgorithmBenchmark{Algorithm: provider.Name(), Type: "signature"}
+
+	keyGen, keyPair, err := benchmarkKeyGen(ctx, provider, iterations)
+	result.Operations = append(result.Operations, keyGen)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	signatures := make([][]byte, iterations)
+	result.Operations = append(result.Operations, timeOperation("Sign", iterations, func(i int) error {
+		var err error
+		signatures[i], err = provider.Sign(ctx, keyPair.PrivateKey, suiteMessage)
+		return err
+	}))
+	result.Operations = append(result.Operations, timeOperation("Verify", iterations, func(i int) error {
+		if signatures[i] == nil {
+			return errors.New("signing failed")
+		}
+		valid, err := provider.Verify(ctx, keyPair.PublicKey, suiteMessage, signatures[i])
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return errors.New("signature did not verify")
+		}
+		return nil
+	}))
+
+	crypto.ZeroBytes(keyPair.PrivateKey)
+	return result
+}
+
+// benchmarkKeyGen times key generation and returns the first key pair
+// generated, for the other operations to use. It fails if no key could be
+// generated.
+func benchmarkKeyGen(ctx context.Context, provider crypto.CryptoProvider, iterations int) (OperationBenchmark, crypto.KeyPair, error) {
+	var keyPair crypto.KeyPair
+	var lastErr error
+	stats := timeOperation("KeyGen", iterations, func(i int) error {
+		generated, err := provider.KeyGen(ctx)
+		if err != nil {
+			lastErr = err
+			return err
+		}
+		if keyPair.PrivateKey == nil {
+			keyPair = generated
+		} else {
+			crypto.ZeroBytes(generated.PrivateKey)
+		}
+		return nil
+	})
+	if keyPair.PrivateKey == nil {
+		return stats, keyPair, fmt.Errorf("key generation failed: %w", lastErr)
+	}
+	return stats, keyPair, nil
+}
+
+// timeOperation calls op iterations times, timing each call
+func timeOperation(operation string, iterations int, op func(i int) error) OperationBenchmark {
+	stats := OperationBenchmark{Operation: operation, Iterations: iterations}
+	latencies := make([]float64, 0, iterations)
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		err := op(i)
+		elapsed := time.Since(start)
+		if err != nil {
+			stats.Errors++
+			continue
+		}
+		latencies = append(latencies, float64(elapsed.Nanoseconds())/1000)
+	}
+	summarize(&stats, latencies)
+	return stats
+}
+
+// summarize fills in the statistics of latencies, in microseconds
+func summarize(stats *OperationBenchmark, latencies []float64) {
+	if len(latencies) == 0 {
+		return
+	}
+
+	stats.MinUs, stats.MaxUs = latencies[0], latencies[0]
+	var sum float64
+	for _, latency := range latencies {
+		sum += latency
+		stats.MinUs = math.Min(stats.MinUs, latency)
+		stats.MaxUs = math.Max(stats.MaxUs, latency)
+	}
+	stats.MeanUs = sum / float64(len(latencies))
+
+	var squares float64
+	for _, latency := range latencies {
+		squares += (latency - stats.MeanUs) * (latency - stats.MeanUs)
+	}
+	stats.StdDevUs = math.Sqrt(squares / float64(len(latencies)))
+
+	if stats.MeanUs > 0 {
+		stats.OpsPerSec = 1e6 / stats.MeanUs
+	}
+}
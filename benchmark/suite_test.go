@@ -0,0 +1,67 @@
+package benchmark
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"pqcd/crypto"
+)
+
+func TestRunSuite(t *testing.T) {
+	registry := crypto.DefaultRegistry()
+	report := RunSuite(context.Background(), registry, 2)
+
+	want := len(registry.ListKEMAlgorithms()) + len(registry.ListSignatureAlgorithms())
+	if report.Iterations != 2 || len(report.Algorithms) != want {
+		t.Fatalf("Expected %d algorithms run 2 times, got %d run %d times", want, len(report.Algorithms), report.Iterations)
+	}
+	for _, result := range report.Algorithms {
+		if result.Error != "" {
+			t.Logf("%s was not benchmarked: %s", result.Algorithm, result.Error)
+			continue
+		}
+		expected := []string{"KeyGen", "Sign", "Verify"}
+		if result.Type == "kem" {
+			expected = []string{"KeyGen", "Encapsulate", "Decapsulate"}
+		}
+		if len(result.Operations) != len(expected) {
+			t.Errorf("Expected %s to report %v, got %+v", result.Algorithm, expected, result.Operations)
+			continue
+		}
+		for i, op := range result.Operations {
+			if op.Operation != expected[i] || op.Errors != 0 || op.MeanUs <= 0 || op.OpsPerSec <= 0 || op.MinUs > op.MaxUs {
+				t.Errorf("Unexpected %s %s stats: %+v", result.Algorithm, expected[i], op)
+			}
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var stats OperationBenchmark
+	summarize(&stats, []float64{2, 4, 4, 4, 5, 5, 7, 9})
+
+	if stats.MeanUs != 5 || stats.StdDevUs != 2 || stats.MinUs != 2 || stats.MaxUs != 9 {
+		t.Errorf("Expected mean 5, std dev 2, min 2 and max 9, got %+v", stats)
+	}
+	if math.Abs(stats.OpsPerSec-200000) > 1e-6 {
+		t.Errorf("Expected 200000 ops/sec, got %v", stats.OpsPerSec)
+	}
+
+	var empty OperationBenchmark
+	summarize(&empty, nil)
+	if empty != (OperationBenchmark{}) {
+		t.Errorf("Expected no stats without latencies, got %+v", empty)
+	}
+}
+
+func BenchmarkKeyGenMLKEM768(b *testing.B) {
+	provider := crypto.NewMLKEM768Provider()
+	for i := 0; i < b.N; i++ {
+		keyPair, err := provider.KeyGen(context.Background())
+		if err != nil {
+			b.Fatalf("Failed to generate key pair: %v", err)
+		}
+		crypto.ZeroBytes(keyPair.PrivateKey)
+	}
+}
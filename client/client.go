@@ -0,0 +1,287 @@
+// Package client is a Go client for the pqcd HTTP API. Keys, ciphertexts,
+// shared secrets and signatures are hex-encoded, as on the wire.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the request timeout of clients created with New
+const DefaultTimeout = 30 * time.Second
+
+// maxErrorBodyBytes caps how much of an error response is read
+const maxErrorBodyBytes = 64 << 10
+
+// Client calls the pqcd API at BaseURL, for example "https://localhost:8082".
+// Token, when set, is sent as a bearer token; Login obtains one.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Token      string
+}
+
+// New creates a client for the API at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// WithTimeout returns a copy of the client whose requests time out after d.
+// The copy shares the transport of the original.
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	httpClient := http.Client{}
+	if c.HTTPClient != nil {
+		httpClient = *c.HTTPClient
+	}
+	httpClient.Timeout = d
+	return &Client{BaseURL: c.BaseURL, HTTPClient: &httpClient, Token: c.Token}
+}
+
+// KeyRequest selects the algorithm of a new key pair
+type KeyRequest struct {
+	Algorithm string `json:"-"`
+}
+
+// KeyResponse is a generated key pair. GenerateKey joins the chunks the
+// server sends large public keys in, so PublicKey always holds the whole key.
+type KeyResponse struct {
+	PublicKey       string    `json:"publicKey"`
+	PublicKeyChunks []string  `json:"publicKeyChunks,omitempty"`
+	PrivateKey      string    `json:"privateKey"`
+	Algorithm       string    `json:"algorithm"`
+	Fingerprint     string    `json:"fingerprint"`
+	Decoys          []string  `json:"decoys"`
+	Warning         string    `json:"warning,omitempty"` // Set by the server for large public keys
+	GeneratedAt     time.Time `json:"generatedAt"`
+}
+
+// EncapsulateRequest is the request for encapsulating a shared secret to a public key
+type EncapsulateRequest struct {
+	PublicKey string `json:"publicKey"`
+	Algorithm string `json:"algorithm"`
+}
+
+// EncapsulateResponse carries the ciphertext and the shared secret it encapsulates
+type EncapsulateResponse struct {
+	Ciphertext   string `json:"ciphertext"`
+	SharedSecret string `json:"sharedSecret"`
+}
+
+// DecapsulateRequest is the request for recovering a shared secret from a ciphertext
+type DecapsulateRequest struct {
+	PrivateKey string `json:"privateKey"`
+	Ciphertext string `json:"ciphertext"`
+	Algorithm  string `json:"algorithm"`
+}
+
+// DecapsulateResponse carries the recovered shared secret
+type DecapsulateResponse struct {
+	SharedSecret string `json:"sharedSecret"`
+}
+
+// The /api/encrypt and /api/decrypt endpoints are algorithm-agnostic forms of
+// encapsulation and decapsulation, and share their messages
+type (
+	EncryptRequest  = EncapsulateRequest
+	EncryptResponse = EncapsulateResponse
+	DecryptRequest  = DecapsulateRequest
+	DecryptResponse = DecapsulateResponse
+)
+
+// SignRequest is the request for signing a message
+type SignRequest struct {
+	PrivateKey string `json:"privateKey"`
+	Message    string `json:"message"`
+	Algorithm  string `json:"-"`
+}
+
+// SignResponse carries the signature
+type SignResponse struct {
+	Signature string `json:"signature"`
+}
+
+// VerifyRequest is the request for verifying a signature
+type VerifyRequest struct {
+	PublicKey string `json:"publicKey"`
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+	Algorithm string `json:"-"`
+}
+
+// VerifyResponse reports whether the signature is valid
+type VerifyResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// APIError is returned for responses with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+	Code       string // Crypto error code such as INVALID_KEY, if any
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("pqcd API error %d (%s): %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("pqcd API error %d: %s", e.StatusCode, e.Message)
+}
+
+// LoginRequest carries a user's credentials
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResponse carries a login token
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Login exchanges credentials for a token and sets it as the client's Token
+func (c *Client) Login(ctx context.Context, req LoginRequest) (LoginResponse, error) {
+	var resp LoginResponse
+	if err := c.post(ctx, "/api/auth/login", req, &resp); err != nil {
+		return resp, err
+	}
+	c.Token = resp.Token
+	return resp, nil
+}
+
+// GenerateKey generates a key pair for req.Algorithm
+func (c *Client) GenerateKey(ctx context.Context, req KeyRequest) (KeyResponse, error) {
+	var resp KeyResponse
+	err := c.post(ctx, algorithmPath(req.Algorithm, "keygen"), struct{}{}, &resp)
+	if len(resp.PublicKeyChunks) > 0 {
+		resp.PublicKey = strings.Join(resp.PublicKeyChunks, "")
+		resp.PublicKeyChunks = nil
+	}
+	return resp, err
+}
+
+// Encrypt encapsulates a shared secret through /api/encrypt
+func (c *Client) Encrypt(ctx context.Context, req EncryptRequest) (EncryptResponse, error) {
+	var resp EncryptResponse
+	err := c.post(ctx, "/api/encrypt", req, &resp)
+	return resp, err
+}
+
+// Decrypt recovers a shared secret through /api/decrypt
+func (c *Client) Decrypt(ctx context.Context, req DecryptRequest) (DecryptResponse, error) {
+	var resp DecryptResponse
+	err := c.post(ctx, "/api/decrypt", req, &resp)
+	return resp, err
+}
+
+// Encapsulate encapsulates a shared secret to a public key
+func (c *Client) Encapsulate(ctx context.Context, req EncapsulateRequest) (EncapsulateResponse, error) {
+	var resp EncapsulateResponse
+	err := c.post(ctx, algorithmPath(req.Algorithm, "encapsulate"), req, &resp)
+	return resp, err
+}
+
+// Decapsulate recovers a shared secret from a ciphertext
+func (c *Client) Decapsulate(ctx context.Context, req DecapsulateRequest) (DecapsulateResponse, error) {
+	var resp DecapsulateResponse
+	err := c.post(ctx, algorithmPath(req.Algorithm, "decapsulate"), req, &resp)
+	return resp, err
+}
+
+// Sign signs a message with a private key
+func (c *Client) Sign(ctx context.Context, req SignRequest) (SignResponse, error) {
+	var resp SignResponse
+	err := c.post(ctx, algorithmPath(req.Algorithm, "sign"), req, &resp)
+	return resp, err
+}
+
+// Verify checks a signature. An invalid signature is reported through
+// VerifyResponse.Valid rather than as an error.
+func (c *Client) Verify(ctx context.Context, req VerifyRequest) (VerifyResponse, error) {
+	var resp VerifyResponse
+	err := c.post(ctx, algorithmPath(req.Algorithm, "verify"), req, &resp)
+	return resp, err
+}
+
+// algorithmPath builds the path of a per-algorithm endpoint
+func algorithmPath(algorithm, operation string) string {
+	return "/api/" + url.PathEscape(algorithm) + "/" + operation
+}
+
+// post sends body as JSON and decodes the response into out. A 5xx response is
+// retried once.
+func (c *Client) post(ctx context.Context, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	var resp *http.Response
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to call %s: %w", path, err)
+		}
+		if resp.StatusCode < 500 || attempt == 1 {
+			break
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodyBytes))
+		resp.Body.Close()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// decodeError builds an APIError from an error response, falling back to the
+// status text when the body is not the API's JSON error
+func decodeError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	var body struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		apiErr.Message = body.Error
+		apiErr.Code = body.Code
+	} else if text := strings.TrimSpace(string(data)); text != "" {
+		apiErr.Message = text
+	} else {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
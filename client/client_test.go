@@ -0,0 +1,229 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pqcd/testutil"
+)
+
+// newTestAPI returns a client of a test server, authenticated as a user
+func newTestAPI(t *testing.T) *Client {
+	t.Helper()
+	server := testutil.NewTestServer(t)
+	c := New(server.URL)
+	c.Token = testutil.MustLogin(t, server, testutil.TestUsername, testutil.TestPassword)
+	return c
+}
+
+func TestClientKEMRoundTrip(t *testing.T) {
+	c := newTestAPI(t)
+	ctx := context.Background()
+
+	key, err := c.GenerateKey(ctx, KeyRequest{Algorithm: "ml-kem-768"})
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if key.Algorithm != "ml-kem-768" || key.PublicKey == "" || key.PrivateKey == "" {
+		t.Fatalf("Unexpected key pair: %+v", key)
+	}
+
+	encapsulated, err := c.Encapsulate(ctx, EncapsulateRequest{PublicKey: key.PublicKey, Algorithm: key.Algorithm})
+	if err != nil {
+		t.Fatalf("Encapsulate failed: %v", err)
+	}
+	decapsulated, err := c.Decapsulate(ctx, DecapsulateRequest{PrivateKey: key.PrivateKey, Ciphertext: encapsulated.Ciphertext, Algorithm: key.Algorithm})
+	if err != nil {
+		t.Fatalf("Decapsulate failed: %v", err)
+	}
+	if decapsulated.SharedSecret != encapsulated.SharedSecret {
+		t.Errorf("Expected shared secret %s, got %s", encapsulated.SharedSecret, decapsulated.SharedSecret)
+	}
+
+	encrypted, err := c.Encrypt(ctx, EncryptRequest{PublicKey: key.PublicKey, Algorithm: key.Algorithm})
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	decrypted, err := c.Decrypt(ctx, DecryptRequest{PrivateKey: key.PrivateKey, Ciphertext: encrypted.Ciphertext, Algorithm: key.Algorithm})
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if decrypted.SharedSecret != encrypted.SharedSecret {
+		t.Errorf("Expected shared secret %s, got %s", encrypted.SharedSecret, decrypted.SharedSecret)
+	}
+}
+
+func TestClientSignVerify(t *testing.T) {
+	c := newTestAPI(t)
+	ctx := context.Background()
+
+	key, err := c.GenerateKey(ctx, KeyRequest{Algorithm: "ml-dsa-65"})
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	signed, err := c.Sign(ctx, SignRequest{PrivateKey: key.PrivateKey, Message: "hello", Algorithm: key.Algorithm})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	verified, err := c.Verify(ctx, VerifyRequest{PublicKey: key.PublicKey, Message: "hello", Signature: signed.Signature, Algorithm: key.Algorithm})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !verified.Valid {
+		t.Error("Expected the signature to be valid")
+	}
+
+	verified, err = c.Verify(ctx, VerifyRequest{PublicKey: key.PublicKey, Message: "tampered", Signature: signed.Signature, Algorithm: key.Algorithm})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if verified.Valid {
+		t.Error("Expected the signature over a different message to be invalid")
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	c := newTestAPI(t)
+
+	_, err := c.Encapsulate(context.Background(), EncapsulateRequest{PublicKey: "00", Algorithm: "ml-kem-768"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Message == "" {
+		t.Errorf("Expected a 400 with a message, got %+v", apiErr)
+	}
+}
+
+func TestClientJoinsPublicKeyChunks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"publicKeyChunks": ["abcd", "ef01"], "privateKey": "00", "algorithm": "mceliece-348864"}`))
+	}))
+	defer server.Close()
+
+	key, err := New(server.URL).GenerateKey(context.Background(), KeyRequest{Algorithm: "mceliece-348864"})
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if key.PublicKey != "abcdef01" || key.PublicKeyChunks != nil {
+		t.Errorf("Expected the chunks joined into public key abcdef01, got %q and %v", key.PublicKey, key.PublicKeyChunks)
+	}
+}
+
+func TestClientRetriesOnceOn5xx(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			http.Error(w, `{"error": "temporarily unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"signature": "abcd"}`))
+	}))
+	defer server.Close()
+
+	resp, err := New(server.URL).Sign(context.Background(), SignRequest{Algorithm: "ml-dsa-44"})
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if resp.Signature != "abcd" || calls != 2 {
+		t.Errorf("Expected signature abcd after 2 calls, got %q after %d", resp.Signature, calls)
+	}
+}
+
+func TestClientGivesUpAfterOneRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error": "boom", "code": "KEYGEN_FAILED"}`))
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).GenerateKey(context.Background(), KeyRequest{Algorithm: "ml-kem-768"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusInternalServerError || apiErr.Code != "KEYGEN_FAILED" || apiErr.Message != "boom" {
+		t.Errorf("Unexpected error: %+v", apiErr)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+}
+
+func TestClientDoesNotRetry4xx(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).Verify(context.Background(), VerifyRequest{Algorithm: "ml-dsa-44"})
+	if err == nil {
+		t.Fatal("Expected an error for a 400 response")
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
+
+func TestClientLogin(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "correct horse battery")
+	server := testutil.NewTestServer(t)
+	c := New(server.URL)
+	ctx := context.Background()
+
+	_, err := c.GenerateKey(ctx, KeyRequest{Algorithm: "ml-kem-768"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 before logging in, got %v", err)
+	}
+	if _, err := c.Login(ctx, LoginRequest{Username: "admin", Password: "wrong password"}); err == nil {
+		t.Error("Expected login with a wrong password to fail")
+	}
+
+	resp, err := c.Login(ctx, LoginRequest{Username: "admin", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if resp.Token == "" || c.Token != resp.Token || resp.ExpiresAt.IsZero() {
+		t.Errorf("Expected Login to set the token, got %+v", resp)
+	}
+	if _, err := c.WithTimeout(10*time.Second).GenerateKey(ctx, KeyRequest{Algorithm: "ml-kem-768"}); err != nil {
+		t.Errorf("Expected GenerateKey to succeed after logging in, got %v", err)
+	}
+}
+
+func TestClientWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := New(server.URL)
+	fast := c.WithTimeout(50 * time.Millisecond)
+	if fast.HTTPClient.Timeout != 50*time.Millisecond || c.HTTPClient.Timeout != DefaultTimeout {
+		t.Errorf("Expected WithTimeout to leave the original client unchanged")
+	}
+
+	start := time.Now()
+	if _, err := fast.Sign(context.Background(), SignRequest{Algorithm: "ml-dsa-44"}); err == nil {
+		t.Fatal("Expected the request to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the request to time out quickly, took %v", elapsed)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"pqcd/client"
+	"pqcd/crypto"
+)
+
+// backend performs the crypto operations, either in-process or through the API
+type backend interface {
+	KeyGen(ctx context.Context, alg crypto.Algorithm) (crypto.KeyPair, error)
+	Encapsulate(ctx context.Context, alg crypto.Algorithm, publicKey []byte) (ciphertext, sharedSecret []byte, err error)
+	Decapsulate(ctx context.Context, alg crypto.Algorithm, privateKey, ciphertext []byte) ([]byte, error)
+	Sign(ctx context.Context, alg crypto.Algorithm, privateKey, message []byte) ([]byte, error)
+	Verify(ctx context.Context, alg crypto.Algorithm, publicKey, message, signature []byte) (bool, error)
+}
+
+// newBackend returns the API backend when --server is set and the local one otherwise
+func newBackend(opts *options) backend {
+	if opts.server == "" {
+		return localBackend{registry: crypto.DefaultRegistry()}
+	}
+
+	c := client.New(opts.server).WithTimeout(opts.timeout)
+	c.Token = opts.token
+	if opts.insecure {
+		// The server generates a self-signed certificate when none is configured
+		c.HTTPClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	return remoteBackend{client: c}
+}
+
+// localBackend runs the registered providers in-process
+type localBackend struct {
+	registry *crypto.Registry
+}
+
+func (b localBackend) KeyGen(ctx context.Context, alg crypto.Algorithm) (crypto.KeyPair, error) {
+	if provider, err := b.registry.GetKEMProvider(alg); err == nil {
+		return provider.KeyGen(ctx)
+	}
+	provider, err := b.registry.GetSignatureProvider(alg)
+	if err != nil {
+		return crypto.KeyPair{}, fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+	return provider.KeyGen(ctx)
+}
+
+func (b localBackend) Encapsulate(ctx context.Context, alg crypto.Algorithm, publicKey []byte) ([]byte, []byte, error) {
+	provider, err := b.registry.GetKEMProvider(alg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s is not a key encapsulation algorithm", alg)
+	}
+	return provider.Encapsulate(ctx, publicKey)
+}
+
+func (b localBackend) Decapsulate(ctx context.Context, alg crypto.Algorithm, privateKey, ciphertext []byte) ([]byte, error) {
+	provider, err := b.registry.GetKEMProvider(alg)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a key encapsulation algorithm", alg)
+	}
+	return provider.Decapsulate(ctx, privateKey, ciphertext)
+}
+
+func (b localBackend) Sign(ctx context.Context, alg crypto.Algorithm, privateKey, message []byte) ([]byte, error) {
+	provider, err := b.registry.GetSignatureProvider(alg)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a signature algorithm", alg)
+	}
+	return provider.Sign(ctx, privateKey, message)
+}
+
+func (b localBackend) Verify(ctx context.Context, alg crypto.Algorithm, publicKey, message, signature []byte) (bool, error) {
+	provider, err := b.registry.GetSignatureProvider(alg)
+	if err != nil {
+		return false, fmt.Errorf("%s is not a signature algorithm", alg)
+	}
+	return provider.Verify(ctx, publicKey, message, signature)
+}
+
+// remoteBackend proxies every operation through the API
+type remoteBackend struct {
+	client *client.Client
+}
+
+func (b remoteBackend) KeyGen(ctx context.Context, alg crypto.Algorithm) (crypto.KeyPair, error) {
+	resp, err := b.client.GenerateKey(ctx, client.KeyRequest{Algorithm: string(alg)})
+	if err != nil {
+		return crypto.KeyPair{}, err
+	}
+	keyPair := crypto.KeyPair{Algorithm: crypto.Algorithm(resp.Algorithm)}
+	if keyPair.PublicKey, err = decodeHex("public key", resp.PublicKey); err != nil {
+		return crypto.KeyPair{}, err
+	}
+	if keyPair.PrivateKey, err = decodeHex("private key", resp.PrivateKey); err != nil {
+		return crypto.KeyPair{}, err
+	}
+	return keyPair, nil
+}
+
+func (b remoteBackend) Encapsulate(ctx context.Context, alg crypto.Algorithm, publicKey []byte) ([]byte, []byte, error) {
+	resp, err := b.client.Encapsulate(ctx, client.EncapsulateRequest{
+		PublicKey: hex.EncodeToString(publicKey),
+		Algorithm: string(alg),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := decodeHex("ciphertext", resp.Ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+	sharedSecret, err := decodeHex("shared secret", resp.SharedSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ciphertext, sharedSecret, nil
+}
+
+func (b remoteBackend) Decapsulate(ctx context.Context, alg crypto.Algorithm, privateKey, ciphertext []byte) ([]byte, error) {
+	resp, err := b.client.Decapsulate(ctx, client.DecapsulateRequest{
+		PrivateKey: hex.EncodeToString(privateKey),
+		Ciphertext: hex.EncodeToString(ciphertext),
+		Algorithm:  string(alg),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeHex("shared secret", resp.SharedSecret)
+}
+
+func (b remoteBackend) Sign(ctx context.Context, alg crypto.Algorithm, privateKey, message []byte) ([]byte, error) {
+	if err := checkTextMessage(message); err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Sign(ctx, client.SignRequest{
+		PrivateKey: hex.EncodeToString(privateKey),
+		Message:    string(message),
+		Algorithm:  string(alg),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeHex("signature", resp.Signature)
+}
+
+func (b remoteBackend) Verify(ctx context.Context, alg crypto.Algorithm, publicKey, message, signature []byte) (bool, error) {
+	if err := checkTextMessage(message); err != nil {
+		return false, err
+	}
+	resp, err := b.client.Verify(ctx, client.VerifyRequest{
+		PublicKey: hex.EncodeToString(publicKey),
+		Message:   string(message),
+		Signature: hex.EncodeToString(signature),
+		Algorithm: string(alg),
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Valid, nil
+}
+
+// checkTextMessage rejects messages the API cannot carry unchanged: it takes
+// messages as JSON strings, which replace invalid UTF-8
+func checkTextMessage(message []byte) error {
+	if !utf8.Valid(message) {
+		return fmt.Errorf("--server can only sign and verify UTF-8 text; sign binary input locally")
+	}
+	return nil
+}
+
+// decodeHex decodes a hex field of an API response
+func decodeHex(field, value string) ([]byte, error) {
+	decoded, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("server returned an invalid %s: %w", field, err)
+	}
+	return decoded, nil
+}
+
+// defaultTimeout bounds each API call made with --server
+const defaultTimeout = 30 * time.Second
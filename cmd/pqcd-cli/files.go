@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"pqcd/crypto"
+)
+
+// stdio is the file name that stands for standard input or output
+const stdio = "-"
+
+// readKeyFile reads the PEM key blocks in a file. A file written by keygen holds
+// the private key followed by the public key; either may be missing.
+func readKeyFile(path string) (crypto.KeyPair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return crypto.KeyPair{}, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	var keyPair crypto.KeyPair
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var parsed crypto.KeyPair
+		encoded := pem.EncodeToMemory(block)
+		switch {
+		case strings.HasSuffix(block.Type, " PRIVATE KEY"):
+			parsed, err = crypto.UnmarshalPrivateKeyFromPEM(encoded)
+			keyPair.PrivateKey = parsed.PrivateKey
+		case strings.HasSuffix(block.Type, " PUBLIC KEY"):
+			parsed, err = crypto.UnmarshalPublicKeyFromPEM(encoded)
+			keyPair.PublicKey = parsed.PublicKey
+		default:
+			return crypto.KeyPair{}, fmt.Errorf("%s: unexpected PEM block %q", path, block.Type)
+		}
+		if err != nil {
+			return crypto.KeyPair{}, fmt.Errorf("%s: %w", path, err)
+		}
+		if keyPair.Algorithm != "" && keyPair.Algorithm != parsed.Algorithm {
+			return crypto.KeyPair{}, fmt.Errorf("%s: holds keys for both %s and %s", path, keyPair.Algorithm, parsed.Algorithm)
+		}
+		keyPair.Algorithm = parsed.Algorithm
+	}
+
+	if keyPair.Algorithm == "" {
+		return crypto.KeyPair{}, fmt.Errorf("%s: no PEM key found", path)
+	}
+	return keyPair, nil
+}
+
+// requirePublicKey reads a key file that must contain a public key
+func requirePublicKey(path string) (crypto.KeyPair, error) {
+	keyPair, err := readKeyFile(path)
+	if err == nil && len(keyPair.PublicKey) == 0 {
+		err = fmt.Errorf("%s: no public key found", path)
+	}
+	return keyPair, err
+}
+
+// requirePrivateKey reads a key file that must contain a private key
+func requirePrivateKey(path string) (crypto.KeyPair, error) {
+	keyPair, err := readKeyFile(path)
+	if err == nil && len(keyPair.PrivateKey) == 0 {
+		err = fmt.Errorf("%s: no private key found", path)
+	}
+	return keyPair, err
+}
+
+// encodeKeyFile writes the private and public key of a key pair as PEM blocks
+func encodeKeyFile(keyPair crypto.KeyPair) ([]byte, error) {
+	privatePEM, err := crypto.MarshalPrivateKeyToPEM(keyPair)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := crypto.MarshalPublicKeyToPEM(keyPair)
+	if err != nil {
+		return nil, err
+	}
+	return append(privatePEM, publicPEM...), nil
+}
+
+// readInput reads a file, or standard input for "-"
+func readInput(path string, stdin io.Reader) ([]byte, error) {
+	if path == stdio {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read standard input: %w", err)
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	return data, nil
+}
+
+// writeFile writes output to a file. Files holding private keys are only
+// readable by their owner.
+func writeFile(path string, data []byte, private bool) error {
+	mode := os.FileMode(0o644)
+	if private {
+		mode = 0o600
+	}
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// fingerprint is the SHA-256 digest of a public key in hex, as reported by the API
+func fingerprint(publicKey []byte) string {
+	hash := sha256.Sum256(publicKey)
+	return hex.EncodeToString(hash[:])
+}
+
+// Encrypted files hold a KEM ciphertext followed by the data encrypted with
+// AES-256-GCM under a key derived from the encapsulated secret:
+//
+//	version (1) | KEM ciphertext length (2, big endian) | KEM ciphertext | nonce (12) | sealed data
+//
+// The header up to the nonce is authenticated as additional data.
+const envelopeVersion = 1
+
+// envelopeKeyInfo is the HKDF info string for the data encryption key
+var envelopeKeyInfo = []byte("pqcd-cli envelope v1")
+
+// sealEnvelope encrypts plaintext for the holder of the KEM private key
+func sealEnvelope(kemCiphertext, sharedSecret, plaintext []byte) ([]byte, error) {
+	if len(kemCiphertext) > 0xffff {
+		return nil, fmt.Errorf("KEM ciphertext of %d bytes is too long", len(kemCiphertext))
+	}
+	aead, err := envelopeCipher(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 3, 3+len(kemCiphertext))
+	header[0] = envelopeVersion
+	binary.BigEndian.PutUint16(header[1:], uint16(len(kemCiphertext)))
+	header = append(header, kemCiphertext...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out := append(append([]byte{}, header...), nonce...)
+	return aead.Seal(out, nonce, plaintext, header), nil
+}
+
+// splitEnvelope returns the KEM ciphertext of an encrypted file
+func splitEnvelope(data []byte) (kemCiphertext []byte, err error) {
+	if len(data) < 3 || data[0] != envelopeVersion {
+		return nil, errors.New("input is not a pqcd-cli encrypted file")
+	}
+	length := int(binary.BigEndian.Uint16(data[1:3]))
+	if len(data) < 3+length {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	return data[3 : 3+length], nil
+}
+
+// openEnvelope decrypts an encrypted file with the decapsulated secret
+func openEnvelope(data, sharedSecret []byte) ([]byte, error) {
+	kemCiphertext, err := splitEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := envelopeCipher(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLength := 3 + len(kemCiphertext)
+	if len(data) < headerLength+aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	nonce := data[headerLength : headerLength+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, data[headerLength+aead.NonceSize():], data[:headerLength])
+	if err != nil {
+		return nil, errors.New("failed to decrypt: wrong key or corrupted file")
+	}
+	return plaintext, nil
+}
+
+// envelopeCipher derives the AES-256-GCM cipher from a shared secret
+func envelopeCipher(sharedSecret []byte) (cipher.AEAD, error) {
+	key, err := crypto.DeriveKey(sharedSecret, envelopeKeyInfo, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
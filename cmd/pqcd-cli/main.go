@@ -0,0 +1,327 @@
+// Command pqcd-cli generates keys and encrypts, decrypts, signs and verifies
+// files with the pqcd algorithms, either locally or through a pqcd server.
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"pqcd/crypto"
+)
+
+// errInvalidSignature makes verify exit with status 1 after reporting the result
+var errInvalidSignature = errors.New("signature is invalid")
+
+// options are the flags shared by every subcommand
+type options struct {
+	server   string
+	token    string
+	insecure bool
+	timeout  time.Duration
+	json     bool
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		if !errors.Is(err, errInvalidSignature) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// newRootCommand builds the pqcd-cli command tree
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:           "pqcd-cli",
+		Short:         "Post-quantum key and crypto operations",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&opts.server, "server", "", "pqcd API base URL to proxy operations through, for example https://localhost:8082 (default: local crypto)")
+	root.PersistentFlags().StringVar(&opts.token, "token", os.Getenv("PQCD_TOKEN"), "Login token sent to --server (default $PQCD_TOKEN)")
+	root.PersistentFlags().BoolVar(&opts.insecure, "insecure", false, "skip TLS certificate verification of --server, for self-signed certificates")
+	root.PersistentFlags().DurationVar(&opts.timeout, "timeout", defaultTimeout, "timeout of each API call made with --server")
+	root.PersistentFlags().BoolVar(&opts.json, "json", false, "print machine-parseable JSON")
+
+	root.AddCommand(
+		newKeygenCommand(opts),
+		newEncryptCommand(opts),
+		newDecryptCommand(opts),
+		newSignCommand(opts),
+		newVerifyCommand(opts),
+		newFingerprintCommand(opts),
+	)
+	return root
+}
+
+// report prints a result as JSON with --json and as text otherwise
+func report(cmd *cobra.Command, opts *options, result interface{}, text string) error {
+	if opts.json {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	_, err := fmt.Fprintln(cmd.OutOrStdout(), text)
+	return err
+}
+
+// emit writes data to a file, or to standard output for "-". With --json, data
+// written to standard output is embedded base64-encoded in the result under key.
+func emit(cmd *cobra.Command, opts *options, path string, data []byte, private bool, key string, result map[string]interface{}, text string) error {
+	if path != stdio {
+		if err := writeFile(path, data, private); err != nil {
+			return err
+		}
+		result["output"] = path
+		return report(cmd, opts, result, text)
+	}
+	if opts.json {
+		result[key] = base64.StdEncoding.EncodeToString(data)
+		return report(cmd, opts, result, "")
+	}
+	_, err := cmd.OutOrStdout().Write(data)
+	return err
+}
+
+func newKeygenCommand(opts *options) *cobra.Command {
+	var algorithm, output, publicOutput string
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a key pair and write it as PEM",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyPair, err := newBackend(opts).KeyGen(cmd.Context(), crypto.Algorithm(algorithm))
+			if err != nil {
+				return fmt.Errorf("failed to generate key pair: %w", err)
+			}
+			keyFile, err := encodeKeyFile(keyPair)
+			if err != nil {
+				return err
+			}
+			publicPEM, err := crypto.MarshalPublicKeyToPEM(keyPair)
+			if err != nil {
+				return err
+			}
+
+			result := map[string]interface{}{
+				"algorithm":   keyPair.Algorithm,
+				"fingerprint": fingerprint(keyPair.PublicKey),
+			}
+			if publicOutput != "" {
+				if err := writeFile(publicOutput, publicPEM, false); err != nil {
+					return err
+				}
+				result["publicOutput"] = publicOutput
+			}
+			if output == stdio && opts.json {
+				privatePEM, err := crypto.MarshalPrivateKeyToPEM(keyPair)
+				if err != nil {
+					return err
+				}
+				result["privateKey"] = string(privatePEM)
+				result["publicKey"] = string(publicPEM)
+				return report(cmd, opts, result, "")
+			}
+			text := fmt.Sprintf("Wrote %s key pair to %s\nFingerprint: %s", keyPair.Algorithm, output, result["fingerprint"])
+			return emit(cmd, opts, output, keyFile, true, "", result, text)
+		},
+	}
+	cmd.Flags().StringVar(&algorithm, "algorithm", string(crypto.AlgMLKEM768), "algorithm of the key pair")
+	cmd.Flags().StringVar(&output, "output", stdio, "file to write the private and public key to")
+	cmd.Flags().StringVar(&publicOutput, "public-output", "", "file to also write the public key to on its own")
+	return cmd
+}
+
+func newEncryptCommand(opts *options) *cobra.Command {
+	var keyPath, in, out string
+	cmd := &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt a file to a KEM public key",
+		Long:  "Encrypt a file to a KEM public key. A fresh shared secret is encapsulated to the key and the data is encrypted with AES-256-GCM under a key derived from it.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyPair, err := requirePublicKey(keyPath)
+			if err != nil {
+				return err
+			}
+			plaintext, err := readInput(in, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			kemCiphertext, sharedSecret, err := newBackend(opts).Encapsulate(cmd.Context(), keyPair.Algorithm, keyPair.PublicKey)
+			if err != nil {
+				return fmt.Errorf("failed to encapsulate: %w", err)
+			}
+			sealed, err := sealEnvelope(kemCiphertext, sharedSecret, plaintext)
+			if err != nil {
+				return err
+			}
+
+			result := map[string]interface{}{"algorithm": keyPair.Algorithm, "bytes": len(sealed)}
+			text := fmt.Sprintf("Encrypted %d bytes with %s to %s", len(plaintext), keyPair.Algorithm, out)
+			return emit(cmd, opts, out, sealed, false, "ciphertext", result, text)
+		},
+	}
+	cmd.Flags().StringVar(&keyPath, "key", "", "PEM file holding the recipient's public key")
+	cmd.Flags().StringVar(&in, "in", stdio, "file to encrypt")
+	cmd.Flags().StringVar(&out, "out", stdio, "file to write the encrypted data to")
+	cmd.MarkFlagRequired("key")
+	return cmd
+}
+
+func newDecryptCommand(opts *options) *cobra.Command {
+	var keyPath, in, out string
+	cmd := &cobra.Command{
+		Use:   "decrypt",
+		Short: "Decrypt a file written by encrypt",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyPair, err := requirePrivateKey(keyPath)
+			if err != nil {
+				return err
+			}
+			defer crypto.ZeroBytes(keyPair.PrivateKey)
+			sealed, err := readInput(in, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			kemCiphertext, err := splitEnvelope(sealed)
+			if err != nil {
+				return err
+			}
+
+			sharedSecret, err := newBackend(opts).Decapsulate(cmd.Context(), keyPair.Algorithm, keyPair.PrivateKey, kemCiphertext)
+			if err != nil {
+				return fmt.Errorf("failed to decapsulate: %w", err)
+			}
+			plaintext, err := openEnvelope(sealed, sharedSecret)
+			if err != nil {
+				return err
+			}
+
+			result := map[string]interface{}{"algorithm": keyPair.Algorithm, "bytes": len(plaintext)}
+			text := fmt.Sprintf("Decrypted %d bytes with %s to %s", len(plaintext), keyPair.Algorithm, out)
+			return emit(cmd, opts, out, plaintext, false, "plaintext", result, text)
+		},
+	}
+	cmd.Flags().StringVar(&keyPath, "key", "", "PEM file holding the private key")
+	cmd.Flags().StringVar(&in, "in", stdio, "file to decrypt")
+	cmd.Flags().StringVar(&out, "out", stdio, "file to write the decrypted data to")
+	cmd.MarkFlagRequired("key")
+	return cmd
+}
+
+func newSignCommand(opts *options) *cobra.Command {
+	var keyPath, in, sigPath string
+	cmd := &cobra.Command{
+		Use:   "sign",
+		Short: "Sign a file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyPair, err := requirePrivateKey(keyPath)
+			if err != nil {
+				return err
+			}
+			defer crypto.ZeroBytes(keyPair.PrivateKey)
+			message, err := readInput(in, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			signature, err := newBackend(opts).Sign(cmd.Context(), keyPair.Algorithm, keyPair.PrivateKey, message)
+			if err != nil {
+				return fmt.Errorf("failed to sign: %w", err)
+			}
+
+			result := map[string]interface{}{"algorithm": keyPair.Algorithm, "bytes": len(signature)}
+			text := fmt.Sprintf("Wrote %s signature to %s", keyPair.Algorithm, sigPath)
+			return emit(cmd, opts, sigPath, signature, false, "signature", result, text)
+		},
+	}
+	cmd.Flags().StringVar(&keyPath, "key", "", "PEM file holding the signing key")
+	cmd.Flags().StringVar(&in, "in", stdio, "file to sign")
+	cmd.Flags().StringVar(&sigPath, "sig", stdio, "file to write the signature to")
+	cmd.MarkFlagRequired("key")
+	return cmd
+}
+
+func newVerifyCommand(opts *options) *cobra.Command {
+	var keyPath, in, sigPath string
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the signature of a file, exiting with status 1 if it is invalid",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if in == stdio && sigPath == stdio {
+				return errors.New("--in and --sig cannot both be standard input")
+			}
+			keyPair, err := requirePublicKey(keyPath)
+			if err != nil {
+				return err
+			}
+			message, err := readInput(in, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			signature, err := readInput(sigPath, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			valid, err := newBackend(opts).Verify(cmd.Context(), keyPair.Algorithm, keyPair.PublicKey, message, signature)
+			if err != nil {
+				return fmt.Errorf("failed to verify: %w", err)
+			}
+
+			text := "Signature is valid"
+			if !valid {
+				text = "Signature is INVALID"
+			}
+			result := map[string]interface{}{"algorithm": keyPair.Algorithm, "valid": valid}
+			if err := report(cmd, opts, result, text); err != nil {
+				return err
+			}
+			if !valid {
+				return errInvalidSignature
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&keyPath, "key", "", "PEM file holding the signer's public key")
+	cmd.Flags().StringVar(&in, "in", stdio, "file that was signed")
+	cmd.Flags().StringVar(&sigPath, "sig", "", "file holding the signature")
+	cmd.MarkFlagRequired("key")
+	cmd.MarkFlagRequired("sig")
+	return cmd
+}
+
+func newFingerprintCommand(opts *options) *cobra.Command {
+	var keyPath string
+	cmd := &cobra.Command{
+		Use:   "fingerprint",
+		Short: "Print the SHA-256 fingerprint of a public key",
+		Long:  "Print the SHA-256 fingerprint of a public key, as reported by the API at key generation. It is always computed locally.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyPair, err := requirePublicKey(keyPath)
+			if err != nil {
+				return err
+			}
+			fp := fingerprint(keyPair.PublicKey)
+			result := map[string]interface{}{"algorithm": keyPair.Algorithm, "fingerprint": fp}
+			return report(cmd, opts, result, fp)
+		},
+	}
+	cmd.Flags().StringVar(&keyPath, "key", "", "PEM file holding the public key")
+	cmd.MarkFlagRequired("key")
+	return cmd
+}
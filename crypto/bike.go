@@ -0,0 +1,190 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/cloudflare/circl/kem"
+	"github.com/cloudflare/circl/kem/schemes"
+)
+
+// BIKEProvider implements the FallibleKEMProvider interface for BIKE (Bit Flipping Key
+// Encapsulation). Decapsulation decodes with a bit-flipping decoder that fails
+// with a small probability, given by DecapsulationFailureRate in Metadata.
+type BIKEProvider struct {
+	algorithm Algorithm
+	scheme    kem.Scheme
+	metadata  AlgorithmMetadata
+}
+
+// NewBIKEL1Provider creates a new BIKE level 1 provider
+func NewBIKEL1Provider() *BIKEProvider {
+	return &BIKEProvider{
+		algorithm: AlgBIKEL1,
+		scheme:    schemes.ByName("BIKE1-L1-CPA"),
+		metadata: AlgorithmMetadata{
+			Algorithm:                AlgBIKEL1,
+			Family:                   "code",
+			NISTLevel:                1,
+			PublicKeySize:            1541,
+			PrivateKeySize:           5223,
+			OutputSize:               1573,
+			DecapsulationFailureRate: math.Exp2(-128),
+		},
+	}
+}
+
+// NewBIKEL3Provider creates a new BIKE level 3 provider
+func NewBIKEL3Provider() *BIKEProvider {
+	return &BIKEProvider{
+		algorithm: AlgBIKEL3,
+		scheme:    schemes.ByName("BIKE1-L3-CPA"),
+		metadata: AlgorithmMetadata{
+			Algorithm:                AlgBIKEL3,
+			Family:                   "code",
+			NISTLevel:                3,
+			PublicKeySize:            3083,
+			PrivateKeySize:           10105,
+			OutputSize:               3115,
+			DecapsulationFailureRate: math.Exp2(-192),
+		},
+	}
+}
+
+// Name returns the algorithm name
+func (p *BIKEProvider) Name() Algorithm {
+	return p.algorithm
+}
+
+// Metadata returns the BIKE parameters for this security level. The sizes and
+// decapsulation failure rates are those of the BIKE round 4 specification.
+// Unlike ML-KEM, a valid ciphertext may fail to decapsulate to the right
+// secret, so protocols using BIKE must tolerate a failed handshake.
+func (p *BIKEProvider) Metadata() AlgorithmMetadata {
+	metadata := p.metadata
+	if p.Available() {
+		metadata.PublicKeySize = p.scheme.PublicKeySize()
+		metadata.PrivateKeySize = p.scheme.PrivateKeySize()
+		metadata.OutputSize = p.scheme.CiphertextSize()
+	}
+	return metadata
+}
+
+// IsFallible reports that a valid BIKE ciphertext may fail to decapsulate
+func (p *BIKEProvider) IsFallible() bool {
+	return true
+}
+
+// Available reports whether the linked CIRCL version ships this BIKE parameter
+// set. DefaultRegistry only registers BIKE when it does.
+func (p *BIKEProvider) Available() bool {
+	return p.scheme != nil
+}
+
+// KeyGen generates a new BIKE key pair
+func (p *BIKEProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", p.algorithm); err != nil {
+		return KeyPair{}, err
+	}
+
+	if !p.Available() {
+		return KeyPair{}, p.unavailableError("KeyGen")
+	}
+
+	// Generate key pair
+	pk, sk, err := p.scheme.GenerateKeyPair()
+	if err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", p.algorithm, fmt.Errorf("failed to generate key pair: %w", err))
+	}
+
+	// Extract public and private keys as bytes
+	publicKey, err := pk.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", p.algorithm, fmt.Errorf("failed to marshal public key: %w", err))
+	}
+
+	privateKey, err := sk.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", p.algorithm, fmt.Errorf("failed to marshal private key: %w", err))
+	}
+
+	if err := checkContext(ctx, "KeyGen", p.algorithm); err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Algorithm:  p.algorithm,
+	}, nil
+}
+
+// Encapsulate generates a shared secret and ciphertext using the recipient's public key
+func (p *BIKEProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	if err := checkContext(ctx, "Encapsulate", p.algorithm); err != nil {
+		return nil, nil, err
+	}
+
+	if !p.Available() {
+		return nil, nil, p.unavailableError("Encapsulate")
+	}
+
+	// Parse public key from bytes
+	pk, err := p.scheme.UnmarshalBinaryPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, nil, newCryptoError(ErrCodeInvalidKey, "Encapsulate", p.algorithm, fmt.Errorf("failed to parse public key: %w", err))
+	}
+
+	// Encapsulate to generate ciphertext and shared secret
+	ct, ss, err := p.scheme.Encapsulate(pk)
+	if err != nil {
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", p.algorithm, err)
+	}
+
+	if err := checkContext(ctx, "Encapsulate", p.algorithm); err != nil {
+		return nil, nil, err
+	}
+	return ct, ss, nil
+}
+
+// Decapsulate recovers the shared secret from the ciphertext using the private
+// key. With probability DecapsulationFailureRate the secret of a valid
+// ciphertext is wrong, without an error.
+func (p *BIKEProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	if err := checkContext(ctx, "Decapsulate", p.algorithm); err != nil {
+		return nil, err
+	}
+
+	if !p.Available() {
+		return nil, p.unavailableError("Decapsulate")
+	}
+
+	// Parse private key from bytes
+	sk, err := p.scheme.UnmarshalBinaryPrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "Decapsulate", p.algorithm, fmt.Errorf("failed to parse private key: %w", err))
+	}
+
+	if err := ValidateCiphertextSize(p.algorithm, ciphertextBytes); err != nil {
+		return nil, err
+	}
+
+	// Decapsulate to recover the shared secret
+	ss, err := p.scheme.Decapsulate(sk, ciphertextBytes)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidInput, "Decapsulate", p.algorithm, fmt.Errorf("invalid ciphertext: %w", err))
+	}
+
+	if err := checkContext(ctx, "Decapsulate", p.algorithm); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// unavailableError explains why a BIKE operation cannot be performed
+func (p *BIKEProvider) unavailableError(op string) error {
+	return newCryptoError(ErrCodeUnsupported, op, p.algorithm, fmt.Errorf("%s is not supported by the linked CIRCL version", p.algorithm))
+}
@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+)
+
+// KeyBundle is a KEM key pair and a signature key pair generated together,
+// for protocols that present both at once when negotiating, such as a PQ
+// key alongside a classical one in a TLS 1.3 hybrid key share
+type KeyBundle struct {
+	KEM       KeyPair
+	Signature KeyPair
+	CreatedAt time.Time
+}
+
+// GenerateBundle generates a key pair for the KEM algorithm and one for the
+// signature algorithm from the registry. If the second key generation fails,
+// the first private key is zeroed before returning.
+func GenerateBundle(ctx context.Context, kemAlg, sigAlg Algorithm, reg *Registry) (KeyBundle, error) {
+	kemProvider, err := reg.GetKEMProvider(kemAlg)
+	if err != nil {
+		return KeyBundle{}, err
+	}
+	sigProvider, err := reg.GetSignatureProvider(sigAlg)
+	if err != nil {
+		return KeyBundle{}, err
+	}
+
+	kemKeyPair, err := kemProvider.KeyGen(ctx)
+	if err != nil {
+		return KeyBundle{}, fmt.Errorf("failed to generate bundle KEM key: %w", err)
+	}
+	sigKeyPair, err := sigProvider.KeyGen(ctx)
+	if err != nil {
+		ZeroBytes(kemKeyPair.PrivateKey)
+		return KeyBundle{}, fmt.Errorf("failed to generate bundle signature key: %w", err)
+	}
+
+	return KeyBundle{
+		KEM:       kemKeyPair,
+		Signature: sigKeyPair,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Fingerprint returns the SHA-256 digest of the KEM public key followed by
+// the signature public key, identifying the bundle as a whole
+func (b KeyBundle) Fingerprint() []byte {
+	hash := sha256.New()
+	hash.Write(b.KEM.PublicKey)
+	hash.Write(b.Signature.PublicKey)
+	return hash.Sum(nil)
+}
+
+// Zero overwrites both private keys with zeros
+func (b KeyBundle) Zero() {
+	ZeroBytes(b.KEM.PrivateKey)
+	ZeroBytes(b.Signature.PrivateKey)
+}
@@ -0,0 +1,233 @@
+package crypto
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyCache hands out recently generated key pairs so callers that only need a
+// short-lived shared key don't pay for key generation on every request.
+// Entries expire after a TTL and the least recently used entry is evicted once
+// the cache is full. Private keys are zeroed when their entry is removed.
+type KeyCache struct {
+	registry   *Registry
+	maxEntries int
+	ttl        time.Duration
+	entries    sync.Map     // Algorithm -> *cacheEntry
+	mutex      sync.RWMutex // Readers copy keys, writers generate and zero them
+	hits       atomic.Int64
+	misses     atomic.Int64
+	now        func() time.Time
+	stop       chan struct{}
+	once       sync.Once
+}
+
+// cacheEntry is a cached key pair and its bookkeeping
+type cacheEntry struct {
+	keyPair   KeyPair
+	createdAt time.Time
+	lastUsed  atomic.Int64 // Unix nanoseconds
+}
+
+// KeyCacheStats reports how effective the key cache has been
+type KeyCacheStats struct {
+	Hits       int64 `json:"hits"`
+	Misses     int64 `json:"misses"`
+	Entries    int   `json:"entries"`
+	MaxEntries int   `json:"maxEntries"`
+	TTLSeconds int64 `json:"ttlSeconds"`
+}
+
+// EnableKeyCache attaches a key cache to the registry, replacing any existing one
+func (r *Registry) EnableKeyCache(maxEntries int, ttl time.Duration) {
+	if r.keyCache != nil {
+		r.keyCache.Stop()
+	}
+	r.keyCache = newKeyCache(r, maxEntries, ttl)
+}
+
+// KeyCache returns the registry's key cache, or nil if it is not enabled
+func (r *Registry) KeyCache() *KeyCache {
+	return r.keyCache
+}
+
+// newKeyCache creates a key cache and starts its expiry loop
+func newKeyCache(registry *Registry, maxEntries int, ttl time.Duration) *KeyCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	c := &KeyCache{
+		registry:   registry,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		stop:       make(chan struct{}),
+	}
+	go c.expireLoop()
+	return c
+}
+
+// GetOrGenerate returns a copy of the cached key pair for an algorithm if it is
+// younger than the TTL, otherwise it generates and caches a new one
+func (c *KeyCache) GetOrGenerate(ctx context.Context, alg Algorithm) (KeyPair, error) {
+	c.mutex.RLock()
+	keyPair, ok := c.lookup(alg)
+	c.mutex.RUnlock()
+	if ok {
+		c.hits.Add(1)
+		return keyPair, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Another caller may have filled the entry while we waited
+	if keyPair, ok := c.lookup(alg); ok {
+		c.hits.Add(1)
+		return keyPair, nil
+	}
+	c.misses.Add(1)
+
+	provider, err := c.registry.provider(alg)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	keyPair, err = provider.KeyGen(ctx)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	now := c.now()
+	entry := &cacheEntry{keyPair: keyPair, createdAt: now}
+	entry.lastUsed.Store(now.UnixNano())
+	if previous, loaded := c.entries.Swap(alg, entry); loaded {
+		zeroKeyPair(previous.(*cacheEntry).keyPair)
+	}
+	c.evictOverflow()
+
+	return copyKeyPair(keyPair), nil
+}
+
+// lookup returns a copy of a fresh cached key pair and marks it as used.
+// The caller must hold the mutex for reading or writing.
+func (c *KeyCache) lookup(alg Algorithm) (KeyPair, bool) {
+	value, ok := c.entries.Load(alg)
+	if !ok {
+		return KeyPair{}, false
+	}
+	entry := value.(*cacheEntry)
+	now := c.now()
+	if now.Sub(entry.createdAt) >= c.ttl {
+		return KeyPair{}, false
+	}
+	entry.lastUsed.Store(now.UnixNano())
+	return copyKeyPair(entry.keyPair), true
+}
+
+// evictOverflow removes least recently used entries until the cache fits.
+// The caller must hold the mutex.
+func (c *KeyCache) evictOverflow() {
+	for {
+		var count int
+		var oldest Algorithm
+		var oldestUsed int64
+		c.entries.Range(func(key, value interface{}) bool {
+			used := value.(*cacheEntry).lastUsed.Load()
+			if count == 0 || used < oldestUsed {
+				oldest, oldestUsed = key.(Algorithm), used
+			}
+			count++
+			return true
+		})
+		if count <= c.maxEntries {
+			return
+		}
+		c.remove(oldest)
+	}
+}
+
+// expire removes every entry older than the TTL
+func (c *KeyCache) expire() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	c.entries.Range(func(key, value interface{}) bool {
+		if now.Sub(value.(*cacheEntry).createdAt) >= c.ttl {
+			c.remove(key.(Algorithm))
+		}
+		return true
+	})
+}
+
+// remove deletes an entry and zeroes its private key
+func (c *KeyCache) remove(alg Algorithm) {
+	if value, loaded := c.entries.LoadAndDelete(alg); loaded {
+		zeroKeyPair(value.(*cacheEntry).keyPair)
+	}
+}
+
+// expireLoop periodically drops expired entries until Stop is called
+func (c *KeyCache) expireLoop() {
+	interval := c.ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.expire()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Stop ends the expiry loop and zeroes every cached private key
+func (c *KeyCache) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.entries.Range(func(key, _ interface{}) bool {
+			c.remove(key.(Algorithm))
+			return true
+		})
+	})
+}
+
+// Stats returns the cache's hit and miss counts and current size
+func (c *KeyCache) Stats() KeyCacheStats {
+	entries := 0
+	c.entries.Range(func(_, _ interface{}) bool {
+		entries++
+		return true
+	})
+	return KeyCacheStats{
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Entries:    entries,
+		MaxEntries: c.maxEntries,
+		TTLSeconds: int64(c.ttl.Seconds()),
+	}
+}
+
+// copyKeyPair returns a key pair with its own copies of the key bytes, so
+// zeroing a cached entry never affects keys already handed out
+func copyKeyPair(keyPair KeyPair) KeyPair {
+	return KeyPair{
+		PublicKey:  append([]byte(nil), keyPair.PublicKey...),
+		PrivateKey: append([]byte(nil), keyPair.PrivateKey...),
+		Algorithm:  keyPair.Algorithm,
+	}
+}
+
+// zeroKeyPair overwrites a private key in place
+func zeroKeyPair(keyPair KeyPair) {
+	ZeroBytes(keyPair.PrivateKey)
+}
@@ -0,0 +1,1452 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestHybridKEMRoundTrip(t *testing.T) {
+	provider := NewHybridKEMProvider()
+
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate hybrid key pair: %v", err)
+	}
+	if keyPair.Algorithm != AlgHybridMLKEMECDH {
+		t.Errorf("Expected algorithm %s, got %s", AlgHybridMLKEMECDH, keyPair.Algorithm)
+	}
+
+	ciphertext, sharedSecret, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+
+	recovered, err := provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext)
+	if err != nil {
+		t.Fatalf("Decapsulation failed: %v", err)
+	}
+	if !SecureCompare(sharedSecret, recovered) {
+		t.Error("Decapsulated shared secret does not match encapsulated one")
+	}
+
+	// The combined secret must differ from either component secret
+	pqSize := provider.mlkem.scheme.CiphertextSize()
+	pqSecret, err := provider.mlkem.Decapsulate(context.Background(), keyPair.PrivateKey[:provider.mlkem.scheme.PrivateKeySize()], ciphertext[:pqSize])
+	if err != nil {
+		t.Fatalf("ML-KEM-768 component decapsulation failed: %v", err)
+	}
+	if SecureCompare(sharedSecret, pqSecret) {
+		t.Error("Hybrid shared secret equals the ML-KEM-768 component secret")
+	}
+
+	// Altering the classical component must change the derived secret
+	tampered := append([]byte{}, ciphertext...)
+	other, err := provider.ecdh.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate ECDH key: %v", err)
+	}
+	copy(tampered[pqSize:], other.PublicKey)
+	recovered, err = provider.Decapsulate(context.Background(), keyPair.PrivateKey, tampered)
+	if err != nil {
+		t.Fatalf("Decapsulation of tampered ciphertext failed: %v", err)
+	}
+	if SecureCompare(sharedSecret, recovered) {
+		t.Error("Expected tampered ciphertext to yield a different shared secret")
+	}
+}
+
+func TestHybridKEMRejectsShortInput(t *testing.T) {
+	provider := NewHybridKEMProvider()
+
+	if _, _, err := provider.Encapsulate(context.Background(), make([]byte, 16)); err == nil {
+		t.Error("Expected error for truncated hybrid public key")
+	}
+}
+
+func BenchmarkHybridKEMRoundTrip(b *testing.B) {
+	provider := NewHybridKEMProvider()
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		b.Fatalf("Failed to generate hybrid key pair: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ciphertext, sharedSecret, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+		if err != nil {
+			b.Fatalf("Encapsulation failed: %v", err)
+		}
+		recovered, err := provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext)
+		if err != nil {
+			b.Fatalf("Decapsulation failed: %v", err)
+		}
+		if !SecureCompare(sharedSecret, recovered) {
+			b.Fatal("Shared secret mismatch")
+		}
+	}
+}
+
+func TestRegistryListAlgorithms(t *testing.T) {
+	registry := DefaultRegistry()
+
+	kems := registry.ListKEMAlgorithms()
+	expectedKEMs := []Algorithm{AlgECDH, AlgHybridMLKEMECDH, AlgMLKEM768}
+	if NewFrodoKEM640Provider().Available() {
+		expectedKEMs = append(expectedKEMs, AlgFrodoKEM640, AlgFrodoKEM976)
+	}
+	if NewBIKEL1Provider().Available() {
+		expectedKEMs = append(expectedKEMs, AlgBIKEL1, AlgBIKEL3)
+	}
+	if NewMcEliece348864Provider().Available() {
+		expectedKEMs = append(expectedKEMs, AlgMcEliece348864, AlgMcEliece460896)
+	}
+	if NewHQC128Provider().Available() {
+		expectedKEMs = append(expectedKEMs, AlgHQC128, AlgHQC256)
+	}
+	slices.Sort(expectedKEMs)
+	if len(kems) != len(expectedKEMs) {
+		t.Fatalf("Expected %d KEM algorithms, got %v", len(expectedKEMs), kems)
+	}
+	for i, alg := range expectedKEMs {
+		if kems[i] != alg {
+			t.Errorf("KEM %d: Expected %s, got %s", i, alg, kems[i])
+		}
+	}
+
+	sigs := registry.ListSignatureAlgorithms()
+	for i := 1; i < len(sigs); i++ {
+		if sigs[i-1] >= sigs[i] {
+			t.Errorf("Signature algorithms are not sorted: %v", sigs)
+		}
+	}
+}
+
+func TestRegistryAlgorithmInfo(t *testing.T) {
+	registry := DefaultRegistry()
+
+	// Reported key sizes must match what the providers actually generate
+	for _, alg := range append(registry.ListKEMAlgorithms(), AlgMLDSA65, AlgECDSA) {
+		info, err := registry.AlgorithmInfo(alg)
+		if err != nil {
+			t.Fatalf("Failed to get info for %s: %v", alg, err)
+		}
+		if info.Family == "" {
+			t.Errorf("%s: Expected a family", alg)
+		}
+
+		var keyPair KeyPair
+		if kem, err := registry.GetKEMProvider(alg); err == nil {
+			keyPair, err = kem.KeyGen(context.Background())
+			if err != nil {
+				t.Fatalf("%s: KeyGen failed: %v", alg, err)
+			}
+		} else {
+			sig, _ := registry.GetSignatureProvider(alg)
+			keyPair, err = sig.KeyGen(context.Background())
+			if err != nil {
+				t.Fatalf("%s: KeyGen failed: %v", alg, err)
+			}
+		}
+		if len(keyPair.PublicKey) != info.PublicKeySize {
+			t.Errorf("%s: Expected public key size %d, got %d", alg, info.PublicKeySize, len(keyPair.PublicKey))
+		}
+		if len(keyPair.PrivateKey) != info.PrivateKeySize {
+			t.Errorf("%s: Expected private key size %d, got %d", alg, info.PrivateKeySize, len(keyPair.PrivateKey))
+		}
+	}
+
+	if _, err := registry.AlgorithmInfo("unknown"); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+}
+
+func TestAlgorithmValidation(t *testing.T) {
+	registry := DefaultRegistry()
+
+	// One case per registered algorithm, sized from what its provider reports
+	type testCase struct {
+		alg  Algorithm
+		size int
+	}
+	var tests []testCase
+	for _, alg := range append(registry.ListKEMAlgorithms(), registry.ListSignatureAlgorithms()...) {
+		info, err := registry.AlgorithmInfo(alg)
+		if err != nil {
+			t.Fatalf("Failed to get info for %s: %v", alg, err)
+		}
+		tests = append(tests, testCase{alg, info.PublicKeySize})
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.alg), func(t *testing.T) {
+			if err := registry.ValidateAlgorithm(tt.alg); err != nil {
+				t.Errorf("Expected %s to be valid, got %v", tt.alg, err)
+			}
+			if err := ValidatePublicKeySize(tt.alg, make([]byte, tt.size)); err != nil {
+				t.Errorf("Expected a %d byte key to be valid, got %v", tt.size, err)
+			}
+
+			err := ValidatePublicKeySize(tt.alg, make([]byte, tt.size-1))
+			want := fmt.Sprintf("public key for %s must be %d bytes, got %d", tt.alg, tt.size, tt.size-1)
+			if err == nil || err.Error() != want {
+				t.Errorf("Expected error %q, got %v", want, err)
+			}
+			if err := ValidatePublicKeySize(tt.alg, nil); err == nil {
+				t.Error("Expected error for an empty key")
+			}
+		})
+	}
+
+	if err := registry.ValidateAlgorithm("kyber-512"); err == nil {
+		t.Error("Expected error for an unregistered algorithm")
+	}
+	if err := ValidatePublicKeySize("kyber-512", make([]byte, 800)); err == nil {
+		t.Error("Expected error for an unknown algorithm")
+	}
+}
+
+func TestSPHINCSSignVerify(t *testing.T) {
+	providers := []*SPHINCSProvider{NewSPHINCS128sProvider(), NewSPHINCS256sProvider()}
+
+	for _, provider := range providers {
+		t.Run(string(provider.Name()), func(t *testing.T) {
+			keyPair, err := provider.KeyGen(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to generate key pair: %v", err)
+			}
+
+			message := []byte("This is a test message for SPHINCS+ signatures")
+			signature, err := provider.Sign(context.Background(), keyPair.PrivateKey, message)
+			if err != nil {
+				t.Fatalf("Signing failed: %v", err)
+			}
+			if len(signature) != provider.Metadata().OutputSize {
+				t.Errorf("Expected signature size %d, got %d", provider.Metadata().OutputSize, len(signature))
+			}
+
+			valid, err := provider.Verify(context.Background(), keyPair.PublicKey, message, signature)
+			if err != nil || !valid {
+				t.Errorf("Expected valid signature, got valid=%v err=%v", valid, err)
+			}
+
+			// A forged signature must be rejected
+			forged := append([]byte{}, signature...)
+			forged[len(forged)/2] ^= 0xFF
+			valid, err = provider.Verify(context.Background(), keyPair.PublicKey, message, forged)
+			if err != nil {
+				t.Fatalf("Verification returned an error: %v", err)
+			}
+			if valid {
+				t.Error("Expected forged signature to fail verification")
+			}
+		})
+	}
+}
+
+func BenchmarkSPHINCS128sKeyGen(b *testing.B) {
+	provider := NewSPHINCS128sProvider()
+	for i := 0; i < b.N; i++ {
+		if _, err := provider.KeyGen(context.Background()); err != nil {
+			b.Fatalf("KeyGen failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkSPHINCS128sSign(b *testing.B) {
+	provider := NewSPHINCS128sProvider()
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		b.Fatalf("KeyGen failed: %v", err)
+	}
+	message := []byte("benchmark message")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := provider.Sign(context.Background(), keyPair.PrivateKey, message); err != nil {
+			b.Fatalf("Sign failed: %v", err)
+		}
+	}
+}
+
+func TestPEMRoundTrip(t *testing.T) {
+	keyPair, err := NewMLKEM768Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	publicPEM, err := MarshalPublicKeyToPEM(keyPair)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	if !bytes.Contains(publicPEM, []byte("-----BEGIN ML-KEM-768 PUBLIC KEY-----")) {
+		t.Errorf("Unexpected PEM header: %s", publicPEM[:40])
+	}
+
+	privatePEM, err := MarshalPrivateKeyToPEM(keyPair)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+
+	public, err := UnmarshalPublicKeyFromPEM(publicPEM)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal public key: %v", err)
+	}
+	if public.Algorithm != AlgMLKEM768 || !bytes.Equal(public.PublicKey, keyPair.PublicKey) {
+		t.Error("Public key does not survive a PEM round trip")
+	}
+
+	private, err := UnmarshalPrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal private key: %v", err)
+	}
+	if private.Algorithm != AlgMLKEM768 || !bytes.Equal(private.PrivateKey, keyPair.PrivateKey) {
+		t.Error("Private key does not survive a PEM round trip")
+	}
+
+	// A public key block must not be accepted as a private key
+	if _, err := UnmarshalPrivateKeyFromPEM(publicPEM); err == nil {
+		t.Error("Expected error when decoding a public key block as a private key")
+	}
+}
+
+func TestPEMUnknownBlockType(t *testing.T) {
+	data := []byte("-----BEGIN RSA PUBLIC KEY-----\nAAAA\n-----END RSA PUBLIC KEY-----\n")
+
+	_, err := UnmarshalPublicKeyFromPEM(data)
+	if err == nil {
+		t.Fatal("Expected error for unknown PEM block type")
+	}
+	if !strings.Contains(err.Error(), "RSA PUBLIC KEY") {
+		t.Errorf("Expected error to name the block type, got: %v", err)
+	}
+
+	if _, err := UnmarshalPublicKeyFromPEM([]byte("not pem")); err == nil {
+		t.Error("Expected error for non-PEM input")
+	}
+}
+
+func TestPKCS12RoundTrip(t *testing.T) {
+	providers := map[string]func(context.Context) (KeyPair, error){
+		"ml-kem-768": NewMLKEM768Provider().KeyGen,
+		"ml-dsa-65":  NewMLDSA65Provider().KeyGen,
+		"ecdh":       NewECDHProvider().KeyGen,
+		"ecdsa":      NewECDSAProvider().KeyGen,
+	}
+	encryptions := map[string]PKCS12Encryption{"modern": PKCS12Modern, "legacy": PKCS12Legacy}
+
+	for name, keyGen := range providers {
+		keyPair, err := keyGen(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to generate %s key pair: %v", name, err)
+		}
+		for mode, encryption := range encryptions {
+			pfx, err := ExportPKCS12WithEncryption(keyPair, "correct horse", encryption)
+			if err != nil {
+				t.Fatalf("Failed to export %s key (%s): %v", name, mode, err)
+			}
+
+			imported, err := ImportPKCS12(pfx, "correct horse")
+			if err != nil {
+				t.Fatalf("Failed to import %s key (%s): %v", name, mode, err)
+			}
+			if imported.Algorithm != keyPair.Algorithm {
+				t.Errorf("Expected algorithm %s, got %s", keyPair.Algorithm, imported.Algorithm)
+			}
+			if !bytes.Equal(imported.PrivateKey, keyPair.PrivateKey) || !bytes.Equal(imported.PublicKey, keyPair.PublicKey) {
+				t.Errorf("%s key material does not survive a PKCS#12 round trip (%s)", name, mode)
+			}
+
+			if _, err := ImportPKCS12(pfx, "wrong password"); err == nil {
+				t.Errorf("Expected error importing %s bundle with the wrong password (%s)", name, mode)
+			}
+		}
+	}
+}
+
+// The bundles in testdata/pkcs12 were written by OpenSSL 3.0 from key.pem, a
+// P-256 key, with the password "interop":
+//
+//	openssl pkcs12 -export -nocerts -inkey key.pem -name ecdsa -passout pass:interop -out openssl-modern.p12
+//	openssl pkcs12 -export -nocerts -inkey key.pem -name ecdsa -keypbe PBE-SHA1-3DES -macalg sha1 -passout pass:interop -out openssl-legacy.p12
+//	openssl pkcs12 -export -nocerts -inkey key.pem -name ecdh -passout pass:interop -out openssl-ecdh.p12
+func TestPKCS12ImportOpenSSL(t *testing.T) {
+	keyPEM, err := os.ReadFile("testdata/pkcs12/key.pem")
+	if err != nil {
+		t.Fatalf("Failed to read key: %v", err)
+	}
+	expected := parseECPrivateKeyPEM(t, keyPEM)
+
+	for _, tc := range []struct {
+		file string
+		alg  Algorithm
+	}{
+		{"openssl-modern.p12", AlgECDSA},
+		{"openssl-legacy.p12", AlgECDSA},
+		{"openssl-ecdh.p12", AlgECDH},
+	} {
+		pfx, err := os.ReadFile(filepath.Join("testdata/pkcs12", tc.file))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", tc.file, err)
+		}
+		imported, err := ImportPKCS12(pfx, "interop")
+		if err != nil {
+			t.Fatalf("Failed to import %s: %v", tc.file, err)
+		}
+		if imported.Algorithm != tc.alg {
+			t.Errorf("%s: Expected algorithm %s, got %s", tc.file, tc.alg, imported.Algorithm)
+		}
+		publicKey := elliptic.MarshalCompressed(expected.Curve, expected.X, expected.Y)
+		if tc.alg == AlgECDH {
+			publicKey = elliptic.Marshal(expected.Curve, expected.X, expected.Y)
+		} else if !bytes.Equal(imported.PrivateKey, expected.D.Bytes()) {
+			t.Errorf("%s: Private key does not match key.pem", tc.file)
+		}
+		if !bytes.Equal(imported.PublicKey, publicKey) {
+			t.Errorf("%s: Public key does not match key.pem", tc.file)
+		}
+
+		if _, err := ImportPKCS12(pfx, "wrong password"); err == nil {
+			t.Errorf("%s: Expected error importing with the wrong password", tc.file)
+		}
+	}
+}
+
+// OpenSSL checks the MAC of every exported bundle and reads back the EC keys.
+// It can't parse the post-quantum keys themselves.
+func TestPKCS12ExportReadByOpenSSL(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+	providers := map[string]func(context.Context) (KeyPair, error){
+		"ml-kem-768": NewMLKEM768Provider().KeyGen,
+		"ml-dsa-65":  NewMLDSA65Provider().KeyGen,
+		"ecdh":       NewECDHProvider().KeyGen,
+		"ecdsa":      NewECDSAProvider().KeyGen,
+	}
+	encryptions := map[string]PKCS12Encryption{"modern": PKCS12Modern, "legacy": PKCS12Legacy}
+	dir := t.TempDir()
+
+	for name, keyGen := range providers {
+		keyPair, err := keyGen(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to generate %s key pair: %v", name, err)
+		}
+		for mode, encryption := range encryptions {
+			pfx, err := ExportPKCS12WithEncryption(keyPair, "correct horse", encryption)
+			if err != nil {
+				t.Fatalf("Failed to export %s key (%s): %v", name, mode, err)
+			}
+			file := filepath.Join(dir, name+"-"+mode+".p12")
+			if err := os.WriteFile(file, pfx, 0o600); err != nil {
+				t.Fatalf("Failed to write bundle: %v", err)
+			}
+
+			if out, err := exec.Command("openssl", "pkcs12", "-in", file, "-passin", "pass:correct horse", "-noout").CombinedOutput(); err != nil {
+				t.Errorf("OpenSSL rejected the %s bundle (%s): %v\n%s", name, mode, err, out)
+			}
+			if err := exec.Command("openssl", "pkcs12", "-in", file, "-passin", "pass:wrong password", "-noout").Run(); err == nil {
+				t.Errorf("Expected OpenSSL to fail the MAC of the %s bundle (%s) with the wrong password", name, mode)
+			}
+			if keyPair.Algorithm != AlgECDH && keyPair.Algorithm != AlgECDSA {
+				continue
+			}
+
+			out, err := exec.Command("openssl", "pkcs12", "-in", file, "-passin", "pass:correct horse", "-nodes", "-nocerts").Output()
+			if err != nil {
+				t.Fatalf("OpenSSL failed to decrypt the %s key (%s): %v", name, mode, err)
+			}
+			key := parseECPrivateKeyPEM(t, out)
+			publicKey := elliptic.MarshalCompressed(key.Curve, key.X, key.Y)
+			if keyPair.Algorithm == AlgECDH {
+				publicKey = elliptic.Marshal(key.Curve, key.X, key.Y)
+			}
+			if !bytes.Equal(publicKey, keyPair.PublicKey) {
+				t.Errorf("OpenSSL read a different %s key (%s)", name, mode)
+			}
+		}
+	}
+}
+
+// parseECPrivateKeyPEM parses the PKCS#8 P-256 key in data
+func parseECPrivateKeyPEM(t *testing.T, data []byte) *ecdsa.PrivateKey {
+	t.Helper()
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		t.Fatalf("Expected a PKCS#8 private key, got %q", data)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse private key: %v", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		t.Fatalf("Expected an EC key, got %T", key)
+	}
+	return ecKey
+}
+
+func TestPKCS12DefaultsToAES(t *testing.T) {
+	keyPair, err := NewMLDSA44Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	pfx, err := ExportPKCS12(keyPair, "secret")
+	if err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+	aesOID, _ := asn1.Marshal(oidAES256CBC)
+	if !bytes.Contains(pfx, aesOID) {
+		t.Error("Expected ExportPKCS12 to encrypt with AES-256-CBC")
+	}
+
+	imported, err := ImportPKCS12(pfx, "secret")
+	if err != nil {
+		t.Fatalf("Failed to import key: %v", err)
+	}
+	if !bytes.Equal(imported.PrivateKey, keyPair.PrivateKey) {
+		t.Error("Private key does not survive a PKCS#12 round trip")
+	}
+}
+
+func TestPKCS8PrivateKeyInfo(t *testing.T) {
+	keyPair, err := NewMLDSA44Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	der, err := marshalPKCS8(keyPair)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	var key oneAsymmetricKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	if key.Version != 0 || len(key.PublicKey.Bytes) != 0 || !key.Algorithm.Algorithm.Equal(pkcs8Algorithms[AlgMLDSA44].oid) {
+		t.Errorf("Expected a version 1 PrivateKeyInfo without a public key, got version %d with %v", key.Version, key.Algorithm.Algorithm)
+	}
+	var privateKey []byte
+	if _, err := asn1.Unmarshal(key.PrivateKey, &privateKey); err != nil || !bytes.Equal(privateKey, keyPair.PrivateKey) {
+		t.Errorf("Expected privateKey to hold the key as an OCTET STRING: %v", err)
+	}
+
+	// Version 2 keys are accepted if their public key matches
+	for _, tc := range []struct {
+		publicKey []byte
+		valid     bool
+	}{
+		{keyPair.PublicKey, true},
+		{make([]byte, len(keyPair.PublicKey)), false},
+	} {
+		key.Version = 1
+		key.PublicKey = asn1.BitString{Bytes: tc.publicKey, BitLength: 8 * len(tc.publicKey)}
+		v2, err := asn1.Marshal(key)
+		if err != nil {
+			t.Fatalf("Failed to encode version 2 key: %v", err)
+		}
+		imported, err := unmarshalPKCS8(AlgMLDSA44, v2)
+		if tc.valid && (err != nil || !bytes.Equal(imported.PublicKey, keyPair.PublicKey)) {
+			t.Errorf("Expected a version 2 key to import, got %v", err)
+		}
+		if !tc.valid && err == nil {
+			t.Error("Expected a mismatched public key to be rejected")
+		}
+	}
+}
+
+func TestPKCS12UnsupportedAlgorithm(t *testing.T) {
+	keyPair, err := NewHybridKEMProvider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	if _, err := ExportPKCS12(keyPair, "secret"); err == nil {
+		t.Error("Expected error exporting a hybrid key")
+	}
+	if _, err := ImportPKCS12([]byte("not a pfx"), "secret"); err == nil {
+		t.Error("Expected error importing malformed data")
+	}
+}
+
+func TestDeriveKeyRFC5869(t *testing.T) {
+	// Test cases 1 and 3 from RFC 5869 Appendix A (HKDF-SHA256)
+	cases := []struct {
+		name string
+		ikm  string
+		salt string
+		info string
+		okm  string
+	}{
+		{
+			name: "basic",
+			ikm:  "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			salt: "000102030405060708090a0b0c",
+			info: "f0f1f2f3f4f5f6f7f8f9",
+			okm:  "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+		},
+		{
+			name: "zero-length salt and info",
+			ikm:  "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			okm:  "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ikm, _ := hex.DecodeString(tc.ikm)
+			salt, _ := hex.DecodeString(tc.salt)
+			info, _ := hex.DecodeString(tc.info)
+			expected, _ := hex.DecodeString(tc.okm)
+
+			okm, err := DeriveKeyWithSalt(ikm, salt, info, len(expected))
+			if err != nil {
+				t.Fatalf("Key derivation failed: %v", err)
+			}
+			if !bytes.Equal(okm, expected) {
+				t.Errorf("Expected OKM %x, got %x", expected, okm)
+			}
+		})
+	}
+}
+
+func TestDeriveKeyInvalidLength(t *testing.T) {
+	secret := []byte("shared secret")
+
+	if _, err := DeriveKey(secret, nil, 0); err == nil {
+		t.Error("Expected error for zero length")
+	}
+	if _, err := DeriveKey(secret, nil, MaxDerivedKeyLength+1); err == nil {
+		t.Error("Expected error for length above the HKDF limit")
+	}
+	if _, err := DeriveKey(nil, nil, 32); err == nil {
+		t.Error("Expected error for empty shared secret")
+	}
+}
+
+func TestMLDSASignVerify(t *testing.T) {
+	providers := []SignatureProvider{NewMLDSA44Provider(), NewMLDSA65Provider(), NewMLDSA87Provider()}
+	message := []byte("This is a test message for ML-DSA signatures")
+
+	keyPairs := make([]KeyPair, len(providers))
+	signatures := make([][]byte, len(providers))
+	for i, provider := range providers {
+		keyPair, err := provider.KeyGen(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Failed to generate key pair: %v", provider.Name(), err)
+		}
+		signature, err := provider.Sign(context.Background(), keyPair.PrivateKey, message)
+		if err != nil {
+			t.Fatalf("%s: Signing failed: %v", provider.Name(), err)
+		}
+
+		valid, err := provider.Verify(context.Background(), keyPair.PublicKey, message, signature)
+		if err != nil || !valid {
+			t.Errorf("%s: Expected valid signature, got valid=%v err=%v", provider.Name(), valid, err)
+		}
+
+		valid, err = provider.Verify(context.Background(), keyPair.PublicKey, []byte("tampered message"), signature)
+		if err != nil || valid {
+			t.Errorf("%s: Expected tampered message to fail verification, got valid=%v err=%v", provider.Name(), valid, err)
+		}
+
+		keyPairs[i] = keyPair
+		signatures[i] = signature
+	}
+
+	// Signatures and keys from one security level must be rejected by the others
+	for i, provider := range providers {
+		for j := range providers {
+			if i == j {
+				continue
+			}
+			if valid, _ := provider.Verify(context.Background(), keyPairs[i].PublicKey, message, signatures[j]); valid {
+				t.Errorf("%s accepted a %s signature", provider.Name(), providers[j].Name())
+			}
+			if valid, _ := provider.Verify(context.Background(), keyPairs[j].PublicKey, message, signatures[j]); valid {
+				t.Errorf("%s accepted a %s public key", provider.Name(), providers[j].Name())
+			}
+		}
+	}
+}
+
+func TestCryptoErrorCodes(t *testing.T) {
+	registry := DefaultRegistry()
+
+	kemCases := []Algorithm{AlgMLKEM768, AlgECDH, AlgHybridMLKEMECDH}
+	for _, alg := range kemCases {
+		provider, _ := registry.GetKEMProvider(alg)
+
+		_, _, err := provider.Encapsulate(context.Background(), []byte("not a key"))
+		assertCryptoError(t, err, ErrCodeInvalidKey, "Encapsulate", alg)
+
+		_, err = provider.Decapsulate(context.Background(), []byte("not a key"), []byte("not a ciphertext"))
+		assertCryptoError(t, err, ErrCodeInvalidKey, "Decapsulate", alg)
+	}
+
+	// A valid key with a ciphertext of the wrong size is a key error, but a
+	// ciphertext of the right size that doesn't parse is an input error
+	provider, _ := registry.GetKEMProvider(AlgMLKEM768)
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	_, err = provider.Decapsulate(context.Background(), keyPair.PrivateKey, []byte("short"))
+	assertCryptoError(t, err, ErrCodeInvalidKey, "Decapsulate", AlgMLKEM768)
+
+	provider, _ = registry.GetKEMProvider(AlgECDH)
+	keyPair, err = provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	_, err = provider.Decapsulate(context.Background(), keyPair.PrivateKey, make([]byte, 65))
+	assertCryptoError(t, err, ErrCodeInvalidInput, "Decapsulate", AlgECDH)
+
+	sigCases := []Algorithm{AlgMLDSA44, AlgMLDSA65, AlgMLDSA87, AlgSPHINCS128s, AlgECDSA}
+	for _, alg := range sigCases {
+		provider, _ := registry.GetSignatureProvider(alg)
+
+		_, err := provider.Verify(context.Background(), []byte("not a key"), []byte("message"), make([]byte, 64))
+		assertCryptoError(t, err, ErrCodeInvalidKey, "Verify", alg)
+	}
+
+	// Errors still unwrap to their cause
+	err = newCryptoError(ErrCodeSignFailed, "Sign", AlgECDSA, errInjected)
+	if !errors.Is(err, errInjected) {
+		t.Errorf("Expected CryptoError to unwrap to its cause")
+	}
+}
+
+func TestCiphertextSizeValidation(t *testing.T) {
+	// Every KEM, including the ones build tags leave out
+	kems := []KEMProvider{
+		NewMLKEM768Provider(), NewECDHProvider(), NewHybridKEMProvider(),
+		NewFrodoKEM640Provider(), NewFrodoKEM976Provider(), NewBIKEL1Provider(), NewBIKEL3Provider(),
+		NewMcEliece348864Provider(), NewMcEliece460896Provider(), NewHQC128Provider(), NewHQC256Provider(),
+	}
+	for _, kem := range kems {
+		alg := kem.Name()
+		t.Run(string(alg), func(t *testing.T) {
+			info := kem.(MetadataProvider).Metadata()
+			if size := ciphertextSizes[alg]; size != info.OutputSize {
+				t.Fatalf("Expected a %d byte ciphertext as the provider reports, got %d", info.OutputSize, size)
+			}
+
+			if err := ValidateCiphertextSize(alg, make([]byte, info.OutputSize)); err != nil {
+				t.Errorf("Expected a %d byte ciphertext to be valid, got %v", info.OutputSize, err)
+			}
+			for _, size := range []int{0, info.OutputSize - 1, info.OutputSize + 1} {
+				err := ValidateCiphertextSize(alg, make([]byte, size))
+				assertCryptoError(t, err, ErrCodeInvalidKey, "Decapsulate", alg)
+				want := fmt.Sprintf("invalid ciphertext: must be %d bytes, got %d", info.OutputSize, size)
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+
+	// Providers check the size once the private key parses
+	for _, provider := range []KEMProvider{NewMLKEM768Provider(), NewECDHProvider(), NewHybridKEMProvider()} {
+		keyPair, err := provider.KeyGen(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Key generation failed: %v", provider.Name(), err)
+		}
+		ciphertext, _, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+		if err != nil {
+			t.Fatalf("%s: Encapsulation failed: %v", provider.Name(), err)
+		}
+		_, err = provider.Decapsulate(context.Background(), keyPair.PrivateKey, append(ciphertext, 0))
+		assertCryptoError(t, err, ErrCodeInvalidKey, "Decapsulate", provider.Name())
+		_, err = provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext[:len(ciphertext)-1])
+		assertCryptoError(t, err, ErrCodeInvalidKey, "Decapsulate", provider.Name())
+	}
+
+	err := ValidateCiphertextSize("kyber-512", make([]byte, 768))
+	assertCryptoError(t, err, ErrCodeUnsupported, "Decapsulate", "kyber-512")
+}
+
+func TestDerivePublicKey(t *testing.T) {
+	for _, provider := range []KEMProvider{NewMLKEM768Provider(), NewECDHProvider(), NewHybridKEMProvider()} {
+		keyPair, err := provider.KeyGen(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Key generation failed: %v", provider.Name(), err)
+		}
+		deriver := provider.(PublicKeyDeriver)
+		derived, err := deriver.DerivePublicKey(keyPair.PrivateKey)
+		if err != nil {
+			t.Fatalf("%s: Failed to derive public key: %v", provider.Name(), err)
+		}
+		if !bytes.Equal(derived, keyPair.PublicKey) {
+			t.Errorf("%s: Derived public key does not match the generated one", provider.Name())
+		}
+
+		_, err = deriver.DerivePublicKey([]byte("not a key"))
+		assertCryptoError(t, err, ErrCodeInvalidKey, "DerivePublicKey", provider.Name())
+	}
+}
+
+func TestVerifyKeyPair(t *testing.T) {
+	providers := []CryptoProvider{NewMLKEM768Provider(), NewECDHProvider(), NewHybridKEMProvider(), NewMLDSA44Provider()}
+	for _, provider := range providers {
+		keyPair, err := provider.KeyGen(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Key generation failed: %v", provider.Name(), err)
+		}
+		other, err := provider.KeyGen(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Key generation failed: %v", provider.Name(), err)
+		}
+
+		if err := VerifyKeyPair(context.Background(), provider, keyPair.PublicKey, keyPair.PrivateKey); err != nil {
+			t.Errorf("%s: Expected a generated key pair to verify, got %v", provider.Name(), err)
+		}
+		err = VerifyKeyPair(context.Background(), provider, other.PublicKey, keyPair.PrivateKey)
+		assertCryptoError(t, err, ErrCodeInvalidKey, "VerifyKeyPair", provider.Name())
+		if !errors.Is(err, ErrKeyPairMismatch) {
+			t.Errorf("%s: Expected ErrKeyPairMismatch, got %v", provider.Name(), err)
+		}
+	}
+}
+
+var errInjected = errors.New("injected failure")
+
+// assertCryptoError checks that err is a CryptoError with the given details
+func assertCryptoError(t *testing.T, err error, code CryptoErrorCode, op string, alg Algorithm) {
+	t.Helper()
+	var cryptoErr *CryptoError
+	if !errors.As(err, &cryptoErr) {
+		t.Errorf("%s %s: Expected a CryptoError, got %v", alg, op, err)
+		return
+	}
+	if cryptoErr.Code != code || cryptoErr.Op != op || cryptoErr.Algorithm != alg {
+		t.Errorf("Expected %s %s %s, got %s %s %s", alg, op, code, cryptoErr.Algorithm, cryptoErr.Op, cryptoErr.Code)
+	}
+}
+
+func TestKeyCacheExpiry(t *testing.T) {
+	registry := DefaultRegistry()
+	registry.EnableKeyCache(4, time.Minute)
+	cache := registry.KeyCache()
+	defer cache.Stop()
+
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	first, err := cache.GetOrGenerate(context.Background(), AlgMLKEM768)
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	second, _ := cache.GetOrGenerate(context.Background(), AlgMLKEM768)
+	if !bytes.Equal(first.PublicKey, second.PublicKey) {
+		t.Errorf("Expected the cached key to be returned within the TTL")
+	}
+
+	// Once the TTL has passed the key must be regenerated
+	now = now.Add(time.Minute)
+	third, _ := cache.GetOrGenerate(context.Background(), AlgMLKEM768)
+	if bytes.Equal(first.PublicKey, third.PublicKey) {
+		t.Errorf("Expected an expired key to be regenerated")
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("Expected 1 hit and 2 misses, got %d and %d", stats.Hits, stats.Misses)
+	}
+
+	// The expiry sweep drops entries and zeroes their private keys
+	value, _ := cache.entries.Load(AlgMLKEM768)
+	cached := value.(*cacheEntry).keyPair
+	now = now.Add(time.Minute)
+	cache.expire()
+	if cache.Stats().Entries != 0 {
+		t.Errorf("Expected the expired entry to be removed")
+	}
+	if !bytes.Equal(cached.PrivateKey, make([]byte, len(cached.PrivateKey))) {
+		t.Errorf("Expected the evicted private key to be zeroed")
+	}
+	if bytes.Equal(third.PrivateKey, make([]byte, len(third.PrivateKey))) {
+		t.Errorf("Expected keys handed out earlier to be unaffected by eviction")
+	}
+}
+
+func TestKeyCacheLRU(t *testing.T) {
+	registry := DefaultRegistry()
+	registry.EnableKeyCache(2, time.Hour)
+	cache := registry.KeyCache()
+	defer cache.Stop()
+
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	tick := func() { now = now.Add(time.Second) }
+
+	cache.GetOrGenerate(context.Background(), AlgECDH)
+	tick()
+	cache.GetOrGenerate(context.Background(), AlgECDSA)
+	tick()
+	cache.GetOrGenerate(context.Background(), AlgECDH) // ECDH is now the most recently used
+	tick()
+	cache.GetOrGenerate(context.Background(), AlgMLKEM768)
+
+	if _, ok := cache.entries.Load(AlgECDSA); ok {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+	if _, ok := cache.entries.Load(AlgECDH); !ok {
+		t.Errorf("Expected the recently used entry to be kept")
+	}
+	if entries := cache.Stats().Entries; entries != 2 {
+		t.Errorf("Expected 2 entries, got %d", entries)
+	}
+
+	if _, err := cache.GetOrGenerate(context.Background(), "rot13"); err == nil {
+		t.Errorf("Expected an error for an unknown algorithm")
+	}
+}
+
+func TestKeyEncryptorRoundTrip(t *testing.T) {
+	encryptor, err := NewKeyEncryptor("test master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	privateKey := []byte("private key material")
+
+	blob, err := encryptor.EncryptForStorage(privateKey)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	if bytes.Contains(blob, privateKey) {
+		t.Errorf("Expected the stored key to be encrypted")
+	}
+	decrypted, err := encryptor.DecryptFromStorage(blob)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, privateKey) {
+		t.Errorf("Expected the decrypted key to match")
+	}
+
+	other, _ := NewKeyEncryptor("other master key")
+	if _, err := other.DecryptFromStorage(blob); err == nil {
+		t.Errorf("Expected decryption with the wrong master key to fail")
+	}
+	if _, err := NewKeyEncryptor(""); err == nil {
+		t.Errorf("Expected an empty master key to be rejected")
+	}
+}
+
+func TestKeyEncryptorReadsBackendKeys(t *testing.T) {
+	// Encrypted by the backend's KeyEncryptor with the same master key
+	blob, _ := hex.DecodeString("536ff8e635ac95dee47cc17570fea610109d2757350093f078ddb85dc738887bc3a959b14fbce53068f2ecdf")
+
+	encryptor, err := NewKeyEncryptor("compat master key")
+	if err != nil {
+		t.Fatalf("Failed to create key encryptor: %v", err)
+	}
+	decrypted, err := encryptor.DecryptFromStorage(blob)
+	if err != nil {
+		t.Fatalf("Failed to decrypt a backend key: %v", err)
+	}
+	if string(decrypted) != "pqcd private key" {
+		t.Errorf("Expected %q, got %q", "pqcd private key", decrypted)
+	}
+}
+
+func TestZeroize(t *testing.T) {
+	keyPair, err := NewMLKEM768Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	key := keyPair.PrivateKey
+	if bytes.Count(key, []byte{0}) == len(key) {
+		t.Fatal("Expected a generated private key not to be all zeros")
+	}
+
+	ZeroBytes(key)
+	for i, b := range key {
+		if b != 0 {
+			t.Fatalf("Expected byte %d to be zeroed, got %#x", i, b)
+		}
+	}
+
+	// Empty and nil slices are fine
+	ZeroBytes(nil)
+	ZeroBytes([]byte{})
+}
+
+func TestNoPrivateKeyLeak(t *testing.T) {
+	keyPair, err := NewMLDSA65Provider().KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	// Read the backing array through a raw pointer, so the check doesn't go
+	// through the slice the compiler could reason about
+	size := len(keyPair.PrivateKey)
+	data := unsafe.SliceData(keyPair.PrivateKey)
+
+	func(privateKey []byte) {
+		defer ZeroBytes(privateKey)
+		if _, err := NewMLDSA65Provider().Sign(context.Background(), privateKey, []byte("message")); err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+	}(keyPair.PrivateKey)
+	runtime.GC()
+
+	for i, b := range unsafe.Slice(data, size) {
+		if b != 0 {
+			t.Fatalf("Expected byte %d of the private key to be zeroed after use, got %#x", i, b)
+		}
+	}
+	runtime.KeepAlive(keyPair)
+}
+
+func TestProvidersLeaveCallerKeyIntact(t *testing.T) {
+	// Providers zero their own copy of the private key, so the caller's key can
+	// be used again, as the key cache does
+	registry := DefaultRegistry()
+	ctx := context.Background()
+	for _, alg := range registry.ListKEMAlgorithms() {
+		provider, _ := registry.GetKEMProvider(alg)
+		keyPair, err := provider.KeyGen(ctx)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key pair: %v", alg, err)
+		}
+		key := append([]byte(nil), keyPair.PrivateKey...)
+		ciphertext, sharedSecret, err := provider.Encapsulate(ctx, keyPair.PublicKey)
+		if err != nil {
+			t.Fatalf("%s encapsulation failed: %v", alg, err)
+		}
+		for i := 0; i < 2; i++ {
+			recovered, err := provider.Decapsulate(ctx, keyPair.PrivateKey, ciphertext)
+			if err != nil || !SecureCompare(recovered, sharedSecret) {
+				t.Fatalf("%s decapsulation %d failed: %v", alg, i+1, err)
+			}
+		}
+		if !SecureCompare(keyPair.PrivateKey, key) {
+			t.Errorf("Expected %s Decapsulate to leave the caller's private key intact", alg)
+		}
+	}
+	for _, alg := range registry.ListSignatureAlgorithms() {
+		provider, _ := registry.GetSignatureProvider(alg)
+		keyPair, err := provider.KeyGen(ctx)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key pair: %v", alg, err)
+		}
+		key := append([]byte(nil), keyPair.PrivateKey...)
+		for i := 0; i < 2; i++ {
+			signature, err := provider.Sign(ctx, keyPair.PrivateKey, []byte("message"))
+			if err != nil {
+				t.Fatalf("%s signature %d failed: %v", alg, i+1, err)
+			}
+			if valid, err := provider.Verify(ctx, keyPair.PublicKey, []byte("message"), signature); err != nil || !valid {
+				t.Fatalf("%s signature %d does not verify: %v", alg, i+1, err)
+			}
+		}
+		if !SecureCompare(keyPair.PrivateKey, key) {
+			t.Errorf("Expected %s Sign to leave the caller's private key intact", alg)
+		}
+	}
+}
+
+func TestSecureCompare(t *testing.T) {
+	cases := []struct {
+		a, b []byte
+		want bool
+	}{
+		{[]byte("secret"), []byte("secret"), true},
+		{[]byte("secret"), []byte("secreT"), false},
+		{[]byte("secret"), []byte("secret!"), false},
+		{nil, []byte{}, true},
+	}
+	for _, tc := range cases {
+		if got := SecureCompare(tc.a, tc.b); got != tc.want {
+			t.Errorf("Expected SecureCompare(%q, %q) to be %v, got %v", tc.a, tc.b, tc.want, got)
+		}
+	}
+}
+
+func TestKEMRoundTrip(t *testing.T) {
+	for _, provider := range []KEMProvider{NewMLKEM768Provider(), NewECDHProvider()} {
+		t.Run(string(provider.Name()), func(t *testing.T) {
+			keyPair, err := provider.KeyGen(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to generate key pair: %v", err)
+			}
+			ciphertext, sharedSecret, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+			if err != nil {
+				t.Fatalf("Encapsulation failed: %v", err)
+			}
+			recovered, err := provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext)
+			if err != nil {
+				t.Fatalf("Decapsulation failed: %v", err)
+			}
+			if !SecureCompare(sharedSecret, recovered) {
+				t.Error("Decapsulated shared secret does not match encapsulated one")
+			}
+		})
+	}
+}
+
+func TestKeyBundleRoundTrip(t *testing.T) {
+	registry := DefaultRegistry()
+	for _, pair := range [][2]Algorithm{{AlgMLKEM768, AlgMLDSA65}, {AlgECDH, AlgECDSA}, {AlgHybridMLKEMECDH, AlgMLDSA44}} {
+		kemAlg, sigAlg := pair[0], pair[1]
+		t.Run(string(kemAlg)+"+"+string(sigAlg), func(t *testing.T) {
+			bundle, err := GenerateBundle(context.Background(), kemAlg, sigAlg, registry)
+			if err != nil {
+				t.Fatalf("Failed to generate bundle: %v", err)
+			}
+			if bundle.KEM.Algorithm != kemAlg || bundle.Signature.Algorithm != sigAlg {
+				t.Errorf("Expected %s and %s key pairs, got %s and %s", kemAlg, sigAlg, bundle.KEM.Algorithm, bundle.Signature.Algorithm)
+			}
+			if bundle.CreatedAt.IsZero() {
+				t.Error("Expected a creation time")
+			}
+
+			kem, _ := registry.GetKEMProvider(kemAlg)
+			ciphertext, sharedSecret, err := kem.Encapsulate(context.Background(), bundle.KEM.PublicKey)
+			if err != nil {
+				t.Fatalf("Encapsulation failed: %v", err)
+			}
+			recovered, err := kem.Decapsulate(context.Background(), bundle.KEM.PrivateKey, ciphertext)
+			if err != nil || !SecureCompare(sharedSecret, recovered) {
+				t.Errorf("Expected the bundle KEM key to decapsulate its ciphertext, got %v", err)
+			}
+
+			sig, _ := registry.GetSignatureProvider(sigAlg)
+			message := []byte("bundle round trip")
+			signature, err := sig.Sign(context.Background(), bundle.Signature.PrivateKey, message)
+			if err != nil {
+				t.Fatalf("Signing failed: %v", err)
+			}
+			if valid, err := sig.Verify(context.Background(), bundle.Signature.PublicKey, message, signature); err != nil || !valid {
+				t.Errorf("Expected the bundle signature key to verify its signature, got %v %v", valid, err)
+			}
+
+			want := sha256.Sum256(append(append([]byte{}, bundle.KEM.PublicKey...), bundle.Signature.PublicKey...))
+			if !bytes.Equal(bundle.Fingerprint(), want[:]) {
+				t.Errorf("Expected the fingerprint to hash both public keys, got %x", bundle.Fingerprint())
+			}
+
+			bundle.Zero()
+			if !bytes.Equal(bundle.KEM.PrivateKey, make([]byte, len(bundle.KEM.PrivateKey))) || !bytes.Equal(bundle.Signature.PrivateKey, make([]byte, len(bundle.Signature.PrivateKey))) {
+				t.Error("Expected Zero to zero both private keys")
+			}
+		})
+	}
+
+	// The KEM and signature algorithms can't be swapped
+	if _, err := GenerateBundle(context.Background(), AlgMLDSA65, AlgMLKEM768, registry); err == nil {
+		t.Error("Expected an error for a signature algorithm as the KEM")
+	}
+	if _, err := GenerateBundle(context.Background(), AlgMLKEM768, AlgMLKEM768, registry); err == nil {
+		t.Error("Expected an error for a KEM as the signature algorithm")
+	}
+}
+
+func TestProvidersRespectCancellation(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// assertCanceled checks an operation run with the cancelled context failed
+	// with its error instead of producing a result
+	assertCanceled := func(t *testing.T, op string, err error, result ...[]byte) {
+		t.Helper()
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: Expected context.Canceled, got %v", op, err)
+		}
+		if code := codeOf(err, ""); code != ErrCodeCanceled {
+			t.Errorf("%s: Expected code %s, got %s", op, ErrCodeCanceled, code)
+		}
+		for _, r := range result {
+			if r != nil {
+				t.Errorf("%s: Expected no result alongside the error", op)
+			}
+		}
+	}
+
+	registry := DefaultRegistry()
+	for _, alg := range registry.ListKEMAlgorithms() {
+		provider, _ := registry.GetKEMProvider(alg)
+		t.Run(string(alg), func(t *testing.T) {
+			keyPair, err := provider.KeyGen(canceled)
+			assertCanceled(t, "KeyGen", err, keyPair.PublicKey, keyPair.PrivateKey)
+
+			keyPair, err = provider.KeyGen(context.Background())
+			if err != nil {
+				t.Skipf("%s can't generate keys: %v", alg, err)
+			}
+			ciphertext, sharedSecret, err := provider.Encapsulate(canceled, keyPair.PublicKey)
+			assertCanceled(t, "Encapsulate", err, ciphertext, sharedSecret)
+
+			ciphertext, _, err = provider.Encapsulate(context.Background(), keyPair.PublicKey)
+			if err != nil {
+				t.Fatalf("Encapsulation failed: %v", err)
+			}
+			sharedSecret, err = provider.Decapsulate(canceled, keyPair.PrivateKey, ciphertext)
+			assertCanceled(t, "Decapsulate", err, sharedSecret)
+		})
+	}
+	for _, alg := range registry.ListSignatureAlgorithms() {
+		provider, _ := registry.GetSignatureProvider(alg)
+		t.Run(string(alg), func(t *testing.T) {
+			keyPair, err := provider.KeyGen(canceled)
+			assertCanceled(t, "KeyGen", err, keyPair.PublicKey, keyPair.PrivateKey)
+
+			keyPair, err = provider.KeyGen(context.Background())
+			if err != nil {
+				t.Skipf("%s can't generate keys: %v", alg, err)
+			}
+			message := []byte("cancelled before signing")
+			signature, err := provider.Sign(canceled, keyPair.PrivateKey, message)
+			assertCanceled(t, "Sign", err, signature)
+
+			signature, err = provider.Sign(context.Background(), keyPair.PrivateKey, message)
+			if err != nil {
+				t.Fatalf("Signing failed: %v", err)
+			}
+			valid, err := provider.Verify(canceled, keyPair.PublicKey, message, signature)
+			assertCanceled(t, "Verify", err)
+			if valid {
+				t.Error("Verify: Expected a cancelled verification not to report a valid signature")
+			}
+		})
+	}
+
+	// A context that expires reports the deadline instead
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	if _, err := NewMLKEM768Provider().KeyGen(expired); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// secretNames are the names whose values must be compared with SecureCompare
+var secretNames = map[string]bool{"sharedsecret": true, "secret": true, "key": true}
+
+// TestNoTimingUnsafeSecretComparisons flags bytes.Equal calls on variables or
+// fields named sharedSecret, secret or key anywhere in the module
+func TestNoTimingUnsafeSecretComparisons(t *testing.T) {
+	skip := map[string]bool{"backend": true, "frontend": true, "ai": true, "node_modules": true, "testdata": true}
+	fset := token.NewFileSet()
+	err := filepath.WalkDir("..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != ".." && (skip[d.Name()] || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			fn, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || fn.Sel.Name != "Equal" {
+				return true
+			}
+			if pkg, ok := fn.X.(*ast.Ident); !ok || pkg.Name != "bytes" {
+				return true
+			}
+			for _, arg := range call.Args {
+				var name string
+				switch arg := arg.(type) {
+				case *ast.Ident:
+					name = arg.Name
+				case *ast.SelectorExpr:
+					name = arg.Sel.Name
+				}
+				if secretNames[strings.ToLower(name)] {
+					t.Errorf("%s: bytes.Equal on %s is not constant-time, use SecureCompare", fset.Position(call.Pos()), name)
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan sources: %v", err)
+	}
+}
+
+func TestFrodoKEMNotBuilt(t *testing.T) {
+	provider := NewFrodoKEM640Provider()
+	if provider.Available() {
+		t.Skip("FrodoKEM is built in")
+	}
+
+	_, err := provider.KeyGen(context.Background())
+	if !errors.Is(err, ErrNotBuilt) {
+		t.Errorf("Expected ErrNotBuilt, got %v", err)
+	}
+	assertCryptoError(t, err, ErrCodeUnsupported, "KeyGen", AlgFrodoKEM640)
+	_, _, err = provider.Encapsulate(context.Background(), nil)
+	assertCryptoError(t, err, ErrCodeUnsupported, "Encapsulate", AlgFrodoKEM640)
+	_, err = provider.Decapsulate(context.Background(), nil, nil)
+	assertCryptoError(t, err, ErrCodeUnsupported, "Decapsulate", AlgFrodoKEM640)
+}
+
+func TestMcElieceNotBuilt(t *testing.T) {
+	provider := NewMcEliece348864Provider()
+	if provider.Available() {
+		t.Skip("Classic McEliece is built in")
+	}
+
+	_, err := provider.KeyGen(context.Background())
+	if !errors.Is(err, ErrNotBuilt) {
+		t.Errorf("Expected ErrNotBuilt, got %v", err)
+	}
+	assertCryptoError(t, err, ErrCodeUnsupported, "KeyGen", AlgMcEliece348864)
+	_, _, err = provider.Encapsulate(context.Background(), nil)
+	assertCryptoError(t, err, ErrCodeUnsupported, "Encapsulate", AlgMcEliece348864)
+	_, err = provider.Decapsulate(context.Background(), nil, nil)
+	assertCryptoError(t, err, ErrCodeUnsupported, "Decapsulate", AlgMcEliece348864)
+}
+
+func TestHQCNotBuilt(t *testing.T) {
+	provider := NewHQC128Provider()
+	if provider.Available() {
+		t.Skip("HQC is built in")
+	}
+
+	_, err := provider.KeyGen(context.Background())
+	if !errors.Is(err, ErrNotBuilt) {
+		t.Errorf("Expected ErrNotBuilt, got %v", err)
+	}
+	assertCryptoError(t, err, ErrCodeUnsupported, "KeyGen", AlgHQC128)
+	_, _, err = provider.Encapsulate(context.Background(), nil)
+	assertCryptoError(t, err, ErrCodeUnsupported, "Encapsulate", AlgHQC128)
+	_, err = provider.Decapsulate(context.Background(), nil, nil)
+	assertCryptoError(t, err, ErrCodeUnsupported, "Decapsulate", AlgHQC128)
+}
+
+func TestFallibleKEMProviders(t *testing.T) {
+	fallible := []KEMProvider{NewBIKEL1Provider(), NewBIKEL3Provider(), NewHQC128Provider(), NewHQC256Provider()}
+	for _, provider := range fallible {
+		f, ok := provider.(FallibleKEMProvider)
+		if !ok || !f.IsFallible() {
+			t.Errorf("Expected %s to be fallible", provider.Name())
+		}
+		if rate := provider.(MetadataProvider).Metadata().DecapsulationFailureRate; rate <= 0 {
+			t.Errorf("Expected %s to document its failure rate, got %g", provider.Name(), rate)
+		}
+	}
+	for _, provider := range []KEMProvider{NewMLKEM768Provider(), NewECDHProvider(), NewHybridKEMProvider()} {
+		if _, ok := provider.(FallibleKEMProvider); ok {
+			t.Errorf("Expected %s not to be fallible", provider.Name())
+		}
+	}
+}
+
+func TestBIKEDecapFailureRate(t *testing.T) {
+	const cycles = 1000
+	for _, provider := range []*BIKEProvider{NewBIKEL1Provider(), NewBIKEL3Provider()} {
+		t.Run(string(provider.Name()), func(t *testing.T) {
+			if rate := provider.Metadata().DecapsulationFailureRate; rate <= 0 || rate >= math.Exp2(-64) {
+				t.Errorf("Expected a documented failure rate below 2^-64, got %g", rate)
+			}
+			if !provider.Available() {
+				_, err := provider.KeyGen(context.Background())
+				assertCryptoError(t, err, ErrCodeUnsupported, "KeyGen", provider.Name())
+				t.Skipf("%s is not supported by the linked CIRCL version", provider.Name())
+			}
+
+			keyPair, err := provider.KeyGen(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to generate key pair: %v", err)
+			}
+			// At a rate below 2^-64, even one failure in 1000 cycles is
+			// implausible
+			failures := 0
+			for i := 0; i < cycles; i++ {
+				ciphertext, sharedSecret, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+				if err != nil {
+					t.Fatalf("Encapsulation failed: %v", err)
+				}
+				recovered, err := provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext)
+				if err != nil || !SecureCompare(sharedSecret, recovered) {
+					failures++
+				}
+			}
+			if failures != 0 {
+				t.Errorf("Expected no decapsulation failures in %d cycles, got %d", cycles, failures)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building plugins is slow")
+	}
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		t.Skipf("plugins are not supported on %s", runtime.GOOS)
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	dir := t.TempDir()
+	build := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command(goTool, append([]string{"build"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go build %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+	plugin := filepath.Join(dir, "plugin.so")
+	oldPlugin := filepath.Join(dir, "oldplugin.so")
+	host := filepath.Join(dir, "pluginhost")
+	build("-buildmode=plugin", "-o", plugin, "./testdata/plugin")
+	build("-buildmode=plugin", "-o", oldPlugin, "./testdata/oldplugin")
+	build("-o", host, "./testdata/pluginhost")
+
+	output, err := exec.Command(host, plugin, oldPlugin, filepath.Join(dir, "missing.so")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("pluginhost failed: %v\n%s", err, output)
+	}
+	results := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(results) != 3 {
+		t.Fatalf("Expected a result per plugin, got %q", output)
+	}
+	if results[0] != "ok: plugin-ecdh" {
+		t.Errorf("Expected the plugin's KEM to be registered and work, got %q", results[0])
+	}
+	if !strings.Contains(results[1], fmt.Sprintf("built for plugin API version 0, this build supports %d", PluginAPIVersion)) {
+		t.Errorf("Expected an old plugin to be refused, got %q", results[1])
+	}
+	if !strings.Contains(results[2], "failed to open plugin") {
+		t.Errorf("Expected a missing plugin to fail, got %q", results[2])
+	}
+}
@@ -1,7 +1,9 @@
 package crypto
 
 import (
+	"context"
 	"crypto/ecdh"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/x509"
 	"fmt"
@@ -20,12 +22,28 @@ func (p *ECDHProvider) Name() Algorithm {
 	return AlgECDH
 }
 
+// Metadata returns the ECDH P-256 parameters
+func (p *ECDHProvider) Metadata() AlgorithmMetadata {
+	return AlgorithmMetadata{
+		Algorithm:      AlgECDH,
+		Family:         "elliptic-curve",
+		NISTLevel:      0,
+		PublicKeySize:  65,  // Uncompressed P-256 point
+		PrivateKeySize: 138, // PKCS8-encoded P-256 key
+		OutputSize:     65,  // Ephemeral public key
+	}
+}
+
 // KeyGen generates a new ECDH key pair
-func (p *ECDHProvider) KeyGen() (KeyPair, error) {
+func (p *ECDHProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", AlgECDH); err != nil {
+		return KeyPair{}, err
+	}
+
 	// Generate private key using P-256 curve
 	privateKey, err := ecdh.P256().GenerateKey(rand.Reader)
 	if err != nil {
-		return KeyPair{}, fmt.Errorf("failed to generate ECDH key pair: %w", err)
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", AlgECDH, fmt.Errorf("failed to generate key pair: %w", err))
 	}
 	
 	// Extract public and private keys as bytes
@@ -34,9 +52,12 @@ func (p *ECDHProvider) KeyGen() (KeyPair, error) {
 	// Marshal private key to PKCS8 format
 	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
 	if err != nil {
-		return KeyPair{}, fmt.Errorf("failed to marshal ECDH private key: %w", err)
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", AlgECDH, fmt.Errorf("failed to marshal private key: %w", err))
 	}
 	
+	if err := checkContext(ctx, "KeyGen", AlgECDH); err != nil {
+		return KeyPair{}, err
+	}
 	return KeyPair{
 		PublicKey:  publicKeyBytes,
 		PrivateKey: privateKeyBytes,
@@ -45,56 +66,101 @@ func (p *ECDHProvider) KeyGen() (KeyPair, error) {
 }
 
 // Encapsulate generates an ephemeral key pair, computes shared secret, and returns the ephemeral public key as ciphertext
-func (p *ECDHProvider) Encapsulate(publicKeyBytes []byte) ([]byte, []byte, error) {
+func (p *ECDHProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	if err := checkContext(ctx, "Encapsulate", AlgECDH); err != nil {
+		return nil, nil, err
+	}
+
 	// Parse recipient's public key
 	recipientPubKey, err := ecdh.P256().NewPublicKey(publicKeyBytes)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse ECDH public key: %w", err)
+		return nil, nil, newCryptoError(ErrCodeInvalidKey, "Encapsulate", AlgECDH, fmt.Errorf("failed to parse public key: %w", err))
 	}
 	
 	// Generate ephemeral key pair
 	ephemeralKey, err := ecdh.P256().GenerateKey(rand.Reader)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate ephemeral ECDH key: %w", err)
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", AlgECDH, fmt.Errorf("failed to generate ephemeral key: %w", err))
 	}
 	
 	// Compute shared secret
 	sharedSecret, err := ephemeralKey.ECDH(recipientPubKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to compute ECDH shared secret: %w", err)
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", AlgECDH, fmt.Errorf("failed to compute shared secret: %w", err))
 	}
 	
 	// Return ephemeral public key as ciphertext
 	ephemeralPubKeyBytes := ephemeralKey.PublicKey().Bytes()
 	
+	if err := checkContext(ctx, "Encapsulate", AlgECDH); err != nil {
+		return nil, nil, err
+	}
 	return ephemeralPubKeyBytes, sharedSecret, nil
 }
 
 // Decapsulate computes the shared secret using the private key and the ephemeral public key (ciphertext)
-func (p *ECDHProvider) Decapsulate(privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
-	// Parse private key from PKCS8 format
-	privKeyInterface, err := x509.ParsePKCS8PrivateKey(privateKeyBytes)
+func (p *ECDHProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	if err := checkContext(ctx, "Decapsulate", AlgECDH); err != nil {
+		return nil, err
+	}
+
+	privateKey, err := parseECDHPrivateKey(privateKeyBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse ECDH private key: %w", err)
+		return nil, newCryptoError(ErrCodeInvalidKey, "Decapsulate", AlgECDH, err)
 	}
 	
-	// Cast to ECDH private key
-	privateKey, ok := privKeyInterface.(*ecdh.PrivateKey)
-	if !ok {
-		return nil, fmt.Errorf("invalid ECDH private key type")
+	if err := ValidateCiphertextSize(AlgECDH, ciphertextBytes); err != nil {
+		return nil, err
 	}
 	
 	// Parse ephemeral public key from ciphertext
 	ephemeralPubKey, err := ecdh.P256().NewPublicKey(ciphertextBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse ephemeral ECDH public key: %w", err)
+		return nil, newCryptoError(ErrCodeInvalidInput, "Decapsulate", AlgECDH, fmt.Errorf("failed to parse ephemeral public key: %w", err))
 	}
 	
 	// Compute shared secret
 	sharedSecret, err := privateKey.ECDH(ephemeralPubKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compute ECDH shared secret: %w", err)
+		return nil, newCryptoError(ErrCodeDecapFailed, "Decapsulate", AlgECDH, fmt.Errorf("failed to compute shared secret: %w", err))
 	}
 	
+	if err := checkContext(ctx, "Decapsulate", AlgECDH); err != nil {
+		return nil, err
+	}
 	return sharedSecret, nil
-} 
\ No newline at end of file
+} 
+
+// DerivePublicKey returns the uncompressed public point of a PKCS8 private key
+func (p *ECDHProvider) DerivePublicKey(privateKeyBytes []byte) ([]byte, error) {
+	privateKey, err := parseECDHPrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "DerivePublicKey", AlgECDH, err)
+	}
+	return privateKey.PublicKey().Bytes(), nil
+}
+
+// parseECDHPrivateKey parses a PKCS8 P-256 private key
+func parseECDHPrivateKey(privateKeyBytes []byte) (*ecdh.PrivateKey, error) {
+	privKeyInterface, err := x509.ParsePKCS8PrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	// PKCS8 P-256 keys are parsed as ECDSA keys
+	switch key := privKeyInterface.(type) {
+	case *ecdh.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		privateKey, err := key.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert private key: %w", err)
+		}
+		return privateKey, nil
+	default:
+		return nil, fmt.Errorf("invalid private key type %T", privKeyInterface)
+	}
+}
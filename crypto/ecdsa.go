@@ -1,10 +1,12 @@
 package crypto
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"math/big"
 )
@@ -22,12 +24,28 @@ func (p *ECDSAProvider) Name() Algorithm {
 	return AlgECDSA
 }
 
+// Metadata returns the ECDSA P-256 parameters
+func (p *ECDSAProvider) Metadata() AlgorithmMetadata {
+	return AlgorithmMetadata{
+		Algorithm:      AlgECDSA,
+		Family:         "elliptic-curve",
+		NISTLevel:      0,
+		PublicKeySize:  33, // Compressed P-256 point
+		PrivateKeySize: 32,
+		OutputSize:     64, // R || S
+	}
+}
+
 // KeyGen generates a new ECDSA key pair
-func (p *ECDSAProvider) KeyGen() (KeyPair, error) {
+func (p *ECDSAProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", AlgECDSA); err != nil {
+		return KeyPair{}, err
+	}
+
 	// Generate key pair using P-256 curve
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return KeyPair{}, fmt.Errorf("failed to generate ECDSA key pair: %w", err)
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", AlgECDSA, fmt.Errorf("failed to generate key pair: %w", err))
 	}
 	
 	// Extract public key as bytes (X and Y coordinates)
@@ -36,6 +54,9 @@ func (p *ECDSAProvider) KeyGen() (KeyPair, error) {
 	// Extract private key as bytes (just the D value)
 	privateKeyBytes := privateKey.D.Bytes()
 	
+	if err := checkContext(ctx, "KeyGen", AlgECDSA); err != nil {
+		return KeyPair{}, err
+	}
 	return KeyPair{
 		PublicKey:  publicKeyBytes,
 		PrivateKey: privateKeyBytes,
@@ -44,7 +65,14 @@ func (p *ECDSAProvider) KeyGen() (KeyPair, error) {
 }
 
 // Sign creates a signature for the given message using the private key
-func (p *ECDSAProvider) Sign(privateKeyBytes, message []byte) ([]byte, error) {
+func (p *ECDSAProvider) Sign(ctx context.Context, privateKeyBytes, message []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	if err := checkContext(ctx, "Sign", AlgECDSA); err != nil {
+		return nil, err
+	}
+
 	// Parse private key
 	d := new(big.Int).SetBytes(privateKeyBytes)
 	privateKey := &ecdsa.PrivateKey{
@@ -63,7 +91,7 @@ func (p *ECDSAProvider) Sign(privateKeyBytes, message []byte) ([]byte, error) {
 	// Sign the digest
 	r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign message with ECDSA: %w", err)
+		return nil, newCryptoError(ErrCodeSignFailed, "Sign", AlgECDSA, err)
 	}
 	
 	// Encode signature as bytes (R || S)
@@ -75,19 +103,26 @@ func (p *ECDSAProvider) Sign(privateKeyBytes, message []byte) ([]byte, error) {
 	copy(signature[32-len(rBytes):32], rBytes)
 	copy(signature[64-len(sBytes):64], sBytes)
 	
+	if err := checkContext(ctx, "Sign", AlgECDSA); err != nil {
+		return nil, err
+	}
 	return signature, nil
 }
 
 // Verify checks if the signature is valid for the given message and public key
-func (p *ECDSAProvider) Verify(publicKeyBytes, message, signature []byte) (bool, error) {
+func (p *ECDSAProvider) Verify(ctx context.Context, publicKeyBytes, message, signature []byte) (bool, error) {
+	if err := checkContext(ctx, "Verify", AlgECDSA); err != nil {
+		return false, err
+	}
+
 	if len(signature) != 64 {
-		return false, fmt.Errorf("invalid ECDSA signature length: expected 64 bytes, got %d", len(signature))
+		return false, newCryptoError(ErrCodeInvalidInput, "Verify", AlgECDSA, fmt.Errorf("invalid signature length: expected 64 bytes, got %d", len(signature)))
 	}
 	
 	// Parse public key
 	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), publicKeyBytes)
 	if x == nil {
-		return false, fmt.Errorf("failed to unmarshal ECDSA public key")
+		return false, newCryptoError(ErrCodeInvalidKey, "Verify", AlgECDSA, errors.New("failed to unmarshal public key"))
 	}
 	
 	publicKey := &ecdsa.PublicKey{
@@ -106,5 +141,8 @@ func (p *ECDSAProvider) Verify(publicKeyBytes, message, signature []byte) (bool,
 	// Verify the signature
 	valid := ecdsa.Verify(publicKey, digest[:], r, s)
 	
+	if err := checkContext(ctx, "Verify", AlgECDSA); err != nil {
+		return false, err
+	}
 	return valid, nil
 } 
\ No newline at end of file
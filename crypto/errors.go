@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CryptoErrorCode classifies why a crypto operation failed
+type CryptoErrorCode string
+
+// Error codes returned by the providers
+const (
+	ErrCodeKeyGenFailed CryptoErrorCode = "KEYGEN_FAILED"
+	ErrCodeInvalidKey   CryptoErrorCode = "INVALID_KEY"
+	ErrCodeInvalidInput CryptoErrorCode = "INVALID_INPUT" // Malformed ciphertext or signature
+	ErrCodeEncapFailed  CryptoErrorCode = "ENCAPSULATION_FAILED"
+	ErrCodeDecapFailed  CryptoErrorCode = "DECAPSULATION_FAILED"
+	ErrCodeSignFailed   CryptoErrorCode = "SIGN_FAILED"
+	ErrCodeVerifyFailed CryptoErrorCode = "VERIFY_FAILED"
+	ErrCodeUnsupported  CryptoErrorCode = "UNSUPPORTED"
+	ErrCodeCanceled     CryptoErrorCode = "CANCELED" // The context ended; errors.Is matches its error
+)
+
+// ErrNotBuilt is the cause of errors from providers left out of the binary by
+// its build tags, such as FrodoKEM without the frodokem tag
+var ErrNotBuilt = errors.New("built without support for the algorithm")
+
+// CryptoError is the error returned by providers. Use errors.As to inspect its code.
+type CryptoError struct {
+	Code      CryptoErrorCode
+	Op        string
+	Algorithm Algorithm
+	Cause     error
+}
+
+// newCryptoError creates a CryptoError for an operation
+func newCryptoError(code CryptoErrorCode, op string, alg Algorithm, cause error) *CryptoError {
+	return &CryptoError{
+		Code:      code,
+		Op:        op,
+		Algorithm: alg,
+		Cause:     cause,
+	}
+}
+
+// Error implements the error interface
+func (e *CryptoError) Error() string {
+	if e.Cause == nil {
+		return fmt.Sprintf("%s %s: %s", e.Algorithm, e.Op, e.Code)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Algorithm, e.Op, e.Cause)
+}
+
+// Unwrap returns the underlying cause
+func (e *CryptoError) Unwrap() error {
+	return e.Cause
+}
+
+// checkContext returns an ErrCodeCanceled error wrapping the context's error
+// once ctx is done. Providers call it before and after their main operation.
+func checkContext(ctx context.Context, op string, alg Algorithm) error {
+	if err := ctx.Err(); err != nil {
+		return newCryptoError(ErrCodeCanceled, op, alg, err)
+	}
+	return nil
+}
+
+// codeOf returns the code of a wrapped CryptoError, or fallback if err has none
+func codeOf(err error, fallback CryptoErrorCode) CryptoErrorCode {
+	var cryptoErr *CryptoError
+	if errors.As(err, &cryptoErr) {
+		return cryptoErr.Code
+	}
+	return fallback
+}
@@ -0,0 +1,38 @@
+//go:build frodokem
+
+package crypto
+
+import "context"
+
+// registerFrodoKEMProviders adds both FrodoKEM parameter sets to the registry
+func registerFrodoKEMProviders(registry *Registry) {
+	registry.RegisterKEMProvider(NewFrodoKEM640Provider())
+	registry.RegisterKEMProvider(NewFrodoKEM976Provider())
+}
+
+// Available reports whether the binary was built with FrodoKEM support
+func (p *FrodoKEMProvider) Available() bool {
+	return true
+}
+
+// KeyGen generates a new FrodoKEM key pair
+func (p *FrodoKEMProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	return p.oqs().keyGen(ctx)
+}
+
+// Encapsulate generates a shared secret and ciphertext using the recipient's public key
+func (p *FrodoKEMProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	return p.oqs().encapsulate(ctx, publicKeyBytes)
+}
+
+// Decapsulate recovers the shared secret from the ciphertext using the private
+// key. Like ML-KEM, FrodoKEM rejects implicitly: a ciphertext of the right size
+// that wasn't made for the key yields an unrelated secret rather than an error.
+func (p *FrodoKEMProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	return p.oqs().decapsulate(ctx, privateKeyBytes, ciphertextBytes)
+}
+
+// oqs returns the liboqs bridge for this parameter set
+func (p *FrodoKEMProvider) oqs() oqsKEM {
+	return oqsKEM{algorithm: p.algorithm, method: p.method}
+}
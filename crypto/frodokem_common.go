@@ -0,0 +1,53 @@
+package crypto
+
+// FrodoKEMProvider implements the KEMProvider interface for FrodoKEM with AES,
+// through liboqs. CIRCL has no AES variant, so the providers only work in
+// binaries built with the frodokem tag, and only those register them in
+// DefaultRegistry. Otherwise every operation fails with ErrNotBuilt.
+type FrodoKEMProvider struct {
+	algorithm Algorithm
+	method    string // liboqs algorithm name
+	metadata  AlgorithmMetadata
+}
+
+// NewFrodoKEM640Provider creates a new FrodoKEM-640-AES provider
+func NewFrodoKEM640Provider() *FrodoKEMProvider {
+	return &FrodoKEMProvider{
+		algorithm: AlgFrodoKEM640,
+		method:    "FrodoKEM-640-AES",
+		metadata: AlgorithmMetadata{
+			Algorithm:      AlgFrodoKEM640,
+			Family:         "lattice",
+			NISTLevel:      1,
+			PublicKeySize:  9616,
+			PrivateKeySize: 19888,
+			OutputSize:     9720,
+		},
+	}
+}
+
+// NewFrodoKEM976Provider creates a new FrodoKEM-976-AES provider
+func NewFrodoKEM976Provider() *FrodoKEMProvider {
+	return &FrodoKEMProvider{
+		algorithm: AlgFrodoKEM976,
+		method:    "FrodoKEM-976-AES",
+		metadata: AlgorithmMetadata{
+			Algorithm:      AlgFrodoKEM976,
+			Family:         "lattice",
+			NISTLevel:      3,
+			PublicKeySize:  15632,
+			PrivateKeySize: 31296,
+			OutputSize:     15744,
+		},
+	}
+}
+
+// Name returns the algorithm name
+func (p *FrodoKEMProvider) Name() Algorithm {
+	return p.algorithm
+}
+
+// Metadata returns the FrodoKEM parameters for this security level
+func (p *FrodoKEMProvider) Metadata() AlgorithmMetadata {
+	return p.metadata
+}
@@ -0,0 +1,37 @@
+//go:build !frodokem
+
+package crypto
+
+import (
+	"context"
+	"fmt"
+)
+
+// Available reports whether the binary was built with FrodoKEM support
+func (p *FrodoKEMProvider) Available() bool {
+	return false
+}
+
+// KeyGen fails with ErrNotBuilt
+func (p *FrodoKEMProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	return KeyPair{}, p.notBuilt("KeyGen")
+}
+
+// Encapsulate fails with ErrNotBuilt
+func (p *FrodoKEMProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	return nil, nil, p.notBuilt("Encapsulate")
+}
+
+// Decapsulate fails with ErrNotBuilt
+func (p *FrodoKEMProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	return nil, p.notBuilt("Decapsulate")
+}
+
+// notBuilt is the error of every operation without the frodokem tag
+func (p *FrodoKEMProvider) notBuilt(op string) error {
+	return newCryptoError(ErrCodeUnsupported, op, p.algorithm, fmt.Errorf("%w, rebuild with -tags frodokem and liboqs installed", ErrNotBuilt))
+}
+
+// registerFrodoKEMProviders leaves FrodoKEM out of the registry, since it
+// can't be used without the frodokem tag
+func registerFrodoKEMProviders(registry *Registry) {}
@@ -0,0 +1,148 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// The seed corpora in testdata/fuzz hold empty, one-byte and maximum-length
+// (the algorithm's size for the input, all zeros) inputs for each target. Running go test replays them; go test
+// -fuzz=FuzzName searches for more.
+
+// noPanic fails the test if fn panics, so bad input is reported as the input
+// that caused the panic rather than a crash of the fuzzer
+func noPanic(t *testing.T, op string, fn func()) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("%s panicked: %v", op, r)
+		}
+	}()
+	fn()
+}
+
+// fuzzKeyPair generates a key pair for the fuzz targets that need a valid key
+func fuzzKeyPair(f *testing.F, keyGen func(context.Context) (KeyPair, error)) KeyPair {
+	f.Helper()
+	keyPair, err := keyGen(context.Background())
+	if err != nil {
+		f.Fatalf("Failed to generate key pair: %v", err)
+	}
+	return keyPair
+}
+
+// FuzzDecryptMLKEM768 decrypts arbitrary ciphertexts with a valid private key,
+// as the /decrypt endpoint does
+func FuzzDecryptMLKEM768(f *testing.F) {
+	provider := NewMLKEM768Provider()
+	keyPair := fuzzKeyPair(f, provider.KeyGen)
+	ciphertext, _, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+	if err != nil {
+		f.Fatalf("Failed to encapsulate: %v", err)
+	}
+	f.Add(ciphertext)
+	f.Add(ciphertext[:len(ciphertext)-1])
+
+	ciphertextSize := provider.Metadata().OutputSize
+	f.Fuzz(func(t *testing.T, ciphertext []byte) {
+		noPanic(t, "Decapsulate", func() {
+			sharedSecret, err := provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext)
+			if len(ciphertext) != ciphertextSize {
+				if err == nil {
+					t.Errorf("Expected an error for a %d byte ciphertext", len(ciphertext))
+				}
+				return
+			}
+			// ML-KEM rejects implicitly: a well-sized but wrong ciphertext
+			// yields an unrelated secret rather than an error
+			if err != nil || len(sharedSecret) != 32 {
+				t.Errorf("Expected a 32 byte shared secret, got %d bytes and %v", len(sharedSecret), err)
+			}
+		})
+	})
+}
+
+// FuzzEncapsulateMLKEM768 encapsulates to arbitrary public keys
+func FuzzEncapsulateMLKEM768(f *testing.F) {
+	provider := NewMLKEM768Provider()
+	f.Add(fuzzKeyPair(f, provider.KeyGen).PublicKey)
+
+	publicKeySize := provider.Metadata().PublicKeySize
+	f.Fuzz(func(t *testing.T, publicKey []byte) {
+		noPanic(t, "Encapsulate", func() {
+			_, _, err := provider.Encapsulate(context.Background(), publicKey)
+			if len(publicKey) != publicKeySize && err == nil {
+				t.Errorf("Expected an error for a %d byte public key", len(publicKey))
+			}
+		})
+	})
+}
+
+// FuzzDecapsulateMLKEM768 decapsulates arbitrary ciphertexts with arbitrary
+// private keys
+func FuzzDecapsulateMLKEM768(f *testing.F) {
+	provider := NewMLKEM768Provider()
+	keyPair := fuzzKeyPair(f, provider.KeyGen)
+	ciphertext, _, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+	if err != nil {
+		f.Fatalf("Failed to encapsulate: %v", err)
+	}
+	f.Add(keyPair.PrivateKey, ciphertext)
+
+	metadata := provider.Metadata()
+	f.Fuzz(func(t *testing.T, privateKey, ciphertext []byte) {
+		noPanic(t, "Decapsulate", func() {
+			_, err := provider.Decapsulate(context.Background(), privateKey, ciphertext)
+			if (len(privateKey) != metadata.PrivateKeySize || len(ciphertext) != metadata.OutputSize) && err == nil {
+				t.Errorf("Expected an error for a %d byte private key and %d byte ciphertext", len(privateKey), len(ciphertext))
+			}
+		})
+	})
+}
+
+// FuzzSignMLDSA65 signs arbitrary messages with arbitrary private keys
+func FuzzSignMLDSA65(f *testing.F) {
+	provider := NewMLDSA65Provider()
+	f.Add(fuzzKeyPair(f, provider.KeyGen).PrivateKey, []byte("message"))
+
+	privateKeySize := provider.Metadata().PrivateKeySize
+	f.Fuzz(func(t *testing.T, privateKey, message []byte) {
+		noPanic(t, "Sign", func() {
+			_, err := provider.Sign(context.Background(), privateKey, message)
+			if len(privateKey) != privateKeySize && err == nil {
+				t.Errorf("Expected an error for a %d byte private key", len(privateKey))
+			}
+		})
+	})
+}
+
+// FuzzVerifyMLDSA65 verifies arbitrary signatures against a valid key and
+// arbitrary public keys. Only the original signature may verify.
+func FuzzVerifyMLDSA65(f *testing.F) {
+	provider := NewMLDSA65Provider()
+	keyPair := fuzzKeyPair(f, provider.KeyGen)
+	message := []byte("message")
+	signature, err := provider.Sign(context.Background(), keyPair.PrivateKey, message)
+	if err != nil {
+		f.Fatalf("Failed to sign: %v", err)
+	}
+	f.Add(keyPair.PublicKey, message, signature)
+
+	publicKeySize := provider.Metadata().PublicKeySize
+	f.Fuzz(func(t *testing.T, publicKey, msg, sig []byte) {
+		noPanic(t, "Verify", func() {
+			valid, err := provider.Verify(context.Background(), publicKey, msg, sig)
+			if len(publicKey) != publicKeySize {
+				if err == nil {
+					t.Errorf("Expected an error for a %d byte public key", len(publicKey))
+				}
+				return
+			}
+			original := bytes.Equal(msg, message) && bytes.Equal(sig, signature)
+			if valid && bytes.Equal(publicKey, keyPair.PublicKey) && !original {
+				t.Errorf("Expected a modified message or signature not to verify")
+			}
+		})
+	})
+}
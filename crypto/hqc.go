@@ -0,0 +1,39 @@
+//go:build hqc
+
+package crypto
+
+import "context"
+
+// registerHQCProviders adds both HQC parameter sets to the registry
+func registerHQCProviders(registry *Registry) {
+	registry.RegisterKEMProvider(NewHQC128Provider())
+	registry.RegisterKEMProvider(NewHQC256Provider())
+}
+
+// Available reports whether the binary was built with HQC support
+func (p *HQCProvider) Available() bool {
+	return true
+}
+
+// KeyGen generates a new HQC key pair
+func (p *HQCProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	return p.oqs().keyGen(ctx)
+}
+
+// Encapsulate generates a shared secret and ciphertext using the recipient's public key
+func (p *HQCProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	return p.oqs().encapsulate(ctx, publicKeyBytes)
+}
+
+// Decapsulate recovers the shared secret from the ciphertext using the private
+// key. With probability DecapsulationFailureRate the secret of a valid
+// ciphertext is wrong, without an error. Tampered ciphertexts are rejected
+// implicitly.
+func (p *HQCProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	return p.oqs().decapsulate(ctx, privateKeyBytes, ciphertextBytes)
+}
+
+// oqs returns the liboqs bridge for this parameter set
+func (p *HQCProvider) oqs() oqsKEM {
+	return oqsKEM{algorithm: p.algorithm, method: p.method}
+}
@@ -0,0 +1,67 @@
+package crypto
+
+import "math"
+
+// HQCProvider implements the FallibleKEMProvider interface for HQC (Hamming
+// Quasi-Cyclic), through liboqs. CIRCL doesn't implement it, so like Classic
+// McEliece the providers only work in binaries built with the hqc tag, and
+// only those register them in DefaultRegistry. Otherwise every operation
+// fails with ErrNotBuilt.
+//
+// HQC decodes with a concatenated Reed-Muller and Reed-Solomon code that fails
+// with a small probability, given by DecapsulationFailureRate in Metadata.
+type HQCProvider struct {
+	algorithm Algorithm
+	method    string // liboqs algorithm name
+	metadata  AlgorithmMetadata
+}
+
+// NewHQC128Provider creates a new HQC-128 provider
+func NewHQC128Provider() *HQCProvider {
+	return &HQCProvider{
+		algorithm: AlgHQC128,
+		method:    "HQC-128",
+		metadata: AlgorithmMetadata{
+			Algorithm:                AlgHQC128,
+			Family:                   "code",
+			NISTLevel:                1,
+			PublicKeySize:            2249,
+			PrivateKeySize:           2305,
+			OutputSize:               4433,
+			DecapsulationFailureRate: math.Exp2(-128),
+		},
+	}
+}
+
+// NewHQC256Provider creates a new HQC-256 provider
+func NewHQC256Provider() *HQCProvider {
+	return &HQCProvider{
+		algorithm: AlgHQC256,
+		method:    "HQC-256",
+		metadata: AlgorithmMetadata{
+			Algorithm:                AlgHQC256,
+			Family:                   "code",
+			NISTLevel:                5,
+			PublicKeySize:            7245,
+			PrivateKeySize:           7317,
+			OutputSize:               14421,
+			DecapsulationFailureRate: math.Exp2(-256),
+		},
+	}
+}
+
+// Name returns the algorithm name
+func (p *HQCProvider) Name() Algorithm {
+	return p.algorithm
+}
+
+// Metadata returns the HQC parameters for this security level. The sizes and
+// decapsulation failure rates are those of the HQC specification.
+func (p *HQCProvider) Metadata() AlgorithmMetadata {
+	return p.metadata
+}
+
+// IsFallible reports that a valid HQC ciphertext may fail to decapsulate
+func (p *HQCProvider) IsFallible() bool {
+	return true
+}
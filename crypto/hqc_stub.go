@@ -0,0 +1,37 @@
+//go:build !hqc
+
+package crypto
+
+import (
+	"context"
+	"fmt"
+)
+
+// Available reports whether the binary was built with HQC support
+func (p *HQCProvider) Available() bool {
+	return false
+}
+
+// KeyGen fails with ErrNotBuilt
+func (p *HQCProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	return KeyPair{}, p.notBuilt("KeyGen")
+}
+
+// Encapsulate fails with ErrNotBuilt
+func (p *HQCProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	return nil, nil, p.notBuilt("Encapsulate")
+}
+
+// Decapsulate fails with ErrNotBuilt
+func (p *HQCProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	return nil, p.notBuilt("Decapsulate")
+}
+
+// notBuilt is the error of every operation without the hqc tag
+func (p *HQCProvider) notBuilt(op string) error {
+	return newCryptoError(ErrCodeUnsupported, op, p.algorithm, fmt.Errorf("%w, rebuild with -tags hqc and liboqs installed", ErrNotBuilt))
+}
+
+// registerHQCProviders leaves HQC out of the registry, since it can't be used
+// without the hqc tag
+func registerHQCProviders(registry *Registry) {}
@@ -0,0 +1,434 @@
+//go:build hsm
+
+package crypto
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// Algorithms that can be kept on a PKCS#11 token. PKCS#11 2.40 has no
+// post-quantum mechanisms, so the HSM holds classical keys: RSA-OAEP key
+// transport as a KEM, and ECDSA P-256 signatures.
+const (
+	AlgHSMRSAOAEP Algorithm = "hsm-rsa-oaep-3072"
+	AlgHSMECDSA   Algorithm = "hsm-ecdsa-p256"
+)
+
+// hsmRSABits is the modulus size of RSA keys generated on the token
+const hsmRSABits = 3072
+
+// hsmSharedSecretSize is the size of the secrets encapsulated to RSA keys
+const hsmSharedSecretSize = 32
+
+// hsmKeyIDSize is the size of the CKA_ID given to each generated key pair
+const hsmKeyIDSize = 16
+
+// oidP256 is the DER encoding of the prime256v1 curve OID, for CKA_EC_PARAMS
+var oidP256 = []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+
+// HSMProvider implements the KEMProvider and SignatureProvider interfaces with
+// keys generated and used on a PKCS#11 token, so private keys never leave the
+// hardware. It serves one algorithm: AlgHSMRSAOAEP supports the KEM
+// operations and AlgHSMECDSA the signature ones; the others fail with
+// ErrCodeUnsupported.
+//
+// The PrivateKey of a key pair it generates holds no key material. It is the
+// key's CKA_ID on the token, which Decapsulate and Sign use to find the key.
+//
+// The provider is only built with the hsm tag. It is not in DefaultRegistry,
+// since it needs a library and PIN; register it with RegisterKEMProvider or
+// RegisterSignatureProvider.
+type HSMProvider struct {
+	// PKCS#11 sessions can't be used concurrently, so each operation holds mu
+	mu        sync.Mutex
+	module    *pkcs11.Ctx
+	session   pkcs11.SessionHandle
+	slot      uint
+	algorithm Algorithm
+}
+
+// NewHSMProvider loads the PKCS#11 library at libraryPath, opens a session on
+// the first slot holding a token and logs in with pin. Close the provider to
+// log out and unload the library.
+func NewHSMProvider(libraryPath string, pin string, algorithm Algorithm) (*HSMProvider, error) {
+	if algorithm != AlgHSMRSAOAEP && algorithm != AlgHSMECDSA {
+		return nil, fmt.Errorf("unsupported HSM algorithm: %s", algorithm)
+	}
+
+	module := pkcs11.New(libraryPath)
+	if module == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 library %s", libraryPath)
+	}
+	if err := module.Initialize(); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		module.Destroy()
+		return nil, fmt.Errorf("failed to initialize PKCS#11 library: %w", err)
+	}
+
+	slots, err := module.GetSlotList(true)
+	if err != nil {
+		module.Finalize()
+		module.Destroy()
+		return nil, fmt.Errorf("failed to list PKCS#11 slots: %w", err)
+	}
+	if len(slots) == 0 {
+		module.Finalize()
+		module.Destroy()
+		return nil, errors.New("no PKCS#11 slot holds a token")
+	}
+	slot := slots[0]
+
+	session, err := module.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		module.Finalize()
+		module.Destroy()
+		return nil, fmt.Errorf("failed to open PKCS#11 session on slot %d: %w", slot, err)
+	}
+	if err := module.Login(session, pkcs11.CKU_USER, pin); err != nil {
+		module.CloseSession(session)
+		module.Finalize()
+		module.Destroy()
+		return nil, fmt.Errorf("failed to log in to slot %d: %w", slot, err)
+	}
+
+	return &HSMProvider{
+		module:    module,
+		session:   session,
+		slot:      slot,
+		algorithm: algorithm,
+	}, nil
+}
+
+// Close logs out, closes the session and unloads the library
+func (p *HSMProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := p.module.Logout(p.session)
+	if closeErr := p.module.CloseSession(p.session); err == nil {
+		err = closeErr
+	}
+	if finalizeErr := p.module.Finalize(); err == nil {
+		err = finalizeErr
+	}
+	p.module.Destroy()
+	return err
+}
+
+// Name returns the algorithm name
+func (p *HSMProvider) Name() Algorithm {
+	return p.algorithm
+}
+
+// Metadata returns the parameters of the algorithm. The private key size is
+// that of the CKA_ID standing in for the key.
+func (p *HSMProvider) Metadata() AlgorithmMetadata {
+	if p.algorithm == AlgHSMRSAOAEP {
+		return AlgorithmMetadata{
+			Algorithm:      AlgHSMRSAOAEP,
+			Family:         "rsa",
+			PublicKeySize:  422, // PKIX-encoded 3072-bit key
+			PrivateKeySize: hsmKeyIDSize,
+			OutputSize:     hsmRSABits / 8,
+		}
+	}
+	return AlgorithmMetadata{
+		Algorithm:      AlgHSMECDSA,
+		Family:         "elliptic-curve",
+		PublicKeySize:  33, // Compressed P-256 point
+		PrivateKeySize: hsmKeyIDSize,
+		OutputSize:     64, // R || S
+	}
+}
+
+// KeyGen generates a key pair on the token. The public key is returned in the
+// format of the software provider for the same family: PKIX for RSA and a
+// compressed point for ECDSA.
+func (p *HSMProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", p.algorithm); err != nil {
+		return KeyPair{}, err
+	}
+
+	id := make([]byte, hsmKeyIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", p.algorithm, fmt.Errorf("failed to generate key id: %w", err))
+	}
+
+	var mechanism uint
+	publicTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+	privateTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+	if p.algorithm == AlgHSMRSAOAEP {
+		mechanism = pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN
+		publicTemplate = append(publicTemplate,
+			pkcs11.NewAttribute(pkcs11.CKA_WRAP, true),
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, hsmRSABits),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		)
+		privateTemplate = append(privateTemplate, pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true))
+	} else {
+		mechanism = pkcs11.CKM_EC_KEY_PAIR_GEN
+		publicTemplate = append(publicTemplate,
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, oidP256),
+		)
+		privateTemplate = append(privateTemplate, pkcs11.NewAttribute(pkcs11.CKA_SIGN, true))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	publicHandle, privateHandle, err := p.module.GenerateKeyPair(p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, publicTemplate, privateTemplate)
+	if err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", p.algorithm, fmt.Errorf("failed to generate key pair on the token: %w", err))
+	}
+	// A key pair that isn't returned could never be used, so it is removed
+	// from the token rather than left behind
+	discard := func() {
+		p.module.DestroyObject(p.session, publicHandle)
+		p.module.DestroyObject(p.session, privateHandle)
+	}
+	publicKey, err := p.exportPublicKey(publicHandle)
+	if err != nil {
+		discard()
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", p.algorithm, err)
+	}
+
+	if err := checkContext(ctx, "KeyGen", p.algorithm); err != nil {
+		discard()
+		return KeyPair{}, err
+	}
+	return KeyPair{
+		PublicKey:  publicKey,
+		PrivateKey: id,
+		Algorithm:  p.algorithm,
+	}, nil
+}
+
+// exportPublicKey reads a public key object from the token
+func (p *HSMProvider) exportPublicKey(handle pkcs11.ObjectHandle) ([]byte, error) {
+	if p.algorithm == AlgHSMRSAOAEP {
+		attributes, err := p.module.GetAttributeValue(p.session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		publicKey := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attributes[0].Value),
+			E: int(new(big.Int).SetBytes(attributes[1].Value).Int64()),
+		}
+		return x509.MarshalPKIXPublicKey(publicKey)
+	}
+
+	attributes, err := p.module.GetAttributeValue(p.session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	// CKA_EC_POINT is the uncompressed point wrapped in a DER OCTET STRING
+	var point []byte
+	if _, err := asn1.Unmarshal(attributes[0].Value, &point); err != nil {
+		return nil, fmt.Errorf("failed to decode public key point: %w", err)
+	}
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("invalid public key point: %w", err)
+	}
+	// Compress the point: its parity byte followed by X
+	compressed := make([]byte, 33)
+	compressed[0] = 2 | point[64]&1
+	copy(compressed[1:], point[1:33])
+	return compressed, nil
+}
+
+// findPrivateKey returns the handle of the private key with the given CKA_ID
+func (p *HSMProvider) findPrivateKey(id []byte) (pkcs11.ObjectHandle, error) {
+	if err := p.module.FindObjectsInit(p.session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}); err != nil {
+		return 0, fmt.Errorf("failed to search the token: %w", err)
+	}
+	handles, _, err := p.module.FindObjects(p.session, 1)
+	if finalErr := p.module.FindObjectsFinal(p.session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to search the token: %w", err)
+	}
+	if len(handles) == 0 {
+		return 0, fmt.Errorf("no private key with id %x on the token", id)
+	}
+	return handles[0], nil
+}
+
+// oaepMechanism is RSA-OAEP with SHA-256 and MGF1-SHA-256
+func oaepMechanism() []*pkcs11.Mechanism {
+	params := pkcs11.NewOAEPParams(pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, pkcs11.CKZ_DATA_SPECIFIED, nil)
+	return []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_OAEP, params)}
+}
+
+// Encapsulate generates a secret on the token and wraps it with C_WrapKey
+// under the RSA public key, which is imported as a session object for the
+// purpose. The wrapped secret is the ciphertext.
+func (p *HSMProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	if p.algorithm != AlgHSMRSAOAEP {
+		return nil, nil, newCryptoError(ErrCodeUnsupported, "Encapsulate", p.algorithm, errors.New("not a KEM algorithm"))
+	}
+	if err := checkContext(ctx, "Encapsulate", p.algorithm); err != nil {
+		return nil, nil, err
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, nil, newCryptoError(ErrCodeInvalidKey, "Encapsulate", p.algorithm, fmt.Errorf("failed to parse public key: %w", err))
+	}
+	publicKey, ok := parsed.(*rsa.PublicKey)
+	if !ok || publicKey.N.BitLen() != hsmRSABits {
+		return nil, nil, newCryptoError(ErrCodeInvalidKey, "Encapsulate", p.algorithm, fmt.Errorf("expected a %d-bit RSA public key", hsmRSABits))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wrappingKey, err := p.module.CreateObject(p.session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+		pkcs11.NewAttribute(pkcs11.CKA_WRAP, true),
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, publicKey.N.Bytes()),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, big.NewInt(int64(publicKey.E)).Bytes()),
+	})
+	if err != nil {
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", p.algorithm, fmt.Errorf("failed to import public key: %w", err))
+	}
+	defer p.module.DestroyObject(p.session, wrappingKey)
+
+	secretKey, err := p.module.GenerateKey(p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_GENERIC_SECRET_KEY_GEN, nil)}, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_GENERIC_SECRET),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, hsmSharedSecretSize),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, true),
+	})
+	if err != nil {
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", p.algorithm, fmt.Errorf("failed to generate secret: %w", err))
+	}
+	defer p.module.DestroyObject(p.session, secretKey)
+
+	ciphertext, err := p.module.WrapKey(p.session, oaepMechanism(), wrappingKey, secretKey)
+	if err != nil {
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", p.algorithm, fmt.Errorf("failed to wrap secret: %w", err))
+	}
+	attributes, err := p.module.GetAttributeValue(p.session, secretKey, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil),
+	})
+	if err != nil {
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", p.algorithm, fmt.Errorf("failed to read secret: %w", err))
+	}
+	sharedSecret := attributes[0].Value
+
+	if err := checkContext(ctx, "Encapsulate", p.algorithm); err != nil {
+		ZeroBytes(sharedSecret)
+		return nil, nil, err
+	}
+	return ciphertext, sharedSecret, nil
+}
+
+// Decapsulate recovers the secret with C_Decrypt under the private key on the
+// token whose CKA_ID is privateKeyBytes
+func (p *HSMProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	if p.algorithm != AlgHSMRSAOAEP {
+		return nil, newCryptoError(ErrCodeUnsupported, "Decapsulate", p.algorithm, errors.New("not a KEM algorithm"))
+	}
+	if err := checkContext(ctx, "Decapsulate", p.algorithm); err != nil {
+		return nil, err
+	}
+	if len(ciphertextBytes) != hsmRSABits/8 {
+		return nil, newCryptoError(ErrCodeInvalidInput, "Decapsulate", p.algorithm, fmt.Errorf("invalid ciphertext length: expected %d bytes, got %d", hsmRSABits/8, len(ciphertextBytes)))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	privateKey, err := p.findPrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "Decapsulate", p.algorithm, err)
+	}
+	if err := p.module.DecryptInit(p.session, oaepMechanism(), privateKey); err != nil {
+		return nil, newCryptoError(ErrCodeDecapFailed, "Decapsulate", p.algorithm, err)
+	}
+	sharedSecret, err := p.module.Decrypt(p.session, ciphertextBytes)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidInput, "Decapsulate", p.algorithm, fmt.Errorf("failed to unwrap secret: %w", err))
+	}
+
+	if err := checkContext(ctx, "Decapsulate", p.algorithm); err != nil {
+		ZeroBytes(sharedSecret)
+		return nil, err
+	}
+	return sharedSecret, nil
+}
+
+// Sign signs the SHA-256 digest of the message on the token with the private
+// key whose CKA_ID is privateKeyBytes, returning R || S
+func (p *HSMProvider) Sign(ctx context.Context, privateKeyBytes, message []byte) ([]byte, error) {
+	if p.algorithm != AlgHSMECDSA {
+		return nil, newCryptoError(ErrCodeUnsupported, "Sign", p.algorithm, errors.New("not a signature algorithm"))
+	}
+	if err := checkContext(ctx, "Sign", p.algorithm); err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(message)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	privateKey, err := p.findPrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "Sign", p.algorithm, err)
+	}
+	if err := p.module.SignInit(p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, privateKey); err != nil {
+		return nil, newCryptoError(ErrCodeSignFailed, "Sign", p.algorithm, err)
+	}
+	signature, err := p.module.Sign(p.session, digest[:])
+	if err != nil {
+		return nil, newCryptoError(ErrCodeSignFailed, "Sign", p.algorithm, err)
+	}
+
+	if err := checkContext(ctx, "Sign", p.algorithm); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// Verify checks a signature in software. Verification only needs the public
+// key, and the signatures are those of ECDSAProvider.
+func (p *HSMProvider) Verify(ctx context.Context, publicKeyBytes, message, signature []byte) (bool, error) {
+	if p.algorithm != AlgHSMECDSA {
+		return false, newCryptoError(ErrCodeUnsupported, "Verify", p.algorithm, errors.New("not a signature algorithm"))
+	}
+	return NewECDSAProvider().Verify(ctx, publicKeyBytes, message, signature)
+}
@@ -0,0 +1,140 @@
+//go:build hsm
+
+package crypto
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// softHSMLibraries are where distributions install the SoftHSM2 module
+var softHSMLibraries = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+// newSoftHSMProvider creates a provider on a fresh SoftHSM2 token in a
+// temporary directory, skipping the test unless SoftHSM2 is installed.
+// SOFTHSM2_LIB overrides where the module is looked for.
+func newSoftHSMProvider(t *testing.T, algorithm Algorithm) *HSMProvider {
+	t.Helper()
+	library := os.Getenv("SOFTHSM2_LIB")
+	if library == "" {
+		for _, candidate := range softHSMLibraries {
+			if _, err := os.Stat(candidate); err == nil {
+				library = candidate
+				break
+			}
+		}
+	}
+	if library == "" {
+		t.Skip("SoftHSM2 is not installed")
+	}
+	if _, err := exec.LookPath("softhsm2-util"); err != nil {
+		t.Skip("softhsm2-util not found")
+	}
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+dir+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write SoftHSM2 config: %v", err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+	const pin = "1234"
+	cmd := exec.Command("softhsm2-util", "--init-token", "--free", "--label", "pqcd-test", "--pin", pin, "--so-pin", "0000")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to initialize SoftHSM2 token: %v\n%s", err, out)
+	}
+
+	provider, err := NewHSMProvider(library, pin, algorithm)
+	if err != nil {
+		t.Fatalf("Failed to create HSM provider: %v", err)
+	}
+	t.Cleanup(func() { provider.Close() })
+	return provider
+}
+
+func TestHSMKEMRoundTrip(t *testing.T) {
+	provider := newSoftHSMProvider(t, AlgHSMRSAOAEP)
+	metadata := provider.Metadata()
+
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	if len(keyPair.PublicKey) != metadata.PublicKeySize || len(keyPair.PrivateKey) != metadata.PrivateKeySize {
+		t.Errorf("Expected key sizes %d and %d, got %d and %d", metadata.PublicKeySize, metadata.PrivateKeySize, len(keyPair.PublicKey), len(keyPair.PrivateKey))
+	}
+
+	ciphertext, sharedSecret, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	if len(ciphertext) != metadata.OutputSize || len(sharedSecret) != hsmSharedSecretSize {
+		t.Errorf("Expected a %d-byte ciphertext and %d-byte secret, got %d and %d", metadata.OutputSize, hsmSharedSecretSize, len(ciphertext), len(sharedSecret))
+	}
+	recovered, err := provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext)
+	if err != nil {
+		t.Fatalf("Decapsulation failed: %v", err)
+	}
+	if !SecureCompare(sharedSecret, recovered) {
+		t.Error("Decapsulated shared secret does not match encapsulated one")
+	}
+
+	// A key the token doesn't hold is rejected
+	_, err = provider.Decapsulate(context.Background(), make([]byte, hsmKeyIDSize), ciphertext)
+	var cryptoErr *CryptoError
+	if !errors.As(err, &cryptoErr) || cryptoErr.Code != ErrCodeInvalidKey {
+		t.Errorf("Expected %s for an unknown key, got %v", ErrCodeInvalidKey, err)
+	}
+
+	// The KEM provider doesn't sign
+	if _, err := provider.Sign(context.Background(), keyPair.PrivateKey, []byte("message")); codeOf(err, "") != ErrCodeUnsupported {
+		t.Errorf("Expected %s signing with a KEM key, got %v", ErrCodeUnsupported, err)
+	}
+}
+
+func TestHSMSignVerify(t *testing.T) {
+	provider := newSoftHSMProvider(t, AlgHSMECDSA)
+
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	message := []byte("signed on the token")
+	signature, err := provider.Sign(context.Background(), keyPair.PrivateKey, message)
+	if err != nil {
+		t.Fatalf("Signing failed: %v", err)
+	}
+	if valid, err := provider.Verify(context.Background(), keyPair.PublicKey, message, signature); err != nil || !valid {
+		t.Errorf("Expected a valid signature, got %v %v", valid, err)
+	}
+	// The signatures are ordinary ECDSA P-256 signatures
+	if valid, err := NewECDSAProvider().Verify(context.Background(), keyPair.PublicKey, message, signature); err != nil || !valid {
+		t.Errorf("Expected the software provider to verify the signature, got %v %v", valid, err)
+	}
+	if valid, _ := provider.Verify(context.Background(), keyPair.PublicKey, []byte("tampered"), signature); valid {
+		t.Error("Expected a tampered message to fail verification")
+	}
+
+	// The signature provider doesn't encapsulate
+	if _, _, err := provider.Encapsulate(context.Background(), keyPair.PublicKey); codeOf(err, "") != ErrCodeUnsupported {
+		t.Errorf("Expected %s encapsulating to a signature key, got %v", ErrCodeUnsupported, err)
+	}
+}
+
+func TestNewHSMProviderRejectsAlgorithm(t *testing.T) {
+	if _, err := NewHSMProvider("/nonexistent/libpkcs11.so", "1234", AlgMLKEM768); err == nil {
+		t.Error("Expected an error for an algorithm the HSM provider doesn't support")
+	}
+	if _, err := NewHSMProvider("/nonexistent/libpkcs11.so", "1234", AlgHSMECDSA); err == nil {
+		t.Error("Expected an error for a missing PKCS#11 library")
+	}
+}
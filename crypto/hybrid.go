@@ -0,0 +1,172 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+)
+
+// hybridInfo is the HKDF context label for the hybrid shared secret
+const hybridInfo = "pqcd hybrid-ml-kem-ecdh v1"
+
+// HybridKEMProvider implements the KEMProvider interface by combining ML-KEM-768 with ECDH.
+// Keys and ciphertexts are the ML-KEM-768 component followed by the ECDH component,
+// and the shared secret is derived from both component secrets with HKDF-SHA256.
+type HybridKEMProvider struct {
+	mlkem *MLKEM768Provider
+	ecdh  *ECDHProvider
+}
+
+// NewHybridKEMProvider creates a new hybrid ML-KEM-768 + ECDH provider
+func NewHybridKEMProvider() *HybridKEMProvider {
+	return &HybridKEMProvider{
+		mlkem: NewMLKEM768Provider(),
+		ecdh:  NewECDHProvider(),
+	}
+}
+
+// Name returns the algorithm name
+func (p *HybridKEMProvider) Name() Algorithm {
+	return AlgHybridMLKEMECDH
+}
+
+// Metadata returns the combined parameters of both components
+func (p *HybridKEMProvider) Metadata() AlgorithmMetadata {
+	pq := p.mlkem.Metadata()
+	classical := p.ecdh.Metadata()
+	return AlgorithmMetadata{
+		Algorithm:      AlgHybridMLKEMECDH,
+		Family:         "hybrid",
+		NISTLevel:      pq.NISTLevel,
+		PublicKeySize:  pq.PublicKeySize + classical.PublicKeySize,
+		PrivateKeySize: pq.PrivateKeySize + classical.PrivateKeySize,
+		OutputSize:     pq.OutputSize + classical.OutputSize,
+	}
+}
+
+// KeyGen generates a new hybrid key pair
+func (p *HybridKEMProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	pqKeyPair, err := p.mlkem.KeyGen(ctx)
+	if err != nil {
+		return KeyPair{}, newCryptoError(codeOf(err, ErrCodeKeyGenFailed), "KeyGen", AlgHybridMLKEMECDH, err)
+	}
+
+	classicalKeyPair, err := p.ecdh.KeyGen(ctx)
+	if err != nil {
+		return KeyPair{}, newCryptoError(codeOf(err, ErrCodeKeyGenFailed), "KeyGen", AlgHybridMLKEMECDH, err)
+	}
+
+	return KeyPair{
+		PublicKey:  concat(pqKeyPair.PublicKey, classicalKeyPair.PublicKey),
+		PrivateKey: concat(pqKeyPair.PrivateKey, classicalKeyPair.PrivateKey),
+		Algorithm:  AlgHybridMLKEMECDH,
+	}, nil
+}
+
+// Encapsulate runs both KEMs against the recipient's public key and combines their shared secrets
+func (p *HybridKEMProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	pqPublicKey, classicalPublicKey, err := splitHybrid(publicKeyBytes, p.mlkem.scheme.PublicKeySize(), "public key")
+	if err != nil {
+		return nil, nil, newCryptoError(ErrCodeInvalidKey, "Encapsulate", AlgHybridMLKEMECDH, err)
+	}
+
+	pqCiphertext, pqSecret, err := p.mlkem.Encapsulate(ctx, pqPublicKey)
+	if err != nil {
+		return nil, nil, newCryptoError(codeOf(err, ErrCodeEncapFailed), "Encapsulate", AlgHybridMLKEMECDH, err)
+	}
+
+	classicalCiphertext, classicalSecret, err := p.ecdh.Encapsulate(ctx, classicalPublicKey)
+	if err != nil {
+		return nil, nil, newCryptoError(codeOf(err, ErrCodeEncapFailed), "Encapsulate", AlgHybridMLKEMECDH, err)
+	}
+
+	ciphertext := concat(pqCiphertext, classicalCiphertext)
+	sharedSecret, err := combineSecrets(pqSecret, classicalSecret, ciphertext)
+	if err != nil {
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", AlgHybridMLKEMECDH, err)
+	}
+
+	return ciphertext, sharedSecret, nil
+}
+
+// Decapsulate recovers both component secrets and combines them the same way as Encapsulate
+func (p *HybridKEMProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	pqPrivateKey, classicalPrivateKey, err := splitHybrid(privateKeyBytes, p.mlkem.scheme.PrivateKeySize(), "private key")
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "Decapsulate", AlgHybridMLKEMECDH, err)
+	}
+	if err := ValidateCiphertextSize(AlgHybridMLKEMECDH, ciphertextBytes); err != nil {
+		return nil, err
+	}
+
+	pqCiphertext, classicalCiphertext, err := splitHybrid(ciphertextBytes, p.mlkem.scheme.CiphertextSize(), "ciphertext")
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidInput, "Decapsulate", AlgHybridMLKEMECDH, err)
+	}
+
+	pqSecret, err := p.mlkem.Decapsulate(ctx, pqPrivateKey, pqCiphertext)
+	if err != nil {
+		return nil, newCryptoError(codeOf(err, ErrCodeDecapFailed), "Decapsulate", AlgHybridMLKEMECDH, err)
+	}
+
+	classicalSecret, err := p.ecdh.Decapsulate(ctx, classicalPrivateKey, classicalCiphertext)
+	if err != nil {
+		return nil, newCryptoError(codeOf(err, ErrCodeDecapFailed), "Decapsulate", AlgHybridMLKEMECDH, err)
+	}
+
+	sharedSecret, err := combineSecrets(pqSecret, classicalSecret, ciphertextBytes)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeDecapFailed, "Decapsulate", AlgHybridMLKEMECDH, err)
+	}
+
+	return sharedSecret, nil
+}
+
+// DerivePublicKey derives both component public keys from the private key
+func (p *HybridKEMProvider) DerivePublicKey(privateKeyBytes []byte) ([]byte, error) {
+	pqPrivateKey, classicalPrivateKey, err := splitHybrid(privateKeyBytes, p.mlkem.scheme.PrivateKeySize(), "private key")
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "DerivePublicKey", AlgHybridMLKEMECDH, err)
+	}
+
+	pqPublicKey, err := p.mlkem.DerivePublicKey(pqPrivateKey)
+	if err != nil {
+		return nil, newCryptoError(codeOf(err, ErrCodeInvalidKey), "DerivePublicKey", AlgHybridMLKEMECDH, err)
+	}
+	classicalPublicKey, err := p.ecdh.DerivePublicKey(classicalPrivateKey)
+	if err != nil {
+		return nil, newCryptoError(codeOf(err, ErrCodeInvalidKey), "DerivePublicKey", AlgHybridMLKEMECDH, err)
+	}
+	return concat(pqPublicKey, classicalPublicKey), nil
+}
+
+// Helper functions
+
+// combineSecrets derives the hybrid shared secret so that neither component secret alone is sufficient
+func combineSecrets(pqSecret, classicalSecret, ciphertext []byte) ([]byte, error) {
+	info := append([]byte(hybridInfo), ciphertext...)
+
+	sharedSecret, err := DeriveKey(concat(pqSecret, classicalSecret), info, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive hybrid shared secret: %w", err)
+	}
+
+	return sharedSecret, nil
+}
+
+// splitHybrid splits a hybrid encoding into its ML-KEM-768 and ECDH parts
+func splitHybrid(data []byte, pqSize int, what string) ([]byte, []byte, error) {
+	if len(data) <= pqSize {
+		return nil, nil, fmt.Errorf("invalid hybrid %s length: expected more than %d bytes, got %d", what, pqSize, len(data))
+	}
+	return data[:pqSize], data[pqSize:], nil
+}
+
+// concat returns a new slice holding a followed by b
+func concat(a, b []byte) []byte {
+	out := make([]byte, 0, len(a)+len(b))
+	out = append(out, a...)
+	return append(out, b...)
+}
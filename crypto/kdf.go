@@ -0,0 +1,37 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// MaxDerivedKeyLength is the most output HKDF-SHA256 can produce (255 * hash size)
+const MaxDerivedKeyLength = 255 * sha256.Size
+
+// DeriveKey stretches a shared secret into length bytes of key material using HKDF-SHA256
+func DeriveKey(sharedSecret []byte, info []byte, length int) ([]byte, error) {
+	return DeriveKeyWithSalt(sharedSecret, nil, info, length)
+}
+
+// DeriveKeyWithSalt is like DeriveKey but mixes in an optional salt.
+// A nil or empty salt is equivalent to a salt of hash-length zero bytes (RFC 5869).
+func DeriveKeyWithSalt(sharedSecret, salt, info []byte, length int) ([]byte, error) {
+	if len(sharedSecret) == 0 {
+		return nil, fmt.Errorf("cannot derive key from empty shared secret")
+	}
+	if length <= 0 || length > MaxDerivedKeyLength {
+		return nil, fmt.Errorf("invalid derived key length: must be between 1 and %d bytes, got %d", MaxDerivedKeyLength, length)
+	}
+
+	reader := hkdf.New(sha256.New, sharedSecret, salt, info)
+
+	key := make([]byte, length)
+	if _, err := io.ReadFull(reader, key); err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,40 @@
+package crypto
+
+import "fmt"
+
+// publicKeySizes holds the encoded public key size of every algorithm, in
+// bytes. It lets callers reject a malformed key before handing it to a
+// provider, including for algorithms left out of the binary by build tags.
+var publicKeySizes = map[Algorithm]int{
+	AlgMLKEM768:        1184,
+	AlgECDH:            65,
+	AlgHybridMLKEMECDH: 1184 + 65,
+	AlgFrodoKEM640:     9616,
+	AlgFrodoKEM976:     15632,
+	AlgBIKEL1:          1541,
+	AlgBIKEL3:          3083,
+	AlgMcEliece348864:  261120,
+	AlgMcEliece460896:  524160,
+	AlgHQC128:          2249,
+	AlgHQC256:          7245,
+
+	AlgMLDSA44:     1312,
+	AlgMLDSA65:     1952,
+	AlgMLDSA87:     2592,
+	AlgSPHINCS128s: 32,
+	AlgSPHINCS256s: 64,
+	AlgECDSA:       33,
+}
+
+// ValidatePublicKeySize returns an error unless key is the size of a public
+// key for alg
+func ValidatePublicKeySize(alg Algorithm, key []byte) error {
+	size, ok := publicKeySizes[alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+	if len(key) != size {
+		return fmt.Errorf("public key for %s must be %d bytes, got %d", alg, size, len(key))
+	}
+	return nil
+}
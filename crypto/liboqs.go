@@ -0,0 +1,136 @@
+//go:build frodokem || mceliece || hqc
+
+package crypto
+
+/*
+#cgo LDFLAGS: -loqs
+#include <stdlib.h>
+#include <oqs/oqs.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"unsafe"
+)
+
+// oqsKEM runs the KEM operations of a liboqs algorithm for the providers built
+// on liboqs
+type oqsKEM struct {
+	algorithm Algorithm
+	method    string // liboqs algorithm name
+}
+
+// keyGen generates a new key pair
+func (k oqsKEM) keyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", k.algorithm); err != nil {
+		return KeyPair{}, err
+	}
+	kem, err := k.newKEM("KeyGen")
+	if err != nil {
+		return KeyPair{}, err
+	}
+	defer C.OQS_KEM_free(kem)
+
+	publicKey := make([]byte, int(kem.length_public_key))
+	privateKey := make([]byte, int(kem.length_secret_key))
+	if C.OQS_KEM_keypair(kem, bytePtr(publicKey), bytePtr(privateKey)) != C.OQS_SUCCESS {
+		ZeroBytes(privateKey)
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", k.algorithm, fmt.Errorf("liboqs failed to generate a %s key pair", k.method))
+	}
+	if err := checkContext(ctx, "KeyGen", k.algorithm); err != nil {
+		ZeroBytes(privateKey)
+		return KeyPair{}, err
+	}
+
+	return KeyPair{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Algorithm:  k.algorithm,
+	}, nil
+}
+
+// encapsulate generates a shared secret and ciphertext for a public key
+func (k oqsKEM) encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	if err := checkContext(ctx, "Encapsulate", k.algorithm); err != nil {
+		return nil, nil, err
+	}
+	kem, err := k.newKEM("Encapsulate")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer C.OQS_KEM_free(kem)
+
+	if len(publicKeyBytes) != int(kem.length_public_key) {
+		return nil, nil, newCryptoError(ErrCodeInvalidKey, "Encapsulate", k.algorithm, fmt.Errorf("public key must be %d bytes, got %d", int(kem.length_public_key), len(publicKeyBytes)))
+	}
+
+	ciphertext := make([]byte, int(kem.length_ciphertext))
+	sharedSecret := make([]byte, int(kem.length_shared_secret))
+	if C.OQS_KEM_encaps(kem, bytePtr(ciphertext), bytePtr(sharedSecret), bytePtr(publicKeyBytes)) != C.OQS_SUCCESS {
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", k.algorithm, fmt.Errorf("liboqs failed to encapsulate with %s", k.method))
+	}
+	if err := checkContext(ctx, "Encapsulate", k.algorithm); err != nil {
+		ZeroBytes(sharedSecret)
+		return nil, nil, err
+	}
+
+	return ciphertext, sharedSecret, nil
+}
+
+// decapsulate recovers the shared secret from a ciphertext
+func (k oqsKEM) decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	if err := checkContext(ctx, "Decapsulate", k.algorithm); err != nil {
+		return nil, err
+	}
+	kem, err := k.newKEM("Decapsulate")
+	if err != nil {
+		return nil, err
+	}
+	defer C.OQS_KEM_free(kem)
+
+	if len(privateKeyBytes) != int(kem.length_secret_key) {
+		return nil, newCryptoError(ErrCodeInvalidKey, "Decapsulate", k.algorithm, fmt.Errorf("private key must be %d bytes, got %d", int(kem.length_secret_key), len(privateKeyBytes)))
+	}
+	if err := ValidateCiphertextSize(k.algorithm, ciphertextBytes); err != nil {
+		return nil, err
+	}
+	// liboqs reads length_ciphertext bytes, whatever ciphertextSizes says
+	if len(ciphertextBytes) != int(kem.length_ciphertext) {
+		return nil, newCryptoError(ErrCodeInvalidKey, "Decapsulate", k.algorithm, fmt.Errorf("invalid ciphertext: must be %d bytes, got %d", int(kem.length_ciphertext), len(ciphertextBytes)))
+	}
+
+	sharedSecret := make([]byte, int(kem.length_shared_secret))
+	if C.OQS_KEM_decaps(kem, bytePtr(sharedSecret), bytePtr(ciphertextBytes), bytePtr(privateKeyBytes)) != C.OQS_SUCCESS {
+		return nil, newCryptoError(ErrCodeDecapFailed, "Decapsulate", k.algorithm, fmt.Errorf("liboqs failed to decapsulate with %s", k.method))
+	}
+	if err := checkContext(ctx, "Decapsulate", k.algorithm); err != nil {
+		ZeroBytes(sharedSecret)
+		return nil, err
+	}
+
+	return sharedSecret, nil
+}
+
+// newKEM creates the liboqs KEM object for the algorithm. The caller frees it
+// with OQS_KEM_free.
+func (k oqsKEM) newKEM(op string) (*C.OQS_KEM, error) {
+	method := C.CString(k.method)
+	defer C.free(unsafe.Pointer(method))
+
+	kem := C.OQS_KEM_new(method)
+	if kem == nil {
+		return nil, newCryptoError(ErrCodeUnsupported, op, k.algorithm, fmt.Errorf("the linked liboqs was built without %s", k.method))
+	}
+	return kem, nil
+}
+
+// bytePtr returns a pointer to the first byte of b for passing to liboqs,
+// which never keeps it after the call returns. Callers check b is not empty.
+func bytePtr(b []byte) *C.uint8_t {
+	return (*C.uint8_t)(unsafe.Pointer(&b[0]))
+}
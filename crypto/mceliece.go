@@ -0,0 +1,38 @@
+//go:build mceliece
+
+package crypto
+
+import "context"
+
+// registerMcElieceProviders adds both Classic McEliece parameter sets to the registry
+func registerMcElieceProviders(registry *Registry) {
+	registry.RegisterKEMProvider(NewMcEliece348864Provider())
+	registry.RegisterKEMProvider(NewMcEliece460896Provider())
+}
+
+// Available reports whether the binary was built with Classic McEliece support
+func (p *McElieceProvider) Available() bool {
+	return true
+}
+
+// KeyGen generates a new Classic McEliece key pair. Generation is slow, often
+// tens of milliseconds, as it retries until it finds an invertible matrix.
+func (p *McElieceProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	return p.oqs().keyGen(ctx)
+}
+
+// Encapsulate generates a shared secret and ciphertext using the recipient's public key
+func (p *McElieceProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	return p.oqs().encapsulate(ctx, publicKeyBytes)
+}
+
+// Decapsulate recovers the shared secret from the ciphertext using the private
+// key. Classic McEliece rejects implicitly, like ML-KEM.
+func (p *McElieceProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	return p.oqs().decapsulate(ctx, privateKeyBytes, ciphertextBytes)
+}
+
+// oqs returns the liboqs bridge for this parameter set
+func (p *McElieceProvider) oqs() oqsKEM {
+	return oqsKEM{algorithm: p.algorithm, method: p.method}
+}
@@ -0,0 +1,56 @@
+package crypto
+
+// McElieceProvider implements the KEMProvider interface for Classic McEliece,
+// through liboqs. CIRCL doesn't implement it, so like FrodoKEM the providers
+// only work in binaries built with the mceliece tag, and only those register
+// them in DefaultRegistry. Otherwise every operation fails with ErrNotBuilt.
+//
+// Classic McEliece public keys are hundreds of kilobytes, far larger than
+// those of any other algorithm, while its ciphertexts are the smallest.
+type McElieceProvider struct {
+	algorithm Algorithm
+	method    string // liboqs algorithm name
+	metadata  AlgorithmMetadata
+}
+
+// NewMcEliece348864Provider creates a new Classic McEliece 348864 provider
+func NewMcEliece348864Provider() *McElieceProvider {
+	return &McElieceProvider{
+		algorithm: AlgMcEliece348864,
+		method:    "Classic-McEliece-348864",
+		metadata: AlgorithmMetadata{
+			Algorithm:      AlgMcEliece348864,
+			Family:         "code",
+			NISTLevel:      1,
+			PublicKeySize:  261120,
+			PrivateKeySize: 6492,
+			OutputSize:     96,
+		},
+	}
+}
+
+// NewMcEliece460896Provider creates a new Classic McEliece 460896 provider
+func NewMcEliece460896Provider() *McElieceProvider {
+	return &McElieceProvider{
+		algorithm: AlgMcEliece460896,
+		method:    "Classic-McEliece-460896",
+		metadata: AlgorithmMetadata{
+			Algorithm:      AlgMcEliece460896,
+			Family:         "code",
+			NISTLevel:      3,
+			PublicKeySize:  524160,
+			PrivateKeySize: 13608,
+			OutputSize:     156,
+		},
+	}
+}
+
+// Name returns the algorithm name
+func (p *McElieceProvider) Name() Algorithm {
+	return p.algorithm
+}
+
+// Metadata returns the Classic McEliece parameters for this security level
+func (p *McElieceProvider) Metadata() AlgorithmMetadata {
+	return p.metadata
+}
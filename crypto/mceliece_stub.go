@@ -0,0 +1,37 @@
+//go:build !mceliece
+
+package crypto
+
+import (
+	"context"
+	"fmt"
+)
+
+// Available reports whether the binary was built with Classic McEliece support
+func (p *McElieceProvider) Available() bool {
+	return false
+}
+
+// KeyGen fails with ErrNotBuilt
+func (p *McElieceProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	return KeyPair{}, p.notBuilt("KeyGen")
+}
+
+// Encapsulate fails with ErrNotBuilt
+func (p *McElieceProvider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	return nil, nil, p.notBuilt("Encapsulate")
+}
+
+// Decapsulate fails with ErrNotBuilt
+func (p *McElieceProvider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	return nil, p.notBuilt("Decapsulate")
+}
+
+// notBuilt is the error of every operation without the mceliece tag
+func (p *McElieceProvider) notBuilt(op string) error {
+	return newCryptoError(ErrCodeUnsupported, op, p.algorithm, fmt.Errorf("%w, rebuild with -tags mceliece and liboqs installed", ErrNotBuilt))
+}
+
+// registerMcElieceProviders leaves Classic McEliece out of the registry, since
+// it can't be used without the mceliece tag
+func registerMcElieceProviders(registry *Registry) {}
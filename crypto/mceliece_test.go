@@ -0,0 +1,53 @@
+//go:build mceliece
+
+package crypto
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMcElieceRoundTrip(t *testing.T) {
+	for _, provider := range []*McElieceProvider{NewMcEliece348864Provider(), NewMcEliece460896Provider()} {
+		t.Run(string(provider.Name()), func(t *testing.T) {
+			metadata := provider.Metadata()
+			keyPair, err := provider.KeyGen(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to generate key pair: %v", err)
+			}
+			if len(keyPair.PublicKey) != metadata.PublicKeySize || len(keyPair.PrivateKey) != metadata.PrivateKeySize {
+				t.Errorf("Expected key sizes %d and %d, got %d and %d", metadata.PublicKeySize, metadata.PrivateKeySize, len(keyPair.PublicKey), len(keyPair.PrivateKey))
+			}
+
+			ciphertext, sharedSecret, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+			if err != nil {
+				t.Fatalf("Encapsulation failed: %v", err)
+			}
+			if len(ciphertext) != metadata.OutputSize {
+				t.Errorf("Expected ciphertext size %d, got %d", metadata.OutputSize, len(ciphertext))
+			}
+			recovered, err := provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext)
+			if err != nil {
+				t.Fatalf("Decapsulation failed: %v", err)
+			}
+			if !SecureCompare(sharedSecret, recovered) {
+				t.Error("Decapsulated shared secret does not match encapsulated one")
+			}
+
+			// A tampered ciphertext is rejected implicitly
+			ciphertext[0] ^= 0xFF
+			recovered, err = provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext)
+			if err != nil {
+				t.Fatalf("Decapsulation of tampered ciphertext failed: %v", err)
+			}
+			if SecureCompare(sharedSecret, recovered) {
+				t.Error("Expected tampered ciphertext to yield a different shared secret")
+			}
+
+			_, _, err = provider.Encapsulate(context.Background(), keyPair.PublicKey[:16])
+			assertCryptoError(t, err, ErrCodeInvalidKey, "Encapsulate", provider.Name())
+			_, err = provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext[:16])
+			assertCryptoError(t, err, ErrCodeInvalidKey, "Decapsulate", provider.Name())
+		})
+	}
+}
@@ -1,12 +1,113 @@
 package crypto
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
 
 	"github.com/cloudflare/circl/sign/dilithium/mode2"
+	"github.com/cloudflare/circl/sign/dilithium/mode3"
+	"github.com/cloudflare/circl/sign/dilithium/mode5"
 )
 
+// MLDSA44Provider implements the SignatureProvider interface for ML-DSA-44
+type MLDSA44Provider struct{}
+
+// NewMLDSA44Provider creates a new ML-DSA-44 provider
+func NewMLDSA44Provider() *MLDSA44Provider {
+	return &MLDSA44Provider{}
+}
+
+// Name returns the algorithm name
+func (p *MLDSA44Provider) Name() Algorithm {
+	return AlgMLDSA44
+}
+
+// Metadata returns the parameters of the underlying Dilithium mode 2 scheme
+func (p *MLDSA44Provider) Metadata() AlgorithmMetadata {
+	return AlgorithmMetadata{
+		Algorithm:      AlgMLDSA44,
+		Family:         "lattice",
+		NISTLevel:      2,
+		PublicKeySize:  mode2.PublicKeySize,
+		PrivateKeySize: mode2.PrivateKeySize,
+		OutputSize:     mode2.SignatureSize,
+	}
+}
+
+// KeyGen generates a new ML-DSA-44 key pair
+func (p *MLDSA44Provider) KeyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", AlgMLDSA44); err != nil {
+		return KeyPair{}, err
+	}
+
+	// Generate key pair
+	pk, sk, err := mode2.GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", AlgMLDSA44, fmt.Errorf("failed to generate key pair: %w", err))
+	}
+	
+	// Extract public and private keys as bytes
+	publicKey := pk.Bytes()
+	privateKey := sk.Bytes()
+
+	if err := checkContext(ctx, "KeyGen", AlgMLDSA44); err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Algorithm:  AlgMLDSA44,
+	}, nil
+}
+
+// Sign creates a signature for the given message using the private key
+func (p *MLDSA44Provider) Sign(ctx context.Context, privateKeyBytes, message []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	if err := checkContext(ctx, "Sign", AlgMLDSA44); err != nil {
+		return nil, err
+	}
+
+	// Parse private key from bytes
+	sk := new(mode2.PrivateKey)
+	if err := sk.UnmarshalBinary(privateKeyBytes); err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "Sign", AlgMLDSA44, fmt.Errorf("failed to parse private key: %w", err))
+	}
+	
+	// Sign the message
+	signature, err := sk.Sign(rand.Reader, message, nil)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeSignFailed, "Sign", AlgMLDSA44, err)
+	}
+	
+	if err := checkContext(ctx, "Sign", AlgMLDSA44); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// Verify checks if the signature is valid for the given message and public key
+func (p *MLDSA44Provider) Verify(ctx context.Context, publicKeyBytes, message, signature []byte) (bool, error) {
+	if err := checkContext(ctx, "Verify", AlgMLDSA44); err != nil {
+		return false, err
+	}
+
+	// Parse public key from bytes
+	pk := new(mode2.PublicKey)
+	if err := pk.UnmarshalBinary(publicKeyBytes); err != nil {
+		return false, newCryptoError(ErrCodeInvalidKey, "Verify", AlgMLDSA44, fmt.Errorf("failed to parse public key: %w", err))
+	}
+	
+	// Verify the signature
+	valid := mode2.Verify(pk, message, signature)
+	
+	if err := checkContext(ctx, "Verify", AlgMLDSA44); err != nil {
+		return false, err
+	}
+	return valid, nil
+} 
 // MLDSA65Provider implements the SignatureProvider interface for ML-DSA-65
 type MLDSA65Provider struct{}
 
@@ -20,18 +121,37 @@ func (p *MLDSA65Provider) Name() Algorithm {
 	return AlgMLDSA65
 }
 
+// Metadata returns the parameters of the underlying Dilithium mode 3 scheme
+func (p *MLDSA65Provider) Metadata() AlgorithmMetadata {
+	return AlgorithmMetadata{
+		Algorithm:      AlgMLDSA65,
+		Family:         "lattice",
+		NISTLevel:      3,
+		PublicKeySize:  mode3.PublicKeySize,
+		PrivateKeySize: mode3.PrivateKeySize,
+		OutputSize:     mode3.SignatureSize,
+	}
+}
+
 // KeyGen generates a new ML-DSA-65 key pair
-func (p *MLDSA65Provider) KeyGen() (KeyPair, error) {
+func (p *MLDSA65Provider) KeyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", AlgMLDSA65); err != nil {
+		return KeyPair{}, err
+	}
+
 	// Generate key pair
-	pk, sk, err := mode2.GenerateKey(rand.Reader)
+	pk, sk, err := mode3.GenerateKey(rand.Reader)
 	if err != nil {
-		return KeyPair{}, fmt.Errorf("failed to generate ML-DSA-65 key pair: %w", err)
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", AlgMLDSA65, fmt.Errorf("failed to generate key pair: %w", err))
 	}
 	
 	// Extract public and private keys as bytes
 	publicKey := pk.Bytes()
 	privateKey := sk.Bytes()
 
+	if err := checkContext(ctx, "KeyGen", AlgMLDSA65); err != nil {
+		return KeyPair{}, err
+	}
 	return KeyPair{
 		PublicKey:  publicKey,
 		PrivateKey: privateKey,
@@ -40,32 +160,148 @@ func (p *MLDSA65Provider) KeyGen() (KeyPair, error) {
 }
 
 // Sign creates a signature for the given message using the private key
-func (p *MLDSA65Provider) Sign(privateKeyBytes, message []byte) ([]byte, error) {
+func (p *MLDSA65Provider) Sign(ctx context.Context, privateKeyBytes, message []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	if err := checkContext(ctx, "Sign", AlgMLDSA65); err != nil {
+		return nil, err
+	}
+
+	// Parse private key from bytes
+	sk := new(mode3.PrivateKey)
+	if err := sk.UnmarshalBinary(privateKeyBytes); err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "Sign", AlgMLDSA65, fmt.Errorf("failed to parse private key: %w", err))
+	}
+	
+	// Sign the message
+	signature, err := sk.Sign(rand.Reader, message, nil)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeSignFailed, "Sign", AlgMLDSA65, err)
+	}
+	
+	if err := checkContext(ctx, "Sign", AlgMLDSA65); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// Verify checks if the signature is valid for the given message and public key
+func (p *MLDSA65Provider) Verify(ctx context.Context, publicKeyBytes, message, signature []byte) (bool, error) {
+	if err := checkContext(ctx, "Verify", AlgMLDSA65); err != nil {
+		return false, err
+	}
+
+	// Parse public key from bytes
+	pk := new(mode3.PublicKey)
+	if err := pk.UnmarshalBinary(publicKeyBytes); err != nil {
+		return false, newCryptoError(ErrCodeInvalidKey, "Verify", AlgMLDSA65, fmt.Errorf("failed to parse public key: %w", err))
+	}
+	
+	// Verify the signature
+	valid := mode3.Verify(pk, message, signature)
+	
+	if err := checkContext(ctx, "Verify", AlgMLDSA65); err != nil {
+		return false, err
+	}
+	return valid, nil
+}
+
+// MLDSA87Provider implements the SignatureProvider interface for ML-DSA-87
+type MLDSA87Provider struct{}
+
+// NewMLDSA87Provider creates a new ML-DSA-87 provider
+func NewMLDSA87Provider() *MLDSA87Provider {
+	return &MLDSA87Provider{}
+}
+
+// Name returns the algorithm name
+func (p *MLDSA87Provider) Name() Algorithm {
+	return AlgMLDSA87
+}
+
+// Metadata returns the parameters of the underlying Dilithium mode 5 scheme
+func (p *MLDSA87Provider) Metadata() AlgorithmMetadata {
+	return AlgorithmMetadata{
+		Algorithm:      AlgMLDSA87,
+		Family:         "lattice",
+		NISTLevel:      5,
+		PublicKeySize:  mode5.PublicKeySize,
+		PrivateKeySize: mode5.PrivateKeySize,
+		OutputSize:     mode5.SignatureSize,
+	}
+}
+
+// KeyGen generates a new ML-DSA-87 key pair
+func (p *MLDSA87Provider) KeyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", AlgMLDSA87); err != nil {
+		return KeyPair{}, err
+	}
+
+	// Generate key pair
+	pk, sk, err := mode5.GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", AlgMLDSA87, fmt.Errorf("failed to generate key pair: %w", err))
+	}
+	
+	// Extract public and private keys as bytes
+	publicKey := pk.Bytes()
+	privateKey := sk.Bytes()
+
+	if err := checkContext(ctx, "KeyGen", AlgMLDSA87); err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Algorithm:  AlgMLDSA87,
+	}, nil
+}
+
+// Sign creates a signature for the given message using the private key
+func (p *MLDSA87Provider) Sign(ctx context.Context, privateKeyBytes, message []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	if err := checkContext(ctx, "Sign", AlgMLDSA87); err != nil {
+		return nil, err
+	}
+
 	// Parse private key from bytes
-	sk := new(mode2.PrivateKey)
+	sk := new(mode5.PrivateKey)
 	if err := sk.UnmarshalBinary(privateKeyBytes); err != nil {
-		return nil, fmt.Errorf("failed to parse ML-DSA-65 private key: %w", err)
+		return nil, newCryptoError(ErrCodeInvalidKey, "Sign", AlgMLDSA87, fmt.Errorf("failed to parse private key: %w", err))
 	}
 	
 	// Sign the message
 	signature, err := sk.Sign(rand.Reader, message, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign message with ML-DSA-65: %w", err)
+		return nil, newCryptoError(ErrCodeSignFailed, "Sign", AlgMLDSA87, err)
 	}
 	
+	if err := checkContext(ctx, "Sign", AlgMLDSA87); err != nil {
+		return nil, err
+	}
 	return signature, nil
 }
 
 // Verify checks if the signature is valid for the given message and public key
-func (p *MLDSA65Provider) Verify(publicKeyBytes, message, signature []byte) (bool, error) {
+func (p *MLDSA87Provider) Verify(ctx context.Context, publicKeyBytes, message, signature []byte) (bool, error) {
+	if err := checkContext(ctx, "Verify", AlgMLDSA87); err != nil {
+		return false, err
+	}
+
 	// Parse public key from bytes
-	pk := new(mode2.PublicKey)
+	pk := new(mode5.PublicKey)
 	if err := pk.UnmarshalBinary(publicKeyBytes); err != nil {
-		return false, fmt.Errorf("failed to parse ML-DSA-65 public key: %w", err)
+		return false, newCryptoError(ErrCodeInvalidKey, "Verify", AlgMLDSA87, fmt.Errorf("failed to parse public key: %w", err))
 	}
 	
 	// Verify the signature
-	valid := mode2.Verify(pk, message, signature)
+	valid := mode5.Verify(pk, message, signature)
 	
+	if err := checkContext(ctx, "Verify", AlgMLDSA87); err != nil {
+		return false, err
+	}
 	return valid, nil
-} 
\ No newline at end of file
+}
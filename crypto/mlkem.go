@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/cloudflare/circl/kem"
@@ -24,25 +25,44 @@ func (p *MLKEM768Provider) Name() Algorithm {
 	return AlgMLKEM768
 }
 
+// Metadata returns the ML-KEM-768 parameters
+func (p *MLKEM768Provider) Metadata() AlgorithmMetadata {
+	return AlgorithmMetadata{
+		Algorithm:      AlgMLKEM768,
+		Family:         "lattice",
+		NISTLevel:      3,
+		PublicKeySize:  p.scheme.PublicKeySize(),
+		PrivateKeySize: p.scheme.PrivateKeySize(),
+		OutputSize:     p.scheme.CiphertextSize(),
+	}
+}
+
 // KeyGen generates a new ML-KEM-768 key pair
-func (p *MLKEM768Provider) KeyGen() (KeyPair, error) {
+func (p *MLKEM768Provider) KeyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", AlgMLKEM768); err != nil {
+		return KeyPair{}, err
+	}
+
 	// Generate key pair
 	pk, sk, err := p.scheme.GenerateKeyPair()
 	if err != nil {
-		return KeyPair{}, fmt.Errorf("failed to generate ML-KEM-768 key pair: %w", err)
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", AlgMLKEM768, fmt.Errorf("failed to generate key pair: %w", err))
 	}
 
 	// Extract public and private keys as bytes
 	publicKey, err := pk.MarshalBinary()
 	if err != nil {
-		return KeyPair{}, fmt.Errorf("failed to marshal public key: %w", err)
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", AlgMLKEM768, fmt.Errorf("failed to marshal public key: %w", err))
 	}
 
 	privateKey, err := sk.MarshalBinary()
 	if err != nil {
-		return KeyPair{}, fmt.Errorf("failed to marshal private key: %w", err)
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", AlgMLKEM768, fmt.Errorf("failed to marshal private key: %w", err))
 	}
 
+	if err := checkContext(ctx, "KeyGen", AlgMLKEM768); err != nil {
+		return KeyPair{}, err
+	}
 	return KeyPair{
 		PublicKey:  publicKey,
 		PrivateKey: privateKey,
@@ -51,35 +71,69 @@ func (p *MLKEM768Provider) KeyGen() (KeyPair, error) {
 }
 
 // Encapsulate generates a shared secret and ciphertext using the recipient's public key
-func (p *MLKEM768Provider) Encapsulate(publicKeyBytes []byte) ([]byte, []byte, error) {
+func (p *MLKEM768Provider) Encapsulate(ctx context.Context, publicKeyBytes []byte) ([]byte, []byte, error) {
+	if err := checkContext(ctx, "Encapsulate", AlgMLKEM768); err != nil {
+		return nil, nil, err
+	}
+
 	// Parse public key from bytes
 	pk, err := p.scheme.UnmarshalBinaryPublicKey(publicKeyBytes)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse ML-KEM-768 public key: %w", err)
+		return nil, nil, newCryptoError(ErrCodeInvalidKey, "Encapsulate", AlgMLKEM768, fmt.Errorf("failed to parse public key: %w", err))
 	}
 
 	// Encapsulate to generate ciphertext and shared secret
 	ct, ss, err := p.scheme.Encapsulate(pk)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to encapsulate using ML-KEM-768: %w", err)
+		return nil, nil, newCryptoError(ErrCodeEncapFailed, "Encapsulate", AlgMLKEM768, err)
 	}
 
+	if err := checkContext(ctx, "Encapsulate", AlgMLKEM768); err != nil {
+		return nil, nil, err
+	}
 	return ct, ss, nil
 }
 
 // Decapsulate recovers the shared secret from the ciphertext using the private key
-func (p *MLKEM768Provider) Decapsulate(privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+func (p *MLKEM768Provider) Decapsulate(ctx context.Context, privateKeyBytes, ciphertextBytes []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	if err := checkContext(ctx, "Decapsulate", AlgMLKEM768); err != nil {
+		return nil, err
+	}
+
 	// Parse private key from bytes
 	sk, err := p.scheme.UnmarshalBinaryPrivateKey(privateKeyBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse ML-KEM-768 private key: %w", err)
+		return nil, newCryptoError(ErrCodeInvalidKey, "Decapsulate", AlgMLKEM768, fmt.Errorf("failed to parse private key: %w", err))
+	}
+
+	if err := ValidateCiphertextSize(AlgMLKEM768, ciphertextBytes); err != nil {
+		return nil, err
 	}
 
 	// Decapsulate to recover the shared secret
 	ss, err := p.scheme.Decapsulate(sk, ciphertextBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decapsulate using ML-KEM-768: %w", err)
+		return nil, newCryptoError(ErrCodeInvalidInput, "Decapsulate", AlgMLKEM768, fmt.Errorf("invalid ciphertext: %w", err))
 	}
 
+	if err := checkContext(ctx, "Decapsulate", AlgMLKEM768); err != nil {
+		return nil, err
+	}
 	return ss, nil
-} 
\ No newline at end of file
+} 
+
+// DerivePublicKey returns the public key an ML-KEM-768 private key embeds
+func (p *MLKEM768Provider) DerivePublicKey(privateKeyBytes []byte) ([]byte, error) {
+	sk, err := p.scheme.UnmarshalBinaryPrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "DerivePublicKey", AlgMLKEM768, fmt.Errorf("failed to parse private key: %w", err))
+	}
+	publicKey, err := sk.Public().MarshalBinary()
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "DerivePublicKey", AlgMLKEM768, fmt.Errorf("failed to marshal public key: %w", err))
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+const (
+	pemPublicKeySuffix  = " PUBLIC KEY"
+	pemPrivateKeySuffix = " PRIVATE KEY"
+)
+
+// pemAlgorithms lists the algorithms that may appear in PEM block types
+var pemAlgorithms = []Algorithm{
+	AlgMLKEM768,
+	AlgECDH,
+	AlgHybridMLKEMECDH,
+	AlgMLDSA44,
+	AlgMLDSA65,
+	AlgMLDSA87,
+	AlgSPHINCS128s,
+	AlgSPHINCS256s,
+	AlgECDSA,
+}
+
+// MarshalPublicKeyToPEM encodes the public key of a key pair as a PEM block
+// with a type such as "ML-KEM-768 PUBLIC KEY"
+func MarshalPublicKeyToPEM(kp KeyPair) ([]byte, error) {
+	return marshalPEM(kp.Algorithm, pemPublicKeySuffix, kp.PublicKey)
+}
+
+// MarshalPrivateKeyToPEM encodes the private key of a key pair as a PEM block
+// with a type such as "ML-KEM-768 PRIVATE KEY"
+func MarshalPrivateKeyToPEM(kp KeyPair) ([]byte, error) {
+	return marshalPEM(kp.Algorithm, pemPrivateKeySuffix, kp.PrivateKey)
+}
+
+// UnmarshalPublicKeyFromPEM decodes a PEM public key into a key pair with only the public key set
+func UnmarshalPublicKeyFromPEM(data []byte) (KeyPair, error) {
+	alg, key, err := unmarshalPEM(data, pemPublicKeySuffix)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{PublicKey: key, Algorithm: alg}, nil
+}
+
+// UnmarshalPrivateKeyFromPEM decodes a PEM private key into a key pair with only the private key set
+func UnmarshalPrivateKeyFromPEM(data []byte) (KeyPair, error) {
+	alg, key, err := unmarshalPEM(data, pemPrivateKeySuffix)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{PrivateKey: key, Algorithm: alg}, nil
+}
+
+// ExportPKCS12 packs a key pair into a password-protected PKCS#12 (.pfx) bundle,
+// encrypting the private key with AES-256. Use ExportPKCS12WithEncryption for
+// 3DES bundles readable by older tools.
+func ExportPKCS12(kp KeyPair, password string) ([]byte, error) {
+	return ExportPKCS12WithEncryption(kp, password, PKCS12Modern)
+}
+
+// ExportPKCS12WithEncryption is like ExportPKCS12 with a choice of encryption.
+// Hybrid keys have no PKCS#8 encoding and cannot be exported.
+func ExportPKCS12WithEncryption(kp KeyPair, password string, encryption PKCS12Encryption) ([]byte, error) {
+	if !isPEMAlgorithm(kp.Algorithm) {
+		return nil, fmt.Errorf("cannot export key for unknown algorithm: %s", kp.Algorithm)
+	}
+	return encodePKCS12(kp, password, encryption)
+}
+
+// ImportPKCS12 reads a key pair from a bundle written by ExportPKCS12
+func ImportPKCS12(data []byte, password string) (KeyPair, error) {
+	return decodePKCS12(data, password)
+}
+
+// Helper functions
+
+// marshalPEM writes key bytes under a block type derived from the algorithm name
+func marshalPEM(alg Algorithm, suffix string, key []byte) ([]byte, error) {
+	if !isPEMAlgorithm(alg) {
+		return nil, fmt.Errorf("cannot PEM-encode key for unknown algorithm: %s", alg)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("cannot PEM-encode empty%s for %s", strings.ToLower(suffix), alg)
+	}
+
+	block := &pem.Block{
+		Type:  strings.ToUpper(string(alg)) + suffix,
+		Bytes: key,
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// unmarshalPEM parses a PEM block and resolves the algorithm from its type
+func unmarshalPEM(data []byte, suffix string) (Algorithm, []byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", nil, fmt.Errorf("failed to decode PEM data: no PEM block found")
+	}
+
+	if !strings.HasSuffix(block.Type, suffix) {
+		return "", nil, fmt.Errorf("unexpected PEM block type %q: expected a block ending in %q", block.Type, suffix)
+	}
+
+	alg := Algorithm(strings.ToLower(strings.TrimSuffix(block.Type, suffix)))
+	if !isPEMAlgorithm(alg) {
+		return "", nil, fmt.Errorf("unknown PEM block type %q: unsupported algorithm %q", block.Type, alg)
+	}
+
+	return alg, block.Bytes, nil
+}
+
+// isPEMAlgorithm reports whether the algorithm may be used in a PEM block type
+func isPEMAlgorithm(alg Algorithm) bool {
+	for _, known := range pemAlgorithms {
+		if known == alg {
+			return true
+		}
+	}
+	return false
+}
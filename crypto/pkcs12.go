@@ -0,0 +1,728 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"unicode/utf16"
+
+	kemschemes "github.com/cloudflare/circl/kem/schemes"
+	"github.com/cloudflare/circl/sign"
+	signschemes "github.com/cloudflare/circl/sign/schemes"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// PKCS12Encryption selects how the private key and MAC of a PKCS#12 bundle are protected
+type PKCS12Encryption int
+
+const (
+	// PKCS12Modern encrypts with PBES2 (PBKDF2-HMAC-SHA256, AES-256-CBC) and
+	// uses an HMAC-SHA256 MAC
+	PKCS12Modern PKCS12Encryption = iota
+	// PKCS12Legacy encrypts with pbeWithSHAAnd3-KeyTripleDES-CBC and uses an
+	// HMAC-SHA1 MAC, for tools that predate PBES2 support
+	PKCS12Legacy
+)
+
+// pkcs12Iterations is the KDF and MAC iteration count, OpenSSL's default
+const pkcs12Iterations = 2048
+
+// pkcs12SaltSize is the size of the random KDF and MAC salts
+const pkcs12SaltSize = 16
+
+var (
+	oidDataContentType      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS8ShroudedKeyBag  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidFriendlyName         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidPBEWithSHAAnd3DESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBES2                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256       = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC            = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidSHA1                 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// pkcs8Algorithm is how a post-quantum private key is identified in PKCS#8,
+// and the CIRCL scheme that can recompute its public key
+type pkcs8Algorithm struct {
+	oid    asn1.ObjectIdentifier
+	scheme string
+}
+
+// pkcs8Algorithms are the PKCS#8 algorithms of the post-quantum keys. The
+// ml-kem-768 and ml-dsa providers implement round-3 Kyber768 and Dilithium,
+// whose keys differ from FIPS 203 and 204 ones, so they use the experimental
+// OIDs the Open Quantum Safe project assigned to those schemes rather than the
+// final ones; an importer expecting the final schemes would misread the keys.
+// SPHINCS+ is FIPS 205 SLH-DSA and uses its final OIDs. ECDH and ECDSA keys
+// use the standard EC encoding instead.
+var pkcs8Algorithms = map[Algorithm]pkcs8Algorithm{
+	AlgMLKEM768:    {asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 22554, 5, 6, 2}, "Kyber768"},
+	AlgMLDSA44:     {asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 2, 267, 7, 4, 4}, "Dilithium2"},
+	AlgMLDSA65:     {asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 2, 267, 7, 6, 5}, "Dilithium3"},
+	AlgMLDSA87:     {asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 2, 267, 7, 8, 7}, "Dilithium5"},
+	AlgSPHINCS128s: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 20}, "SLH-DSA-SHA2-128s"},
+	AlgSPHINCS256s: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 24}, "SLH-DSA-SHA2-256s"},
+}
+
+// ASN.1 structures from RFC 7292 (PKCS#12), RFC 8018 (PKCS#5) and RFC 5958
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type privateKeyInfo struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type oneAsymmetricKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	PublicKey  asn1.BitString `asn1:"optional,tag:1"`
+}
+
+// encodePKCS12 builds a password-protected PFX holding the key pair in a single
+// shrouded key bag. The bag's friendlyName is the algorithm name.
+func encodePKCS12(kp KeyPair, password string, encryption PKCS12Encryption) ([]byte, error) {
+	if len(kp.PrivateKey) == 0 {
+		return nil, fmt.Errorf("cannot export a key pair without a private key")
+	}
+	keyInfo, err := marshalPKCS8(kp)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encryptPKCS8(keyInfo, password, encryption)
+	if err != nil {
+		return nil, err
+	}
+	bagValue, err := asn1.Marshal(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode encrypted key: %w", err)
+	}
+	friendlyName, err := asn1.Marshal(asn1.RawValue{Tag: 30, Bytes: bmpString(string(kp.Algorithm))})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode friendly name: %w", err)
+	}
+	bags := []safeBag{{
+		ID:    oidPKCS8ShroudedKeyBag,
+		Value: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: bagValue},
+		Attributes: []pkcs12Attribute{{
+			ID:    oidFriendlyName,
+			Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: friendlyName},
+		}},
+	}}
+
+	safeContents, err := asn1.Marshal(bags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode safe contents: %w", err)
+	}
+	safeContentsInfo, err := dataContentInfo(safeContents)
+	if err != nil {
+		return nil, err
+	}
+	authSafe, err := asn1.Marshal([]contentInfo{safeContentsInfo})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode authenticated safe: %w", err)
+	}
+
+	pfx := pfxPdu{Version: 3}
+	if pfx.AuthSafe, err = dataContentInfo(authSafe); err != nil {
+		return nil, err
+	}
+	if pfx.MacData, err = computeMac(authSafe, password, encryption); err != nil {
+		return nil, err
+	}
+
+	der, err := asn1.Marshal(pfx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PKCS#12 bundle: %w", err)
+	}
+	return der, nil
+}
+
+// decodePKCS12 verifies the MAC of a PFX and returns the key pair from its
+// shrouded key bag
+func decodePKCS12(data []byte, password string) (KeyPair, error) {
+	var pfx pfxPdu
+	if rest, err := asn1.Unmarshal(data, &pfx); err != nil {
+		return KeyPair{}, fmt.Errorf("failed to parse PKCS#12 bundle: %w", err)
+	} else if len(rest) != 0 {
+		return KeyPair{}, errors.New("trailing data after PKCS#12 bundle")
+	}
+	if pfx.Version != 3 {
+		return KeyPair{}, fmt.Errorf("unsupported PKCS#12 version %d", pfx.Version)
+	}
+
+	authSafe, err := dataContent(pfx.AuthSafe)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	if err := verifyMac(pfx.MacData, authSafe, password); err != nil {
+		return KeyPair{}, err
+	}
+
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		return KeyPair{}, fmt.Errorf("failed to parse authenticated safe: %w", err)
+	}
+	for _, info := range contents {
+		// Encrypted content is used for certificates, which these bundles never carry
+		if !info.ContentType.Equal(oidDataContentType) {
+			continue
+		}
+		safeContents, err := dataContent(info)
+		if err != nil {
+			return KeyPair{}, err
+		}
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(safeContents, &bags); err != nil {
+			return KeyPair{}, fmt.Errorf("failed to parse safe contents: %w", err)
+		}
+		for _, bag := range bags {
+			if bag.ID.Equal(oidPKCS8ShroudedKeyBag) {
+				return decodeKeyBag(bag, password)
+			}
+		}
+	}
+	return KeyPair{}, errors.New("PKCS#12 bundle does not contain a private key")
+}
+
+// decodeKeyBag decrypts a shrouded key bag and parses the key for the
+// algorithm named by its friendlyName
+func decodeKeyBag(bag safeBag, password string) (KeyPair, error) {
+	var alg Algorithm
+	for _, attr := range bag.Attributes {
+		if !attr.ID.Equal(oidFriendlyName) {
+			continue
+		}
+		var name asn1.RawValue
+		if _, err := asn1.Unmarshal(attr.Value.Bytes, &name); err != nil {
+			return KeyPair{}, fmt.Errorf("failed to parse friendly name: %w", err)
+		}
+		decoded, err := decodeBMPString(name.Bytes)
+		if err != nil {
+			return KeyPair{}, err
+		}
+		alg = Algorithm(decoded)
+	}
+	if !isPEMAlgorithm(alg) {
+		return KeyPair{}, fmt.Errorf("PKCS#12 key has unknown algorithm %q", alg)
+	}
+
+	var encrypted encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(bag.Value.Bytes, &encrypted); err != nil {
+		return KeyPair{}, fmt.Errorf("failed to parse encrypted key: %w", err)
+	}
+	keyInfo, err := decryptPKCS8(encrypted, password)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return unmarshalPKCS8(alg, keyInfo)
+}
+
+// marshalPKCS8 encodes a private key as PKCS#8. Post-quantum keys are written
+// as a version 1 PrivateKeyInfo whose privateKey holds the key as a DER OCTET
+// STRING, as RFC 8410 does for EdDSA. The public key is left out, since it can
+// be recomputed from the private key and tools such as OpenSSL 3.0 reject the
+// version 2 OneAsymmetricKey that would carry it.
+func marshalPKCS8(kp KeyPair) ([]byte, error) {
+	switch kp.Algorithm {
+	case AlgECDH:
+		// ECDH private keys are already PKCS#8
+		return kp.PrivateKey, nil
+	case AlgECDSA:
+		curve := elliptic.P256()
+		key := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve}, D: new(big.Int).SetBytes(kp.PrivateKey)}
+		key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(kp.PrivateKey)
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode ECDSA key: %w", err)
+		}
+		return der, nil
+	}
+
+	alg, ok := pkcs8Algorithms[kp.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("PKCS#12 export is not supported for %s", kp.Algorithm)
+	}
+	privateKey, err := asn1.Marshal(kp.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+	der, err := asn1.Marshal(privateKeyInfo{
+		Algorithm:  pkix.AlgorithmIdentifier{Algorithm: alg.oid},
+		PrivateKey: privateKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+	return der, nil
+}
+
+// unmarshalPKCS8 reverses marshalPKCS8. Version 2 keys carrying their public
+// key are accepted too, if it matches the private key.
+func unmarshalPKCS8(alg Algorithm, der []byte) (KeyPair, error) {
+	switch alg {
+	case AlgECDH, AlgECDSA:
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return KeyPair{}, fmt.Errorf("failed to parse %s key: %w", alg, err)
+		}
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return KeyPair{}, fmt.Errorf("expected a P-256 key for %s", alg)
+		}
+		if alg == AlgECDSA {
+			return KeyPair{
+				PublicKey:  elliptic.MarshalCompressed(ecKey.Curve, ecKey.X, ecKey.Y),
+				PrivateKey: ecKey.D.Bytes(),
+				Algorithm:  alg,
+			}, nil
+		}
+		ecdhKey, err := ecKey.ECDH()
+		if err != nil {
+			return KeyPair{}, fmt.Errorf("failed to convert ECDH key: %w", err)
+		}
+		return ecdhKeyPair(ecdhKey, der), nil
+	}
+
+	var key oneAsymmetricKey
+	if rest, err := asn1.Unmarshal(der, &key); err != nil {
+		return KeyPair{}, fmt.Errorf("failed to parse private key: %w", err)
+	} else if len(rest) != 0 {
+		return KeyPair{}, errors.New("trailing data after private key")
+	}
+	pkcs8Alg, ok := pkcs8Algorithms[alg]
+	if !ok || !key.Algorithm.Algorithm.Equal(pkcs8Alg.oid) {
+		return KeyPair{}, fmt.Errorf("private key algorithm %v does not match %s", key.Algorithm.Algorithm, alg)
+	}
+	var privateKey []byte
+	if rest, err := asn1.Unmarshal(key.PrivateKey, &privateKey); err != nil {
+		return KeyPair{}, fmt.Errorf("failed to parse %s private key: %w", alg, err)
+	} else if len(rest) != 0 {
+		return KeyPair{}, errors.New("trailing data after private key")
+	}
+
+	publicKey, err := derivePublicKey(pkcs8Alg.scheme, privateKey)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("invalid %s private key: %w", alg, err)
+	}
+	if len(key.PublicKey.Bytes) != 0 && !bytes.Equal(key.PublicKey.Bytes, publicKey) {
+		return KeyPair{}, fmt.Errorf("%s public key does not match the private key", alg)
+	}
+	return KeyPair{PublicKey: publicKey, PrivateKey: privateKey, Algorithm: alg}, nil
+}
+
+// derivePublicKey recomputes the public key of a private key of the named
+// CIRCL KEM or signature scheme
+func derivePublicKey(scheme string, privateKey []byte) ([]byte, error) {
+	if kemScheme := kemschemes.ByName(scheme); kemScheme != nil {
+		sk, err := kemScheme.UnmarshalBinaryPrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return sk.Public().MarshalBinary()
+	}
+	signScheme := signschemes.ByName(scheme)
+	if signScheme == nil {
+		return nil, fmt.Errorf("unknown scheme %s", scheme)
+	}
+	sk, err := signScheme.UnmarshalBinaryPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	pk, ok := sk.Public().(sign.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s public key type", scheme)
+	}
+	return pk.MarshalBinary()
+}
+
+// ecdhKeyPair builds an ECDH key pair in the provider's format: the uncompressed
+// public point and the PKCS#8 private key
+func ecdhKeyPair(key *ecdh.PrivateKey, pkcs8 []byte) KeyPair {
+	return KeyPair{PublicKey: key.PublicKey().Bytes(), PrivateKey: pkcs8, Algorithm: AlgECDH}
+}
+
+// encryptPKCS8 encrypts a PKCS#8 private key with the chosen scheme
+func encryptPKCS8(keyInfo []byte, password string, encryption PKCS12Encryption) (encryptedPrivateKeyInfo, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return encryptedPrivateKeyInfo{}, err
+	}
+
+	if encryption == PKCS12Legacy {
+		params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: pkcs12Iterations})
+		if err != nil {
+			return encryptedPrivateKeyInfo{}, fmt.Errorf("failed to encode PBE parameters: %w", err)
+		}
+		block, iv, err := tripleDESCipher(password, salt, pkcs12Iterations)
+		if err != nil {
+			return encryptedPrivateKeyInfo{}, err
+		}
+		return encryptedPrivateKeyInfo{
+			Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd3DESCBC, Parameters: asn1.RawValue{FullBytes: params}},
+			EncryptedData: cbcEncrypt(block, iv, keyInfo),
+		}, nil
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return encryptedPrivateKeyInfo{}, fmt.Errorf("failed to generate IV: %w", err)
+	}
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: pkcs12Iterations,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return encryptedPrivateKeyInfo{}, fmt.Errorf("failed to encode PBKDF2 parameters: %w", err)
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return encryptedPrivateKeyInfo{}, fmt.Errorf("failed to encode IV: %w", err)
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return encryptedPrivateKeyInfo{}, fmt.Errorf("failed to encode PBES2 parameters: %w", err)
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(password), salt, pkcs12Iterations, 32, sha256.New))
+	if err != nil {
+		return encryptedPrivateKeyInfo{}, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: cbcEncrypt(block, iv, keyInfo),
+	}, nil
+}
+
+// decryptPKCS8 reverses encryptPKCS8
+func decryptPKCS8(encrypted encryptedPrivateKeyInfo, password string) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+
+	switch alg := encrypted.Algorithm.Algorithm; {
+	case alg.Equal(oidPBEWithSHAAnd3DESCBC):
+		var params pbeParams
+		if _, err := asn1.Unmarshal(encrypted.Algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("failed to parse PBE parameters: %w", err)
+		}
+		var err error
+		if block, iv, err = tripleDESCipher(password, params.Salt, params.Iterations); err != nil {
+			return nil, err
+		}
+
+	case alg.Equal(oidPBES2):
+		var params pbes2Params
+		if _, err := asn1.Unmarshal(encrypted.Algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("failed to parse PBES2 parameters: %w", err)
+		}
+		if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) || !params.EncryptionScheme.Algorithm.Equal(oidAES256CBC) {
+			return nil, errors.New("unsupported PBES2 scheme: only PBKDF2 with AES-256-CBC is supported")
+		}
+		var kdf pbkdf2Params
+		if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+			return nil, fmt.Errorf("failed to parse PBKDF2 parameters: %w", err)
+		}
+		prf := sha1.New // The PKCS#5 default
+		if len(kdf.PRF.Algorithm) != 0 {
+			if !kdf.PRF.Algorithm.Equal(oidHMACWithSHA256) {
+				return nil, fmt.Errorf("unsupported PBKDF2 PRF %v", kdf.PRF.Algorithm)
+			}
+			prf = sha256.New
+		}
+		if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, fmt.Errorf("failed to parse IV: %w", err)
+		}
+		if len(iv) != aes.BlockSize {
+			return nil, fmt.Errorf("invalid IV length %d", len(iv))
+		}
+		var err error
+		if block, err = aes.NewCipher(pbkdf2.Key([]byte(password), kdf.Salt, kdf.Iterations, 32, prf)); err != nil {
+			return nil, fmt.Errorf("failed to create cipher: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported key encryption algorithm %v", alg)
+	}
+
+	keyInfo, err := cbcDecrypt(block, iv, encrypted.EncryptedData)
+	if err != nil {
+		return nil, errors.New("failed to decrypt private key: wrong password or corrupted data")
+	}
+	return keyInfo, nil
+}
+
+// tripleDESCipher derives the 3DES key and IV for pbeWithSHAAnd3-KeyTripleDES-CBC
+func tripleDESCipher(password string, salt []byte, iterations int) (cipher.Block, []byte, error) {
+	bmpPassword := bmpString(password)
+	key := pkcs12KDF(sha1.New, bmpPassword, salt, iterations, 1, 24)
+	iv := pkcs12KDF(sha1.New, bmpPassword, salt, iterations, 2, des.BlockSize)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return block, iv, nil
+}
+
+// computeMac builds the MacData over the authenticated safe
+func computeMac(authSafe []byte, password string, encryption PKCS12Encryption) (macData, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return macData{}, err
+	}
+	digestAlg := oidSHA256
+	if encryption == PKCS12Legacy {
+		digestAlg = oidSHA1
+	}
+	mac := macData{
+		Mac:        digestInfo{Algorithm: pkix.AlgorithmIdentifier{Algorithm: digestAlg, Parameters: asn1.NullRawValue}},
+		MacSalt:    salt,
+		Iterations: pkcs12Iterations,
+	}
+	mac.Mac.Digest, err = macDigest(mac, authSafe, password)
+	return mac, err
+}
+
+// verifyMac checks the MAC of a PFX, which doubles as the password check
+func verifyMac(mac macData, authSafe []byte, password string) error {
+	if len(mac.Mac.Digest) == 0 {
+		return errors.New("PKCS#12 bundle has no MAC")
+	}
+	expected, err := macDigest(mac, authSafe, password)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, mac.Mac.Digest) {
+		return errors.New("PKCS#12 MAC verification failed: wrong password or corrupted data")
+	}
+	return nil
+}
+
+// macDigest computes the HMAC of the authenticated safe keyed by the PKCS#12 KDF
+func macDigest(mac macData, authSafe []byte, password string) ([]byte, error) {
+	var newHash func() hash.Hash
+	switch alg := mac.Mac.Algorithm.Algorithm; {
+	case alg.Equal(oidSHA1):
+		newHash = sha1.New
+	case alg.Equal(oidSHA256):
+		newHash = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported MAC algorithm %v", alg)
+	}
+	key := pkcs12KDF(newHash, bmpString(password), mac.MacSalt, mac.Iterations, 3, newHash().Size())
+	h := hmac.New(newHash, key)
+	h.Write(authSafe)
+	return h.Sum(nil), nil
+}
+
+// pkcs12KDF implements the key derivation of RFC 7292, appendix B.2. id is 1
+// for encryption keys, 2 for IVs and 3 for MAC keys.
+func pkcs12KDF(newHash func() hash.Hash, password, salt []byte, iterations int, id byte, size int) []byte {
+	v := newHash().BlockSize()
+
+	diversifier := bytes.Repeat([]byte{id}, v)
+	fill := func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		length := v * ((len(data) + v - 1) / v)
+		out := make([]byte, length)
+		for i := range out {
+			out[i] = data[i%len(data)]
+		}
+		return out
+	}
+	input := append(fill(salt), fill(password)...)
+
+	var out []byte
+	for len(out) < size {
+		h := newHash()
+		h.Write(diversifier)
+		h.Write(input)
+		a := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h.Reset()
+			h.Write(a)
+			a = h.Sum(a[:0])
+		}
+		out = append(out, a...)
+
+		// Ij = (Ij + B + 1) mod 2^(8v) for each v-byte block of the input
+		b := fill(a)[:v]
+		for j := 0; j < len(input); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(input[j+k]) + int(b[k]) + carry
+				input[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out[:size:size]
+}
+
+// bmpString encodes s as a null-terminated big-endian UTF-16 string, as the
+// PKCS#12 KDF and friendlyName expect
+func bmpString(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 0, 2*len(units)+2)
+	for _, unit := range units {
+		out = append(out, byte(unit>>8), byte(unit))
+	}
+	return append(out, 0, 0)
+}
+
+// decodeBMPString reverses bmpString, accepting strings without the terminator
+func decodeBMPString(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", errors.New("invalid BMPString length")
+	}
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	if len(units) > 0 && units[len(units)-1] == 0 {
+		units = units[:len(units)-1]
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// dataContentInfo wraps content in a ContentInfo of type data
+func dataContentInfo(content []byte) (contentInfo, error) {
+	octets, err := asn1.Marshal(content)
+	if err != nil {
+		return contentInfo{}, fmt.Errorf("failed to encode content: %w", err)
+	}
+	return contentInfo{
+		ContentType: oidDataContentType,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets},
+	}, nil
+}
+
+// dataContent unwraps the content of a ContentInfo of type data
+func dataContent(info contentInfo) ([]byte, error) {
+	if !info.ContentType.Equal(oidDataContentType) {
+		return nil, fmt.Errorf("unsupported PKCS#12 content type %v", info.ContentType)
+	}
+	var content []byte
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &content); err != nil {
+		return nil, fmt.Errorf("failed to parse content: %w", err)
+	}
+	return content, nil
+}
+
+// randomSalt returns a fresh salt for the KDF or MAC
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, pkcs12SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+// cbcEncrypt pads plaintext with PKCS#7 and encrypts it in CBC mode
+func cbcEncrypt(block cipher.Block, iv, plaintext []byte) []byte {
+	padding := block.BlockSize() - len(plaintext)%block.BlockSize()
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	return ciphertext
+}
+
+// cbcDecrypt decrypts CBC ciphertext and strips its PKCS#7 padding
+func cbcDecrypt(block cipher.Block, iv, ciphertext []byte) ([]byte, error) {
+	size := block.BlockSize()
+	if len(ciphertext) == 0 || len(ciphertext)%size != 0 {
+		return nil, errors.New("invalid ciphertext length")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > size {
+		return nil, errors.New("invalid padding")
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("invalid padding")
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
@@ -1,11 +1,15 @@
 package crypto
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 // Registry maintains a collection of crypto providers
 type Registry struct {
 	kemProviders       map[Algorithm]KEMProvider
 	signatureProviders map[Algorithm]SignatureProvider
+	keyCache           *KeyCache
 }
 
 // NewRegistry creates a new crypto registry
@@ -44,6 +48,71 @@ func (r *Registry) GetSignatureProvider(alg Algorithm) (SignatureProvider, error
 	return provider, nil
 }
 
+// provider retrieves the KEM or signature provider for an algorithm
+func (r *Registry) provider(alg Algorithm) (CryptoProvider, error) {
+	if provider, exists := r.kemProviders[alg]; exists {
+		return provider, nil
+	}
+	if provider, exists := r.signatureProviders[alg]; exists {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("provider not found: %s", alg)
+}
+
+// ListKEMAlgorithms returns the names of all registered KEM providers in sorted order
+func (r *Registry) ListKEMAlgorithms() []Algorithm {
+	algorithms := make([]Algorithm, 0, len(r.kemProviders))
+	for alg := range r.kemProviders {
+		algorithms = append(algorithms, alg)
+	}
+	sortAlgorithms(algorithms)
+	return algorithms
+}
+
+// ListSignatureAlgorithms returns the names of all registered signature providers in sorted order
+func (r *Registry) ListSignatureAlgorithms() []Algorithm {
+	algorithms := make([]Algorithm, 0, len(r.signatureProviders))
+	for alg := range r.signatureProviders {
+		algorithms = append(algorithms, alg)
+	}
+	sortAlgorithms(algorithms)
+	return algorithms
+}
+
+// AlgorithmInfo returns the metadata of a registered algorithm.
+// Providers that do not implement MetadataProvider only report their name.
+func (r *Registry) AlgorithmInfo(alg Algorithm) (AlgorithmMetadata, error) {
+	var provider CryptoProvider
+	if kem, exists := r.kemProviders[alg]; exists {
+		provider = kem
+	} else if sig, exists := r.signatureProviders[alg]; exists {
+		provider = sig
+	} else {
+		return AlgorithmMetadata{}, fmt.Errorf("provider not found: %s", alg)
+	}
+
+	if mp, ok := provider.(MetadataProvider); ok {
+		return mp.Metadata(), nil
+	}
+	return AlgorithmMetadata{Algorithm: alg}, nil
+}
+
+// ValidateAlgorithm returns an error unless a KEM or signature provider is
+// registered for alg
+func (r *Registry) ValidateAlgorithm(alg Algorithm) error {
+	if _, err := r.provider(alg); err != nil {
+		return fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+	return nil
+}
+
+// sortAlgorithms sorts algorithm names alphabetically
+func sortAlgorithms(algorithms []Algorithm) {
+	sort.Slice(algorithms, func(i, j int) bool {
+		return algorithms[i] < algorithms[j]
+	})
+}
+
 // DefaultRegistry creates a registry with all available providers
 func DefaultRegistry() *Registry {
 	registry := NewRegistry()
@@ -51,9 +120,22 @@ func DefaultRegistry() *Registry {
 	// Register KEM providers
 	registry.RegisterKEMProvider(NewMLKEM768Provider())
 	registry.RegisterKEMProvider(NewECDHProvider())
+	registry.RegisterKEMProvider(NewHybridKEMProvider())
+	registerFrodoKEMProviders(registry)
+	registerMcElieceProviders(registry)
+	registerHQCProviders(registry)
+	for _, bike := range []*BIKEProvider{NewBIKEL1Provider(), NewBIKEL3Provider()} {
+		if bike.Available() {
+			registry.RegisterKEMProvider(bike)
+		}
+	}
 	
 	// Register signature providers
+	registry.RegisterSignatureProvider(NewMLDSA44Provider())
 	registry.RegisterSignatureProvider(NewMLDSA65Provider())
+	registry.RegisterSignatureProvider(NewMLDSA87Provider())
+	registry.RegisterSignatureProvider(NewSPHINCS128sProvider())
+	registry.RegisterSignatureProvider(NewSPHINCS256sProvider())
 	registry.RegisterSignatureProvider(NewECDSAProvider())
 	
 	return registry
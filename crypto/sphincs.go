@@ -0,0 +1,130 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudflare/circl/sign"
+	"github.com/cloudflare/circl/sign/schemes"
+)
+
+// SPHINCSProvider implements the SignatureProvider interface for SPHINCS+ (SLH-DSA).
+// The "s" parameter sets favour small signatures, so key generation and signing are slow.
+type SPHINCSProvider struct {
+	algorithm Algorithm
+	nistLevel int
+	scheme    sign.Scheme
+}
+
+// NewSPHINCS128sProvider creates a new SPHINCS+-SHA2-128s provider
+func NewSPHINCS128sProvider() *SPHINCSProvider {
+	return &SPHINCSProvider{
+		algorithm: AlgSPHINCS128s,
+		nistLevel: 1,
+		scheme:    schemes.ByName("SLH-DSA-SHA2-128s"),
+	}
+}
+
+// NewSPHINCS256sProvider creates a new SPHINCS+-SHA2-256s provider
+func NewSPHINCS256sProvider() *SPHINCSProvider {
+	return &SPHINCSProvider{
+		algorithm: AlgSPHINCS256s,
+		nistLevel: 5,
+		scheme:    schemes.ByName("SLH-DSA-SHA2-256s"),
+	}
+}
+
+// Name returns the algorithm name
+func (p *SPHINCSProvider) Name() Algorithm {
+	return p.algorithm
+}
+
+// Metadata returns the SPHINCS+ parameters for this security level
+func (p *SPHINCSProvider) Metadata() AlgorithmMetadata {
+	return AlgorithmMetadata{
+		Algorithm:      p.algorithm,
+		Family:         "hash-based",
+		NISTLevel:      p.nistLevel,
+		PublicKeySize:  p.scheme.PublicKeySize(),
+		PrivateKeySize: p.scheme.PrivateKeySize(),
+		OutputSize:     p.scheme.SignatureSize(),
+	}
+}
+
+// KeyGen generates a new SPHINCS+ key pair
+func (p *SPHINCSProvider) KeyGen(ctx context.Context) (KeyPair, error) {
+	if err := checkContext(ctx, "KeyGen", p.algorithm); err != nil {
+		return KeyPair{}, err
+	}
+
+	// Generate key pair
+	pk, sk, err := p.scheme.GenerateKey()
+	if err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", p.algorithm, fmt.Errorf("failed to generate key pair: %w", err))
+	}
+
+	// Extract public and private keys as bytes
+	publicKey, err := pk.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", p.algorithm, fmt.Errorf("failed to marshal public key: %w", err))
+	}
+
+	privateKey, err := sk.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, newCryptoError(ErrCodeKeyGenFailed, "KeyGen", p.algorithm, fmt.Errorf("failed to marshal private key: %w", err))
+	}
+
+	if err := checkContext(ctx, "KeyGen", p.algorithm); err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Algorithm:  p.algorithm,
+	}, nil
+}
+
+// Sign creates a signature for the given message using the private key
+func (p *SPHINCSProvider) Sign(ctx context.Context, privateKeyBytes, message []byte) ([]byte, error) {
+	privateKeyBytes = privateKeyCopy(privateKeyBytes)
+	defer ZeroBytes(privateKeyBytes)
+
+	if err := checkContext(ctx, "Sign", p.algorithm); err != nil {
+		return nil, err
+	}
+
+	// Parse private key from bytes
+	sk, err := p.scheme.UnmarshalBinaryPrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, newCryptoError(ErrCodeInvalidKey, "Sign", p.algorithm, fmt.Errorf("failed to parse private key: %w", err))
+	}
+
+	// Sign the message
+	signature := p.scheme.Sign(sk, message, nil)
+
+	if err := checkContext(ctx, "Sign", p.algorithm); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// Verify checks if the signature is valid for the given message and public key
+func (p *SPHINCSProvider) Verify(ctx context.Context, publicKeyBytes, message, signature []byte) (bool, error) {
+	if err := checkContext(ctx, "Verify", p.algorithm); err != nil {
+		return false, err
+	}
+
+	// Parse public key from bytes
+	pk, err := p.scheme.UnmarshalBinaryPublicKey(publicKeyBytes)
+	if err != nil {
+		return false, newCryptoError(ErrCodeInvalidKey, "Verify", p.algorithm, fmt.Errorf("failed to parse public key: %w", err))
+	}
+
+	// Verify the signature
+	valid := p.scheme.Verify(pk, message, signature, nil)
+
+	if err := checkContext(ctx, "Verify", p.algorithm); err != nil {
+		return false, err
+	}
+	return valid, nil
+}
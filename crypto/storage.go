@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// storageKeyInfo binds keys derived for private key storage to that purpose.
+// It matches the backend so both can read keys the other has stored.
+const storageKeyInfo = "pqcd key_pairs private_key v1"
+
+// KeyEncryptor encrypts private keys before they are written to the key store.
+// It uses AES-256-GCM with a key derived from a master secret via HKDF-SHA256,
+// in the same format as the backend.
+type KeyEncryptor struct {
+	gcm cipher.AEAD
+}
+
+// NewKeyEncryptor derives the storage key from masterKey
+func NewKeyEncryptor(masterKey string) (*KeyEncryptor, error) {
+	if masterKey == "" {
+		return nil, errors.New("master key must not be empty")
+	}
+
+	key, err := DeriveKey([]byte(masterKey), []byte(storageKeyInfo), 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return &KeyEncryptor{gcm: gcm}, nil
+}
+
+// EncryptForStorage returns nonce || ciphertext || tag for a private key
+func (e *KeyEncryptor) EncryptForStorage(privKey []byte) ([]byte, error) {
+	nonce := make([]byte, e.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return e.gcm.Seal(nonce, nonce, privKey, nil), nil
+}
+
+// DecryptFromStorage reverses EncryptForStorage
+func (e *KeyEncryptor) DecryptFromStorage(blob []byte) ([]byte, error) {
+	nonceSize := e.gcm.NonceSize()
+	if len(blob) < nonceSize+e.gcm.Overhead() {
+		return nil, errors.New("stored key is too short")
+	}
+	privKey, err := e.gcm.Open(nil, blob[:nonceSize], blob[nonceSize:], nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt stored key: wrong master key or corrupted data")
+	}
+	return privKey, nil
+}
@@ -0,0 +1,15 @@
+// Command oldplugin is a provider plugin built for a plugin API version that
+// doesn't exist, used to test that Registry.LoadPlugin refuses it
+package main
+
+import "pqcd/crypto"
+
+// PluginAPIVersion claims an API version older than any supported one
+var PluginAPIVersion = 0
+
+// GetKEMProviders would return the built-in ECDH provider
+func GetKEMProviders() []crypto.KEMProvider {
+	return []crypto.KEMProvider{crypto.NewECDHProvider()}
+}
+
+func main() {}
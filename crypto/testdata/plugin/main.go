@@ -0,0 +1,26 @@
+// Command plugin is a provider plugin used to test Registry.LoadPlugin. It
+// provides ECDH under a name of its own. Build it with
+//
+//	go build -buildmode=plugin -o testplugin.so ./crypto/testdata/plugin
+package main
+
+import "pqcd/crypto"
+
+// PluginAPIVersion is the plugin API version the plugin was built against
+var PluginAPIVersion = crypto.PluginAPIVersion
+
+// pluginKEM is ECDH renamed, so tests can tell it apart from the built-in provider
+type pluginKEM struct {
+	*crypto.ECDHProvider
+}
+
+func (pluginKEM) Name() crypto.Algorithm {
+	return "plugin-ecdh"
+}
+
+// GetKEMProviders returns the providers the plugin adds to a registry
+func GetKEMProviders() []crypto.KEMProvider {
+	return []crypto.KEMProvider{pluginKEM{crypto.NewECDHProvider()}}
+}
+
+func main() {}
@@ -1,18 +1,34 @@
 package crypto
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // Algorithm represents a cryptographic algorithm type
 type Algorithm string
 
 const (
 	// Key Encapsulation Mechanisms
-	AlgMLKEM768 Algorithm = "ml-kem-768"
-	AlgECDH     Algorithm = "ecdh"
+	AlgMLKEM768        Algorithm = "ml-kem-768"
+	AlgECDH            Algorithm = "ecdh"
+	AlgHybridMLKEMECDH Algorithm = "hybrid-ml-kem-ecdh"
+	AlgFrodoKEM640     Algorithm = "frodokem-640-aes"
+	AlgFrodoKEM976     Algorithm = "frodokem-976-aes"
+	AlgBIKEL1          Algorithm = "bike-l1"
+	AlgBIKEL3          Algorithm = "bike-l3"
+	AlgMcEliece348864  Algorithm = "mceliece-348864"
+	AlgMcEliece460896  Algorithm = "mceliece-460896"
+	AlgHQC128          Algorithm = "hqc-128"
+	AlgHQC256          Algorithm = "hqc-256"
 
 	// Digital Signature Algorithms
-	AlgMLDSA65 Algorithm = "ml-dsa-65"
-	AlgECDSA   Algorithm = "ecdsa"
+	AlgMLDSA44     Algorithm = "ml-dsa-44"
+	AlgMLDSA65     Algorithm = "ml-dsa-65"
+	AlgMLDSA87     Algorithm = "ml-dsa-87"
+	AlgSPHINCS128s Algorithm = "sphincs-sha2-128s"
+	AlgSPHINCS256s Algorithm = "sphincs-sha2-256s"
+	AlgECDSA       Algorithm = "ecdsa"
 )
 
 // CryptoProvider is an interface for crypto operations
@@ -21,7 +37,28 @@ type CryptoProvider interface {
 	Name() Algorithm
 	
 	// KeyGen generates a new key pair
-	KeyGen() (KeyPair, error)
+	KeyGen(ctx context.Context) (KeyPair, error)
+}
+
+// AlgorithmMetadata describes the parameters of a registered algorithm
+type AlgorithmMetadata struct {
+	Algorithm      Algorithm `json:"algorithm"`
+	Family         string    `json:"family"`
+	NISTLevel      int       `json:"nistLevel"` // 0 for classical algorithms
+	PublicKeySize  int       `json:"publicKeySize"`
+	PrivateKeySize int       `json:"privateKeySize"`
+	OutputSize     int       `json:"outputSize"` // Size of either signature or ciphertext
+
+	// DecapsulationFailureRate bounds the chance that decapsulating a valid
+	// ciphertext yields the wrong shared secret. It is 0 for KEMs whose
+	// decapsulation never fails.
+	DecapsulationFailureRate float64 `json:"decapsulationFailureRate,omitempty"`
+}
+
+// MetadataProvider is implemented by providers that can describe their parameters
+type MetadataProvider interface {
+	// Metadata returns the algorithm parameters
+	Metadata() AlgorithmMetadata
 }
 
 // KeyPair represents a generic key pair
@@ -40,15 +77,41 @@ type OperationResult struct {
 	DataSize  int // Size of either signature or ciphertext
 }
 
-// KEMProvider is an interface for KEM operations
+// KEMProvider is an interface for KEM operations. Shared secrets must only be
+// compared with SecureCompare, never bytes.Equal, whether by a provider (for
+// example to check a recomputed secret) or by its callers.
+//
+// Every provider operation takes a context and fails with an ErrCodeCanceled
+// error, rather than returning a result, if the context ends before it
+// completes.
 type KEMProvider interface {
 	CryptoProvider
 	
 	// Encapsulate generates a shared secret for the given public key
-	Encapsulate(publicKey []byte) (ciphertext []byte, sharedSecret []byte, err error)
+	Encapsulate(ctx context.Context, publicKey []byte) (ciphertext []byte, sharedSecret []byte, err error)
 	
 	// Decapsulate recovers the shared secret from the ciphertext using the private key
-	Decapsulate(privateKey, ciphertext []byte) (sharedSecret []byte, err error)
+	Decapsulate(ctx context.Context, privateKey, ciphertext []byte) (sharedSecret []byte, err error)
+}
+
+// FallibleKEMProvider is implemented by KEMs whose decapsulation of a valid
+// ciphertext can yield the wrong shared secret, such as BIKE and HQC, rather
+// than always recovering it like ML-KEM. The wrong secret comes back without
+// an error, so protocols using a fallible KEM must tolerate a failed handshake
+// and retry it. Metadata reports the failure rate as DecapsulationFailureRate.
+type FallibleKEMProvider interface {
+	KEMProvider
+	
+	// IsFallible reports whether decapsulation can fail
+	IsFallible() bool
+}
+
+// PublicKeyDeriver is implemented by providers that can recompute the public
+// key of a key pair from its private key, so a stored public key can be
+// checked against the private key it was stored with
+type PublicKeyDeriver interface {
+	// DerivePublicKey returns the public key belonging to the private key
+	DerivePublicKey(privateKey []byte) (publicKey []byte, err error)
 }
 
 // SignatureProvider is an interface for digital signature operations
@@ -56,8 +119,8 @@ type SignatureProvider interface {
 	CryptoProvider
 	
 	// Sign creates a signature for the given message using the private key
-	Sign(privateKey, message []byte) (signature []byte, err error)
+	Sign(ctx context.Context, privateKey, message []byte) (signature []byte, err error)
 	
 	// Verify checks if the signature is valid for the given message and public key
-	Verify(publicKey, message, signature []byte) (valid bool, err error)
+	Verify(ctx context.Context, publicKey, message, signature []byte) (valid bool, err error)
 } 
\ No newline at end of file
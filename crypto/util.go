@@ -0,0 +1,11 @@
+package crypto
+
+import "crypto/subtle"
+
+// SecureCompare reports whether a and b are equal in time that depends only on
+// their lengths, not their contents. Use it rather than bytes.Equal for shared
+// secrets, keys and MACs, so comparisons don't leak how many leading bytes
+// matched.
+func SecureCompare(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
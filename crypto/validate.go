@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrKeyPairMismatch is the cause of the error VerifyKeyPair returns when a
+// private key doesn't belong with the public key it is checked against
+var ErrKeyPairMismatch = errors.New("private key does not belong with public key")
+
+// keyPairProbe is the message VerifyKeyPair signs to check a signature key pair
+var keyPairProbe = []byte("pqcd key pair check")
+
+// ciphertextSizes holds the ciphertext size of every KEM, in bytes. Like
+// publicKeySizes it covers the algorithms left out of the binary by build tags.
+var ciphertextSizes = map[Algorithm]int{
+	AlgMLKEM768:        1088,
+	AlgECDH:            65,
+	AlgHybridMLKEMECDH: 1088 + 65,
+	AlgFrodoKEM640:     9720,
+	AlgFrodoKEM976:     15744,
+	AlgBIKEL1:          1573,
+	AlgBIKEL3:          3115,
+	AlgMcEliece348864:  96,
+	AlgMcEliece460896:  156,
+	AlgHQC128:          4433,
+	AlgHQC256:          14421,
+}
+
+// ValidateCiphertextSize returns an ErrCodeInvalidKey error unless ct is the
+// size of a ciphertext for alg, so a truncated or padded ciphertext is
+// rejected before it can decapsulate to a garbage secret
+func ValidateCiphertextSize(alg Algorithm, ct []byte) error {
+	size, ok := ciphertextSizes[alg]
+	if !ok {
+		return newCryptoError(ErrCodeUnsupported, "Decapsulate", alg, fmt.Errorf("unsupported algorithm: %s", alg))
+	}
+	if len(ct) != size {
+		return newCryptoError(ErrCodeInvalidKey, "Decapsulate", alg, fmt.Errorf("invalid ciphertext: must be %d bytes, got %d", size, len(ct)))
+	}
+	return nil
+}
+
+// VerifyKeyPair checks that publicKey and privateKey work together: a KEM's
+// private key must recover the secret encapsulated to its public key, and a
+// signature scheme's public key must verify what its private key signs. Keys
+// that parse but don't belong together fail with an ErrCodeInvalidKey error
+// wrapping ErrKeyPairMismatch. A fallible KEM fails a sound key pair at its
+// decapsulation failure rate.
+func VerifyKeyPair(ctx context.Context, provider CryptoProvider, publicKey, privateKey []byte) error {
+	switch p := provider.(type) {
+	case KEMProvider:
+		ciphertext, sharedSecret, err := p.Encapsulate(ctx, publicKey)
+		if err != nil {
+			return err
+		}
+		defer ZeroBytes(sharedSecret)
+		recovered, err := p.Decapsulate(ctx, privateKey, ciphertext)
+		if err != nil {
+			return err
+		}
+		defer ZeroBytes(recovered)
+		if !SecureCompare(sharedSecret, recovered) {
+			return newCryptoError(ErrCodeInvalidKey, "VerifyKeyPair", p.Name(), ErrKeyPairMismatch)
+		}
+	case SignatureProvider:
+		signature, err := p.Sign(ctx, privateKey, keyPairProbe)
+		if err != nil {
+			return err
+		}
+		valid, err := p.Verify(ctx, publicKey, keyPairProbe, signature)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return newCryptoError(ErrCodeInvalidKey, "VerifyKeyPair", p.Name(), ErrKeyPairMismatch)
+		}
+	default:
+		return newCryptoError(ErrCodeUnsupported, "VerifyKeyPair", provider.Name(), fmt.Errorf("%s has no key pairs to check", provider.Name()))
+	}
+	return nil
+}
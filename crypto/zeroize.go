@@ -0,0 +1,20 @@
+package crypto
+
+import "runtime"
+
+// ZeroBytes overwrites b with zeros, so private key material doesn't linger in
+// memory after use. The KeepAlive stops the compiler from treating the writes
+// as dead stores to a slice that is never read again.
+func ZeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
+
+// privateKeyCopy returns a copy of a private key for Decapsulate or Sign to
+// work on and zero when done. The caller's key is left intact, since callers
+// such as the key cache reuse it, and whoever decoded or loaded it zeroes it.
+func privateKeyCopy(privateKey []byte) []byte {
+	return append([]byte(nil), privateKey...)
+}
@@ -4,12 +4,19 @@
 CREATE TABLE IF NOT EXISTS key_pairs (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     public_key BLOB NOT NULL,
-    private_key BLOB NOT NULL,
-    fingerprint TEXT NOT NULL,
+    private_key BLOB,                  -- NULL for public keys imported on their own
+    fingerprint VARCHAR(95) NOT NULL,  -- Colon-separated SHA-256 (32 hex pairs)
     algorithm TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     is_real BOOLEAN DEFAULT 1,
-    tags TEXT
+    tags TEXT,                         -- JSON array of tag names
+    source_ip TEXT,
+    expires_at TIMESTAMP,              -- NULL means the key never expires
+    superseded_by INTEGER REFERENCES key_pairs(id), -- Replacement after rotation
+    effectiveness_score REAL,          -- How convincing a decoy is, from 0 to 1
+    flagged BOOLEAN DEFAULT 0,         -- Set on keys used for too many encapsulations
+    deleted_at TIMESTAMP,              -- Set on decoys replaced by the rotator
+    origin_fingerprint TEXT            -- Fingerprint of the real key a decoy was generated for
 );
 
 -- Create index on fingerprint for faster lookups
@@ -18,6 +25,24 @@ CREATE INDEX IF NOT EXISTS idx_key_pairs_fingerprint ON key_pairs(fingerprint);
 -- Create index on algorithm type
 CREATE INDEX IF NOT EXISTS idx_key_pairs_algorithm ON key_pairs(algorithm);
 
+-- Create index on real/decoy flag for key listing
+CREATE INDEX IF NOT EXISTS idx_key_pairs_is_real ON key_pairs(is_real);
+
+-- Create index on expiry for purging expired keys
+CREATE INDEX IF NOT EXISTS idx_key_pairs_expires_at ON key_pairs(expires_at);
+
+-- Create index on origin fingerprint for listing a key's decoys
+CREATE INDEX IF NOT EXISTS idx_key_pairs_origin_fingerprint ON key_pairs(origin_fingerprint);
+
+-- Key usage table, counting operations per key to spot enumeration attacks
+CREATE TABLE IF NOT EXISTS key_usage (
+    fingerprint TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    last_used TIMESTAMP,
+    UNIQUE (fingerprint, operation)
+);
+
 -- Decoy table 
 CREATE TABLE IF NOT EXISTS decoys (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -31,6 +56,9 @@ CREATE TABLE IF NOT EXISTS decoys (
 -- Create index on target text
 CREATE INDEX IF NOT EXISTS idx_decoys_target ON decoys(target_text);
 
+-- Create index on target text and complexity for filtering decoy history
+CREATE INDEX IF NOT EXISTS idx_decoys_target_complexity ON decoys(target_text, complexity);
+
 -- Event log table
 CREATE TABLE IF NOT EXISTS event_logs (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -46,6 +74,29 @@ CREATE TABLE IF NOT EXISTS event_logs (
 -- Create index on event type and timestamp
 CREATE INDEX IF NOT EXISTS idx_event_logs_type_time ON event_logs(event_type, timestamp);
 
+-- Create index on source IP and event type for per-client threat history
+CREATE INDEX IF NOT EXISTS idx_event_logs_ip_type ON event_logs(source_ip, event_type);
+
+-- Create index on severity and timestamp for listing events by severity
+CREATE INDEX IF NOT EXISTS idx_event_logs_severity_time ON event_logs(severity, timestamp);
+
+-- Key bundle table, a KEM key pair and a signature key pair generated together
+CREATE TABLE IF NOT EXISTS key_bundles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    fingerprint TEXT NOT NULL,         -- Hex SHA-256 of the KEM then signature public key
+    kem_algorithm TEXT NOT NULL,
+    kem_public_key BLOB NOT NULL,
+    kem_private_key BLOB NOT NULL,     -- Encrypted for storage
+    sig_algorithm TEXT NOT NULL,
+    sig_public_key BLOB NOT NULL,
+    sig_private_key BLOB NOT NULL,     -- Encrypted for storage
+    source_ip TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create index on bundle fingerprint for lookups
+CREATE INDEX IF NOT EXISTS idx_key_bundles_fingerprint ON key_bundles(fingerprint);
+
 -- User table
 CREATE TABLE IF NOT EXISTS users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -56,6 +107,58 @@ CREATE TABLE IF NOT EXISTS users (
     role TEXT CHECK (role IN ('admin', 'user', 'readonly')) DEFAULT 'user'
 );
 
--- Insert default admin user (password: admin123)
-INSERT OR IGNORE INTO users (username, password_hash, role) 
-VALUES ('admin', '$2b$12$1B7tQMt1IjuOXZvGdyz9A.J1DWnbwOgqYJMBpWY2Rcx.UmNMy9.cG', 'admin'); 
\ No newline at end of file
+-- Login sessions. The ID is the bearer token.
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP               -- Set on logout
+);
+
+-- Create index on expiry for purging expired sessions
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Clients registered to sign their requests
+CREATE TABLE IF NOT EXISTS clients (
+    client_id TEXT PRIMARY KEY,        -- Random hex ID sent in X-Client-ID
+    name TEXT,
+    algorithm TEXT NOT NULL,           -- ml-dsa-65 or ecdsa
+    public_key BLOB NOT NULL,
+    source_ip TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Block list table
+CREATE TABLE IF NOT EXISTS block_list (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ip TEXT NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create index on blocked IP
+CREATE INDEX IF NOT EXISTS idx_block_list_ip ON block_list(ip);
+
+-- Create canary tokens table, one row per decoy key that carries a token
+CREATE TABLE IF NOT EXISTS canary_tokens (
+    token_id TEXT PRIMARY KEY,
+    key_pair_id INTEGER REFERENCES key_pairs(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    first_triggered_at TIMESTAMP,
+    last_triggered_at TIMESTAMP,
+    trigger_count INTEGER NOT NULL DEFAULT 0,
+    last_source_ip TEXT
+);
+
+-- Create background key generation jobs table
+CREATE TABLE IF NOT EXISTS keygen_jobs (
+    id TEXT PRIMARY KEY,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    key_id INTEGER REFERENCES key_pairs(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    error TEXT
+);
+
+-- The servers create the admin user from ADMIN_PASSWORD on startup
\ No newline at end of file
@@ -0,0 +1,209 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"pqcd/benchmark"
+	"pqcd/crypto"
+	pb "pqcd/proto"
+	"pqcd/testutil"
+)
+
+// newTestClient starts a server on an in-memory listener and returns a client stub for it
+func newTestClient(t *testing.T, metrics *benchmark.MetricsCollector) pb.CryptoServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(testutil.NewTestRegistry(t), metrics)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewCryptoServiceClient(conn)
+}
+
+func TestEncapsulateDecapsulate(t *testing.T) {
+	client := newTestClient(t, benchmark.NewMetricsCollector())
+	ctx := context.Background()
+
+	for _, alg := range []crypto.Algorithm{crypto.AlgMLKEM768, crypto.AlgECDH, crypto.AlgHybridMLKEMECDH, testutil.MockKEMAlgorithm} {
+		keyPair, err := client.KeyGen(ctx, &pb.KeyGenRequest{Algorithm: string(alg)})
+		if err != nil {
+			t.Fatalf("KeyGen %s failed: %v", alg, err)
+		}
+		encap, err := client.Encapsulate(ctx, &pb.EncapsulateRequest{Algorithm: string(alg), PublicKey: keyPair.PublicKey})
+		if err != nil {
+			t.Fatalf("Encapsulate %s failed: %v", alg, err)
+		}
+		decap, err := client.Decapsulate(ctx, &pb.DecapsulateRequest{
+			Algorithm:  string(alg),
+			PrivateKey: keyPair.PrivateKey,
+			Ciphertext: encap.Ciphertext,
+		})
+		if err != nil {
+			t.Fatalf("Decapsulate %s failed: %v", alg, err)
+		}
+		if !crypto.SecureCompare(encap.SharedSecret, decap.SharedSecret) {
+			t.Errorf("Expected %s shared secrets to match", alg)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	client := newTestClient(t, benchmark.NewMetricsCollector())
+	ctx := context.Background()
+	message := []byte("gRPC test message")
+
+	keyPair, err := client.KeyGen(ctx, &pb.KeyGenRequest{Algorithm: string(crypto.AlgMLDSA65)})
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	signed, err := client.Sign(ctx, &pb.SignRequest{Algorithm: string(crypto.AlgMLDSA65), PrivateKey: keyPair.PrivateKey, Message: message})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	verified, err := client.Verify(ctx, &pb.VerifyRequest{
+		Algorithm: string(crypto.AlgMLDSA65),
+		PublicKey: keyPair.PublicKey,
+		Message:   message,
+		Signature: signed.Signature,
+	})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !verified.Valid {
+		t.Errorf("Expected signature to verify")
+	}
+
+	verified, err = client.Verify(ctx, &pb.VerifyRequest{
+		Algorithm: string(crypto.AlgMLDSA65),
+		PublicKey: keyPair.PublicKey,
+		Message:   []byte("tampered message"),
+		Signature: signed.Signature,
+	})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if verified.Valid {
+		t.Errorf("Expected tampered message to fail verification")
+	}
+}
+
+func TestStreamEncapsulateDecapsulate(t *testing.T) {
+	client := newTestClient(t, benchmark.NewMetricsCollector())
+	ctx := context.Background()
+	alg := string(crypto.AlgMLKEM768)
+	const count = 5
+
+	keyPair := testutil.MustGenerateKeyPair(t, crypto.AlgMLKEM768)
+
+	encapStream, err := client.StreamEncapsulate(ctx)
+	if err != nil {
+		t.Fatalf("StreamEncapsulate failed: %v", err)
+	}
+	for i := 0; i < count; i++ {
+		if err := encapStream.Send(&pb.EncapsulateRequest{Algorithm: alg, PublicKey: keyPair.PublicKey}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	encapResults, err := encapStream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("StreamEncapsulate failed: %v", err)
+	}
+	if len(encapResults.Results) != count {
+		t.Fatalf("Expected %d results, got %d", count, len(encapResults.Results))
+	}
+
+	decapStream, err := client.StreamDecapsulate(ctx)
+	if err != nil {
+		t.Fatalf("StreamDecapsulate failed: %v", err)
+	}
+	for _, result := range encapResults.Results {
+		if err := decapStream.Send(&pb.DecapsulateRequest{Algorithm: alg, PrivateKey: keyPair.PrivateKey, Ciphertext: result.Ciphertext}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	decapResults, err := decapStream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("StreamDecapsulate failed: %v", err)
+	}
+	if len(decapResults.Results) != count {
+		t.Fatalf("Expected %d results, got %d", count, len(decapResults.Results))
+	}
+	for i := range decapResults.Results {
+		if !crypto.SecureCompare(encapResults.Results[i].SharedSecret, decapResults.Results[i].SharedSecret) {
+			t.Errorf("Expected shared secrets to match at position %d", i)
+		}
+	}
+}
+
+func TestUnsupportedAlgorithm(t *testing.T) {
+	client := newTestClient(t, benchmark.NewMetricsCollector())
+
+	_, err := client.Encapsulate(context.Background(), &pb.EncapsulateRequest{Algorithm: "rsa-2048"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	client := newTestClient(t, benchmark.NewMetricsCollector())
+
+	_, err := client.Encapsulate(context.Background(), &pb.EncapsulateRequest{
+		Algorithm: string(crypto.AlgMLKEM768),
+		PublicKey: []byte("too short"),
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestMetricsInterceptors(t *testing.T) {
+	metrics := benchmark.NewMetricsCollector()
+	client := newTestClient(t, metrics)
+	ctx := context.Background()
+	alg := string(crypto.AlgECDH)
+
+	keyPair, err := client.KeyGen(ctx, &pb.KeyGenRequest{Algorithm: alg})
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	stream, err := client.StreamEncapsulate(ctx)
+	if err != nil {
+		t.Fatalf("StreamEncapsulate failed: %v", err)
+	}
+	if err := stream.Send(&pb.EncapsulateRequest{Algorithm: alg, PublicKey: keyPair.PublicKey}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatalf("StreamEncapsulate failed: %v", err)
+	}
+
+	counts := map[string]int{}
+	for _, stats := range metrics.GetAllStats() {
+		if stats.Algorithm == crypto.AlgECDH {
+			counts[stats.Operation] = stats.Count
+		}
+	}
+	if counts["KeyGen"] != 1 || counts["StreamEncapsulate"] != 1 {
+		t.Errorf("Expected one KeyGen and one StreamEncapsulate, got %v", counts)
+	}
+}
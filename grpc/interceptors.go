@@ -0,0 +1,123 @@
+package grpc
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"pqcd/benchmark"
+	"pqcd/crypto"
+)
+
+// algorithmRequest is implemented by every request message of the crypto service
+type algorithmRequest interface {
+	GetAlgorithm() string
+}
+
+// LoggingUnaryInterceptor logs every unary call with its duration and status code
+func LoggingUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(info.FullMethod, time.Since(start), err)
+		return resp, err
+	}
+}
+
+// LoggingStreamInterceptor logs every streaming call with its duration and status code
+func LoggingStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(info.FullMethod, time.Since(start), err)
+		return err
+	}
+}
+
+// logCall logs the outcome of a call, at Warn level if it failed
+func logCall(method string, duration time.Duration, err error) {
+	entry := logrus.WithFields(logrus.Fields{
+		"method":      method,
+		"duration_ms": duration.Milliseconds(),
+		"code":        status.Code(err).String(),
+	})
+	if err != nil {
+		entry.WithError(err).Warn("gRPC call failed")
+		return
+	}
+	entry.Debug("gRPC call")
+}
+
+// MetricsUnaryInterceptor records every unary call in metrics under the RPC
+// name, so KeyGen, Encapsulate and the rest are reported like their HTTP counterparts
+func MetricsUnaryInterceptor(metrics *benchmark.MetricsCollector) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		duration := time.Since(start)
+
+		algReq, ok := req.(algorithmRequest)
+		if !ok {
+			return resp, err
+		}
+		metrics.RecordOperation(ctx, crypto.Algorithm(algReq.GetAlgorithm()), path.Base(info.FullMethod), duration, messageSize(req), messageSize(resp), err == nil)
+		return resp, err
+	}
+}
+
+// MetricsStreamInterceptor records every streaming call in metrics under the
+// RPC name and the algorithm of the last message received
+func MetricsStreamInterceptor(metrics *benchmark.MetricsCollector) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		stream := &meteredStream{ServerStream: ss}
+		start := time.Now()
+		err := handler(srv, stream)
+		duration := time.Since(start)
+
+		if stream.algorithm == "" {
+			return err
+		}
+		metrics.RecordOperation(ss.Context(), stream.algorithm, path.Base(info.FullMethod), duration, stream.received, stream.sent, err == nil)
+		return err
+	}
+}
+
+// meteredStream counts the bytes passing through a server stream
+type meteredStream struct {
+	grpc.ServerStream
+	algorithm crypto.Algorithm
+	received  int
+	sent      int
+}
+
+// RecvMsg records the size and algorithm of each received message
+func (s *meteredStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+	s.received += messageSize(m)
+	if algReq, ok := m.(algorithmRequest); ok {
+		s.algorithm = crypto.Algorithm(algReq.GetAlgorithm())
+	}
+	return nil
+}
+
+// SendMsg records the size of each sent message
+func (s *meteredStream) SendMsg(m interface{}) error {
+	s.sent += messageSize(m)
+	return s.ServerStream.SendMsg(m)
+}
+
+// messageSize returns the encoded size of a protobuf message, or 0 for anything else
+func messageSize(m interface{}) int {
+	if msg, ok := m.(proto.Message); ok {
+		return proto.Size(msg)
+	}
+	return 0
+}
@@ -0,0 +1,255 @@
+// Package grpc serves the crypto operations over gRPC alongside the HTTP API.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"pqcd/benchmark"
+	"pqcd/crypto"
+	pb "pqcd/proto"
+)
+
+// DefaultPort is the gRPC port used when GRPC_PORT is not set
+const DefaultPort = 9090
+
+// CryptoServiceServer implements the CryptoService RPCs with the providers in a registry
+type CryptoServiceServer struct {
+	pb.UnimplementedCryptoServiceServer
+
+	registry *crypto.Registry
+}
+
+// NewCryptoServiceServer creates a server backed by registry
+func NewCryptoServiceServer(registry *crypto.Registry) *CryptoServiceServer {
+	return &CryptoServiceServer{registry: registry}
+}
+
+// NewServer creates a gRPC server with the crypto service registered and the
+// logging and metrics interceptors installed
+func NewServer(registry *crypto.Registry, metrics *benchmark.MetricsCollector, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(LoggingUnaryInterceptor(), MetricsUnaryInterceptor(metrics)),
+		grpc.ChainStreamInterceptor(LoggingStreamInterceptor(), MetricsStreamInterceptor(metrics)),
+	)
+	srv := grpc.NewServer(opts...)
+	pb.RegisterCryptoServiceServer(srv, NewCryptoServiceServer(registry))
+	return srv
+}
+
+// Port reads the gRPC port from GRPC_PORT, falling back to DefaultPort
+func Port() int {
+	value := os.Getenv("GRPC_PORT")
+	if value == "" {
+		return DefaultPort
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		logrus.WithField("value", value).Warnf("Invalid GRPC_PORT, using default of %d", DefaultPort)
+		return DefaultPort
+	}
+	return port
+}
+
+// Serve starts srv on port and blocks until it stops
+func Serve(srv *grpc.Server, port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d: %w", port, err)
+	}
+	logrus.Infof("gRPC server starting on port %d", port)
+	return srv.Serve(lis)
+}
+
+// KeyGen generates a key pair
+func (s *CryptoServiceServer) KeyGen(ctx context.Context, req *pb.KeyGenRequest) (*pb.KeyGenResponse, error) {
+	algorithm := crypto.Algorithm(req.GetAlgorithm())
+
+	var provider crypto.CryptoProvider
+	if kem, err := s.registry.GetKEMProvider(algorithm); err == nil {
+		provider = kem
+	} else if sig, err := s.registry.GetSignatureProvider(algorithm); err == nil {
+		provider = sig
+	} else {
+		return nil, unsupported(algorithm)
+	}
+
+	keyPair, err := provider.KeyGen(ctx)
+	if err != nil {
+		return nil, cryptoStatus("key generation failed", err)
+	}
+	return &pb.KeyGenResponse{
+		Algorithm:  string(keyPair.Algorithm),
+		PublicKey:  keyPair.PublicKey,
+		PrivateKey: keyPair.PrivateKey,
+	}, nil
+}
+
+// Encapsulate generates a shared secret for a public key
+func (s *CryptoServiceServer) Encapsulate(ctx context.Context, req *pb.EncapsulateRequest) (*pb.EncapsulateResponse, error) {
+	provider, err := s.kemProvider(req.GetAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+	return encapsulate(ctx, provider, req)
+}
+
+// Decapsulate recovers a shared secret from a ciphertext
+func (s *CryptoServiceServer) Decapsulate(ctx context.Context, req *pb.DecapsulateRequest) (*pb.DecapsulateResponse, error) {
+	provider, err := s.kemProvider(req.GetAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+	return decapsulate(ctx, provider, req)
+}
+
+// Sign signs a message
+func (s *CryptoServiceServer) Sign(ctx context.Context, req *pb.SignRequest) (*pb.SignResponse, error) {
+	provider, err := s.signatureProvider(req.GetAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(req.GetPrivateKey())
+	signature, err := provider.Sign(ctx, req.GetPrivateKey(), req.GetMessage())
+	if err != nil {
+		return nil, cryptoStatus("signing failed", err)
+	}
+	return &pb.SignResponse{Signature: signature}, nil
+}
+
+// Verify checks a signature
+func (s *CryptoServiceServer) Verify(ctx context.Context, req *pb.VerifyRequest) (*pb.VerifyResponse, error) {
+	provider, err := s.signatureProvider(req.GetAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+	valid, err := provider.Verify(ctx, req.GetPublicKey(), req.GetMessage(), req.GetSignature())
+	if err != nil {
+		return nil, cryptoStatus("verification failed", err)
+	}
+	return &pb.VerifyResponse{Valid: valid}, nil
+}
+
+// StreamEncapsulate encapsulates every request on the stream. The first
+// failure ends the stream with its error.
+func (s *CryptoServiceServer) StreamEncapsulate(stream grpc.ClientStreamingServer[pb.EncapsulateRequest, pb.StreamEncapsulateResponse]) error {
+	results := []*pb.EncapsulateResponse{}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.StreamEncapsulateResponse{Results: results})
+		}
+		if err != nil {
+			return err
+		}
+
+		provider, err := s.kemProvider(req.GetAlgorithm())
+		if err != nil {
+			return err
+		}
+		result, err := encapsulate(stream.Context(), provider, req)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+}
+
+// StreamDecapsulate decapsulates every request on the stream. The first
+// failure ends the stream with its error.
+func (s *CryptoServiceServer) StreamDecapsulate(stream grpc.ClientStreamingServer[pb.DecapsulateRequest, pb.StreamDecapsulateResponse]) error {
+	results := []*pb.DecapsulateResponse{}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.StreamDecapsulateResponse{Results: results})
+		}
+		if err != nil {
+			return err
+		}
+
+		provider, err := s.kemProvider(req.GetAlgorithm())
+		if err != nil {
+			return err
+		}
+		result, err := decapsulate(stream.Context(), provider, req)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+}
+
+// kemProvider returns the KEM provider for an algorithm, or an InvalidArgument status
+func (s *CryptoServiceServer) kemProvider(name string) (crypto.KEMProvider, error) {
+	provider, err := s.registry.GetKEMProvider(crypto.Algorithm(name))
+	if err != nil {
+		return nil, unsupported(crypto.Algorithm(name))
+	}
+	return provider, nil
+}
+
+// signatureProvider returns the signature provider for an algorithm, or an InvalidArgument status
+func (s *CryptoServiceServer) signatureProvider(name string) (crypto.SignatureProvider, error) {
+	provider, err := s.registry.GetSignatureProvider(crypto.Algorithm(name))
+	if err != nil {
+		return nil, unsupported(crypto.Algorithm(name))
+	}
+	return provider, nil
+}
+
+// encapsulate runs a single encapsulation
+func encapsulate(ctx context.Context, provider crypto.KEMProvider, req *pb.EncapsulateRequest) (*pb.EncapsulateResponse, error) {
+	ciphertext, sharedSecret, err := provider.Encapsulate(ctx, req.GetPublicKey())
+	if err != nil {
+		return nil, cryptoStatus("encapsulation failed", err)
+	}
+	return &pb.EncapsulateResponse{Ciphertext: ciphertext, SharedSecret: sharedSecret}, nil
+}
+
+// decapsulate runs a single decapsulation and zeroes the request's private key
+func decapsulate(ctx context.Context, provider crypto.KEMProvider, req *pb.DecapsulateRequest) (*pb.DecapsulateResponse, error) {
+	defer crypto.ZeroBytes(req.GetPrivateKey())
+	sharedSecret, err := provider.Decapsulate(ctx, req.GetPrivateKey(), req.GetCiphertext())
+	if err != nil {
+		return nil, cryptoStatus("decapsulation failed", err)
+	}
+	return &pb.DecapsulateResponse{SharedSecret: sharedSecret}, nil
+}
+
+// unsupported is the status returned for an unknown algorithm
+func unsupported(algorithm crypto.Algorithm) error {
+	return status.Errorf(codes.InvalidArgument, "unsupported algorithm: %s", algorithm)
+}
+
+// cryptoStatus translates a provider error into a gRPC status, in the same way
+// the HTTP API maps them to status codes
+func cryptoStatus(message string, err error) error {
+	code := codes.Internal
+
+	var cryptoErr *crypto.CryptoError
+	if errors.As(err, &cryptoErr) {
+		switch cryptoErr.Code {
+		case crypto.ErrCodeInvalidKey, crypto.ErrCodeInvalidInput:
+			code = codes.InvalidArgument
+		case crypto.ErrCodeUnsupported:
+			code = codes.Unimplemented
+		case crypto.ErrCodeCanceled:
+			code = codes.Canceled
+			if errors.Is(err, context.DeadlineExceeded) {
+				code = codes.DeadlineExceeded
+			}
+		}
+	}
+	return status.Errorf(code, "%s: %v", message, err)
+}
@@ -8,22 +8,30 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
-	"github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 
 	"pqcd/api"
+	"pqcd/benchmark"
+	"pqcd/crypto"
+	pqcdgrpc "pqcd/grpc"
 	"pqcd/security"
+	"pqcd/server"
 )
 
 func main() {
 	// Parse command line flags
 	var (
 		port        = flag.Int("port", 8082, "Port to listen on")
+		tlsPort     = flag.Int("tls-port", 0, "Port to serve HTTPS on, keeping plain HTTP on -port (default: HTTPS on -port)")
 		enableAI    = flag.Bool("enable-ai", false, "Enable AI threat detection")
 		logLevel    = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+		dbPath      = flag.String("db", "pqcd.db", "Path to the SQLite key store")
+		algWarning  = flag.Bool("algorithm-warning", true, "Warn callers generating keys for algorithms with large public keys, such as Classic McEliece")
+		anomalyConf = flag.String("anomaly-config", "anomaly_config.yaml", "Path to the anomaly detection thresholds, reloaded when the file changes")
+		plugins     = flag.String("plugins", "", "Comma-separated provider plugins (.so) to load into the crypto registry")
 	)
 	flag.Parse()
 
@@ -35,43 +43,144 @@ func main() {
 	logrus.SetLevel(level)
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 
-	// Create router
-	r := mux.NewRouter()
+	// Initialize tracing
+	tracerProvider, err := api.InitTracerProvider(context.Background())
+	if err != nil {
+		logrus.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
+	// Open the key store
+	keyStore, err := api.OpenKeyStore(*dbPath)
+	if err != nil {
+		logrus.Fatalf("Failed to open key store: %v", err)
+	}
+	defer keyStore.Close()
 
-	// Initialize API routes
-	api.RegisterRoutes(r)
+	// Anomaly thresholds can also be tuned through the config file without a
+	// restart
+	detector := security.NewAnomalyDetector()
+	if stop, err := detector.WatchThresholds(*anomalyConf); err != nil {
+		logrus.WithError(err).Warn("Anomaly config will not be reloaded, using the current thresholds")
+	} else {
+		defer stop()
+	}
+	
+	// Keep the trained baseline across restarts, so detection doesn't have to
+	// wait for a fresh one
+	if statePath := os.Getenv("ANOMALY_STATE_PATH"); statePath != "" {
+		defer detector.PersistState(statePath)()
+	}
+	
+	// Cross-origin requests are allowed from the CORS_* settings
+	corsConfig, err := server.CORSConfigFromEnv()
+	if err != nil {
+		logrus.Fatalf("Failed to configure CORS: %v", err)
+	}
 	
-	// Initialize AI security if enabled
 	if *enableAI {
 		logrus.Info("Initializing AI security layer")
-		aiHandler := security.NewAISecurityMiddleware()
-		r.Use(aiHandler.Middleware)
 	}
-
-	// Configure CORS
-	corsHandler := handlers.CORS(
-		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}),
-		handlers.ExposedHeaders([]string{"X-Anomaly-Detected", "X-Anomaly-Score"}),
-	)
+	r, err := server.NewRouter(server.Deps{
+		KeyStore:          keyStore,
+		Detector:          detector,
+		AlgorithmWarnings: *algWarning,
+		EnableAI:          *enableAI,
+		CORS:              &corsConfig,
+	})
+	if err != nil {
+		logrus.Fatalf("Failed to initialize routes: %v", err)
+	}
+	handler := r.API
+	
+	// Providers from plugins replace the compiled-in ones for their algorithms
+	for _, path := range strings.Split(*plugins, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if err := handler.Registry().LoadPlugin(path); err != nil {
+			logrus.Fatalf("Failed to load provider plugin: %v", err)
+		}
+		logrus.WithField("path", path).Info("Provider plugin loaded")
+	}
 	
-	// Configure server
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", *port),
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
-		Handler:      corsHandler(r),
+	// Keys written to the key store are encrypted the same way as the backend's
+	if masterKey := os.Getenv("STORAGE_MASTER_KEY"); masterKey != "" {
+		encryptor, err := crypto.NewKeyEncryptor(masterKey)
+		if err != nil {
+			logrus.Fatalf("Failed to create key encryptor: %v", err)
+		}
+		handler.SetKeyEncryptor(encryptor)
+	} else {
+		logrus.Warn("STORAGE_MASTER_KEY is not set, key rotation, export and import are disabled")
 	}
-
-	// Start server in a goroutine
+	
+	// Alert operators when an operation's latency goes over its goal
+	if spec := os.Getenv("SLA_GOALS"); spec != "" {
+		goals, err := benchmark.ParseSLAGoals(spec)
+		if err != nil {
+			logrus.Fatalf("Failed to parse SLA_GOALS: %v", err)
+		}
+		for _, goal := range goals {
+			handler.Metrics().SetSLAGoal(goal.Algorithm, goal.Operation, goal.MaxLatencyUs)
+		}
+	}
+	if alerter := security.NewWebhookAlerterFromEnv(); alerter != nil {
+		handler.Metrics().SetAlertFunc(func(alg crypto.Algorithm, operation string, actual, goal float64) {
+			if err := alerter.DispatchSLABreach(string(alg), operation, actual, goal); err != nil {
+				logrus.WithError(err).Error("Failed to send SLA alert")
+			}
+		})
+	}
+	defer handler.Metrics().StartSLAChecker()()
+	
+	// Serve the crypto operations over gRPC as well, sharing the registry and metrics
+	grpcServer := pqcdgrpc.NewServer(handler.Registry(), handler.Metrics())
 	go func() {
-		logrus.Infof("Server starting on port %d", *port)
-		if err := srv.ListenAndServe(); err != nil {
-			if err != http.ErrServerClosed {
-				logrus.Fatalf("Failed to start server: %v", err)
+		if err := pqcdgrpc.Serve(grpcServer, pqcdgrpc.Port()); err != nil {
+			logrus.Fatalf("Failed to start gRPC server: %v", err)
+		}
+	}()
+	
+	// Configure TLS
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		logrus.Fatalf("Failed to configure TLS: %v", err)
+	}
+
+	// Configure servers. HTTPS runs on -port unless -tls-port is given, in which
+	// case plain HTTP stays on -port for health checks.
+	newServer := func(listenPort int) *http.Server {
+		return &http.Server{
+			Addr:         fmt.Sprintf(":%d", listenPort),
+			WriteTimeout: time.Second * 15,
+			ReadTimeout:  time.Second * 15,
+			IdleTimeout:  time.Second * 60,
+			Handler:      r.WithCORS(),
+		}
+	}
+	servers := []*http.Server{}
+
+	httpsPort := *port
+	if *tlsPort != 0 {
+		httpsPort = *tlsPort
+		httpSrv := newServer(*port)
+		servers = append(servers, httpSrv)
+		go func() {
+			logrus.Infof("HTTP server starting on port %d", *port)
+			if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logrus.Fatalf("Failed to start HTTP server: %v", err)
 			}
+		}()
+	}
+
+	tlsSrv := newServer(httpsPort)
+	tlsSrv.TLSConfig = tlsConfig
+	servers = append(servers, tlsSrv)
+	go func() {
+		logrus.Infof("HTTPS server starting on port %d", httpsPort)
+		// The certificate is already in TLSConfig
+		if err := tlsSrv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			logrus.Fatalf("Failed to start HTTPS server: %v", err)
 		}
 	}()
 
@@ -83,6 +192,10 @@ func main() {
 	// Shutdown gracefully
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
-	srv.Shutdown(ctx)
+	for _, srv := range servers {
+		srv.Shutdown(ctx)
+	}
+	grpcServer.GracefulStop()
+	tracerProvider.Shutdown(ctx)
 	logrus.Info("Server shutdown complete")
 } 
\ No newline at end of file
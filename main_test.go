@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerateSelfSignedCert(t *testing.T) {
+	certPEM, keyPEM, err := generateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	if leaf.PublicKeyAlgorithm != x509.ECDSA {
+		t.Errorf("Expected ECDSA key, got %v", leaf.PublicKeyAlgorithm)
+	}
+	validity := leaf.NotAfter.Sub(leaf.NotBefore)
+	if validity < selfSignedValidity || validity > selfSignedValidity+time.Hour {
+		t.Errorf("Expected validity of about one year, got %v", validity)
+	}
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("Expected certificate to be valid for localhost: %v", err)
+	}
+}
+
+func TestTLSServerResponds(t *testing.T) {
+	t.Setenv("TLS_CERT", "")
+	t.Setenv("TLS_KEY", "")
+
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		t.Fatalf("Failed to configure TLS: %v", err)
+	}
+	assertServesHTTPS(t, tlsConfig)
+}
+
+func TestTLSServerWithCertFiles(t *testing.T) {
+	certPEM, keyPEM, err := generateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	t.Setenv("TLS_CERT", certFile)
+	t.Setenv("TLS_KEY", keyFile)
+
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		t.Fatalf("Failed to configure TLS: %v", err)
+	}
+	assertServesHTTPS(t, tlsConfig)
+}
+
+func TestLoadTLSConfigRequiresBothFiles(t *testing.T) {
+	t.Setenv("TLS_CERT", "cert.pem")
+	t.Setenv("TLS_KEY", "")
+
+	if _, err := loadTLSConfig(); err == nil {
+		t.Errorf("Expected error when only TLS_CERT is set")
+	}
+}
+
+// assertServesHTTPS starts a TLS server with the given config and checks that
+// it answers an HTTPS request
+func assertServesHTTPS(t *testing.T, tlsConfig *tls.Config) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "ok")
+		}),
+		TLSConfig: tlsConfig,
+	}
+	go srv.ServeTLS(ln, "", "")
+	defer srv.Close()
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.TLS == nil {
+		t.Errorf("Expected a TLS connection")
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("Expected 200 ok, got %d %q", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,4 @@
+// Package pqcdpb holds the generated gRPC stubs for the crypto service.
+package pqcdpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pqcd.proto
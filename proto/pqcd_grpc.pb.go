@@ -0,0 +1,360 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: pqcd.proto
+
+package pqcdpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CryptoService_KeyGen_FullMethodName            = "/pqcd.v1.CryptoService/KeyGen"
+	CryptoService_Encapsulate_FullMethodName       = "/pqcd.v1.CryptoService/Encapsulate"
+	CryptoService_Decapsulate_FullMethodName       = "/pqcd.v1.CryptoService/Decapsulate"
+	CryptoService_Sign_FullMethodName              = "/pqcd.v1.CryptoService/Sign"
+	CryptoService_Verify_FullMethodName            = "/pqcd.v1.CryptoService/Verify"
+	CryptoService_StreamEncapsulate_FullMethodName = "/pqcd.v1.CryptoService/StreamEncapsulate"
+	CryptoService_StreamDecapsulate_FullMethodName = "/pqcd.v1.CryptoService/StreamDecapsulate"
+)
+
+// CryptoServiceClient is the client API for CryptoService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CryptoService exposes the same post-quantum and classical operations as the
+// HTTP API. Algorithms use the HTTP API names, for example "ml-kem-768".
+type CryptoServiceClient interface {
+	// KeyGen generates a key pair
+	KeyGen(ctx context.Context, in *KeyGenRequest, opts ...grpc.CallOption) (*KeyGenResponse, error)
+	// Encapsulate generates a shared secret for a public key
+	Encapsulate(ctx context.Context, in *EncapsulateRequest, opts ...grpc.CallOption) (*EncapsulateResponse, error)
+	// Decapsulate recovers a shared secret from a ciphertext
+	Decapsulate(ctx context.Context, in *DecapsulateRequest, opts ...grpc.CallOption) (*DecapsulateResponse, error)
+	// Sign signs a message
+	Sign(ctx context.Context, in *SignRequest, opts ...grpc.CallOption) (*SignResponse, error)
+	// Verify checks a signature
+	Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error)
+	// StreamEncapsulate encapsulates every request on the stream and returns
+	// the results in the order they were sent
+	StreamEncapsulate(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[EncapsulateRequest, StreamEncapsulateResponse], error)
+	// StreamDecapsulate decapsulates every request on the stream and returns
+	// the results in the order they were sent
+	StreamDecapsulate(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DecapsulateRequest, StreamDecapsulateResponse], error)
+}
+
+type cryptoServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCryptoServiceClient(cc grpc.ClientConnInterface) CryptoServiceClient {
+	return &cryptoServiceClient{cc}
+}
+
+func (c *cryptoServiceClient) KeyGen(ctx context.Context, in *KeyGenRequest, opts ...grpc.CallOption) (*KeyGenResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyGenResponse)
+	err := c.cc.Invoke(ctx, CryptoService_KeyGen_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cryptoServiceClient) Encapsulate(ctx context.Context, in *EncapsulateRequest, opts ...grpc.CallOption) (*EncapsulateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EncapsulateResponse)
+	err := c.cc.Invoke(ctx, CryptoService_Encapsulate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cryptoServiceClient) Decapsulate(ctx context.Context, in *DecapsulateRequest, opts ...grpc.CallOption) (*DecapsulateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DecapsulateResponse)
+	err := c.cc.Invoke(ctx, CryptoService_Decapsulate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cryptoServiceClient) Sign(ctx context.Context, in *SignRequest, opts ...grpc.CallOption) (*SignResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SignResponse)
+	err := c.cc.Invoke(ctx, CryptoService_Sign_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cryptoServiceClient) Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VerifyResponse)
+	err := c.cc.Invoke(ctx, CryptoService_Verify_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cryptoServiceClient) StreamEncapsulate(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[EncapsulateRequest, StreamEncapsulateResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CryptoService_ServiceDesc.Streams[0], CryptoService_StreamEncapsulate_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EncapsulateRequest, StreamEncapsulateResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CryptoService_StreamEncapsulateClient = grpc.ClientStreamingClient[EncapsulateRequest, StreamEncapsulateResponse]
+
+func (c *cryptoServiceClient) StreamDecapsulate(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DecapsulateRequest, StreamDecapsulateResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CryptoService_ServiceDesc.Streams[1], CryptoService_StreamDecapsulate_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DecapsulateRequest, StreamDecapsulateResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CryptoService_StreamDecapsulateClient = grpc.ClientStreamingClient[DecapsulateRequest, StreamDecapsulateResponse]
+
+// CryptoServiceServer is the server API for CryptoService service.
+// All implementations must embed UnimplementedCryptoServiceServer
+// for forward compatibility.
+//
+// CryptoService exposes the same post-quantum and classical operations as the
+// HTTP API. Algorithms use the HTTP API names, for example "ml-kem-768".
+type CryptoServiceServer interface {
+	// KeyGen generates a key pair
+	KeyGen(context.Context, *KeyGenRequest) (*KeyGenResponse, error)
+	// Encapsulate generates a shared secret for a public key
+	Encapsulate(context.Context, *EncapsulateRequest) (*EncapsulateResponse, error)
+	// Decapsulate recovers a shared secret from a ciphertext
+	Decapsulate(context.Context, *DecapsulateRequest) (*DecapsulateResponse, error)
+	// Sign signs a message
+	Sign(context.Context, *SignRequest) (*SignResponse, error)
+	// Verify checks a signature
+	Verify(context.Context, *VerifyRequest) (*VerifyResponse, error)
+	// StreamEncapsulate encapsulates every request on the stream and returns
+	// the results in the order they were sent
+	StreamEncapsulate(grpc.ClientStreamingServer[EncapsulateRequest, StreamEncapsulateResponse]) error
+	// StreamDecapsulate decapsulates every request on the stream and returns
+	// the results in the order they were sent
+	StreamDecapsulate(grpc.ClientStreamingServer[DecapsulateRequest, StreamDecapsulateResponse]) error
+	mustEmbedUnimplementedCryptoServiceServer()
+}
+
+// UnimplementedCryptoServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCryptoServiceServer struct{}
+
+func (UnimplementedCryptoServiceServer) KeyGen(context.Context, *KeyGenRequest) (*KeyGenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KeyGen not implemented")
+}
+func (UnimplementedCryptoServiceServer) Encapsulate(context.Context, *EncapsulateRequest) (*EncapsulateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Encapsulate not implemented")
+}
+func (UnimplementedCryptoServiceServer) Decapsulate(context.Context, *DecapsulateRequest) (*DecapsulateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Decapsulate not implemented")
+}
+func (UnimplementedCryptoServiceServer) Sign(context.Context, *SignRequest) (*SignResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sign not implemented")
+}
+func (UnimplementedCryptoServiceServer) Verify(context.Context, *VerifyRequest) (*VerifyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedCryptoServiceServer) StreamEncapsulate(grpc.ClientStreamingServer[EncapsulateRequest, StreamEncapsulateResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEncapsulate not implemented")
+}
+func (UnimplementedCryptoServiceServer) StreamDecapsulate(grpc.ClientStreamingServer[DecapsulateRequest, StreamDecapsulateResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamDecapsulate not implemented")
+}
+func (UnimplementedCryptoServiceServer) mustEmbedUnimplementedCryptoServiceServer() {}
+func (UnimplementedCryptoServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeCryptoServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CryptoServiceServer will
+// result in compilation errors.
+type UnsafeCryptoServiceServer interface {
+	mustEmbedUnimplementedCryptoServiceServer()
+}
+
+func RegisterCryptoServiceServer(s grpc.ServiceRegistrar, srv CryptoServiceServer) {
+	// If the following call pancis, it indicates UnimplementedCryptoServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CryptoService_ServiceDesc, srv)
+}
+
+func _CryptoService_KeyGen_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyGenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CryptoServiceServer).KeyGen(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CryptoService_KeyGen_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CryptoServiceServer).KeyGen(ctx, req.(*KeyGenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CryptoService_Encapsulate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EncapsulateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CryptoServiceServer).Encapsulate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CryptoService_Encapsulate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CryptoServiceServer).Encapsulate(ctx, req.(*EncapsulateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CryptoService_Decapsulate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DecapsulateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CryptoServiceServer).Decapsulate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CryptoService_Decapsulate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CryptoServiceServer).Decapsulate(ctx, req.(*DecapsulateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CryptoService_Sign_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CryptoServiceServer).Sign(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CryptoService_Sign_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CryptoServiceServer).Sign(ctx, req.(*SignRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CryptoService_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CryptoServiceServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CryptoService_Verify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CryptoServiceServer).Verify(ctx, req.(*VerifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CryptoService_StreamEncapsulate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CryptoServiceServer).StreamEncapsulate(&grpc.GenericServerStream[EncapsulateRequest, StreamEncapsulateResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CryptoService_StreamEncapsulateServer = grpc.ClientStreamingServer[EncapsulateRequest, StreamEncapsulateResponse]
+
+func _CryptoService_StreamDecapsulate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CryptoServiceServer).StreamDecapsulate(&grpc.GenericServerStream[DecapsulateRequest, StreamDecapsulateResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CryptoService_StreamDecapsulateServer = grpc.ClientStreamingServer[DecapsulateRequest, StreamDecapsulateResponse]
+
+// CryptoService_ServiceDesc is the grpc.ServiceDesc for CryptoService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CryptoService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pqcd.v1.CryptoService",
+	HandlerType: (*CryptoServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "KeyGen",
+			Handler:    _CryptoService_KeyGen_Handler,
+		},
+		{
+			MethodName: "Encapsulate",
+			Handler:    _CryptoService_Encapsulate_Handler,
+		},
+		{
+			MethodName: "Decapsulate",
+			Handler:    _CryptoService_Decapsulate_Handler,
+		},
+		{
+			MethodName: "Sign",
+			Handler:    _CryptoService_Sign_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _CryptoService_Verify_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEncapsulate",
+			Handler:       _CryptoService_StreamEncapsulate_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamDecapsulate",
+			Handler:       _CryptoService_StreamDecapsulate_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pqcd.proto",
+}
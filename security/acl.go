@@ -0,0 +1,170 @@
+package security
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// aclEventType is the event_logs event type used to persist list updates
+const aclEventType = "acl_update"
+
+// Names of the persisted lists, stored as the event's related_item_type
+const (
+	aclAllowlist = "allowlist"
+	aclBlocklist = "blocklist"
+)
+
+// AccessControl owns the allowlist and blocklist and serves their admin endpoints.
+// Every update is written to event_logs, and the latest lists are restored from
+// there on startup.
+type AccessControl struct {
+	Allowlist *IPList
+	Blocklist *IPList
+	db        *sql.DB
+}
+
+// ACLResponse lists the ranges currently in an access control list
+type ACLResponse struct {
+	Entries []string `json:"entries"`
+}
+
+// NewAccessControl creates empty lists, restoring them from db when it is not nil
+func NewAccessControl(db *sql.DB) *AccessControl {
+	a := &AccessControl{
+		Allowlist: NewIPList(),
+		Blocklist: NewIPList(),
+		db:        db,
+	}
+	if db == nil {
+		return a
+	}
+
+	for _, statement := range threatStoreSchema {
+		if _, err := db.Exec(statement); err != nil {
+			logrus.WithError(err).Error("Failed to migrate access control schema")
+		}
+	}
+	a.restore(aclAllowlist, a.Allowlist)
+	a.restore(aclBlocklist, a.Blocklist)
+	return a
+}
+
+// restore loads the most recently persisted entries of a list
+func (a *AccessControl) restore(name string, list *IPList) {
+	var description string
+	err := a.db.QueryRow(
+		"SELECT description FROM event_logs WHERE event_type = ? AND related_item_type = ? ORDER BY id DESC LIMIT 1",
+		aclEventType, name,
+	).Scan(&description)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("list", name).Error("Failed to load access control list")
+		return
+	}
+
+	var entries []string
+	if err := json.Unmarshal([]byte(description), &entries); err != nil {
+		logrus.WithError(err).WithField("list", name).Error("Failed to decode access control list")
+		return
+	}
+	if err := list.Replace(entries); err != nil {
+		logrus.WithError(err).WithField("list", name).Error("Persisted access control list is invalid")
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"list":    name,
+		"entries": len(entries),
+	}).Info("Access control list restored")
+}
+
+// persist records the current entries of a list in event_logs
+func (a *AccessControl) persist(name string, list *IPList, sourceIP string) error {
+	if a.db == nil {
+		return nil
+	}
+	data, err := json.Marshal(list.Entries())
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	_, err = a.db.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, related_item_type) VALUES (?, ?, ?, ?, ?)",
+		aclEventType, string(data), sourceIP, "WARNING", name,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to persist %s: %w", name, err)
+	}
+	return nil
+}
+
+// RegisterRoutes adds the admin endpoints to a router mounted at /api/admin
+func (a *AccessControl) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/allowlist", a.HandleReplace(aclAllowlist, a.Allowlist)).Methods("PUT")
+	r.HandleFunc("/blocklist", a.HandleReplace(aclBlocklist, a.Blocklist)).Methods("PUT")
+	r.HandleFunc("/blocklist/{ip}", a.HandleRemove(aclBlocklist, a.Blocklist)).Methods("DELETE")
+}
+
+// HandleReplace replaces a list with the JSON array of CIDR ranges in the request body
+func (a *AccessControl) HandleReplace(name string, list *IPList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var cidrs []string
+		if err := json.NewDecoder(r.Body).Decode(&cidrs); err != nil {
+			writeACLError(w, http.StatusBadRequest, "request body must be a JSON array of CIDR ranges")
+			return
+		}
+		if err := list.Replace(cidrs); err != nil {
+			writeACLError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"list":    name,
+			"entries": len(cidrs),
+		}).Warn("Access control list replaced")
+		if err := a.persist(name, list, peerIP(r)); err != nil {
+			RequestLogger(r.Context()).WithError(err).Error("Failed to persist access control list")
+		}
+
+		writeACLResponse(w, list)
+	}
+}
+
+// HandleRemove removes the address in the {ip} path variable from a list
+func (a *AccessControl) HandleRemove(name string, list *IPList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := mux.Vars(r)["ip"]
+		if !list.Remove(ip) {
+			writeACLError(w, http.StatusNotFound, fmt.Sprintf("%s is not in the %s", ip, name))
+			return
+		}
+
+		RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"list": name,
+			"ip":   ip,
+		}).Warn("Access control entry removed")
+		if err := a.persist(name, list, peerIP(r)); err != nil {
+			RequestLogger(r.Context()).WithError(err).Error("Failed to persist access control list")
+		}
+
+		writeACLResponse(w, list)
+	}
+}
+
+// writeACLResponse writes the current entries of a list
+func writeACLResponse(w http.ResponseWriter, list *IPList) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ACLResponse{Entries: list.Entries()})
+}
+
+// writeACLError writes a JSON error response
+func writeACLError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
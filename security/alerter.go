@@ -0,0 +1,163 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Webhook delivery settings
+const (
+	alertTimeout        = 5 * time.Second // Per delivery attempt
+	alertAttempts       = 3
+	alertInitialBackoff = time.Second // Doubled after each failed attempt
+)
+
+// alertSignatureHeader carries the hex HMAC-SHA256 of the request body
+const alertSignatureHeader = "X-Signature-256"
+
+// WebhookAlerter posts critical threats and SLA breaches to an operator
+// webhook. Each payload is signed with HMAC-SHA256 so the receiver can check it
+// came from us.
+type WebhookAlerter struct {
+	url     string
+	secret  string
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewWebhookAlerter creates an alerter that posts to url, signing with secret
+func NewWebhookAlerter(url, secret string) *WebhookAlerter {
+	return &WebhookAlerter{
+		url:     url,
+		secret:  secret,
+		client:  &http.Client{},
+		backoff: alertInitialBackoff,
+	}
+}
+
+// NewWebhookAlerterFromEnv creates an alerter from ALERT_WEBHOOK_URL and
+// ALERT_WEBHOOK_SECRET, or returns nil if no URL is configured
+func NewWebhookAlerterFromEnv() *WebhookAlerter {
+	url := os.Getenv("ALERT_WEBHOOK_URL")
+	if url == "" {
+		return nil
+	}
+	secret := os.Getenv("ALERT_WEBHOOK_SECRET")
+	if secret == "" {
+		logrus.Warn("ALERT_WEBHOOK_SECRET is not set, webhook alerts will be signed with an empty key")
+	}
+	return NewWebhookAlerter(url, secret)
+}
+
+// Dispatch sends a threat to the webhook in the background, retrying failed
+// deliveries with exponential backoff. It only returns an error if the threat
+// cannot be encoded; delivery failures are logged.
+func (a *WebhookAlerter) Dispatch(threat Threat) error {
+	payload, err := json.Marshal(threat)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	go func() {
+		if err := a.deliver(payload); err != nil {
+			logrus.WithError(err).WithField("ip", threat.IP).Error("Failed to deliver threat alert")
+		}
+	}()
+	return nil
+}
+
+// SLABreachAlert is the payload posted when an operation's average latency
+// exceeds its goal
+type SLABreachAlert struct {
+	Type            string    `json:"type"` // Always "sla_breach", to tell it apart from threats
+	Algorithm       string    `json:"algorithm"`
+	Operation       string    `json:"operation"`
+	ActualLatencyUs float64   `json:"actual_latency_us"`
+	GoalLatencyUs   float64   `json:"goal_latency_us"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// DispatchSLABreach sends an SLA breach to the webhook in the background, the
+// same way as Dispatch
+func (a *WebhookAlerter) DispatchSLABreach(algorithm, operation string, actualUs, goalUs float64) error {
+	payload, err := json.Marshal(SLABreachAlert{
+		Type:            "sla_breach",
+		Algorithm:       algorithm,
+		Operation:       operation,
+		ActualLatencyUs: actualUs,
+		GoalLatencyUs:   goalUs,
+		Timestamp:       time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	go func() {
+		if err := a.deliver(payload); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"algorithm": algorithm,
+				"operation": operation,
+			}).Error("Failed to deliver SLA alert")
+		}
+	}()
+	return nil
+}
+
+// deliver posts a payload, making up to alertAttempts attempts
+func (a *WebhookAlerter) deliver(payload []byte) error {
+	backoff := a.backoff
+	var err error
+	for attempt := 1; attempt <= alertAttempts; attempt++ {
+		if err = a.post(payload); err == nil {
+			return nil
+		}
+		logrus.WithError(err).WithField("attempt", attempt).Warn("Alert delivery failed")
+		if attempt < alertAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", alertAttempts, err)
+}
+
+// post makes a single signed delivery attempt
+func (a *WebhookAlerter) post(payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(alertSignatureHeader, "sha256="+signPayload(a.secret, payload))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("webhook returned " + resp.Status)
+	}
+	return nil
+}
+
+// signPayload returns the hex HMAC-SHA256 of a payload
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
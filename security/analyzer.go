@@ -20,8 +20,31 @@ type AnalysisResponse struct {
 	Timestamp           string  `json:"timestamp"`
 }
 
+// analysisBreaker stops calls to the analysis service while it is unavailable
+var analysisBreaker = NewCircuitBreaker(defaultFailureThreshold, defaultResetTimeout)
+
+// AnalysisCircuitBreaker returns the circuit breaker guarding the analysis service
+func AnalysisCircuitBreaker() *CircuitBreaker {
+	return analysisBreaker
+}
+
 // AnalyzeRequest sends a log entry to the threat detection service and returns the analysis.
+// After repeated failures it returns ErrCircuitOpen without contacting the service.
 func AnalyzeRequest(logEntryJSON string) (*AnalysisResponse, error) {
+	var analysis *AnalysisResponse
+	err := analysisBreaker.Execute(func() error {
+		var err error
+		analysis, err = analyzeRequest(logEntryJSON)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
+
+// analyzeRequest performs a single call to the threat detection service
+func analyzeRequest(logEntryJSON string) (*AnalysisResponse, error) {
 	analysisURL := "http://localhost:5000/analyze"
 	req, err := http.NewRequest("POST", analysisURL, bytes.NewBuffer([]byte(logEntryJSON)))
 	if err != nil {
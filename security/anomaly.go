@@ -3,6 +3,7 @@ package security
 import (
 	"math"
 	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 )
@@ -16,25 +17,60 @@ type AnomalyDetector struct {
 	featureVariances  map[string]float64
 	numSamples        int
 	
-	// Thresholds for anomaly detection
-	entropyThreshold     float64
-	interRequestTimeThreshold float64
-	requestsPerMinuteThreshold int
-	sequenceThreshold    float64
+	// Running mean and co-moment matrix of the feature vector (Welford's algorithm)
+	vectorMean        [featureDimensions]float64
+	coMoments         [featureDimensions][featureDimensions]float64
+	
+	// Thresholds for anomaly detection, swapped whole so Detect reads them
+	// without taking the lock
+	thresholds atomic.Pointer[ThresholdConfig]
+	
+	// Known reconnaissance operation sequences
+	patterns *SequencePatternMatcher
 }
 
+// featureDimensions is the length of the vector used for Mahalanobis scoring:
+// input entropy, inter-request time, requests per minute and operation latency
+const featureDimensions = 4
+
+// defaultMahalanobisThreshold is the distance above which a request is flagged
+const defaultMahalanobisThreshold = 4.0
+
+// minBaselineSamples is how many training samples Detect needs before it
+// flags anything but reconnaissance sequences
+const minBaselineSamples = 10
+
+// covarianceRidge is added to the covariance diagonal when it is singular, for
+// example while a feature has only ever had one value
+const covarianceRidge = 1e-6
+
 // NewAnomalyDetector creates a new anomaly detector
 func NewAnomalyDetector() *AnomalyDetector {
-	return &AnomalyDetector{
+	d := &AnomalyDetector{
 		featureMeans:     make(map[string]float64),
 		featureVariances: make(map[string]float64),
 		numSamples:       0,
-		
-		// Set initial thresholds
-		entropyThreshold:     6.0,  // Lower entropy suggests non-random keys
-		interRequestTimeThreshold: 0.1,  // Very fast requests are suspicious
-		requestsPerMinuteThreshold: 20, // Too many requests per minute
-		sequenceThreshold:    3.0,  // Mahalanobis distance threshold
+		patterns:         NewSequencePatternMatcher(),
+	}
+	thresholds := DefaultThresholdConfig()
+	d.thresholds.Store(&thresholds)
+	return d
+}
+
+// SequencePatterns returns the matcher used to detect reconnaissance sequences
+func (d *AnomalyDetector) SequencePatterns() *SequencePatternMatcher {
+	return d.patterns
+}
+
+// SetMahalanobisThreshold changes the distance above which Detect flags a request
+func (d *AnomalyDetector) SetMahalanobisThreshold(threshold float64) {
+	for {
+		current := d.thresholds.Load()
+		updated := *current
+		updated.MahalanobisThreshold = threshold
+		if d.thresholds.CompareAndSwap(current, &updated) {
+			return
+		}
 	}
 }
 
@@ -46,6 +82,7 @@ func (d *AnomalyDetector) Train(features RequestFeatures) {
 	
 	d.numSamples++
 	alpha := 1.0 / float64(d.numSamples)
+	d.updateCovariance(featureVector(features))
 	
 	// Update means using incremental formula
 	updateMean(d.featureMeans, "input_entropy", features.InputEntropy, alpha)
@@ -69,26 +106,32 @@ func (d *AnomalyDetector) Train(features RequestFeatures) {
 
 // Detect checks if a request is anomalous
 func (d *AnomalyDetector) Detect(features RequestFeatures) (bool, string, float64) {
+	thresholds := d.thresholds.Load()
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 	
+	// Reconnaissance sequences are recognisable without a baseline
+	if _, confidence := d.patterns.matchAbove(features.OperationSequence, thresholds.SequenceThreshold); confidence > 0 {
+		return true, "ReconSequence", confidence
+	}
+	
 	// If we don't have enough samples for baseline, assume benign
-	if d.numSamples < 10 {
+	if d.numSamples < minBaselineSamples {
 		return false, "", 0.0
 	}
 	
 	// Check statistical features
-	if features.InputEntropy < d.entropyThreshold {
-		return true, "LowEntropy", d.entropyThreshold - features.InputEntropy
+	if features.InputEntropy < thresholds.EntropyThreshold {
+		return true, "LowEntropy", thresholds.EntropyThreshold - features.InputEntropy
 	}
 	
 	// Check temporal features
-	if features.InterRequestTime > 0 && features.InterRequestTime < d.interRequestTimeThreshold {
-		return true, "RapidRequests", d.interRequestTimeThreshold - features.InterRequestTime
+	if features.InterRequestTime > 0 && features.InterRequestTime < thresholds.InterRequestTimeThreshold {
+		return true, "RapidRequests", thresholds.InterRequestTimeThreshold - features.InterRequestTime
 	}
 	
-	if features.RequestsPerMinute > d.requestsPerMinuteThreshold {
-		return true, "HighFrequency", float64(features.RequestsPerMinute - d.requestsPerMinuteThreshold)
+	if features.RequestsPerMinute > thresholds.RequestsPerMinuteThreshold {
+		return true, "HighFrequency", float64(features.RequestsPerMinute - thresholds.RequestsPerMinuteThreshold)
 	}
 	
 	// Check for abnormal latency (potential side-channel attack)
@@ -97,14 +140,156 @@ func (d *AnomalyDetector) Detect(features RequestFeatures) (bool, string, float6
 		return true, "AbnormalLatency", math.Abs(latencyScore)
 	}
 	
-	// In a real system, we would also check sequence patterns, calculate Mahalanobis distance, etc.
+	// Check for combinations of features that are unusual together
+	if score := d.mahalanobisScore(features); score > thresholds.MahalanobisThreshold {
+		return true, "MultivariateOutlier", score
+	}
 	
 	// No anomaly detected
 	return false, "", 0.0
 }
 
+// baseline returns the number of training samples and copies of the per-feature
+// means and variances learned from them
+func (d *AnomalyDetector) baseline() (int, map[string]float64, map[string]float64) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	means := make(map[string]float64, len(d.featureMeans))
+	for feature, mean := range d.featureMeans {
+		means[feature] = mean
+	}
+	variances := make(map[string]float64, len(d.featureVariances))
+	for feature, variance := range d.featureVariances {
+		variances[feature] = variance
+	}
+	return d.numSamples, means, variances
+}
+
+// MahalanobisScore returns the Mahalanobis distance of a request's feature vector
+// from the trained distribution, or 0 until at least two samples have been seen
+func (d *AnomalyDetector) MahalanobisScore(features RequestFeatures) float64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.mahalanobisScore(features)
+}
+
+// mahalanobisScore is MahalanobisScore for callers already holding the lock
+func (d *AnomalyDetector) mahalanobisScore(features RequestFeatures) float64 {
+	if d.numSamples < 2 {
+		return 0
+	}
+	return mahalanobisDistance(featureVector(features), d.vectorMean, d.covariance())
+}
+
+// updateCovariance adds a sample to the running mean and co-moment matrix.
+// numSamples must already include the new sample.
+func (d *AnomalyDetector) updateCovariance(x [featureDimensions]float64) {
+	n := float64(d.numSamples)
+	var before [featureDimensions]float64
+	for i := range x {
+		before[i] = x[i] - d.vectorMean[i]
+		d.vectorMean[i] += before[i] / n
+	}
+	for i := range x {
+		after := x[i] - d.vectorMean[i]
+		for j := range x {
+			d.coMoments[j][i] += before[j] * after
+		}
+	}
+}
+
+// covariance returns the sample covariance matrix of the training data
+func (d *AnomalyDetector) covariance() [featureDimensions][featureDimensions]float64 {
+	var cov [featureDimensions][featureDimensions]float64
+	for i := range cov {
+		for j := range cov[i] {
+			cov[i][j] = d.coMoments[i][j] / float64(d.numSamples-1)
+		}
+	}
+	return cov
+}
+
 // Helper functions
 
+// featureVector returns the features used for Mahalanobis scoring
+func featureVector(features RequestFeatures) [featureDimensions]float64 {
+	return [featureDimensions]float64{
+		features.InputEntropy,
+		features.InterRequestTime,
+		float64(features.RequestsPerMinute),
+		features.OperationLatency,
+	}
+}
+
+// mahalanobisDistance calculates sqrt((x-mean)^T * cov^-1 * (x-mean))
+func mahalanobisDistance(x, mean [featureDimensions]float64, cov [featureDimensions][featureDimensions]float64) float64 {
+	inverse, ok := invertMatrix(cov)
+	if !ok {
+		for i := range cov {
+			cov[i][i] += covarianceRidge
+		}
+		if inverse, ok = invertMatrix(cov); !ok {
+			return 0
+		}
+	}
+	
+	var diff [featureDimensions]float64
+	for i := range x {
+		diff[i] = x[i] - mean[i]
+	}
+	
+	var sum float64
+	for i := range diff {
+		for j := range diff {
+			sum += diff[i] * inverse[i][j] * diff[j]
+		}
+	}
+	if sum < 0 {
+		return 0
+	}
+	return math.Sqrt(sum)
+}
+
+// invertMatrix inverts a matrix by Gauss-Jordan elimination with partial
+// pivoting, reporting false if it is singular
+func invertMatrix(m [featureDimensions][featureDimensions]float64) ([featureDimensions][featureDimensions]float64, bool) {
+	var inverse [featureDimensions][featureDimensions]float64
+	for i := range inverse {
+		inverse[i][i] = 1
+	}
+	
+	for col := 0; col < featureDimensions; col++ {
+		pivot := col
+		for row := col + 1; row < featureDimensions; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return inverse, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+		
+		scale := m[col][col]
+		for j := 0; j < featureDimensions; j++ {
+			m[col][j] /= scale
+			inverse[col][j] /= scale
+		}
+		for row := 0; row < featureDimensions; row++ {
+			if row == col {
+				continue
+			}
+			factor := m[row][col]
+			for j := 0; j < featureDimensions; j++ {
+				m[row][j] -= factor * m[col][j]
+				inverse[row][j] -= factor * inverse[col][j]
+			}
+		}
+	}
+	return inverse, true
+}
+
 // updateMean updates the running mean for a feature
 func updateMean(means map[string]float64, feature string, value float64, alpha float64) {
 	oldMean, exists := means[feature]
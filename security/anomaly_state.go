@@ -0,0 +1,165 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// anomalyStateInterval is how often PersistState saves the trained baseline
+const anomalyStateInterval = 5 * time.Minute
+
+// anomalyState is the trained baseline of an AnomalyDetector as exported. The
+// vector mean and co-moments behind Mahalanobis scoring are kept alongside the
+// per-feature statistics, since a restored sample count without them would
+// make every request look like an outlier.
+type anomalyState struct {
+	FeatureMeans     map[string]float64                            `json:"feature_means"`
+	FeatureVariances map[string]float64                            `json:"feature_variances"`
+	NumSamples       int                                           `json:"num_samples"`
+	VectorMean       [featureDimensions]float64                    `json:"vector_mean"`
+	CoMoments        [featureDimensions][featureDimensions]float64 `json:"co_moments"`
+}
+
+// Export serializes the trained baseline to JSON so it can survive a restart
+func (d *AnomalyDetector) Export() ([]byte, error) {
+	d.mu.RLock()
+	state := anomalyState{
+		FeatureMeans:     d.featureMeans,
+		FeatureVariances: d.featureVariances,
+		NumSamples:       d.numSamples,
+		VectorMean:       d.vectorMean,
+		CoMoments:        d.coMoments,
+	}
+	data, err := json.Marshal(state)
+	d.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to export anomaly state: %w", err)
+	}
+	return data, nil
+}
+
+// Import replaces the trained baseline with one produced by Export
+func (d *AnomalyDetector) Import(data []byte) error {
+	var state anomalyState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse anomaly state: %w", err)
+	}
+	if state.NumSamples < 0 {
+		return errors.New("invalid anomaly state: num_samples must not be negative")
+	}
+	if state.FeatureMeans == nil {
+		state.FeatureMeans = make(map[string]float64)
+	}
+	if state.FeatureVariances == nil {
+		state.FeatureVariances = make(map[string]float64)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.featureMeans = state.FeatureMeans
+	d.featureVariances = state.FeatureVariances
+	d.numSamples = state.NumSamples
+	d.vectorMean = state.VectorMean
+	d.coMoments = state.CoMoments
+	return nil
+}
+
+// Reset clears the trained baseline, leaving the thresholds and sequence
+// patterns as they are
+func (d *AnomalyDetector) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.featureMeans = make(map[string]float64)
+	d.featureVariances = make(map[string]float64)
+	d.numSamples = 0
+	d.vectorMean = [featureDimensions]float64{}
+	d.coMoments = [featureDimensions][featureDimensions]float64{}
+}
+
+// SaveState writes the trained baseline to a file. It is written to a
+// temporary file first and renamed into place, so a crash mid-write leaves the
+// previous state intact.
+func (d *AnomalyDetector) SaveState(path string) error {
+	data, err := d.Export()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save anomaly state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save anomaly state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save anomaly state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save anomaly state: %w", err)
+	}
+	return nil
+}
+
+// LoadState restores the trained baseline from a file written by SaveState
+func (d *AnomalyDetector) LoadState(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read anomaly state: %w", err)
+	}
+	return d.Import(data)
+}
+
+// PersistState restores the trained baseline from path if the file exists and
+// then saves it there every five minutes, and once more when stop is called.
+// A file that fails to load is logged and training starts afresh.
+func (d *AnomalyDetector) PersistState(path string) (stop func()) {
+	if _, err := os.Stat(path); err == nil {
+		if err := d.LoadState(path); err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Ignoring saved anomaly state")
+		} else {
+			logrus.WithField("path", path).Info("Anomaly detector baseline restored")
+		}
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(anomalyStateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.saveStateLogged(path)
+			case <-done:
+				d.saveStateLogged(path)
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+}
+
+// saveStateLogged saves the trained baseline, logging rather than returning
+// any failure
+func (d *AnomalyDetector) saveStateLogged(path string) {
+	if err := d.SaveState(path); err != nil {
+		logrus.WithError(err).WithField("path", path).Error("Failed to save anomaly state")
+	}
+}
@@ -0,0 +1,353 @@
+package security
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptCost is the work factor of stored password hashes
+const bcryptCost = 12
+
+// sessionTTL is how long a login session stays valid
+const sessionTTL = time.Hour
+
+// Password length limits. bcrypt ignores everything past 72 bytes.
+const (
+	minPasswordLength = 8
+	maxPasswordBytes  = 72
+)
+
+// loginPath is the only /api endpoint reachable without a token
+const loginPath = "/api/auth/login"
+
+// usernamePattern matches the accepted usernames
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// errUsernameTaken is returned when registering a username that already exists
+var errUsernameTaken = errors.New("username is already in use")
+
+// errInvalidCredentials is returned for an unknown user or a wrong password
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// usersSchema makes sure the users table exists. It mirrors database/schema.sql.
+var usersSchema = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_login TIMESTAMP,
+		role TEXT CHECK (role IN ('admin', 'user', 'readonly')) DEFAULT 'user'
+	)`,
+}
+
+// Authenticator registers users in the users table, checks their passwords and
+// starts and verifies the sessions that authenticate API requests. A session
+// is a row of the sessions table, and its random ID is the bearer token, so
+// unlike a stateless token it can be revoked before it expires.
+type Authenticator struct {
+	db *sql.DB
+
+	// Clock used for session expiry, replaceable in tests
+	now func() time.Time
+
+	// dummyHash is compared against when the user does not exist, so unknown
+	// usernames take as long to reject as wrong passwords
+	dummyOnce sync.Once
+	dummyHash []byte
+}
+
+// RegisterRequest is the request for registering a user. Role defaults to user.
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// LoginRequest carries a user's credentials
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResponse carries a login token
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewAuthenticator creates an authenticator for the users and sessions in db.
+// If db has no admin user and ADMIN_PASSWORD is set, an admin user with that
+// password is created.
+func NewAuthenticator(db *sql.DB) (*Authenticator, error) {
+	if db == nil {
+		return nil, errors.New("authenticator needs a database for its users and sessions")
+	}
+	a := &Authenticator{db: db, now: time.Now}
+
+	for _, statement := range append(usersSchema, sessionsSchema...) {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, fmt.Errorf("failed to create users schema: %w", err)
+		}
+	}
+	if err := a.bootstrapAdmin(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// bootstrapAdmin creates the admin user from ADMIN_PASSWORD when there is none
+func (a *Authenticator) bootstrapAdmin() error {
+	var admins int
+	if err := a.db.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", RoleAdmin).Scan(&admins); err != nil {
+		return fmt.Errorf("failed to check for admin users: %w", err)
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		logrus.Warn("No admin user exists. Set ADMIN_PASSWORD to create one")
+		return nil
+	}
+	if err := a.Register("admin", password, RoleAdmin); err != nil {
+		return fmt.Errorf("failed to create admin user: %w", err)
+	}
+	logrus.Info("Created admin user from ADMIN_PASSWORD")
+	return nil
+}
+
+// Register stores a new user with a bcrypt hash of password
+func (a *Authenticator) Register(username, password, role string) error {
+	if err := validateRegistration(username, password, role); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	_, err = a.db.Exec("INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?)", username, string(hash), role)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return errUsernameTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store user: %w", err)
+	}
+	return nil
+}
+
+// validateRegistration checks a new user's username, password and role
+func validateRegistration(username, password, role string) error {
+	if !usernamePattern.MatchString(username) {
+		return errors.New("username must be 1 to 64 letters, digits, '_', '.' or '-'")
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be %d to %d bytes long", minPasswordLength, maxPasswordBytes)
+	}
+	if _, ok := roleRanks[role]; !ok {
+		return errors.New("role must be admin, user or readonly")
+	}
+	return nil
+}
+
+// Login checks a user's password and starts a session for them, returning
+// its token
+func (a *Authenticator) Login(username, password string) (string, time.Time, error) {
+	var hash string
+	user := User{Name: username}
+	err := a.db.QueryRow("SELECT password_hash, COALESCE(role, ?) FROM users WHERE username = ?", RoleUser, username).Scan(&hash, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(a.unknownUserHash(), []byte(password))
+		return "", time.Time{}, errInvalidCredentials
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return "", time.Time{}, errInvalidCredentials
+	}
+
+	if _, err := a.db.Exec("UPDATE users SET last_login = CURRENT_TIMESTAMP WHERE username = ?", username); err != nil {
+		logrus.WithError(err).Warn("Failed to record last login")
+	}
+	return a.IssueToken(user)
+}
+
+// unknownUserHash returns a bcrypt hash no password matches
+func (a *Authenticator) unknownUserHash() []byte {
+	a.dummyOnce.Do(func() {
+		random := make([]byte, 16)
+		rand.Read(random)
+		a.dummyHash, _ = bcrypt.GenerateFromPassword([]byte(base64.RawStdEncoding.EncodeToString(random)), bcryptCost)
+	})
+	return a.dummyHash
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// apiKeyParam is the query parameter WebSocket clients pass their token in,
+// since browsers can't set headers on a WebSocket handshake
+const apiKeyParam = "api_key"
+
+// requestToken returns the bearer token of r or, for a WebSocket handshake
+// without one, its api_key query parameter
+func requestToken(r *http.Request) string {
+	if token := bearerToken(r); token != "" {
+		return token
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return r.URL.Query().Get(apiKeyParam)
+	}
+	return ""
+}
+
+// RegisterRoutes adds the login, logout and registration endpoints to a router
+// mounted at /api/auth. Registration requires the admin role.
+func (a *Authenticator) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/login", a.HandleLogin()).Methods("POST")
+	r.HandleFunc("/logout", a.HandleLogout()).Methods("POST")
+	r.Handle("/register", RequireRole(RoleAdmin)(a.HandleRegister())).Methods("POST")
+}
+
+// HandleRegister registers a user
+func (a *Authenticator) HandleRegister() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeACLError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if req.Role == "" {
+			req.Role = RoleUser
+		}
+		if err := validateRegistration(req.Username, req.Password, req.Role); err != nil {
+			writeACLError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err := a.Register(req.Username, req.Password, req.Role)
+		if errors.Is(err, errUsernameTaken) {
+			writeACLError(w, http.StatusConflict, fmt.Sprintf("username %q is already in use", req.Username))
+			return
+		}
+		if err != nil {
+			RequestLogger(r.Context()).WithError(err).Error("Failed to register user")
+			writeACLError(w, http.StatusInternalServerError, "failed to register user")
+			return
+		}
+
+		registeredBy, _ := UserFromContext(r.Context())
+		RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"username":      req.Username,
+			"role":          req.Role,
+			"registered_by": registeredBy.Name,
+			"ip":            peerIP(r),
+		}).Warn("User registered")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(User{Name: req.Username, Role: req.Role})
+	}
+}
+
+// HandleLogin exchanges a username and password for a token
+func (a *Authenticator) HandleLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req LoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeACLError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		token, expiresAt, err := a.Login(req.Username, req.Password)
+		if errors.Is(err, errInvalidCredentials) {
+			RequestLogger(r.Context()).WithFields(logrus.Fields{
+				"username": req.Username,
+				"ip":       peerIP(r),
+			}).Warn("Failed login")
+			writeACLError(w, http.StatusUnauthorized, errInvalidCredentials.Error())
+			return
+		}
+		if err != nil {
+			RequestLogger(r.Context()).WithError(err).Error("Failed to log in")
+			writeACLError(w, http.StatusInternalServerError, "failed to log in")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LoginResponse{Token: token, TokenType: "Bearer", ExpiresAt: expiresAt.UTC()})
+	}
+}
+
+// AuthMiddleware rejects requests to /api endpoints, other than login, that do
+// not carry the token of a live session as a bearer token, and records the
+// session's user in the request context for RequireRole
+type AuthMiddleware struct {
+	auth *Authenticator
+}
+
+// NewAuthMiddleware creates an authentication middleware backed by auth
+func NewAuthMiddleware(auth *Authenticator) *AuthMiddleware {
+	return &AuthMiddleware{auth: auth}
+}
+
+func (m *AuthMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.URL.Path != "/api" && !strings.HasPrefix(r.URL.Path, "/api/")) || r.URL.Path == loginPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := requestToken(r)
+		if token == "" {
+			m.reject(w, r, "missing bearer token")
+			return
+		}
+		user, err := m.auth.Authenticate(token)
+		if errors.Is(err, errInvalidSession) {
+			RequestLogger(r.Context()).WithError(err).Debug("Rejecting invalid token")
+			m.reject(w, r, "invalid, expired or revoked token")
+			return
+		}
+		if err != nil {
+			RequestLogger(r.Context()).WithError(err).Error("Failed to authenticate request")
+			writeACLError(w, http.StatusInternalServerError, "failed to authenticate request")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+// reject answers an unauthenticated request with 401
+func (m *AuthMiddleware) reject(w http.ResponseWriter, r *http.Request, message string) {
+	RequestLogger(r.Context()).WithFields(logrus.Fields{
+		"ip":   peerIP(r),
+		"path": r.URL.Path,
+	}).Warn("Rejecting unauthenticated request")
+	w.Header().Set("WWW-Authenticate", `Bearer realm="pqcd"`)
+	writeACLError(w, http.StatusUnauthorized, message)
+}
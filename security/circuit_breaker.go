@@ -0,0 +1,174 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned instead of calling a service whose breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Default circuit breaker settings
+const (
+	defaultFailureThreshold = 5
+	defaultResetTimeout     = 30 * time.Second
+)
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every call until the reset timeout has passed
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe call through to test the service
+	CircuitHalfOpen
+)
+
+// String returns the state name
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "Open"
+	case CircuitHalfOpen:
+		return "HalfOpen"
+	default:
+		return "Closed"
+	}
+}
+
+// CircuitBreaker stops calling a failing service after a number of consecutive
+// failures, then probes it again once a reset timeout has passed
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	state            CircuitState
+	failures         int
+	failureThreshold int
+	resetTimeout     time.Duration
+	openedAt         time.Time
+	probing          bool
+	now              func() time.Time
+}
+
+// CircuitBreakerStatus reports the current state of a circuit breaker
+type CircuitBreakerStatus struct {
+	State            string     `json:"state"`
+	Failures         int        `json:"failures"`
+	FailureThreshold int        `json:"failure_threshold"`
+	ResetTimeout     string     `json:"reset_timeout"`
+	OpenedAt         *time.Time `json:"opened_at,omitempty"`
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(failureThreshold int, resetTimeout time.Duration) *CircuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = defaultFailureThreshold
+	}
+	if resetTimeout <= 0 {
+		resetTimeout = defaultResetTimeout
+	}
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		resetTimeout:     resetTimeout,
+		now:              time.Now,
+	}
+}
+
+// Execute runs fn unless the breaker is open, recording whether it failed
+func (b *CircuitBreaker) Execute(fn func() error) error {
+	if !b.allow() {
+		return ErrCircuitOpen
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// allow reports whether a call may proceed, moving an open breaker to half-open
+// once the reset timeout has passed
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.resetTimeout {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a call
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		if b.state != CircuitClosed {
+			logrus.Info("Circuit breaker closed after a successful probe")
+		}
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.failureThreshold {
+		if b.state != CircuitOpen {
+			logrus.WithField("failures", b.failures).Warn("Circuit breaker opened")
+		}
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Status returns a snapshot of the breaker's state and failure count
+func (b *CircuitBreaker) Status() CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := CircuitBreakerStatus{
+		State:            b.state.String(),
+		Failures:         b.failures,
+		FailureThreshold: b.failureThreshold,
+		ResetTimeout:     b.resetTimeout.String(),
+	}
+	if b.state != CircuitClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// HandleStatus serves the breaker's status as JSON
+func (b *CircuitBreaker) HandleStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b.Status())
+	}
+}
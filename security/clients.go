@@ -0,0 +1,190 @@
+package security
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"pqcd/crypto"
+)
+
+// errUnknownClient is returned when looking up a client ID that was never registered
+var errUnknownClient = errors.New("unknown client")
+
+// clientsSchema makes sure the clients table exists. It mirrors database/schema.sql.
+var clientsSchema = []string{
+	`CREATE TABLE IF NOT EXISTS clients (
+		client_id TEXT PRIMARY KEY,
+		name TEXT,
+		algorithm TEXT NOT NULL,
+		public_key BLOB NOT NULL,
+		source_ip TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+}
+
+// clientSignatureProviders are the algorithms clients may sign requests with
+var clientSignatureProviders = map[crypto.Algorithm]crypto.SignatureProvider{
+	crypto.AlgMLDSA65: crypto.NewMLDSA65Provider(),
+	crypto.AlgECDSA:   crypto.NewECDSAProvider(),
+}
+
+// Client is a registered client and the public key its requests are signed with
+type Client struct {
+	ID        string
+	Name      string
+	Algorithm crypto.Algorithm
+	PublicKey []byte
+}
+
+// ClientRegisterRequest is the request for registering a client. PublicKey is
+// hex encoded.
+type ClientRegisterRequest struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+}
+
+// ClientRegisterResponse carries the ID a client sends in X-Client-ID
+type ClientRegisterResponse struct {
+	ClientID  string    `json:"client_id"`
+	Name      string    `json:"name,omitempty"`
+	Algorithm string    `json:"algorithm"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ClientRegistry stores the clients allowed to sign their requests in the
+// clients table and serves the admin endpoint that registers them
+type ClientRegistry struct {
+	db *sql.DB
+}
+
+// NewClientRegistry creates a registry for the clients in db
+func NewClientRegistry(db *sql.DB) (*ClientRegistry, error) {
+	for _, statement := range clientsSchema {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, fmt.Errorf("failed to create clients schema: %w", err)
+		}
+	}
+	return &ClientRegistry{db: db}, nil
+}
+
+// Register stores a client's public key under a new random client ID
+func (c *ClientRegistry) Register(name string, alg crypto.Algorithm, publicKey []byte, sourceIP string) (string, error) {
+	if err := validateClientPublicKey(alg, publicKey); err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate client ID: %w", err)
+	}
+	clientID := hex.EncodeToString(id)
+	_, err := c.db.Exec(
+		"INSERT INTO clients (client_id, name, algorithm, public_key, source_ip) VALUES (?, ?, ?, ?, ?)",
+		clientID, name, string(alg), publicKey, sourceIP,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to store client: %w", err)
+	}
+	return clientID, nil
+}
+
+// validateClientPublicKey returns an error unless key is a public key clients
+// can sign with under alg
+func validateClientPublicKey(alg crypto.Algorithm, key []byte) error {
+	if _, ok := clientSignatureProviders[alg]; !ok {
+		return fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+	if err := crypto.ValidatePublicKeySize(alg, key); err != nil {
+		return err
+	}
+	if alg == crypto.AlgECDSA {
+		if x, _ := elliptic.UnmarshalCompressed(elliptic.P256(), key); x == nil {
+			return errors.New("public key is not a compressed P-256 point")
+		}
+	}
+	return nil
+}
+
+// Lookup returns a registered client, or errUnknownClient
+func (c *ClientRegistry) Lookup(ctx context.Context, clientID string) (Client, error) {
+	client := Client{ID: clientID}
+	var name sql.NullString
+	var alg string
+	err := c.db.QueryRowContext(ctx,
+		"SELECT name, algorithm, public_key FROM clients WHERE client_id = ?",
+		clientID,
+	).Scan(&name, &alg, &client.PublicKey)
+	if err == sql.ErrNoRows {
+		return Client{}, errUnknownClient
+	}
+	if err != nil {
+		return Client{}, fmt.Errorf("failed to look up client: %w", err)
+	}
+	client.Name = name.String
+	client.Algorithm = crypto.Algorithm(alg)
+	return client, nil
+}
+
+// RegisterRoutes adds the admin endpoints to a router mounted at /api/admin
+func (c *ClientRegistry) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/clients/register", c.HandleRegister()).Methods("POST")
+}
+
+// HandleRegister registers the client public key in the request body
+func (c *ClientRegistry) HandleRegister() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ClientRegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeACLError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		alg := crypto.Algorithm(req.Algorithm)
+		if _, ok := clientSignatureProviders[alg]; !ok {
+			writeACLError(w, http.StatusBadRequest, fmt.Sprintf("algorithm must be %q or %q", crypto.AlgMLDSA65, crypto.AlgECDSA))
+			return
+		}
+		publicKey, err := hex.DecodeString(req.PublicKey)
+		if err != nil {
+			writeACLError(w, http.StatusBadRequest, "invalid public key format")
+			return
+		}
+		if err := validateClientPublicKey(alg, publicKey); err != nil {
+			writeACLError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		clientID, err := c.Register(req.Name, alg, publicKey, peerIP(r))
+		if err != nil {
+			RequestLogger(r.Context()).WithError(err).Error("Failed to register client")
+			writeACLError(w, http.StatusInternalServerError, "failed to register client")
+			return
+		}
+
+		RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"client_id": clientID,
+			"name":      req.Name,
+			"algorithm": alg,
+		}).Warn("Client registered for request signing")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ClientRegisterResponse{
+			ClientID:  clientID,
+			Name:      req.Name,
+			Algorithm: string(alg),
+			CreatedAt: time.Now().UTC(),
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package security
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"math"
@@ -20,6 +21,7 @@ type RequestFeatures struct {
 	UserAgent    string `json:"user_agent"`
 	Algorithm    string `json:"algorithm"`
 	Operation    string `json:"operation"`
+	RequestID    string `json:"request_id,omitempty"`
 	
 	// Statistical features
 	InputEntropy  float64 `json:"input_entropy"`
@@ -36,28 +38,100 @@ type RequestFeatures struct {
 	// Sequence features (derived from history)
 	LastOperation      string  `json:"last_operation"`
 	SequenceHash       string  `json:"sequence_hash"`
+	OperationSequence  []string `json:"operation_sequence,omitempty"`
 }
 
-// FeatureExtractor extracts features from HTTP requests
+// requestWindow is the period covered by RequestsPerMinute
+const requestWindow = time.Minute
+
+const (
+	// DefaultClientStateTTL is how long StartCleanup should keep an idle
+	// client's state unless the caller has a reason to choose otherwise
+	DefaultClientStateTTL = 10 * time.Minute
+	// DefaultClientCleanupInterval is how often StartCleanup should look for
+	// idle clients
+	DefaultClientCleanupInterval = time.Minute
+)
+
+// FeatureExtractor extracts features from HTTP requests. It keeps state for
+// every client IP it sees, so StartCleanup should run alongside it to evict
+// the clients that have gone quiet.
 type FeatureExtractor struct {
 	mu                 sync.Mutex
-	// Keep track of last request time for each client IP
-	lastRequestTime map[string]time.Time
-	// Keep track of request count in the last minute for each client IP
-	requestCounts map[string]int
+	// Keep track of the last request time for each client IP
+	lastSeen map[string]time.Time
+	// Keep track of request timestamps in the last minute for each client IP
+	requestCounts map[string]*slidingWindow
 	// Keep track of the last operation for each client IP
 	lastOperations map[string]string
 	// Keep track of operation sequence (used for anomaly detection)
 	operationSequences map[string][]string
+	
+	// Clock used for all time calculations, replaceable in tests
+	now  func() time.Time
+	stop chan struct{}
+	once sync.Once
 }
 
 // NewFeatureExtractor creates a new feature extractor
 func NewFeatureExtractor() *FeatureExtractor {
 	return &FeatureExtractor{
-		lastRequestTime:   make(map[string]time.Time),
-		requestCounts:     make(map[string]int),
-		lastOperations:    make(map[string]string),
+		lastSeen:           make(map[string]time.Time),
+		requestCounts:      make(map[string]*slidingWindow),
+		lastOperations:     make(map[string]string),
 		operationSequences: make(map[string][]string),
+		now:                time.Now,
+		stop:               make(chan struct{}),
+	}
+}
+
+// StartCleanup starts a goroutine that every interval drops all state for
+// clients that haven't sent a request in ttl. It runs until ctx is done or
+// Stop is called. A client that comes back after being dropped starts over as
+// if it had never been seen.
+func (e *FeatureExtractor) StartCleanup(ctx context.Context, interval time.Duration, ttl time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		
+		for {
+			select {
+			case <-ticker.C:
+				e.evictStale(ttl)
+			case <-ctx.Done():
+				return
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the cleanup goroutines started by StartCleanup
+func (e *FeatureExtractor) Stop() {
+	e.once.Do(func() { close(e.stop) })
+}
+
+// Size returns the number of clients state is held for
+func (e *FeatureExtractor) Size() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.lastSeen)
+}
+
+// evictStale drops all state for clients idle for longer than ttl
+func (e *FeatureExtractor) evictStale(ttl time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	
+	now := e.now()
+	for ip, last := range e.lastSeen {
+		if now.Sub(last) > ttl {
+			delete(e.lastSeen, ip)
+			delete(e.requestCounts, ip)
+			delete(e.lastOperations, ip)
+			delete(e.operationSequences, ip)
+		}
 	}
 }
 
@@ -70,22 +144,26 @@ func (e *FeatureExtractor) ExtractFeatures(r *http.Request, algorithm crypto.Alg
 	clientIP := getClientIP(r)
 	
 	// Get current time
-	now := time.Now()
+	now := e.now()
 	
 	// Calculate inter-request time
 	var interRequestTime float64
-	lastRequest, exists := e.lastRequestTime[clientIP]
+	lastRequest, exists := e.lastSeen[clientIP]
 	if exists {
 		interRequestTime = now.Sub(lastRequest).Seconds()
 	} else {
 		interRequestTime = -1 // First request from this IP
 	}
-	e.lastRequestTime[clientIP] = now
+	e.lastSeen[clientIP] = now
 	
-	// Calculate requests per minute
-	// This is simplified, in a production system we would use a sliding window
-	e.requestCounts[clientIP]++
-	requestsPerMinute := e.requestCounts[clientIP]
+	// Calculate requests in the last minute
+	window, exists := e.requestCounts[clientIP]
+	if !exists {
+		window = newSlidingWindow(requestWindow)
+		e.requestCounts[clientIP] = window
+	}
+	window.Add(now)
+	requestsPerMinute := window.Count(now)
 	
 	// Get last operation for sequence analysis
 	lastOperation := e.lastOperations[clientIP]
@@ -105,6 +183,7 @@ func (e *FeatureExtractor) ExtractFeatures(r *http.Request, algorithm crypto.Alg
 	
 	// Calculate entropy of input data
 	entropy := calculateEntropy(inputData)
+	requestID, _ := RequestIDFromContext(r.Context())
 	
 	return RequestFeatures{
 		Timestamp:       now.Unix(),
@@ -112,6 +191,7 @@ func (e *FeatureExtractor) ExtractFeatures(r *http.Request, algorithm crypto.Alg
 		UserAgent:       r.UserAgent(),
 		Algorithm:       string(algorithm),
 		Operation:       operation,
+		RequestID:       requestID,
 		InputEntropy:    entropy,
 		InputSize:       len(inputData),
 		InterRequestTime: interRequestTime,
@@ -120,7 +200,103 @@ func (e *FeatureExtractor) ExtractFeatures(r *http.Request, algorithm crypto.Alg
 		Success:          success,
 		LastOperation:    lastOperation,
 		SequenceHash:     sequenceHash,
+		OperationSequence: append([]string(nil), sequence...),
+	}
+}
+
+// slidingWindow counts events within a trailing time window using a
+// circular buffer of timestamps that grows when full
+type slidingWindow struct {
+	window time.Duration
+	times  []time.Time
+	head   int // Index of the oldest timestamp
+	size   int
+}
+
+// newSlidingWindow creates an empty sliding window of the given duration
+func newSlidingWindow(window time.Duration) *slidingWindow {
+	return &slidingWindow{
+		window: window,
+		times:  make([]time.Time, 16),
+	}
+}
+
+// Add records an event at time t
+func (s *slidingWindow) Add(t time.Time) {
+	s.evict(t)
+	if s.size == len(s.times) {
+		s.grow()
+	}
+	s.times[(s.head+s.size)%len(s.times)] = t
+	s.size++
+}
+
+// Count returns the number of events within the window ending at now
+func (s *slidingWindow) Count(now time.Time) int {
+	s.evict(now)
+	return s.size
+}
+
+// evict drops timestamps older than the window
+func (s *slidingWindow) evict(now time.Time) {
+	cutoff := now.Add(-s.window)
+	for s.size > 0 && !s.times[s.head].After(cutoff) {
+		s.head = (s.head + 1) % len(s.times)
+		s.size--
+	}
+}
+
+// grow doubles the buffer capacity, preserving order
+func (s *slidingWindow) grow() {
+	times := make([]time.Time, len(s.times)*2)
+	for i := 0; i < s.size; i++ {
+		times[i] = s.times[(s.head+i)%len(s.times)]
+	}
+	s.times = times
+	s.head = 0
+}
+
+// DefaultMinBodyEntropy is the body entropy, in bits per byte, above which
+// PreScreenEntropy treats a request body as normal
+const DefaultMinBodyEntropy = 5.5
+
+// maxPreScreenBytes is how much of a request body PreScreenEntropy looks at
+const maxPreScreenBytes = 4 << 10
+
+// countLog2 holds c*log2(c) for every byte count PreScreenEntropy can see, so
+// the pre-screen makes no logarithm calls
+var countLog2 = func() [maxPreScreenBytes + 1]float64 {
+	var table [maxPreScreenBytes + 1]float64
+	for c := 2; c <= maxPreScreenBytes; c++ {
+		table[c] = float64(c) * math.Log2(float64(c))
+	}
+	return table
+}()
+
+// PreScreenEntropy reports whether a request body's entropy is clearly in the
+// normal range, above minEntropy bits per byte, so the full analysis can be
+// skipped. Only the first 4 KiB are looked at. An empty body can't be judged
+// and does not pass.
+func PreScreenEntropy(body []byte, minEntropy float64) bool {
+	if len(body) == 0 {
+		return false
+	}
+	if len(body) > maxPreScreenBytes {
+		body = body[:maxPreScreenBytes]
+	}
+
+	var counts [256]uint16
+	for _, b := range body {
+		counts[b]++
+	}
+
+	// H = log2(n) - sum(c*log2(c)) / n
+	var sum float64
+	for _, c := range counts {
+		sum += countLog2[c]
 	}
+	n := float64(len(body))
+	return math.Log2(n)-sum/n > minEntropy
 }
 
 // Helper functions
@@ -132,7 +308,7 @@ func calculateEntropy(data []byte) float64 {
 	}
 	
 	// Count occurrences of each byte value
-	counts := make(map[byte]int)
+	var counts [256]int
 	for _, b := range data {
 		counts[b]++
 	}
@@ -140,6 +316,9 @@ func calculateEntropy(data []byte) float64 {
 	// Calculate entropy
 	entropy := 0.0
 	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
 		p := float64(count) / float64(len(data))
 		entropy -= p * math.Log2(p)
 	}
@@ -0,0 +1,62 @@
+package security
+
+import "sync"
+
+// maxThreatSubscribers caps how many threat streams may be open at once
+const maxThreatSubscribers = 10
+
+// threatSubscriberBuffer is how many threats a subscriber may fall behind by
+// before further threats are dropped for it
+const threatSubscriberBuffer = 16
+
+// ThreatHub broadcasts classified threats to live subscribers such as
+// dashboards. A subscriber that falls behind misses threats rather than
+// holding up classification.
+type ThreatHub struct {
+	mu          sync.Mutex
+	subscribers map[<-chan Threat]chan Threat
+}
+
+// NewThreatHub creates a hub with no subscribers
+func NewThreatHub() *ThreatHub {
+	return &ThreatHub{subscribers: make(map[<-chan Threat]chan Threat)}
+}
+
+// Subscribe returns a channel receiving every threat published from now on,
+// or nil if the hub already has the maximum of 10 subscribers
+func (h *ThreatHub) Subscribe() <-chan Threat {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subscribers) >= maxThreatSubscribers {
+		return nil
+	}
+	ch := make(chan Threat, threatSubscriberBuffer)
+	h.subscribers[ch] = ch
+	return ch
+}
+
+// Unsubscribe stops publishing to ch and closes it. Unknown channels are ignored.
+func (h *ThreatHub) Unsubscribe(ch <-chan Threat) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if send, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(send)
+	}
+}
+
+// Publish sends threat to every subscriber with room for it, without waiting
+// on the others
+func (h *ThreatHub) Publish(threat Threat) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, send := range h.subscribers {
+		select {
+		case send <- threat:
+		default:
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package security
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IdempotencyKeyHeader names a request so that retries of it are answered
+// from the first response instead of being run again
+const IdempotencyKeyHeader = "X-Idempotency-Key"
+
+// IdempotentReplayHeader is set on responses replayed from the cache
+const IdempotentReplayHeader = "X-Idempotent-Replay"
+
+const (
+	// maxIdempotencyKeyLength is the longest idempotency key accepted
+	maxIdempotencyKeyLength = 128
+	// idempotencyTTL is how long a response is replayed for
+	idempotencyTTL = 5 * time.Minute
+	// maxIdempotencyEntries caps the responses kept at once
+	maxIdempotencyEntries = 10000
+	// idempotencyEvictInterval is how often expired responses are evicted
+	idempotencyEvictInterval = time.Minute
+)
+
+// idempotencyKey identifies a request by its client, key and endpoint, so
+// clients can't replay each other's responses
+type idempotencyKey struct {
+	clientIP string
+	key      string
+	endpoint string
+}
+
+// idempotentResponse is the response to the first request with a key. done
+// is closed once it is complete; requests arriving before that wait for it.
+type idempotentResponse struct {
+	done        chan struct{}
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// IdempotencyMiddleware answers repeated requests carrying the same
+// X-Idempotency-Key with the response to the first, for five minutes, so a
+// client retrying after a network failure doesn't have its request run twice.
+// Requests without the header pass straight through. Server errors aren't
+// kept, so a retry after one runs again.
+type IdempotencyMiddleware struct {
+	entries sync.Map // idempotencyKey -> *idempotentResponse
+	size    atomic.Int64
+
+	// Clock used for expiry, replaceable in tests
+	now  func() time.Time
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewIdempotencyMiddleware creates an idempotency middleware and starts a
+// background goroutine that evicts expired responses
+func NewIdempotencyMiddleware() *IdempotencyMiddleware {
+	m := &IdempotencyMiddleware{
+		now:  time.Now,
+		stop: make(chan struct{}),
+	}
+	go m.evictLoop()
+	return m
+}
+
+// Stop terminates the background eviction goroutine
+func (m *IdempotencyMiddleware) Stop() {
+	m.once.Do(func() { close(m.stop) })
+}
+
+func (m *IdempotencyMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeACLError(w, http.StatusBadRequest, "X-Idempotency-Key must be at most 128 characters")
+			return
+		}
+
+		id := idempotencyKey{clientIP: getClientIP(r), key: key, endpoint: r.Method + " " + r.URL.Path}
+		for {
+			entry := &idempotentResponse{done: make(chan struct{})}
+			cached, loaded := m.entries.LoadOrStore(id, entry)
+			if !loaded {
+				m.record(id, entry, next, w, r)
+				return
+			}
+
+			previous := cached.(*idempotentResponse)
+			<-previous.done
+			if previous.status != 0 && m.now().Before(previous.expires) {
+				RequestLogger(r.Context()).WithField("endpoint", id.endpoint).Info("Replaying idempotent response")
+				previous.replay(w)
+				return
+			}
+			// The earlier response expired or wasn't kept, so try again to
+			// be the request that runs
+			m.remove(id, previous)
+		}
+	})
+}
+
+// record runs the request holding entry and keeps its response for replay.
+// The entry is dropped instead if the handler panicked, failed with a server
+// error or the cache was already full.
+func (m *IdempotencyMiddleware) record(id idempotencyKey, entry *idempotentResponse, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	full := m.size.Add(1) > maxIdempotencyEntries
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	completed := false
+	defer func() {
+		if completed && !full && recorder.status < http.StatusInternalServerError {
+			entry.status = recorder.status
+			entry.contentType = w.Header().Get("Content-Type")
+			entry.body = recorder.body.Bytes()
+			entry.expires = m.now().Add(idempotencyTTL)
+		} else {
+			m.remove(id, entry)
+		}
+		close(entry.done)
+	}()
+
+	next.ServeHTTP(recorder, r)
+	completed = true
+}
+
+// replay writes a cached response
+func (e *idempotentResponse) replay(w http.ResponseWriter) {
+	if e.contentType != "" {
+		w.Header().Set("Content-Type", e.contentType)
+	}
+	w.Header().Set(IdempotentReplayHeader, "true")
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// remove drops the entry for id if it is still entry
+func (m *IdempotencyMiddleware) remove(id idempotencyKey, entry *idempotentResponse) {
+	if m.entries.CompareAndDelete(id, entry) {
+		m.size.Add(-1)
+	}
+}
+
+// evictLoop periodically removes expired responses
+func (m *IdempotencyMiddleware) evictLoop() {
+	ticker := time.NewTicker(idempotencyEvictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.evictExpired()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// evictExpired drops every complete response past its expiry
+func (m *IdempotencyMiddleware) evictExpired() {
+	now := m.now()
+	m.entries.Range(func(id, value interface{}) bool {
+		entry := value.(*idempotentResponse)
+		select {
+		case <-entry.done:
+			if !now.Before(entry.expires) {
+				m.remove(id.(idempotencyKey), entry)
+			}
+		default: // Still being handled
+		}
+		return true
+	})
+}
+
+// responseRecorder passes a response through while keeping a copy of its
+// status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
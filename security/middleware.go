@@ -1,24 +1,46 @@
 package security
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// EntropyScreenedHeader is set on responses to requests whose body failed the
+// entropy pre-screen and went through the full analysis
+const EntropyScreenedHeader = "X-Entropy-Screened"
+
 type AISecurityMiddleware struct {
-	// any dependencies, e.g., a logger
+	minEntropy float64                                 // Body entropy above which the analysis is skipped
+	analyze    func(string) (*AnalysisResponse, error) // The analysis service, replaced in tests
 }
 
 func NewAISecurityMiddleware() *AISecurityMiddleware {
-	return &AISecurityMiddleware{}
+	return &AISecurityMiddleware{
+		minEntropy: DefaultMinBodyEntropy,
+		analyze:    AnalyzeRequest,
+	}
 }
 
 func (m *AISecurityMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Trusted clients skip anomaly detection entirely
+		if _, signed := SignedClientID(r.Context()); signed || IsAllowlisted(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		
 		// --- 1. Extract Request Details ---
 		// Attempt to get the real IP, falling back to RemoteAddr.
 		ip := r.Header.Get("X-Real-IP")
@@ -43,42 +65,306 @@ func (m *AISecurityMiddleware) Middleware(next http.Handler) http.Handler {
 			"status_code": 200, "response_size": %d, "execution_time": 0.1, "key_size": 2000, "payload_size": %d
 		}`, time.Now().UTC().Format(time.RFC3339), ip, r.UserAgent(), r.URL.Path, r.Method, r.ContentLength, r.ContentLength)
 
-		// --- 2. Get AI Analysis ---
-		analysis, err := AnalyzeRequest(requestDetailsJSON)
+		// --- 2. Pre-screen the body ---
+		// A body that looks random is what the crypto endpoints expect, so
+		// the analysis call is only made for the rest. The body is put back
+		// for the handlers.
+		if r.Body != nil {
+			prefix, err := io.ReadAll(io.LimitReader(r.Body, maxPreScreenBytes))
+			if err != nil {
+				RequestLogger(r.Context()).WithError(err).Warn("Failed to read request body. Rejecting request.")
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+			if PreScreenEntropy(prefix, m.minEntropy) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(prefix) > 0 {
+				w.Header().Set(EntropyScreenedHeader, "true")
+			}
+		}
+
+		// --- 3. Get AI Analysis ---
+		analysis, err := m.analyze(requestDetailsJSON)
+		if errors.Is(err, ErrCircuitOpen) {
+			RequestLogger(r.Context()).Debug("AI analysis service unavailable. Passing request through.")
+			next.ServeHTTP(w, r)
+			return
+		}
 		if err != nil {
-			logrus.WithError(err).Warn("AI analysis request failed. Passing request through.")
+			RequestLogger(r.Context()).WithError(err).Warn("AI analysis request failed. Passing request through.")
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		logrus.WithFields(logrus.Fields{
+		RequestLogger(r.Context()).WithFields(logrus.Fields{
 			"ip":          ip,
 			"threat_type": analysis.ThreatType,
 			"confidence":  analysis.Confidence,
 			"action":      analysis.Action,
 		}).Info("AI analysis complete")
 
-		// --- 3. Take Action ---
+		// --- 4. Take Action ---
 		switch analysis.Action {
 		case "THROTTLE":
-			logrus.WithField("ip", ip).Warn("Throttling request due to suspicious activity.")
+			RequestLogger(r.Context()).WithField("ip", ip).Warn("Throttling request due to suspicious activity.")
 			http.Error(w, "Request throttled", http.StatusTooManyRequests)
 			return
 		case "DECEIVE":
-			logrus.WithField("ip", ip).Warn("Serving deceptive response.")
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintln(w, `{"error": "invalid_cryptographic_key_format"}`) // Send a fake, plausible error
+			// Handlers that support it answer with plausible but useless output
+			RequestLogger(r.Context()).WithField("ip", ip).Warn("Serving deceptive response.")
+			next.ServeHTTP(w, r.WithContext(WithDeception(r.Context())))
 			return
 		case "REDIRECT":
-			logrus.WithField("ip", ip).Warn("Redirecting suspicious request to honeypot.")
+			RequestLogger(r.Context()).WithField("ip", ip).Warn("Redirecting suspicious request to honeypot.")
 			http.Redirect(w, r, "http://localhost:8080/honeypot", http.StatusFound)
 			return
 		case "PASS":
 			fallthrough // Explicitly fall through to the default case
 		default:
-			logrus.Debug("Passing request to next handler.")
+			RequestLogger(r.Context()).Debug("Passing request to next handler.")
+			next.ServeHTTP(w, r)
+		}
+	})
+} 
+
+// readCloser reads from a replacement reader and closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// IPList is a concurrency-safe set of CIDR ranges. Single addresses are stored
+// as /32 or /128 ranges.
+type IPList struct {
+	mu       sync.RWMutex
+	entries  map[string]struct{}
+	networks []*net.IPNet
+}
+
+// NewIPList creates an empty IP list
+func NewIPList() *IPList {
+	return &IPList{
+		entries: make(map[string]struct{}),
+	}
+}
+
+// parseCIDR parses a CIDR range or single address into its canonical network
+func parseCIDR(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %q", value)
+		}
+		if ip.To4() != nil {
+			value += "/32"
+		} else {
+			value += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR range: %q", value)
+	}
+	return network, nil
+}
+
+// Replace swaps the list contents for the given CIDR ranges. Nothing changes if
+// any range is invalid.
+func (l *IPList) Replace(cidrs []string) error {
+	entries := make(map[string]struct{}, len(cidrs))
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		network, err := parseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		if _, exists := entries[network.String()]; exists {
+			continue
+		}
+		entries[network.String()] = struct{}{}
+		networks = append(networks, network)
+	}
+	
+	l.mu.Lock()
+	l.entries = entries
+	l.networks = networks
+	l.mu.Unlock()
+	return nil
+}
+
+// Remove deletes a single address or CIDR range and reports whether it was present
+func (l *IPList) Remove(value string) bool {
+	network, err := parseCIDR(value)
+	if err != nil {
+		return false
+	}
+	key := network.String()
+	
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, exists := l.entries[key]; !exists {
+		return false
+	}
+	delete(l.entries, key)
+	for i, n := range l.networks {
+		if n.String() == key {
+			l.networks = append(l.networks[:i], l.networks[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Contains reports whether an address falls inside any range in the list
+func (l *IPList) Contains(value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, network := range l.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Entries returns the ranges in the list in sorted order
+func (l *IPList) Entries() []string {
+	l.mu.RLock()
+	entries := make([]string, 0, len(l.entries))
+	for entry := range l.entries {
+		entries = append(entries, entry)
+	}
+	l.mu.RUnlock()
+	sort.Strings(entries)
+	return entries
+}
+
+// peerIP returns the address of the directly connected client. Proxy headers are
+// ignored because clients can set them to anything.
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// deceptionKey marks a request context as one that should get a decoy response
+type deceptionKey struct{}
+
+// WithDeception returns a copy of ctx that asks handlers for decoy responses
+func WithDeception(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deceptionKey{}, true)
+}
+
+// DeceptionEnabled reports whether the security layer asked for a decoy response
+func DeceptionEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(deceptionKey{}).(bool)
+	return enabled
+}
+
+// allowlistedKey marks a request context as coming from an allowlisted client
+type allowlistedKey struct{}
+
+// IsAllowlisted reports whether AllowlistMiddleware matched the request's client
+func IsAllowlisted(ctx context.Context) bool {
+	allowlisted, _ := ctx.Value(allowlistedKey{}).(bool)
+	return allowlisted
+}
+
+// AllowlistMiddleware marks requests from known-good clients so later security
+// checks can skip them
+type AllowlistMiddleware struct {
+	list *IPList
+}
+
+// NewAllowlistMiddleware creates an allowlist middleware backed by list
+func NewAllowlistMiddleware(list *IPList) *AllowlistMiddleware {
+	return &AllowlistMiddleware{list: list}
+}
+
+func (m *AllowlistMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.list.Contains(peerIP(r)) {
+			r = r.WithContext(context.WithValue(r.Context(), allowlistedKey{}, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ThrottleMiddleware rejects requests from clients the response engine has
+// throttled with 429 once they exceed their rate limit. Responses to throttled
+// clients, rejected or not, carry the rate limit headers.
+type ThrottleMiddleware struct {
+	engine *ResponseEngine
+}
+
+// NewThrottleMiddleware creates a throttle middleware backed by engine
+func NewThrottleMiddleware(engine *ResponseEngine) *ThrottleMiddleware {
+	return &ThrottleMiddleware{engine: engine}
+}
+
+func (m *ThrottleMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsAllowlisted(r.Context()) {
 			next.ServeHTTP(w, r)
+			return
+		}
+		
+		ip := getClientIP(r)
+		throttled, status, limited := m.engine.CheckThrottle(ip)
+		if limited {
+			setRateLimitHeaders(w, status)
+		}
+		if throttled {
+			RequestLogger(r.Context()).WithField("ip", ip).Warn("Rejecting request from throttled client")
+			http.Error(w, "Request throttled", http.StatusTooManyRequests)
+			return
 		}
+		next.ServeHTTP(w, r)
 	})
-} 
\ No newline at end of file
+}
+
+// setRateLimitHeaders describes a client's rate limit: X-RateLimit-Limit in
+// requests per minute, X-RateLimit-Remaining as the requests allowed right away
+// and X-RateLimit-Reset as the Unix time the next request is allowed
+func setRateLimitHeaders(w http.ResponseWriter, status RateLimitStatus) {
+	reset := status.Reset.Unix()
+	if status.Reset.Nanosecond() > 0 {
+		reset++ // Round up so a client waiting until then is allowed
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatFloat(float64(status.Limit)*60, 'f', -1, 64))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+}
+
+// BlocklistMiddleware rejects requests from known-bad clients with 403
+type BlocklistMiddleware struct {
+	list *IPList
+}
+
+// NewBlocklistMiddleware creates a blocklist middleware backed by list
+func NewBlocklistMiddleware(list *IPList) *BlocklistMiddleware {
+	return &BlocklistMiddleware{list: list}
+}
+
+func (m *BlocklistMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := peerIP(r)
+		if m.list.Contains(ip) {
+			RequestLogger(r.Context()).WithField("ip", ip).Warn("Rejecting request from blocklisted client")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
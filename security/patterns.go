@@ -0,0 +1,125 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// minSequenceConfidence is the fraction of a pattern's operations that must
+// match, in order, for a sequence to be flagged
+const minSequenceConfidence = 0.8
+
+// defaultReconPatterns are operation sequences typical of a client probing the
+// service rather than using it
+var defaultReconPatterns = [][]string{
+	{"KeyGen", "KeyGen", "KeyGen", "Encapsulate", "Decapsulate"},
+	{"Encapsulate", "Decapsulate", "Encapsulate", "Decapsulate", "Encapsulate", "Decapsulate"},
+	{"Sign", "Verify", "Sign", "Verify", "Sign", "Verify"},
+}
+
+// SequencePatternMatcher compares a client's recent operations against known
+// reconnaissance patterns
+type SequencePatternMatcher struct {
+	mu                 sync.RWMutex
+	knownReconPatterns [][]string
+}
+
+// NewSequencePatternMatcher creates a matcher using the default patterns
+func NewSequencePatternMatcher() *SequencePatternMatcher {
+	m := &SequencePatternMatcher{}
+	m.SetPatterns(defaultReconPatterns)
+	return m
+}
+
+// SetPatterns replaces the known patterns
+func (m *SequencePatternMatcher) SetPatterns(patterns [][]string) error {
+	copied := make([][]string, 0, len(patterns))
+	for i, pattern := range patterns {
+		if len(pattern) == 0 {
+			return fmt.Errorf("pattern %d is empty", i)
+		}
+		copied = append(copied, append([]string(nil), pattern...))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.knownReconPatterns = copied
+	return nil
+}
+
+// Patterns returns a copy of the known patterns
+func (m *SequencePatternMatcher) Patterns() [][]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	patterns := make([][]string, len(m.knownReconPatterns))
+	for i, pattern := range m.knownReconPatterns {
+		patterns[i] = append([]string(nil), pattern...)
+	}
+	return patterns
+}
+
+// LoadPatterns replaces the known patterns with those in a JSON file holding
+// an array of operation sequences
+func (m *SequencePatternMatcher) LoadPatterns(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read pattern file: %w", err)
+	}
+	var patterns [][]string
+	if err := json.Unmarshal(data, &patterns); err != nil {
+		return fmt.Errorf("failed to parse pattern file: %w", err)
+	}
+	if len(patterns) == 0 {
+		return errors.New("pattern file contains no patterns")
+	}
+	return m.SetPatterns(patterns)
+}
+
+// Match slides every known pattern across the sequence and returns the best
+// matching pattern with the fraction of its operations that matched. It
+// returns a nil pattern if nothing reaches minSequenceConfidence.
+func (m *SequencePatternMatcher) Match(sequence []string) ([]string, float64) {
+	return m.matchAbove(sequence, minSequenceConfidence)
+}
+
+// matchAbove is Match with the confidence a match must reach given by minConfidence
+func (m *SequencePatternMatcher) matchAbove(sequence []string, minConfidence float64) ([]string, float64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var best []string
+	var bestConfidence float64
+	for _, pattern := range m.knownReconPatterns {
+		if confidence := matchConfidence(sequence, pattern); confidence > bestConfidence {
+			best, bestConfidence = pattern, confidence
+		}
+	}
+	if bestConfidence < minConfidence {
+		return nil, 0
+	}
+	return append([]string(nil), best...), bestConfidence
+}
+
+// matchConfidence returns the highest fraction of positions at which any
+// window of the sequence equals the pattern
+func matchConfidence(sequence, pattern []string) float64 {
+	if len(sequence) < len(pattern) {
+		return 0
+	}
+	var best int
+	for start := 0; start+len(pattern) <= len(sequence); start++ {
+		matched := 0
+		for i, operation := range pattern {
+			if sequence[start+i] == operation {
+				matched++
+			}
+		}
+		if matched > best {
+			best = matched
+		}
+	}
+	return float64(best) / float64(len(pattern))
+}
@@ -0,0 +1,87 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Roles of the users table, from most to least privileged
+const (
+	RoleAdmin    = "admin"
+	RoleUser     = "user"
+	RoleReadonly = "readonly"
+)
+
+// roleRanks orders the roles; a role may do everything the roles below it may
+var roleRanks = map[string]int{
+	RoleReadonly: 1,
+	RoleUser:     2,
+	RoleAdmin:    3,
+}
+
+// User is an authenticated caller
+type User struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type userKey struct{}
+
+// WithUser marks the request context as authenticated as user
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the user the authentication middleware authenticated
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userKey{}).(User)
+	return user, ok
+}
+
+// RequireRole rejects requests whose user is not at least role with 403, and
+// unauthenticated requests with 401. It panics if role is unknown.
+func RequireRole(role string) mux.MiddlewareFunc {
+	required, ok := roleRanks[role]
+	if !ok {
+		panic(fmt.Sprintf("security: unknown role %q", role))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				writeACLError(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			if roleRanks[user.Role] < required {
+				RequestLogger(r.Context()).WithFields(logrus.Fields{
+					"user":     user.Name,
+					"role":     user.Role,
+					"required": role,
+					"path":     r.URL.Path,
+				}).Warn("Rejecting request with an insufficient role")
+				writeACLError(w, http.StatusForbidden, fmt.Sprintf("this operation requires the %s role", role))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HandleWhoAmI reports the authenticated user and their role
+func HandleWhoAmI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			writeACLError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
@@ -1,11 +1,18 @@
 package security
 
 import (
+	cryptorand "crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
+
+	"pqcd/crypto"
 )
 
 // ThreatType represents a classified threat
@@ -59,27 +66,298 @@ type ResponseEngine struct {
 	// Throttling limits for IPs
 	throttlingMap   map[string]*rate.Limiter
 	
-	// Deception settings
-	deceptionEnabled bool
+	// Tunable behaviour, replaced by ApplyConfig
+	config          ResponseEngineConfig
+	
+	// Output sizes for decoys
+	kemMetadata     map[crypto.Algorithm]crypto.AlgorithmMetadata
+	
+	// Optional persistent threat store in the event_logs table
+	db              *sql.DB
 	
-	// Honeypot settings
-	honeypotIP      string
-	honeypotEnabled bool
+	// Optional webhook notified of critical threats
+	alerter         *WebhookAlerter
+	
+	// Live subscribers to classified threats
+	hub             *ThreatHub
+}
+
+// decoySharedSecretSize is the shared secret length of every supported KEM
+const decoySharedSecretSize = 32
+
+// ecdhPointPrefix marks an uncompressed elliptic curve point
+const ecdhPointPrefix = 0x04
+
+// maxThreatHistory is how many threats are kept per IP, in memory and when
+// reloading from the database
+const maxThreatHistory = 100
+
+// threatEventType is the event_logs event type used for persisted threats
+const threatEventType = "threat"
+
+// purgeEventType is the event_logs event type recording that an IP's threat
+// history was purged. Threats persisted before it are never restored.
+const purgeEventType = "admin_purge"
+
+// threatPurgeWindow is how far back PurgeThreats deletes persisted threats.
+// Older threats are kept for audit.
+const threatPurgeWindow = 24 * time.Hour
+
+// threatStoreSchema makes sure event_logs exists and can be queried per IP
+var threatStoreSchema = []string{
+	`CREATE TABLE IF NOT EXISTS event_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_type TEXT NOT NULL,
+		description TEXT,
+		source_ip TEXT,
+		timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		severity TEXT CHECK (severity IN ('INFO', 'WARNING', 'ERROR', 'CRITICAL')),
+		related_item_id INTEGER,
+		related_item_type TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_event_logs_type_time ON event_logs(event_type, timestamp)`,
+	`CREATE INDEX IF NOT EXISTS idx_event_logs_ip_type ON event_logs(source_ip, event_type)`,
 }
 
 // NewResponseEngine creates a new response engine
 func NewResponseEngine() *ResponseEngine {
 	return &ResponseEngine{
-		threatHistory:    make(map[string][]Threat),
-		throttlingMap:    make(map[string]*rate.Limiter),
-		deceptionEnabled: true,
-		honeypotEnabled:  true,
-		honeypotIP:       "10.10.10.10", // In a real system, this would be a real honeypot server
+		threatHistory: make(map[string][]Threat),
+		throttlingMap: make(map[string]*rate.Limiter),
+		config:        DefaultResponseEngineConfig(),
+		kemMetadata:   kemMetadata(),
+		alerter:       NewWebhookAlerterFromEnv(),
+		hub:           NewThreatHub(),
 	}
 }
 
-// ClassifyThreat determines the type and severity of a detected anomaly
+// Threats returns the hub every classified threat is published to
+func (r *ResponseEngine) Threats() *ThreatHub {
+	return r.hub
+}
+
+// SetAlerter replaces the webhook notified of critical threats, or disables
+// alerts when alerter is nil
+func (r *ResponseEngine) SetAlerter(alerter *WebhookAlerter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerter = alerter
+}
+
+// kemMetadata collects the metadata of every default KEM provider
+func kemMetadata() map[crypto.Algorithm]crypto.AlgorithmMetadata {
+	registry := crypto.DefaultRegistry()
+	metadata := make(map[crypto.Algorithm]crypto.AlgorithmMetadata)
+	for _, alg := range registry.ListKEMAlgorithms() {
+		if info, err := registry.AlgorithmInfo(alg); err == nil {
+			metadata[alg] = info
+		}
+	}
+	return metadata
+}
+
+// NewResponseEngineWithDB creates a response engine that persists threats to the
+// event_logs table so threat history survives restarts
+func NewResponseEngineWithDB(db *sql.DB) *ResponseEngine {
+	r := NewResponseEngine()
+	r.db = db
+	
+	for _, statement := range threatStoreSchema {
+		if _, err := db.Exec(statement); err != nil {
+			logrus.WithError(err).Error("Failed to migrate threat store schema")
+		}
+	}
+	
+	return r
+}
+
+// severity maps a threat level onto the event_logs severity values
+func (l ThreatLevel) severity() string {
+	switch l {
+	case ThreatLevelCritical:
+		return "CRITICAL"
+	case ThreatLevelHigh:
+		return "ERROR"
+	case ThreatLevelMedium:
+		return "WARNING"
+	default:
+		return "INFO"
+	}
+}
+
+// persistThreat stores a threat in event_logs. The full threat is kept as JSON
+// in the description so it can be restored by loadThreats.
+func (r *ResponseEngine) persistThreat(threat Threat) error {
+	data, err := json.Marshal(threat)
+	if err != nil {
+		return fmt.Errorf("failed to encode threat: %w", err)
+	}
+	
+	_, err = r.db.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, timestamp) VALUES (?, ?, ?, ?, ?)",
+		threatEventType, string(data), threat.IP, threat.Level.severity(), threat.Timestamp.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to persist threat: %w", err)
+	}
+	return nil
+}
+
+// loadThreats returns the most recent persisted threats for an IP, oldest first
+func (r *ResponseEngine) loadThreats(ip string) ([]Threat, error) {
+	rows, err := r.db.Query(
+		`SELECT description FROM event_logs WHERE source_ip = ? AND event_type = ?
+			AND timestamp > COALESCE((SELECT MAX(timestamp) FROM event_logs WHERE source_ip = ? AND event_type = ?), '')
+			ORDER BY timestamp DESC, id DESC LIMIT ?`,
+		ip, threatEventType, ip, purgeEventType, maxThreatHistory,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query threats: %w", err)
+	}
+	defer rows.Close()
+	
+	var threats []Threat
+	for rows.Next() {
+		var description string
+		if err := rows.Scan(&description); err != nil {
+			return nil, fmt.Errorf("failed to scan threat: %w", err)
+		}
+		var threat Threat
+		if err := json.Unmarshal([]byte(description), &threat); err != nil {
+			logrus.WithError(err).WithField("ip", ip).Warn("Skipping unreadable threat record")
+			continue
+		}
+		threats = append(threats, threat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read threats: %w", err)
+	}
+	
+	// Rows come back newest first
+	for i, j := 0, len(threats)-1; i < j; i, j = i+1, j-1 {
+		threats[i], threats[j] = threats[j], threats[i]
+	}
+	return threats, nil
+}
+
+// restoreHistory loads persisted threats for an IP with no in-memory history
+func (r *ResponseEngine) restoreHistory(ip string) {
+	r.mu.RLock()
+	known := len(r.threatHistory[ip]) > 0
+	r.mu.RUnlock()
+	if known {
+		return
+	}
+	
+	threats, err := r.loadThreats(ip)
+	if err != nil {
+		logrus.WithError(err).WithField("ip", ip).Error("Failed to load threat history")
+		return
+	}
+	if len(threats) == 0 {
+		return
+	}
+	
+	r.mu.Lock()
+	if len(r.threatHistory[ip]) == 0 {
+		r.threatHistory[ip] = threats
+	}
+	r.mu.Unlock()
+}
+
+// PurgeThreats forgets the threat history and rate limiter of an IP, so its
+// next request is judged afresh. Persisted threats from the last 24 hours are
+// deleted and the purge is recorded in event_logs with description, for
+// accountability. It returns the number of persisted threats deleted.
+func (r *ResponseEngine) PurgeThreats(ip, description string) (int64, error) {
+	r.mu.Lock()
+	delete(r.threatHistory, ip)
+	delete(r.throttlingMap, ip)
+	r.mu.Unlock()
+	
+	if r.db == nil {
+		return 0, nil
+	}
+	
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin threat purge: %w", err)
+	}
+	defer tx.Rollback()
+	
+	now := time.Now().UTC()
+	result, err := tx.Exec(
+		"DELETE FROM event_logs WHERE source_ip = ? AND event_type = ? AND timestamp >= ?",
+		ip, threatEventType, now.Add(-threatPurgeWindow),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete threats: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted threats: %w", err)
+	}
+	
+	// The purge event is also the cutoff loadThreats restores history from
+	_, err = tx.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity, timestamp) VALUES (?, ?, ?, ?, ?)",
+		purgeEventType, description, ip, "WARNING", now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record threat purge: %w", err)
+	}
+	
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit threat purge: %w", err)
+	}
+	return deleted, nil
+}
+
+// ClassifyThreat determines the type and severity of a detected anomaly and
+// records the threat in the IP's history
 func (r *ResponseEngine) ClassifyThreat(features RequestFeatures, anomalyType string, score float64) Threat {
+	threat := classifyAnomaly(features, anomalyType, score)
+	
+	// Pick up history from before a restart
+	if r.db != nil {
+		r.restoreHistory(features.ClientIP)
+	}
+	
+	// Update threat history
+	r.mu.Lock()
+	threats := r.threatHistory[features.ClientIP]
+	if len(threats) >= maxThreatHistory {
+		// Keep last 100 threats
+		threats = threats[1:]
+	}
+	threats = append(threats, threat)
+	r.threatHistory[features.ClientIP] = threats
+	r.mu.Unlock()
+	
+	r.hub.Publish(threat)
+	
+	if r.db != nil {
+		if err := r.persistThreat(threat); err != nil {
+			logrus.WithError(err).WithField("ip", threat.IP).Error("Failed to persist threat")
+		}
+	}
+	
+	if threat.Level == ThreatLevelCritical {
+		r.mu.RLock()
+		alerter := r.alerter
+		r.mu.RUnlock()
+		if alerter != nil {
+			if err := alerter.Dispatch(threat); err != nil {
+				logrus.WithError(err).WithField("ip", threat.IP).Error("Failed to dispatch threat alert")
+			}
+		}
+	}
+	
+	return threat
+}
+
+// classifyAnomaly builds the threat record for a detected anomaly
+func classifyAnomaly(features RequestFeatures, anomalyType string, score float64) Threat {
 	var threatType ThreatType
 	var threatLevel ThreatLevel
 	var description string
@@ -104,6 +382,15 @@ func (r *ResponseEngine) ClassifyThreat(features RequestFeatures, anomalyType st
 			threatLevel = ThreatLevelMedium
 		}
 		
+	case "ReconSequence":
+		threatType = ThreatRecon
+		description = "Operation sequence matches a known reconnaissance pattern"
+		if score >= 1.0 {
+			threatLevel = ThreatLevelHigh
+		} else {
+			threatLevel = ThreatLevelMedium
+		}
+		
 	case "HighFrequency":
 		threatType = ThreatRecon
 		description = "High frequency API usage"
@@ -124,8 +411,7 @@ func (r *ResponseEngine) ClassifyThreat(features RequestFeatures, anomalyType st
 		threatLevel = ThreatLevelLow
 	}
 	
-	// Create threat record
-	threat := Threat{
+	return Threat{
 		IP:          features.ClientIP,
 		Type:        threatType,
 		Level:       threatLevel,
@@ -134,19 +420,6 @@ func (r *ResponseEngine) ClassifyThreat(features RequestFeatures, anomalyType st
 		Timestamp:   time.Now(),
 		Features:    features,
 	}
-	
-	// Update threat history
-	r.mu.Lock()
-	threats := r.threatHistory[features.ClientIP]
-	if len(threats) > 99 {
-		// Keep last 100 threats
-		threats = threats[1:]
-	}
-	threats = append(threats, threat)
-	r.threatHistory[features.ClientIP] = threats
-	r.mu.Unlock()
-	
-	return threat
 }
 
 // DecideAction determines the appropriate response to a threat
@@ -156,19 +429,40 @@ func (r *ResponseEngine) DecideAction(threat Threat) ActionType {
 	r.mu.RLock()
 	history := r.threatHistory[threat.IP]
 	historyLength := len(history)
+	config := r.config
 	r.mu.RUnlock()
 	
+	return decideAction(threat, historyLength, config)
+}
+
+// SimulateThreat classifies an anomaly and decides on the response to it as
+// ClassifyThreat and DecideAction would, without recording, publishing or
+// alerting the threat
+func (r *ResponseEngine) SimulateThreat(features RequestFeatures, anomalyType string, score float64) (Threat, ActionType) {
+	threat := classifyAnomaly(features, anomalyType, score)
+	
+	r.mu.RLock()
+	historyLength := min(len(r.threatHistory[features.ClientIP])+1, maxThreatHistory)
+	config := r.config
+	r.mu.RUnlock()
+	
+	return threat, decideAction(threat, historyLength, config)
+}
+
+// decideAction picks the response to a threat from an IP with historyLength
+// threats on record, counting this one
+func decideAction(threat Threat, historyLength int, config ResponseEngineConfig) ActionType {
 	// Simple rule-based decision making
 	// In a real system, this would be a trained RL agent
 
 	// For critical threats, always redirect to honeypot
-	if threat.Level == ThreatLevelCritical && r.honeypotEnabled {
+	if threat.Level == ThreatLevelCritical && config.HoneypotEnabled {
 		return ActionRedirect
 	}
 	
 	// For high-level threats or repeat offenders, use deception
 	if threat.Level == ThreatLevelHigh || historyLength > 5 {
-		if r.deceptionEnabled {
+		if config.DeceptionEnabled {
 			return ActionDeceive
 		}
 		return ActionThrottle
@@ -197,8 +491,8 @@ func (r *ResponseEngine) ApplyAction(action ActionType, clientIP string) {
 			current := r.throttlingMap[clientIP]
 			// Cut rate in half each time
 			newRate := current.Limit() / 2
-			if newRate < 0.1 {
-				newRate = 0.1 // Don't go below 1 request per 10 seconds
+			if floor := rate.Limit(r.config.ThrottleRateFloor); newRate < floor {
+				newRate = floor // Don't go below the configured floor
 			}
 			r.throttlingMap[clientIP] = rate.NewLimiter(newRate, 1)
 		}
@@ -206,10 +500,13 @@ func (r *ResponseEngine) ApplyAction(action ActionType, clientIP string) {
 		
 	case ActionRedirect:
 		// In a real system, we would configure the proxy to redirect to honeypot
+		r.mu.RLock()
+		target := r.config.HoneypotIP
+		r.mu.RUnlock()
 		logrus.WithFields(logrus.Fields{
 			"action": "redirect",
 			"ip":     clientIP,
-			"target": r.honeypotIP,
+			"target": target,
 		}).Info("Redirecting suspicious traffic to honeypot")
 		
 	case ActionDeceive:
@@ -230,33 +527,59 @@ func (r *ResponseEngine) ApplyAction(action ActionType, clientIP string) {
 
 // ShouldThrottle checks if a request from this IP should be throttled
 func (r *ResponseEngine) ShouldThrottle(clientIP string) bool {
+	throttled, _, _ := r.CheckThrottle(clientIP)
+	return throttled
+}
+
+// RateLimitStatus is the state of a throttled client's rate limiter after a request
+type RateLimitStatus struct {
+	Limit     rate.Limit // Requests allowed per second
+	Remaining int        // Requests that would be allowed right away
+	Reset     time.Time  // When the next request will be allowed
+}
+
+// CheckThrottle is ShouldThrottle that also reports the state of the client's
+// rate limiter. limited is false, with a zero status, for clients that have
+// never been throttled.
+func (r *ResponseEngine) CheckThrottle(clientIP string) (throttled bool, status RateLimitStatus, limited bool) {
 	r.mu.RLock()
 	limiter, exists := r.throttlingMap[clientIP]
 	r.mu.RUnlock()
 	
 	if !exists {
-		return false
+		return false, RateLimitStatus{}, false
 	}
 	
-	return !limiter.Allow()
+	now := time.Now()
+	throttled = !limiter.AllowN(now, 1)
+	tokens := limiter.TokensAt(now)
+	status = RateLimitStatus{
+		Limit:     limiter.Limit(),
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     now,
+	}
+	if tokens < 1 && limiter.Limit() > 0 {
+		status.Reset = now.Add(time.Duration((1 - tokens) / float64(limiter.Limit()) * float64(time.Second)))
+	}
+	return throttled, status, true
 }
 
 // ShouldDeceive checks if deception should be used for this IP
 func (r *ResponseEngine) ShouldDeceive(clientIP string) bool {
-	if !r.deceptionEnabled {
-		return false
-	}
-	
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	
+	if !r.config.DeceptionEnabled {
+		return false
+	}
+	
 	history, exists := r.threatHistory[clientIP]
 	if !exists || len(history) == 0 {
 		return false
 	}
 	
 	// Check if any recent action was to deceive
-	for i := len(history) - 1; i >= 0 && i >= len(history)-5; i-- {
+	for i := len(history) - 1; i >= 0 && i >= len(history)-r.config.HistoryWindowSize; i-- {
 		// We don't store the action in the threat history, but in a real system we would
 		// For now, assume high-level threats get deception
 		if history[i].Level >= ThreatLevelHigh {
@@ -267,15 +590,48 @@ func (r *ResponseEngine) ShouldDeceive(clientIP string) bool {
 	return false
 }
 
-// ShouldRedirect checks if request should be redirected to honeypot
-func (r *ResponseEngine) ShouldRedirect(clientIP string) bool {
-	if !r.honeypotEnabled {
-		return false
+// GenerateDecoyEncapsulateResponse returns random bytes shaped like the output
+// of a real encapsulation with alg. The ciphertext has the algorithm's length and
+// any elliptic curve point in it carries the usual prefix, but the shared secret
+// has nothing to do with it.
+func (r *ResponseEngine) GenerateDecoyEncapsulateResponse(alg crypto.Algorithm) (ciphertext []byte, sharedSecret []byte) {
+	info, ok := r.kemMetadata[alg]
+	if !ok {
+		info = r.kemMetadata[crypto.AlgMLKEM768]
 	}
 	
+	ciphertext = randomDecoyBytes(info.OutputSize)
+	sharedSecret = randomDecoyBytes(decoySharedSecretSize)
+	
+	// ECDH and hybrid ciphertexts end in an uncompressed ephemeral public key
+	if alg == crypto.AlgECDH || alg == crypto.AlgHybridMLKEMECDH {
+		pointSize := r.kemMetadata[crypto.AlgECDH].OutputSize
+		if pointSize > 0 && len(ciphertext) >= pointSize {
+			ciphertext[len(ciphertext)-pointSize] = ecdhPointPrefix
+		}
+	}
+	
+	return ciphertext, sharedSecret
+}
+
+// randomDecoyBytes returns n random bytes
+func randomDecoyBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := cryptorand.Read(b); err != nil {
+		logrus.WithError(err).Error("Failed to generate decoy bytes")
+	}
+	return b
+}
+
+// ShouldRedirect checks if request should be redirected to honeypot
+func (r *ResponseEngine) ShouldRedirect(clientIP string) bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	
+	if !r.config.HoneypotEnabled {
+		return false
+	}
+	
 	history, exists := r.threatHistory[clientIP]
 	if !exists || len(history) == 0 {
 		return false
@@ -0,0 +1,126 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// responseConfigEventType is the event_logs event type recording config changes
+const responseConfigEventType = "response_engine_config"
+
+// ResponseEngineConfig holds the ResponseEngine behaviour that can be tuned at
+// runtime through the /api/admin/response-engine/config endpoint
+type ResponseEngineConfig struct {
+	DeceptionEnabled  bool    `json:"deception_enabled"`   // Whether repeat and high-level threats get decoy responses
+	HoneypotEnabled   bool    `json:"honeypot_enabled"`    // Whether critical threats are redirected to the honeypot
+	HoneypotIP        string  `json:"honeypot_ip"`         // Address critical threats are redirected to
+	ThrottleRateFloor float64 `json:"throttle_rate_floor"` // Requests per second repeated throttling never goes below
+	HistoryWindowSize int     `json:"history_window_size"` // Recent threats per IP ShouldDeceive looks at
+}
+
+// DefaultResponseEngineConfig returns the behaviour a new ResponseEngine starts with
+func DefaultResponseEngineConfig() ResponseEngineConfig {
+	return ResponseEngineConfig{
+		DeceptionEnabled:  true,
+		HoneypotEnabled:   true,
+		HoneypotIP:        "10.10.10.10", // In a real system, this would be a real honeypot server
+		ThrottleRateFloor: 0.1,
+		HistoryWindowSize: 5,
+	}
+}
+
+// Validate reports the first setting that is out of range
+func (c ResponseEngineConfig) Validate() error {
+	switch {
+	case net.ParseIP(c.HoneypotIP) == nil:
+		return fmt.Errorf("honeypot_ip must be an IP address, got %q", c.HoneypotIP)
+	case c.ThrottleRateFloor < 0.01:
+		return errors.New("throttle_rate_floor must be at least 0.01")
+	case c.HistoryWindowSize < 1 || c.HistoryWindowSize > maxThreatHistory:
+		return fmt.Errorf("history_window_size must be between 1 and %d", maxThreatHistory)
+	}
+	return nil
+}
+
+// Config returns the behaviour in use
+func (r *ResponseEngine) Config() ResponseEngineConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+// ApplyConfig replaces the engine's behaviour. It takes effect for the next
+// decision; cfg should already have passed Validate.
+func (r *ResponseEngine) ApplyConfig(cfg ResponseEngineConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = cfg
+}
+
+// persistConfig records a config change in event_logs
+func (r *ResponseEngine) persistConfig(cfg ResponseEngineConfig, sourceIP string) error {
+	if r.db == nil {
+		return nil
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode response engine config: %w", err)
+	}
+	_, err = r.db.Exec(
+		"INSERT INTO event_logs (event_type, description, source_ip, severity) VALUES (?, ?, ?, ?)",
+		responseConfigEventType, string(data), sourceIP, "WARNING",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to persist response engine config: %w", err)
+	}
+	return nil
+}
+
+// RegisterRoutes adds the admin endpoints to a router mounted at /api/admin
+func (r *ResponseEngine) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/response-engine/config", r.HandleGetConfig()).Methods("GET")
+	router.HandleFunc("/response-engine/config", r.HandleUpdateConfig()).Methods("PATCH")
+}
+
+// HandleGetConfig returns the behaviour in use
+func (r *ResponseEngine) HandleGetConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Config())
+	}
+}
+
+// HandleUpdateConfig applies the settings in the JSON request body. Settings
+// the body leaves out keep their current values. Changes last until the next
+// restart.
+func (r *ResponseEngine) HandleUpdateConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		config := r.Config()
+		if err := json.NewDecoder(req.Body).Decode(&config); err != nil {
+			writeACLError(w, http.StatusBadRequest, "request body must be a JSON object of response engine settings")
+			return
+		}
+		if err := config.Validate(); err != nil {
+			writeACLError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		r.ApplyConfig(config)
+
+		RequestLogger(req.Context()).WithFields(logrus.Fields{
+			"config": config,
+			"ip":     peerIP(req),
+		}).Warn("Response engine config updated")
+		if err := r.persistConfig(config, peerIP(req)); err != nil {
+			RequestLogger(req.Context()).WithError(err).Error("Failed to persist response engine config")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(config)
+	}
+}
@@ -0,0 +1,1999 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
+
+	"pqcd/crypto"
+)
+
+// fakeClock is a manually advanced clock for time-dependent tests
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// newTestExtractor returns a feature extractor driven by a fake clock
+func newTestExtractor(t *testing.T) (*FeatureExtractor, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	e := NewFeatureExtractor()
+	e.now = clock.Now
+	t.Cleanup(e.Stop)
+	return e, clock
+}
+
+func TestRequestsPerMinuteSlidingWindow(t *testing.T) {
+	e, clock := newTestExtractor(t)
+	req := httptest.NewRequest("POST", "/api/ml-kem-768/keygen", nil)
+	req.RemoteAddr = "198.51.100.1:4000"
+
+	var features RequestFeatures
+	for i := 0; i < 30; i++ {
+		features = e.ExtractFeatures(req, crypto.AlgMLKEM768, "KeyGen", nil, true, 1)
+		clock.Advance(time.Second)
+	}
+	if features.RequestsPerMinute != 30 {
+		t.Errorf("Expected 30 requests in the window, got %d", features.RequestsPerMinute)
+	}
+
+	// 45 seconds later only the last 15 of those requests are still in the window
+	clock.Advance(44 * time.Second)
+	features = e.ExtractFeatures(req, crypto.AlgMLKEM768, "KeyGen", nil, true, 1)
+	if features.RequestsPerMinute != 16 {
+		t.Errorf("Expected 16 requests in the window, got %d", features.RequestsPerMinute)
+	}
+
+	// After a quiet minute the count starts over
+	clock.Advance(2 * time.Minute)
+	features = e.ExtractFeatures(req, crypto.AlgMLKEM768, "KeyGen", nil, true, 1)
+	if features.RequestsPerMinute != 1 {
+		t.Errorf("Expected 1 request in the window, got %d", features.RequestsPerMinute)
+	}
+}
+
+func TestSlidingWindowGrows(t *testing.T) {
+	window := newSlidingWindow(time.Minute)
+	start := time.Unix(1700000000, 0)
+
+	for i := 0; i < 100; i++ {
+		window.Add(start.Add(time.Duration(i) * 100 * time.Millisecond))
+	}
+	if count := window.Count(start.Add(10 * time.Second)); count != 100 {
+		t.Errorf("Expected 100 events, got %d", count)
+	}
+	// Only events strictly newer than 5s remain: 5.1s through 9.9s
+	if count := window.Count(start.Add(65 * time.Second)); count != 49 {
+		t.Errorf("Expected 49 events after partial eviction, got %d", count)
+	}
+}
+
+func TestEvictStaleClients(t *testing.T) {
+	e, clock := newTestExtractor(t)
+
+	active := httptest.NewRequest("GET", "/", nil)
+	active.RemoteAddr = "198.51.100.2:4000"
+	idle := httptest.NewRequest("GET", "/", nil)
+	idle.RemoteAddr = "198.51.100.3:4000"
+
+	e.ExtractFeatures(idle, crypto.AlgECDH, "KeyGen", nil, true, 1)
+	clock.Advance(11 * time.Minute)
+	e.ExtractFeatures(active, crypto.AlgECDH, "KeyGen", nil, true, 1)
+
+	e.evictStale(DefaultClientStateTTL)
+
+	if _, exists := e.lastSeen["198.51.100.3"]; exists {
+		t.Error("Expected idle client to be evicted")
+	}
+	if _, exists := e.requestCounts["198.51.100.3"]; exists {
+		t.Error("Expected idle client's window to be evicted")
+	}
+	if _, exists := e.lastSeen["198.51.100.2"]; !exists {
+		t.Error("Expected active client to be kept")
+	}
+}
+
+func TestFeatureExtractorCleanup(t *testing.T) {
+	e, clock := newTestExtractor(t)
+
+	active := httptest.NewRequest("GET", "/", nil)
+	active.RemoteAddr = "198.51.100.4:4000"
+	idle := httptest.NewRequest("GET", "/", nil)
+	idle.RemoteAddr = "198.51.100.5:4000"
+
+	e.ExtractFeatures(idle, crypto.AlgECDH, "KeyGen", nil, true, 1)
+	e.ExtractFeatures(idle, crypto.AlgECDH, "Encapsulate", nil, true, 1)
+	clock.Advance(2 * time.Minute)
+	e.ExtractFeatures(active, crypto.AlgECDH, "KeyGen", nil, true, 1)
+	if size := e.Size(); size != 2 {
+		t.Fatalf("Expected 2 tracked clients, got %d", size)
+	}
+
+	// The clock stays put from here on, as the cleanup goroutine reads it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.StartCleanup(ctx, time.Millisecond, time.Minute)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for e.Size() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected idle client to be evicted, %d clients still tracked", e.Size())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	// An evicted client starts over as if it had never been seen
+	features := e.ExtractFeatures(idle, crypto.AlgECDH, "Decapsulate", nil, true, 1)
+	if features.InterRequestTime != -1 {
+		t.Errorf("Expected no inter-request time for a returning client, got %f", features.InterRequestTime)
+	}
+	if features.RequestsPerMinute != 1 {
+		t.Errorf("Expected 1 request in the window, got %d", features.RequestsPerMinute)
+	}
+	if features.LastOperation != "" {
+		t.Errorf("Expected no last operation, got %q", features.LastOperation)
+	}
+	if size := e.Size(); size != 2 {
+		t.Errorf("Expected 2 tracked clients, got %d", size)
+	}
+}
+
+// openTestDB opens an in-memory SQLite database shared by a single connection
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestThreatHistoryPersistence(t *testing.T) {
+	db := openTestDB(t)
+	ip := "198.51.100.4"
+
+	engine := NewResponseEngineWithDB(db)
+	features := RequestFeatures{ClientIP: ip, RequestsPerMinute: 2000}
+	engine.ClassifyThreat(features, "RapidRequests", 3.0)
+	engine.ClassifyThreat(features, "AbnormalLatency", 6.0)
+
+	var severity string
+	err := db.QueryRow("SELECT severity FROM event_logs WHERE event_type = 'threat' AND source_ip = ? ORDER BY id DESC", ip).Scan(&severity)
+	if err != nil {
+		t.Fatalf("Expected a persisted threat: %v", err)
+	}
+	if severity != "CRITICAL" {
+		t.Errorf("Expected severity CRITICAL, got %s", severity)
+	}
+
+	// A new engine on the same database simulates a restart
+	restarted := NewResponseEngineWithDB(db)
+	if restarted.ShouldRedirect(ip) {
+		t.Errorf("Expected no history before the IP is seen again")
+	}
+	restarted.ClassifyThreat(RequestFeatures{ClientIP: ip}, "HighFrequency", 1.0)
+
+	history := restarted.threatHistory[ip]
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 threats after restoring history, got %d", len(history))
+	}
+	if history[0].Type != ThreatRecon || history[1].Level != ThreatLevelCritical {
+		t.Errorf("Expected restored threats in chronological order, got %+v", history[:2])
+	}
+	if !restarted.ShouldRedirect(ip) {
+		t.Errorf("Expected the restored critical threat to trigger a redirect")
+	}
+}
+
+func TestThreatHistoryLoadLimit(t *testing.T) {
+	db := openTestDB(t)
+	ip := "198.51.100.5"
+
+	engine := NewResponseEngineWithDB(db)
+	for i := 0; i < maxThreatHistory+20; i++ {
+		engine.ClassifyThreat(RequestFeatures{ClientIP: ip}, "HighFrequency", 1.0)
+	}
+
+	restarted := NewResponseEngineWithDB(db)
+	threats, err := restarted.loadThreats(ip)
+	if err != nil {
+		t.Fatalf("Failed to load threats: %v", err)
+	}
+	if len(threats) != maxThreatHistory {
+		t.Errorf("Expected %d threats, got %d", maxThreatHistory, len(threats))
+	}
+
+	// Threats for other IPs are not loaded
+	others, _ := restarted.loadThreats("198.51.100.6")
+	if len(others) != 0 {
+		t.Errorf("Expected no threats for an unseen IP, got %d", len(others))
+	}
+}
+
+func TestIPListCIDRMatching(t *testing.T) {
+	list := NewIPList()
+	err := list.Replace([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32", "::1"})
+	if err != nil {
+		t.Fatalf("Failed to replace list: %v", err)
+	}
+
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"192.0.2.1", true},
+		{"192.0.2.2", false},
+		{"2001:db8:1::5", true},
+		{"2001:db9::1", false},
+		{"::1", true},
+		{"::ffff:10.0.0.1", true}, // IPv4-mapped addresses match IPv4 ranges
+		{"not an ip", false},
+	}
+	for _, tc := range tests {
+		if got := list.Contains(tc.ip); got != tc.expected {
+			t.Errorf("Contains(%s): Expected %v, got %v", tc.ip, tc.expected, got)
+		}
+	}
+
+	// Invalid ranges leave the list unchanged
+	if err := list.Replace([]string{"10.0.0.0/8", "10.0.0.0/33"}); err == nil {
+		t.Errorf("Expected an error for an invalid CIDR range")
+	}
+	if !list.Contains("2001:db8::1") {
+		t.Errorf("Expected a failed replace to keep the existing entries")
+	}
+
+	if !list.Remove("192.0.2.1") || list.Contains("192.0.2.1") {
+		t.Errorf("Expected 192.0.2.1 to be removed")
+	}
+	if list.Remove("192.0.2.1") {
+		t.Errorf("Expected removing a missing entry to report false")
+	}
+}
+
+func TestAccessControlMiddleware(t *testing.T) {
+	blocklist := NewIPList()
+	blocklist.Replace([]string{"203.0.113.0/24", "2001:db8:bad::/48"})
+	allowlist := NewIPList()
+	allowlist.Replace([]string{"198.51.100.10"})
+
+	var allowlisted bool
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowlisted = IsAllowlisted(r.Context())
+	})
+	handler := NewBlocklistMiddleware(blocklist).Middleware(NewAllowlistMiddleware(allowlist).Middleware(final))
+
+	tests := []struct {
+		remoteAddr  string
+		status      int
+		allowlisted bool
+	}{
+		{"203.0.113.9:4000", http.StatusForbidden, false},
+		{"[2001:db8:bad::1]:4000", http.StatusForbidden, false},
+		{"198.51.100.10:4000", http.StatusOK, true},
+		{"[2001:db8::1]:4000", http.StatusOK, false},
+	}
+	for _, tc := range tests {
+		allowlisted = false
+		req := httptest.NewRequest("GET", "/api/health", nil)
+		req.RemoteAddr = tc.remoteAddr
+		// Proxy headers must not be able to bypass the lists
+		req.Header.Set("X-Forwarded-For", "198.51.100.10")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s: Expected status %d, got %d", tc.remoteAddr, tc.status, rec.Code)
+		}
+		if allowlisted != tc.allowlisted {
+			t.Errorf("%s: Expected allowlisted %v, got %v", tc.remoteAddr, tc.allowlisted, allowlisted)
+		}
+	}
+}
+
+func TestAccessControlEndpoints(t *testing.T) {
+	db := openTestDB(t)
+	acl := NewAccessControl(db)
+	r := mux.NewRouter()
+	acl.RegisterRoutes(r.PathPrefix("/api/admin").Subrouter())
+
+	serve := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&payload).Encode(body)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, path, &payload))
+		return rec
+	}
+
+	rec := serve("PUT", "/api/admin/blocklist", []string{"203.0.113.0/24", "2001:db8::1"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Blocklist update failed: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = serve("PUT", "/api/admin/allowlist", []string{"198.51.100.0/24"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Allowlist update failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve("PUT", "/api/admin/blocklist", []string{"bogus"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid range, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = serve("DELETE", "/api/admin/blocklist/2001:db8::1", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Blocklist removal failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve("DELETE", "/api/admin/blocklist/2001:db8::1", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing entry, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	var updates int
+	db.QueryRow("SELECT COUNT(*) FROM event_logs WHERE event_type = 'acl_update'").Scan(&updates)
+	if updates != 3 {
+		t.Errorf("Expected 3 persisted list updates, got %d", updates)
+	}
+
+	// The latest lists are restored after a restart
+	restarted := NewAccessControl(db)
+	if !restarted.Blocklist.Contains("203.0.113.50") || restarted.Blocklist.Contains("2001:db8::1") {
+		t.Errorf("Expected the restored blocklist to match the last update, got %v", restarted.Blocklist.Entries())
+	}
+	if !restarted.Allowlist.Contains("198.51.100.7") {
+		t.Errorf("Expected the restored allowlist to match the last update, got %v", restarted.Allowlist.Entries())
+	}
+}
+
+// newTestAuthenticator returns an authenticator for db with a fake clock
+func newTestAuthenticator(t *testing.T, db *sql.DB) (*Authenticator, *fakeClock) {
+	t.Helper()
+	auth, err := NewAuthenticator(db)
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	clock := &fakeClock{t: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+	auth.now = clock.Now
+	return auth, clock
+}
+
+// addTestUser stores a user without a usable password, skipping the cost of bcrypt
+func addTestUser(t *testing.T, db *sql.DB, username, role string) {
+	t.Helper()
+	if _, err := db.Exec("INSERT INTO users (username, password_hash, role) VALUES (?, '', ?)", username, role); err != nil {
+		t.Fatalf("Failed to add user %s: %v", username, err)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	db := openTestDB(t)
+	auth, clock := newTestAuthenticator(t, db)
+	addTestUser(t, db, "alice", RoleUser)
+	var authenticated User
+	handler := NewAuthMiddleware(auth).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := UserFromContext(r.Context()); ok {
+			authenticated = user
+		}
+	}))
+
+	valid, _, err := auth.IssueToken(User{Name: "alice", Role: RoleUser})
+	if err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+	if _, _, err := auth.IssueToken(User{Name: "mallory", Role: RoleAdmin}); err == nil {
+		t.Error("Expected no session for an unregistered user")
+	}
+	// A session of another database is unknown here
+	other, _ := newTestAuthenticator(t, openTestDB(t))
+	addTestUser(t, other.db, "alice", RoleUser)
+	foreign, _, _ := other.IssueToken(User{Name: "alice"})
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		status int
+	}{
+		{"missing", "/api/ml-kem-768/keygen", "", http.StatusUnauthorized},
+		{"invalid", "/api/ml-kem-768/keygen", "Bearer not-a-token", http.StatusUnauthorized},
+		{"unknown session", "/api/ml-kem-768/keygen", "Bearer " + foreign, http.StatusUnauthorized},
+		{"wrong scheme", "/api/ml-kem-768/keygen", "Basic " + valid, http.StatusUnauthorized},
+		{"valid", "/api/ml-kem-768/keygen", "Bearer " + valid, http.StatusOK},
+		{"login", "/api/auth/login", "", http.StatusOK},
+		{"outside /api", "/metrics", "", http.StatusOK},
+		{"prefix lookalike", "/apidocs", "", http.StatusOK},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("POST", tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s: Expected status %d, got %d", tc.name, tc.status, rec.Code)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: Expected a WWW-Authenticate header", tc.name)
+		}
+	}
+	if authenticated != (User{Name: "alice", Role: RoleUser}) {
+		t.Errorf("Expected the token's user in the request context, got %+v", authenticated)
+	}
+
+	// Sessions expire
+	clock.Advance(sessionTTL)
+	req := httptest.NewRequest("POST", "/api/ml-kem-768/keygen", nil)
+	req.Header.Set("Authorization", "Bearer "+valid)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an expired token, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	db := openTestDB(t)
+	t.Setenv("ADMIN_PASSWORD", "correct horse battery")
+	auth, clock := newTestAuthenticator(t, db)
+
+	r := mux.NewRouter()
+	r.Use(NewAuthMiddleware(auth).Middleware)
+	auth.RegisterRoutes(r.PathPrefix("/api/auth").Subrouter())
+	r.Handle("/api/whoami", HandleWhoAmI()).Methods("GET")
+
+	serve := func(path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		json.NewEncoder(&payload).Encode(body)
+		req := httptest.NewRequest("POST", path, &payload)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func(username, password string) (LoginResponse, int) {
+		rec := serve("/api/auth/login", "", LoginRequest{Username: username, Password: password})
+		var resp LoginResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp, rec.Code
+	}
+
+	// The admin user is created from ADMIN_PASSWORD
+	admin, code := login("admin", "correct horse battery")
+	if code != http.StatusOK || admin.Token == "" || admin.TokenType != "Bearer" {
+		t.Fatalf("Admin login failed: %d %+v", code, admin)
+	}
+
+	// Only admins may register users
+	bob := RegisterRequest{Username: "bob", Password: "hunter2hunter2", Role: RoleReadonly}
+	if rec := serve("/api/auth/register", "", bob); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	addTestUser(t, db, "carol", RoleUser)
+	userToken, _, _ := auth.IssueToken(User{Name: "carol"})
+	if rec := serve("/api/auth/register", userToken, bob); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a non-admin, got %d", http.StatusForbidden, rec.Code)
+	}
+	if rec := serve("/api/auth/register", admin.Token, RegisterRequest{Username: "bob", Password: "short"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a short password, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if rec := serve("/api/auth/register", admin.Token, RegisterRequest{Username: "bob", Password: "hunter2hunter2", Role: "root"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid role, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if rec := serve("/api/auth/register", admin.Token, bob); rec.Code != http.StatusCreated {
+		t.Fatalf("Registration failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve("/api/auth/register", admin.Token, bob); rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a duplicate username, got %d", http.StatusConflict, rec.Code)
+	}
+
+	var hash string
+	db.QueryRow("SELECT password_hash FROM users WHERE username = 'bob'").Scan(&hash)
+	if cost, err := bcrypt.Cost([]byte(hash)); err != nil || cost != bcryptCost {
+		t.Errorf("Expected a bcrypt hash with cost %d, got %q", bcryptCost, hash)
+	}
+
+	// Login succeeds with the right password and the token carries the claims
+	resp, code := login("bob", "hunter2hunter2")
+	if code != http.StatusOK {
+		t.Fatalf("Login failed with status %d", code)
+	}
+	if !resp.ExpiresAt.Equal(clock.Now().Add(sessionTTL)) {
+		t.Errorf("Expected the session to expire at %v, got %v", clock.Now().Add(sessionTTL), resp.ExpiresAt)
+	}
+	var sessions int
+	db.QueryRow("SELECT COUNT(*) FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.id = ? AND u.username = 'bob'", resp.Token).Scan(&sessions)
+	if sessions != 1 {
+		t.Errorf("Expected the token to be the ID of a session for bob, got %d sessions", sessions)
+	}
+
+	req := httptest.NewRequest("GET", "/api/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var user User
+	json.NewDecoder(rec.Body).Decode(&user)
+	if user != (User{Name: "bob", Role: RoleReadonly}) {
+		t.Errorf("Expected whoami to report bob as readonly, got %d %+v", rec.Code, user)
+	}
+
+	// Login fails with a wrong password or an unknown user
+	if _, code := login("bob", "hunter3hunter3"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong password, got %d", http.StatusUnauthorized, code)
+	}
+	if _, code := login("nobody", "hunter2hunter2"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unknown user, got %d", http.StatusUnauthorized, code)
+	}
+
+	// The admin user is not recreated on restart
+	t.Setenv("ADMIN_PASSWORD", "a different password")
+	newTestAuthenticator(t, db)
+	if _, code := login("admin", "correct horse battery"); code != http.StatusOK {
+		t.Errorf("Expected the original admin password to still work, got %d", code)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	db := openTestDB(t)
+	t.Setenv("ADMIN_PASSWORD", "correct horse battery")
+	auth, clock := newTestAuthenticator(t, db)
+
+	r := mux.NewRouter()
+	r.Use(NewAuthMiddleware(auth).Middleware)
+	auth.RegisterRoutes(r.PathPrefix("/api/auth").Subrouter())
+	admin := r.PathPrefix("/api/admin").Subrouter()
+	auth.RegisterAdminRoutes(admin)
+	admin.Use(RequireRole(RoleAdmin))
+	r.Handle("/api/whoami", HandleWhoAmI()).Methods("GET")
+
+	serve := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&payload).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &payload)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func() string {
+		t.Helper()
+		rec := serve("POST", "/api/auth/login", "", LoginRequest{Username: "admin", Password: "correct horse battery"})
+		var resp LoginResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusOK || resp.Token == "" {
+			t.Fatalf("Login failed: %d %s", rec.Code, rec.Body.String())
+		}
+		return resp.Token
+	}
+
+	// A session works until it is logged out, and never after
+	token := login()
+	if rec := serve("GET", "/api/whoami", token, nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d with a live session, got %d", http.StatusOK, rec.Code)
+	}
+	if rec := serve("POST", "/api/auth/logout", token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d for logout, got %d", http.StatusNoContent, rec.Code)
+	}
+	if rec := serve("GET", "/api/whoami", token, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d after logout, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if rec := serve("POST", "/api/auth/logout", token, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d logging out a revoked session, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	// Sessions expire an hour after login
+	expiring := login()
+	clock.Advance(sessionTTL - time.Second)
+	if rec := serve("GET", "/api/whoami", expiring, nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d just before expiry, got %d", http.StatusOK, rec.Code)
+	}
+	clock.Advance(time.Second)
+	if rec := serve("GET", "/api/whoami", expiring, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d after expiry, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	// Purging removes the revoked and expired sessions, not the live one
+	live := login()
+	rec := serve("POST", "/api/admin/sessions/purge-expired", live, nil)
+	var purged PurgeSessionsResponse
+	json.NewDecoder(rec.Body).Decode(&purged)
+	if rec.Code != http.StatusOK || purged.Purged != 2 {
+		t.Errorf("Expected 2 sessions purged, got %d %+v", rec.Code, purged)
+	}
+	var remaining int
+	db.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&remaining)
+	if remaining != 1 {
+		t.Errorf("Expected 1 session left, got %d", remaining)
+	}
+	if rec := serve("GET", "/api/whoami", live, nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected the live session to survive the purge, got %d", rec.Code)
+	}
+
+	// Only admins may purge
+	addTestUser(t, db, "dave", RoleUser)
+	userToken, _, _ := auth.IssueToken(User{Name: "dave"})
+	if rec := serve("POST", "/api/admin/sessions/purge-expired", userToken, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a non-admin purge, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	roles := []string{RoleReadonly, RoleUser, RoleAdmin}
+	for i, required := range roles {
+		handler := RequireRole(required)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for j, role := range roles {
+			req := httptest.NewRequest("GET", "/api/keys", nil)
+			req = req.WithContext(WithUser(req.Context(), User{Name: "test", Role: role}))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			want := http.StatusOK
+			if j < i {
+				want = http.StatusForbidden
+			}
+			if rec.Code != want {
+				t.Errorf("%s calling a %s endpoint: Expected status %d, got %d", role, required, want, rec.Code)
+			}
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/keys", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s endpoint: Expected status %d without a user, got %d", required, http.StatusUnauthorized, rec.Code)
+		}
+	}
+}
+
+func TestCircuitBreakerOpensAfterFailures(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	breaker := NewCircuitBreaker(5, 30*time.Second)
+	breaker.now = clock.Now
+
+	failure := errors.New("service unavailable")
+	for i := 0; i < 5; i++ {
+		if err := breaker.Execute(func() error { return failure }); err != failure {
+			t.Fatalf("Expected the call's error on attempt %d, got %v", i+1, err)
+		}
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("Expected breaker to be Open after 5 failures, got %s", breaker.State())
+	}
+
+	called := false
+	if err := breaker.Execute(func() error { called = true; return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if called {
+		t.Error("Expected an open breaker not to call the service")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	breaker := NewCircuitBreaker(5, 30*time.Second)
+	breaker.now = clock.Now
+
+	failure := errors.New("service unavailable")
+	trip := func() {
+		for i := 0; i < 5; i++ {
+			breaker.Execute(func() error { return failure })
+		}
+	}
+	trip()
+
+	clock.Advance(29 * time.Second)
+	if err := breaker.Execute(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen before the reset timeout, got %v", err)
+	}
+
+	// Only one probe is let through while it is in flight
+	clock.Advance(time.Second)
+	err := breaker.Execute(func() error {
+		if breaker.State() != CircuitHalfOpen {
+			t.Errorf("Expected breaker to be HalfOpen during the probe, got %s", breaker.State())
+		}
+		if err := breaker.Execute(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Expected a second call during the probe to be rejected, got %v", err)
+		}
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Expected the probe's error, got %v", err)
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("Expected a failed probe to reopen the breaker, got %s", breaker.State())
+	}
+
+	clock.Advance(30 * time.Second)
+	if err := breaker.Execute(func() error { return nil }); err != nil {
+		t.Errorf("Expected the probe to succeed, got %v", err)
+	}
+	status := breaker.Status()
+	if status.State != "Closed" || status.Failures != 0 || status.OpenedAt != nil {
+		t.Errorf("Expected a successful probe to close and reset the breaker, got %+v", status)
+	}
+}
+
+func TestCircuitBreakerStatusEndpoint(t *testing.T) {
+	breaker := NewCircuitBreaker(5, 30*time.Second)
+	for i := 0; i < 5; i++ {
+		breaker.Execute(func() error { return errors.New("service unavailable") })
+	}
+
+	rec := httptest.NewRecorder()
+	breaker.HandleStatus()(rec, httptest.NewRequest("GET", "/api/admin/circuit-breaker/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var status CircuitBreakerStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if status.State != "Open" || status.Failures != 5 || status.FailureThreshold != 5 || status.ResetTimeout != "30s" {
+		t.Errorf("Unexpected circuit breaker status: %+v", status)
+	}
+	if status.OpenedAt == nil {
+		t.Error("Expected an open breaker to report when it opened")
+	}
+}
+
+func TestMahalanobisDistanceKnownCovariance(t *testing.T) {
+	cov := [featureDimensions][featureDimensions]float64{
+		{4, 2, 0, 0},
+		{2, 3, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 9},
+	}
+	tests := []struct {
+		x        [featureDimensions]float64
+		expected float64
+	}{
+		{[featureDimensions]float64{0, 0, 0, 0}, 0},
+		{[featureDimensions]float64{2, 1, 1, 3}, math.Sqrt(3)},
+		{[featureDimensions]float64{0, 0, 0, 6}, 2},
+		// (2,-2) runs against the positive correlation: 12/8 + 16/8 + 16/8 = 5.5
+		{[featureDimensions]float64{2, -2, 0, 0}, math.Sqrt(5.5)},
+	}
+	for _, tt := range tests {
+		got := mahalanobisDistance(tt.x, [featureDimensions]float64{}, cov)
+		if math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("Expected distance %f for %v, got %f", tt.expected, tt.x, got)
+		}
+	}
+}
+
+func TestMahalanobisWelfordCovariance(t *testing.T) {
+	d := NewAnomalyDetector()
+	samples := []RequestFeatures{
+		{InputEntropy: 7.0, InterRequestTime: 1.0, RequestsPerMinute: 2, OperationLatency: 10},
+		{InputEntropy: 7.5, InterRequestTime: 2.0, RequestsPerMinute: 4, OperationLatency: 12},
+		{InputEntropy: 7.2, InterRequestTime: 1.5, RequestsPerMinute: 3, OperationLatency: 15},
+		{InputEntropy: 7.8, InterRequestTime: 3.0, RequestsPerMinute: 6, OperationLatency: 11},
+		{InputEntropy: 7.1, InterRequestTime: 2.5, RequestsPerMinute: 5, OperationLatency: 14},
+	}
+	for _, s := range samples {
+		d.Train(s)
+	}
+
+	// Compare against the two-pass sample covariance
+	var mean [featureDimensions]float64
+	for _, s := range samples {
+		x := featureVector(s)
+		for i := range x {
+			mean[i] += x[i] / float64(len(samples))
+		}
+	}
+	var expected [featureDimensions][featureDimensions]float64
+	for _, s := range samples {
+		x := featureVector(s)
+		for i := range x {
+			for j := range x {
+				expected[i][j] += (x[i] - mean[i]) * (x[j] - mean[j]) / float64(len(samples)-1)
+			}
+		}
+	}
+
+	cov := d.covariance()
+	for i := range cov {
+		if math.Abs(d.vectorMean[i]-mean[i]) > 1e-9 {
+			t.Errorf("Expected mean %f for feature %d, got %f", mean[i], i, d.vectorMean[i])
+		}
+		for j := range cov[i] {
+			if math.Abs(cov[i][j]-expected[i][j]) > 1e-9 {
+				t.Errorf("Expected covariance %f at (%d,%d), got %f", expected[i][j], i, j, cov[i][j])
+			}
+		}
+	}
+
+	if got := d.MahalanobisScore(samples[0]); got <= 0 {
+		t.Errorf("Expected a positive distance for a training sample, got %f", got)
+	}
+}
+
+func TestDetectMultivariateOutlier(t *testing.T) {
+	d := NewAnomalyDetector()
+	// Request rate and latency rise together in the training data
+	for i := 0; i < 20; i++ {
+		d.Train(RequestFeatures{
+			InputEntropy:      7.0 + float64(i%3)*0.1,
+			InterRequestTime:  1.0 + float64(i%4)*0.2,
+			RequestsPerMinute: 2 + i%10,
+			OperationLatency:  10 + float64(i%10) + float64(i%3)*0.5,
+		})
+	}
+
+	normal := RequestFeatures{InputEntropy: 7.1, InterRequestTime: 1.2, RequestsPerMinute: 6, OperationLatency: 14.5}
+	if anomalous, kind, score := d.Detect(normal); anomalous {
+		t.Errorf("Expected a typical request to pass, got %s with score %f", kind, score)
+	}
+
+	// Each feature is within its usual range, but the combination is not
+	outlier := RequestFeatures{InputEntropy: 7.1, InterRequestTime: 1.2, RequestsPerMinute: 11, OperationLatency: 10}
+	anomalous, kind, score := d.Detect(outlier)
+	if !anomalous || kind != "MultivariateOutlier" {
+		t.Fatalf("Expected MultivariateOutlier, got %v %q", anomalous, kind)
+	}
+	if score <= defaultMahalanobisThreshold {
+		t.Errorf("Expected a score above %f, got %f", defaultMahalanobisThreshold, score)
+	}
+
+	d.SetMahalanobisThreshold(score + 1)
+	if anomalous, kind, _ := d.Detect(outlier); anomalous {
+		t.Errorf("Expected a raised threshold to pass the request, got %s", kind)
+	}
+}
+
+func TestAnomalyStateRoundTrip(t *testing.T) {
+	trained := NewAnomalyDetector()
+	for i := 0; i < 20; i++ {
+		trained.Train(RequestFeatures{
+			InputEntropy:      7.0 + float64(i%3)*0.1,
+			InterRequestTime:  1.0 + float64(i%4)*0.2,
+			RequestsPerMinute: 2 + i%10,
+			OperationLatency:  10 + float64(i%10) + float64(i%3)*0.5,
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "anomaly_state.json")
+	if err := trained.SaveState(path); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+	restored := NewAnomalyDetector()
+	if err := restored.LoadState(path); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+
+	exported, _ := trained.Export()
+	reexported, _ := restored.Export()
+	if !bytes.Equal(exported, reexported) {
+		t.Errorf("Expected the restored state to match\n%s\n%s", exported, reexported)
+	}
+
+	// The restored detector passes normal traffic and catches the same
+	// anomalies without any new training
+	normal := RequestFeatures{InputEntropy: 7.1, InterRequestTime: 1.2, RequestsPerMinute: 6, OperationLatency: 14.5}
+	if anomalous, kind, _ := restored.Detect(normal); anomalous {
+		t.Errorf("Expected a typical request to pass after import, got %s", kind)
+	}
+	outlier := RequestFeatures{InputEntropy: 7.1, InterRequestTime: 1.2, RequestsPerMinute: 11, OperationLatency: 10}
+	_, wantKind, wantScore := trained.Detect(outlier)
+	anomalous, kind, score := restored.Detect(outlier)
+	if !anomalous || kind != wantKind || math.Abs(score-wantScore) > 1e-9 {
+		t.Errorf("Expected %s with score %f after import, got %v %s %f", wantKind, wantScore, anomalous, kind, score)
+	}
+	latency := RequestFeatures{InputEntropy: 7.1, InterRequestTime: 1.2, RequestsPerMinute: 6, OperationLatency: 100}
+	if anomalous, kind, _ := restored.Detect(latency); !anomalous || kind != "AbnormalLatency" {
+		t.Errorf("Expected AbnormalLatency after import, got %v %q", anomalous, kind)
+	}
+
+	if err := restored.Import([]byte("{not json")); err == nil {
+		t.Error("Expected malformed state to be rejected")
+	}
+
+	// Without a baseline nothing but reconnaissance sequences is flagged
+	restored.Reset()
+	if anomalous, kind, _ := restored.Detect(outlier); anomalous {
+		t.Errorf("Expected no detection after reset, got %s", kind)
+	}
+	if _, err := restored.Export(); err != nil {
+		t.Errorf("Export after reset failed: %v", err)
+	}
+}
+
+func TestPersistAnomalyState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anomaly_state.json")
+	d := NewAnomalyDetector()
+	stop := d.PersistState(path)
+	for i := 0; i < 12; i++ {
+		d.Train(RequestFeatures{InputEntropy: 7.0 + float64(i%3)*0.1, InterRequestTime: 1.0, RequestsPerMinute: 2 + i%4, OperationLatency: 10 + float64(i%5)})
+	}
+	// Stopping saves the state one last time
+	stop()
+	stop()
+
+	restarted := NewAnomalyDetector()
+	defer restarted.PersistState(path)()
+	exported, _ := d.Export()
+	restored, _ := restarted.Export()
+	if !bytes.Equal(exported, restored) {
+		t.Errorf("Expected the saved state to be restored at startup\n%s\n%s", exported, restored)
+	}
+}
+
+func TestThresholdsChangeDetection(t *testing.T) {
+	d := NewAnomalyDetector()
+	for i := 0; i < 20; i++ {
+		d.Train(RequestFeatures{
+			InputEntropy:      5.0 + float64(i%3)*0.1,
+			InterRequestTime:  1.0 + float64(i%4)*0.2,
+			RequestsPerMinute: 2 + i%10,
+			OperationLatency:  10 + float64(i%10) + float64(i%3)*0.5,
+		})
+	}
+
+	features := RequestFeatures{InputEntropy: 5.1, InterRequestTime: 1.2, RequestsPerMinute: 6, OperationLatency: 14.5}
+	if anomalous, kind, _ := d.Detect(features); !anomalous || kind != "LowEntropy" {
+		t.Fatalf("Expected LowEntropy with the default thresholds, got %v %q", anomalous, kind)
+	}
+
+	thresholds := d.Thresholds()
+	thresholds.EntropyThreshold = 4.0
+	if err := d.SetThresholds(thresholds); err != nil {
+		t.Fatalf("SetThresholds failed: %v", err)
+	}
+	if anomalous, kind, _ := d.Detect(features); anomalous {
+		t.Errorf("Expected a lowered entropy threshold to pass the request, got %s", kind)
+	}
+
+	thresholds.RequestsPerMinuteThreshold = 5
+	if err := d.SetThresholds(thresholds); err != nil {
+		t.Fatalf("SetThresholds failed: %v", err)
+	}
+	if anomalous, kind, _ := d.Detect(features); !anomalous || kind != "HighFrequency" {
+		t.Errorf("Expected HighFrequency with a lowered rate threshold, got %v %q", anomalous, kind)
+	}
+
+	thresholds.SequenceThreshold = 0
+	if err := d.SetThresholds(thresholds); err == nil {
+		t.Error("Expected a zero sequence threshold to be rejected")
+	}
+	if got := d.Thresholds().SequenceThreshold; got != minSequenceConfidence {
+		t.Errorf("Expected a rejected update to keep sequence threshold %f, got %f", minSequenceConfidence, got)
+	}
+}
+
+func TestAnomalyConfigEndpoints(t *testing.T) {
+	d := NewAnomalyDetector()
+	r := mux.NewRouter()
+	d.RegisterRoutes(r.PathPrefix("/api/admin").Subrouter())
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, "/api/admin/anomaly-config", strings.NewReader(body)))
+		return rec
+	}
+
+	var config ThresholdConfig
+	rec := serve("GET", "")
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatalf("Failed to decode thresholds: %v", err)
+	}
+	if config != DefaultThresholdConfig() {
+		t.Errorf("Expected the default thresholds, got %+v", config)
+	}
+
+	// Thresholds left out of the body keep their values
+	rec = serve("PUT", `{"entropy_threshold": 5.5, "requests_per_minute_threshold": 40}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Threshold update failed: %d %s", rec.Code, rec.Body.String())
+	}
+	expected := DefaultThresholdConfig()
+	expected.EntropyThreshold = 5.5
+	expected.RequestsPerMinuteThreshold = 40
+	if got := d.Thresholds(); got != expected {
+		t.Errorf("Expected thresholds %+v, got %+v", expected, got)
+	}
+
+	if rec := serve("PUT", `{"entropy_threshold": 9}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an out of range threshold, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if rec := serve("PUT", `not json`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid body, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if got := d.Thresholds(); got != expected {
+		t.Errorf("Expected rejected updates to keep %+v, got %+v", expected, got)
+	}
+}
+
+func TestWatchThresholds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anomaly_config.yaml")
+	if err := os.WriteFile(path, []byte("entropy_threshold: 5.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewAnomalyDetector()
+	stop, err := d.WatchThresholds(path)
+	if err != nil {
+		t.Fatalf("WatchThresholds failed: %v", err)
+	}
+	defer stop()
+	if got := d.Thresholds(); got.EntropyThreshold != 5.0 || got.RequestsPerMinuteThreshold != 20 {
+		t.Errorf("Expected the file's entropy threshold and default rate threshold, got %+v", got)
+	}
+
+	// An invalid file is ignored
+	if err := os.WriteFile(path, []byte("entropy_threshold: -1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("entropy_threshold: 4.5\nsequence_threshold: 0.6\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Thresholds().SequenceThreshold != 0.6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the rewritten file to be reloaded, got %+v", d.Thresholds())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := d.Thresholds().EntropyThreshold; got != 4.5 {
+		t.Errorf("Expected entropy threshold 4.5, got %f", got)
+	}
+}
+
+func TestSequencePatternMatching(t *testing.T) {
+	m := NewSequencePatternMatcher()
+
+	tests := []struct {
+		name       string
+		sequence   []string
+		confidence float64
+	}{
+		{"exact", []string{"KeyGen", "KeyGen", "KeyGen", "Encapsulate", "Decapsulate"}, 1.0},
+		{"embedded", []string{"Sign", "KeyGen", "KeyGen", "KeyGen", "Encapsulate", "Decapsulate", "Verify"}, 1.0},
+		{"one off", []string{"KeyGen", "KeyGen", "Sign", "Encapsulate", "Decapsulate"}, 0.8},
+		{"too short", []string{"KeyGen", "Encapsulate"}, 0},
+		{"ordinary use", []string{"KeyGen", "Encapsulate", "Sign", "Verify", "KeyGen"}, 0},
+	}
+	for _, tt := range tests {
+		pattern, confidence := m.Match(tt.sequence)
+		if confidence != tt.confidence {
+			t.Errorf("%s: expected confidence %f, got %f", tt.name, tt.confidence, confidence)
+		}
+		if (pattern != nil) != (tt.confidence > 0) {
+			t.Errorf("%s: unexpected matched pattern %v", tt.name, pattern)
+		}
+	}
+}
+
+func TestLoadPatterns(t *testing.T) {
+	m := NewSequencePatternMatcher()
+	if err := m.LoadPatterns("recon_patterns.json"); err != nil {
+		t.Fatalf("Failed to load the bundled pattern file: %v", err)
+	}
+	if len(m.Patterns()) != 4 {
+		t.Errorf("Expected 4 patterns, got %d", len(m.Patterns()))
+	}
+
+	path := t.TempDir() + "/patterns.json"
+	os.WriteFile(path, []byte(`[["Decapsulate", "Decapsulate", "Decapsulate"]]`), 0o600)
+	if err := m.LoadPatterns(path); err != nil {
+		t.Fatalf("Failed to load patterns: %v", err)
+	}
+	if _, confidence := m.Match([]string{"KeyGen", "Decapsulate", "Decapsulate", "Decapsulate"}); confidence != 1.0 {
+		t.Errorf("Expected the loaded pattern to match, got confidence %f", confidence)
+	}
+
+	for _, content := range []string{`not json`, `[]`, `[["KeyGen"], []]`} {
+		os.WriteFile(path, []byte(content), 0o600)
+		if err := m.LoadPatterns(path); err == nil {
+			t.Errorf("Expected an error loading %q", content)
+		}
+	}
+	if len(m.Patterns()) != 1 {
+		t.Errorf("Expected a failed load to keep the previous patterns, got %v", m.Patterns())
+	}
+}
+
+func TestDetectReconSequence(t *testing.T) {
+	e, clock := newTestExtractor(t)
+	d := NewAnomalyDetector()
+	req := httptest.NewRequest("POST", "/api/kem/encapsulate", nil)
+	req.RemoteAddr = "192.0.2.10:1234"
+
+	var features RequestFeatures
+	for _, operation := range []string{"KeyGen", "KeyGen", "KeyGen", "Encapsulate", "Decapsulate"} {
+		clock.Advance(5 * time.Second)
+		features = e.ExtractFeatures(req, crypto.AlgMLKEM768, operation, nil, true, 1)
+	}
+
+	anomalous, kind, score := d.Detect(features)
+	if !anomalous || kind != "ReconSequence" || score != 1.0 {
+		t.Fatalf("Expected ReconSequence with score 1, got %v %q %f", anomalous, kind, score)
+	}
+	if threat := NewResponseEngine().ClassifyThreat(features, kind, score); threat.Type != ThreatRecon {
+		t.Errorf("Expected a reconnaissance threat, got %s", threat.Type)
+	}
+}
+
+func TestDecoyEncapsulateSizes(t *testing.T) {
+	engine := NewResponseEngine()
+	registry := crypto.DefaultRegistry()
+
+	for _, alg := range registry.ListKEMAlgorithms() {
+		provider, _ := registry.GetKEMProvider(alg)
+		keyPair, err := provider.KeyGen(context.Background())
+		if err != nil {
+			t.Fatalf("Key generation failed for %s: %v", alg, err)
+		}
+		realCiphertext, realSecret, err := provider.Encapsulate(context.Background(), keyPair.PublicKey)
+		if err != nil {
+			t.Fatalf("Encapsulation failed for %s: %v", alg, err)
+		}
+
+		ciphertext, sharedSecret := engine.GenerateDecoyEncapsulateResponse(alg)
+		if len(ciphertext) != len(realCiphertext) {
+			t.Errorf("Expected %s decoy ciphertext of %d bytes, got %d", alg, len(realCiphertext), len(ciphertext))
+		}
+		if len(sharedSecret) != len(realSecret) {
+			t.Errorf("Expected %s decoy shared secret of %d bytes, got %d", alg, len(realSecret), len(sharedSecret))
+		}
+		if alg == crypto.AlgECDH && ciphertext[0] != 0x04 {
+			t.Errorf("Expected the ECDH decoy to look like an uncompressed point, got prefix %#x", ciphertext[0])
+		}
+
+		// The decoy decapsulates, if at all, to a different secret
+		if secret, err := provider.Decapsulate(context.Background(), keyPair.PrivateKey, ciphertext); err == nil && crypto.SecureCompare(secret, sharedSecret) {
+			t.Errorf("Expected the %s decoy shared secret not to match its ciphertext", alg)
+		}
+	}
+
+	first, _ := engine.GenerateDecoyEncapsulateResponse(crypto.AlgMLKEM768)
+	second, _ := engine.GenerateDecoyEncapsulateResponse(crypto.AlgMLKEM768)
+	if bytes.Equal(first, second) {
+		t.Error("Expected each decoy to be freshly random")
+	}
+}
+
+func TestDeceptionContext(t *testing.T) {
+	ctx := context.Background()
+	if DeceptionEnabled(ctx) {
+		t.Error("Expected deception to be off by default")
+	}
+	if !DeceptionEnabled(WithDeception(ctx)) {
+		t.Error("Expected WithDeception to enable deception")
+	}
+}
+
+// newTestAlerter returns an alerter for url that retries without waiting
+func newTestAlerter(url string) *WebhookAlerter {
+	a := NewWebhookAlerter(url, "test-secret")
+	a.backoff = time.Millisecond
+	return a
+}
+
+func TestWebhookAlerterSignsPayload(t *testing.T) {
+	received := make(chan Threat, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-Signature-256"); got != "sha256="+signPayload("test-secret", body) {
+			t.Errorf("Unexpected signature header %q", got)
+		}
+		var threat Threat
+		if err := json.Unmarshal(body, &threat); err != nil {
+			t.Errorf("Failed to decode alert: %v", err)
+		}
+		received <- threat
+	}))
+	defer server.Close()
+
+	engine := NewResponseEngine()
+	engine.SetAlerter(newTestAlerter(server.URL))
+
+	// Medium threats are not sent
+	engine.ClassifyThreat(RequestFeatures{ClientIP: "192.0.2.30"}, "HighFrequency", 1.0)
+	engine.ClassifyThreat(RequestFeatures{ClientIP: "192.0.2.31"}, "AbnormalLatency", 6.0)
+
+	select {
+	case threat := <-received:
+		if threat.IP != "192.0.2.31" || threat.Level != ThreatLevelCritical {
+			t.Errorf("Expected the critical threat from 192.0.2.31, got %+v", threat)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the alert")
+	}
+	select {
+	case threat := <-received:
+		t.Errorf("Expected a single alert, also got %+v", threat)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhookAlerterSLABreach(t *testing.T) {
+	received := make(chan SLABreachAlert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-Signature-256"); got != "sha256="+signPayload("test-secret", body) {
+			t.Errorf("Unexpected signature header %q", got)
+		}
+		var alert SLABreachAlert
+		if err := json.Unmarshal(body, &alert); err != nil {
+			t.Errorf("Failed to decode alert: %v", err)
+		}
+		received <- alert
+	}))
+	defer server.Close()
+
+	if err := newTestAlerter(server.URL).DispatchSLABreach("ml-kem-768", "Encapsulate", 600, 500); err != nil {
+		t.Fatalf("DispatchSLABreach failed: %v", err)
+	}
+	select {
+	case alert := <-received:
+		if alert.Type != "sla_breach" || alert.Algorithm != "ml-kem-768" || alert.Operation != "Encapsulate" || alert.ActualLatencyUs != 600 || alert.GoalLatencyUs != 500 {
+			t.Errorf("Unexpected alert %+v", alert)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the alert")
+	}
+}
+
+func TestWebhookAlerterRetries(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	a := newTestAlerter(server.URL)
+	if err := a.deliver([]byte(`{}`)); err != nil {
+		t.Errorf("Expected the third attempt to succeed, got %v", err)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts.Load())
+	}
+
+	attempts.Store(-10)
+	if err := a.deliver([]byte(`{}`)); err == nil {
+		t.Error("Expected an error once every attempt fails")
+	}
+	if attempts.Load() != -7 {
+		t.Errorf("Expected delivery to stop after 3 attempts, got %d", attempts.Load()+10)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = RequestIDFromContext(r.Context())
+		if got := RequestLogger(r.Context()).Data["request_id"]; got != seen {
+			t.Errorf("Expected the request ID %q on log entries, got %v", seen, got)
+		}
+	}))
+	serve := func(header string) string {
+		req := httptest.NewRequest("GET", "/api/health", nil)
+		if header != "" {
+			req.Header.Set(RequestIDHeader, header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if echoed := rec.Header().Get(RequestIDHeader); echoed != seen || seen == "" {
+			t.Errorf("Expected the response header to echo %q, got %q", seen, echoed)
+		}
+		return seen
+	}
+
+	// A valid ID from the caller is kept
+	const incoming = "3F2504E0-4F89-41D3-9A0C-0305E82C3301"
+	if id := serve(incoming); id != incoming {
+		t.Errorf("Expected the incoming request ID to be kept, got %q", id)
+	}
+
+	// A missing or invalid ID is replaced by a new UUID v4
+	generated := map[string]bool{}
+	for _, header := range []string{"", "not-a-uuid", "3f2504e0-4f89-41d3-9a0c-0305e82c330g", strings.Repeat("a", 200)} {
+		id := serve(header)
+		if id == header || !validRequestID(id) || id[14] != '4' || generated[id] {
+			t.Errorf("Expected a new UUID v4 in place of %q, got %q", header, id)
+		}
+		generated[id] = true
+	}
+
+	if _, ok := RequestIDFromContext(context.Background()); ok {
+		t.Error("Expected no request ID outside a request")
+	}
+	if _, ok := RequestLogger(context.Background()).Data["request_id"]; ok {
+		t.Error("Expected no request ID on log entries outside a request")
+	}
+}
+
+func TestPreScreenEntropy(t *testing.T) {
+	random := make([]byte, 2048)
+	rand.Read(random)
+
+	tests := []struct {
+		name   string
+		body   []byte
+		passes bool
+	}{
+		{"random", random, true},
+		{"hex", []byte(hex.EncodeToString(random)), false},
+		{"repeated", bytes.Repeat([]byte{'A'}, 2048), false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		if got := PreScreenEntropy(tt.body, DefaultMinBodyEntropy); got != tt.passes {
+			t.Errorf("%s: expected pre-screen %v, got %v", tt.name, tt.passes, got)
+		}
+	}
+}
+
+func TestAISecurityMiddlewarePreScreen(t *testing.T) {
+	var analyzed int
+	m := NewAISecurityMiddleware()
+	m.analyze = func(string) (*AnalysisResponse, error) {
+		analyzed++
+		return &AnalysisResponse{Action: "PASS"}, nil
+	}
+	var received []byte
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+
+	random := make([]byte, 3*maxPreScreenBytes)
+	rand.Read(random)
+	tests := []struct {
+		name     string
+		body     []byte
+		analyzed int
+		screened string
+	}{
+		{"random", random, 0, ""},
+		{"low entropy", bytes.Repeat([]byte("abcd"), 1024), 1, "true"},
+		{"empty", nil, 1, ""},
+	}
+	for _, tt := range tests {
+		analyzed = 0
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/kem/encapsulate", bytes.NewReader(tt.body)))
+		if analyzed != tt.analyzed {
+			t.Errorf("%s: expected %d analysis calls, got %d", tt.name, tt.analyzed, analyzed)
+		}
+		if got := rec.Header().Get(EntropyScreenedHeader); got != tt.screened {
+			t.Errorf("%s: expected %s %q, got %q", tt.name, EntropyScreenedHeader, tt.screened, got)
+		}
+		if !bytes.Equal(received, tt.body) {
+			t.Errorf("%s: expected the handler to read the whole body, got %d of %d bytes", tt.name, len(received), len(tt.body))
+		}
+	}
+}
+
+func BenchmarkPreScreenEntropy(b *testing.B) {
+	body := make([]byte, 2048)
+	rand.Read(body)
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		PreScreenEntropy(body, DefaultMinBodyEntropy)
+	}
+}
+
+func TestThrottleMiddlewareRateLimitHeaders(t *testing.T) {
+	engine := NewResponseEngine()
+	engine.ApplyAction(ActionThrottle, "192.0.2.20")
+	handler := NewThrottleMiddleware(engine).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/health", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Clients that were never throttled get no rate limit headers
+	if rec := serve("192.0.2.21"); rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Limit") != "" {
+		t.Errorf("Expected an unthrottled client to pass without headers, got %d %v", rec.Code, rec.Header())
+	}
+
+	// The initial limit is 5 requests per second with a burst of 3
+	for i := 2; i >= 0; i-- {
+		rec := serve("192.0.2.20")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected a request within the burst to pass, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != strconv.Itoa(i) {
+			t.Errorf("Expected %d remaining requests, got %q", i, got)
+		}
+	}
+
+	before := time.Now().Unix()
+	rec := serve("192.0.2.20")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d once the burst is spent, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "300" {
+		t.Errorf("Expected a limit of 300 requests per minute, got %q", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("Expected 0 remaining requests, got %q", got)
+	}
+	reset, err := strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || reset < before || reset > before+2 {
+		t.Errorf("Expected a reset time within a second of %d, got %q", before, rec.Header().Get("X-RateLimit-Reset"))
+	}
+}
+
+func TestThreatHub(t *testing.T) {
+	hub := NewThreatHub()
+
+	subscribers := make([]<-chan Threat, 0, maxThreatSubscribers)
+	for i := 0; i < maxThreatSubscribers; i++ {
+		ch := hub.Subscribe()
+		if ch == nil {
+			t.Fatalf("Expected subscriber %d to be accepted", i+1)
+		}
+		subscribers = append(subscribers, ch)
+	}
+	if hub.Subscribe() != nil {
+		t.Fatalf("Expected more than %d subscribers to be refused", maxThreatSubscribers)
+	}
+
+	hub.Publish(Threat{IP: "192.0.2.30"})
+	for i, ch := range subscribers {
+		if threat := <-ch; threat.IP != "192.0.2.30" {
+			t.Errorf("Subscriber %d: Expected the published threat, got %+v", i, threat)
+		}
+	}
+
+	// A subscriber that stops reading loses threats instead of blocking Publish
+	for i := 0; i < threatSubscriberBuffer+5; i++ {
+		hub.Publish(Threat{IP: "192.0.2.31"})
+	}
+	if len(subscribers[0]) != threatSubscriberBuffer {
+		t.Errorf("Expected %d buffered threats, got %d", threatSubscriberBuffer, len(subscribers[0]))
+	}
+
+	// Unsubscribing closes the channel and frees a slot
+	hub.Unsubscribe(subscribers[0])
+	for range subscribers[0] {
+	}
+	if hub.Subscribe() == nil {
+		t.Error("Expected a subscriber to be accepted after another left")
+	}
+	hub.Unsubscribe(subscribers[0])
+}
+
+func TestClassifyThreatPublishes(t *testing.T) {
+	engine := NewResponseEngine()
+	threats := engine.Threats().Subscribe()
+	defer engine.Threats().Unsubscribe(threats)
+
+	engine.ClassifyThreat(RequestFeatures{ClientIP: "192.0.2.32"}, "AbnormalLatency", 6.0)
+	select {
+	case threat := <-threats:
+		if threat.IP != "192.0.2.32" || threat.Level != ThreatLevelCritical {
+			t.Errorf("Expected the classified threat, got %+v", threat)
+		}
+	default:
+		t.Error("Expected ClassifyThreat to publish the threat")
+	}
+}
+
+// newIdempotencyTestHandler wraps a handler counting its calls and answering
+// with the count in an idempotency middleware. Requests for /fail get a 500.
+func newIdempotencyTestHandler(t *testing.T) (*IdempotencyMiddleware, http.Handler, *atomic.Int64) {
+	t.Helper()
+	m := NewIdempotencyMiddleware()
+	t.Cleanup(m.Stop)
+	var calls atomic.Int64
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(map[string]int64{"call": n})
+	}))
+	return m, handler, &calls
+}
+
+// serveIdempotent sends a POST to path from ip with an idempotency key
+func serveIdempotent(handler http.Handler, ip, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader("{}"))
+	req.RemoteAddr = ip + ":1234"
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyMiddlewareReplay(t *testing.T) {
+	_, handler, calls := newIdempotencyTestHandler(t)
+
+	first := serveIdempotent(handler, "192.0.2.40", "/api/encrypt", "retry-1")
+	second := serveIdempotent(handler, "192.0.2.40", "/api/encrypt", "retry-1")
+	if calls.Load() != 1 {
+		t.Fatalf("Expected a retry to be replayed, handler ran %d times", calls.Load())
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("Expected the first response to be replayed, got %d %s", second.Code, second.Body.String())
+	}
+	if second.Header().Get(IdempotentReplayHeader) != "true" || first.Header().Get(IdempotentReplayHeader) != "" {
+		t.Error("Expected only the replayed response to be marked")
+	}
+	if second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the replay to keep its content type, got %q", second.Header().Get("Content-Type"))
+	}
+
+	// Another key, client or endpoint is a different request, as is one
+	// without a key at all
+	serveIdempotent(handler, "192.0.2.40", "/api/encrypt", "retry-2")
+	serveIdempotent(handler, "192.0.2.41", "/api/encrypt", "retry-1")
+	serveIdempotent(handler, "192.0.2.40", "/api/decrypt", "retry-1")
+	serveIdempotent(handler, "192.0.2.40", "/api/encrypt", "")
+	serveIdempotent(handler, "192.0.2.40", "/api/encrypt", "")
+	if calls.Load() != 6 {
+		t.Errorf("Expected 6 handler calls, got %d", calls.Load())
+	}
+
+	// Server errors aren't kept, so their retries run again
+	serveIdempotent(handler, "192.0.2.40", "/fail", "retry-3")
+	if rec := serveIdempotent(handler, "192.0.2.40", "/fail", "retry-3"); rec.Header().Get(IdempotentReplayHeader) != "" {
+		t.Error("Expected a server error not to be replayed")
+	}
+	if calls.Load() != 8 {
+		t.Errorf("Expected both failing requests to run, got %d handler calls", calls.Load())
+	}
+
+	if rec := serveIdempotent(handler, "192.0.2.40", "/api/encrypt", strings.Repeat("k", maxIdempotencyKeyLength+1)); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an overlong key, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestIdempotencyMiddlewareConcurrentRetries(t *testing.T) {
+	m := NewIdempotencyMiddleware()
+	t.Cleanup(m.Stop)
+	release := make(chan struct{})
+	var calls atomic.Int64
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte("done"))
+	}))
+
+	// Retries arriving while the first request runs wait for its response
+	results := make(chan *httptest.ResponseRecorder, 5)
+	for i := 0; i < 5; i++ {
+		go func() { results <- serveIdempotent(handler, "192.0.2.42", "/api/encrypt", "slow") }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 5; i++ {
+		if rec := <-results; rec.Body.String() != "done" {
+			t.Errorf("Expected every request to get the response, got %q", rec.Body.String())
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected concurrent retries to run once, handler ran %d times", calls.Load())
+	}
+}
+
+func TestIdempotencyMiddlewareExpiry(t *testing.T) {
+	m, handler, calls := newIdempotencyTestHandler(t)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	serveIdempotent(handler, "192.0.2.43", "/api/encrypt", "expiring")
+	serveIdempotent(handler, "192.0.2.43", "/api/decrypt", "evicted")
+	now = now.Add(idempotencyTTL - time.Second)
+	if rec := serveIdempotent(handler, "192.0.2.43", "/api/encrypt", "expiring"); rec.Header().Get(IdempotentReplayHeader) != "true" {
+		t.Error("Expected the response to be replayed before it expires")
+	}
+
+	// An expired response is replaced by that of the request that runs instead
+	now = now.Add(2 * time.Second)
+	if rec := serveIdempotent(handler, "192.0.2.43", "/api/encrypt", "expiring"); rec.Header().Get(IdempotentReplayHeader) != "" {
+		t.Error("Expected an expired response not to be replayed")
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected the request to run again after expiry, got %d handler calls", calls.Load())
+	}
+	if rec := serveIdempotent(handler, "192.0.2.43", "/api/encrypt", "expiring"); rec.Header().Get(IdempotentReplayHeader) != "true" {
+		t.Error("Expected the new response to be replayed")
+	}
+
+	// Eviction drops only the expired response
+	m.evictExpired()
+	if size := m.size.Load(); size != 1 {
+		t.Errorf("Expected 1 response left after eviction, got %d", size)
+	}
+	if _, ok := m.entries.Load(idempotencyKey{"192.0.2.43", "evicted", "POST /api/decrypt"}); ok {
+		t.Error("Expected the expired response to be evicted")
+	}
+}
+
+// registerTestClient registers a new key pair for alg through the admin endpoint
+func registerTestClient(t *testing.T, r *mux.Router, alg crypto.Algorithm) (string, crypto.KeyPair) {
+	t.Helper()
+	keyPair, err := clientSignatureProviders[alg].KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("%s: key generation failed: %v", alg, err)
+	}
+	body, _ := json.Marshal(ClientRegisterRequest{
+		Name:      "test " + string(alg),
+		Algorithm: string(alg),
+		PublicKey: hex.EncodeToString(keyPair.PublicKey),
+	})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/api/admin/clients/register", bytes.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("%s: registration failed: %d %s", alg, rec.Code, rec.Body.String())
+	}
+	var resp ClientRegisterResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.ClientID == "" {
+		t.Fatalf("%s: expected a client ID, got %q (%v)", alg, rec.Body.String(), err)
+	}
+	return resp.ClientID, keyPair
+}
+
+// signTestRequest sets the signature headers on req, signing body as it was
+// when the request was made
+func signTestRequest(t *testing.T, req *http.Request, clientID string, keyPair crypto.KeyPair, body []byte, at time.Time) {
+	t.Helper()
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	signature, err := clientSignatureProviders[keyPair.Algorithm].Sign(context.Background(), keyPair.PrivateKey, SignedMessage(req.Method, req.URL.Path, body, timestamp))
+	if err != nil {
+		t.Fatalf("Signing failed: %v", err)
+	}
+	req.Header.Set(ClientIDHeader, clientID)
+	req.Header.Set(SignatureTimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, hex.EncodeToString(signature))
+}
+
+func TestRequestSignatureMiddleware(t *testing.T) {
+	db := openTestDB(t)
+	clients, err := NewClientRegistry(db)
+	if err != nil {
+		t.Fatalf("Failed to create client registry: %v", err)
+	}
+	admin := mux.NewRouter()
+	clients.RegisterRoutes(admin.PathPrefix("/api/admin").Subrouter())
+
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	signing := NewRequestSignatureMiddleware(clients)
+	signing.now = clock.Now
+	var analyzed int
+	ai := NewAISecurityMiddleware()
+	ai.analyze = func(string) (*AnalysisResponse, error) {
+		analyzed++
+		return &AnalysisResponse{Action: "PASS"}, nil
+	}
+	var received []byte
+	var signedBy string
+	handler := signing.Middleware(ai.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		signedBy, _ = SignedClientID(r.Context())
+	})))
+
+	body := []byte(`{"message":"hello"}`)
+	for _, alg := range []crypto.Algorithm{crypto.AlgMLDSA65, crypto.AlgECDSA} {
+		clientID, keyPair := registerTestClient(t, admin, alg)
+		_, otherKeyPair := registerTestClient(t, admin, alg)
+
+		tests := []struct {
+			name   string
+			sign   func(req *http.Request)
+			status int
+			signed bool
+		}{
+			{"unsigned", func(*http.Request) {}, http.StatusOK, false},
+			{"valid", func(req *http.Request) {
+				signTestRequest(t, req, clientID, keyPair, body, clock.Now())
+			}, http.StatusOK, true},
+			{"small skew", func(req *http.Request) {
+				signTestRequest(t, req, clientID, keyPair, body, clock.Now().Add(-25*time.Second))
+			}, http.StatusOK, true},
+			{"stale timestamp", func(req *http.Request) {
+				signTestRequest(t, req, clientID, keyPair, body, clock.Now().Add(-31*time.Second))
+			}, http.StatusUnauthorized, false},
+			{"future timestamp", func(req *http.Request) {
+				signTestRequest(t, req, clientID, keyPair, body, clock.Now().Add(31*time.Second))
+			}, http.StatusUnauthorized, false},
+			{"tampered body", func(req *http.Request) {
+				signTestRequest(t, req, clientID, keyPair, []byte(`{"message":"other"}`), clock.Now())
+			}, http.StatusUnauthorized, false},
+			{"other client's key", func(req *http.Request) {
+				signTestRequest(t, req, clientID, otherKeyPair, body, clock.Now())
+			}, http.StatusUnauthorized, false},
+			{"unknown client", func(req *http.Request) {
+				signTestRequest(t, req, "0123456789abcdef", keyPair, body, clock.Now())
+			}, http.StatusUnauthorized, false},
+			{"missing signature", func(req *http.Request) {
+				signTestRequest(t, req, clientID, keyPair, body, clock.Now())
+				req.Header.Del(SignatureHeader)
+			}, http.StatusUnauthorized, false},
+		}
+		for _, tt := range tests {
+			analyzed, received, signedBy = 0, nil, ""
+			req := httptest.NewRequest("POST", "/api/sign/ml-dsa-65/sign", bytes.NewReader(body))
+			tt.sign(req)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("%s %s: expected status %d, got %d", alg, tt.name, tt.status, rec.Code)
+				continue
+			}
+			if tt.status != http.StatusOK {
+				continue
+			}
+			if !bytes.Equal(received, body) {
+				t.Errorf("%s %s: expected the handler to read the whole body, got %q", alg, tt.name, received)
+			}
+			if tt.signed && (signedBy != clientID || analyzed != 0) {
+				t.Errorf("%s %s: expected a request signed by %s to skip analysis, got client %q and %d analysis calls", alg, tt.name, clientID, signedBy, analyzed)
+			}
+			if !tt.signed && (signedBy != "" || analyzed != 1) {
+				t.Errorf("%s %s: expected an unsigned request to be analyzed, got client %q and %d analysis calls", alg, tt.name, signedBy, analyzed)
+			}
+		}
+	}
+
+	var registered int
+	db.QueryRow("SELECT COUNT(*) FROM clients").Scan(&registered)
+	if registered != 4 {
+		t.Errorf("Expected 4 registered clients, got %d", registered)
+	}
+}
+
+func TestRegisterClientValidation(t *testing.T) {
+	clients, err := NewClientRegistry(openTestDB(t))
+	if err != nil {
+		t.Fatalf("Failed to create client registry: %v", err)
+	}
+	r := mux.NewRouter()
+	clients.RegisterRoutes(r.PathPrefix("/api/admin").Subrouter())
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid JSON", `{`},
+		{"unsupported algorithm", `{"algorithm":"ml-dsa-44","public_key":"00"}`},
+		{"invalid hex", `{"algorithm":"ecdsa","public_key":"zz"}`},
+		{"wrong size", `{"algorithm":"ml-dsa-65","public_key":"0011"}`},
+		{"not a point", `{"algorithm":"ecdsa","public_key":"` + strings.Repeat("ff", 33) + `"}`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/api/admin/clients/register", strings.NewReader(tt.body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", tt.name, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestApplyConfigTogglesDeception(t *testing.T) {
+	engine := NewResponseEngine()
+	ip := "192.0.2.30"
+	threat := engine.ClassifyThreat(RequestFeatures{ClientIP: ip}, "LowEntropy", 3.0)
+	if !engine.ShouldDeceive(ip) || engine.DecideAction(threat) != ActionDeceive {
+		t.Fatal("Expected a high-level threat to be deceived by default")
+	}
+
+	config := engine.Config()
+	config.DeceptionEnabled = false
+	engine.ApplyConfig(config)
+	if engine.ShouldDeceive(ip) {
+		t.Error("Expected deception to stop as soon as it is disabled")
+	}
+	if action := engine.DecideAction(threat); action != ActionThrottle {
+		t.Errorf("Expected a high-level threat to be throttled without deception, got %s", action)
+	}
+
+	config.DeceptionEnabled = true
+	engine.ApplyConfig(config)
+	if !engine.ShouldDeceive(ip) {
+		t.Error("Expected deception to resume as soon as it is enabled")
+	}
+
+	// A low-level threat pushes the high-level one out of a one-threat window
+	engine.ClassifyThreat(RequestFeatures{ClientIP: ip}, "Unknown", 0)
+	config.HistoryWindowSize = 1
+	engine.ApplyConfig(config)
+	if engine.ShouldDeceive(ip) {
+		t.Error("Expected threats outside the history window to be ignored")
+	}
+}
+
+func TestApplyConfigThrottleRateFloor(t *testing.T) {
+	engine := NewResponseEngine()
+	config := engine.Config()
+	config.ThrottleRateFloor = 2
+	engine.ApplyConfig(config)
+
+	ip := "192.0.2.31"
+	for i := 0; i < 5; i++ {
+		engine.ApplyAction(ActionThrottle, ip)
+	}
+	if limit := engine.throttlingMap[ip].Limit(); limit != 2 {
+		t.Errorf("Expected repeated throttling to stop at 2 requests per second, got %v", limit)
+	}
+}
+
+func TestResponseEngineConfigEndpoints(t *testing.T) {
+	db := openTestDB(t)
+	engine := NewResponseEngineWithDB(db)
+	r := mux.NewRouter()
+	engine.RegisterRoutes(r.PathPrefix("/api/admin").Subrouter())
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, "/api/admin/response-engine/config", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve("GET", "")
+	var config ResponseEngineConfig
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil || config != DefaultResponseEngineConfig() {
+		t.Fatalf("Expected the default config, got %d %+v (%v)", rec.Code, config, err)
+	}
+
+	rec = serve("PATCH", `{"deception_enabled": false, "honeypot_ip": "2001:db8::10"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Config update failed: %d %s", rec.Code, rec.Body.String())
+	}
+	want := DefaultResponseEngineConfig()
+	want.DeceptionEnabled = false
+	want.HoneypotIP = "2001:db8::10"
+	if got := engine.Config(); got != want {
+		t.Errorf("Expected the settings left out to keep their values, got %+v", got)
+	}
+
+	for _, body := range []string{
+		`{"honeypot_ip": "honeypot.local"}`,
+		`{"throttle_rate_floor": 0.001}`,
+		`{"history_window_size": 0}`,
+		`[]`,
+	} {
+		if rec := serve("PATCH", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, rec.Code)
+		}
+	}
+	if got := engine.Config(); got != want {
+		t.Errorf("Expected rejected updates to change nothing, got %+v", got)
+	}
+
+	var changes int
+	db.QueryRow("SELECT COUNT(*) FROM event_logs WHERE event_type = ? AND severity = 'WARNING'", responseConfigEventType).Scan(&changes)
+	if changes != 1 {
+		t.Errorf("Expected 1 config change event, got %d", changes)
+	}
+}
+
+func TestSimulateAttack(t *testing.T) {
+	engine := NewResponseEngine()
+	r := mux.NewRouter()
+	NewAttackSimulator(NewAnomalyDetector(), engine).RegisterRoutes(r.PathPrefix("/api/admin").Subrouter())
+
+	simulate := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/api/admin/simulate-attack", strings.NewReader(body)))
+		return rec
+	}
+
+	tests := []struct {
+		body    string
+		anomaly string
+		threat  ThreatType
+		level   ThreatLevel
+		action  ActionType
+	}{
+		{`{"attack_type": "rapid_requests", "source_ip": "203.0.113.7"}`, "RapidRequests", ThreatRecon, ThreatLevelMedium, ActionThrottle},
+		{`{"attack_type": "low_entropy", "source_ip": "203.0.113.7"}`, "LowEntropy", ThreatImplementation, ThreatLevelMedium, ActionThrottle},
+		{`{"attack_type": "low_entropy", "source_ip": "203.0.113.7", "intensity": 3}`, "LowEntropy", ThreatImplementation, ThreatLevelHigh, ActionDeceive},
+		{`{"attack_type": "abnormal_latency", "source_ip": "203.0.113.7"}`, "AbnormalLatency", ThreatSideChannel, ThreatLevelCritical, ActionRedirect},
+		{`{"attack_type": "abnormal_latency", "source_ip": "203.0.113.7", "intensity": 0.5}`, "AbnormalLatency", ThreatSideChannel, ThreatLevelHigh, ActionDeceive},
+		{`{"attack_type": "recon_sequence", "source_ip": "2001:db8::7"}`, "ReconSequence", ThreatRecon, ThreatLevelHigh, ActionDeceive},
+		{`{"attack_type": "recon_sequence", "source_ip": "2001:db8::7", "intensity": 0.8}`, "ReconSequence", ThreatRecon, ThreatLevelMedium, ActionThrottle},
+	}
+	for _, tt := range tests {
+		rec := simulate(tt.body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d %s", tt.body, http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var resp SimulateAttackResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.body, err)
+		}
+		if !resp.Detected || resp.AnomalyType != tt.anomaly || resp.Threat == nil {
+			t.Fatalf("%s: expected a %s anomaly, got %+v", tt.body, tt.anomaly, resp)
+		}
+		if resp.Threat.Type != tt.threat || resp.Threat.Level != tt.level || resp.Action != tt.action {
+			t.Errorf("%s: expected %s at level %d and %s, got %s at level %d and %s",
+				tt.body, tt.threat, tt.level, tt.action, resp.Threat.Type, resp.Threat.Level, resp.Action)
+		}
+		if !resp.SyntheticBaseline {
+			t.Errorf("%s: expected an untrained detector to use a synthetic baseline", tt.body)
+		}
+	}
+
+	if len(engine.threatHistory["203.0.113.7"]) != 0 || engine.ShouldThrottle("203.0.113.7") {
+		t.Error("Expected a simulation to leave no threat history and apply no action")
+	}
+
+	for _, body := range []string{
+		`{"attack_type": "port_scan", "source_ip": "203.0.113.7"}`,
+		`{"attack_type": "low_entropy", "source_ip": "not-an-ip"}`,
+		`{"attack_type": "low_entropy", "source_ip": "203.0.113.7", "intensity": -1}`,
+		`{"attack_type": "low_entropy", "source_ip": "203.0.113.7", "intensity": 101}`,
+		`[]`,
+	} {
+		if rec := simulate(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestSimulateAttackTrainedDetector(t *testing.T) {
+	detector := NewAnomalyDetector()
+	for i := 0; i < minBaselineSamples; i++ {
+		detector.Train(RequestFeatures{
+			InputEntropy:      7.5 + float64(i%3)/10,
+			InterRequestTime:  1 + float64(i%4)/4,
+			RequestsPerMinute: 8 + i%3,
+			OperationLatency:  5 + float64(i%5)/5,
+		})
+	}
+	simulator := NewAttackSimulator(detector, NewResponseEngine())
+
+	resp, err := simulator.Simulate(SimulateAttackRequest{AttackType: AttackAbnormalLatency, SourceIP: "203.0.113.7", Intensity: 1})
+	if err != nil {
+		t.Fatalf("Simulate failed: %v", err)
+	}
+	if resp.SyntheticBaseline {
+		t.Error("Expected a trained detector's own baseline to be used")
+	}
+	if resp.Features.OperationLatency <= 5 || resp.AnomalyType != "AbnormalLatency" || resp.Action != ActionRedirect {
+		t.Errorf("Expected a redirected latency anomaly against the trained baseline, got %+v", resp)
+	}
+	if samples, _, _ := detector.baseline(); samples != minBaselineSamples {
+		t.Errorf("Expected a simulation not to train the detector, got %d samples", samples)
+	}
+}
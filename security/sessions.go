@@ -0,0 +1,160 @@
+package security
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// sessionIDBytes is the number of random bytes in a session ID
+const sessionIDBytes = 32
+
+// errInvalidSession is returned for a token that is not the ID of a live
+// session: unknown, expired or revoked
+var errInvalidSession = errors.New("invalid session")
+
+// sessionsSchema makes sure the sessions table exists. It mirrors database/schema.sql.
+var sessionsSchema = []string{
+	`CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at)`,
+}
+
+// PurgeSessionsResponse reports how many sessions a purge removed
+type PurgeSessionsResponse struct {
+	Purged int64 `json:"purged"`
+}
+
+// IssueToken starts a session for the registered user named user.Name and
+// returns its token and the time it expires. The session carries the user's
+// current role from the users table, not user.Role.
+func (a *Authenticator) IssueToken(user User) (string, time.Time, error) {
+	random := make([]byte, sessionIDBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(random)
+
+	// Timestamps are stored in UTC to the second so they compare as text
+	now := a.now().UTC().Truncate(time.Second)
+	expiresAt := now.Add(sessionTTL)
+	result, err := a.db.Exec(
+		"INSERT INTO sessions (id, user_id, created_at, expires_at) SELECT ?, id, ?, ? FROM users WHERE username = ?",
+		id, now, expiresAt, user.Name,
+	)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to store session: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 1 {
+		return "", time.Time{}, fmt.Errorf("failed to store session: no user %q", user.Name)
+	}
+	return id, expiresAt, nil
+}
+
+// Authenticate returns the user of the session whose ID is token. Unknown,
+// expired and revoked sessions fail with errInvalidSession.
+func (a *Authenticator) Authenticate(token string) (User, error) {
+	var user User
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err := a.db.QueryRow(
+		`SELECT u.username, COALESCE(u.role, ?), s.expires_at, s.revoked_at
+		FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.id = ?`,
+		RoleUser, token,
+	).Scan(&user.Name, &user.Role, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("%w: unknown session", errInvalidSession)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("failed to look up session: %w", err)
+	}
+	if revokedAt.Valid {
+		return User{}, fmt.Errorf("%w: session was revoked", errInvalidSession)
+	}
+	if !a.now().Before(expiresAt) {
+		return User{}, fmt.Errorf("%w: session has expired", errInvalidSession)
+	}
+	return user, nil
+}
+
+// Revoke ends the session whose ID is token. Revoking an unknown or already
+// revoked session does nothing.
+func (a *Authenticator) Revoke(token string) error {
+	_, err := a.db.Exec(
+		"UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		a.now().UTC().Truncate(time.Second), token,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredSessions deletes the sessions that have expired or been
+// revoked, returning how many were deleted
+func (a *Authenticator) PurgeExpiredSessions() (int64, error) {
+	result, err := a.db.Exec(
+		"DELETE FROM sessions WHERE expires_at <= ? OR revoked_at IS NOT NULL",
+		a.now().UTC().Truncate(time.Second),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RegisterAdminRoutes adds the session maintenance endpoints to a router
+// mounted at /api/admin
+func (a *Authenticator) RegisterAdminRoutes(r *mux.Router) {
+	r.HandleFunc("/sessions/purge-expired", a.HandlePurgeExpiredSessions()).Methods("POST")
+}
+
+// HandleLogout revokes the session of the request's bearer token
+func (a *Authenticator) HandleLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := a.Revoke(requestToken(r)); err != nil {
+			RequestLogger(r.Context()).WithError(err).Error("Failed to log out")
+			writeACLError(w, http.StatusInternalServerError, "failed to log out")
+			return
+		}
+
+		user, _ := UserFromContext(r.Context())
+		RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"username": user.Name,
+			"ip":       peerIP(r),
+		}).Info("User logged out")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandlePurgeExpiredSessions deletes expired and revoked sessions
+func (a *Authenticator) HandlePurgeExpiredSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		purged, err := a.PurgeExpiredSessions()
+		if err != nil {
+			RequestLogger(r.Context()).WithError(err).Error("Failed to purge sessions")
+			writeACLError(w, http.StatusInternalServerError, "failed to purge sessions")
+			return
+		}
+
+		RequestLogger(r.Context()).WithFields(logrus.Fields{
+			"purged": purged,
+			"ip":     peerIP(r),
+		}).Info("Purged expired sessions")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PurgeSessionsResponse{Purged: purged})
+	}
+}
@@ -0,0 +1,182 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// ThresholdConfig holds the thresholds AnomalyDetector flags requests at. It
+// is read from anomaly_config.yaml and the /api/admin/anomaly-config endpoint.
+type ThresholdConfig struct {
+	EntropyThreshold           float64 `yaml:"entropy_threshold" json:"entropy_threshold"`                         // Input entropy, in bits per byte, below which input looks non-random
+	InterRequestTimeThreshold  float64 `yaml:"inter_request_time_threshold" json:"inter_request_time_threshold"`   // Seconds between requests below which they are too fast
+	RequestsPerMinuteThreshold int     `yaml:"requests_per_minute_threshold" json:"requests_per_minute_threshold"` // Requests in the trailing 60 seconds above which a client is too busy
+	SequenceThreshold          float64 `yaml:"sequence_threshold" json:"sequence_threshold"`                       // Fraction of a reconnaissance pattern that must match
+	MahalanobisThreshold       float64 `yaml:"mahalanobis_threshold" json:"mahalanobis_threshold"`                 // Distance above which a feature combination is an outlier
+}
+
+// DefaultThresholdConfig returns the thresholds a new AnomalyDetector uses
+func DefaultThresholdConfig() ThresholdConfig {
+	return ThresholdConfig{
+		EntropyThreshold:           6.0,
+		InterRequestTimeThreshold:  0.1,
+		RequestsPerMinuteThreshold: 20,
+		SequenceThreshold:          minSequenceConfidence,
+		MahalanobisThreshold:       defaultMahalanobisThreshold,
+	}
+}
+
+// Validate reports the first threshold that is out of range
+func (c ThresholdConfig) Validate() error {
+	switch {
+	case c.EntropyThreshold < 0 || c.EntropyThreshold > 8:
+		return errors.New("entropy_threshold must be between 0 and 8")
+	case c.InterRequestTimeThreshold < 0:
+		return errors.New("inter_request_time_threshold must not be negative")
+	case c.RequestsPerMinuteThreshold < 1:
+		return errors.New("requests_per_minute_threshold must be at least 1")
+	case c.SequenceThreshold <= 0 || c.SequenceThreshold > 1:
+		return errors.New("sequence_threshold must be above 0 and at most 1")
+	case c.MahalanobisThreshold <= 0:
+		return errors.New("mahalanobis_threshold must be positive")
+	}
+	return nil
+}
+
+// LoadThresholdConfig reads thresholds from a YAML file. Thresholds the file
+// leaves out keep their defaults.
+func LoadThresholdConfig(path string) (ThresholdConfig, error) {
+	config := DefaultThresholdConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read anomaly config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse anomaly config: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid anomaly config: %w", err)
+	}
+	return config, nil
+}
+
+// Thresholds returns the thresholds Detect currently uses
+func (d *AnomalyDetector) Thresholds() ThresholdConfig {
+	return *d.thresholds.Load()
+}
+
+// SetThresholds replaces the thresholds. Detect picks them up with its next
+// call, without waiting for calls in progress.
+func (d *AnomalyDetector) SetThresholds(config ThresholdConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	d.thresholds.Store(&config)
+	return nil
+}
+
+// WatchThresholds loads the thresholds from a YAML file and reloads them
+// whenever it changes, until stop is called. A missing file leaves the current
+// thresholds until it is created; a file that fails to load is logged and
+// ignored. The file's directory is watched, so editors that replace the file
+// rather than writing it in place are noticed too.
+func (d *AnomalyDetector) WatchThresholds(path string) (stop func() error, err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anomaly config watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch anomaly config: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		d.reloadThresholds(path)
+	} else {
+		logrus.WithField("path", path).Info("No anomaly config file, using the current thresholds")
+	}
+
+	go func() {
+		name := filepath.Clean(path)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == name && event.Has(fsnotify.Write|fsnotify.Create) {
+					d.reloadThresholds(path)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.WithError(err).Warn("Anomaly config watcher failed")
+			}
+		}
+	}()
+	return watcher.Close, nil
+}
+
+// reloadThresholds replaces the thresholds with those in a YAML file, keeping
+// the current ones if it can't be loaded. An empty file is skipped: rewriting a
+// file truncates it first, and loading it then would reset every threshold.
+func (d *AnomalyDetector) reloadThresholds(path string) {
+	if info, err := os.Stat(path); err == nil && info.Size() == 0 {
+		return
+	}
+	config, err := LoadThresholdConfig(path)
+	if err != nil {
+		logrus.WithError(err).WithField("path", path).Error("Keeping the current anomaly thresholds")
+		return
+	}
+	d.thresholds.Store(&config)
+	logrus.WithFields(logrus.Fields{
+		"path":       path,
+		"thresholds": config,
+	}).Info("Anomaly thresholds loaded")
+}
+
+// RegisterRoutes adds the threshold endpoints to a router mounted at /api/admin
+func (d *AnomalyDetector) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/anomaly-config", d.HandleGetThresholds()).Methods("GET")
+	r.HandleFunc("/anomaly-config", d.HandleUpdateThresholds()).Methods("PUT")
+}
+
+// HandleGetThresholds reports the current thresholds
+func (d *AnomalyDetector) HandleGetThresholds() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.Thresholds())
+	}
+}
+
+// HandleUpdateThresholds replaces the thresholds with those in the JSON request
+// body. Thresholds the body leaves out keep their current values. The change
+// is not written to the config file, so an edit of the file overrides it.
+func (d *AnomalyDetector) HandleUpdateThresholds() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := d.Thresholds()
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeACLError(w, http.StatusBadRequest, "request body must be a JSON object of thresholds")
+			return
+		}
+		if err := d.SetThresholds(config); err != nil {
+			writeACLError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		RequestLogger(r.Context()).WithField("thresholds", config).Warn("Anomaly thresholds updated")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(config)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/handlers"
+)
+
+// defaultCORSMethods are the methods cross-origin requests may use when
+// CORS_ALLOWED_METHODS is not set
+var defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+
+// CORSConfig is the cross-origin policy, the same settings the backend reads
+// from its cors config section
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	MaxAgeSec        int
+	AllowCredentials bool
+}
+
+// DefaultCORSConfig allows any origin, without credentials. Production
+// deployments should list their origins instead.
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: defaultCORSMethods,
+	}
+}
+
+// CORSConfigFromEnv reads the policy from CORS_ALLOWED_ORIGINS and
+// CORS_ALLOWED_METHODS (comma-separated), CORS_MAX_AGE_SEC and
+// CORS_ALLOW_CREDENTIALS, falling back to DefaultCORSConfig for unset
+// variables, and validates it
+func CORSConfigFromEnv() (CORSConfig, error) {
+	cfg := DefaultCORSConfig()
+	var problems []string
+
+	if value := os.Getenv("CORS_ALLOWED_ORIGINS"); value != "" {
+		cfg.AllowedOrigins = splitList(value)
+	}
+	if value := os.Getenv("CORS_ALLOWED_METHODS"); value != "" {
+		cfg.AllowedMethods = splitList(value)
+	}
+	if value := os.Getenv("CORS_MAX_AGE_SEC"); value != "" {
+		maxAge, err := strconv.Atoi(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("CORS_MAX_AGE_SEC must be a number of seconds, got %q", value))
+		}
+		cfg.MaxAgeSec = maxAge
+	}
+	if value := os.Getenv("CORS_ALLOW_CREDENTIALS"); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("CORS_ALLOW_CREDENTIALS must be true or false, got %q", value))
+		}
+		cfg.AllowCredentials = allow
+	}
+
+	if err := ValidateCORSConfig(cfg); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		return CORSConfig{}, fmt.Errorf("invalid CORS configuration: %s", strings.Join(problems, "; "))
+	}
+	return cfg, nil
+}
+
+// ValidateCORSConfig checks a CORS policy. A wildcard origin is rejected when
+// credentials are allowed, since the CORS spec forbids answering a
+// credentialed request with Access-Control-Allow-Origin: *. Origins are matched
+// exactly, so "*" is the only wildcard accepted.
+func ValidateCORSConfig(cfg CORSConfig) error {
+	var problems []string
+
+	if len(cfg.AllowedOrigins) == 0 {
+		problems = append(problems, "allowed origins must not be empty")
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if strings.TrimSpace(origin) == "" {
+			problems = append(problems, "allowed origins must not contain empty origins")
+			break
+		}
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin != "*" && strings.Contains(origin, "*") {
+			problems = append(problems, fmt.Sprintf("allowed origin %q may only be the wildcard on its own", origin))
+		}
+	}
+	if cfg.AllowCredentials {
+		for _, origin := range cfg.AllowedOrigins {
+			if origin == "*" {
+				problems = append(problems, "allowed origins must not contain the wildcard when credentials are allowed")
+				break
+			}
+		}
+	}
+	for _, method := range cfg.AllowedMethods {
+		if method == "" || strings.ContainsAny(method, " \t,") {
+			problems = append(problems, fmt.Sprintf("allowed methods contain an invalid method %q", method))
+		}
+	}
+	if cfg.MaxAgeSec < 0 {
+		problems = append(problems, fmt.Sprintf("max age must not be negative, got %d", cfg.MaxAgeSec))
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// handler wraps h in the policy. The allowed and exposed headers are fixed by
+// the API rather than configured.
+func (c CORSConfig) handler(h http.Handler) http.Handler {
+	methods := c.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	options := []handlers.CORSOption{
+		handlers.AllowedOrigins(c.AllowedOrigins),
+		handlers.AllowedMethods(methods),
+		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "X-Request-ID", "X-Idempotency-Key", "X-Client-ID", "X-Signature", "X-Timestamp"}),
+		handlers.ExposedHeaders([]string{"X-Anomaly-Detected", "X-Anomaly-Score", "X-Algorithm-Warning", "X-Request-ID", "X-Entropy-Screened", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Idempotent-Replay", "X-Operation-Latency-Us"}),
+	}
+	if c.MaxAgeSec > 0 {
+		options = append(options, handlers.MaxAge(c.MaxAgeSec))
+	}
+	if c.AllowCredentials {
+		options = append(options, handlers.AllowCredentials())
+	}
+	return handlers.CORS(options...)(h)
+}
+
+// splitList splits a comma-separated list, dropping the spaces around items
+func splitList(value string) []string {
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
@@ -0,0 +1,124 @@
+// Package server wires the API's routes and middleware together, so the
+// server and the integration test fixtures in testutil run the same stack.
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"pqcd/api"
+	"pqcd/security"
+)
+
+// Deps are what NewRouter builds the API around
+type Deps struct {
+	KeyStore *sql.DB
+	// Detector holds the anomaly thresholds and baseline. A new one is created
+	// if nil.
+	Detector *security.AnomalyDetector
+	// AlgorithmWarnings warns callers generating keys for algorithms with large
+	// public keys
+	AlgorithmWarnings bool
+	// EnableAI sends requests to the AI analysis service
+	EnableAI bool
+	// CORS is the cross-origin policy WithCORS applies. DefaultCORSConfig is
+	// used if nil.
+	CORS *CORSConfig
+}
+
+// Router is the API router along with the components its routes share, for
+// callers that configure them further
+type Router struct {
+	*mux.Router
+	API            *api.CryptoHandler
+	Auth           *security.Authenticator
+	Detector       *security.AnomalyDetector
+	ResponseEngine *security.ResponseEngine
+	cors           CORSConfig
+}
+
+// NewRouter registers every API route behind the server's middleware, in the
+// order requests pass through it: request IDs, the IP blocklist and allowlist,
+// signed requests, honeypot routes, authentication, throttling and, if
+// enabled, AI analysis
+func NewRouter(deps Deps) (*Router, error) {
+	cors := DefaultCORSConfig()
+	if deps.CORS != nil {
+		cors = *deps.CORS
+	}
+	if err := ValidateCORSConfig(cors); err != nil {
+		return nil, fmt.Errorf("invalid CORS configuration: %w", err)
+	}
+
+	r := mux.NewRouter()
+
+	// Every request gets an ID for its log lines and events, before anything
+	// else can log or reject it
+	r.Use(security.RequestIDMiddleware)
+
+	// Initialize the IP allowlist and blocklist. The blocklist runs first so
+	// blocked clients never reach the other layers.
+	acl := security.NewAccessControl(deps.KeyStore)
+	admin := r.PathPrefix("/api/admin").Subrouter()
+	acl.RegisterRoutes(admin)
+	admin.HandleFunc("/circuit-breaker/status", security.AnalysisCircuitBreaker().HandleStatus()).Methods("GET")
+
+	// Anomaly thresholds can be tuned through the admin API without a restart
+	detector := deps.Detector
+	if detector == nil {
+		detector = security.NewAnomalyDetector()
+	}
+	detector.RegisterRoutes(admin)
+	r.Use(security.NewBlocklistMiddleware(acl.Blocklist).Middleware)
+	r.Use(security.NewAllowlistMiddleware(acl.Allowlist).Middleware)
+
+	// Registered clients can sign their requests to skip anomaly detection
+	clients, err := security.NewClientRegistry(deps.KeyStore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize client registry: %w", err)
+	}
+	clients.RegisterRoutes(admin)
+	r.Use(security.NewRequestSignatureMiddleware(clients).Middleware)
+
+	// Honeypot endpoints record probes before authentication can reject them
+	r.Use(api.HoneypotMiddleware)
+
+	// Every /api endpoint but login needs a login token
+	auth, err := security.NewAuthenticator(deps.KeyStore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize authentication: %w", err)
+	}
+	auth.RegisterRoutes(r.PathPrefix("/api/auth").Subrouter())
+	auth.RegisterAdminRoutes(admin)
+	r.Use(security.NewAuthMiddleware(auth).Middleware)
+	admin.Use(security.RequireRole(security.RoleAdmin))
+
+	// Initialize API routes
+	responseEngine := security.NewResponseEngineWithDB(deps.KeyStore)
+	responseEngine.RegisterRoutes(admin)
+	security.NewAttackSimulator(detector, responseEngine).RegisterRoutes(admin)
+	r.Use(security.NewThrottleMiddleware(responseEngine).Middleware)
+	handler := api.RegisterRoutes(r, deps.KeyStore, responseEngine)
+	handler.SetAlgorithmWarnings(deps.AlgorithmWarnings)
+
+	if deps.EnableAI {
+		r.Use(security.NewAISecurityMiddleware().Middleware)
+	}
+
+	return &Router{
+		Router:         r,
+		API:            handler,
+		Auth:           auth,
+		Detector:       detector,
+		ResponseEngine: responseEngine,
+		cors:           cors,
+	}, nil
+}
+
+// WithCORS returns the router behind the CORS policy from Deps
+func (r *Router) WithCORS() http.Handler {
+	return r.cors.handler(r.Router)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pqcd/api"
+)
+
+func TestCORSConfigFromEnv(t *testing.T) {
+	config, err := CORSConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to load the default CORS config: %v", err)
+	}
+	if !reflect.DeepEqual(config, DefaultCORSConfig()) {
+		t.Errorf("Expected the default CORS config, got %+v", config)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example, https://b.example")
+	t.Setenv("CORS_ALLOWED_METHODS", "GET,POST")
+	t.Setenv("CORS_MAX_AGE_SEC", "300")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	config, err = CORSConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to load the CORS config: %v", err)
+	}
+	expected := CORSConfig{
+		AllowedOrigins:   []string{"https://a.example", "https://b.example"},
+		AllowedMethods:   []string{"GET", "POST"},
+		MaxAgeSec:        300,
+		AllowCredentials: true,
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, config)
+	}
+
+	// A wildcard can't be combined with credentials
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	if _, err := CORSConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "wildcard") {
+		t.Errorf("Expected the wildcard to be rejected with credentials, got %v", err)
+	}
+
+	// Every problem is reported at once
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://*.example")
+	t.Setenv("CORS_MAX_AGE_SEC", "soon")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "maybe")
+	_, err = CORSConfigFromEnv()
+	if err == nil {
+		t.Fatal("Expected the CORS config to be rejected")
+	}
+	for _, problem := range []string{"https://*.example", "CORS_MAX_AGE_SEC", "CORS_ALLOW_CREDENTIALS"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Expected the error to mention %s, got %v", problem, err)
+		}
+	}
+}
+
+func TestRouterCORS(t *testing.T) {
+	db, err := api.OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	defer db.Close()
+
+	invalid := CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+	if _, err := NewRouter(Deps{KeyStore: db, CORS: &invalid}); err == nil {
+		t.Error("Expected NewRouter to reject a wildcard origin with credentials")
+	}
+
+	config := CORSConfig{AllowedOrigins: []string{"https://app.example"}, AllowCredentials: true}
+	router, err := NewRouter(Deps{KeyStore: db, CORS: &config})
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	handler := router.WithCORS()
+
+	for _, test := range []struct {
+		origin, allowed string
+	}{
+		{"https://app.example", "https://app.example"},
+		{"https://evil.example", ""},
+	} {
+		req := httptest.NewRequest("OPTIONS", "/api/keys/generate", nil)
+		req.Header.Set("Origin", test.origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != test.allowed {
+			t.Errorf("Origin %s: Expected Access-Control-Allow-Origin %q, got %q", test.origin, test.allowed, got)
+		}
+		if test.allowed != "" && rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("Origin %s: Expected credentials to be allowed", test.origin)
+		}
+		if rec.Code != http.StatusOK {
+			t.Errorf("Origin %s: Expected preflight status %d, got %d", test.origin, http.StatusOK, rec.Code)
+		}
+	}
+}
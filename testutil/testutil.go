@@ -0,0 +1,147 @@
+// Package testutil provides the database, crypto and server fixtures shared by
+// integration tests. The api, crypto, security and server packages cannot use
+// it from their own tests, since it imports them.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pqcd/api"
+	"pqcd/crypto"
+	"pqcd/security"
+	"pqcd/server"
+)
+
+// MockKEMAlgorithm is the algorithm of the provider NewTestRegistry and
+// NewTestServer register on top of the built-in ones
+const MockKEMAlgorithm crypto.Algorithm = "test-mock-kem"
+
+// Credentials of the user NewTestServer registers, with the user role
+const (
+	TestUsername = "test"
+	TestPassword = "test password"
+)
+
+// MockKEM is ECDH under a name of its own, so tests can tell a registry they
+// set up apart from crypto.DefaultRegistry
+type MockKEM struct {
+	*crypto.ECDHProvider
+}
+
+// NewMockKEM creates the mock KEM provider
+func NewMockKEM() *MockKEM {
+	return &MockKEM{crypto.NewECDHProvider()}
+}
+
+// Name returns MockKEMAlgorithm
+func (p *MockKEM) Name() crypto.Algorithm {
+	return MockKEMAlgorithm
+}
+
+// Metadata returns the parameters of ECDH under MockKEMAlgorithm
+func (p *MockKEM) Metadata() crypto.AlgorithmMetadata {
+	metadata := p.ECDHProvider.Metadata()
+	metadata.Algorithm = MockKEMAlgorithm
+	return metadata
+}
+
+// KeyGen generates an ECDH key pair labelled MockKEMAlgorithm
+func (p *MockKEM) KeyGen(ctx context.Context) (crypto.KeyPair, error) {
+	keyPair, err := p.ECDHProvider.KeyGen(ctx)
+	keyPair.Algorithm = MockKEMAlgorithm
+	return keyPair, err
+}
+
+// NewTestDB opens an in-memory key store with every table the API needs and
+// closes it when the test ends
+func NewTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := api.OpenKeyStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// NewTestRegistry returns crypto.DefaultRegistry with MockKEM added
+func NewTestRegistry(t *testing.T) *crypto.Registry {
+	t.Helper()
+	registry := crypto.DefaultRegistry()
+	registry.RegisterKEMProvider(NewMockKEM())
+	return registry
+}
+
+// MustGenerateKeyPair generates a key pair with a provider of NewTestRegistry,
+// failing the test if that doesn't work
+func MustGenerateKeyPair(t *testing.T, alg crypto.Algorithm) crypto.KeyPair {
+	t.Helper()
+	registry := NewTestRegistry(t)
+	var provider crypto.CryptoProvider
+	if kem, err := registry.GetKEMProvider(alg); err == nil {
+		provider = kem
+	} else if sig, err := registry.GetSignatureProvider(alg); err == nil {
+		provider = sig
+	} else {
+		t.Fatalf("No provider for %s", alg)
+	}
+	keyPair, err := provider.KeyGen(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate %s key pair: %v", alg, err)
+	}
+	return keyPair
+}
+
+// NewTestServer serves the API on a fresh NewTestDB through server.NewRouter,
+// so it runs the same routes and middleware as the server with its default
+// flags: AI analysis is off and algorithm warnings are on. The user
+// TestUsername is registered, as is an admin user if ADMIN_PASSWORD is set,
+// and MockKEM is registered next to the built-in algorithms. The server is
+// closed when the test ends.
+func NewTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	router, err := server.NewRouter(server.Deps{
+		KeyStore:          NewTestDB(t),
+		AlgorithmWarnings: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	if err := router.Auth.Register(TestUsername, TestPassword, security.RoleUser); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	router.API.Registry().RegisterKEMProvider(NewMockKEM())
+
+	testServer := httptest.NewServer(router.WithCORS())
+	t.Cleanup(testServer.Close)
+	return testServer
+}
+
+// MustLogin logs in to a NewTestServer and returns the login token, failing
+// the test if the credentials are refused
+func MustLogin(t *testing.T, server *httptest.Server, username, password string) string {
+	t.Helper()
+	body, err := json.Marshal(security.LoginRequest{Username: username, Password: password})
+	if err != nil {
+		t.Fatalf("Failed to encode login request: %v", err)
+	}
+	resp, err := server.Client().Post(server.URL+"/api/auth/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Login request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Login as %s failed with status %d", username, resp.StatusCode)
+	}
+	var login security.LoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		t.Fatalf("Failed to decode login response: %v", err)
+	}
+	return login.Token
+}
@@ -0,0 +1,112 @@
+package testutil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"pqcd/api"
+	"pqcd/crypto"
+	"pqcd/security"
+)
+
+func TestNewTestRegistry(t *testing.T) {
+	registry := NewTestRegistry(t)
+	provider, err := registry.GetKEMProvider(MockKEMAlgorithm)
+	if err != nil {
+		t.Fatalf("Expected the mock KEM to be registered: %v", err)
+	}
+	if _, err := registry.GetKEMProvider(crypto.AlgMLKEM768); err != nil {
+		t.Errorf("Expected the built-in providers to be registered: %v", err)
+	}
+	if info, err := registry.AlgorithmInfo(MockKEMAlgorithm); err != nil || info.Algorithm != MockKEMAlgorithm {
+		t.Errorf("Expected metadata for %s, got %+v %v", MockKEMAlgorithm, info, err)
+	}
+
+	keyPair := MustGenerateKeyPair(t, MockKEMAlgorithm)
+	if keyPair.Algorithm != MockKEMAlgorithm {
+		t.Errorf("Expected a %s key pair, got %s", MockKEMAlgorithm, keyPair.Algorithm)
+	}
+	ctx := context.Background()
+	ciphertext, secret, err := provider.Encapsulate(ctx, keyPair.PublicKey)
+	if err != nil {
+		t.Fatalf("Encapsulate failed: %v", err)
+	}
+	recovered, err := provider.Decapsulate(ctx, keyPair.PrivateKey, ciphertext)
+	if err != nil || !crypto.SecureCompare(secret, recovered) {
+		t.Errorf("Expected the mock KEM to recover the shared secret, got %v", err)
+	}
+
+	if signing := MustGenerateKeyPair(t, crypto.AlgMLDSA44); signing.Algorithm != crypto.AlgMLDSA44 {
+		t.Errorf("Expected an %s key pair, got %s", crypto.AlgMLDSA44, signing.Algorithm)
+	}
+}
+
+func TestNewTestDB(t *testing.T) {
+	db := NewTestDB(t)
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM key_pairs").Scan(&count); err != nil || count != 0 {
+		t.Errorf("Expected an empty key_pairs table, got %d %v", count, err)
+	}
+}
+
+func TestNewTestServer(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "admin password")
+	server := NewTestServer(t)
+
+	resp, err := server.Client().Get(server.URL + "/api/status/algorithms")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	token := MustLogin(t, server, TestUsername, TestPassword)
+	req, _ := http.NewRequest("GET", server.URL+"/api/status/algorithms", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if resp.Header.Get(security.RequestIDHeader) == "" {
+		t.Error("Expected the response to carry a request ID")
+	}
+	var status api.AlgorithmStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	found := false
+	for _, algorithm := range status.Algorithms {
+		found = found || algorithm.Name == MockKEMAlgorithm
+	}
+	if !found {
+		t.Errorf("Expected %s among the server's algorithms", MockKEMAlgorithm)
+	}
+
+	// The admin routes main registers are there too
+	adminToken := MustLogin(t, server, "admin", "admin password")
+	for _, route := range []struct{ method, path, body string }{
+		{"GET", "/api/admin/anomaly-config", ""},
+		{"POST", "/api/admin/simulate-attack", `{"attack_type":"low_entropy","source_ip":"203.0.113.7"}`},
+	} {
+		req, _ := http.NewRequest(route.method, server.URL+route.path, strings.NewReader(route.body))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request to %s failed: %v", route.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status %d from %s %s, got %d", http.StatusOK, route.method, route.path, resp.StatusCode)
+		}
+	}
+}